@@ -0,0 +1,64 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Key permissions. Source: include/uapi/linux/keyctl.h and
+// include/linux/key.h.
+const (
+	KEY_POS_VIEW    = 0x01000000
+	KEY_POS_READ    = 0x02000000
+	KEY_POS_WRITE   = 0x04000000
+	KEY_POS_SEARCH  = 0x08000000
+	KEY_POS_LINK    = 0x10000000
+	KEY_POS_SETATTR = 0x20000000
+	KEY_POS_ALL     = 0x3f000000
+
+	KEY_USR_VIEW    = 0x00010000
+	KEY_USR_READ    = 0x00020000
+	KEY_USR_WRITE   = 0x00040000
+	KEY_USR_SEARCH  = 0x00080000
+	KEY_USR_LINK    = 0x00100000
+	KEY_USR_SETATTR = 0x00200000
+	KEY_USR_ALL     = 0x003f0000
+
+	KEY_GRP_VIEW    = 0x00000100
+	KEY_GRP_READ    = 0x00000200
+	KEY_GRP_WRITE   = 0x00000400
+	KEY_GRP_SEARCH  = 0x00000800
+	KEY_GRP_LINK    = 0x00001000
+	KEY_GRP_SETATTR = 0x00002000
+	KEY_GRP_ALL     = 0x00003f00
+
+	KEY_OTH_VIEW    = 0x00000001
+	KEY_OTH_READ    = 0x00000002
+	KEY_OTH_WRITE   = 0x00000004
+	KEY_OTH_SEARCH  = 0x00000008
+	KEY_OTH_LINK    = 0x00000010
+	KEY_OTH_SETATTR = 0x00000020
+	KEY_OTH_ALL     = 0x0000003f
+)
+
+// Default key quotas. Source: security/keys/key.c.
+const (
+	// KEY_QUOTA_ROOT_MAXKEYS and KEY_QUOTA_ROOT_MAXBYTES are the quotas of
+	// the root user, from /proc/sys/kernel/keys/root_max{keys,bytes}.
+	KEY_QUOTA_ROOT_MAXKEYS  = 1000000
+	KEY_QUOTA_ROOT_MAXBYTES = 25000000
+
+	// KEY_QUOTA_MAXKEYS and KEY_QUOTA_MAXBYTES are the quotas of other
+	// users, from /proc/sys/kernel/keys/max{keys,bytes}.
+	KEY_QUOTA_MAXKEYS  = 200
+	KEY_QUOTA_MAXBYTES = 20000
+)
@@ -123,3 +123,9 @@ const (
 
 	MPOL_MF_VALID = MPOL_MF_STRICT | MPOL_MF_MOVE | MPOL_MF_MOVE_ALL
 )
+
+// Bounds of oom_score_adj, from include/uapi/linux/oom.h.
+const (
+	OOM_SCORE_ADJ_MIN = -1000
+	OOM_SCORE_ADJ_MAX = 1000
+)
@@ -165,6 +165,27 @@ type IPTIP struct {
 // SizeOfIPTIP is the size of an IPTIP.
 const SizeOfIPTIP = 84
 
+// Flags in IPTIP.InverseFlags. Corresponding constants are in
+// include/uapi/linux/netfilter_ipv4/ip_tables.h.
+const (
+	// Invert the meaning of InputInterface.
+	IPT_INV_VIA_IN = 0x01
+	// Invert the meaning of OutputInterface.
+	IPT_INV_VIA_OUT = 0x02
+	// Unclear what this is, as no references to it exist in the kernel.
+	IPT_INV_TOS = 0x04
+	// Invert the meaning of Src.
+	IPT_INV_SRCIP = 0x08
+	// Invert the meaning of Dst.
+	IPT_INV_DSTIP = 0x10
+	// Invert the meaning of the IPT_F_FRAG flag.
+	IPT_INV_FRAG = 0x20
+	// Invert the meaning of the Protocol field.
+	IPT_INV_PROTO = 0x40
+	// Enable all flags.
+	IPT_INV_MASK = 0x7F
+)
+
 // XTCounters holds packet and byte counts for a rule. It corresponds to struct
 // xt_counters in include/uapi/linux/netfilter/x_tables.h.
 type XTCounters struct {
@@ -250,6 +271,33 @@ type XTErrorTarget struct {
 // SizeOfXTErrorTarget is the size of an XTErrorTarget.
 const SizeOfXTErrorTarget = 64
 
+// XTRejectTarget drops packets and sends a response to their source. It
+// corresponds to struct ipt_reject_info in
+// include/uapi/linux/netfilter_ipv4/ipt_REJECT.h, preceded by the
+// xt_entry_target holding it.
+type XTRejectTarget struct {
+	Target     XTEntryTarget
+	RejectWith uint32
+	_          [4]byte
+}
+
+// SizeOfXTRejectTarget is the size of an XTRejectTarget.
+const SizeOfXTRejectTarget = 40
+
+// Values of XTRejectTarget.RejectWith. Corresponding constants are in
+// include/uapi/linux/netfilter_ipv4/ipt_REJECT.h.
+const (
+	IPT_ICMP_NET_UNREACHABLE = iota
+	IPT_ICMP_HOST_UNREACHABLE
+	IPT_ICMP_PROT_UNREACHABLE
+	IPT_ICMP_PORT_UNREACHABLE
+	IPT_ICMP_ECHOREPLY
+	IPT_ICMP_NET_PROHIBITED
+	IPT_ICMP_HOST_PROHIBITED
+	IPT_TCP_RESET
+	IPT_ICMP_ADMIN_PROHIBITED
+)
+
 // IPTGetinfo is the argument for the IPT_SO_GET_INFO sockopt. It corresponds
 // to struct ipt_getinfo in include/uapi/linux/netfilter_ipv4/ip_tables.h.
 type IPTGetinfo struct {
@@ -440,3 +488,79 @@ const (
 	// Enable all flags.
 	XT_UDP_INV_MASK = 0x03
 )
+
+// XTStatisticInfo holds data for matching a share of packets. It corresponds
+// to struct xt_statistic_info in include/uapi/linux/netfilter/xt_statistic.h.
+//
+// The kernel struct holds the mode-specific fields in a union: u.random's
+// probability shares its bytes with u.nth's every. Use Probability and
+// SetProbability in random mode.
+type XTStatisticInfo struct {
+	// Mode is the mode of the match. See the XT_STATISTIC_MODE_* values.
+	Mode uint16
+
+	// Flags modifies the match. See XT_STATISTIC_INVERT.
+	Flags uint16
+
+	// Every is one less than the period of the match in nth mode: every
+	// (Every+1)th packet matches.
+	Every uint32
+
+	// Packet is the offset of the first matching packet in nth mode.
+	Packet uint32
+
+	// Count is the initial value of the packet counter in nth mode.
+	Count uint32
+
+	// Master is a kernel pointer to the shared state of the match. Its
+	// value in userspace is meaningless.
+	Master uint64
+}
+
+// SizeOfXTStatisticInfo is the size of an XTStatisticInfo.
+const SizeOfXTStatisticInfo = 24
+
+// Probability returns u.random.probability, the probability of matching in
+// random mode, scaled so that 0x80000000 means always.
+func (s *XTStatisticInfo) Probability() uint32 {
+	return s.Every
+}
+
+// SetProbability sets u.random.probability. See Probability.
+func (s *XTStatisticInfo) SetProbability(p uint32) {
+	s.Every = p
+}
+
+// Values for XTStatisticInfo.Mode, from enum xt_statistic_mode.
+const (
+	XT_STATISTIC_MODE_RANDOM = 0
+	XT_STATISTIC_MODE_NTH    = 1
+)
+
+// Flags in XTStatisticInfo.Flags, from enum xt_statistic_flags.
+const (
+	// Invert the result of the match.
+	XT_STATISTIC_INVERT = 0x1
+)
+
+// XTStateInfo holds data for matching packets by the state of their tracked
+// connection. It corresponds to struct xt_state_info in
+// include/uapi/linux/netfilter/xt_state.h.
+type XTStateInfo struct {
+	// StateMask is the set of matching states. See the XT_STATE_* values.
+	StateMask uint32
+}
+
+// SizeOfXTStateInfo is the size of an XTStateInfo.
+const SizeOfXTStateInfo = 4
+
+// Bits in XTStateInfo.StateMask. Corresponding constants are in
+// include/uapi/linux/netfilter/xt_state.h, where the bit of each state in
+// enum ip_conntrack_info is XT_STATE_BIT(state).
+const (
+	XT_STATE_INVALID     = 1 << 0
+	XT_STATE_ESTABLISHED = 1 << 1
+	XT_STATE_RELATED     = 1 << 2
+	XT_STATE_NEW         = 1 << 3
+	XT_STATE_UNTRACKED   = 1 << 6
+)
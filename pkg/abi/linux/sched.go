@@ -34,3 +34,12 @@ const (
 	PRIO_PROCESS = 0x0
 	PRIO_USER    = 0x2
 )
+
+// Nice values, from include/linux/sched/prio.h.
+const (
+	MIN_NICE = -20
+	MAX_NICE = 19
+
+	// DEFAULT_PRIO is the kernel priority of tasks with a nice value of 0.
+	DEFAULT_PRIO = 120
+)
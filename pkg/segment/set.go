@@ -92,6 +92,10 @@ const (
 // +stateify savable
 type Set struct {
 	root node `state:".(*SegmentDataSlices)"`
+
+	// nrSegments is the number of segments in the set. It is recomputed
+	// when the set is restored.
+	nrSegments int `state:"nosave"`
 }
 
 // IsEmpty returns true if the set contains no segments.
@@ -99,6 +103,11 @@ func (s *Set) IsEmpty() bool {
 	return s.root.nrSegments == 0
 }
 
+// NumSegments returns the number of segments in the set.
+func (s *Set) NumSegments() int {
+	return s.nrSegments
+}
+
 // IsEmptyRange returns true iff no segments in the set overlap the given
 // range. This is semantically equivalent to s.SpanRange(r) == 0, but may be
 // more efficient.
@@ -378,6 +387,7 @@ func (s *Set) InsertWithoutMergingUnchecked(gap GapIterator, r Range, val Value)
 	gap.node.keys[gap.index] = r
 	gap.node.values[gap.index] = val
 	gap.node.nrSegments++
+	s.nrSegments++
 	return Iterator{gap.node, gap.index}
 }
 
@@ -405,6 +415,7 @@ func (s *Set) Remove(seg Iterator) GapIterator {
 	copy(seg.node.values[seg.index:], seg.node.values[seg.index+1:seg.node.nrSegments])
 	Functions{}.ClearValue(&seg.node.values[seg.node.nrSegments-1])
 	seg.node.nrSegments--
+	s.nrSegments--
 	return seg.node.rebalanceAfterRemove(GapIterator{seg.node, seg.index})
 }
 
@@ -412,6 +423,7 @@ func (s *Set) Remove(seg Iterator) GapIterator {
 // invalidated.
 func (s *Set) RemoveAll() {
 	s.root = node{}
+	s.nrSegments = 0
 }
 
 // RemoveRange removes all segments in the given range. An iterator to the
@@ -51,8 +51,8 @@ func randPermutation(size int) []int {
 }
 
 // checkSet returns an error if s is incorrectly sorted, does not contain
-// exactly expectedSegments segments, or contains a segment for which val !=
-// key + valueOffset.
+// exactly expectedSegments segments, miscounts its segments, or contains a
+// segment for which val != key + valueOffset.
 func checkSet(s *Set, expectedSegments int) error {
 	havePrev := false
 	prev := 0
@@ -72,6 +72,9 @@ func checkSet(s *Set, expectedSegments int) error {
 	if nrSegments != expectedSegments {
 		return fmt.Errorf("incorrect number of segments: got %d, wanted %d", nrSegments, expectedSegments)
 	}
+	if got := s.NumSegments(); got != nrSegments {
+		return fmt.Errorf("incorrect NumSegments: got %d, wanted %d", got, nrSegments)
+	}
 	return nil
 }
 
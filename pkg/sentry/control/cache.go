@@ -0,0 +1,38 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// Cache includes RPC stubs to inspect and trim the caches registered with the
+// kernel as kernel.CacheDebugger, e.g. to hunt for leaked dentries.
+type Cache struct {
+	Kernel *kernel.Kernel
+}
+
+// Stats returns the stats of every registered cache, keyed by cache name.
+func (c *Cache) Stats(_ *struct{}, stats *map[string]string) error {
+	*stats = c.Kernel.CacheStats()
+	return nil
+}
+
+// Trim trims every registered cache and returns the number of entries
+// released.
+func (c *Cache) Trim(_ *struct{}, trimmed *int) error {
+	*trimmed = c.Kernel.TrimCaches()
+	return nil
+}
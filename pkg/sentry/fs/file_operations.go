@@ -15,6 +15,7 @@
 package fs
 
 import (
+	"bytes"
 	"io"
 
 	"gvisor.dev/gvisor/pkg/context"
@@ -173,3 +174,12 @@ type FifoSizer interface {
 	// The new size is returned (which may be capped).
 	SetFifoSize(size int64) (int64, error)
 }
+
+// FDInfoWriter is an optional interface that may be implemented by
+// FileOperations whose /proc/[pid]/fdinfo/[fd] files show lines specific to
+// their type, such as inotify instances.
+type FDInfoWriter interface {
+	// WriteFDInfo writes the lines specific to the file's type to buf. They
+	// follow the lines common to all files, e.g. "flags:".
+	WriteFDInfo(ctx context.Context, buf *bytes.Buffer)
+}
@@ -15,7 +15,10 @@
 package fs
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"sort"
 	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -222,6 +225,30 @@ func (i *Inotify) Ioctl(ctx context.Context, _ *File, io usermem.IO, args arch.S
 	}
 }
 
+// WriteFDInfo implements FDInfoWriter.WriteFDInfo. Like Linux's
+// fs/notify/fdinfo.c:inotify_show_fdinfo(), it shows one line per watch.
+// File handles aren't shown, since they aren't supported.
+func (i *Inotify) WriteFDInfo(ctx context.Context, buf *bytes.Buffer) {
+	i.mu.Lock()
+	watches := make([]*Watch, 0, len(i.watches))
+	for _, w := range i.watches {
+		watches = append(watches, w)
+	}
+	i.mu.Unlock()
+	sort.Slice(watches, func(a, b int) bool {
+		return watches[a].wd < watches[b].wd
+	})
+
+	for _, w := range watches {
+		// s_dev is shown in the kernel's internal encoding, see
+		// include/linux/kdev_t.h:MKDEV().
+		major, minor := linux.DecodeDeviceID(uint32(w.target.StableAttr.DeviceID))
+		sdev := uint32(major)<<20 | minor
+		mask := atomic.LoadUint32(&w.mask) & linux.IN_ALL_EVENTS
+		fmt.Fprintf(buf, "inotify wd:%x ino:%x sdev:%x mask:%x ignored_mask:0\n", w.wd, w.target.StableAttr.InodeID, sdev, mask)
+	}
+}
+
 func (i *Inotify) queueEvent(ev *Event) {
 	i.evMu.Lock()
 
@@ -40,6 +40,12 @@ const (
 	environExecArg
 )
 
+// maxExecArgsLen is the maximum number of bytes of an exec arg vector that are
+// returned by a single read. The bounds of the vectors can be changed by the
+// task, e.g. with prctl(PR_SET_MM), so this bounds the memory needed to serve
+// a read.
+const maxExecArgsLen = 2 << 20
+
 // execArgInode is a inode containing the exec args (either cmdline or environ)
 // for a given task.
 //
@@ -136,6 +142,9 @@ func (f *execArgFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequen
 	}
 
 	length := int(execArgEnd - start)
+	if length > maxExecArgsLen {
+		length = maxExecArgsLen
+	}
 	if dstlen := dst.NumBytes(); int64(length) > dstlen {
 		length = int(dstlen)
 	}
@@ -15,6 +15,7 @@
 package proc
 
 import (
+	"bytes"
 	"fmt"
 	"sort"
 	"strconv"
@@ -112,8 +113,12 @@ func (f *fd) GetFile(context.Context, *fs.Dirent, fs.FileFlags) (*fs.File, error
 	return f.file, nil
 }
 
-// Readlink returns the current target.
+// Readlink returns the current target. Files that aren't in the filesystem
+// tree are named by pseudoName.
 func (f *fd) Readlink(ctx context.Context, _ *fs.Inode) (string, error) {
+	if name, ok := pseudoName(f.file.Dirent); ok {
+		return name, nil
+	}
 	root := fs.RootFromContext(ctx)
 	if root != nil {
 		defer root.DecRef()
@@ -122,6 +127,31 @@ func (f *fd) Readlink(ctx context.Context, _ *fs.Inode) (string, error) {
 	return n, nil
 }
 
+// pseudoName returns the name standing in for the pathname of d if d isn't in
+// the filesystem tree, as Linux does for /proc/[pid]/fd/N: "pipe:[ino]" for
+// pipes, "socket:[ino]" for sockets, and "anon_inode:..." for anonymous inodes
+// such as eventfds, which are named by their Dirent. Pipes and sockets are
+// named by their inode number rather than their Dirent, so that the name
+// always matches st_ino.
+func pseudoName(d *fs.Dirent) (string, bool) {
+	// Named pipes and bound sockets are in the filesystem tree, and are
+	// named by their pathname.
+	if !d.IsRoot() {
+		return "", false
+	}
+	sattr := d.Inode.StableAttr
+	switch sattr.Type {
+	case fs.Pipe:
+		return fmt.Sprintf("pipe:[%d]", sattr.InodeID), true
+	case fs.Socket:
+		return fmt.Sprintf("socket:[%d]", sattr.InodeID), true
+	case fs.Anonymous:
+		return d.BaseName(), true
+	default:
+		return "", false
+	}
+}
+
 // Getlink implements fs.InodeOperations.Getlink.
 func (f *fd) Getlink(context.Context, *fs.Inode) (*fs.Dirent, error) {
 	f.file.Dirent.IncRef()
@@ -258,12 +288,17 @@ func (fdid *fdInfoDir) Lookup(ctx context.Context, dir *fs.Inode, p string) (*fs
 		// data can be out-of-date if, for instance, the flags on the
 		// FD change before we read this file. We should switch to
 		// generating the data on Read(). Also, we should include pos,
-		// locks, and other data.  For now we only have flags.
+		// locks, and other data.  For now we only have flags and the
+		// lines specific to the file's type, see fs.FDInfoWriter.
 		// See https://www.kernel.org/doc/Documentation/filesystems/proc.txt
 		flags := file.Flags().ToLinux() | fdFlags.ToLinuxFileFlags()
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "flags:\t0%o\n", flags)
+		if w, ok := file.FileOperations.(fs.FDInfoWriter); ok {
+			w.WriteFDInfo(ctx, &buf)
+		}
 		file.DecRef()
-		contents := []byte(fmt.Sprintf("flags:\t0%o\n", flags))
-		return newStaticProcInode(ctx, dir.MountSource, contents)
+		return newStaticProcInode(ctx, dir.MountSource, buf.Bytes())
 	})
 	if err != nil {
 		return nil, err
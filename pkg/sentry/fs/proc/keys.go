@@ -0,0 +1,116 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// LINT.IfChange
+
+// keysData backs /proc/keys.
+//
+// +stateify savable
+type keysData struct {
+	k *kernel.Kernel
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*keysData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *keysData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	creds := auth.CredentialsFromContext(ctx)
+	var data []seqfile.SeqData
+	for _, key := range d.k.Keys().ViewableKeys(creds) {
+		var buf bytes.Buffer
+		// See fsimpl/proc.writeKey.
+		fmt.Fprintf(&buf, "%08x %s %5d %4s %08x %5d %5d %-9.9s %s: empty\n",
+			key.ID,
+			"I--Q---",
+			1,
+			"perm",
+			key.Perm,
+			key.UID.In(creds.UserNamespace).OrOverflow(),
+			key.GID.In(creds.UserNamespace).OrOverflow(),
+			key.Type,
+			key.Description)
+		data = append(data, seqfile.SeqData{
+			Buf:    buf.Bytes(),
+			Handle: (*keysData)(nil),
+		})
+	}
+	return data, 0
+}
+
+// keyUsersData backs /proc/key-users.
+//
+// +stateify savable
+type keyUsersData struct {
+	k *kernel.Kernel
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*keyUsersData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *keyUsersData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	var data []seqfile.SeqData
+	for _, user := range d.k.Keys().Users() {
+		uid := user.UID.In(userns)
+		if !uid.Ok() {
+			continue
+		}
+		maxKeys, maxBytes := linux.KEY_QUOTA_MAXKEYS, linux.KEY_QUOTA_MAXBYTES
+		if user.UID == auth.RootKUID {
+			maxKeys, maxBytes = linux.KEY_QUOTA_ROOT_MAXKEYS, linux.KEY_QUOTA_ROOT_MAXBYTES
+		}
+		var buf bytes.Buffer
+		// See fsimpl/proc.writeKeyUser.
+		fmt.Fprintf(&buf, "%5d: %5d %d/%d %d/%d %d/%d\n",
+			uid.OrOverflow(),
+			user.Keys,
+			user.Keys, user.Keys,
+			user.Keys, maxKeys,
+			user.Bytes, maxBytes)
+		data = append(data, seqfile.SeqData{
+			Buf:    buf.Bytes(),
+			Handle: (*keyUsersData)(nil),
+		})
+	}
+	return data, 0
+}
+
+// LINT.ThenChange(../../fsimpl/proc/tasks_files.go)
@@ -18,13 +18,16 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"reflect"
+	"sort"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
@@ -45,8 +48,9 @@ func (p *proc) newNetDir(ctx context.Context, k *kernel.Kernel, msrc *fs.MountSo
 	var contents map[string]*fs.Inode
 	if s := p.k.NetworkStack(); s != nil {
 		contents = map[string]*fs.Inode{
-			"dev":  seqfile.NewSeqFileInode(ctx, &netDev{s: s}, msrc),
-			"snmp": seqfile.NewSeqFileInode(ctx, &netSnmp{s: s}, msrc),
+			"dev":       seqfile.NewSeqFileInode(ctx, &netDev{s: s}, msrc),
+			"dev_mcast": seqfile.NewSeqFileInode(ctx, &netDevMcast{s: s}, msrc),
+			"snmp":      seqfile.NewSeqFileInode(ctx, &netSnmp{s: s}, msrc),
 
 			// The following files are simple stubs until they are
 			// implemented in netstack, if the file contains a
@@ -67,11 +71,25 @@ func (p *proc) newNetDir(ctx context.Context, k *kernel.Kernel, msrc *fs.MountSo
 			"tcp":    seqfile.NewSeqFileInode(ctx, &netTCP{k: k}, msrc),
 			"udp":    seqfile.NewSeqFileInode(ctx, &netUDP{k: k}, msrc),
 			"unix":   seqfile.NewSeqFileInode(ctx, &netUnix{k: k}, msrc),
+
+			// Netstack doesn't support VLAN subinterfaces, so
+			// vlan/config only contains its header.
+			"vlan": newProcInode(ctx, ramfs.NewDir(ctx, map[string]*fs.Inode{
+				"config": newStaticProcInode(ctx, msrc, []byte("VLAN Dev name	 | VLAN ID\nName-Type: VLAN_NAME_TYPE_RAW_PLUS_VID_NO_PAD\n")),
+			}, fs.RootOwner, fs.FilePermsFromMode(0555)), msrc, fs.SpecialDirectory, nil),
+		}
+
+		if _, err := s.ConnTrackEntries(); err == nil {
+			// Like Linux, only allow root to list tracked connections.
+			ct := seqfile.NewSeqFile(ctx, &netConnTrack{s: s})
+			ct.InodeSimpleAttributes = fsutil.NewInodeSimpleAttributes(ctx, fs.RootOwner, fs.FilePermsFromMode(0440), linux.PROC_SUPER_MAGIC)
+			contents["nf_conntrack"] = newProcInode(ctx, ct, msrc, fs.SpecialFile, nil)
 		}
 
 		if s.SupportsIPv6() {
 			contents["if_inet6"] = seqfile.NewSeqFileInode(ctx, &ifinet6{s: s}, msrc)
 			contents["ipv6_route"] = newStaticProcInode(ctx, msrc, []byte(""))
+			contents["snmp6"] = seqfile.NewSeqFileInode(ctx, &netSnmp6{s: s}, msrc)
 			contents["tcp6"] = seqfile.NewSeqFileInode(ctx, &netTCP6{k: k}, msrc)
 			contents["udp6"] = newStaticProcInode(ctx, msrc, []byte("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"))
 		}
@@ -201,6 +219,46 @@ func (n *netDev) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]se
 	return data, 0
 }
 
+// netDevMcast implements seqfile.SeqSource for /proc/net/dev_mcast.
+//
+// +stateify savable
+type netDevMcast struct {
+	s inet.Stack
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (n *netDevMcast) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/core/net-procfs.c:dev_mc_seq_show.
+func (n *netDevMcast) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	interfaces := n.s.Interfaces()
+	ids := make([]int32, 0, len(interfaces))
+	for id := range interfaces {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var data []seqfile.SeqData
+	for _, id := range ids {
+		i := interfaces[id]
+		for _, a := range i.MulticastAddrs {
+			// Netstack has no global multicast addresses, so the
+			// global users column is always 0.
+			l := fmt.Sprintf("%-4d %-15s %-5d %-5d %x\n", id, i.Name, a.Users, 0, a.Addr)
+			data = append(data, seqfile.SeqData{Buf: []byte(l), Handle: (*netDevMcast)(nil)})
+		}
+	}
+
+	return data, 0
+}
+
 // netSnmp implements seqfile.SeqSource for /proc/net/snmp.
 //
 // +stateify savable
@@ -313,6 +371,120 @@ func (n *netSnmp) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]s
 	return data, 0
 }
 
+// netSnmp6 implements seqfile.SeqSource for /proc/net/snmp6.
+//
+// +stateify savable
+type netSnmp6 struct {
+	s inet.Stack
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (n *netSnmp6) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// The names of the counters of /proc/net/snmp6, without their prefix. See
+// Linux's net/ipv6/proc.c.
+var (
+	snmp6IP = []string{
+		"InReceives", "InHdrErrors", "InTooBigErrors", "InNoRoutes", "InAddrErrors", "InUnknownProtos", "InTruncatedPkts", "InDiscards",
+		"InDelivers", "OutForwDatagrams", "OutRequests", "OutDiscards", "OutNoRoutes", "ReasmTimeout", "ReasmReqds", "ReasmOKs",
+		"ReasmFails", "FragOKs", "FragFails", "FragCreates", "InMcastPkts", "OutMcastPkts", "InOctets", "OutOctets",
+		"InMcastOctets", "OutMcastOctets", "InBcastOctets", "OutBcastOctets", "InNoECTPkts", "InECT1Pkts", "InECT0Pkts", "InCEPkts",
+	}
+	snmp6ICMP = []string{"InMsgs", "InErrors", "OutMsgs", "OutErrors", "InCsumErrors"}
+	snmp6UDP  = []string{"InDatagrams", "NoPorts", "InErrors", "OutDatagrams", "RcvbufErrors", "SndbufErrors", "InCsumErrors", "IgnoredMulti"}
+
+	// icmp6TypeNames are the names of the ICMPv6 message types that have
+	// named counters.
+	icmp6TypeNames = [256]string{
+		1:   "DestUnreachs",
+		2:   "PktTooBigs",
+		3:   "TimeExcds",
+		4:   "ParmProblems",
+		128: "Echos",
+		129: "EchoReplies",
+		130: "GroupMembQueries",
+		131: "GroupMembResponses",
+		132: "GroupMembReductions",
+		133: "RouterSolicits",
+		134: "RouterAdvertisements",
+		135: "NeighborSolicits",
+		136: "NeighborAdvertisements",
+		137: "Redirects",
+		143: "MLDv2Reports",
+	}
+)
+
+// statistics fills stat with the counters of the stack, leaving it zeroed if
+// they aren't available, and returns them as a slice.
+func (n *netSnmp6) statistics(stat interface{}, prefix string) []uint64 {
+	if err := n.s.Statistics(stat, prefix); err != nil {
+		if err == syserror.EOPNOTSUPP {
+			log.Infof("Failed to retrieve %s of /proc/net/snmp6: %v", prefix, err)
+		} else {
+			log.Warningf("Failed to retrieve %s of /proc/net/snmp6: %v", prefix, err)
+		}
+	}
+	return toSlice(stat)
+}
+
+// contents returns the lines of /proc/net/snmp6.
+func (n *netSnmp6) contents() []string {
+	var lines []string
+	counter := func(name string, v uint64) {
+		lines = append(lines, fmt.Sprintf("%-32s\t%d\n", name, v))
+	}
+	counters := func(prefix string, names []string, values []uint64) {
+		for i, name := range names {
+			counter(prefix+name, values[i])
+		}
+	}
+	counters("Ip6", snmp6IP, n.statistics(&inet.StatSNMP6IP{}, "Ip6"))
+	counters("Icmp6", snmp6ICMP, n.statistics(&inet.StatSNMP6ICMP{}, "Icmp6"))
+
+	// Message types with a name are always listed by name, and all types
+	// with a nonzero counter are listed by number.
+	msgs := n.statistics(&inet.StatSNMP6ICMPMSG{}, "Icmp6Msg")
+	for i, v := range msgs {
+		if name := icmp6TypeNames[i&0xff]; name != "" {
+			counter("Icmp6"+icmp6Direction(i)+name, v)
+		}
+	}
+	for i, v := range msgs {
+		if v != 0 {
+			counter(fmt.Sprintf("Icmp6%sType%d", icmp6Direction(i), i&0xff), v)
+		}
+	}
+
+	counters("Udp6", snmp6UDP, n.statistics(&inet.StatSNMP6UDP{}, "Udp6"))
+	counters("UdpLite6", snmp6UDP, n.statistics(&inet.StatSNMP6UDPLite{}, "UdpLite6"))
+	return lines
+}
+
+// icmp6Direction returns the direction of the messages counted at index i of
+// inet.StatSNMP6ICMPMSG.
+func icmp6Direction(i int) string {
+	if i&0x100 != 0 {
+		return "Out"
+	}
+	return "In"
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData. See Linux's
+// net/ipv6/proc.c:snmp6_seq_show.
+func (n *netSnmp6) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var data []seqfile.SeqData
+	for _, l := range n.contents() {
+		data = append(data, seqfile.SeqData{Buf: []byte(l), Handle: (*netSnmp6)(nil)})
+	}
+	return data, 0
+}
+
 // netRoute implements seqfile.SeqSource for /proc/net/route.
 //
 // +stateify savable
@@ -388,6 +560,78 @@ func (n *netRoute) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]
 	return data, 0
 }
 
+// netConnTrack implements seqfile.SeqSource for /proc/net/nf_conntrack.
+//
+// +stateify savable
+type netConnTrack struct {
+	s inet.Stack
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (n *netConnTrack) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+// See Linux's net/netfilter/nf_conntrack_standalone.c:ct_seq_show.
+func (n *netConnTrack) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	entries, err := n.s.ConnTrackEntries()
+	if err != nil {
+		return nil, 0
+	}
+	var data []seqfile.SeqData
+	for _, e := range entries {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%-8s %d %-8s %d %d ", "ipv4", linux.AF_INET, connTrackProtocolName(e.Protocol), e.Protocol, int64(e.Timeout/time.Second))
+		if e.State != "" {
+			fmt.Fprintf(&buf, "%s ", e.State)
+		}
+		writeConnTrackTuple(&buf, e.Protocol, e.Original)
+		if !e.Replied {
+			buf.WriteString("[UNREPLIED] ")
+		}
+		writeConnTrackTuple(&buf, e.Protocol, e.Reply)
+		if e.Assured {
+			buf.WriteString("[ASSURED] ")
+		}
+		// Marks, zones and references aren't supported; print the
+		// values of an unmarked connection in the default zone.
+		buf.WriteString("mark=0 zone=0 use=2\n")
+		data = append(data, seqfile.SeqData{Buf: buf.Bytes(), Handle: (*netConnTrack)(nil)})
+	}
+	return data, 0
+}
+
+// connTrackProtocolName returns the name of the transport protocol proto in
+// /proc/net/nf_conntrack.
+func connTrackProtocolName(proto uint8) string {
+	switch proto {
+	case linux.IPPROTO_TCP:
+		return "tcp"
+	case linux.IPPROTO_UDP:
+		return "udp"
+	case linux.IPPROTO_ICMP:
+		return "icmp"
+	default:
+		return "unknown"
+	}
+}
+
+// writeConnTrackTuple writes t, a tuple of a connection of protocol proto, to
+// buf.
+func writeConnTrackTuple(buf *bytes.Buffer, proto uint8, t inet.ConnTrackTuple) {
+	fmt.Fprintf(buf, "src=%s dst=%s ", net.IP(t.SrcAddr), net.IP(t.DstAddr))
+	if proto == linux.IPPROTO_ICMP {
+		fmt.Fprintf(buf, "type=%d code=%d id=%d ", t.ICMPType, t.ICMPCode, t.SrcPort)
+		return
+	}
+	fmt.Fprintf(buf, "sport=%d dport=%d ", t.SrcPort, t.DstPort)
+}
+
 // netUnix implements seqfile.SeqSource for /proc/net/unix.
 //
 // +stateify savable
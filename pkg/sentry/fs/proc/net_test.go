@@ -16,10 +16,12 @@ package proc
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 func newIPv6TestStack() *inet.TestStack {
@@ -72,3 +74,68 @@ func TestIfinet6(t *testing.T) {
 		t.Errorf("Got n.contents() = %v, want = %v", got, want)
 	}
 }
+
+// snmp6TestStack is a test stack reporting fixed IPv6 statistics, and no UDP
+// ones.
+type snmp6TestStack struct {
+	*inet.TestStack
+}
+
+// Statistics implements inet.Stack.Statistics.
+func (snmp6TestStack) Statistics(stat interface{}, arg string) error {
+	switch stat := stat.(type) {
+	case *inet.StatSNMP6IP:
+		stat[0] = 3  // InReceives.
+		stat[10] = 2 // OutRequests.
+	case *inet.StatSNMP6ICMP:
+		stat[0] = 3 // InMsgs.
+		stat[2] = 1 // OutMsgs.
+	case *inet.StatSNMP6ICMPMSG:
+		stat[129] = 1     // In EchoReply.
+		stat[200] = 2     // In unnamed type 200.
+		stat[256+128] = 1 // Out EchoRequest.
+	default:
+		return syserror.EOPNOTSUPP
+	}
+	return nil
+}
+
+func TestNetSnmp6(t *testing.T) {
+	n := &netSnmp6{s: snmp6TestStack{newIPv6TestStack()}}
+	lines := n.contents()
+
+	// Ip6, Icmp6, the named Icmp6 types in both directions, the nonzero
+	// Icmp6 types and Udp6 and UdpLite6.
+	if got, want := len(lines), 32+5+2*15+3+2*8; got != want {
+		t.Errorf("got %d lines, want %d:\n%s", got, want, strings.Join(lines, ""))
+	}
+	got := make(map[string]struct{})
+	for _, l := range lines {
+		got[l] = struct{}{}
+	}
+	for _, want := range []string{
+		"Ip6InReceives                   \t3\n",
+		"Ip6OutRequests                  \t2\n",
+		"Ip6InCEPkts                     \t0\n",
+		"Icmp6InMsgs                     \t3\n",
+		"Icmp6OutMsgs                    \t1\n",
+		"Icmp6InEchoReplies              \t1\n",
+		"Icmp6InEchos                    \t0\n",
+		"Icmp6OutEchos                   \t1\n",
+		"Icmp6OutMLDv2Reports            \t0\n",
+		"Icmp6InType129                  \t1\n",
+		"Icmp6InType200                  \t2\n",
+		"Icmp6OutType128                 \t1\n",
+		// Counters the stack doesn't support are 0.
+		"Udp6InDatagrams                 \t0\n",
+		"UdpLite6IgnoredMulti            \t0\n",
+	} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("missing line %q", want)
+		}
+	}
+	// Types are only listed by number if their counter isn't 0.
+	if _, ok := got["Icmp6InType128                  \t0\n"]; ok {
+		t.Errorf("got line for Icmp6InType128, want none")
+	}
+}
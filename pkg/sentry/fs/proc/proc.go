@@ -67,6 +67,8 @@ func New(ctx context.Context, msrc *fs.MountSource, cgroupControllers map[string
 	contents := map[string]*fs.Inode{
 		"cpuinfo":     newCPUInfo(ctx, msrc),
 		"filesystems": seqfile.NewSeqFileInode(ctx, &filesystemsData{}, msrc),
+		"key-users":   seqfile.NewSeqFileInode(ctx, &keyUsersData{k}, msrc),
+		"keys":        seqfile.NewSeqFileInode(ctx, &keysData{k}, msrc),
 		"loadavg":     seqfile.NewSeqFileInode(ctx, &loadavgData{}, msrc),
 		"meminfo":     seqfile.NewSeqFileInode(ctx, &meminfoData{k}, msrc),
 		"mounts":      newProcInode(ctx, ramfs.NewSymlink(ctx, fs.RootOwner, "self/mounts"), msrc, fs.Symlink, nil),
@@ -26,35 +26,93 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // LINT.IfChange
 
-// mmapMinAddrData backs /proc/sys/vm/mmap_min_addr.
+// mmapMinAddr is the inode for /proc/sys/vm/mmap_min_addr.
 //
 // +stateify savable
-type mmapMinAddrData struct {
+type mmapMinAddr struct {
+	fsutil.SimpleFileInode
+
 	k *kernel.Kernel
 }
 
-// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
-func (*mmapMinAddrData) NeedsUpdate(generation int64) bool {
-	return true
+var _ fs.InodeOperations = (*mmapMinAddr)(nil)
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*mmapMinAddr) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
 }
 
-// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
-func (d *mmapMinAddrData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
-	if h != nil {
-		return nil, 0
+// GetFile implements fs.InodeOperations.GetFile.
+func (m *mmapMinAddr) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, d, flags, &mmapMinAddrFile{k: m.k}), nil
+}
+
+// +stateify savable
+type mmapMinAddrFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	k *kernel.Kernel
+}
+
+var _ fs.FileOperations = (*mmapMinAddrFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *mmapMinAddrFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	min := f.k.Platform.MinUserAddress()
+	if sysctl := mm.MMapMinAddr(); sysctl > min {
+		min = sysctl
 	}
-	return []seqfile.SeqData{
-		{
-			Buf:    []byte(fmt.Sprintf("%d\n", d.k.Platform.MinUserAddress())),
-			Handle: (*mmapMinAddrData)(nil),
-		},
-	}, 0
+	contents := []byte(fmt.Sprintf("%d\n", min))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (*mmapMinAddrFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	// Like Linux's security/min_addr.c:mmap_min_addr_handler(), only
+	// CAP_SYS_RAWIO in the root user namespace allows lowering the minimum.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_RAWIO, creds.UserNamespace.Root()) {
+		return 0, syserror.EPERM
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v uint64
+	n, err := usermem.CopyUint64StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if usermem.Addr(v).RoundDown() != usermem.Addr(v) {
+		return 0, syserror.EINVAL
+	}
+	mm.SetMMapMinAddr(usermem.Addr(v))
+	return n, nil
 }
 
 // +stateify savable
@@ -77,25 +135,375 @@ func (*overcommitMemory) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandl
 	}, 0
 }
 
+// nrOpen is the inode for /proc/sys/fs/nr_open.
+//
+// +stateify savable
+type nrOpen struct {
+	fsutil.SimpleFileInode
+}
+
+var _ fs.InodeOperations = (*nrOpen)(nil)
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*nrOpen) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (*nrOpen) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, d, flags, &nrOpenFile{}), nil
+}
+
+// +stateify savable
+type nrOpenFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+}
+
+var _ fs.FileOperations = (*nrOpenFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (*nrOpenFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	contents := []byte(fmt.Sprintf("%d\n", kernel.NROpen()))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (*nrOpenFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < kernel.MinNROpen || v > kernel.MaxNROpen {
+		return 0, syserror.EINVAL
+	}
+	kernel.SetNROpen(v)
+	return n, nil
+}
+
+// maxMapCount is the inode for /proc/sys/vm/max_map_count.
+//
+// +stateify savable
+type maxMapCount struct {
+	fsutil.SimpleFileInode
+}
+
+var _ fs.InodeOperations = (*maxMapCount)(nil)
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*maxMapCount) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (*maxMapCount) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, d, flags, &maxMapCountFile{}), nil
+}
+
+// +stateify savable
+type maxMapCountFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+}
+
+var _ fs.FileOperations = (*maxMapCountFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (*maxMapCountFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	contents := []byte(fmt.Sprintf("%d\n", mm.MaxMapCount()))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (*maxMapCountFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	mm.SetMaxMapCount(v)
+	return n, nil
+}
+
+// ucountMax is the inode for the /proc/sys/user/max_*_namespaces files. Each
+// file shows the limit of the user namespace of the reader or writer.
+//
+// +stateify savable
+type ucountMax struct {
+	fsutil.SimpleFileInode
+
+	typ auth.UCountType
+
+	// If readOnly is true, the limit can't be changed. This is the case for
+	// the limits that aren't enforced, since the sentry doesn't track the
+	// lifetime of those kinds of namespace.
+	readOnly bool
+}
+
+var _ fs.InodeOperations = (*ucountMax)(nil)
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*ucountMax) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (u *ucountMax) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, d, flags, &ucountMaxFile{typ: u.typ, readOnly: u.readOnly}), nil
+}
+
+// +stateify savable
+type ucountMaxFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	typ      auth.UCountType
+	readOnly bool
+}
+
+var _ fs.FileOperations = (*ucountMaxFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *ucountMaxFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	contents := []byte(fmt.Sprintf("%d\n", userns.UCountMax(f.typ)))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *ucountMaxFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if f.readOnly {
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Linux's kernel/ucount.c:set_permissions() requires CAP_SYS_RESOURCE in
+	// the user namespace whose limit is changed.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, creds.UserNamespace) {
+		return 0, syserror.EPERM
+	}
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	creds.UserNamespace.SetUCountMax(f.typ, v)
+	return n, nil
+}
+
+// tainted is the inode for /proc/sys/kernel/tainted.
+//
+// +stateify savable
+type tainted struct {
+	fsutil.SimpleFileInode
+
+	k *kernel.Kernel
+}
+
+var _ fs.InodeOperations = (*tainted)(nil)
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*tainted) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (t *tainted) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, d, flags, &taintedFile{k: t.k}), nil
+}
+
+// +stateify savable
+type taintedFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	k *kernel.Kernel
+}
+
+var _ fs.FileOperations = (*taintedFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *taintedFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	contents := []byte(fmt.Sprintf("%d\n", f.k.Tainted()))
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write. Like Linux's
+// kernel/sysctl.c:proc_taint(), it sets the written taint flags in addition
+// to those already set.
+func (f *taintedFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, creds.UserNamespace.Root()) {
+		return 0, syserror.EPERM
+	}
+
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	f.k.AddTaint(uint64(v))
+	return n, nil
+}
+
+func (p *proc) newFSDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	nro := &nrOpen{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+	}
+	children := map[string]*fs.Inode{
+		"nr_open": newProcInode(ctx, nro, msrc, fs.SpecialFile, nil),
+	}
+	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+}
+
 func (p *proc) newKernelDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	h := hostname{
 		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0444), linux.PROC_SUPER_MAGIC),
 	}
+	t := &tainted{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		k:               p.k,
+	}
 
 	children := map[string]*fs.Inode{
 		"hostname": newProcInode(ctx, &h, msrc, fs.SpecialFile, nil),
 		"shmall":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMALL, 10))),
 		"shmmax":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMMAX, 10))),
 		"shmmni":   newStaticProcInode(ctx, msrc, []byte(strconv.FormatUint(linux.SHMMNI, 10))),
+		"tainted":  newProcInode(ctx, t, msrc, fs.SpecialFile, nil),
 	}
 
 	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
 }
 
+func (p *proc) newUserDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	newFile := func(typ auth.UCountType, readOnly bool) *fs.Inode {
+		mode := linux.FileMode(0644)
+		if readOnly {
+			mode = 0444
+		}
+		u := &ucountMax{
+			SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(mode), linux.PROC_SUPER_MAGIC),
+			typ:             typ,
+			readOnly:        readOnly,
+		}
+		return newProcInode(ctx, u, msrc, fs.SpecialFile, nil)
+	}
+	// The limits on cgroup and mount namespaces aren't enforced.
+	children := map[string]*fs.Inode{
+		"max_cgroup_namespaces": newFile(auth.UCountCgroupNamespaces, true),
+		"max_ipc_namespaces":    newFile(auth.UCountIPCNamespaces, false),
+		"max_mnt_namespaces":    newFile(auth.UCountMntNamespaces, true),
+		"max_net_namespaces":    newFile(auth.UCountNetNamespaces, false),
+		"max_pid_namespaces":    newFile(auth.UCountPIDNamespaces, false),
+		"max_user_namespaces":   newFile(auth.UCountUserNamespaces, false),
+		"max_uts_namespaces":    newFile(auth.UCountUTSNamespaces, false),
+	}
+	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+}
+
 func (p *proc) newVMDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	mmc := &maxMapCount{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+	}
+	mma := &mmapMinAddr{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		k:               p.k,
+	}
 	children := map[string]*fs.Inode{
-		"mmap_min_addr":     seqfile.NewSeqFileInode(ctx, &mmapMinAddrData{p.k}, msrc),
+		"max_map_count":     newProcInode(ctx, mmc, msrc, fs.SpecialFile, nil),
+		"mmap_min_addr":     newProcInode(ctx, mma, msrc, fs.SpecialFile, nil),
 		"overcommit_memory": seqfile.NewSeqFileInode(ctx, &overcommitMemory{}, msrc),
 	}
 	d := ramfs.NewDir(ctx, children, fs.RootOwner, fs.FilePermsFromMode(0555))
@@ -104,8 +512,10 @@ func (p *proc) newVMDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 
 func (p *proc) newSysDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	children := map[string]*fs.Inode{
+		"fs":     p.newFSDir(ctx, msrc),
 		"kernel": p.newKernelDir(ctx, msrc),
 		"net":    p.newSysNetDir(ctx, msrc),
+		"user":   p.newUserDir(ctx, msrc),
 		"vm":     p.newVMDir(ctx, msrc),
 	}
 
@@ -17,15 +17,18 @@ package proc
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/device"
+	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
@@ -355,6 +358,176 @@ func (p *proc) newSysNetIPv4Dir(ctx context.Context, msrc *fs.MountSource, s ine
 	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
 }
 
+// connTrackLimit identifies a connection tracking limit that can be changed
+// through /proc/sys/net/netfilter.
+type connTrackLimit int
+
+const (
+	connTrackMax connTrackLimit = iota
+	connTrackTCPEstablishedTimeout
+	connTrackUDPTimeout
+	connTrackICMPTimeout
+)
+
+// get returns the value of l in limits. Timeouts are in seconds.
+func (l connTrackLimit) get(limits inet.ConnTrackLimits) int64 {
+	switch l {
+	case connTrackMax:
+		return int64(limits.Max)
+	case connTrackTCPEstablishedTimeout:
+		return int64(limits.TCPEstablishedTimeout / time.Second)
+	case connTrackUDPTimeout:
+		return int64(limits.UDPTimeout / time.Second)
+	case connTrackICMPTimeout:
+		return int64(limits.ICMPTimeout / time.Second)
+	default:
+		panic(fmt.Sprintf("unknown connection tracking limit %d", l))
+	}
+}
+
+// set sets the value of l in limits to v. Timeouts are in seconds.
+func (l connTrackLimit) set(limits *inet.ConnTrackLimits, v int32) {
+	switch l {
+	case connTrackMax:
+		limits.Max = int(v)
+	case connTrackTCPEstablishedTimeout:
+		limits.TCPEstablishedTimeout = time.Duration(v) * time.Second
+	case connTrackUDPTimeout:
+		limits.UDPTimeout = time.Duration(v) * time.Second
+	case connTrackICMPTimeout:
+		limits.ICMPTimeout = time.Duration(v) * time.Second
+	default:
+		panic(fmt.Sprintf("unknown connection tracking limit %d", l))
+	}
+}
+
+// connTrackLimitInode is used to read/write a connection tracking limit.
+//
+// +stateify savable
+type connTrackLimitInode struct {
+	fsutil.SimpleFileInode
+
+	stack inet.Stack `state:"wait"`
+	limit connTrackLimit
+}
+
+func newConnTrackLimitInode(ctx context.Context, msrc *fs.MountSource, s inet.Stack, limit connTrackLimit) *fs.Inode {
+	i := &connTrackLimitInode{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(ctx, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		stack:           s,
+		limit:           limit,
+	}
+	sattr := fs.StableAttr{
+		DeviceID:  device.ProcDevice.DeviceID(),
+		InodeID:   device.ProcDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	}
+	return fs.NewInode(ctx, i, msrc, sattr)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (connTrackLimitInode) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (i *connTrackLimitInode) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &connTrackLimitFile{inode: i}), nil
+}
+
+// +stateify savable
+type connTrackLimitFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	inode *connTrackLimitInode
+}
+
+// Read implements fs.FileOperations.Read.
+func (f *connTrackLimitFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, io.EOF
+	}
+	limits, err := f.inode.stack.ConnTrackLimits()
+	if err != nil {
+		return 0, err
+	}
+	n, err := dst.CopyOut(ctx, []byte(fmt.Sprintf("%d\n", f.inode.limit.get(limits))))
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *connTrackLimitFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	limits, err := f.inode.stack.ConnTrackLimits()
+	if err != nil {
+		return 0, err
+	}
+	f.inode.limit.set(&limits, v)
+	return n, f.inode.stack.SetConnTrackLimits(limits)
+}
+
+// connTrackCount implements seqfile.SeqSource for
+// /proc/sys/net/netfilter/nf_conntrack_count.
+//
+// +stateify savable
+type connTrackCount struct {
+	s inet.Stack
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (c *connTrackCount) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (c *connTrackCount) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+	entries, err := c.s.ConnTrackEntries()
+	if err != nil {
+		return nil, 0
+	}
+	return []seqfile.SeqData{{Buf: []byte(fmt.Sprintf("%d\n", len(entries))), Handle: (*connTrackCount)(nil)}}, 0
+}
+
+func (p *proc) newSysNetNetfilterDir(ctx context.Context, msrc *fs.MountSource, s inet.Stack) *fs.Inode {
+	contents := map[string]*fs.Inode{
+		"nf_conntrack_count":                   seqfile.NewSeqFileInode(ctx, &connTrackCount{s: s}, msrc),
+		"nf_conntrack_icmp_timeout":            newConnTrackLimitInode(ctx, msrc, s, connTrackICMPTimeout),
+		"nf_conntrack_max":                     newConnTrackLimitInode(ctx, msrc, s, connTrackMax),
+		"nf_conntrack_tcp_timeout_established": newConnTrackLimitInode(ctx, msrc, s, connTrackTCPEstablishedTimeout),
+		"nf_conntrack_udp_timeout":             newConnTrackLimitInode(ctx, msrc, s, connTrackUDPTimeout),
+	}
+
+	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
+}
+
 func (p *proc) newSysNetDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	var contents map[string]*fs.Inode
 	if s := p.k.NetworkStack(); s != nil {
@@ -362,6 +535,11 @@ func (p *proc) newSysNetDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode
 			"ipv4": p.newSysNetIPv4Dir(ctx, msrc, s),
 			"core": p.newSysNetCore(ctx, msrc, s),
 		}
+
+		// Add netfilter.
+		if _, err := s.ConnTrackLimits(); err == nil {
+			contents["netfilter"] = p.newSysNetNetfilterDir(ctx, msrc, s)
+		}
 	}
 	d := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0555))
 	return newProcInode(ctx, d, msrc, fs.SpecialDirectory, nil)
@@ -20,6 +20,7 @@ import (
 	"io"
 	"sort"
 	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -29,6 +30,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -71,24 +73,30 @@ var _ fs.InodeOperations = (*taskDir)(nil)
 // newTaskDir creates a new proc task entry.
 func (p *proc) newTaskDir(t *kernel.Task, msrc *fs.MountSource, isThreadGroup bool) *fs.Inode {
 	contents := map[string]*fs.Inode{
-		"auxv":      newAuxvec(t, msrc),
-		"cmdline":   newExecArgInode(t, msrc, cmdlineExecArg),
-		"comm":      newComm(t, msrc),
-		"environ":   newExecArgInode(t, msrc, environExecArg),
-		"exe":       newExe(t, msrc),
-		"fd":        newFdDir(t, msrc),
-		"fdinfo":    newFdInfoDir(t, msrc),
-		"gid_map":   newGIDMap(t, msrc),
-		"io":        newIO(t, msrc, isThreadGroup),
-		"maps":      newMaps(t, msrc),
-		"mountinfo": seqfile.NewSeqFileInode(t, &mountInfoFile{t: t}, msrc),
-		"mounts":    seqfile.NewSeqFileInode(t, &mountsFile{t: t}, msrc),
-		"ns":        newNamespaceDir(t, msrc),
-		"smaps":     newSmaps(t, msrc),
-		"stat":      newTaskStat(t, msrc, isThreadGroup, p.pidns),
-		"statm":     newStatm(t, msrc),
-		"status":    newStatus(t, msrc, p.pidns),
-		"uid_map":   newUIDMap(t, msrc),
+		"auxv":          newAuxvec(t, msrc),
+		"cmdline":       newExecArgInode(t, msrc, cmdlineExecArg),
+		"comm":          newComm(t, msrc),
+		"cwd":           newFSContextLink(t, msrc, false),
+		"environ":       newExecArgInode(t, msrc, environExecArg),
+		"exe":           newExe(t, msrc),
+		"fd":            newFdDir(t, msrc),
+		"fdinfo":        newFdInfoDir(t, msrc),
+		"gid_map":       newGIDMap(t, msrc),
+		"io":            newIO(t, msrc, isThreadGroup),
+		"maps":          newMaps(t, msrc),
+		"mountinfo":     seqfile.NewSeqFileInode(t, &mountInfoFile{t: t}, msrc),
+		"mounts":        seqfile.NewSeqFileInode(t, &mountsFile{t: t}, msrc),
+		"ns":            newNamespaceDir(t, msrc),
+		"oom_score":     newOOMScore(t, msrc),
+		"oom_score_adj": newOOMScoreAdj(t, msrc),
+		"root":          newFSContextLink(t, msrc, true),
+		"sched":         seqfile.NewSeqFileInode(t, &schedData{t: t, pidns: p.pidns}, msrc),
+		"smaps":         newSmaps(t, msrc),
+		"stat":          newTaskStat(t, msrc, isThreadGroup, p.pidns),
+		"statm":         newStatm(t, msrc),
+		"status":        newStatus(t, msrc, p.pidns),
+		"uid_map":       newUIDMap(t, msrc),
+		"wchan":         seqfile.NewSeqFileInode(t, &wchanData{t: t}, msrc),
 	}
 	if isThreadGroup {
 		contents["task"] = p.newSubtasks(t, msrc)
@@ -283,6 +291,86 @@ func (e *exe) Readlink(ctx context.Context, inode *fs.Inode) (string, error) {
 	}
 	defer exec.DecRef()
 
+	return taskLinkName(ctx, e.t, exec)
+}
+
+// Getlink implements fs.InodeOperations.Getlink. The executable can be opened
+// even if its pathname isn't reachable from the reader's root.
+func (e *exe) Getlink(ctx context.Context, inode *fs.Inode) (*fs.Dirent, error) {
+	if !kernel.ContextCanTrace(ctx, e.t, false) {
+		return nil, syserror.EACCES
+	}
+	return e.executable()
+}
+
+// fsContextLink is an fs.InodeOperations symlink for the /proc/PID/cwd and
+// /proc/PID/root files.
+//
+// +stateify savable
+type fsContextLink struct {
+	ramfs.Symlink
+
+	t *kernel.Task
+
+	// root is true for /proc/PID/root and false for /proc/PID/cwd.
+	root bool
+}
+
+func newFSContextLink(t *kernel.Task, msrc *fs.MountSource, root bool) *fs.Inode {
+	link := &fsContextLink{
+		Symlink: *ramfs.NewSymlink(t, fs.RootOwner, ""),
+		t:       t,
+		root:    root,
+	}
+	return newProcInode(t, link, msrc, fs.Symlink, t)
+}
+
+// dirent returns the directory that l refers to, with a reference taken.
+func (l *fsContextLink) dirent() (d *fs.Dirent, err error) {
+	l.t.WithMuLocked(func(t *kernel.Task) {
+		fsc := t.FSContext()
+		if fsc == nil {
+			// The task has exited.
+			err = syserror.ENOENT
+			return
+		}
+		if l.root {
+			d = fsc.RootDirectory()
+		} else {
+			d = fsc.WorkingDirectory()
+		}
+		if d == nil {
+			err = syserror.ENOENT
+		}
+	})
+	return
+}
+
+// Readlink implements fs.InodeOperations.Readlink.
+func (l *fsContextLink) Readlink(ctx context.Context, inode *fs.Inode) (string, error) {
+	if !kernel.ContextCanTrace(ctx, l.t, false) {
+		return "", syserror.EACCES
+	}
+	d, err := l.dirent()
+	if err != nil {
+		return "", err
+	}
+	defer d.DecRef()
+	return taskLinkName(ctx, l.t, d)
+}
+
+// Getlink implements fs.InodeOperations.Getlink. Like Linux, the directory can
+// be opened even if its pathname isn't reachable from the reader's root.
+func (l *fsContextLink) Getlink(ctx context.Context, inode *fs.Inode) (*fs.Dirent, error) {
+	if !kernel.ContextCanTrace(ctx, l.t, false) {
+		return nil, syserror.EACCES
+	}
+	return l.dirent()
+}
+
+// taskLinkName returns the pathname of d, a file used by t, as read through
+// the symlink to it in t's /proc directory by a reader in ctx.
+func taskLinkName(ctx context.Context, t *kernel.Task, d *fs.Dirent) (string, error) {
 	root := fs.RootFromContext(ctx)
 	if root == nil {
 		// This doesn't correspond to anything in Linux because the vfs is
@@ -290,8 +378,29 @@ func (e *exe) Readlink(ctx context.Context, inode *fs.Inode) (string, error) {
 		return "", syserror.EINVAL
 	}
 	defer root.DecRef()
-	n, _ := exec.FullName(root)
-	return n, nil
+
+	var taskRoot *fs.Dirent
+	t.WithMuLocked(func(t *kernel.Task) {
+		if fsc := t.FSContext(); fsc != nil {
+			taskRoot = fsc.RootDirectory()
+		}
+	})
+	if taskRoot != nil {
+		defer taskRoot.DecRef()
+	}
+	return linkName(d, root, taskRoot), nil
+}
+
+// linkName returns the pathname of d as seen from root. If d isn't reachable
+// from root, e.g. because the reader is confined to another part of the tree,
+// the pathname is instead taken from taskRoot, the root of the task using d,
+// so that no path outside the task's view of the filesystem is revealed.
+func linkName(d, root, taskRoot *fs.Dirent) string {
+	if n, reachable := d.FullName(root); reachable || taskRoot == nil {
+		return n
+	}
+	n, _ := d.FullName(taskRoot)
+	return n
 }
 
 // namespaceSymlink represents a symlink in the namespacefs, such as the files
@@ -485,10 +594,10 @@ func (s *taskStatData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle)
 	s.t.WithMuLocked(func(t *kernel.Task) {
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			rss = mm.ResidentSetPages()
 		}
 	})
-	fmt.Fprintf(&buf, "%d %d ", vss, rss/usermem.PageSize)
+	fmt.Fprintf(&buf, "%d %d ", vss, rss)
 
 	// rsslim.
 	fmt.Fprintf(&buf, "%d ", s.t.ThreadGroup().Limits().Get(limits.Rss).Cur)
@@ -501,14 +610,133 @@ func (s *taskStatData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle)
 		terminationSignal = s.t.ThreadGroup().TerminationSignal()
 	}
 	fmt.Fprintf(&buf, "%d ", terminationSignal)
-	fmt.Fprintf(&buf, "0 0 0 " /* processor rt_priority policy */)
+	fmt.Fprintf(&buf, "%d ", s.t.CPU())
+	fmt.Fprintf(&buf, "0 0 " /* rt_priority policy */)
 	fmt.Fprintf(&buf, "0 0 0 " /* delayacct_blkio_ticks guest_time cguest_time */)
-	fmt.Fprintf(&buf, "0 0 0 0 0 0 0 " /* start_data end_data start_brk arg_start arg_end env_start env_end */)
+	fmt.Fprintf(&buf, "0 0 " /* start_data end_data */)
+	// Like Linux, only show the memory layout to tasks that can trace.
+	var brk, argv, envv usermem.AddrRange
+	if kernel.ContextCanTrace(ctx, s.t, false) {
+		s.t.WithMuLocked(func(t *kernel.Task) {
+			if mm := t.MemoryManager(); mm != nil {
+				brk = mm.BrkRange()
+				argv = usermem.AddrRange{Start: mm.ArgvStart(), End: mm.ArgvEnd()}
+				envv = usermem.AddrRange{Start: mm.EnvvStart(), End: mm.EnvvEnd()}
+			}
+		})
+	}
+	fmt.Fprintf(&buf, "%d %d %d %d %d ", brk.Start, argv.Start, argv.End, envv.Start, envv.End)
 	fmt.Fprintf(&buf, "0\n" /* exit_code */)
 
 	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*taskStatData)(nil)}}, 0
 }
 
+// oomScoreData implements seqfile.SeqSource for /proc/[pid]/oom_score.
+//
+// +stateify savable
+type oomScoreData struct {
+	t *kernel.Task
+}
+
+func newOOMScore(t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
+	return newProcInode(t, seqfile.NewSeqFile(t, &oomScoreData{t}), msrc, fs.SpecialFile, t)
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (d *oomScoreData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *oomScoreData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+	buf := []byte(fmt.Sprintf("%d\n", d.t.OOMScore()))
+	return []seqfile.SeqData{{Buf: buf, Handle: (*oomScoreData)(nil)}}, 0
+}
+
+// oomScoreAdj is the inode for /proc/[pid]/oom_score_adj.
+//
+// +stateify savable
+type oomScoreAdj struct {
+	fsutil.SimpleFileInode
+
+	t *kernel.Task
+}
+
+var _ fs.InodeOperations = (*oomScoreAdj)(nil)
+
+func newOOMScoreAdj(t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
+	adj := &oomScoreAdj{
+		SimpleFileInode: *fsutil.NewSimpleFileInode(t, fs.RootOwner, fs.FilePermsFromMode(0644), linux.PROC_SUPER_MAGIC),
+		t:               t,
+	}
+	return newProcInode(t, adj, msrc, fs.SpecialFile, t)
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*oomScoreAdj) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (a *oomScoreAdj) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	flags.Pread = true
+	flags.Pwrite = true
+	return fs.NewFile(ctx, dirent, flags, &oomScoreAdjFile{t: a.t}), nil
+}
+
+// +stateify savable
+type oomScoreAdjFile struct {
+	fsutil.FileGenericSeek          `state:"nosave"`
+	fsutil.FileNoIoctl              `state:"nosave"`
+	fsutil.FileNoMMap               `state:"nosave"`
+	fsutil.FileNoSplice             `state:"nosave"`
+	fsutil.FileNoopFlush            `state:"nosave"`
+	fsutil.FileNoopFsync            `state:"nosave"`
+	fsutil.FileNoopRelease          `state:"nosave"`
+	fsutil.FileNotDirReaddir        `state:"nosave"`
+	fsutil.FileUseInodeUnstableAttr `state:"nosave"`
+	waiter.AlwaysReady              `state:"nosave"`
+
+	t *kernel.Task
+}
+
+var _ fs.FileOperations = (*oomScoreAdjFile)(nil)
+
+// Read implements fs.FileOperations.Read.
+func (f *oomScoreAdjFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, syserror.EINVAL
+	}
+	buf := []byte(fmt.Sprintf("%d\n", f.t.ThreadGroup().OOMScoreAdj()))
+	if offset >= int64(len(buf)) {
+		return 0, io.EOF
+	}
+	n, err := dst.CopyOut(ctx, buf[offset:])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (f *oomScoreAdjFile) Write(ctx context.Context, _ *fs.File, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	// See fsimpl/proc.oomScoreAdjData.Write.
+	if err := f.t.WriteOOMScoreAdj(auth.CredentialsFromContext(ctx), v); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // statmData implements seqfile.SeqSource for /proc/[pid]/statm.
 //
 // +stateify savable
@@ -535,12 +763,12 @@ func (s *statmData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([
 	s.t.WithMuLocked(func(t *kernel.Task) {
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			rss = mm.ResidentSetPages()
 		}
 	})
 
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "%d %d 0 0 0 0 0\n", vss/usermem.PageSize, rss/usermem.PageSize)
+	fmt.Fprintf(&buf, "%d %d 0 0 0 0 0\n", vss/usermem.PageSize, rss)
 
 	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*statmData)(nil)}}, 0
 }
@@ -572,6 +800,8 @@ func (s *statusData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) (
 	fmt.Fprintf(&buf, "Name:\t%s\n", s.t.Name())
 	fmt.Fprintf(&buf, "State:\t%s\n", s.t.StateStatus())
 	fmt.Fprintf(&buf, "Tgid:\t%d\n", s.pidns.IDOfThreadGroup(s.t.ThreadGroup()))
+	// We don't support NUMA balancing, so the NUMA group ID is always 0.
+	fmt.Fprintf(&buf, "Ngid:\t0\n")
 	fmt.Fprintf(&buf, "Pid:\t%d\n", s.pidns.IDOfTask(s.t))
 	ppid := kernel.ThreadID(0)
 	if parent := s.t.Parent(); parent != nil {
@@ -584,28 +814,37 @@ func (s *statusData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) (
 	}
 	fmt.Fprintf(&buf, "TracerPid:\t%d\n", tpid)
 	var fds int
-	var vss, rss, data uint64
+	var vss, rssPages, data uint64
 	s.t.WithMuLocked(func(t *kernel.Task) {
 		if fdTable := t.FDTable(); fdTable != nil {
 			fds = fdTable.Size()
 		}
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			rssPages = mm.ResidentSetPages()
 			data = mm.VirtualDataSize()
 		}
 	})
 	fmt.Fprintf(&buf, "FDSize:\t%d\n", fds)
 	fmt.Fprintf(&buf, "VmSize:\t%d kB\n", vss>>10)
-	fmt.Fprintf(&buf, "VmRSS:\t%d kB\n", rss>>10)
+	fmt.Fprintf(&buf, "VmRSS:\t%d kB\n", rssPages*(usermem.PageSize>>10))
 	fmt.Fprintf(&buf, "VmData:\t%d kB\n", data>>10)
+	// Transparent hugepages are not implemented, so they are never enabled.
+	fmt.Fprintf(&buf, "THP_enabled:\t0\n")
 	fmt.Fprintf(&buf, "Threads:\t%d\n", s.t.ThreadGroup().Count())
+	fmt.Fprintf(&buf, "SigBlk:\t%016x\n", uint64(s.t.SignalMask()))
 	creds := s.t.Credentials()
 	fmt.Fprintf(&buf, "CapInh:\t%016x\n", creds.InheritableCaps)
 	fmt.Fprintf(&buf, "CapPrm:\t%016x\n", creds.PermittedCaps)
 	fmt.Fprintf(&buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(&buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
 	fmt.Fprintf(&buf, "Seccomp:\t%d\n", s.t.SeccompMode())
+	// The sandbox doesn't let applications control speculation, so it
+	// doesn't report them as vulnerable.
+	fmt.Fprintf(&buf, "Speculation_Store_Bypass:\tnot vulnerable\n")
+	// Core scheduling (PR_SCHED_CORE) is not supported, so no task has a
+	// cookie.
+	fmt.Fprintf(&buf, "Core_scheduling_cookie:\t0\n")
 	// We unconditionally report a single NUMA node. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
 	fmt.Fprintf(&buf, "Mems_allowed:\t1\n")
@@ -658,6 +897,65 @@ func (i *ioData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]se
 	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*ioData)(nil)}}, 0
 }
 
+// wchanData backs /proc/[pid]/wchan.
+//
+// +stateify savable
+type wchanData struct {
+	t *kernel.Task
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*wchanData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *wchanData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	// See fsimpl/proc.wchanData.Generate.
+	wchan := d.t.WaitChannel()
+	if wchan == "" {
+		wchan = "0"
+	}
+	return []seqfile.SeqData{
+		{
+			Buf:    []byte(wchan),
+			Handle: (*wchanData)(nil),
+		},
+	}, 0
+}
+
+// schedData backs /proc/[pid]/sched.
+//
+// +stateify savable
+type schedData struct {
+	t     *kernel.Task
+	pidns *kernel.PIDNamespace
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*schedData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *schedData) ReadSeqFileData(ctx context.Context, h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	// See fsimpl/proc.schedData.Generate.
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s (%d, #threads: %d)\n", d.t.Name(), d.pidns.IDOfTask(d.t), d.t.ThreadGroup().Count())
+	fmt.Fprintf(&buf, "%s\n", strings.Repeat("-", 67))
+	fmt.Fprintf(&buf, "%-45s:%21d\n", "policy", linux.SCHED_NORMAL)
+	fmt.Fprintf(&buf, "%-45s:%21d\n", "prio", linux.DEFAULT_PRIO+d.t.Niceness())
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*schedData)(nil)}}, 0
+}
+
 // comm is a file containing the command name for a task.
 //
 // On Linux, /proc/[pid]/comm is writable, and writing to the comm file changes
@@ -725,7 +1023,12 @@ func (f *commFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence,
 		return 0, syserror.EINVAL
 	}
 
-	buf := []byte(f.t.Name() + "\n")
+	// See fsimpl/proc.commData.Generate.
+	name := f.t.Name()
+	if len(name) > linux.TASK_COMM_LEN-1 {
+		name = name[:linux.TASK_COMM_LEN-1]
+	}
+	buf := []byte(name + "\n")
 	if offset >= int64(len(buf)) {
 		return 0, io.EOF
 	}
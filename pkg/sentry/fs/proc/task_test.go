@@ -0,0 +1,292 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fs/anon"
+	"gvisor.dev/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/testutil"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/pipe"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// newTestDir returns a ramfs directory inode containing contents.
+func newTestDir(ctx context.Context, contents map[string]*fs.Inode) *fs.Inode {
+	dir := ramfs.NewDir(ctx, contents, fs.RootOwner, fs.FilePermsFromMode(0777))
+	return fs.NewInode(ctx, dir, fs.NewPseudoMountSource(ctx), fs.StableAttr{Type: fs.Directory})
+}
+
+// walk returns the Dirent at path, relative to root, with a reference taken.
+func walk(t *testing.T, ctx context.Context, root *fs.Dirent, path ...string) *fs.Dirent {
+	t.Helper()
+	d := root
+	d.IncRef()
+	for _, name := range path {
+		next, err := d.Walk(ctx, root, name)
+		d.DecRef()
+		if err != nil {
+			t.Fatalf("Walk(%q) failed: %v", name, err)
+		}
+		d = next
+	}
+	return d
+}
+
+// createTaskWithFSContext creates a task whose root and working directory are
+// root and cwd.
+func createTaskWithFSContext(t *testing.T, ctx context.Context, name string, root, cwd *fs.Dirent) *kernel.Task {
+	t.Helper()
+	k := kernel.KernelFromContext(ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := k.TaskSet().NewTask(&kernel.TaskConfig{
+		Kernel:                  k,
+		ThreadGroup:             tg,
+		TaskContext:             &kernel.TaskContext{Name: name},
+		Credentials:             auth.CredentialsFromContext(ctx),
+		FSContext:               kernel.NewFSContext(root, cwd, 0022),
+		FDTable:                 k.NewFDTable(),
+		AllowedCPUMask:          sched.NewFullCPUSet(k.ApplicationCores()),
+		UTSNamespace:            kernel.UTSNamespaceFromContext(ctx),
+		IPCNamespace:            kernel.IPCNamespaceFromContext(ctx),
+		AbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
+	})
+	if err != nil {
+		t.Fatalf("NewTask(%q) failed: %v", name, err)
+	}
+	return task
+}
+
+// TestFSContextLinks tests /proc/PID/cwd and /proc/PID/root when the reader
+// and the target task see different parts of the filesystem tree.
+func TestFSContextLinks(t *testing.T) {
+	k, err := testutil.Boot()
+	if err != nil {
+		t.Fatalf("Boot() failed: %v", err)
+	}
+	ctx := k.SupervisorContext()
+
+	// The tree is /a/b, /c/d.
+	rootInode := newTestDir(ctx, map[string]*fs.Inode{
+		"a": newTestDir(ctx, map[string]*fs.Inode{
+			"b": newTestDir(ctx, nil),
+		}),
+		"c": newTestDir(ctx, map[string]*fs.Inode{
+			"d": newTestDir(ctx, nil),
+		}),
+	})
+	root := fs.NewDirent(ctx, rootInode, "/")
+	defer root.DecRef()
+	dirents := map[string]*fs.Dirent{"/": root}
+	for _, path := range [][]string{{"a"}, {"a", "b"}, {"c"}, {"c", "d"}} {
+		d := walk(t, ctx, root, path...)
+		defer d.DecRef()
+		name, _ := d.FullName(root)
+		dirents[name] = d
+	}
+
+	for _, tc := range []struct {
+		name       string
+		readerRoot string
+		targetRoot string
+		targetCwd  string
+		wantCwd    string
+		wantRoot   string
+	}{
+		{
+			name:       "same root",
+			readerRoot: "/",
+			targetRoot: "/",
+			targetCwd:  "/a/b",
+			wantCwd:    "/a/b",
+			wantRoot:   "/",
+		},
+		{
+			name:       "reachable from reader",
+			readerRoot: "/a",
+			targetRoot: "/",
+			targetCwd:  "/a/b",
+			wantCwd:    "/b",
+			// The target's root isn't reachable from the reader's, so it's
+			// shown from the target's view.
+			wantRoot: "/",
+		},
+		{
+			name:       "unreachable from reader",
+			readerRoot: "/a",
+			targetRoot: "/",
+			targetCwd:  "/c",
+			wantCwd:    "/c",
+			wantRoot:   "/",
+		},
+		{
+			name:       "disjoint roots",
+			readerRoot: "/a",
+			targetRoot: "/c",
+			targetCwd:  "/c/d",
+			// Paths above the target's root aren't revealed.
+			wantCwd:  "/d",
+			wantRoot: "/",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := createTaskWithFSContext(t, ctx, "reader", dirents[tc.readerRoot], dirents[tc.readerRoot])
+			target := createTaskWithFSContext(t, ctx, "target", dirents[tc.targetRoot], dirents[tc.targetCwd])
+
+			msrc := fs.NewPseudoMountSource(ctx)
+			for _, link := range []struct {
+				name   string
+				root   bool
+				want   string
+				wantTo string
+			}{
+				{name: "cwd", want: tc.wantCwd, wantTo: tc.targetCwd},
+				{name: "root", root: true, want: tc.wantRoot, wantTo: tc.targetRoot},
+			} {
+				inode := newFSContextLink(target, msrc, link.root)
+				got, err := inode.Readlink(reader)
+				if err != nil {
+					t.Fatalf("Readlink(%s) failed: %v", link.name, err)
+				}
+				if got != link.want {
+					t.Errorf("Readlink(%s) = %q, want %q", link.name, got, link.want)
+				}
+
+				// Opening through the link works even if its pathname is
+				// unreachable for the reader.
+				d, err := inode.Getlink(reader)
+				if err != nil {
+					t.Fatalf("Getlink(%s) failed: %v", link.name, err)
+				}
+				if want := dirents[link.wantTo]; d != want {
+					gotName, _ := d.FullName(root)
+					t.Errorf("Getlink(%s) = %s, want %s", link.name, gotName, link.wantTo)
+				}
+				file, err := d.Inode.GetFile(reader, d, fs.FileFlags{Read: true})
+				if err != nil {
+					t.Errorf("GetFile(%s) failed: %v", link.name, err)
+				} else {
+					file.DecRef()
+				}
+				d.DecRef()
+			}
+		})
+	}
+}
+
+// TestFDLinks tests the targets of /proc/PID/fd/N for files that aren't in the
+// filesystem tree.
+func TestFDLinks(t *testing.T) {
+	k, err := testutil.Boot()
+	if err != nil {
+		t.Fatalf("Boot() failed: %v", err)
+	}
+	ctx := k.SupervisorContext()
+
+	root := fs.NewDirent(ctx, newTestDir(ctx, nil), "/")
+	defer root.DecRef()
+	task := createTaskWithFSContext(t, ctx, "task", root, root)
+	msrc := fs.NewPseudoMountSource(ctx)
+
+	r, w := pipe.NewConnectedPipe(ctx, pipe.DefaultPipeSize, usermem.PageSize)
+	sock := unix.New(ctx, transport.NewConnectionless(ctx), linux.SOCK_DGRAM)
+	// Both ends of a pipe share an inode, and so a target.
+	pipeIno := r.Dirent.Inode.StableAttr.InodeID
+	if ino := w.Dirent.Inode.StableAttr.InodeID; ino != pipeIno {
+		t.Fatalf("pipe ends have inode numbers %d and %d, want the same", pipeIno, ino)
+	}
+	for _, tc := range []struct {
+		name string
+		file *fs.File
+		want string
+	}{
+		{name: "pipe read end", file: r, want: fmt.Sprintf("pipe:[%d]", pipeIno)},
+		{name: "pipe write end", file: w, want: fmt.Sprintf("pipe:[%d]", pipeIno)},
+		{name: "socket", file: sock, want: fmt.Sprintf("socket:[%d]", sock.Dirent.Inode.StableAttr.InodeID)},
+		{name: "eventfd", file: eventfd.New(ctx, 0, false), want: "anon_inode:[eventfd]"},
+	} {
+		// newFd takes the file reference.
+		inode := newFd(task, tc.file, msrc)
+		got, err := inode.Readlink(ctx)
+		if err != nil {
+			t.Fatalf("Readlink(%s) failed: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("Readlink(%s) = %q, want %q", tc.name, got, tc.want)
+		}
+		inode.DecRef()
+	}
+}
+
+// TestFDInfoInotify tests the watches shown in /proc/PID/fdinfo/N for inotify
+// instances.
+func TestFDInfoInotify(t *testing.T) {
+	k, err := testutil.Boot()
+	if err != nil {
+		t.Fatalf("Boot() failed: %v", err)
+	}
+	ctx := k.SupervisorContext()
+
+	root := fs.NewDirent(ctx, newTestDir(ctx, nil), "/")
+	defer root.DecRef()
+	task := createTaskWithFSContext(t, ctx, "task", root, root)
+
+	watched := fs.NewDirent(ctx, newTestDir(ctx, nil), "watched")
+	defer watched.DecRef()
+	inotify := fs.NewInotify(ctx)
+	file := fs.NewFile(ctx, fs.NewDirent(ctx, anon.NewInode(ctx), "anon_inode:inotify"), fs.FileFlags{Read: true}, inotify)
+	defer file.DecRef()
+	wd := inotify.AddWatch(watched, linux.IN_MODIFY|linux.IN_CREATE)
+	if err := task.FDTable().NewFDAt(ctx, 3, file, kernel.FDFlags{}); err != nil {
+		t.Fatalf("NewFDAt(3) failed: %v", err)
+	}
+
+	fdInfo := newFdInfoDir(task, fs.NewPseudoMountSource(ctx))
+	defer fdInfo.DecRef()
+	d, err := fdInfo.Lookup(ctx, "3")
+	if err != nil {
+		t.Fatalf("Lookup(3) failed: %v", err)
+	}
+	defer d.DecRef()
+	info, err := d.Inode.GetFile(ctx, d, fs.FileFlags{Read: true})
+	if err != nil {
+		t.Fatalf("GetFile(3) failed: %v", err)
+	}
+	defer info.DecRef()
+	buf := make([]byte, 256)
+	n, err := info.Readv(ctx, usermem.BytesIOSequence(buf))
+	if err != nil && err != io.EOF {
+		t.Fatalf("Readv(3) failed: %v", err)
+	}
+
+	major, minor := linux.DecodeDeviceID(uint32(watched.Inode.StableAttr.DeviceID))
+	want := fmt.Sprintf("flags:\t0%o\ninotify wd:%x ino:%x sdev:%x mask:%x ignored_mask:0\n",
+		file.Flags().ToLinux(), wd, watched.Inode.StableAttr.InodeID, uint32(major)<<20|minor, linux.IN_MODIFY|linux.IN_CREATE)
+	if got := string(buf[:n]); got != want {
+		t.Errorf("fdinfo/3 = %q, want %q", got, want)
+	}
+}
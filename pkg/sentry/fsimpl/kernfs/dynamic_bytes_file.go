@@ -53,7 +53,7 @@ func (f *DynamicBytesFile) Init(creds *auth.Credentials, ino uint64, data vfs.Dy
 }
 
 // Open implements Inode.Open.
-func (f *DynamicBytesFile) Open(rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+func (f *DynamicBytesFile) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
 	fd := &DynamicBytesFD{}
 	if err := fd.Init(rp.Mount(), vfsd, f.data, opts.Flags); err != nil {
 		return nil, err
@@ -91,6 +91,12 @@ func (fd *DynamicBytesFD) Init(m *vfs.Mount, d *vfs.Dentry, data vfs.DynamicByte
 	return nil
 }
 
+// VFSFileDescription returns a pointer to the vfs.FileDescription representing
+// this object.
+func (fd *DynamicBytesFD) VFSFileDescription() *vfs.FileDescription {
+	return &fd.vfsfd
+}
+
 // Seek implements vfs.FileDescriptionImpl.Seek.
 func (fd *DynamicBytesFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
 	return fd.DynamicBytesFileDescriptionImpl.Seek(ctx, offset, whence)
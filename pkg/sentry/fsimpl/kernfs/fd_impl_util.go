@@ -101,7 +101,7 @@ func (fd *GenericDirectoryFD) inode() Inode {
 // o.mu when calling cb.
 func (fd *GenericDirectoryFD) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback) error {
 	vfsFS := fd.filesystem()
-	fs := vfsFS.Impl().(*Filesystem)
+	fs := vfsFS.Impl().(filesystemImpl).kernfs()
 	vfsd := fd.vfsfd.VirtualDentry().Dentry()
 
 	fs.mu.Lock()
@@ -167,7 +167,7 @@ func (fd *GenericDirectoryFD) IterDirents(ctx context.Context, cb vfs.IterDirent
 
 // Seek implements vfs.FileDecriptionImpl.Seek.
 func (fd *GenericDirectoryFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
-	fs := fd.filesystem().Impl().(*Filesystem)
+	fs := fd.filesystem().Impl().(filesystemImpl).kernfs()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
@@ -74,12 +74,7 @@ afterSymlink:
 	}
 	// Resolve any symlink at current path component.
 	if rp.ShouldFollowSymlink() && next.isSymlink() {
-		// TODO: VFS2 needs something extra for /proc/[pid]/fd/ "magic symlinks".
-		target, err := next.inode.Readlink(ctx)
-		if err != nil {
-			return nil, err
-		}
-		if err := rp.HandleSymlink(target); err != nil {
+		if err := followSymlink(ctx, rp, next.inode); err != nil {
 			return nil, err
 		}
 		goto afterSymlink
@@ -89,6 +84,21 @@ afterSymlink:
 	return &next.vfsd, nil
 }
 
+// followSymlink updates rp to follow the symlink inode at its current path
+// component, jumping to the target of magic links.
+func followSymlink(ctx context.Context, rp *vfs.ResolvingPath, inode Inode) error {
+	targetVD, target, err := inode.Getlink(ctx)
+	if err != nil {
+		return err
+	}
+	if targetVD.Ok() {
+		err := rp.HandleJump(targetVD)
+		targetVD.DecRef()
+		return err
+	}
+	return rp.HandleSymlink(target)
+}
+
 // revalidateChildLocked must be called after a call to parent.vfsd.Child(name)
 // or vfs.ResolvingPath.ResolveChild(name) returns childVFSD (which may be
 // nil) to verify that the returned child (or lack thereof) is correct.
@@ -121,6 +131,7 @@ func (fs *Filesystem) revalidateChildLocked(ctx context.Context, vfsObj *vfs.Vir
 			return nil, err
 		}
 		// Reference on childVFSD dropped by a corresponding Valid.
+		childVFSD.Impl().(*Dentry).markDynamic()
 		parent.insertChildLocked(name, childVFSD)
 	}
 	return childVFSD.Impl().(*Dentry), nil
@@ -379,7 +390,7 @@ func (fs *Filesystem) OpenAt(ctx context.Context, rp *vfs.ResolvingPath, opts vf
 		if err := inode.CheckPermissions(ctx, rp.Credentials(), ats); err != nil {
 			return nil, err
 		}
-		return inode.Open(rp, vfsd, opts)
+		return inode.Open(ctx, rp, vfsd, opts)
 	}
 
 	// May create new file.
@@ -398,7 +409,7 @@ func (fs *Filesystem) OpenAt(ctx context.Context, rp *vfs.ResolvingPath, opts vf
 		if err := inode.CheckPermissions(ctx, rp.Credentials(), ats); err != nil {
 			return nil, err
 		}
-		return inode.Open(rp, vfsd, opts)
+		return inode.Open(ctx, rp, vfsd, opts)
 	}
 afterTrailingSymlink:
 	parentVFSD, parentInode, err := fs.walkParentDirLocked(ctx, rp)
@@ -438,7 +449,7 @@ afterTrailingSymlink:
 			return nil, err
 		}
 		parentVFSD.Impl().(*Dentry).InsertChild(pc, child)
-		return child.Impl().(*Dentry).inode.Open(rp, child, opts)
+		return child.Impl().(*Dentry).inode.Open(ctx, rp, child, opts)
 	}
 	// Open existing file or follow symlink.
 	if mustCreate {
@@ -448,11 +459,7 @@ afterTrailingSymlink:
 	childInode := childDentry.inode
 	if rp.ShouldFollowSymlink() {
 		if childDentry.isSymlink() {
-			target, err := childInode.Readlink(ctx)
-			if err != nil {
-				return nil, err
-			}
-			if err := rp.HandleSymlink(target); err != nil {
+			if err := followSymlink(ctx, rp, childInode); err != nil {
 				return nil, err
 			}
 			// rp.Final() may no longer be true since we now need to resolve the
@@ -463,7 +470,7 @@ afterTrailingSymlink:
 	if err := childInode.CheckPermissions(ctx, rp.Credentials(), ats); err != nil {
 		return nil, err
 	}
-	return childInode.Open(rp, childVFSD, opts)
+	return childInode.Open(ctx, rp, childVFSD, opts)
 }
 
 // ReadlinkAt implements vfs.FilesystemImpl.ReadlinkAt.
@@ -147,6 +147,18 @@ func (fs *Filesystem) VFSFilesystem() *vfs.Filesystem {
 	return &fs.vfsfs
 }
 
+// filesystemImpl is implemented by *Filesystem and by types embedding it,
+// which may be used as the vfs.FilesystemImpl in place of Filesystem, e.g. to
+// extend Release.
+type filesystemImpl interface {
+	kernfs() *Filesystem
+}
+
+// kernfs implements filesystemImpl.kernfs.
+func (fs *Filesystem) kernfs() *Filesystem {
+	return fs
+}
+
 // NextIno allocates a new inode number on this filesystem.
 func (fs *Filesystem) NextIno() uint64 {
 	return atomic.AddUint64(&fs.nextInoMinusOne, 1)
@@ -159,6 +171,10 @@ const (
 
 	// Dentry points to a symlink inode.
 	dflagsIsSymlink
+
+	// Dentry was returned by a dynamic lookup, and is only cached in its
+	// parent's dentry cache. See Filesystem.TrimCache.
+	dflagsIsDynamic
 )
 
 // Dentry implements vfs.DentryImpl.
@@ -218,6 +234,21 @@ func (d *Dentry) isSymlink() bool {
 	return atomic.LoadUint32(&d.flags)&dflagsIsSymlink != 0
 }
 
+// isDynamic checks whether the dentry was returned by a dynamic lookup.
+func (d *Dentry) isDynamic() bool {
+	return atomic.LoadUint32(&d.flags)&dflagsIsDynamic != 0
+}
+
+// markDynamic records that the dentry was returned by a dynamic lookup.
+//
+// The load and store are not a single atomic operation: this is safe because
+// markDynamic is the only writer of d.flags after Init, and is called with
+// Filesystem.mu locked. The store is atomic so that concurrent readers, which
+// don't hold Filesystem.mu, observe either the old or the new flags.
+func (d *Dentry) markDynamic() {
+	atomic.StoreUint32(&d.flags, atomic.LoadUint32(&d.flags)|dflagsIsDynamic)
+}
+
 // DecRef implements vfs.DentryImpl.DecRef.
 func (d *Dentry) DecRef() {
 	d.AtomicRefCount.DecRefWithDestructor(d.destroy)
@@ -303,7 +334,7 @@ type Inode interface {
 	// inode for its lifetime.
 	//
 	// Precondition: !rp.Done(). vfsd.Impl() must be a kernfs Dentry.
-	Open(rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error)
+	Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error)
 }
 
 type inodeRefs interface {
@@ -419,4 +450,14 @@ type inodeSymlink interface {
 	// Readlink resolves the target of a symbolic link. If an inode is not a
 	// symlink, the implementation should return EINVAL.
 	Readlink(ctx context.Context) (string, error)
+
+	// Getlink returns the target of a symbolic link, as used by path
+	// resolution:
+	//  - If the inode is a "magic link" like /proc/[pid]/cwd, Getlink returns
+	//    the VirtualDentry it refers to, with a reference taken, and path
+	//    resolution continues from it.
+	//  - Otherwise, Getlink returns the symlink target, which path resolution
+	//    follows as a pathname.
+	// If an inode is not a symlink, the implementation should return EINVAL.
+	Getlink(ctx context.Context) (vfs.VirtualDentry, string, error)
 }
@@ -0,0 +1,180 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file implements dentry cache introspection and trimming for kernfs.
+
+package kernfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// DirStats describes the dentries cached under a single directory.
+type DirStats struct {
+	// Path is the path of the directory relative to the root passed to
+	// Filesystem.Stats.
+	Path string
+
+	// Dentries is the number of child dentries cached under the directory.
+	Dentries int
+
+	// NegativeDentries is the number of failed lookups cached under the
+	// directory. Kernfs doesn't cache failed lookups, so this is currently
+	// always 0.
+	NegativeDentries int
+}
+
+// Stats describes the dentries and inodes cached by a kernfs filesystem.
+type Stats struct {
+	// Dentries is the number of live dentries, including the root.
+	Dentries int
+
+	// Inodes is the number of distinct inodes referenced by live dentries.
+	Inodes int
+
+	// NegativeDentries is the total number of cached failed lookups. See
+	// DirStats.NegativeDentries.
+	NegativeDentries int
+
+	// Dirs breaks down the dentry counts by directory, sorted by path. Only
+	// directories with cached children are included.
+	Dirs []DirStats
+
+	// SizeEstimate is a rough estimate of the memory used by the live
+	// dentries, in bytes. It doesn't account for the inodes they point to. It
+	// is only computed if requested.
+	SizeEstimate uint64
+}
+
+// String implements fmt.Stringer.String.
+func (s Stats) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "dentries %d inodes %d negative %d", s.Dentries, s.Inodes, s.NegativeDentries)
+	if s.SizeEstimate != 0 {
+		fmt.Fprintf(&buf, " size %d", s.SizeEstimate)
+	}
+	buf.WriteByte('\n')
+	for _, dir := range s.Dirs {
+		fmt.Fprintf(&buf, "%s: dentries %d negative %d\n", dir.Path, dir.Dentries, dir.NegativeDentries)
+	}
+	return buf.String()
+}
+
+// Stats returns statistics on the dentries cached in the tree rooted at root.
+// If estimateSize is true, Stats also estimates the memory they use.
+func (fs *Filesystem) Stats(root *Dentry, estimateSize bool) Stats {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var stats Stats
+	inodes := make(map[Inode]struct{})
+	fs.statsLocked(root, "/", estimateSize, &stats, inodes)
+	stats.Inodes = len(inodes)
+	sort.Slice(stats.Dirs, func(i, j int) bool { return stats.Dirs[i].Path < stats.Dirs[j].Path })
+	return stats
+}
+
+// Preconditions: fs.mu must be locked for at least reading.
+func (fs *Filesystem) statsLocked(d *Dentry, dpath string, estimateSize bool, stats *Stats, inodes map[Inode]struct{}) {
+	stats.Dentries++
+	inodes[d.inode] = struct{}{}
+	if estimateSize {
+		stats.SizeEstimate += dentrySize + uint64(len(d.vfsd.Name()))
+	}
+	if !d.isDir() {
+		return
+	}
+
+	d.dirMu.Lock()
+	children := d.vfsd.Children()
+	d.dirMu.Unlock()
+	if len(children) == 0 {
+		return
+	}
+	stats.Dirs = append(stats.Dirs, DirStats{
+		Path:     dpath,
+		Dentries: len(children),
+	})
+	for name, child := range children {
+		fs.statsLocked(child.Impl().(*Dentry), path.Join(dpath, name), estimateSize, stats, inodes)
+	}
+}
+
+// TrimCache drops cached dentries in the tree rooted at root that were
+// returned by dynamic lookups and are no longer referenced by anything other
+// than the dentry cache, along with their cached descendants. Dropped dentries
+// are looked up again on next access. TrimCache returns the number of dentries
+// dropped.
+//
+// TrimCache can be used to release memory held by dentries for objects that
+// are no longer accessed, such as /proc/[pid] directories of exited tasks.
+func (fs *Filesystem) TrimCache(root *Dentry) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.processDeferredDecRefsLocked()
+	return fs.trimLocked(fs.vfsfs.VirtualFilesystem(), root)
+}
+
+// Preconditions: fs.mu must be locked for writing.
+func (fs *Filesystem) trimLocked(vfsObj *vfs.VirtualFilesystem, d *Dentry) int {
+	dropped := 0
+	for _, vfsChild := range d.vfsd.Children() {
+		child := vfsChild.Impl().(*Dentry)
+		if child.isDir() {
+			dropped += fs.trimLocked(vfsObj, child)
+		}
+		if child.isDynamic() && child.unusedLocked() {
+			dropped += fs.dropLocked(vfsObj, child)
+		}
+	}
+	return dropped
+}
+
+// unusedLocked returns true if the only references on d are held by its
+// parent's dentry cache and by its cached children, and the same is true for
+// each of those children.
+//
+// Preconditions: fs.mu must be locked for writing.
+func (d *Dentry) unusedLocked() bool {
+	children := d.vfsd.Children()
+	if d.ReadRefs() != 1+int64(len(children)) {
+		return false
+	}
+	for _, child := range children {
+		if !child.Impl().(*Dentry).unusedLocked() {
+			return false
+		}
+	}
+	return true
+}
+
+// dropLocked removes d and its cached descendants from the dentry cache and
+// drops the references held on them by the cache. It returns the number of
+// dentries dropped.
+//
+// Preconditions: fs.mu must be locked for writing. d.unusedLocked().
+func (fs *Filesystem) dropLocked(vfsObj *vfs.VirtualFilesystem, d *Dentry) int {
+	dropped := 1
+	for _, child := range d.vfsd.Children() {
+		dropped += fs.dropLocked(vfsObj, child.Impl().(*Dentry))
+	}
+	vfsObj.ForceDeleteDentry(&d.vfsd)
+	d.DecRef()
+	return dropped
+}
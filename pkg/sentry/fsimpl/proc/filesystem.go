@@ -17,6 +17,7 @@ package proc
 
 import (
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -24,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // procFSType is the factory class for procfs.
@@ -44,7 +46,10 @@ func (ft *procFSType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFile
 		return nil, nil, fmt.Errorf("procfs requires a PID namespace")
 	}
 
-	procfs := &kernfs.Filesystem{}
+	procfs := &filesystem{
+		k:         k,
+		debugName: fmt.Sprintf("procfs:%d", k.UniqueID()),
+	}
 	procfs.VFSFilesystem().Init(vfsObj, procfs)
 
 	var data *InternalData
@@ -52,10 +57,145 @@ func (ft *procFSType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFile
 		data = opts.InternalData.(*InternalData)
 	}
 
-	_, dentry := newTasksInode(procfs, k, pidns, data.Cgroups)
+	speculation := data.SpeculationStoreBypass
+	if speculation == "" {
+		speculation = DefaultSpeculationStoreBypass
+	}
+
+	_, dentry := newTasksInode(&procfs.Filesystem, vfsObj, k, pidns, data.Cgroups, data.HideSelfLinks, speculation, data.MissingFiles)
+	procfs.root = dentry
+	procfs.missingFiles = data.MissingFiles
+	procfs.masked = collectDentries(dentry, data.MaskedPaths)
+	procfs.readOnly = collectDentries(dentry, data.ReadOnlyPaths)
+	procfs.emptyDir.Init(kernfs.OrderedChildrenOptions{})
+	k.RegisterCacheDebugger(procfs.debugName, procfs)
 	return procfs.VFSFilesystem(), dentry.VFSDentry(), nil
 }
 
+// filesystem implements vfs.FilesystemImpl for procfs.
+type filesystem struct {
+	kernfs.Filesystem
+
+	// k is the kernel the filesystem is registered with.
+	k *kernel.Kernel
+
+	// debugName is the name the filesystem is registered under with
+	// Kernel.RegisterCacheDebugger.
+	debugName string
+
+	// root is the root dentry of the filesystem. It is immutable.
+	root *kernfs.Dentry
+
+	// masked and readOnly are the dentries of InternalData.MaskedPaths and
+	// ReadOnlyPaths respectively, and of their descendants. They are
+	// immutable.
+	masked   map[*kernfs.Dentry]struct{}
+	readOnly map[*kernfs.Dentry]struct{}
+
+	// emptyDir holds no children, and is listed by masked directories. It is
+	// immutable.
+	emptyDir kernfs.OrderedChildren
+
+	// missingFiles records lookups of missing files, see
+	// InternalData.MissingFiles. It is immutable.
+	missingFiles *MissingFiles
+}
+
+var _ kernel.CacheDebugger = (*filesystem)(nil)
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *filesystem) Release() {
+	fs.k.UnregisterCacheDebugger(fs.debugName)
+	fs.missingFiles.logSummary()
+	fs.Filesystem.Release()
+}
+
+// CacheStats implements kernel.CacheDebugger.CacheStats.
+func (fs *filesystem) CacheStats() string {
+	return fs.Stats(fs.root, true /* estimateSize */).String()
+}
+
+// TrimCache implements kernel.CacheDebugger.TrimCache. Dentries of exited
+// tasks are only released once they are trimmed.
+func (fs *filesystem) TrimCache() int {
+	return fs.Filesystem.TrimCache(fs.root)
+}
+
+// OpenAt implements vfs.FilesystemImpl.OpenAt. Files under
+// InternalData.MaskedPaths and ReadOnlyPaths can't be opened for writing, and
+// the former are opened as empty files and directories.
+func (fs *filesystem) OpenAt(ctx context.Context, rp *vfs.ResolvingPath, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd, err := fs.Filesystem.OpenAt(ctx, rp, opts)
+	if err != nil || (len(fs.masked) == 0 && len(fs.readOnly) == 0) {
+		return fd, err
+	}
+	d := fd.Dentry().Impl().(*kernfs.Dentry)
+	_, masked := fs.masked[d]
+	_, readOnly := fs.readOnly[d]
+	if !masked && !readOnly {
+		return fd, nil
+	}
+	if vfs.MayWriteFileWithOpenFlags(opts.Flags) {
+		fd.DecRef()
+		return nil, syserror.EROFS
+	}
+	if !masked {
+		return fd, nil
+	}
+
+	// Replace fd with an empty file or directory at the same location.
+	defer fd.DecRef()
+	stat, err := fd.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return nil, err
+	}
+	if linux.FileMode(stat.Mode).FileType() == linux.ModeDirectory {
+		emptyFD := &kernfs.GenericDirectoryFD{}
+		if err := emptyFD.Init(fd.Mount(), fd.Dentry(), &fs.emptyDir, &opts); err != nil {
+			return nil, err
+		}
+		return emptyFD.VFSFileDescription(), nil
+	}
+	emptyFD := &kernfs.DynamicBytesFD{}
+	if err := emptyFD.Init(fd.Mount(), fd.Dentry(), &vfs.StaticData{}, opts.Flags); err != nil {
+		return nil, err
+	}
+	return emptyFD.VFSFileDescription(), nil
+}
+
+// collectDentries returns the dentries at paths, relative to root, and their
+// descendants. Paths that don't name a static entry of the tree, such as the
+// entries of /proc/[pid], are ignored.
+func collectDentries(root *kernfs.Dentry, paths []string) map[*kernfs.Dentry]struct{} {
+	if len(paths) == 0 {
+		return nil
+	}
+	ds := make(map[*kernfs.Dentry]struct{})
+	var add func(d *vfs.Dentry)
+	add = func(d *vfs.Dentry) {
+		ds[d.Impl().(*kernfs.Dentry)] = struct{}{}
+		for _, child := range d.Children() {
+			add(child)
+		}
+	}
+	for _, p := range paths {
+		d := root.VFSDentry()
+		for _, name := range strings.Split(p, "/") {
+			if name == "" {
+				continue
+			}
+			if d = d.Child(name); d == nil {
+				break
+			}
+		}
+		// The root itself can't be masked.
+		if d != nil && d != root.VFSDentry() {
+			add(d)
+		}
+	}
+	return ds
+}
+
 // dynamicInode is an overfitted interface for common Inodes with
 // dynamicByteSource types used in procfs.
 type dynamicInode interface {
@@ -88,4 +228,34 @@ func newStaticFile(data string) *staticFile {
 // vfs.GetFilesystemOptions.InternalData.
 type InternalData struct {
 	Cgroups map[string]string
+
+	// HideSelfLinks omits '/proc/self' and '/proc/thread-self' from the mount.
+	HideSelfLinks bool
+
+	// MaskedPaths are paths relative to the root of the mount, e.g.
+	// "sys/kernel", that are hidden from applications: the files they name
+	// and their descendants read as empty, directories list no entries, and
+	// they can't be opened for writing. They can still be stat'ed.
+	MaskedPaths []string
+
+	// ReadOnlyPaths are paths relative to the root of the mount whose files,
+	// and their descendants, can't be opened for writing.
+	ReadOnlyPaths []string
+
+	// SpeculationStoreBypass is reported as the Speculation_Store_Bypass state
+	// of every task in /proc/[pid]/status, using the strings of Linux's
+	// fs/proc/array.go:task_seccomp(). If empty,
+	// DefaultSpeculationStoreBypass is used.
+	SpeculationStoreBypass string
+
+	// MissingFiles, if not nil, records lookups of files that don't exist
+	// in /proc and /proc/[pid], for compatibility triage. The summary is
+	// logged when the mount is released.
+	MissingFiles *MissingFiles
 }
+
+// DefaultSpeculationStoreBypass is the Speculation_Store_Bypass state reported
+// in /proc/[pid]/status if InternalData.SpeculationStoreBypass is unset. The
+// sandbox doesn't let applications control speculation, so it doesn't report
+// them as vulnerable.
+const DefaultSpeculationStoreBypass = "not vulnerable"
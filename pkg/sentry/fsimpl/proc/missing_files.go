@@ -0,0 +1,134 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Patterns of the paths recorded for lookups in task directories, which are
+// aggregated regardless of the task.
+const (
+	taskDirPattern    = "[pid]"
+	subtaskDirPattern = "[pid]/task/[tid]"
+)
+
+// MissingFile describes the lookups of a file that doesn't exist in procfs.
+type MissingFile struct {
+	// Path is the path of the file relative to the root of the mount, e.g.
+	// "sys/foo". Files in task directories are recorded with the PIDs
+	// replaced by placeholders, e.g. "[pid]/foo" or "[pid]/task/[tid]/foo".
+	Path string
+
+	// Count is the number of lookups of Path.
+	Count uint64
+
+	// FirstTID is the thread ID, in the root PID namespace, of the task that
+	// first looked up Path, and FirstTaskName is its name. FirstTID is 0 if
+	// Path was first looked up by something other than a task.
+	FirstTID      kernel.ThreadID
+	FirstTaskName string
+}
+
+// MissingFiles records lookups of files that don't exist in procfs, to help
+// find the files that an application expects but procfs doesn't implement.
+// The first lookup of each file is logged as a warning.
+//
+// Procfs records lookups in a MissingFiles passed as
+// InternalData.MissingFiles. A nil *MissingFiles records nothing.
+type MissingFiles struct {
+	// limit is the maximum number of files recorded. It is immutable.
+	limit int
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// files maps the paths of the recorded files to their lookups.
+	files map[string]*MissingFile
+
+	// dropped is the number of lookups of files that weren't recorded
+	// because limit was reached.
+	dropped uint64
+}
+
+// NewMissingFiles returns a MissingFiles that records up to limit files.
+// Lookups of other files are only counted.
+func NewMissingFiles(limit int) *MissingFiles {
+	return &MissingFiles{
+		limit: limit,
+		files: make(map[string]*MissingFile),
+	}
+}
+
+// record records a lookup of the missing file at path.
+func (m *MissingFiles) record(ctx context.Context, path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[path]; ok {
+		f.Count++
+		return
+	}
+	if len(m.files) >= m.limit {
+		m.dropped++
+		return
+	}
+	f := &MissingFile{Path: path, Count: 1}
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		f.FirstTID = t.Kernel().TaskSet().Root.IDOfTask(t)
+		f.FirstTaskName = t.Name()
+	}
+	m.files[path] = f
+	log.Warningf("procfs: missing file %q looked up by task %d (%q)", path, f.FirstTID, f.FirstTaskName)
+}
+
+// Files returns the recorded files, sorted by path.
+func (m *MissingFiles) Files() []MissingFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make([]MissingFile, 0, len(m.files))
+	for _, f := range m.files {
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Dropped returns the number of lookups of files that weren't recorded
+// because the limit passed to NewMissingFiles was reached.
+func (m *MissingFiles) Dropped() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dropped
+}
+
+// logSummary logs the recorded files at the debug level.
+func (m *MissingFiles) logSummary() {
+	if m == nil || !log.IsLogging(log.Debug) {
+		return
+	}
+	files := m.Files()
+	log.Debugf("procfs: %d missing files looked up, %d lookups not recorded", len(files), m.Dropped())
+	for _, f := range files {
+		log.Debugf("procfs: missing file %q: %d lookups, first by task %d (%q)", f.Path, f.Count, f.FirstTID, f.FirstTaskName)
+	}
+}
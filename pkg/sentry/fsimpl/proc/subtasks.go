@@ -35,20 +35,24 @@ type subtasksInode struct {
 	kernfs.InodeAttrs
 	kernfs.OrderedChildren
 
-	task              *kernel.Task
-	pidns             *kernel.PIDNamespace
-	inoGen            InoGenerator
-	cgroupControllers map[string]string
+	task                   *kernel.Task
+	pidns                  *kernel.PIDNamespace
+	inoGen                 InoGenerator
+	cgroupControllers      map[string]string
+	speculationStoreBypass string
+	missingFiles           *MissingFiles
 }
 
 var _ kernfs.Inode = (*subtasksInode)(nil)
 
-func newSubtasks(task *kernel.Task, pidns *kernel.PIDNamespace, inoGen InoGenerator, cgroupControllers map[string]string) *kernfs.Dentry {
+func newSubtasks(task *kernel.Task, pidns *kernel.PIDNamespace, inoGen InoGenerator, cgroupControllers map[string]string, speculationStoreBypass string, missingFiles *MissingFiles) *kernfs.Dentry {
 	subInode := &subtasksInode{
-		task:              task,
-		pidns:             pidns,
-		inoGen:            inoGen,
-		cgroupControllers: cgroupControllers,
+		task:                   task,
+		pidns:                  pidns,
+		inoGen:                 inoGen,
+		cgroupControllers:      cgroupControllers,
+		speculationStoreBypass: speculationStoreBypass,
+		missingFiles:           missingFiles,
 	}
 	// Note: credentials are overridden by taskOwnedInode.
 	subInode.InodeAttrs.Init(task.Credentials(), inoGen.NextIno(), linux.ModeDirectory|0555)
@@ -81,40 +85,50 @@ func (i *subtasksInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, e
 		return nil, syserror.ENOENT
 	}
 
-	subTaskDentry := newTaskInode(i.inoGen, subTask, i.pidns, false, i.cgroupControllers)
+	subTaskDentry := newTaskInode(i.inoGen, subTask, i.pidns, false, i.cgroupControllers, i.speculationStoreBypass, i.missingFiles)
 	return subTaskDentry.VFSDentry(), nil
 }
 
 // IterDirents implements kernfs.inodeDynamicLookup.
-func (i *subtasksInode) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+//
+// As in /proc, the offset of each entry is derived from its TID, so that
+// resuming from the offset reported after an entry continues with the
+// following thread, even if threads were created or exited in between:
+//
+//	0                     "."
+//	1                     ".."
+//	tidOffset+tid         "[tid]"
+//	tidOffset+maxTaskID   end of directory
+func (i *subtasksInode) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback, offset, _ int64) (int64, error) {
+	const tidOffset = 2
+	if offset >= tidOffset+maxTaskID {
+		return offset, nil
+	}
+
 	tasks := i.task.ThreadGroup().MemberIDs(i.pidns)
 	if len(tasks) == 0 {
 		return offset, syserror.ENOENT
 	}
+	sort.Slice(tasks, func(a, b int) bool { return tasks[a] < tasks[b] })
 
-	tids := make([]int, 0, len(tasks))
-	for _, tid := range tasks {
-		tids = append(tids, int(tid))
-	}
-
-	sort.Ints(tids)
-	for _, tid := range tids[relOffset:] {
+	start := kernel.ThreadID(offset - tidOffset)
+	first := sort.Search(len(tasks), func(j int) bool { return tasks[j] >= start })
+	for _, tid := range tasks[first:] {
 		dirent := vfs.Dirent{
 			Name:    strconv.FormatUint(uint64(tid), 10),
 			Type:    linux.DT_DIR,
 			Ino:     i.inoGen.NextIno(),
-			NextOff: offset + 1,
+			NextOff: tidOffset + int64(tid) + 1,
 		}
 		if !cb.Handle(dirent) {
-			return offset, nil
+			return tidOffset + int64(tid), nil
 		}
-		offset++
 	}
-	return offset, nil
+	return tidOffset + maxTaskID, nil
 }
 
 // Open implements kernfs.Inode.
-func (i *subtasksInode) Open(rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+func (i *subtasksInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
 	fd := &kernfs.GenericDirectoryFD{}
 	fd.Init(rp.Mount(), vfsd, &i.OrderedChildren, &opts)
 	return fd.VFSFileDescription(), nil
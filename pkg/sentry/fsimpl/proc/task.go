@@ -39,43 +39,73 @@ type taskInode struct {
 	kernfs.OrderedChildren
 
 	task *kernel.Task
+
+	// pidns is the PID namespace the directory was looked up in.
+	pidns *kernel.PIDNamespace
+
+	// tid is task's thread ID in pidns when the directory was looked up. A
+	// task's thread ID changes when it execs from a non-leader thread, after
+	// which the directory's name no longer refers to it.
+	tid kernel.ThreadID
+
+	// missingFiles records lookups of missing files in the directory. It
+	// may be nil.
+	missingFiles *MissingFiles
+
+	// pattern is the path recorded in missingFiles for the directory.
+	pattern string
 }
 
 var _ kernfs.Inode = (*taskInode)(nil)
 
-func newTaskInode(inoGen InoGenerator, task *kernel.Task, pidns *kernel.PIDNamespace, isThreadGroup bool, cgroupControllers map[string]string) *kernfs.Dentry {
+func newTaskInode(inoGen InoGenerator, task *kernel.Task, pidns *kernel.PIDNamespace, isThreadGroup bool, cgroupControllers map[string]string, speculationStoreBypass string, missingFiles *MissingFiles) *kernfs.Dentry {
 	contents := map[string]*kernfs.Dentry{
-		"auxv":    newTaskOwnedFile(task, inoGen.NextIno(), 0444, &auxvData{task: task}),
-		"cmdline": newTaskOwnedFile(task, inoGen.NextIno(), 0444, &cmdlineData{task: task, arg: cmdlineDataArg}),
-		"comm":    newComm(task, inoGen.NextIno(), 0444),
-		"environ": newTaskOwnedFile(task, inoGen.NextIno(), 0444, &cmdlineData{task: task, arg: environDataArg}),
-		//"exe":       newExe(t, msrc),
-		//"fd":        newFdDir(t, msrc),
-		//"fdinfo":    newFdInfoDir(t, msrc),
-		"gid_map": newTaskOwnedFile(task, inoGen.NextIno(), 0644, &idMapData{task: task, gids: true}),
-		"io":      newTaskOwnedFile(task, inoGen.NextIno(), 0400, newIO(task, isThreadGroup)),
-		"maps":    newTaskOwnedFile(task, inoGen.NextIno(), 0444, &mapsData{task: task}),
-		//"mountinfo": seqfile.NewSeqFileInode(t, &mountInfoFile{t: t}, msrc),
-		//"mounts":    seqfile.NewSeqFileInode(t, &mountsFile{t: t}, msrc),
+		"auxv":      newTaskTracedFile(task, inoGen.NextIno(), 0444, &auxvData{task: task}),
+		"cmdline":   newTaskOwnedFile(task, inoGen.NextIno(), 0444, &cmdlineData{task: task, arg: cmdlineDataArg}),
+		"comm":      newComm(task, inoGen.NextIno(), 0444),
+		"cwd":       newFSContextSymlink(task, inoGen.NextIno(), false /* root */),
+		"environ":   newTaskTracedFile(task, inoGen.NextIno(), 0444, &cmdlineData{task: task, arg: environDataArg}),
+		"exe":       newExeSymlink(task, inoGen.NextIno()),
+		"fd":        newFDDirInode(task, inoGen),
+		"fdinfo":    newFDInfoDirInode(task, inoGen),
+		"gid_map":   newTaskOwnedFile(task, inoGen.NextIno(), 0644, &idMapData{task: task, gids: true}),
+		"io":        newTaskOwnedFile(task, inoGen.NextIno(), 0400, newIO(task, isThreadGroup)),
+		"limits":    newTaskOwnedFile(task, inoGen.NextIno(), 0444, &limitsData{task: task}),
+		"maps":      newTaskOwnedFile(task, inoGen.NextIno(), 0444, &mapsData{task: task}),
+		"mem":       newMemInode(task, inoGen.NextIno(), 0600),
+		"mountinfo": newTaskOwnedFile(task, inoGen.NextIno(), 0444, &mountInfoData{task: task}),
+		"mounts":    newTaskOwnedFile(task, inoGen.NextIno(), 0444, &mountsData{task: task}),
 		"ns": newTaskOwnedDir(task, inoGen.NextIno(), 0511, map[string]*kernfs.Dentry{
 			"net":  newNamespaceSymlink(task, inoGen.NextIno(), "net"),
 			"pid":  newNamespaceSymlink(task, inoGen.NextIno(), "pid"),
 			"user": newNamespaceSymlink(task, inoGen.NextIno(), "user"),
 		}),
-		"smaps":   newTaskOwnedFile(task, inoGen.NextIno(), 0444, &smapsData{task: task}),
-		"stat":    newTaskOwnedFile(task, inoGen.NextIno(), 0444, &taskStatData{task: task, pidns: pidns, tgstats: isThreadGroup}),
-		"statm":   newTaskOwnedFile(task, inoGen.NextIno(), 0444, &statmData{task: task}),
-		"status":  newTaskOwnedFile(task, inoGen.NextIno(), 0444, &statusData{task: task, pidns: pidns}),
-		"uid_map": newTaskOwnedFile(task, inoGen.NextIno(), 0644, &idMapData{task: task, gids: false}),
+		"oom_score":     newTaskOwnedFile(task, inoGen.NextIno(), 0444, &oomScoreData{task: task}),
+		"oom_score_adj": newTaskOwnedFile(task, inoGen.NextIno(), 0644, &oomScoreAdjData{task: task}),
+		"root":          newFSContextSymlink(task, inoGen.NextIno(), true /* root */),
+		"sched":         newTaskOwnedFile(task, inoGen.NextIno(), 0444, &schedData{task: task, pidns: pidns}),
+		"smaps":         newTaskOwnedFile(task, inoGen.NextIno(), 0444, &smapsData{task: task}),
+		"stat":          newTaskOwnedFile(task, inoGen.NextIno(), 0444, &taskStatData{task: task, pidns: pidns, tgstats: isThreadGroup}),
+		"statm":         newTaskOwnedFile(task, inoGen.NextIno(), 0444, &statmData{task: task}),
+		"status":        newTaskOwnedFile(task, inoGen.NextIno(), 0444, &statusData{task: task, pidns: pidns, speculationStoreBypass: speculationStoreBypass}),
+		"uid_map":       newTaskOwnedFile(task, inoGen.NextIno(), 0644, &idMapData{task: task, gids: false}),
+		"wchan":         newTaskOwnedFile(task, inoGen.NextIno(), 0444, &wchanData{task: task}),
 	}
 	if isThreadGroup {
-		contents["task"] = newSubtasks(task, pidns, inoGen, cgroupControllers)
+		contents["task"] = newSubtasks(task, pidns, inoGen, cgroupControllers, speculationStoreBypass, missingFiles)
+	} else {
+		// Like Linux, children is only shown per thread, as each thread has
+		// its own children.
+		contents["children"] = newTaskOwnedFile(task, inoGen.NextIno(), 0444, &childrenData{task: task, pidns: pidns})
 	}
 	if len(cgroupControllers) > 0 {
 		contents["cgroup"] = newTaskOwnedFile(task, inoGen.NextIno(), 0444, newCgroupData(cgroupControllers))
 	}
 
-	taskInode := &taskInode{task: task}
+	taskInode := &taskInode{task: task, pidns: pidns, tid: pidns.IDOfTask(task), missingFiles: missingFiles, pattern: subtaskDirPattern}
+	if isThreadGroup {
+		taskInode.pattern = taskDirPattern
+	}
 	// Note: credentials are overridden by taskOwnedInode.
 	taskInode.InodeAttrs.Init(task.Credentials(), inoGen.NextIno(), linux.ModeDirectory|0555)
 
@@ -91,14 +121,23 @@ func newTaskInode(inoGen InoGenerator, task *kernel.Task, pidns *kernel.PIDNames
 }
 
 // Valid implements kernfs.inodeDynamicLookup. This inode remains valid as long
-// as the task is still running. When it's dead, another tasks with the same
-// PID could replace it.
+// as the task is still running and still has the same TID. When it's dead,
+// another tasks with the same PID could replace it. When it has execed from a
+// non-leader thread, it has taken over the leader's TID and its old TID no
+// longer exists.
 func (i *taskInode) Valid(ctx context.Context) bool {
-	return i.task.ExitState() != kernel.TaskExitDead
+	return i.task.ExitState() != kernel.TaskExitDead && i.pidns.IDOfTask(i.task) == i.tid
+}
+
+// Lookup implements kernfs.inodeDynamicLookup. All entries of the directory
+// are static, so it only records the lookup of a missing file.
+func (i *taskInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, error) {
+	i.missingFiles.record(ctx, i.pattern+"/"+name)
+	return nil, syserror.ENOENT
 }
 
 // Open implements kernfs.Inode.
-func (i *taskInode) Open(rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+func (i *taskInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
 	fd := &kernfs.GenericDirectoryFD{}
 	fd.Init(rp.Mount(), vfsd, &i.OrderedChildren, &opts)
 	return fd.VFSFileDescription(), nil
@@ -134,6 +173,35 @@ func newTaskOwnedFile(task *kernel.Task, ino uint64, perm linux.FileMode, inode
 	return d
 }
 
+// taskTracedInode implements kernfs.Inode for task files that may only be
+// opened by callers that can trace the owner task in PTRACE_MODE_READ mode,
+// e.g. /proc/[pid]/environ. See fs/proc/base.c:__mem_open.
+type taskTracedInode struct {
+	taskOwnedInode
+}
+
+var _ kernfs.Inode = (*taskTracedInode)(nil)
+
+// newTaskTracedFile is like newTaskOwnedFile, but the returned file can only
+// be opened by callers that can trace task.
+func newTaskTracedFile(task *kernel.Task, ino uint64, perm linux.FileMode, inode dynamicInode) *kernfs.Dentry {
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.Init(task.Credentials(), ino, inode, perm)
+
+	taskInode := &taskTracedInode{taskOwnedInode{Inode: inode, owner: task}}
+	d := &kernfs.Dentry{}
+	d.Init(taskInode)
+	return d
+}
+
+// Open implements kernfs.Inode.
+func (i *taskTracedInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	if !kernel.ContextCanTrace(ctx, i.owner, false) {
+		return nil, syserror.EACCES
+	}
+	return i.Inode.Open(ctx, rp, vfsd, opts)
+}
+
 func newTaskOwnedDir(task *kernel.Task, ino uint64, perm linux.FileMode, children map[string]*kernfs.Dentry) *kernfs.Dentry {
 	dir := &kernfs.StaticDirectory{}
 
@@ -0,0 +1,354 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// getTaskFD returns a reference on the file description installed at fd in
+// t's FD table, or nil if there is none.
+func getTaskFD(t *kernel.Task, fd int32) (*vfs.FileDescription, kernel.FDFlags) {
+	var (
+		file  *vfs.FileDescription
+		flags kernel.FDFlags
+	)
+	t.WithMuLocked(func(t *kernel.Task) {
+		if fdt := t.FDTable(); fdt != nil {
+			file, flags = fdt.GetVFS2(fd)
+		}
+	})
+	return file, flags
+}
+
+// taskFDExists returns true if fd is installed in t's FD table.
+func taskFDExists(t *kernel.Task, fd int32) bool {
+	file, _ := getTaskFD(t, fd)
+	if file == nil {
+		return false
+	}
+	file.DecRef()
+	return true
+}
+
+// parseTaskFD returns the fd named name in a /proc/[pid]/fd or fdinfo
+// directory of t, or ENOENT if it isn't installed.
+func parseTaskFD(t *kernel.Task, name string) (int32, error) {
+	fd, err := strconv.ParseInt(name, 10, 32)
+	if err != nil || fd < 0 {
+		return 0, syserror.ENOENT
+	}
+	if !taskFDExists(t, int32(fd)) {
+		return 0, syserror.ENOENT
+	}
+	return int32(fd), nil
+}
+
+// fdDir implements the lookups and directory iteration shared by the
+// /proc/[pid]/fd and fdinfo directories of a task.
+//
+// +stateify savable
+type fdDir struct {
+	task   *kernel.Task
+	inoGen InoGenerator
+
+	// mu protects inos.
+	mu sync.Mutex `state:"nosave"`
+
+	// inos maps the fds listed or looked up in the directory to the inode
+	// numbers of their entries, so that readdir reports the inode numbers
+	// that stat does. The entries of closed fds are dropped by iterDirents.
+	inos map[int32]uint64
+}
+
+// ino returns the inode number of the entry for fd.
+func (d *fdDir) ino(fd int32) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ino, ok := d.inos[fd]
+	if !ok {
+		if d.inos == nil {
+			d.inos = make(map[int32]uint64)
+		}
+		ino = d.inoGen.NextIno()
+		d.inos[fd] = ino
+	}
+	return ino
+}
+
+// iterDirents implements kernfs.inodeDynamicLookup.IterDirents for the
+// directory, whose entries have type typ.
+//
+// As in Linux, the offset of each entry is derived from its fd, rather than
+// from its position in the directory, so that fds closed between reads are
+// neither repeated nor skipped over.
+func (d *fdDir) iterDirents(typ uint8, cb vfs.IterDirentsCallback, offset int64) (int64, error) {
+	const (
+		fdOffset = 2
+		maxFD    = math.MaxInt32 + 1
+	)
+	if offset >= fdOffset+maxFD {
+		return offset, nil
+	}
+
+	var fds []int32
+	d.task.WithMuLocked(func(t *kernel.Task) {
+		if fdt := t.FDTable(); fdt != nil {
+			fds = fdt.GetFDs()
+		}
+	})
+	d.pruneInos(fds)
+
+	// GetFDs returns the fds in ascending order.
+	start := offset - fdOffset
+	first := sort.Search(len(fds), func(i int) bool { return int64(fds[i]) >= start })
+	for _, fd := range fds[first:] {
+		dirent := vfs.Dirent{
+			Name:    strconv.FormatUint(uint64(fd), 10),
+			Type:    typ,
+			Ino:     d.ino(fd),
+			NextOff: fdOffset + int64(fd) + 1,
+		}
+		if !cb.Handle(dirent) {
+			return fdOffset + int64(fd), nil
+		}
+	}
+	return fdOffset + maxFD, nil
+}
+
+// pruneInos drops the inode numbers of the fds that aren't in fds.
+func (d *fdDir) pruneInos(fds []int32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.inos) == 0 {
+		return
+	}
+	open := make(map[int32]struct{}, len(fds))
+	for _, fd := range fds {
+		open[fd] = struct{}{}
+	}
+	for fd := range d.inos {
+		if _, ok := open[fd]; !ok {
+			delete(d.inos, fd)
+		}
+	}
+}
+
+// fdDirInode represents the inode for /proc/[pid]/fd directory.
+//
+// +stateify savable
+type fdDirInode struct {
+	kernfs.InodeNotSymlink
+	kernfs.InodeDirectoryNoNewChildren
+	kernfs.InodeAttrs
+	kernfs.OrderedChildren
+	fdDir
+}
+
+var _ kernfs.Inode = (*fdDirInode)(nil)
+
+func newFDDirInode(task *kernel.Task, inoGen InoGenerator) *kernfs.Dentry {
+	inode := &fdDirInode{fdDir: fdDir{task: task, inoGen: inoGen}}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.InodeAttrs.Init(task.Credentials(), inoGen.NextIno(), linux.ModeDirectory|0500)
+	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+
+	dentry := &kernfs.Dentry{}
+	dentry.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return dentry
+}
+
+// Valid implements kernfs.inodeDynamicLookup.
+func (i *fdDirInode) Valid(ctx context.Context) bool {
+	return true
+}
+
+// Lookup implements kernfs.inodeDynamicLookup.
+func (i *fdDirInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, error) {
+	fd, err := parseTaskFD(i.task, name)
+	if err != nil {
+		return nil, err
+	}
+	return newFDSymlink(i.task, fd, i.ino(fd)).VFSDentry(), nil
+}
+
+// IterDirents implements kernfs.inodeDynamicLookup.
+func (i *fdDirInode) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	return i.iterDirents(linux.DT_LNK, cb, offset)
+}
+
+// Open implements kernfs.Inode.
+func (i *fdDirInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &kernfs.GenericDirectoryFD{}
+	fd.Init(rp.Mount(), vfsd, &i.OrderedChildren, &opts)
+	return fd.VFSFileDescription(), nil
+}
+
+// fdSymlink represents the inode for /proc/[pid]/fd/[fd] symlink.
+//
+// +stateify savable
+type fdSymlink struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoopRefCount
+	kernfs.InodeSymlink
+
+	task *kernel.Task
+	fd   int32
+}
+
+var _ kernfs.Inode = (*fdSymlink)(nil)
+
+func newFDSymlink(task *kernel.Task, fd int32, ino uint64) *kernfs.Dentry {
+	inode := &fdSymlink{task: task, fd: fd}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.Init(task.Credentials(), ino, linux.ModeSymlink|0777)
+
+	d := &kernfs.Dentry{}
+	d.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return d
+}
+
+// Readlink implements kernfs.Inode. Files that have no pathname, such as pipes
+// and sockets, are named by their vfs.PseudoNamer implementation.
+func (s *fdSymlink) Readlink(ctx context.Context) (string, error) {
+	file, _ := getTaskFD(s.task, s.fd)
+	if file == nil {
+		return "", syserror.ENOENT
+	}
+	defer file.DecRef()
+
+	if name := file.PseudoName(); name != "" {
+		return name, nil
+	}
+	root := vfs.RootFromContext(ctx)
+	if root.Ok() {
+		defer root.DecRef()
+	}
+	vfsObj := file.Mount().Filesystem().VirtualFilesystem()
+	return vfsObj.PathnameWithDeleted(ctx, root, file.VirtualDentry())
+}
+
+// Getlink implements kernfs.Inode.Getlink.
+//
+// TODO(gvisor.dev/issue/1624): Jump to the file like Linux, rather than
+// following its pathname.
+func (s *fdSymlink) Getlink(ctx context.Context) (vfs.VirtualDentry, string, error) {
+	target, err := s.Readlink(ctx)
+	return vfs.VirtualDentry{}, target, err
+}
+
+// Valid implements kernfs.Inode. The symlink must be looked up again once the
+// fd it refers to has been closed.
+func (s *fdSymlink) Valid(ctx context.Context) bool {
+	return taskFDExists(s.task, s.fd)
+}
+
+// fdInfoDirInode represents the inode for /proc/[pid]/fdinfo directory.
+//
+// +stateify savable
+type fdInfoDirInode struct {
+	kernfs.InodeNotSymlink
+	kernfs.InodeDirectoryNoNewChildren
+	kernfs.InodeAttrs
+	kernfs.OrderedChildren
+	fdDir
+}
+
+var _ kernfs.Inode = (*fdInfoDirInode)(nil)
+
+func newFDInfoDirInode(task *kernel.Task, inoGen InoGenerator) *kernfs.Dentry {
+	inode := &fdInfoDirInode{fdDir: fdDir{task: task, inoGen: inoGen}}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.InodeAttrs.Init(task.Credentials(), inoGen.NextIno(), linux.ModeDirectory|0500)
+	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+
+	dentry := &kernfs.Dentry{}
+	dentry.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return dentry
+}
+
+// Valid implements kernfs.inodeDynamicLookup.
+func (i *fdInfoDirInode) Valid(ctx context.Context) bool {
+	return true
+}
+
+// Lookup implements kernfs.inodeDynamicLookup.
+func (i *fdInfoDirInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, error) {
+	fd, err := parseTaskFD(i.task, name)
+	if err != nil {
+		return nil, err
+	}
+	data := &fdInfoData{task: i.task, fd: fd}
+	return newTaskOwnedFile(i.task, i.ino(fd), 0400, data).VFSDentry(), nil
+}
+
+// IterDirents implements kernfs.inodeDynamicLookup.
+func (i *fdInfoDirInode) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	return i.iterDirents(linux.DT_REG, cb, offset)
+}
+
+// Open implements kernfs.Inode.
+func (i *fdInfoDirInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &kernfs.GenericDirectoryFD{}
+	fd.Init(rp.Mount(), vfsd, &i.OrderedChildren, &opts)
+	return fd.VFSFileDescription(), nil
+}
+
+// fdInfoData implements vfs.DynamicBytesSource for /proc/[pid]/fdinfo/[fd].
+//
+// +stateify savable
+type fdInfoData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+	fd   int32
+}
+
+var _ dynamicInode = (*fdInfoData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *fdInfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	file, descriptorFlags := getTaskFD(d.task, d.fd)
+	if file == nil {
+		return syserror.ENOENT
+	}
+	defer file.DecRef()
+
+	// Compare Linux's fs/proc/fd.c:seq_show().
+	flags := uint(file.StatusFlags()) | descriptorFlags.ToLinuxFileFlags()
+	fmt.Fprintf(buf, "pos:\t%d\n", file.InfoOffset(ctx))
+	fmt.Fprintf(buf, "flags:\t0%o\n", flags)
+	fmt.Fprintf(buf, "mnt_id:\t%d\n", file.Mount().ID)
+	file.WriteFDInfo(ctx, buf)
+	return nil
+}
+
+// Valid implements kernfs.Inode. The file must be looked up again once the fd
+// it describes has been closed.
+func (d *fdInfoData) Valid(ctx context.Context) bool {
+	return taskFDExists(d.task, d.fd)
+}
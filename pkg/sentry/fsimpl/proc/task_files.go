@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -25,10 +28,12 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -123,6 +128,12 @@ const (
 	environDataArg
 )
 
+// maxExecArgsLen is the maximum number of bytes of an exec arg vector that are
+// returned by /proc/[pid]/cmdline and /proc/[pid]/environ. The bounds of the
+// vectors can be changed by the task, e.g. with prctl(PR_SET_MM), so this
+// bounds the memory needed to generate these files.
+const maxExecArgsLen = 2 << 20
+
 // cmdlineData implements vfs.DynamicBytesSource for /proc/[pid]/cmdline.
 //
 // +stateify savable
@@ -166,11 +177,14 @@ func (d *cmdlineData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		return io.EOF
 	}
 
-	// N.B. Technically this should be usermem.IOOpts.IgnorePermissions = true
-	// until Linux 4.9 (272ddc8b3735 "proc: don't use FOLL_FORCE for reading
-	// cmdline and environment").
-	writer := &bufferWriter{buf: buf}
-	if n, err := m.CopyInTo(ctx, usermem.AddrRangeSeqOf(ar), writer, usermem.IOOpts{}); n == 0 || err != nil {
+	// The bounds are controlled by the task, so don't trust them to be sane.
+	if !ar.WellFormed() {
+		return nil
+	}
+	if ar.Length() > maxExecArgsLen {
+		ar.End = ar.Start + maxExecArgsLen
+	}
+	if n, err := copyExecArgs(ctx, m, ar, buf); n == 0 {
 		// Nothing to copy or something went wrong.
 		return err
 	}
@@ -208,20 +222,50 @@ func (d *cmdlineData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 			}
 			arEnvv.End = end
 		}
-		if _, err := m.CopyInTo(ctx, usermem.AddrRangeSeqOf(arEnvv), writer, usermem.IOOpts{}); err != nil {
+		argvLen := buf.Len()
+		if _, err := copyExecArgs(ctx, m, arEnvv, buf); err != nil {
 			return err
 		}
 
 		// Linux will return envp up to and including the first NULL character,
 		// so find it.
-		if end := bytes.IndexByte(buf.Bytes()[ar.Length():], 0); end != -1 {
-			buf.Truncate(end)
+		if end := bytes.IndexByte(buf.Bytes()[argvLen:], 0); end != -1 {
+			buf.Truncate(argvLen + end)
 		}
 	}
 
 	return nil
 }
 
+// copyExecArgs appends the contents of ar in m to buf one page at a time, so
+// that buf only grows as much as the task's address space allows. It stops at
+// the first fault and returns the number of bytes appended. An error is
+// returned only if nothing was appended.
+func copyExecArgs(ctx context.Context, m *mm.MemoryManager, ar usermem.AddrRange, buf *bytes.Buffer) (int, error) {
+	// N.B. Technically this should be usermem.IOOpts.IgnorePermissions = true
+	// until Linux 4.9 (272ddc8b3735 "proc: don't use FOLL_FORCE for reading
+	// cmdline and environment").
+	writer := &bufferWriter{buf: buf}
+	var total int
+	for start := ar.Start; start < ar.End; {
+		end, ok := start.RoundDown().AddLength(usermem.PageSize)
+		if !ok || end > ar.End {
+			end = ar.End
+		}
+		n, err := m.CopyInTo(ctx, usermem.AddrRangeSeqOf(usermem.AddrRange{Start: start, End: end}), writer, usermem.IOOpts{})
+		total += int(n)
+		if err != nil {
+			if total > 0 {
+				// Return what was read before the fault.
+				return total, nil
+			}
+			return 0, err
+		}
+		start = end
+	}
+	return total, nil
+}
+
 // +stateify savable
 type commInode struct {
 	kernfs.DynamicBytesFile
@@ -265,11 +309,178 @@ var _ dynamicInode = (*commData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *commData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	buf.WriteString(d.task.Name())
+	// The name is shown unescaped, followed by a single newline.
+	buf.WriteString(taskComm(d.task))
 	buf.WriteString("\n")
 	return nil
 }
 
+// taskComm returns the name of t as Linux shows it in /proc. Like Linux, which
+// stores the name in a TASK_COMM_LEN buffer including the NUL terminator, at
+// most TASK_COMM_LEN-1 bytes of the name are returned. The name may hold any
+// other byte; each file escapes it as Linux does, see statusNameReplacer.
+func taskComm(t *kernel.Task) string {
+	name := t.Name()
+	if len(name) > linux.TASK_COMM_LEN-1 {
+		name = name[:linux.TASK_COMM_LEN-1]
+	}
+	return name
+}
+
+// statusNameReplacer escapes task names in the Name field of
+// /proc/[pid]/status, like fs/proc/array.c:proc_task_name(): newlines and
+// backslashes are escaped, so that the field stays on its own line and can be
+// unescaped. Other bytes are shown as is.
+var statusNameReplacer = strings.NewReplacer("\n", `\n`, `\`, `\\`)
+
+// wchanData implements vfs.DynamicBytesSource for /proc/[pid]/wchan.
+//
+// +stateify savable
+type wchanData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*wchanData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *wchanData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Like Linux, the symbol isn't followed by a newline, and tasks that
+	// aren't blocked at a known site report "0".
+	wchan := d.task.WaitChannel()
+	if wchan == "" {
+		wchan = "0"
+	}
+	buf.WriteString(wchan)
+	return nil
+}
+
+// limitsData implements vfs.DynamicBytesSource for /proc/[pid]/limits.
+//
+// +stateify savable
+type limitsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*limitsData)(nil)
+
+// limitNames are the rows of /proc/[pid]/limits, in the order of the Linux
+// RLIMIT_* values. See fs/proc/base.c:lnames.
+var limitNames = []struct {
+	resource int
+	name     string
+	// unit is empty for limits without a unit.
+	unit string
+}{
+	{linux.RLIMIT_CPU, "Max cpu time", "seconds"},
+	{linux.RLIMIT_FSIZE, "Max file size", "bytes"},
+	{linux.RLIMIT_DATA, "Max data size", "bytes"},
+	{linux.RLIMIT_STACK, "Max stack size", "bytes"},
+	{linux.RLIMIT_CORE, "Max core file size", "bytes"},
+	{linux.RLIMIT_RSS, "Max resident set", "bytes"},
+	{linux.RLIMIT_NPROC, "Max processes", "processes"},
+	{linux.RLIMIT_NOFILE, "Max open files", "files"},
+	{linux.RLIMIT_MEMLOCK, "Max locked memory", "bytes"},
+	{linux.RLIMIT_AS, "Max address space", "bytes"},
+	{linux.RLIMIT_LOCKS, "Max file locks", "locks"},
+	{linux.RLIMIT_SIGPENDING, "Max pending signals", "signals"},
+	{linux.RLIMIT_MSGQUEUE, "Max msgqueue size", "bytes"},
+	{linux.RLIMIT_NICE, "Max nice priority", ""},
+	{linux.RLIMIT_RTPRIO, "Max realtime priority", ""},
+	{linux.RLIMIT_RTTIME, "Max realtime timeout", "us"},
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *limitsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// The column widths match Linux, so that the file can be parsed by fixed
+	// offsets.
+	fmt.Fprintf(buf, "%-25s %-20s %-20s %-10s\n", "Limit", "Soft Limit", "Hard Limit", "Units")
+	ls := d.task.ThreadGroup().Limits().GetCopy()
+	for _, l := range limitNames {
+		lim := ls.Get(limits.FromLinuxResource[l.resource])
+		fmt.Fprintf(buf, "%-25s %-20s %-20s ", l.name, limitString(lim.Cur), limitString(lim.Max))
+		if l.unit != "" {
+			fmt.Fprintf(buf, "%-10s", l.unit)
+		}
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
+// limitString returns the value of a limit as shown in /proc/[pid]/limits.
+func limitString(v uint64) string {
+	if v == limits.Infinity {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// schedData implements vfs.DynamicBytesSource for /proc/[pid]/sched.
+//
+// +stateify savable
+type schedData struct {
+	kernfs.DynamicBytesFile
+
+	task  *kernel.Task
+	pidns *kernel.PIDNamespace
+}
+
+var _ dynamicInode = (*schedData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *schedData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Only the scheduling fields that the sentry tracks are shown. See
+	// kernel/sched/debug.c:proc_sched_show_task().
+	fmt.Fprintf(buf, "%s (%d, #threads: %d)\n", taskComm(d.task), d.pidns.IDOfTask(d.task), d.task.ThreadGroup().Count())
+	fmt.Fprintf(buf, "%s\n", strings.Repeat("-", 67))
+	// Like Linux, show the runtime in milliseconds with nanosecond
+	// precision. The Go runtime, not the sentry, preempts task goroutines,
+	// so there are no involuntary switches.
+	cputime := d.task.CPUStats()
+	sum := (cputime.UserTime + cputime.SysTime).Nanoseconds()
+	fmt.Fprintf(buf, "%-45s:%14d.%06d\n", "se.sum_exec_runtime", sum/1e6, sum%1e6)
+	fmt.Fprintf(buf, "%-45s:%21d\n", "nr_switches", cputime.VoluntarySwitches)
+	fmt.Fprintf(buf, "%-45s:%21d\n", "nr_voluntary_switches", cputime.VoluntarySwitches)
+	fmt.Fprintf(buf, "%-45s:%21d\n", "nr_involuntary_switches", 0)
+	fmt.Fprintf(buf, "%-45s:%21d\n", "policy", linux.SCHED_NORMAL)
+	fmt.Fprintf(buf, "%-45s:%21d\n", "prio", linux.DEFAULT_PRIO+d.task.Niceness())
+	return nil
+}
+
+// childrenData implements vfs.DynamicBytesSource for
+// /proc/[pid]/task/[tid]/children.
+//
+// +stateify savable
+type childrenData struct {
+	kernfs.DynamicBytesFile
+
+	task  *kernel.Task
+	pidns *kernel.PIDNamespace
+}
+
+var _ dynamicInode = (*childrenData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *childrenData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Like Linux, list the PIDs of the children of this thread only, each
+	// followed by a space. Children outside of pidns aren't shown. See
+	// fs/proc/array.c:children_seq_show().
+	var pids []int
+	for _, child := range d.task.Children() {
+		if pid := d.pidns.IDOfThreadGroup(child.ThreadGroup()); pid != 0 {
+			pids = append(pids, int(pid))
+		}
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		fmt.Fprintf(buf, "%d ", pid)
+	}
+	return nil
+}
+
 // idMapData implements vfs.DynamicBytesSource for /proc/[pid]/{gid_map|uid_map}.
 //
 // +stateify savable
@@ -354,7 +565,9 @@ var _ dynamicInode = (*taskStatData)(nil)
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "%d ", s.pidns.IDOfTask(s.task))
-	fmt.Fprintf(buf, "(%s) ", s.task.Name())
+	// Like Linux, the name is shown unescaped, so it may hold parentheses,
+	// spaces and newlines. Parsers find its end by the last ')' in the file.
+	fmt.Fprintf(buf, "(%s) ", taskComm(s.task))
 	fmt.Fprintf(buf, "%c ", s.task.StateStatus()[0])
 	ppid := kernel.ThreadID(0)
 	if parent := s.task.Parent(); parent != nil {
@@ -363,7 +576,16 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "%d ", ppid)
 	fmt.Fprintf(buf, "%d ", s.pidns.IDOfProcessGroup(s.task.ThreadGroup().ProcessGroup()))
 	fmt.Fprintf(buf, "%d ", s.pidns.IDOfSession(s.task.ThreadGroup().Session()))
-	fmt.Fprintf(buf, "0 0 " /* tty_nr tpgid */)
+	// Like Linux, tpgid is -1 if there is no controlling terminal. Terminals
+	// are pseudoterminal slaves.
+	ttyNr, tpgid := uint32(0), int64(-1)
+	if tty, fg := s.task.ThreadGroup().ForegroundTTY(); tty != nil {
+		ttyNr = linux.MakeDeviceID(linux.UNIX98_PTY_SLAVE_MAJOR, tty.Index)
+		if fg != nil {
+			tpgid = int64(s.pidns.IDOfProcessGroup(fg))
+		}
+	}
+	fmt.Fprintf(buf, "%d %d ", ttyNr, tpgid)
 	fmt.Fprintf(buf, "0 " /* flags */)
 	fmt.Fprintf(buf, "0 0 0 0 " /* minflt cminflt majflt cmajflt */)
 	var cputime usage.CPUStats
@@ -389,25 +611,45 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			rss = mm.ResidentSetPages()
 		}
 	})
-	fmt.Fprintf(buf, "%d %d ", vss, rss/usermem.PageSize)
+	fmt.Fprintf(buf, "%d %d ", vss, rss)
 
 	// rsslim.
 	fmt.Fprintf(buf, "%d ", s.task.ThreadGroup().Limits().Get(limits.Rss).Cur)
 
 	fmt.Fprintf(buf, "0 0 0 0 0 " /* startcode endcode startstack kstkesp kstkeip */)
-	fmt.Fprintf(buf, "0 0 0 0 0 " /* signal blocked sigignore sigcatch wchan */)
+	fmt.Fprintf(buf, "0 0 0 0 " /* signal blocked sigignore sigcatch */)
+	// Like Linux, show whether the task is blocked at a wait channel rather
+	// than its address, which is in /proc/[pid]/wchan.
+	wchan := 0
+	if s.task.WaitChannel() != "" {
+		wchan = 1
+	}
+	fmt.Fprintf(buf, "%d ", wchan)
 	fmt.Fprintf(buf, "0 0 " /* nswap cnswap */)
 	terminationSignal := linux.Signal(0)
 	if s.task == s.task.ThreadGroup().Leader() {
 		terminationSignal = s.task.ThreadGroup().TerminationSignal()
 	}
 	fmt.Fprintf(buf, "%d ", terminationSignal)
-	fmt.Fprintf(buf, "0 0 0 " /* processor rt_priority policy */)
+	fmt.Fprintf(buf, "%d ", s.task.CPU())
+	fmt.Fprintf(buf, "0 0 " /* rt_priority policy */)
 	fmt.Fprintf(buf, "0 0 0 " /* delayacct_blkio_ticks guest_time cguest_time */)
-	fmt.Fprintf(buf, "0 0 0 0 0 0 0 " /* start_data end_data start_brk arg_start arg_end env_start env_end */)
+	fmt.Fprintf(buf, "0 0 " /* start_data end_data */)
+	// Like Linux, only show the memory layout to tasks that can trace.
+	var brk, argv, envv usermem.AddrRange
+	if kernel.ContextCanTrace(ctx, s.task, false) {
+		s.task.WithMuLocked(func(t *kernel.Task) {
+			if mm := t.MemoryManager(); mm != nil {
+				brk = mm.BrkRange()
+				argv = usermem.AddrRange{Start: mm.ArgvStart(), End: mm.ArgvEnd()}
+				envv = usermem.AddrRange{Start: mm.EnvvStart(), End: mm.EnvvEnd()}
+			}
+		})
+	}
+	fmt.Fprintf(buf, "%d %d %d %d %d ", brk.Start, argv.Start, argv.End, envv.Start, envv.End)
 	fmt.Fprintf(buf, "0\n" /* exit_code */)
 
 	return nil
@@ -430,14 +672,78 @@ func (s *statmData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			rss = mm.ResidentSetPages()
 		}
 	})
 
-	fmt.Fprintf(buf, "%d %d 0 0 0 0 0\n", vss/usermem.PageSize, rss/usermem.PageSize)
+	fmt.Fprintf(buf, "%d %d 0 0 0 0 0\n", vss/usermem.PageSize, rss)
 	return nil
 }
 
+// oomScoreData implements vfs.DynamicBytesSource for /proc/[pid]/oom_score.
+//
+// +stateify savable
+type oomScoreData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*oomScoreData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *oomScoreData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.task.OOMScore())
+	return nil
+}
+
+// oomScoreAdjData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/oom_score_adj.
+//
+// +stateify savable
+type oomScoreAdjData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ vfs.WritableDynamicBytesSource = (*oomScoreAdjData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *oomScoreAdjData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.task.ThreadGroup().OOMScoreAdj())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *oomScoreAdjData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if n != src.NumBytes() {
+		// Like Linux's kstrtoint(), only whitespace may surround the
+		// value.
+		return 0, syserror.EINVAL
+	}
+	if err := d.task.WriteOOMScoreAdj(auth.CredentialsFromContext(ctx), v); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // statusData implements vfs.DynamicBytesSource for /proc/[pid]/status.
 //
 // +stateify savable
@@ -446,15 +752,20 @@ type statusData struct {
 
 	task  *kernel.Task
 	pidns *kernel.PIDNamespace
+
+	// speculationStoreBypass is reported as Speculation_Store_Bypass.
+	speculationStoreBypass string
 }
 
 var _ dynamicInode = (*statusData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (s *statusData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	fmt.Fprintf(buf, "Name:\t%s\n", s.task.Name())
+	fmt.Fprintf(buf, "Name:\t%s\n", statusNameReplacer.Replace(taskComm(s.task)))
 	fmt.Fprintf(buf, "State:\t%s\n", s.task.StateStatus())
 	fmt.Fprintf(buf, "Tgid:\t%d\n", s.pidns.IDOfThreadGroup(s.task.ThreadGroup()))
+	// We don't support NUMA balancing, so the NUMA group ID is always 0.
+	fmt.Fprintf(buf, "Ngid:\t0\n")
 	fmt.Fprintf(buf, "Pid:\t%d\n", s.pidns.IDOfTask(s.task))
 	ppid := kernel.ThreadID(0)
 	if parent := s.task.Parent(); parent != nil {
@@ -466,29 +777,62 @@ func (s *statusData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		tpid = s.pidns.IDOfTask(tracer)
 	}
 	fmt.Fprintf(buf, "TracerPid:\t%d\n", tpid)
+	// Filesystem IDs aren't implemented; they are always the effective IDs.
+	creds := s.task.Credentials()
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	euid := creds.EffectiveKUID.In(userns).OrOverflow()
+	egid := creds.EffectiveKGID.In(userns).OrOverflow()
+	fmt.Fprintf(buf, "Uid:\t%d\t%d\t%d\t%d\n", creds.RealKUID.In(userns).OrOverflow(), euid, creds.SavedKUID.In(userns).OrOverflow(), euid)
+	fmt.Fprintf(buf, "Gid:\t%d\t%d\t%d\t%d\n", creds.RealKGID.In(userns).OrOverflow(), egid, creds.SavedKGID.In(userns).OrOverflow(), egid)
 	var fds int
-	var vss, rss, data uint64
+	var vss, peakVSS, rssPages, data, stack uint64
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if fdTable := t.FDTable(); fdTable != nil {
 			fds = fdTable.Size()
 		}
 		if mm := t.MemoryManager(); mm != nil {
 			vss = mm.VirtualMemorySize()
-			rss = mm.ResidentSetSize()
+			peakVSS = mm.PeakVirtualMemorySize()
+			rssPages = mm.ResidentSetPages()
 			data = mm.VirtualDataSize()
+			stack = mm.VirtualStackSize()
 		}
 	})
 	fmt.Fprintf(buf, "FDSize:\t%d\n", fds)
+	fmt.Fprintf(buf, "VmPeak:\t%d kB\n", peakVSS>>10)
 	fmt.Fprintf(buf, "VmSize:\t%d kB\n", vss>>10)
-	fmt.Fprintf(buf, "VmRSS:\t%d kB\n", rss>>10)
+	fmt.Fprintf(buf, "VmRSS:\t%d kB\n", rssPages*(usermem.PageSize>>10))
 	fmt.Fprintf(buf, "VmData:\t%d kB\n", data>>10)
+	fmt.Fprintf(buf, "VmStk:\t%d kB\n", stack>>10)
+	// Transparent hugepages are not implemented, so they are never enabled.
+	fmt.Fprintf(buf, "THP_enabled:\t0\n")
 	fmt.Fprintf(buf, "Threads:\t%d\n", s.task.ThreadGroup().Count())
-	creds := s.task.Credentials()
+	fmt.Fprintf(buf, "SigQ:\t%d/%d\n", s.task.QueuedSignals(), s.task.ThreadGroup().Limits().Get(limits.SignalsPending).Cur)
+	// Like the other fields, the pending and blocked signals are s.task's
+	// own, even in /proc/[pid]/status, where s.task is the thread group
+	// leader.
+	pending, sharedPending := s.task.PendingSignalSets()
+	fmt.Fprintf(buf, "SigPnd:\t%016x\n", uint64(pending))
+	fmt.Fprintf(buf, "ShdPnd:\t%016x\n", uint64(sharedPending))
+	fmt.Fprintf(buf, "SigBlk:\t%016x\n", uint64(s.task.SignalMask()))
+	ignored, caught := s.task.ThreadGroup().SignalHandlers().IgnoredAndCaught()
+	fmt.Fprintf(buf, "SigIgn:\t%016x\n", uint64(ignored))
+	fmt.Fprintf(buf, "SigCgt:\t%016x\n", uint64(caught))
 	fmt.Fprintf(buf, "CapInh:\t%016x\n", creds.InheritableCaps)
 	fmt.Fprintf(buf, "CapPrm:\t%016x\n", creds.PermittedCaps)
 	fmt.Fprintf(buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
+	// Ambient capabilities are not implemented, so the set is always empty.
+	fmt.Fprintf(buf, "CapAmb:\t%016x\n", 0)
 	fmt.Fprintf(buf, "Seccomp:\t%d\n", s.task.SeccompMode())
+	fmt.Fprintf(buf, "Speculation_Store_Bypass:\t%s\n", s.speculationStoreBypass)
+	// Core scheduling (PR_SCHED_CORE) is not supported, so no task has a
+	// cookie.
+	fmt.Fprintf(buf, "Core_scheduling_cookie:\t0\n")
+	numCPUs := s.task.Kernel().ApplicationCores()
+	cpus := s.task.CPUMask()
+	fmt.Fprintf(buf, "Cpus_allowed:\t%s\n", cpuMaskString(cpus, numCPUs))
+	fmt.Fprintf(buf, "Cpus_allowed_list:\t%s\n", cpuListString(cpus, numCPUs))
 	// We unconditionally report a single NUMA node. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
 	fmt.Fprintf(buf, "Mems_allowed:\t1\n")
@@ -496,6 +840,58 @@ func (s *statusData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// cpuMaskString formats the first numCPUs CPUs of mask like Linux's "%*pb":
+// as hexadecimal digits in comma-separated groups of 32 CPUs, the most
+// significant first.
+func cpuMaskString(mask sched.CPUSet, numCPUs uint) string {
+	chunks := make([]uint32, (numCPUs+31)/32)
+	mask.ForEachCPU(func(cpu uint) {
+		if cpu < numCPUs {
+			chunks[cpu/32] |= 1 << (cpu % 32)
+		}
+	})
+	var parts []string
+	for i := len(chunks) - 1; i >= 0; i-- {
+		digits := 8
+		if i == len(chunks)-1 && numCPUs%32 != 0 {
+			digits = int(numCPUs%32+3) / 4
+		}
+		parts = append(parts, fmt.Sprintf("%0*x", digits, chunks[i]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// cpuListString formats the first numCPUs CPUs of mask like Linux's "%*pbl":
+// as comma-separated ranges, e.g. "0-3,6".
+func cpuListString(mask sched.CPUSet, numCPUs uint) string {
+	var parts []string
+	start, end := -1, -1
+	flush := func() {
+		if start == end {
+			parts = append(parts, strconv.Itoa(start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", start, end))
+		}
+	}
+	mask.ForEachCPU(func(cpu uint) {
+		if cpu >= numCPUs {
+			return
+		}
+		if start != -1 && int(cpu) == end+1 {
+			end = int(cpu)
+			return
+		}
+		if start != -1 {
+			flush()
+		}
+		start, end = int(cpu), int(cpu)
+	})
+	if start != -1 {
+		flush()
+	}
+	return strings.Join(parts, ",")
+}
+
 // ioUsage is the /proc/<pid>/io and /proc/<pid>/task/<tid>/io data provider.
 type ioUsage interface {
 	// IOUsage returns the io usage data.
@@ -525,3 +921,358 @@ func (i *ioData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "cancelled_write_bytes: %d\n", io.BytesWriteCancelled)
 	return nil
 }
+
+// exeSymlink is a "magic link" for /proc/[pid]/exe.
+//
+// +stateify savable
+type exeSymlink struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoopRefCount
+	kernfs.InodeSymlink
+
+	task *kernel.Task
+}
+
+var _ kernfs.Inode = (*exeSymlink)(nil)
+
+func newExeSymlink(task *kernel.Task, ino uint64) *kernfs.Dentry {
+	inode := &exeSymlink{task: task}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.Init(task.Credentials(), ino, linux.ModeSymlink|0777)
+
+	d := &kernfs.Dentry{}
+	d.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return d
+}
+
+// executable returns the executable of s.task, with a reference taken.
+func (s *exeSymlink) executable(ctx context.Context) (vfs.VirtualDentry, error) {
+	if !kernel.ContextCanTrace(ctx, s.task, false) {
+		return vfs.VirtualDentry{}, syserror.EACCES
+	}
+	var (
+		exe vfs.VirtualDentry
+		err error
+	)
+	s.task.WithMuLocked(func(t *kernel.Task) {
+		// Like Linux, tasks without a MemoryManager, such as zombies, have no
+		// executable. The MemoryManager may also be destroyed, in which case
+		// MemoryManager.destroy will simply set the executable to the zero
+		// value (with locks held).
+		if mm := t.MemoryManager(); mm != nil {
+			exe = mm.ExecutableVFS2()
+		}
+		if !exe.Ok() {
+			err = syserror.ENOENT
+		}
+	})
+	return exe, err
+}
+
+// Readlink implements kernfs.Inode.
+func (s *exeSymlink) Readlink(ctx context.Context) (string, error) {
+	exe, err := s.executable(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer exe.DecRef()
+	return linkPathname(ctx, exe)
+}
+
+// Getlink implements kernfs.Inode.Getlink. The executable can be opened even
+// if its pathname isn't reachable from the reader's root.
+func (s *exeSymlink) Getlink(ctx context.Context) (vfs.VirtualDentry, string, error) {
+	exe, err := s.executable(ctx)
+	return exe, "", err
+}
+
+// fsContextSymlink is a "magic link" for /proc/[pid]/cwd and /proc/[pid]/root.
+//
+// +stateify savable
+type fsContextSymlink struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoopRefCount
+	kernfs.InodeSymlink
+
+	task *kernel.Task
+
+	// root is true for /proc/[pid]/root and false for /proc/[pid]/cwd.
+	root bool
+}
+
+var _ kernfs.Inode = (*fsContextSymlink)(nil)
+
+func newFSContextSymlink(task *kernel.Task, ino uint64, root bool) *kernfs.Dentry {
+	inode := &fsContextSymlink{task: task, root: root}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.Init(task.Credentials(), ino, linux.ModeSymlink|0777)
+
+	d := &kernfs.Dentry{}
+	d.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return d
+}
+
+// dir returns the directory that s refers to, with a reference taken.
+func (s *fsContextSymlink) dir(ctx context.Context) (vfs.VirtualDentry, error) {
+	if !kernel.ContextCanTrace(ctx, s.task, false) {
+		return vfs.VirtualDentry{}, syserror.EACCES
+	}
+	var dir vfs.VirtualDentry
+	s.task.WithMuLocked(func(t *kernel.Task) {
+		fsc := t.FSContext()
+		if fsc == nil {
+			return
+		}
+		if s.root {
+			dir = fsc.RootDirectoryVFS2()
+		} else {
+			dir = fsc.WorkingDirectoryVFS2()
+		}
+	})
+	if !dir.Ok() {
+		// The task has exited.
+		return vfs.VirtualDentry{}, syserror.ENOENT
+	}
+	return dir, nil
+}
+
+// Readlink implements kernfs.Inode.
+func (s *fsContextSymlink) Readlink(ctx context.Context) (string, error) {
+	dir, err := s.dir(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer dir.DecRef()
+	return linkPathname(ctx, dir)
+}
+
+// Getlink implements kernfs.Inode.Getlink. Like Linux, the directory can be
+// opened even if it has been deleted or its pathname isn't reachable from the
+// reader's root.
+func (s *fsContextSymlink) Getlink(ctx context.Context) (vfs.VirtualDentry, string, error) {
+	dir, err := s.dir(ctx)
+	return dir, "", err
+}
+
+// linkPathname returns the pathname of vd, as read through a magic link by a
+// reader in ctx.
+func linkPathname(ctx context.Context, vd vfs.VirtualDentry) (string, error) {
+	root := vfs.RootFromContext(ctx)
+	if root.Ok() {
+		defer root.DecRef()
+	}
+	vfsObj := vd.Mount().Filesystem().VirtualFilesystem()
+	return vfsObj.PathnameWithDeleted(ctx, root, vd)
+}
+
+// mountsData implements vfs.DynamicBytesSource for /proc/[pid]/mounts.
+//
+// +stateify savable
+type mountsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*mountsData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (i *mountsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	var root vfs.VirtualDentry
+	i.task.WithMuLocked(func(t *kernel.Task) {
+		if fsc := t.FSContext(); fsc != nil {
+			root = fsc.RootDirectoryVFS2()
+		}
+	})
+	if !root.Ok() {
+		// The task has exited, so it has no mounts to show.
+		return nil
+	}
+	defer root.DecRef()
+	// Mount paths are shown relative to the task's root.
+	root.Mount().Filesystem().VirtualFilesystem().GenerateProcMounts(ctx, root, buf)
+	return nil
+}
+
+// mountInfoData implements vfs.DynamicBytesSource for /proc/[pid]/mountinfo.
+//
+// +stateify savable
+type mountInfoData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*mountInfoData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (i *mountInfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	var root vfs.VirtualDentry
+	i.task.WithMuLocked(func(t *kernel.Task) {
+		if fsc := t.FSContext(); fsc != nil {
+			root = fsc.RootDirectoryVFS2()
+		}
+	})
+	if !root.Ok() {
+		// The task has exited, so it has no mounts to show.
+		return nil
+	}
+	defer root.DecRef()
+	root.Mount().Filesystem().VirtualFilesystem().GenerateProcMountInfo(ctx, root, buf)
+	return nil
+}
+
+// memInode implements kernfs.Inode for /proc/[pid]/mem.
+//
+// +stateify savable
+type memInode struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotDirectory
+	kernfs.InodeNotSymlink
+
+	task *kernel.Task
+}
+
+var _ kernfs.Inode = (*memInode)(nil)
+
+func newMemInode(task *kernel.Task, ino uint64, perm linux.FileMode) *kernfs.Dentry {
+	inode := &memInode{task: task}
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.InodeAttrs.Init(task.Credentials(), ino, linux.ModeRegular|perm)
+
+	d := &kernfs.Dentry{}
+	d.Init(&taskOwnedInode{Inode: inode, owner: task})
+	return d
+}
+
+// Open implements kernfs.Inode.Open. Like Linux's fs/proc/base.c:mem_open(),
+// it checks that the caller can attach to the task, and takes the task's
+// address space at the time of the open.
+func (i *memInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	mem, err := kernel.NewCrossTaskMemory(ctx, i.task, usermem.IOOpts{IgnorePermissions: true})
+	if err != nil && err != syserror.ESRCH {
+		return nil, err
+	}
+	// If the task has no address space, mem is nil and reads and writes
+	// transfer no bytes.
+	fd := &memFD{inode: i, mem: mem}
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), vfsd, &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// SetStat implements kernfs.Inode.SetStat.
+func (i *memInode) SetStat(*vfs.Filesystem, vfs.SetStatOptions) error {
+	return syserror.EPERM
+}
+
+// memFD implements vfs.FileDescriptionImpl for /proc/[pid]/mem. Its offset is
+// the address in the task's address space.
+//
+// +stateify savable
+type memFD struct {
+	vfs.FileDescriptionDefaultImpl
+
+	vfsfd vfs.FileDescription
+	inode *memInode
+
+	// mem is the task's address space at the time of the open. It is nil if
+	// the task had none. It is immutable.
+	mem *kernel.CrossTaskMemory
+
+	// offMu protects off.
+	offMu sync.Mutex
+	off   int64
+}
+
+var _ vfs.FileDescriptionImpl = (*memFD)(nil)
+
+// Seek implements vfs.FileDescriptionImpl.Seek. As in Linux, only SEEK_SET and
+// SEEK_CUR are supported.
+func (fd *memFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.offMu.Lock()
+	defer fd.offMu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+	case linux.SEEK_CUR:
+		offset += fd.off
+	default:
+		return 0, syserror.EINVAL
+	}
+	if offset < 0 {
+		return 0, syserror.EINVAL
+	}
+	fd.off = offset
+	return offset, nil
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *memFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, syserror.EINVAL
+	}
+	if fd.mem == nil {
+		return 0, nil
+	}
+	n, err := fd.mem.ReadAt(ctx, dst, usermem.Addr(offset))
+	return memRWResult(n, err)
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *memFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.off, opts)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *memFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if offset < 0 {
+		return 0, syserror.EINVAL
+	}
+	if fd.mem == nil {
+		return 0, nil
+	}
+	n, err := fd.mem.WriteAt(ctx, src, usermem.Addr(offset))
+	return memRWResult(n, err)
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *memFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.PWrite(ctx, src, fd.off, opts)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// memRWResult returns the result of a read or write of /proc/[pid]/mem that
+// transferred n bytes before failing with err. As in Linux's
+// fs/proc/base.c:mem_rw(), partial transfers succeed, transfers of no bytes
+// fail with EIO, and transfers after the address space was released transfer
+// no bytes.
+func memRWResult(n int64, err error) (int64, error) {
+	if err == nil || n > 0 || err == io.EOF {
+		return n, nil
+	}
+	return 0, syserror.EIO
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *memFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	owned := taskOwnedInode{Inode: fd.inode, owner: fd.inode.task}
+	return owned.Stat(fs), nil
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *memFD) SetStat(context.Context, vfs.SetStatOptions) error {
+	return syserror.EPERM
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *memFD) Release() {}
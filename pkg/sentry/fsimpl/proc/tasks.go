@@ -16,7 +16,7 @@ package proc
 
 import (
 	"bytes"
-	"sort"
+	"fmt"
 	"strconv"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -33,6 +33,34 @@ const (
 	threadSelfName = "thread-self"
 )
 
+// Directory offsets in /proc are laid out as in Linux
+// (fs/proc/root.c:proc_root_readdir()):
+//
+//	0                             "."
+//	1                             ".."
+//	[2, 2+n)                      the n static files, in name order
+//	[2+n, FIRST_PROCESS_ENTRY)    unused, resumes at FIRST_PROCESS_ENTRY
+//	FIRST_PROCESS_ENTRY           "self"
+//	FIRST_PROCESS_ENTRY+1         "thread-self"
+//	pidOffset+tgid                "[tgid]"
+//	pidOffset+maxTaskID           end of directory
+//
+// pidOffset is FIRST_PROCESS_ENTRY+2, or FIRST_PROCESS_ENTRY if the self links
+// are hidden. The offset reported after an entry is its own offset plus one, so
+// resuming from it continues with the following entry, even if tasks were
+// created or exited in between.
+const (
+	// fs/proc/internal.h: #define FIRST_PROCESS_ENTRY 256
+	FIRST_PROCESS_ENTRY = 256
+
+	// maxTaskID is greater than any TGID.
+	maxTaskID = kernel.TasksLimit + 1
+
+	// tgidBatchSize is the number of TGIDs that tasksInode.IterDirents reads
+	// from the PID namespace at a time.
+	tgidBatchSize = 64
+)
+
 // InoGenerator generates unique inode numbers for a given filesystem.
 type InoGenerator interface {
 	NextIno() uint64
@@ -51,7 +79,8 @@ type tasksInode struct {
 	pidns  *kernel.PIDNamespace
 
 	// '/proc/self' and '/proc/thread-self' have custom directory offsets in
-	// Linux. So handle them outside of OrderedChildren.
+	// Linux. So handle them outside of OrderedChildren. Both are nil if the
+	// links are hidden, see InternalData.HideSelfLinks.
 	selfSymlink       *vfs.Dentry
 	threadSelfSymlink *vfs.Dentry
 
@@ -59,37 +88,61 @@ type tasksInode struct {
 	// cgroup hierarchy. These controllers are immutable and will be listed
 	// in /proc/pid/cgroup if not nil.
 	cgroupControllers map[string]string
+
+	// speculationStoreBypass is the Speculation_Store_Bypass state reported
+	// in /proc/[pid]/status.
+	speculationStoreBypass string
+
+	// missingFiles records lookups of missing files in /proc and
+	// /proc/[pid]. It may be nil.
+	missingFiles *MissingFiles
 }
 
 var _ kernfs.Inode = (*tasksInode)(nil)
 
-func newTasksInode(inoGen InoGenerator, k *kernel.Kernel, pidns *kernel.PIDNamespace, cgroupControllers map[string]string) (*tasksInode, *kernfs.Dentry) {
+func newTasksInode(inoGen InoGenerator, vfsObj *vfs.VirtualFilesystem, k *kernel.Kernel, pidns *kernel.PIDNamespace, cgroupControllers map[string]string, hideSelfLinks bool, speculationStoreBypass string, missingFiles *MissingFiles) (*tasksInode, *kernfs.Dentry) {
 	root := auth.NewRootCredentials(pidns.UserNamespace())
 	contents := map[string]*kernfs.Dentry{
 		"cpuinfo": newDentry(root, inoGen.NextIno(), 0444, newStaticFile(cpuInfoData(k))),
+		"devices": newDentry(root, inoGen.NextIno(), 0444, &devicesData{vfsObj: vfsObj}),
 		//"filesystems": newDentry(root, inoGen.NextIno(), 0444, &filesystemsData{}),
-		"loadavg": newDentry(root, inoGen.NextIno(), 0444, &loadavgData{}),
-		"sys":     newSysDir(root, inoGen, k),
-		"meminfo": newDentry(root, inoGen.NextIno(), 0444, &meminfoData{}),
-		"mounts":  kernfs.NewStaticSymlink(root, inoGen.NextIno(), "self/mounts"),
-		"net":     newNetDir(root, inoGen, k),
-		"stat":    newDentry(root, inoGen.NextIno(), 0444, &statData{}),
-		"uptime":  newDentry(root, inoGen.NextIno(), 0444, &uptimeData{}),
-		"version": newDentry(root, inoGen.NextIno(), 0444, &versionData{}),
+		"key-users": newDentry(root, inoGen.NextIno(), 0444, &keyUsersData{k: k}),
+		"keys":      newDentry(root, inoGen.NextIno(), 0444, &keysData{k: k}),
+		"loadavg":   newDentry(root, inoGen.NextIno(), 0444, &loadavgData{}),
+		"sys":       newSysDir(root, inoGen, k),
+		"meminfo":   newDentry(root, inoGen.NextIno(), 0444, &meminfoData{}),
+		"misc":      newDentry(root, inoGen.NextIno(), 0444, &miscData{vfsObj: vfsObj}),
+		"mounts":    kernfs.NewStaticSymlink(root, inoGen.NextIno(), "self/mounts"),
+		"net":       newNetDir(root, inoGen, k),
+		"stat":      newDentry(root, inoGen.NextIno(), 0444, &statData{}),
+		// Like in Linux, only root may read the pending timers of every
+		// task.
+		"timer_list": newDentry(root, inoGen.NextIno(), 0400, &timerListData{k: k, pidns: pidns}),
+		"tty":        newTTYDir(root, inoGen, vfsObj),
+		"uptime":     newDentry(root, inoGen.NextIno(), 0444, &uptimeData{}),
+		"version":    newDentry(root, inoGen.NextIno(), 0444, &versionData{k: k}),
 	}
 
 	inode := &tasksInode{
-		pidns:             pidns,
-		inoGen:            inoGen,
-		selfSymlink:       newSelfSymlink(root, inoGen.NextIno(), 0444, pidns).VFSDentry(),
-		threadSelfSymlink: newThreadSelfSymlink(root, inoGen.NextIno(), 0444, pidns).VFSDentry(),
-		cgroupControllers: cgroupControllers,
+		pidns:                  pidns,
+		inoGen:                 inoGen,
+		cgroupControllers:      cgroupControllers,
+		speculationStoreBypass: speculationStoreBypass,
+		missingFiles:           missingFiles,
+	}
+	if !hideSelfLinks {
+		inode.selfSymlink = newSelfSymlink(root, inoGen.NextIno(), 0444, pidns).VFSDentry()
+		inode.threadSelfSymlink = newThreadSelfSymlink(root, inoGen.NextIno(), 0444, pidns).VFSDentry()
 	}
 	inode.InodeAttrs.Init(root, inoGen.NextIno(), linux.ModeDirectory|0555)
 
 	dentry := &kernfs.Dentry{}
 	dentry.Init(inode)
 
+	// Static files must not overlap with task entries.
+	if 2+len(contents) > FIRST_PROCESS_ENTRY {
+		panic(fmt.Sprintf("too many static files in /proc: %d", len(contents)))
+	}
 	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
 	links := inode.OrderedChildren.Populate(dentry, contents)
 	inode.IncLinks(links)
@@ -103,12 +156,19 @@ func (i *tasksInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, erro
 	tid, err := strconv.ParseUint(name, 10, 64)
 	if err != nil {
 		// If it failed to parse, check if it's one of the special handled files.
-		switch name {
-		case selfName:
+		// The symlinks are owned by i, so the caller's reference is in
+		// addition to i's. They are nil if they are hidden.
+		switch {
+		case name == selfName && i.selfSymlink != nil:
+			i.selfSymlink.IncRef()
 			return i.selfSymlink, nil
-		case threadSelfName:
+		case name == threadSelfName && i.threadSelfSymlink != nil:
+			i.threadSelfSymlink.IncRef()
 			return i.threadSelfSymlink, nil
 		}
+		// Tasks that don't exist aren't recorded, since they have usually
+		// just exited.
+		i.missingFiles.record(ctx, name)
 		return nil, syserror.ENOENT
 	}
 
@@ -117,7 +177,7 @@ func (i *tasksInode) Lookup(ctx context.Context, name string) (*vfs.Dentry, erro
 		return nil, syserror.ENOENT
 	}
 
-	taskDentry := newTaskInode(i.inoGen, task, i.pidns, true, i.cgroupControllers)
+	taskDentry := newTaskInode(i.inoGen, task, i.pidns, true, i.cgroupControllers, i.speculationStoreBypass, i.missingFiles)
 	return taskDentry.VFSDentry(), nil
 }
 
@@ -128,84 +188,84 @@ func (i *tasksInode) Valid(ctx context.Context) bool {
 
 // IterDirents implements kernfs.inodeDynamicLookup.
 func (i *tasksInode) IterDirents(ctx context.Context, cb vfs.IterDirentsCallback, offset, _ int64) (int64, error) {
-	// fs/proc/internal.h: #define FIRST_PROCESS_ENTRY 256
-	const FIRST_PROCESS_ENTRY = 256
+	// If the symlinks are hidden, '/proc/[pid]' starts at FIRST_PROCESS_ENTRY.
+	pidOffset := int64(FIRST_PROCESS_ENTRY)
+	if i.selfSymlink != nil {
+		pidOffset += 2
+	}
 
 	// Use maxTaskID to shortcut searches that will result in 0 entries.
-	const maxTaskID = kernel.TasksLimit + 1
-	if offset >= maxTaskID {
+	if offset >= pidOffset+maxTaskID {
 		return offset, nil
 	}
 
 	// According to Linux (fs/proc/base.c:proc_pid_readdir()), process directories
 	// start at offset FIRST_PROCESS_ENTRY with '/proc/self', followed by
-	// '/proc/thread-self' and then '/proc/[pid]'.
+	// '/proc/thread-self' and then '/proc/[pid]'. Offsets past the static files
+	// but before FIRST_PROCESS_ENTRY resume at FIRST_PROCESS_ENTRY.
 	if offset < FIRST_PROCESS_ENTRY {
 		offset = FIRST_PROCESS_ENTRY
 	}
 
-	if offset == FIRST_PROCESS_ENTRY {
-		dirent := vfs.Dirent{
-			Name:    selfName,
-			Type:    linux.DT_LNK,
-			Ino:     i.inoGen.NextIno(),
-			NextOff: offset + 1,
-		}
-		if !cb.Handle(dirent) {
-			return offset, nil
-		}
-		offset++
-	}
-	if offset == FIRST_PROCESS_ENTRY+1 {
-		dirent := vfs.Dirent{
-			Name:    threadSelfName,
-			Type:    linux.DT_LNK,
-			Ino:     i.inoGen.NextIno(),
-			NextOff: offset + 1,
+	if i.selfSymlink != nil {
+		if offset == FIRST_PROCESS_ENTRY {
+			dirent := vfs.Dirent{
+				Name:    selfName,
+				Type:    linux.DT_LNK,
+				Ino:     i.inoGen.NextIno(),
+				NextOff: offset + 1,
+			}
+			if !cb.Handle(dirent) {
+				return offset, nil
+			}
+			offset++
 		}
-		if !cb.Handle(dirent) {
-			return offset, nil
+		if offset == FIRST_PROCESS_ENTRY+1 {
+			dirent := vfs.Dirent{
+				Name:    threadSelfName,
+				Type:    linux.DT_LNK,
+				Ino:     i.inoGen.NextIno(),
+				NextOff: offset + 1,
+			}
+			if !cb.Handle(dirent) {
+				return offset, nil
+			}
+			offset++
 		}
-		offset++
 	}
 
-	// Collect all tasks that TGIDs are greater than the offset specified. Per
-	// Linux we only include in directory listings if it's the leader. But for
-	// whatever crazy reason, you can still walk to the given node.
-	var tids []int
-	startTid := offset - FIRST_PROCESS_ENTRY - 2
-	for _, tg := range i.pidns.ThreadGroups() {
-		tid := i.pidns.IDOfThreadGroup(tg)
-		if int64(tid) < startTid {
-			continue
+	// Per Linux we only include thread groups in directory listings, by the
+	// TGID of their leader. But for whatever crazy reason, you can still walk
+	// to any task. TGIDs are fetched in increasing order in batches, without
+	// holding the TaskSet lock while the callback runs, and each batch
+	// resumes right after the previous one, so tasks created or reaped in
+	// between are neither repeated nor skipped.
+	var tids [tgidBatchSize]kernel.ThreadID
+	start := kernel.ThreadID(offset - pidOffset)
+	for {
+		batch := i.pidns.ThreadGroupIDsFrom(tids[:0], start, tgidBatchSize)
+		for _, tid := range batch {
+			dirent := vfs.Dirent{
+				Name:    strconv.FormatUint(uint64(tid), 10),
+				Type:    linux.DT_DIR,
+				Ino:     i.inoGen.NextIno(),
+				NextOff: pidOffset + int64(tid) + 1,
+			}
+			if !cb.Handle(dirent) {
+				// Resume at this task, rather than counting the entries
+				// handled so far, which would repeat or skip tasks.
+				return pidOffset + int64(tid), nil
+			}
 		}
-		if leader := tg.Leader(); leader != nil {
-			tids = append(tids, int(tid))
+		if len(batch) < tgidBatchSize {
+			return pidOffset + maxTaskID, nil
 		}
+		start = batch[len(batch)-1] + 1
 	}
-
-	if len(tids) == 0 {
-		return offset, nil
-	}
-
-	sort.Ints(tids)
-	for _, tid := range tids {
-		dirent := vfs.Dirent{
-			Name:    strconv.FormatUint(uint64(tid), 10),
-			Type:    linux.DT_DIR,
-			Ino:     i.inoGen.NextIno(),
-			NextOff: FIRST_PROCESS_ENTRY + 2 + int64(tid) + 1,
-		}
-		if !cb.Handle(dirent) {
-			return offset, nil
-		}
-		offset++
-	}
-	return maxTaskID, nil
 }
 
 // Open implements kernfs.Inode.
-func (i *tasksInode) Open(rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+func (i *tasksInode) Open(ctx context.Context, rp *vfs.ResolvingPath, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
 	fd := &kernfs.GenericDirectoryFD{}
 	fd.Init(rp.Mount(), vfsd, &i.OrderedChildren, &opts)
 	return fd.VFSFileDescription(), nil
@@ -215,11 +275,7 @@ func (i *tasksInode) Stat(vsfs *vfs.Filesystem) linux.Statx {
 	stat := i.InodeAttrs.Stat(vsfs)
 
 	// Add dynamic children to link count.
-	for _, tg := range i.pidns.ThreadGroups() {
-		if leader := tg.Leader(); leader != nil {
-			stat.Nlink++
-		}
-	}
+	stat.Nlink += uint32(i.pidns.NumThreadGroups())
 
 	return stat
 }
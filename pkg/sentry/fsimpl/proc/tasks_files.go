@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -62,6 +63,12 @@ func (s *selfSymlink) Readlink(ctx context.Context) (string, error) {
 	return strconv.FormatUint(uint64(tgid), 10), nil
 }
 
+// Getlink implements kernfs.Inode.Getlink.
+func (s *selfSymlink) Getlink(ctx context.Context) (vfs.VirtualDentry, string, error) {
+	target, err := s.Readlink(ctx)
+	return vfs.VirtualDentry{}, target, err
+}
+
 type threadSelfSymlink struct {
 	kernfs.InodeAttrs
 	kernfs.InodeNoopRefCount
@@ -95,6 +102,12 @@ func (s *threadSelfSymlink) Readlink(ctx context.Context) (string, error) {
 	return fmt.Sprintf("%d/task/%d", tgid, tid), nil
 }
 
+// Getlink implements kernfs.Inode.Getlink.
+func (s *threadSelfSymlink) Getlink(ctx context.Context) (vfs.VirtualDentry, string, error) {
+	target, err := s.Readlink(ctx)
+	return vfs.VirtualDentry{}, target, err
+}
+
 // cpuStats contains the breakdown of CPU time for /proc/stat.
 type cpuStats struct {
 	// user is time spent in userspace tasks with non-positive niceness.
@@ -335,3 +348,271 @@ func (v *versionData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "%s version %s %s\n", ver.Sysname, ver.Release, ver.Version)
 	return nil
 }
+
+// devicesData implements vfs.DynamicBytesSource for /proc/devices.
+type devicesData struct {
+	kernfs.DynamicBytesFile
+
+	// vfsObj holds the device registry.
+	vfsObj *vfs.VirtualFilesystem
+}
+
+var _ dynamicInode = (*devicesData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *devicesData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	regs := d.vfsObj.DeviceRegistrations()
+	for _, kind := range []vfs.DeviceKind{vfs.CharDevice, vfs.BlockDevice} {
+		if kind == vfs.CharDevice {
+			fmt.Fprintf(buf, "Character devices:\n")
+		} else {
+			fmt.Fprintf(buf, "\nBlock devices:\n")
+		}
+		// As in Linux, each group of devices is listed once per major device
+		// number.
+		type group struct {
+			major uint32
+			name  string
+		}
+		seen := make(map[group]struct{})
+		for _, reg := range regs {
+			g := group{reg.Major, reg.Opts.GroupName}
+			if reg.Kind != kind || g.name == "" {
+				continue
+			}
+			if _, ok := seen[g]; ok {
+				continue
+			}
+			seen[g] = struct{}{}
+			fmt.Fprintf(buf, "%3d %s\n", g.major, g.name)
+		}
+	}
+	return nil
+}
+
+// miscData implements vfs.DynamicBytesSource for /proc/misc.
+type miscData struct {
+	kernfs.DynamicBytesFile
+
+	// vfsObj holds the device registry.
+	vfsObj *vfs.VirtualFilesystem
+}
+
+var _ dynamicInode = (*miscData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *miscData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	for _, reg := range d.vfsObj.DeviceRegistrations() {
+		if reg.Kind != vfs.CharDevice || reg.Major != linux.MISC_MAJOR || reg.Opts.Name == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "%3d %s\n", reg.Minor, reg.Opts.Name)
+	}
+	return nil
+}
+
+// newTTYDir returns the /proc/tty directory.
+func newTTYDir(root *auth.Credentials, inoGen InoGenerator, vfsObj *vfs.VirtualFilesystem) *kernfs.Dentry {
+	return kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+		"drivers": newDentry(root, inoGen.NextIno(), 0444, &ttyDriversData{vfsObj: vfsObj}),
+	})
+}
+
+// ttyDriversData implements vfs.DynamicBytesSource for /proc/tty/drivers.
+type ttyDriversData struct {
+	kernfs.DynamicBytesFile
+
+	// vfsObj holds the device registry.
+	vfsObj *vfs.VirtualFilesystem
+}
+
+var _ dynamicInode = (*ttyDriversData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ttyDriversData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Each driver is listed with the range of minor device numbers of its
+	// devices with each major device number, as in Linux's
+	// fs/proc/proc_tty.c:show_tty_range().
+	type driverRange struct {
+		driver      *vfs.TTYDriver
+		major       uint32
+		first, last uint32
+	}
+	var ranges []driverRange
+	for _, reg := range d.vfsObj.DeviceRegistrations() {
+		if reg.Kind != vfs.CharDevice || reg.Opts.TTYDriver == nil {
+			continue
+		}
+		// Registrations are sorted by device numbers, so a driver's devices
+		// with the same major device number are adjacent.
+		if n := len(ranges); n > 0 {
+			if r := &ranges[n-1]; r.driver == reg.Opts.TTYDriver && r.major == reg.Major && r.last+1 == reg.Minor {
+				r.last = reg.Minor
+				continue
+			}
+		}
+		ranges = append(ranges, driverRange{
+			driver: reg.Opts.TTYDriver,
+			major:  reg.Major,
+			first:  reg.Minor,
+			last:   reg.Minor,
+		})
+	}
+	for _, r := range ranges {
+		fmt.Fprintf(buf, "%-20s /dev/%-8s ", r.driver.Name, r.driver.DevName)
+		if r.first != r.last {
+			fmt.Fprintf(buf, "%3d %d-%d ", r.major, r.first, r.last)
+		} else {
+			fmt.Fprintf(buf, "%3d %7d ", r.major, r.first)
+		}
+		fmt.Fprintf(buf, "%s\n", r.driver.Type)
+	}
+	return nil
+}
+
+// keysData implements vfs.DynamicBytesSource for /proc/keys.
+//
+// +stateify savable
+type keysData struct {
+	kernfs.DynamicBytesFile
+
+	// k is the owning Kernel.
+	k *kernel.Kernel
+}
+
+var _ dynamicInode = (*keysData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *keysData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	creds := auth.CredentialsFromContext(ctx)
+	for _, key := range d.k.Keys().ViewableKeys(creds) {
+		writeKey(buf, key, creds.UserNamespace)
+	}
+	return nil
+}
+
+// writeKey writes key to buf in the format of /proc/keys. See Linux's
+// security/keys/proc.c:proc_keys_show.
+func writeKey(buf *bytes.Buffer, key *kernel.Key, userns *auth.UserNamespace) {
+	// All keys are instantiated keyrings charged to their owner's quota,
+	// which never expire and are only referenced by the registry.
+	fmt.Fprintf(buf, "%08x %s %5d %4s %08x %5d %5d %-9.9s %s: empty\n",
+		key.ID,
+		"I--Q---",
+		1,
+		"perm",
+		key.Perm,
+		key.UID.In(userns).OrOverflow(),
+		key.GID.In(userns).OrOverflow(),
+		key.Type,
+		key.Description)
+}
+
+// keyUsersData implements vfs.DynamicBytesSource for /proc/key-users.
+//
+// +stateify savable
+type keyUsersData struct {
+	kernfs.DynamicBytesFile
+
+	// k is the owning Kernel.
+	k *kernel.Kernel
+}
+
+var _ dynamicInode = (*keyUsersData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *keyUsersData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	for _, user := range d.k.Keys().Users() {
+		writeKeyUser(buf, user, userns)
+	}
+	return nil
+}
+
+// writeKeyUser writes user to buf in the format of /proc/key-users, unless
+// user isn't mapped in userns. See Linux's
+// security/keys/proc.c:proc_key_users_show.
+func writeKeyUser(buf *bytes.Buffer, user kernel.KeyUser, userns *auth.UserNamespace) {
+	uid := user.UID.In(userns)
+	if !uid.Ok() {
+		return
+	}
+	maxKeys, maxBytes := linux.KEY_QUOTA_MAXKEYS, linux.KEY_QUOTA_MAXBYTES
+	if user.UID == auth.RootKUID {
+		maxKeys, maxBytes = linux.KEY_QUOTA_ROOT_MAXKEYS, linux.KEY_QUOTA_ROOT_MAXBYTES
+	}
+	// Columns: uid, usage, instantiated/total keys, keys/bytes against the
+	// quota. The user is referenced by each of its keys.
+	fmt.Fprintf(buf, "%5d: %5d %d/%d %d/%d %d/%d\n",
+		uid.OrOverflow(),
+		user.Keys,
+		user.Keys, user.Keys,
+		user.Keys, maxKeys,
+		user.Bytes, maxBytes)
+}
+
+// timerListData implements vfs.DynamicBytesSource for /proc/timer_list.
+//
+// +stateify savable
+type timerListData struct {
+	kernfs.DynamicBytesFile
+
+	// k is the owning Kernel.
+	k *kernel.Kernel
+
+	// pidns is the PID namespace of the owning procfs mount.
+	pidns *kernel.PIDNamespace
+}
+
+var _ dynamicInode = (*timerListData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *timerListData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// The format follows Linux's kernel/time/timer_list.c. Timers are listed
+	// on a single CPU, in one clock base per clock that drives them, with
+	// the site that started them and their owner as when Linux had
+	// CONFIG_TIMER_STATS. Timers of tasks outside of the PID namespace
+	// aren't listed, and timers driven by CPU clocks, which aren't hrtimers
+	// in Linux, are omitted.
+	bases := []struct {
+		clock   time.Clock
+		getTime string
+	}{
+		{d.k.MonotonicClock(), "ktime_get"},
+		{d.k.RealtimeClock(), "ktime_get_real"},
+	}
+	timers := d.k.PendingTimers()
+
+	fmt.Fprintf(buf, "Timer List Version: v0.8\n")
+	fmt.Fprintf(buf, "HRTIMER_MAX_CLOCK_BASES: %d\n", len(bases))
+	fmt.Fprintf(buf, "now at %d nsecs\n", d.k.MonotonicClock().Now().Nanoseconds())
+	fmt.Fprintf(buf, "\ncpu: 0\n")
+	for i, base := range bases {
+		now := base.clock.Now()
+		fmt.Fprintf(buf, " clock %d:\n", i)
+		fmt.Fprintf(buf, "  .index:      %d\n", i)
+		fmt.Fprintf(buf, "  .resolution: 1 nsecs\n")
+		fmt.Fprintf(buf, "  .get_time:   %s\n", base.getTime)
+		fmt.Fprintf(buf, "active timers:\n")
+		n := 0
+		for _, timer := range timers {
+			if timer.Clock != base.clock {
+				continue
+			}
+			tid := d.pidns.IDOfTask(timer.Task)
+			if tid == 0 {
+				continue
+			}
+			site := timer.Site
+			if site == "" {
+				site = "0"
+			}
+			expires := timer.Expires.Nanoseconds()
+			in := timer.Expires.Sub(now).Nanoseconds()
+			fmt.Fprintf(buf, " #%d: <0000000000000000>, %s, S:01, %s, %s/%d\n", n, timer.Function, site, taskComm(timer.Task), tid)
+			fmt.Fprintf(buf, " # expires at %d-%d nsecs [in %d to %d nsecs]\n", expires, expires, in, in)
+			n++
+		}
+	}
+	return nil
+}
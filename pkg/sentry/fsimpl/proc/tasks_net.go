@@ -18,7 +18,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"reflect"
+	"sort"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -47,12 +49,16 @@ func newNetDir(root *auth.Credentials, inoGen InoGenerator, k *kernel.Kernel) *k
 			protocols = "protocol  size sockets  memory press maxhdr  slab module     cl co di ac io in de sh ss gs se re sp bi br ha uh gp em\n"
 			ptype     = "Type Device      Function\n"
 			upd6      = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+			// Netstack doesn't support VLAN subinterfaces, so vlan/config
+			// only contains its header.
+			vlanConfig = "VLAN Dev name	 | VLAN ID\nName-Type: VLAN_NAME_TYPE_RAW_PLUS_VID_NO_PAD\n"
 		)
 		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond))
 
 		contents = map[string]*kernfs.Dentry{
-			"dev":  newDentry(root, inoGen.NextIno(), 0444, &netDevData{stack: stack}),
-			"snmp": newDentry(root, inoGen.NextIno(), 0444, &netSnmpData{stack: stack}),
+			"dev":       newDentry(root, inoGen.NextIno(), 0444, &netDevData{stack: stack}),
+			"dev_mcast": newDentry(root, inoGen.NextIno(), 0444, &netDevMcastData{stack: stack}),
+			"snmp":      newDentry(root, inoGen.NextIno(), 0444, &netSnmpData{stack: stack}),
 
 			// The following files are simple stubs until they are implemented in
 			// netstack, if the file contains a header the stub is just the header
@@ -71,11 +77,19 @@ func newNetDir(root *auth.Credentials, inoGen InoGenerator, k *kernel.Kernel) *k
 			"tcp":    newDentry(root, inoGen.NextIno(), 0444, &netTCPData{kernel: k}),
 			"udp":    newDentry(root, inoGen.NextIno(), 0444, &netUDPData{kernel: k}),
 			"unix":   newDentry(root, inoGen.NextIno(), 0444, &netUnixData{kernel: k}),
+			"vlan": kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+				"config": newDentry(root, inoGen.NextIno(), 0444, newStaticFile(vlanConfig)),
+			}),
+		}
+
+		if _, err := stack.ConnTrackEntries(); err == nil {
+			contents["nf_conntrack"] = newDentry(root, inoGen.NextIno(), 0440, &netConnTrackData{stack: stack})
 		}
 
 		if stack.SupportsIPv6() {
 			contents["if_inet6"] = newDentry(root, inoGen.NextIno(), 0444, &ifinet6{stack: stack})
 			contents["ipv6_route"] = newDentry(root, inoGen.NextIno(), 0444, newStaticFile(""))
+			contents["snmp6"] = newDentry(root, inoGen.NextIno(), 0444, &netSnmp6Data{stack: stack})
 			contents["tcp6"] = newDentry(root, inoGen.NextIno(), 0444, &netTCP6Data{kernel: k})
 			contents["udp6"] = newDentry(root, inoGen.NextIno(), 0444, newStaticFile(upd6))
 		}
@@ -185,6 +199,38 @@ func (n *netDevData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netDevMcastData implements vfs.DynamicBytesSource for /proc/net/dev_mcast.
+//
+// +stateify savable
+type netDevMcastData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netDevMcastData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate. See Linux's
+// net/core/net-procfs.c:dev_mc_seq_show.
+func (n *netDevMcastData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	interfaces := n.stack.Interfaces()
+	ids := make([]int32, 0, len(interfaces))
+	for id := range interfaces {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		i := interfaces[id]
+		for _, a := range i.MulticastAddrs {
+			// Netstack has no global multicast addresses, so the global
+			// users column is always 0.
+			fmt.Fprintf(buf, "%-4d %-15s %-5d %-5d %x\n", id, i.Name, a.Users, 0, a.Addr)
+		}
+	}
+	return nil
+}
+
 // netUnixData implements vfs.DynamicBytesSource for /proc/net/unix.
 //
 // +stateify savable
@@ -672,6 +718,102 @@ func (d *netSnmpData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netSnmp6Data implements vfs.DynamicBytesSource for /proc/net/snmp6.
+//
+// +stateify savable
+type netSnmp6Data struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netSnmp6Data)(nil)
+
+// The names of the counters of /proc/net/snmp6, without their prefix. See
+// Linux's net/ipv6/proc.c.
+var (
+	snmp6IP = []string{
+		"InReceives", "InHdrErrors", "InTooBigErrors", "InNoRoutes", "InAddrErrors", "InUnknownProtos", "InTruncatedPkts", "InDiscards",
+		"InDelivers", "OutForwDatagrams", "OutRequests", "OutDiscards", "OutNoRoutes", "ReasmTimeout", "ReasmReqds", "ReasmOKs",
+		"ReasmFails", "FragOKs", "FragFails", "FragCreates", "InMcastPkts", "OutMcastPkts", "InOctets", "OutOctets",
+		"InMcastOctets", "OutMcastOctets", "InBcastOctets", "OutBcastOctets", "InNoECTPkts", "InECT1Pkts", "InECT0Pkts", "InCEPkts",
+	}
+	snmp6ICMP = []string{"InMsgs", "InErrors", "OutMsgs", "OutErrors", "InCsumErrors"}
+	snmp6UDP  = []string{"InDatagrams", "NoPorts", "InErrors", "OutDatagrams", "RcvbufErrors", "SndbufErrors", "InCsumErrors", "IgnoredMulti"}
+
+	// icmp6TypeNames are the names of the ICMPv6 message types that have
+	// named counters.
+	icmp6TypeNames = [256]string{
+		1:   "DestUnreachs",
+		2:   "PktTooBigs",
+		3:   "TimeExcds",
+		4:   "ParmProblems",
+		128: "Echos",
+		129: "EchoReplies",
+		130: "GroupMembQueries",
+		131: "GroupMembResponses",
+		132: "GroupMembReductions",
+		133: "RouterSolicits",
+		134: "RouterAdvertisements",
+		135: "NeighborSolicits",
+		136: "NeighborAdvertisements",
+		137: "Redirects",
+		143: "MLDv2Reports",
+	}
+)
+
+// statistics fills stat with the counters of the stack, leaving it zeroed if
+// they aren't available, and returns them as a slice.
+func (d *netSnmp6Data) statistics(stat interface{}, prefix string) []uint64 {
+	if err := d.stack.Statistics(stat, prefix); err != nil {
+		if err == syserror.EOPNOTSUPP {
+			log.Infof("Failed to retrieve %s of /proc/net/snmp6: %v", prefix, err)
+		} else {
+			log.Warningf("Failed to retrieve %s of /proc/net/snmp6: %v", prefix, err)
+		}
+	}
+	return toSlice(stat)
+}
+
+// Generate implements vfs.DynamicBytesSource.
+// See Linux's net/ipv6/proc.c:snmp6_seq_show.
+func (d *netSnmp6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	writeCounters := func(prefix string, names []string, values []uint64) {
+		for i, name := range names {
+			fmt.Fprintf(buf, "%-32s\t%d\n", prefix+name, values[i])
+		}
+	}
+	writeCounters("Ip6", snmp6IP, d.statistics(&inet.StatSNMP6IP{}, "Ip6"))
+	writeCounters("Icmp6", snmp6ICMP, d.statistics(&inet.StatSNMP6ICMP{}, "Icmp6"))
+
+	// Message types with a name are always listed by name, and all types
+	// with a nonzero counter are listed by number.
+	msgs := d.statistics(&inet.StatSNMP6ICMPMSG{}, "Icmp6Msg")
+	for i, v := range msgs {
+		if name := icmp6TypeNames[i&0xff]; name != "" {
+			fmt.Fprintf(buf, "%-32s\t%d\n", "Icmp6"+icmp6Direction(i)+name, v)
+		}
+	}
+	for i, v := range msgs {
+		if v != 0 {
+			fmt.Fprintf(buf, "%-32s\t%d\n", fmt.Sprintf("Icmp6%sType%d", icmp6Direction(i), i&0xff), v)
+		}
+	}
+
+	writeCounters("Udp6", snmp6UDP, d.statistics(&inet.StatSNMP6UDP{}, "Udp6"))
+	writeCounters("UdpLite6", snmp6UDP, d.statistics(&inet.StatSNMP6UDPLite{}, "UdpLite6"))
+	return nil
+}
+
+// icmp6Direction returns the direction of the messages counted at index i of
+// inet.StatSNMP6ICMPMSG.
+func icmp6Direction(i int) string {
+	if i&0x100 != 0 {
+		return "Out"
+	}
+	return "In"
+}
+
 // netRouteData implements vfs.DynamicBytesSource for /proc/net/route.
 //
 // +stateify savable
@@ -736,6 +878,71 @@ func (d *netRouteData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netConnTrackData implements vfs.DynamicBytesSource for
+// /proc/net/nf_conntrack.
+//
+// +stateify savable
+type netConnTrackData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netConnTrackData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.
+// See Linux's net/netfilter/nf_conntrack_standalone.c:ct_seq_show.
+func (d *netConnTrackData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	entries, err := d.stack.ConnTrackEntries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmt.Fprintf(buf, "%-8s %d %-8s %d %d ", "ipv4", linux.AF_INET, connTrackProtocolName(e.Protocol), e.Protocol, int64(e.Timeout/time.Second))
+		if e.State != "" {
+			fmt.Fprintf(buf, "%s ", e.State)
+		}
+		writeConnTrackTuple(buf, e.Protocol, e.Original)
+		if !e.Replied {
+			buf.WriteString("[UNREPLIED] ")
+		}
+		writeConnTrackTuple(buf, e.Protocol, e.Reply)
+		if e.Assured {
+			buf.WriteString("[ASSURED] ")
+		}
+		// Marks, zones and references aren't supported; print the values of
+		// an unmarked connection in the default zone.
+		buf.WriteString("mark=0 zone=0 use=2\n")
+	}
+	return nil
+}
+
+// connTrackProtocolName returns the name of the transport protocol proto in
+// /proc/net/nf_conntrack.
+func connTrackProtocolName(proto uint8) string {
+	switch proto {
+	case linux.IPPROTO_TCP:
+		return "tcp"
+	case linux.IPPROTO_UDP:
+		return "udp"
+	case linux.IPPROTO_ICMP:
+		return "icmp"
+	default:
+		return "unknown"
+	}
+}
+
+// writeConnTrackTuple writes t, a tuple of a connection of protocol proto, to
+// buf.
+func writeConnTrackTuple(buf *bytes.Buffer, proto uint8, t inet.ConnTrackTuple) {
+	fmt.Fprintf(buf, "src=%s dst=%s ", net.IP(t.SrcAddr), net.IP(t.DstAddr))
+	if proto == linux.IPPROTO_ICMP {
+		fmt.Fprintf(buf, "type=%d code=%d id=%d ", t.ICMPType, t.ICMPCode, t.SrcPort)
+		return
+	}
+	fmt.Fprintf(buf, "sport=%d dport=%d ", t.SrcPort, t.DstPort)
+}
+
 // netStatData implements vfs.DynamicBytesSource for /proc/net/netstat.
 //
 // +stateify savable
@@ -17,6 +17,7 @@ package proc
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -24,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -32,14 +34,28 @@ import (
 // newSysDir returns the dentry corresponding to /proc/sys directory.
 func newSysDir(root *auth.Credentials, inoGen InoGenerator, k *kernel.Kernel) *kernfs.Dentry {
 	return kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+		"fs": kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+			"nr_open": newDentry(root, inoGen.NextIno(), 0644, &nrOpenData{}),
+		}),
 		"kernel": kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
 			"hostname": newDentry(root, inoGen.NextIno(), 0444, &hostnameData{}),
 			"shmall":   newDentry(root, inoGen.NextIno(), 0444, shmData(linux.SHMALL)),
 			"shmmax":   newDentry(root, inoGen.NextIno(), 0444, shmData(linux.SHMMAX)),
 			"shmmni":   newDentry(root, inoGen.NextIno(), 0444, shmData(linux.SHMMNI)),
+			"tainted":  newDentry(root, inoGen.NextIno(), 0644, &taintedData{k: k}),
+		}),
+		"user": kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+			"max_cgroup_namespaces": newDentry(root, inoGen.NextIno(), 0444, &ucountMaxData{typ: auth.UCountCgroupNamespaces, readOnly: true}),
+			"max_ipc_namespaces":    newDentry(root, inoGen.NextIno(), 0644, &ucountMaxData{typ: auth.UCountIPCNamespaces}),
+			"max_mnt_namespaces":    newDentry(root, inoGen.NextIno(), 0444, &ucountMaxData{typ: auth.UCountMntNamespaces, readOnly: true}),
+			"max_net_namespaces":    newDentry(root, inoGen.NextIno(), 0644, &ucountMaxData{typ: auth.UCountNetNamespaces}),
+			"max_pid_namespaces":    newDentry(root, inoGen.NextIno(), 0644, &ucountMaxData{typ: auth.UCountPIDNamespaces}),
+			"max_user_namespaces":   newDentry(root, inoGen.NextIno(), 0644, &ucountMaxData{typ: auth.UCountUserNamespaces}),
+			"max_uts_namespaces":    newDentry(root, inoGen.NextIno(), 0644, &ucountMaxData{typ: auth.UCountUTSNamespaces}),
 		}),
 		"vm": kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
-			"mmap_min_addr":     newDentry(root, inoGen.NextIno(), 0444, &mmapMinAddrData{}),
+			"max_map_count":     newDentry(root, inoGen.NextIno(), 0644, &maxMapCountData{}),
+			"mmap_min_addr":     newDentry(root, inoGen.NextIno(), 0644, &mmapMinAddrData{k: k}),
 			"overcommit_memory": newDentry(root, inoGen.NextIno(), 0444, newStaticFile("0\n")),
 		}),
 		"net": newSysNetDir(root, inoGen, k),
@@ -108,6 +124,16 @@ func newSysNetDir(root *auth.Credentials, inoGen InoGenerator, k *kernel.Kernel)
 				"wmem_max":      newDentry(root, inoGen.NextIno(), 0444, newStaticFile("212992")),
 			}),
 		}
+
+		if _, err := stack.ConnTrackLimits(); err == nil {
+			contents["netfilter"] = kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
+				"nf_conntrack_count":                   newDentry(root, inoGen.NextIno(), 0444, &connTrackCountData{stack: stack}),
+				"nf_conntrack_icmp_timeout":            newDentry(root, inoGen.NextIno(), 0644, &connTrackLimitData{stack: stack, limit: connTrackICMPTimeout}),
+				"nf_conntrack_max":                     newDentry(root, inoGen.NextIno(), 0644, &connTrackLimitData{stack: stack, limit: connTrackMax}),
+				"nf_conntrack_tcp_timeout_established": newDentry(root, inoGen.NextIno(), 0644, &connTrackLimitData{stack: stack, limit: connTrackTCPEstablishedTimeout}),
+				"nf_conntrack_udp_timeout":             newDentry(root, inoGen.NextIno(), 0644, &connTrackLimitData{stack: stack, limit: connTrackUDPTimeout}),
+			})
+		}
 	}
 
 	return kernfs.NewStaticDir(root, inoGen.NextIno(), 0555, map[string]*kernfs.Dentry{
@@ -115,7 +141,149 @@ func newSysNetDir(root *auth.Credentials, inoGen InoGenerator, k *kernel.Kernel)
 	})
 }
 
-// mmapMinAddrData implements vfs.DynamicBytesSource for
+// nrOpenData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/nr_open.
+//
+// +stateify savable
+type nrOpenData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ vfs.WritableDynamicBytesSource = (*nrOpenData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*nrOpenData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", kernel.NROpen())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*nrOpenData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < kernel.MinNROpen || v > kernel.MaxNROpen {
+		return 0, syserror.EINVAL
+	}
+	kernel.SetNROpen(v)
+	return n, nil
+}
+
+// maxMapCountData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/vm/max_map_count.
+//
+// +stateify savable
+type maxMapCountData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ vfs.WritableDynamicBytesSource = (*maxMapCountData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*maxMapCountData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", mm.MaxMapCount())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*maxMapCountData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	mm.SetMaxMapCount(v)
+	return n, nil
+}
+
+// ucountMaxData implements vfs.WritableDynamicBytesSource for the
+// /proc/sys/user/max_*_namespaces files. Each file shows the limit of the user
+// namespace of the reader or writer.
+//
+// +stateify savable
+type ucountMaxData struct {
+	kernfs.DynamicBytesFile
+
+	typ auth.UCountType
+
+	// If readOnly is true, the limit can't be changed. This is the case for
+	// the limits that aren't enforced, since the sentry doesn't track the
+	// lifetime of those kinds of namespace.
+	readOnly bool
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ucountMaxData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ucountMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	fmt.Fprintf(buf, "%d\n", userns.UCountMax(d.typ))
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ucountMaxData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if d.readOnly {
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Linux's kernel/ucount.c:set_permissions() requires CAP_SYS_RESOURCE in
+	// the user namespace whose limit is changed.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, creds.UserNamespace) {
+		return 0, syserror.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	creds.UserNamespace.SetUCountMax(d.typ, v)
+	return n, nil
+}
+
+// mmapMinAddrData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/vm/mmap_min_addr.
 //
 // +stateify savable
@@ -125,14 +293,104 @@ type mmapMinAddrData struct {
 	k *kernel.Kernel
 }
 
-var _ dynamicInode = (*mmapMinAddrData)(nil)
+var _ vfs.WritableDynamicBytesSource = (*mmapMinAddrData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *mmapMinAddrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	fmt.Fprintf(buf, "%d\n", d.k.Platform.MinUserAddress())
+	fmt.Fprintf(buf, "%d\n", effectiveMMapMinAddr(d.k))
 	return nil
 }
 
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*mmapMinAddrData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	// Like Linux's security/min_addr.c:mmap_min_addr_handler(), only
+	// CAP_SYS_RAWIO in the root user namespace allows lowering the minimum.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_RAWIO, creds.UserNamespace.Root()) {
+		return 0, syserror.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v uint64
+	n, err := usermem.CopyUint64StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if usermem.Addr(v).RoundDown() != usermem.Addr(v) {
+		return 0, syserror.EINVAL
+	}
+	mm.SetMMapMinAddr(usermem.Addr(v))
+	return n, nil
+}
+
+// effectiveMMapMinAddr returns the lowest address at which applications may
+// create mappings: the greater of the platform's minimum and vm.mmap_min_addr.
+func effectiveMMapMinAddr(k *kernel.Kernel) usermem.Addr {
+	if min := mm.MMapMinAddr(); min > k.Platform.MinUserAddress() {
+		return min
+	}
+	return k.Platform.MinUserAddress()
+}
+
+// taintedData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/tainted.
+//
+// +stateify savable
+type taintedData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*taintedData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *taintedData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d\n", d.k.Tainted())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write. Like Linux's
+// kernel/sysctl.c:proc_taint(), it sets the written taint flags in addition
+// to those already set.
+func (d *taintedData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, creds.UserNamespace.Root()) {
+		return 0, syserror.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	d.k.AddTaint(uint64(v))
+	return n, nil
+}
+
 // hostnameData implements vfs.DynamicBytesSource for /proc/sys/kernel/hostname.
 //
 // +stateify savable
@@ -207,3 +465,120 @@ func (d *tcpSackData) Write(ctx context.Context, src usermem.IOSequence, offset
 	*d.enabled = v != 0
 	return n, d.stack.SetTCPSACKEnabled(*d.enabled)
 }
+
+// connTrackLimit identifies a connection tracking limit that can be changed
+// through /proc/sys/net/netfilter.
+type connTrackLimit int
+
+const (
+	connTrackMax connTrackLimit = iota
+	connTrackTCPEstablishedTimeout
+	connTrackUDPTimeout
+	connTrackICMPTimeout
+)
+
+// get returns the value of l in limits. Timeouts are in seconds.
+func (l connTrackLimit) get(limits inet.ConnTrackLimits) int64 {
+	switch l {
+	case connTrackMax:
+		return int64(limits.Max)
+	case connTrackTCPEstablishedTimeout:
+		return int64(limits.TCPEstablishedTimeout / time.Second)
+	case connTrackUDPTimeout:
+		return int64(limits.UDPTimeout / time.Second)
+	case connTrackICMPTimeout:
+		return int64(limits.ICMPTimeout / time.Second)
+	default:
+		panic(fmt.Sprintf("unknown connection tracking limit %d", l))
+	}
+}
+
+// set sets the value of l in limits to v. Timeouts are in seconds.
+func (l connTrackLimit) set(limits *inet.ConnTrackLimits, v int32) {
+	switch l {
+	case connTrackMax:
+		limits.Max = int(v)
+	case connTrackTCPEstablishedTimeout:
+		limits.TCPEstablishedTimeout = time.Duration(v) * time.Second
+	case connTrackUDPTimeout:
+		limits.UDPTimeout = time.Duration(v) * time.Second
+	case connTrackICMPTimeout:
+		limits.ICMPTimeout = time.Duration(v) * time.Second
+	default:
+		panic(fmt.Sprintf("unknown connection tracking limit %d", l))
+	}
+}
+
+// connTrackLimitData implements vfs.WritableDynamicBytesSource for the
+// connection tracking limits in /proc/sys/net/netfilter.
+//
+// +stateify savable
+type connTrackLimitData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+	limit connTrackLimit
+}
+
+var _ vfs.WritableDynamicBytesSource = (*connTrackLimitData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *connTrackLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	limits, err := d.stack.ConnTrackLimits()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "%d\n", d.limit.get(limits))
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *connTrackLimitData) Write(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, syserror.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(usermem.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return n, err
+	}
+	if v < 0 {
+		return 0, syserror.EINVAL
+	}
+	limits, err := d.stack.ConnTrackLimits()
+	if err != nil {
+		return 0, err
+	}
+	d.limit.set(&limits, v)
+	return n, d.stack.SetConnTrackLimits(limits)
+}
+
+// connTrackCountData implements vfs.DynamicBytesSource for
+// /proc/sys/net/netfilter/nf_conntrack_count.
+//
+// +stateify savable
+type connTrackCountData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ dynamicInode = (*connTrackCountData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *connTrackCountData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	entries, err := d.stack.ConnTrackEntries()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "%d\n", len(entries))
+	return nil
+}
@@ -16,12 +16,27 @@ package proc
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 func newIPv6TestStack() *inet.TestStack {
@@ -76,3 +91,277 @@ func TestIfinet6(t *testing.T) {
 		t.Errorf("Got n.contents() = %v, want = %v", got, want)
 	}
 }
+
+func TestNetDevMcastNoAddresses(t *testing.T) {
+	s := inet.NewTestStack()
+	s.InterfacesMap[1] = inet.Interface{Name: "lo"}
+	n := &netDevMcastData{stack: s}
+	var buf bytes.Buffer
+	n.Generate(contexttest.Context(t), &buf)
+	if buf.Len() > 0 {
+		t.Errorf("n.Generate() generated = %q, want = %q", buf.Bytes(), "")
+	}
+}
+
+func TestNetDevMcast(t *testing.T) {
+	const (
+		loID  = 1
+		ethID = 2
+	)
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol(), ipv6.NewProtocol()},
+	})
+	if err := s.CreateNICWithOptions(loID, loopback.New(), stack.NICOptions{Name: "lo"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(%d, _, _) = %s", loID, err)
+	}
+	if err := s.CreateNICWithOptions(ethID, channel.New(0, 1280, "\x02\x02\x03\x04\x05\x06"), stack.NICOptions{Name: "eth0"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(%d, _, _) = %s", ethID, err)
+	}
+	// IPv6 NICs join the all-nodes group when they are enabled, but IPv4
+	// NICs must join the all-hosts group explicitly.
+	allHosts := tcpip.Address("\xe0\x00\x00\x01")
+	if err := s.JoinGroup(ipv4.ProtocolNumber, ethID, allHosts); err != nil {
+		t.Fatalf("JoinGroup(%d, %d, %s) = %s", ipv4.ProtocolNumber, ethID, allHosts, err)
+	}
+
+	n := &netDevMcastData{stack: &netstack.Stack{Stack: s}}
+	var buf bytes.Buffer
+	if err := n.Generate(contexttest.Context(t), &buf); err != nil {
+		t.Fatalf("n.Generate() = %v", err)
+	}
+	want := "2    eth0            1     0     01005e000001\n" +
+		"2    eth0            1     0     333300000001\n"
+	if got := buf.String(); got != want {
+		t.Errorf("n.Generate() generated = %q, want = %q", got, want)
+	}
+}
+
+func TestNetConnTrack(t *testing.T) {
+	client := []byte("\x0a\x00\x00\x01")
+	server := []byte("\x0a\x00\x00\x02")
+	s := inet.NewTestStack()
+	s.ConnTrackList = []inet.ConnTrackEntry{
+		{
+			Protocol: linux.IPPROTO_TCP,
+			Original: inet.ConnTrackTuple{SrcAddr: client, DstAddr: server, SrcPort: 1234, DstPort: 80},
+			Reply:    inet.ConnTrackTuple{SrcAddr: server, DstAddr: client, SrcPort: 80, DstPort: 1234},
+			State:    "ESTABLISHED",
+			Timeout:  431999*time.Second + time.Millisecond,
+			Replied:  true,
+			Assured:  true,
+		},
+		{
+			Protocol: linux.IPPROTO_UDP,
+			Original: inet.ConnTrackTuple{SrcAddr: client, DstAddr: server, SrcPort: 5000, DstPort: 53},
+			Reply:    inet.ConnTrackTuple{SrcAddr: server, DstAddr: client, SrcPort: 53, DstPort: 5000},
+			Timeout:  29 * time.Second,
+		},
+		{
+			Protocol: linux.IPPROTO_ICMP,
+			Original: inet.ConnTrackTuple{SrcAddr: client, DstAddr: server, SrcPort: 7, DstPort: 7, ICMPType: 8},
+			Reply:    inet.ConnTrackTuple{SrcAddr: server, DstAddr: client, SrcPort: 7, DstPort: 7},
+			Timeout:  30 * time.Second,
+			Replied:  true,
+		},
+	}
+
+	n := &netConnTrackData{stack: s}
+	var buf bytes.Buffer
+	if err := n.Generate(contexttest.Context(t), &buf); err != nil {
+		t.Fatalf("n.Generate() = %v", err)
+	}
+	want := "ipv4     2 tcp      6 431999 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=1234 dport=80 src=10.0.0.2 dst=10.0.0.1 sport=80 dport=1234 [ASSURED] mark=0 zone=0 use=2\n" +
+		"ipv4     2 udp      17 29 src=10.0.0.1 dst=10.0.0.2 sport=5000 dport=53 [UNREPLIED] src=10.0.0.2 dst=10.0.0.1 sport=53 dport=5000 mark=0 zone=0 use=2\n" +
+		"ipv4     2 icmp     1 30 src=10.0.0.1 dst=10.0.0.2 type=8 code=0 id=7 src=10.0.0.2 dst=10.0.0.1 type=0 code=0 id=7 mark=0 zone=0 use=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("n.Generate() generated = %q, want = %q", got, want)
+	}
+
+	c := &connTrackCountData{stack: s}
+	buf.Reset()
+	if err := c.Generate(contexttest.Context(t), &buf); err != nil {
+		t.Fatalf("c.Generate() = %v", err)
+	}
+	if got, want := buf.String(), "3\n"; got != want {
+		t.Errorf("c.Generate() generated = %q, want = %q", got, want)
+	}
+}
+
+func TestConnTrackLimits(t *testing.T) {
+	ctx := contexttest.Context(t)
+	s := &netstack.Stack{Stack: stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol()},
+		ConnTrackMax:     100,
+	})}
+
+	for _, tc := range []struct {
+		limit connTrackLimit
+		write string
+		want  string
+	}{
+		{limit: connTrackMax, want: "100\n"},
+		{limit: connTrackMax, write: "200\n", want: "200\n"},
+		{limit: connTrackTCPEstablishedTimeout, want: "432000\n"},
+		{limit: connTrackUDPTimeout, write: "60", want: "60\n"},
+		{limit: connTrackICMPTimeout, write: "10", want: "10\n"},
+	} {
+		d := &connTrackLimitData{stack: s, limit: tc.limit}
+		if tc.write != "" {
+			if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte(tc.write)), 0); err != nil {
+				t.Fatalf("Write(%q) to limit %d = %v", tc.write, tc.limit, err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := d.Generate(ctx, &buf); err != nil {
+			t.Fatalf("Generate() of limit %d = %v", tc.limit, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Generate() of limit %d generated = %q, want = %q", tc.limit, got, tc.want)
+		}
+	}
+
+	d := &connTrackLimitData{stack: s, limit: connTrackMax}
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("-1")), 0); err != syserror.EINVAL {
+		t.Errorf("Write(%q) = %v, want = %v", "-1", err, syserror.EINVAL)
+	}
+
+	ct := s.Stack.ConnTrack()
+	want := iptables.ConnTrackTimeouts{
+		TCPEstablished: 5 * 24 * time.Hour,
+		TCPTransient:   2 * time.Minute,
+		UDP:            time.Minute,
+		ICMP:           10 * time.Second,
+	}
+	if got := ct.Timeouts(); got != want {
+		t.Errorf("got ct.Timeouts() = %+v, want = %+v", got, want)
+	}
+	if got := ct.Max(); got != 200 {
+		t.Errorf("got ct.Max() = %d, want = 200", got)
+	}
+}
+
+func TestUCountMax(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	ctx := contexttest.WithCreds(contexttest.Context(t), auth.NewRootCredentials(userns))
+
+	d := &ucountMaxData{typ: auth.UCountPIDNamespaces}
+	var buf bytes.Buffer
+	if err := d.Generate(ctx, &buf); err != nil {
+		t.Fatalf("Generate() = %v", err)
+	}
+	if got, want := buf.String(), fmt.Sprintf("%d\n", auth.DefaultRootUCountMax); got != want {
+		t.Errorf("Generate() generated = %q, want = %q", got, want)
+	}
+
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("1\n")), 0); err != nil {
+		t.Fatalf("Write(%q) = %v", "1\n", err)
+	}
+	if got := userns.UCountMax(auth.UCountPIDNamespaces); got != 1 {
+		t.Errorf("got UCountMax(UCountPIDNamespaces) = %d, want = 1", got)
+	}
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("-1")), 0); err != syserror.EINVAL {
+		t.Errorf("Write(%q) = %v, want = %v", "-1", err, syserror.EINVAL)
+	}
+
+	// Without CAP_SYS_RESOURCE, the limit can't be changed.
+	unprivileged := contexttest.WithCreds(contexttest.Context(t), auth.NewUserCredentials(1000, 1000, nil, nil, userns))
+	if _, err := d.Write(unprivileged, usermem.BytesIOSequence([]byte("2")), 0); err != syserror.EPERM {
+		t.Errorf("unprivileged Write(%q) = %v, want = %v", "2", err, syserror.EPERM)
+	}
+	if got := userns.UCountMax(auth.UCountPIDNamespaces); got != 1 {
+		t.Errorf("got UCountMax(UCountPIDNamespaces) after unprivileged write = %d, want = 1", got)
+	}
+
+	// Limits that aren't enforced can't be changed.
+	ro := &ucountMaxData{typ: auth.UCountCgroupNamespaces, readOnly: true}
+	if _, err := ro.Write(ctx, usermem.BytesIOSequence([]byte("2")), 0); err != syserror.EINVAL {
+		t.Errorf("Write(%q) to a read-only limit = %v, want = %v", "2", err, syserror.EINVAL)
+	}
+	if got, want := userns.UCountMax(auth.UCountCgroupNamespaces), int32(auth.DefaultRootUCountMax); got != want {
+		t.Errorf("got UCountMax(UCountCgroupNamespaces) = %d, want = %d", got, want)
+	}
+}
+
+func TestTainted(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	ctx := contexttest.WithCreds(contexttest.Context(t), auth.NewRootCredentials(userns))
+
+	d := &taintedData{k: &kernel.Kernel{}}
+	for _, tc := range []struct {
+		write string
+		want  string
+	}{
+		{want: "0\n"},
+		{write: "4\n", want: "4\n"},
+		{write: "1", want: "5\n"},
+		// Writes can't clear flags.
+		{write: "0", want: "5\n"},
+		{write: "2", want: "7\n"},
+	} {
+		if tc.write != "" {
+			if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte(tc.write)), 0); err != nil {
+				t.Fatalf("Write(%q) = %v", tc.write, err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := d.Generate(ctx, &buf); err != nil {
+			t.Fatalf("Generate() = %v", err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Generate() after writing %q generated = %q, want = %q", tc.write, got, tc.want)
+		}
+	}
+
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("-1")), 0); err != syserror.EINVAL {
+		t.Errorf("Write(%q) = %v, want = %v", "-1", err, syserror.EINVAL)
+	}
+
+	// Without CAP_SYS_ADMIN, no flags can be set.
+	unprivileged := contexttest.WithCreds(contexttest.Context(t), auth.NewUserCredentials(1000, 1000, nil, nil, userns))
+	if _, err := d.Write(unprivileged, usermem.BytesIOSequence([]byte("8")), 0); err != syserror.EPERM {
+		t.Errorf("unprivileged Write(%q) = %v, want = %v", "8", err, syserror.EPERM)
+	}
+	if got := d.k.Tainted(); got != 7 {
+		t.Errorf("got Tainted() after unprivileged write = %d, want = 7", got)
+	}
+}
+
+func TestMMapMinAddrWrite(t *testing.T) {
+	defer mm.SetMMapMinAddr(mm.MMapMinAddr())
+	userns := auth.NewRootUserNamespace()
+	root := auth.NewRootCredentials(userns)
+	ctx := contexttest.WithCreds(contexttest.Context(t), root)
+
+	d := &mmapMinAddrData{}
+	// Values beyond the range of int32 are accepted, like unsigned longs.
+	const big = "4294967296\n"
+	if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte(big)), 0); err != nil {
+		t.Fatalf("Write(%q) = %v", big, err)
+	}
+	if got, want := mm.MMapMinAddr(), usermem.Addr(1<<32); got != want {
+		t.Errorf("got MMapMinAddr() = %#x, want = %#x", got, want)
+	}
+	for _, v := range []string{"4097", "-4096", "18446744073709551616"} {
+		if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte(v)), 0); err != syserror.EINVAL {
+			t.Errorf("Write(%q) = %v, want = %v", v, err, syserror.EINVAL)
+		}
+	}
+
+	// Only CAP_SYS_RAWIO in the root user namespace allows writes.
+	child, err := root.NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace() = %v", err)
+	}
+	for name, creds := range map[string]*auth.Credentials{
+		"unprivileged":         auth.NewUserCredentials(1000, 1000, nil, nil, userns),
+		"child namespace root": auth.NewRootCredentials(child),
+	} {
+		ctx := contexttest.WithCreds(contexttest.Context(t), creds)
+		if _, err := d.Write(ctx, usermem.BytesIOSequence([]byte("0")), 0); err != syserror.EPERM {
+			t.Errorf("%s Write(%q) = %v, want = %v", name, "0", err, syserror.EPERM)
+		}
+	}
+	if got, want := mm.MMapMinAddr(), usermem.Addr(1<<32); got != want {
+		t.Errorf("got MMapMinAddr() after unprivileged writes = %#x, want = %#x", got, want)
+	}
+}
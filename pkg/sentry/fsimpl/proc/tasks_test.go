@@ -15,20 +15,38 @@
 package proc
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"path"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/testutil"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/pipe"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -47,14 +65,20 @@ var (
 var (
 	tasksStaticFiles = map[string]testutil.DirentType{
 		"cpuinfo":     linux.DT_REG,
+		"devices":     linux.DT_REG,
+		"key-users":   linux.DT_REG,
+		"keys":        linux.DT_REG,
 		"loadavg":     linux.DT_REG,
 		"meminfo":     linux.DT_REG,
+		"misc":        linux.DT_REG,
 		"mounts":      linux.DT_LNK,
 		"net":         linux.DT_DIR,
 		"self":        linux.DT_LNK,
 		"stat":        linux.DT_REG,
 		"sys":         linux.DT_DIR,
 		"thread-self": linux.DT_LNK,
+		"timer_list":  linux.DT_REG,
+		"tty":         linux.DT_DIR,
 		"uptime":      linux.DT_REG,
 		"version":     linux.DT_REG,
 	}
@@ -63,50 +87,81 @@ var (
 		"thread-self": threadSelfLink.NextOff,
 	}
 	taskStaticFiles = map[string]testutil.DirentType{
-		"auxv":    linux.DT_REG,
-		"cgroup":  linux.DT_REG,
-		"cmdline": linux.DT_REG,
-		"comm":    linux.DT_REG,
-		"environ": linux.DT_REG,
-		"gid_map": linux.DT_REG,
-		"io":      linux.DT_REG,
-		"maps":    linux.DT_REG,
-		"ns":      linux.DT_DIR,
-		"smaps":   linux.DT_REG,
-		"stat":    linux.DT_REG,
-		"statm":   linux.DT_REG,
-		"status":  linux.DT_REG,
-		"task":    linux.DT_DIR,
-		"uid_map": linux.DT_REG,
+		"auxv":          linux.DT_REG,
+		"cgroup":        linux.DT_REG,
+		"cmdline":       linux.DT_REG,
+		"comm":          linux.DT_REG,
+		"cwd":           linux.DT_LNK,
+		"environ":       linux.DT_REG,
+		"exe":           linux.DT_LNK,
+		"fd":            linux.DT_DIR,
+		"fdinfo":        linux.DT_DIR,
+		"gid_map":       linux.DT_REG,
+		"io":            linux.DT_REG,
+		"limits":        linux.DT_REG,
+		"maps":          linux.DT_REG,
+		"mem":           linux.DT_REG,
+		"mountinfo":     linux.DT_REG,
+		"mounts":        linux.DT_REG,
+		"ns":            linux.DT_DIR,
+		"oom_score":     linux.DT_REG,
+		"oom_score_adj": linux.DT_REG,
+		"root":          linux.DT_LNK,
+		"sched":         linux.DT_REG,
+		"smaps":         linux.DT_REG,
+		"stat":          linux.DT_REG,
+		"statm":         linux.DT_REG,
+		"status":        linux.DT_REG,
+		"task":          linux.DT_DIR,
+		"uid_map":       linux.DT_REG,
+		"wchan":         linux.DT_REG,
 	}
 )
 
 func setup(t *testing.T) *testutil.System {
-	k, err := testutil.Boot()
+	return setupWithData(t, &InternalData{
+		Cgroups: map[string]string{
+			"cpuset": "/foo/cpuset",
+			"memory": "/foo/memory",
+		},
+	})
+}
+
+// setupWithData is like setup, but mounts procfs with the given InternalData.
+func setupWithData(t *testing.T, data *InternalData) *testutil.System {
+	return setupWithOptions(t, data, testutil.BootOptions{})
+}
+
+// setupWithOptions is like setupWithData, but also boots the kernel with the
+// given options.
+func setupWithOptions(t *testing.T, data *InternalData, opts testutil.BootOptions) *testutil.System {
+	k, err := testutil.BootWithOptions(opts)
 	if err != nil {
 		t.Fatalf("Error creating kernel: %v", err)
 	}
-
 	ctx := k.SupervisorContext()
-	creds := auth.CredentialsFromContext(ctx)
+	vfsObj, mntns, err := mountProc(ctx, data)
+	if err != nil {
+		t.Fatalf("NewMountNamespace(): %v", err)
+	}
+	return testutil.NewSystem(ctx, t, vfsObj, mntns)
+}
 
+// mountProc returns a new VFS and a mount namespace whose root is a procfs
+// mounted with the given InternalData.
+func mountProc(ctx context.Context, data *InternalData) (*vfs.VirtualFilesystem, *vfs.MountNamespace, error) {
 	vfsObj := vfs.New()
 	vfsObj.MustRegisterFilesystemType("procfs", &procFSType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 	})
 	fsOpts := vfs.GetFilesystemOptions{
-		InternalData: &InternalData{
-			Cgroups: map[string]string{
-				"cpuset": "/foo/cpuset",
-				"memory": "/foo/memory",
-			},
-		},
+		InternalData: data,
 	}
-	mntns, err := vfsObj.NewMountNamespace(ctx, creds, "", "procfs", &fsOpts)
+	mntns, err := vfsObj.NewMountNamespace(ctx, auth.CredentialsFromContext(ctx), "", "procfs", &fsOpts)
 	if err != nil {
-		t.Fatalf("NewMountNamespace(): %v", err)
+		return nil, nil, err
 	}
-	return testutil.NewSystem(ctx, t, vfsObj, mntns)
+	return vfsObj, mntns, nil
 }
 
 func TestTasksEmpty(t *testing.T) {
@@ -331,6 +386,388 @@ func TestTasksOffset(t *testing.T) {
 	}
 }
 
+// limitedCollector collects at most limit dirents.
+type limitedCollector struct {
+	limit   int
+	dirents []vfs.Dirent
+}
+
+// Handle implements vfs.IterDirentsCallback.Handle.
+func (c *limitedCollector) Handle(dirent vfs.Dirent) bool {
+	if len(c.dirents) >= c.limit {
+		return false
+	}
+	c.dirents = append(c.dirents, dirent)
+	return true
+}
+
+func TestTasksOffsetBoundary(t *testing.T) {
+	for _, hide := range []bool{false, true} {
+		t.Run(fmt.Sprintf("HideSelfLinks=%t", hide), func(t *testing.T) {
+			s := setupWithData(t, &InternalData{HideSelfLinks: hide})
+			defer s.Destroy()
+
+			k := kernel.KernelFromContext(s.Ctx)
+			for i := 0; i < 3; i++ {
+				tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+				if _, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc); err != nil {
+					t.Fatalf("CreateTask(): %v", err)
+				}
+			}
+
+			fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/"), &vfs.OpenOptions{})
+			if err != nil {
+				t.Fatalf("vfsfs.OpenAt(/) failed: %v", err)
+			}
+			defer fd.DecRef()
+
+			// Static files follow the dots in name order, at consecutive
+			// offsets.
+			var staticNames []string
+			for name := range tasksStaticFiles {
+				switch name {
+				case ".", "..", selfName, threadSelfName:
+				default:
+					staticNames = append(staticNames, name)
+				}
+			}
+			sort.Strings(staticNames)
+			var all testutil.DirentCollector
+			if err := fd.IterDirents(s.Ctx, &all); err != nil {
+				t.Fatalf("IterDirents(): %v", err)
+			}
+			dirents := all.OrderedDirents()
+			if len(dirents) < 2+len(staticNames) {
+				t.Fatalf("got %d dirents, want at least %d: %v", len(dirents), 2+len(staticNames), dirents)
+			}
+			for i, name := range staticNames {
+				d := dirents[2+i]
+				if d.Name != name || d.NextOff != int64(2+i+1) {
+					t.Errorf("dirent %d = %q with next offset %d, want %q with next offset %d", 2+i, d.Name, d.NextOff, name, 2+i+1)
+				}
+			}
+
+			pidOffset := int64(256 + 2)
+			var tail []string
+			if !hide {
+				tail = append(tail, selfName, threadSelfName)
+			} else {
+				pidOffset = 256
+			}
+			tail = append(tail, "1", "2", "3")
+
+			// Seeking to the last static file, right after it, or anywhere
+			// before the first task entry interleaves deterministically.
+			lastStatic := int64(2 + len(staticNames))
+			for _, tc := range []struct {
+				offset int64
+				want   []string
+			}{
+				{offset: lastStatic - 1, want: append([]string{staticNames[len(staticNames)-1]}, tail...)},
+				{offset: lastStatic, want: tail},
+				{offset: 255, want: tail},
+				{offset: pidOffset + 1, want: []string{"1", "2", "3"}},
+			} {
+				if _, err := fd.Seek(s.Ctx, tc.offset, linux.SEEK_SET); err != nil {
+					t.Fatalf("Seek(%d, SEEK_SET): %v", tc.offset, err)
+				}
+				var collector testutil.DirentCollector
+				collector.SkipDotsChecks(true)
+				if err := fd.IterDirents(s.Ctx, &collector); err != nil {
+					t.Fatalf("IterDirents(): %v", err)
+				}
+				var got []string
+				for _, d := range collector.OrderedDirents() {
+					got = append(got, d.Name)
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("dirents at offset %d = %v, want %v", tc.offset, got, tc.want)
+				}
+			}
+
+			// Reading one dirent at a time across the boundary neither
+			// repeats nor skips entries.
+			if _, err := fd.Seek(s.Ctx, lastStatic-1, linux.SEEK_SET); err != nil {
+				t.Fatalf("Seek(%d, SEEK_SET): %v", lastStatic-1, err)
+			}
+			var got []string
+			for {
+				c := limitedCollector{limit: 1}
+				if err := fd.IterDirents(s.Ctx, &c); err != nil {
+					t.Fatalf("IterDirents(): %v", err)
+				}
+				if len(c.dirents) == 0 {
+					break
+				}
+				got = append(got, c.dirents[0].Name)
+			}
+			want := append([]string{staticNames[len(staticNames)-1]}, tail...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("dirents read one at a time = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestTasksChurn checks that listing /proc in small chunks while thread groups
+// are created concurrently returns TGIDs in increasing order, without
+// repeating any, and includes every thread group that existed before the
+// listing started.
+func TestTasksChurn(t *testing.T) {
+	s := setupWithData(t, &InternalData{HideSelfLinks: true})
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	createTasks := func(n int) error {
+		for i := 0; i < n; i++ {
+			tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+			if _, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// Span several batches of TGIDs.
+	const numTasks = 3*tgidBatchSize + 1
+	if err := createTasks(numTasks); err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/"), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(/) failed: %v", err)
+	}
+	defer fd.DecRef()
+
+	done := make(chan error)
+	go func() {
+		done <- createTasks(numTasks)
+	}()
+
+	for pass := 0; pass < 3; pass++ {
+		if _, err := fd.Seek(s.Ctx, FIRST_PROCESS_ENTRY, linux.SEEK_SET); err != nil {
+			t.Fatalf("Seek(%d, SEEK_SET): %v", FIRST_PROCESS_ENTRY, err)
+		}
+		var tids []uint64
+		for {
+			c := limitedCollector{limit: 7}
+			if err := fd.IterDirents(s.Ctx, &c); err != nil {
+				t.Fatalf("IterDirents(): %v", err)
+			}
+			if len(c.dirents) == 0 {
+				break
+			}
+			for _, d := range c.dirents {
+				tid, err := strconv.ParseUint(d.Name, 10, 64)
+				if err != nil {
+					t.Fatalf("pass %d: unexpected dirent %q", pass, d.Name)
+				}
+				tids = append(tids, tid)
+			}
+		}
+		for i := 1; i < len(tids); i++ {
+			if tids[i] <= tids[i-1] {
+				t.Fatalf("pass %d: TGID %d listed after %d", pass, tids[i], tids[i-1])
+			}
+		}
+		if len(tids) < numTasks {
+			t.Fatalf("pass %d: listed %d thread groups, want at least %d", pass, len(tids), numTasks)
+		}
+		for i := 0; i < numTasks; i++ {
+			if tids[i] != uint64(i+1) {
+				t.Fatalf("pass %d: dirent %d has TGID %d, want %d", pass, i, tids[i], i+1)
+			}
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	pidns := k.RootPIDNamespace()
+	tg := k.NewThreadGroup(nil, pidns, kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	var names []string
+	for i := 0; i < 4; i++ {
+		thread, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("thread-%d", i), tg)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		threads = append(threads, thread)
+		names = append(names, strconv.Itoa(int(pidns.IDOfTask(thread))))
+	}
+	path := fmt.Sprintf("/%d/task", pidns.IDOfThreadGroup(tg))
+
+	// Every thread is listed as a directory, at an offset derived from its
+	// TID.
+	types := make(map[string]testutil.DirentType)
+	offsets := make(map[string]int64)
+	for i, thread := range threads {
+		types[names[i]] = linux.DT_DIR
+		offsets[names[i]] = 2 + int64(pidns.IDOfTask(thread)) + 1
+	}
+	collector := s.ListDirents(s.PathOpAtRoot(path))
+	s.AssertAllDirentTypes(collector, types)
+	s.AssertDirentOffsets(collector, offsets)
+
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+	}
+	defer fd.DecRef()
+
+	// Threads that exit between reads are neither repeated nor skipped over,
+	// whether they were listed already or not.
+	var got []string
+	for {
+		c := limitedCollector{limit: 1}
+		if err := fd.IterDirents(s.Ctx, &c); err != nil {
+			t.Fatalf("IterDirents(): %v", err)
+		}
+		if len(c.dirents) == 0 {
+			break
+		}
+		got = append(got, c.dirents[0].Name)
+		if c.dirents[0].Name == names[1] {
+			threads[1].TestOnly_Exit()
+			threads[2].TestOnly_Exit()
+		}
+	}
+	want := []string{".", "..", names[0], names[1], names[3]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s read one entry at a time = %v, want %v", path, got, want)
+	}
+
+	// Seeking to the offset reported after a thread resumes right after it.
+	if _, err := fd.Seek(s.Ctx, offsets[names[0]], linux.SEEK_SET); err != nil {
+		t.Fatalf("Seek(%d, SEEK_SET): %v", offsets[names[0]], err)
+	}
+	var rest testutil.DirentCollector
+	rest.SkipDotsChecks(true)
+	if err := fd.IterDirents(s.Ctx, &rest); err != nil {
+		t.Fatalf("IterDirents(): %v", err)
+	}
+	got = nil
+	for _, d := range rest.OrderedDirents() {
+		got = append(got, d.Name)
+	}
+	if want := []string{names[3]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%s after seeking past %s = %v, want %v", path, names[0], got, want)
+	}
+}
+
+func TestTasksHideSelfLinks(t *testing.T) {
+	s := setupWithData(t, &InternalData{HideSelfLinks: true})
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	for i := 0; i < 2; i++ {
+		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		if _, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc); err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+	}
+
+	// Without the symlinks, /proc/[pid] next offset starts at 256, then adds
+	// the PID, and adds 1 for the next offset.
+	expectedDirents := map[string]testutil.DirentType{
+		"1": linux.DT_DIR,
+		"2": linux.DT_DIR,
+	}
+	for n, d := range tasksStaticFiles {
+		if n != selfName && n != threadSelfName {
+			expectedDirents[n] = d
+		}
+	}
+	collector := s.ListDirents(s.PathOpAtRoot("/"))
+	s.AssertAllDirentTypes(collector, expectedDirents)
+	s.AssertDirentOffsets(collector, map[string]int64{
+		"1": 256 + 1 + 1,
+		"2": 256 + 2 + 1,
+	})
+
+	for _, name := range []string{selfName, threadSelfName} {
+		_, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(name))
+		if err != syserror.ENOENT {
+			t.Errorf("vfsfs.ReadlinkAt(%s): got error %v, want %v", name, err, syserror.ENOENT)
+		}
+	}
+}
+
+// warningRecorder is a log.Emitter that records warnings.
+type warningRecorder struct {
+	warnings []string
+}
+
+// Emit implements log.Emitter.Emit.
+func (r *warningRecorder) Emit(level log.Level, _ time.Time, format string, v ...interface{}) {
+	if level == log.Warning {
+		r.warnings = append(r.warnings, fmt.Sprintf(format, v...))
+	}
+}
+
+func TestMissingFiles(t *testing.T) {
+	missing := NewMissingFiles(4)
+	s := setupWithData(t, &InternalData{MissingFiles: missing})
+	defer s.Destroy()
+
+	oldEmitter := log.Log().Emitter
+	var recorder warningRecorder
+	log.SetTarget(&recorder)
+	defer log.SetTarget(oldEmitter)
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "task", tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	tid := k.RootPIDNamespace().IDOfTask(task)
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		path string
+	}{
+		{ctx: task, path: "/foo"},
+		{ctx: s.Ctx, path: "/foo"},
+		{ctx: s.Ctx, path: fmt.Sprintf("/%d/foo", tid)},
+		{ctx: s.Ctx, path: fmt.Sprintf("/%d/foo", tid)},
+		{ctx: s.Ctx, path: fmt.Sprintf("/%d/task/%d/bar", tid, tid)},
+		// Missing tasks aren't recorded.
+		{ctx: s.Ctx, path: "/12345"},
+		// The limit is reached.
+		{ctx: s.Ctx, path: "/baz"},
+		{ctx: s.Ctx, path: "/qux"},
+	} {
+		if _, err := s.VFS.StatAt(tc.ctx, s.Creds, s.PathOpAtRoot(tc.path), &vfs.StatOptions{}); err == nil {
+			t.Errorf("StatAt(%s) succeeded, want error", tc.path)
+		}
+	}
+
+	want := []MissingFile{
+		{Path: "[pid]/foo", Count: 2},
+		{Path: "[pid]/task/[tid]/bar", Count: 1},
+		{Path: "baz", Count: 1},
+		{Path: "foo", Count: 2, FirstTID: tid, FirstTaskName: "task"},
+	}
+	if got := missing.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %+v, want %+v", got, want)
+	}
+	if got, want := missing.Dropped(), uint64(1); got != want {
+		t.Errorf("Dropped() = %d, want %d", got, want)
+	}
+
+	// Each recorded file is only logged once.
+	if got, want := len(recorder.warnings), len(want); got != want {
+		t.Errorf("got %d warnings, want %d: %q", got, want, recorder.warnings)
+	}
+}
+
 func TestTask(t *testing.T) {
 	s := setup(t)
 	defer s.Destroy()
@@ -366,89 +803,3030 @@ func TestProcSelf(t *testing.T) {
 	s.AssertAllDirentTypes(collector, taskStaticFiles)
 }
 
-func iterateDir(ctx context.Context, t *testing.T, s *testutil.System, fd *vfs.FileDescription) {
-	t.Logf("Iterating: /proc%s", fd.MappedName(ctx))
+func TestTaskFDReadlink(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
 
-	var collector testutil.DirentCollector
-	if err := fd.IterDirents(ctx, &collector); err != nil {
-		t.Fatalf("IterDirents(): %v", err)
+	k := kernel.KernelFromContext(s.Ctx)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
 	}
-	if err := collector.Contains(".", linux.DT_DIR); err != nil {
-		t.Error(err.Error())
+
+	epollFD, err := s.VFS.NewEpollInstanceFD()
+	if err != nil {
+		t.Fatalf("NewEpollInstanceFD(): %v", err)
 	}
-	if err := collector.Contains("..", linux.DT_DIR); err != nil {
-		t.Error(err.Error())
+	defer epollFD.DecRef()
+	statusFD, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/status"), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(/1/status) failed: %v", err)
+	}
+	defer statusFD.DecRef()
+	pipeR, pipeW, err := pipe.NewConnectedVFSPipeFDs(s.Ctx, s.VFS, 0)
+	if err != nil {
+		t.Fatalf("NewConnectedVFSPipeFDs(): %v", err)
+	}
+	defer pipeR.DecRef()
+	defer pipeW.DecRef()
+	eventFD, err := eventfd.NewVFSEventFD(s.VFS, 0, false, 0)
+	if err != nil {
+		t.Fatalf("NewVFSEventFD(): %v", err)
+	}
+	defer eventFD.DecRef()
+	for fd, file := range []*vfs.FileDescription{epollFD, statusFD, pipeR, pipeW, eventFD} {
+		if err := task.FDTable().NewFDAtVFS2(s.Ctx, int32(fd), file, kernel.FDFlags{}); err != nil {
+			t.Fatalf("NewFDAtVFS2(%d): %v", fd, err)
+		}
 	}
 
-	for _, d := range collector.Dirents() {
-		if d.Name == "." || d.Name == ".." {
-			continue
+	collector := s.ListDirents(s.PathOpAtRoot("/1/fd"))
+	s.AssertAllDirentTypes(collector, map[string]testutil.DirentType{
+		"0": linux.DT_LNK,
+		"1": linux.DT_LNK,
+		"2": linux.DT_LNK,
+		"3": linux.DT_LNK,
+		"4": linux.DT_LNK,
+	})
+
+	// Like Linux, pipes are named by the inode number that fstat(2) reports
+	// for both of their ends, while anonymous inodes share a single inode.
+	ino := func(file *vfs.FileDescription) uint64 {
+		t.Helper()
+		stat, err := file.Stat(s.Ctx, vfs.StatOptions{Mask: linux.STATX_INO})
+		if err != nil {
+			t.Fatalf("Stat(): %v", err)
 		}
-		childPath := path.Join(fd.MappedName(ctx), d.Name)
-		if d.Type == linux.DT_LNK {
-			link, err := s.VFS.ReadlinkAt(
-				ctx,
-				auth.CredentialsFromContext(ctx),
-				&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(childPath)},
-			)
-			if err != nil {
-				t.Errorf("vfsfs.ReadlinkAt(%v) failed: %v", childPath, err)
-			} else {
-				t.Logf("Skipping symlink: /proc%s => %s", childPath, link)
-			}
-			continue
+		return stat.Ino
+	}
+	pipeIno := ino(pipeR)
+	if got := ino(pipeW); got != pipeIno {
+		t.Errorf("got inode number %d for the write end of a pipe, want %d as for its read end", got, pipeIno)
+	}
+	if otherR, otherW, err := pipe.NewConnectedVFSPipeFDs(s.Ctx, s.VFS, 0); err != nil {
+		t.Errorf("NewConnectedVFSPipeFDs(): %v", err)
+	} else {
+		if got := ino(otherR); got == pipeIno {
+			t.Errorf("got inode number %d for two pipes, want distinct inode numbers", got)
 		}
+		otherR.DecRef()
+		otherW.DecRef()
+	}
+	if got, want := ino(eventFD), ino(epollFD); got != want {
+		t.Errorf("got inode number %d for an eventfd, want %d as for an epoll instance", got, want)
+	}
 
-		t.Logf("Opening: /proc%s", childPath)
-		child, err := s.VFS.OpenAt(
-			ctx,
-			auth.CredentialsFromContext(ctx),
-			&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(childPath)},
-			&vfs.OpenOptions{},
-		)
+	pipeName := fmt.Sprintf("pipe:[%d]", pipeIno)
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{path: "/1/fd/0", want: "anon_inode:[eventpoll]"},
+		{path: "/1/fd/1", want: "/1/status"},
+		{path: "/1/fd/2", want: pipeName},
+		{path: "/1/fd/3", want: pipeName},
+		{path: "/1/fd/4", want: "anon_inode:[eventfd]"},
+	} {
+		got, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(tc.path))
 		if err != nil {
-			t.Errorf("vfsfs.OpenAt(%v) failed: %v", childPath, err)
+			t.Errorf("vfsfs.ReadlinkAt(%s) failed: %v", tc.path, err)
 			continue
 		}
-		stat, err := child.Stat(ctx, vfs.StatOptions{})
-		if err != nil {
-			t.Errorf("Stat(%v) failed: %v", childPath, err)
-		}
-		if got := linux.FileMode(stat.Mode).DirentType(); got != d.Type {
-			t.Errorf("wrong file mode, stat: %v, dirent: %v", got, d.Type)
-		}
-		if d.Type == linux.DT_DIR {
-			// Found another dir, let's do it again!
-			iterateDir(ctx, t, s, child)
+		if got != tc.want {
+			t.Errorf("vfsfs.ReadlinkAt(%s) = %q, want %q", tc.path, got, tc.want)
 		}
 	}
+
+	// Once the fd is closed, its symlink must disappear.
+	if _, file := task.FDTable().Remove(0); file != nil {
+		file.DecRef()
+	}
+	if _, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/fd/0")); err != syserror.ENOENT {
+		t.Errorf("vfsfs.ReadlinkAt(/1/fd/0) after close: got error %v, want %v", err, syserror.ENOENT)
+	}
 }
 
-// TestTree iterates all directories and stats every file.
-func TestTree(t *testing.T) {
+func TestTaskFDInfo(t *testing.T) {
 	s := setup(t)
 	defer s.Destroy()
 
 	k := kernel.KernelFromContext(s.Ctx)
-	var tasks []*kernel.Task
-	for i := 0; i < 5; i++ {
-		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
-		task, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc)
-		if err != nil {
-			t.Fatalf("CreateTask(): %v", err)
-		}
-		tasks = append(tasks, task)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
 	}
 
-	ctx := tasks[0]
-	fd, err := s.VFS.OpenAt(
-		ctx,
-		auth.CredentialsFromContext(s.Ctx),
-		&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse("/")},
-		&vfs.OpenOptions{},
-	)
+	statusFD, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/status"), &vfs.OpenOptions{Flags: linux.O_RDONLY})
 	if err != nil {
-		t.Fatalf("vfsfs.OpenAt(/) failed: %v", err)
+		t.Fatalf("vfsfs.OpenAt(/1/status) failed: %v", err)
+	}
+	defer statusFD.DecRef()
+	buf := make([]byte, 10)
+	if _, err := statusFD.Read(s.Ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{}); err != nil {
+		t.Fatalf("Read(/1/status) failed: %v", err)
+	}
+	if err := task.FDTable().NewFDAtVFS2(s.Ctx, 3, statusFD, kernel.FDFlags{CloseOnExec: true}); err != nil {
+		t.Fatalf("NewFDAtVFS2(3): %v", err)
+	}
+
+	collector := s.ListDirents(s.PathOpAtRoot("/1/fdinfo"))
+	s.AssertAllDirentTypes(collector, map[string]testutil.DirentType{
+		"3": linux.DT_REG,
+	})
+
+	want := fmt.Sprintf("pos:\t10\nflags:\t0%o\nmnt_id:\t%d\n", linux.O_RDONLY|linux.O_LARGEFILE|linux.O_CLOEXEC, statusFD.Mount().ID)
+	if got := readFile(t, s, "/1/fdinfo/3"); got != want {
+		t.Errorf("/1/fdinfo/3 = %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"4", "-1", "foo"} {
+		path := "/1/fdinfo/" + name
+		if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{}); err != syserror.ENOENT {
+			t.Errorf("vfsfs.OpenAt(%s): got error %v, want %v", path, err, syserror.ENOENT)
+		}
+	}
+
+	// A file reporting on itself must not deadlock.
+	infoFD, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/fdinfo/3"), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(/1/fdinfo/3) failed: %v", err)
+	}
+	defer infoFD.DecRef()
+	if err := task.FDTable().NewFDAtVFS2(s.Ctx, 3, infoFD, kernel.FDFlags{}); err != nil {
+		t.Fatalf("NewFDAtVFS2(3): %v", err)
+	}
+	got, err := s.ReadToEnd(infoFD)
+	if err != nil {
+		t.Fatalf("Read(/1/fdinfo/3) failed: %v", err)
+	}
+	want = fmt.Sprintf("pos:\t0\nflags:\t0%o\nmnt_id:\t%d\n", linux.O_RDONLY|linux.O_LARGEFILE, infoFD.Mount().ID)
+	if got != want {
+		t.Errorf("/1/fdinfo/3 = %q, want %q", got, want)
+	}
+
+	// Once the fd is closed, its file must disappear.
+	if _, file := task.FDTable().Remove(3); file != nil {
+		file.DecRef()
+	}
+	if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/fdinfo/3"), &vfs.OpenOptions{}); err != syserror.ENOENT {
+		t.Errorf("vfsfs.OpenAt(/1/fdinfo/3) after close: got error %v, want %v", err, syserror.ENOENT)
+	}
+}
+
+func TestTaskFDOffsets(t *testing.T) {
+	for _, dir := range []string{"/1/fd", "/1/fdinfo"} {
+		t.Run(dir, func(t *testing.T) {
+			s := setup(t)
+			defer s.Destroy()
+
+			k := kernel.KernelFromContext(s.Ctx)
+			tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+			task, err := testutil.CreateTask(s.Ctx, "name", tc)
+			if err != nil {
+				t.Fatalf("CreateTask(): %v", err)
+			}
+			statusFD, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/status"), &vfs.OpenOptions{})
+			if err != nil {
+				t.Fatalf("vfsfs.OpenAt(/1/status) failed: %v", err)
+			}
+			defer statusFD.DecRef()
+			for _, fd := range []int32{0, 1, 3, 5} {
+				if err := task.FDTable().NewFDAtVFS2(s.Ctx, fd, statusFD, kernel.FDFlags{}); err != nil {
+					t.Fatalf("NewFDAtVFS2(%d): %v", fd, err)
+				}
+			}
+
+			// Every fd is listed at an offset derived from it, with the
+			// inode number reported by stat.
+			offsets := map[string]int64{"0": 3, "1": 4, "3": 6, "5": 8}
+			collector := s.ListDirents(s.PathOpAtRoot(dir))
+			s.AssertDirentOffsets(collector, offsets)
+			for name, dirent := range collector.Dirents() {
+				if name == "." || name == ".." {
+					continue
+				}
+				path := dir + "/" + name
+				for i := 0; i < 2; i++ {
+					stat, err := s.VFS.StatAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.StatOptions{})
+					if err != nil {
+						t.Fatalf("StatAt(%s) failed: %v", path, err)
+					}
+					if stat.Ino != dirent.Ino {
+						t.Errorf("StatAt(%s) got inode %d, want %d as listed", path, stat.Ino, dirent.Ino)
+					}
+				}
+			}
+
+			fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(dir), &vfs.OpenOptions{})
+			if err != nil {
+				t.Fatalf("vfsfs.OpenAt(%s) failed: %v", dir, err)
+			}
+			defer fd.DecRef()
+
+			// Fds closed between reads are neither repeated nor skipped
+			// over, whether they were listed already or not.
+			var got []string
+			for {
+				c := limitedCollector{limit: 1}
+				if err := fd.IterDirents(s.Ctx, &c); err != nil {
+					t.Fatalf("IterDirents(): %v", err)
+				}
+				if len(c.dirents) == 0 {
+					break
+				}
+				got = append(got, c.dirents[0].Name)
+				if c.dirents[0].Name == "1" {
+					for _, closed := range []int32{1, 3} {
+						if _, file := task.FDTable().Remove(closed); file != nil {
+							file.DecRef()
+						}
+					}
+				}
+			}
+			if want := []string{".", "..", "0", "1", "5"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s read one entry at a time = %v, want %v", dir, got, want)
+			}
+
+			// Seeking to the offset reported after an fd resumes right
+			// after it.
+			if _, err := fd.Seek(s.Ctx, offsets["0"], linux.SEEK_SET); err != nil {
+				t.Fatalf("Seek(%d, SEEK_SET): %v", offsets["0"], err)
+			}
+			var rest testutil.DirentCollector
+			rest.SkipDotsChecks(true)
+			if err := fd.IterDirents(s.Ctx, &rest); err != nil {
+				t.Fatalf("IterDirents(): %v", err)
+			}
+			got = nil
+			for _, d := range rest.OrderedDirents() {
+				got = append(got, d.Name)
+			}
+			if want := []string{"5"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s after seeking past 0 = %v, want %v", dir, got, want)
+			}
+		})
+	}
+}
+
+func TestTaskFDInfoEpoll(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+
+	epfd, err := s.VFS.NewEpollInstanceFD()
+	if err != nil {
+		t.Fatalf("NewEpollInstanceFD(): %v", err)
+	}
+	defer epfd.DecRef()
+	if err := task.FDTable().NewFDAtVFS2(s.Ctx, 3, epfd, kernel.FDFlags{}); err != nil {
+		t.Fatalf("NewFDAtVFS2(3): %v", err)
+	}
+	ep := epfd.Impl().(*vfs.EpollInstance)
+
+	// The watched files are listed in file descriptor order, whatever the
+	// order in which they were added.
+	var want strings.Builder
+	fmt.Fprintf(&want, "pos:\t0\nflags:\t0%o\nmnt_id:\t%d\n", linux.O_RDWR|linux.O_LARGEFILE, epfd.Mount().ID)
+	for _, w := range []struct {
+		path     string
+		num      int32
+		mask     uint32
+		userData [2]int32
+		data     uint64
+		pos      int64
+	}{
+		{path: "/1/stat", num: 4, mask: linux.EPOLLOUT | linux.EPOLLET, userData: [2]int32{-1, 0}, data: 0xffffffff},
+		{path: "/1/status", num: 5, mask: linux.EPOLLIN, userData: [2]int32{1, 2}, data: 0x200000001, pos: 10},
+	} {
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(w.path), &vfs.OpenOptions{Flags: linux.O_RDONLY})
+		if err != nil {
+			t.Fatalf("vfsfs.OpenAt(%s) failed: %v", w.path, err)
+		}
+		defer fd.DecRef()
+		if w.pos > 0 {
+			if _, err := fd.Read(s.Ctx, usermem.BytesIOSequence(make([]byte, w.pos)), vfs.ReadOptions{}); err != nil {
+				t.Fatalf("Read(%s) failed: %v", w.path, err)
+			}
+		}
+		if err := ep.AddInterest(fd, w.num, w.mask, w.userData); err != nil {
+			t.Fatalf("AddInterest(%s): %v", w.path, err)
+		}
+		defer ep.DeleteInterest(fd, w.num)
+		stat, err := fd.Stat(s.Ctx, vfs.StatOptions{})
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", w.path, err)
+		}
+		// Errors and hangups are always reported.
+		events := w.mask | linux.EPOLLERR | linux.EPOLLRDHUP
+		fmt.Fprintf(&want, "tfd: %8d events: %8x data: %16x  pos:%d ino:%x sdev:%x\n", w.num, events, w.data, w.pos, stat.Ino, stat.DevMajor<<20|stat.DevMinor)
+	}
+	if got := readFile(t, s, "/1/fdinfo/3"); got != want.String() {
+		t.Errorf("/1/fdinfo/3 = %q, want %q", got, want.String())
+	}
+}
+
+func TestTaskFDInfoChurn(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	open := func(path string, flags uint32) *vfs.FileDescription {
+		t.Helper()
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{Flags: flags})
+		if err != nil {
+			t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+		}
+		return fd
+	}
+	install := func(fd int32, file *vfs.FileDescription) {
+		t.Helper()
+		if err := task.FDTable().NewFDAtVFS2(s.Ctx, fd, file, kernel.FDFlags{}); err != nil {
+			t.Fatalf("NewFDAtVFS2(%d): %v", fd, err)
+		}
+		file.DecRef()
+	}
+	remove := func(fd int32) {
+		if _, file := task.FDTable().Remove(fd); file != nil {
+			file.DecRef()
+		}
+	}
+	flags := func(path string) string {
+		t.Helper()
+		for _, line := range strings.Split(readFile(t, s, path), "\n") {
+			if strings.HasPrefix(line, "flags:\t") {
+				return strings.TrimPrefix(line, "flags:\t")
+			}
+		}
+		t.Fatalf("%s has no flags line", path)
+		return ""
+	}
+
+	install(0, open("/1/status", linux.O_RDONLY))
+	install(1, open("/1/status", linux.O_RDONLY))
+	s.AssertAllDirentTypes(s.ListDirents(s.PathOpAtRoot("/1/fdinfo")), map[string]testutil.DirentType{
+		"0": linux.DT_REG,
+		"1": linux.DT_REG,
+	})
+
+	// Open fdinfo files report on the fd, not on the file it held when they
+	// were opened.
+	info := open("/1/fdinfo/1", linux.O_RDONLY)
+	defer info.DecRef()
+	remove(1)
+	install(1, open("/1/uid_map", linux.O_WRONLY))
+	if got, want := flags("/1/fdinfo/1"), fmt.Sprintf("0%o", linux.O_WRONLY|linux.O_LARGEFILE); got != want {
+		t.Errorf("flags of /1/fdinfo/1 after reuse = %s, want %s", got, want)
+	}
+	s.AssertAllDirentTypes(s.ListDirents(s.PathOpAtRoot("/1/fdinfo")), map[string]testutil.DirentType{
+		"0": linux.DT_REG,
+		"1": linux.DT_REG,
+	})
+
+	// Closed fds disappear, and fdinfo files opened before they were closed
+	// fail to read rather than reporting stale data.
+	remove(1)
+	s.AssertAllDirentTypes(s.ListDirents(s.PathOpAtRoot("/1/fdinfo")), map[string]testutil.DirentType{
+		"0": linux.DT_REG,
+	})
+	if _, err := info.Read(s.Ctx, usermem.BytesIOSequence(make([]byte, 100)), vfs.ReadOptions{}); err != syserror.ENOENT {
+		t.Errorf("Read(/1/fdinfo/1) after close: got error %v, want %v", err, syserror.ENOENT)
+	}
+	if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/1/fdinfo/1"), &vfs.OpenOptions{}); err != syserror.ENOENT {
+		t.Errorf("vfsfs.OpenAt(/1/fdinfo/1) after close: got error %v, want %v", err, syserror.ENOENT)
+	}
+}
+
+// readStatus returns the fields of the /proc/[pid]/status file at path, keyed
+// by name.
+func readStatus(t *testing.T, s *testutil.System, path string) map[string]string {
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+	}
+	defer fd.DecRef()
+	data, err := s.ReadToEnd(fd)
+	if err != nil {
+		t.Fatalf("Read(%s) failed: %v", path, err)
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		kv := strings.SplitN(line, ":\t", 2)
+		if len(kv) != 2 {
+			t.Fatalf("malformed line %q in %s", line, path)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return fields
+}
+
+func TestTaskStatusIDs(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	var tasks []*kernel.Task
+	for i := 0; i < 2; i++ {
+		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		task, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	tracee, tracer := tasks[0], tasks[1]
+	traceeID := k.RootPIDNamespace().IDOfTask(tracee)
+	tracerID := k.RootPIDNamespace().IDOfTask(tracer)
+	path := fmt.Sprintf("/%d/status", traceeID)
+
+	want := map[string]string{
+		"Tgid":      strconv.Itoa(int(traceeID)),
+		"Ngid":      "0",
+		"Pid":       strconv.Itoa(int(traceeID)),
+		"PPid":      "0",
+		"TracerPid": "0",
+	}
+	check := func() {
+		fields := readStatus(t, s, path)
+		for name, value := range want {
+			if got, ok := fields[name]; !ok {
+				t.Errorf("%s is missing %q", path, name)
+			} else if got != value {
+				t.Errorf("%s: %s = %q, want %q", path, name, got, value)
+			}
+		}
+	}
+	check()
+
+	if err := tracer.Ptrace(linux.PTRACE_SEIZE, traceeID, 0, 0); err != nil {
+		t.Fatalf("Ptrace(PTRACE_SEIZE, %d): %v", traceeID, err)
+	}
+	want["TracerPid"] = strconv.Itoa(int(tracerID))
+	check()
+}
+
+// procFilesystem returns the procfs instance mounted at s.Root.
+func procFilesystem(s *testutil.System) *filesystem {
+	return s.Root.Mount().Filesystem().Impl().(*filesystem)
+}
+
+func TestTaskDentriesTrimmed(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	fs := procFilesystem(s)
+	baseline := fs.Stats(fs.root, false /* estimateSize */)
+
+	k := kernel.KernelFromContext(s.Ctx)
+	const numTasks = 10
+	for i := 0; i < numTasks; i++ {
+		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		task, err := testutil.CreateTask(s.Ctx, fmt.Sprintf("name-%d", i), tc)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		readStatus(t, s, fmt.Sprintf("/%d/status", k.RootPIDNamespace().IDOfTask(task)))
+	}
+
+	// Keep one task directory in use, it must survive trimming.
+	vd := s.GetDentryOrDie(s.PathOpAtRoot("/1"))
+
+	grown := fs.Stats(fs.root, true /* estimateSize */)
+	if grown.Dentries < baseline.Dentries+numTasks {
+		t.Errorf("Stats().Dentries = %d after looking up %d tasks, want at least %d", grown.Dentries, numTasks, baseline.Dentries+numTasks)
+	}
+	if grown.Inodes <= baseline.Inodes {
+		t.Errorf("Stats().Inodes = %d after looking up %d tasks, want more than %d", grown.Inodes, numTasks, baseline.Inodes)
+	}
+	if grown.SizeEstimate == 0 {
+		t.Errorf("Stats(estimateSize=true).SizeEstimate = 0, want > 0")
+	}
+	stats, ok := k.CacheStats()[fs.debugName]
+	if !ok {
+		t.Fatalf("Kernel.CacheStats() is missing %q", fs.debugName)
+	}
+	if want := fmt.Sprintf("dentries %d ", grown.Dentries); !strings.HasPrefix(stats, want) {
+		t.Errorf("Kernel.CacheStats()[%q] = %q, want prefix %q", fs.debugName, stats, want)
+	}
+
+	if trimmed := k.TrimCaches(); trimmed == 0 {
+		t.Errorf("Kernel.TrimCaches() = 0, want > 0")
+	}
+	readStatus(t, s, "/1/status")
+	vd.DecRef()
+
+	// Once released, the last task directory is trimmed as well.
+	fs.Filesystem.TrimCache(fs.root)
+	if got := fs.Stats(fs.root, false /* estimateSize */); !reflect.DeepEqual(got, baseline) {
+		t.Errorf("Stats() after trim = %+v, want %+v", got, baseline)
+	}
+}
+
+func iterateDir(ctx context.Context, t *testing.T, s *testutil.System, fd *vfs.FileDescription) {
+	t.Logf("Iterating: /proc%s", fd.MappedName(ctx))
+
+	var collector testutil.DirentCollector
+	if err := fd.IterDirents(ctx, &collector); err != nil {
+		t.Fatalf("IterDirents(): %v", err)
+	}
+	if err := collector.Contains(".", linux.DT_DIR); err != nil {
+		t.Error(err.Error())
+	}
+	if err := collector.Contains("..", linux.DT_DIR); err != nil {
+		t.Error(err.Error())
+	}
+
+	for _, d := range collector.Dirents() {
+		if d.Name == "." || d.Name == ".." {
+			continue
+		}
+		childPath := path.Join(fd.MappedName(ctx), d.Name)
+		if d.Type == linux.DT_LNK {
+			link, err := s.VFS.ReadlinkAt(
+				ctx,
+				auth.CredentialsFromContext(ctx),
+				&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(childPath)},
+			)
+			if err != nil {
+				t.Errorf("vfsfs.ReadlinkAt(%v) failed: %v", childPath, err)
+			} else {
+				t.Logf("Skipping symlink: /proc%s => %s", childPath, link)
+			}
+			continue
+		}
+
+		t.Logf("Opening: /proc%s", childPath)
+		child, err := s.VFS.OpenAt(
+			ctx,
+			auth.CredentialsFromContext(ctx),
+			&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(childPath)},
+			&vfs.OpenOptions{},
+		)
+		if err != nil {
+			t.Errorf("vfsfs.OpenAt(%v) failed: %v", childPath, err)
+			continue
+		}
+		stat, err := child.Stat(ctx, vfs.StatOptions{})
+		if err != nil {
+			t.Errorf("Stat(%v) failed: %v", childPath, err)
+		}
+		if got := linux.FileMode(stat.Mode).DirentType(); got != d.Type {
+			t.Errorf("wrong file mode, stat: %v, dirent: %v", got, d.Type)
+		}
+		if d.Type == linux.DT_DIR {
+			// Found another dir, let's do it again!
+			iterateDir(ctx, t, s, child)
+		}
+	}
+}
+
+// TestTree iterates all directories and stats every file.
+func TestTree(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	var tasks []*kernel.Task
+	for i := 0; i < 5; i++ {
+		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		// The tasks need an FSContext and an executable for their cwd, exe
+		// and root links to be read.
+		fsc := kernel.NewFSContextVFS2(s.Root, s.Root, 0022)
+		defer fsc.DecRef()
+		task := createTaskWithFSContext(t, s, fmt.Sprintf("name-%d", i), tc, fsc)
+		exe := s.GetDentryOrDie(s.PathOpAtRoot("/cpuinfo"))
+		task.MemoryManager().SetExecutableVFS2(exe)
+		exe.DecRef()
+		tasks = append(tasks, task)
+	}
+
+	ctx := tasks[0]
+	fd, err := s.VFS.OpenAt(
+		ctx,
+		auth.CredentialsFromContext(s.Ctx),
+		&vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse("/")},
+		&vfs.OpenOptions{},
+	)
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(/) failed: %v", err)
+	}
+	iterateDir(ctx, t, s, fd)
+}
+
+// readFile returns the contents of the file at path.
+func readFile(t *testing.T, s *testutil.System, path string) string {
+	data, err := s.ReadFile(s.PathOpAtRoot(path))
+	if err != nil {
+		t.Fatalf("ReadFile(%s) failed: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestVersion(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	// /proc/version is generated from the syscall table of init.
+	k := kernel.KernelFromContext(s.Ctx)
+	init, err := testutil.CreateTask(s.Ctx, "init", k.GlobalInit())
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	init.TestOnly_SetSyscallTable(&kernel.SyscallTable{
+		Version: kernel.Version{
+			Sysname: "Linux",
+			Release: "4.4.0",
+			Version: "#1 SMP Sun Jan 10 15:06:54 PST 2016",
+		},
+	})
+
+	got, err := s.ReadFile(s.PathOpAtRoot("/version"))
+	if err != nil {
+		t.Fatalf("ReadFile(/version) failed: %v", err)
+	}
+	if want := "Linux version 4.4.0 #1 SMP Sun Jan 10 15:06:54 PST 2016\n"; string(got) != want {
+		t.Errorf("got /version = %q, want = %q", got, want)
+	}
+}
+
+func TestUptime(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(1e9, 0))
+	s := setupWithOptions(t, &InternalData{}, testutil.BootOptions{Clock: clock})
+	defer s.Destroy()
+
+	if got, want := readFile(t, s, "/uptime"), "0.00 0.00\n"; got != want {
+		t.Errorf("got /uptime = %q, want = %q", got, want)
+	}
+	clock.Advance(90*time.Second + 500*time.Millisecond)
+	if got, want := readFile(t, s, "/uptime"), "90.50 0.00\n"; got != want {
+		t.Errorf("got /uptime = %q after advancing the clock, want = %q", got, want)
+	}
+}
+
+// TestFakeClockTimers tests that kernel timers fire when the fake clock
+// installed by testutil.BootWithOptions is advanced, without waiting for the
+// host's clock.
+func TestFakeClockTimers(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(1e9, 0))
+	s := setupWithOptions(t, &InternalData{}, testutil.BootOptions{Clock: clock})
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	timer, _, expired := ktime.After(k.MonotonicClock(), time.Hour)
+	defer timer.Destroy()
+
+	clock.Advance(time.Hour)
+	select {
+	case <-expired:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timer didn't fire after advancing the clock past its expiration")
+	}
+}
+
+// linuxStatusFields lists the fields of /proc/[pid]/status in the order they
+// are emitted by Linux 6.x's fs/proc/array.go:proc_pid_status() on x86.
+// Core_scheduling_cookie isn't emitted by Linux; it is listed with the other
+// per-task scheduling and security state where parsers expect it.
+var linuxStatusFields = []string{
+	"Name", "Umask", "State", "Tgid", "Ngid", "Pid", "PPid", "TracerPid",
+	"Uid", "Gid", "FDSize", "Groups", "NStgid", "NSpid", "NSpgid", "NSsid",
+	"Kthread", "VmPeak", "VmSize", "VmLck", "VmPin", "VmHWM", "VmRSS",
+	"RssAnon", "RssFile", "RssShmem", "VmData", "VmStk", "VmExe", "VmLib",
+	"VmPTE", "VmSwap", "HugetlbPages", "CoreDumping", "THP_enabled",
+	"untag_mask", "Threads", "SigQ", "SigPnd", "ShdPnd", "SigBlk", "SigIgn",
+	"SigCgt", "CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb", "NoNewPrivs",
+	"Seccomp", "Seccomp_filters", "Speculation_Store_Bypass",
+	"SpeculationIndirectBranch", "Core_scheduling_cookie", "Cpus_allowed",
+	"Cpus_allowed_list", "Mems_allowed", "Mems_allowed_list",
+	"voluntary_ctxt_switches", "nonvoluntary_ctxt_switches",
+	"x86_Thread_features", "x86_Thread_features_locked",
+}
+
+// createStatusTask creates a task and returns its ID in the root PID
+// namespace.
+func createStatusTask(t *testing.T, s *testutil.System) kernel.ThreadID {
+	k := kernel.KernelFromContext(s.Ctx)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	return k.RootPIDNamespace().IDOfTask(task)
+}
+
+func TestTaskStatusFields(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+	path := fmt.Sprintf("/%d/status", createStatusTask(t, s))
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(readFile(t, s, path), "\n"), "\n") {
+		got = append(got, strings.SplitN(line, ":\t", 2)[0])
+	}
+	want := []string{
+		"Name", "State", "Tgid", "Ngid", "Pid", "PPid", "TracerPid", "Uid",
+		"Gid", "FDSize", "VmPeak", "VmSize", "VmRSS", "VmData", "VmStk",
+		"THP_enabled", "Threads", "SigQ", "SigPnd", "ShdPnd", "SigBlk",
+		"SigIgn", "SigCgt", "CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb",
+		"Seccomp", "Speculation_Store_Bypass", "Core_scheduling_cookie",
+		"Cpus_allowed", "Cpus_allowed_list", "Mems_allowed", "Mems_allowed_list",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s fields = %v, want %v", path, got, want)
+	}
+
+	// Parsers depend on the relative order of fields, so it must match
+	// Linux's.
+	i := 0
+	for _, name := range got {
+		for i < len(linuxStatusFields) && linuxStatusFields[i] != name {
+			i++
+		}
+		if i == len(linuxStatusFields) {
+			t.Errorf("%s field %q is out of order or unknown, want fields ordered as %v", path, name, linuxStatusFields)
+			break
+		}
+	}
+
+	fields := readStatus(t, s, path)
+	for name, value := range map[string]string{
+		"THP_enabled":              "0",
+		"CapAmb":                   "0000000000000000",
+		"Speculation_Store_Bypass": DefaultSpeculationStoreBypass,
+		"Core_scheduling_cookie":   "0",
+	} {
+		if got := fields[name]; got != value {
+			t.Errorf("%s: %s = %q, want %q", path, name, got, value)
+		}
+	}
+}
+
+func TestTaskStatusSpeculationStoreBypass(t *testing.T) {
+	const want = "thread force mitigated"
+	s := setupWithData(t, &InternalData{SpeculationStoreBypass: want})
+	defer s.Destroy()
+	tid := createStatusTask(t, s)
+
+	for _, path := range []string{fmt.Sprintf("/%d/status", tid), fmt.Sprintf("/%d/task/%d/status", tid, tid)} {
+		if got := readStatus(t, s, path)["Speculation_Store_Bypass"]; got != want {
+			t.Errorf("%s: Speculation_Store_Bypass = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestTaskStatusValues(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	task, m, addr := createTaskWithMM(t, s, 4*usermem.PageSize)
+	path := fmt.Sprintf("/%d/status", k.RootPIDNamespace().IDOfTask(task))
+
+	// The task goroutine isn't running, so the test stands in for it. GIDs
+	// are changed first, since changing UIDs drops CAP_SETGID.
+	if err := task.SetRESGID(4, 5, 6); err != nil {
+		t.Fatalf("SetRESGID(): %v", err)
+	}
+	if err := task.SetRESUID(1, 2, 3); err != nil {
+		t.Fatalf("SetRESUID(): %v", err)
+	}
+	task.SetSignalMask(linux.SignalSetOf(linux.SIGUSR1) | linux.SignalSetOf(linux.SIGUSR2))
+	if err := task.SendSignal(&arch.SignalInfo{Signo: int32(linux.SIGUSR1)}); err != nil {
+		t.Fatalf("SendSignal(SIGUSR1): %v", err)
+	}
+	if err := task.SendGroupSignal(&arch.SignalInfo{Signo: int32(linux.SIGUSR2)}); err != nil {
+		t.Fatalf("SendGroupSignal(SIGUSR2): %v", err)
+	}
+	for sig, handler := range map[linux.Signal]uint64{
+		linux.SIGINT:  arch.SignalActIgnore,
+		linux.SIGTERM: 0x1000,
+	} {
+		if _, err := task.ThreadGroup().SetSignalAct(sig, &arch.SignalAct{Handler: handler}); err != nil {
+			t.Fatalf("SetSignalAct(%v): %v", sig, err)
+		}
+	}
+	// Unmapping lowers VmSize, but not VmPeak.
+	if err := m.MUnmap(s.Ctx, addr, 2*usermem.PageSize); err != nil {
+		t.Fatalf("MUnmap(): %v", err)
+	}
+
+	sigpending := task.ThreadGroup().Limits().Get(limits.SignalsPending).Cur
+	fields := readStatus(t, s, path)
+	for name, want := range map[string]string{
+		"Uid":    "1\t2\t3\t2",
+		"Gid":    "4\t5\t6\t5",
+		"VmPeak": fmt.Sprintf("%d kB", (m.VirtualMemorySize()+2*usermem.PageSize)>>10),
+		"VmSize": fmt.Sprintf("%d kB", m.VirtualMemorySize()>>10),
+		"SigQ":   fmt.Sprintf("2/%d", sigpending),
+		"SigPnd": fmt.Sprintf("%016x", uint64(linux.SignalSetOf(linux.SIGUSR1))),
+		"ShdPnd": fmt.Sprintf("%016x", uint64(linux.SignalSetOf(linux.SIGUSR2))),
+		"SigIgn": fmt.Sprintf("%016x", uint64(linux.SignalSetOf(linux.SIGINT))),
+		"SigCgt": fmt.Sprintf("%016x", uint64(linux.SignalSetOf(linux.SIGTERM))),
+	} {
+		if got := fields[name]; got != want {
+			t.Errorf("%s: %s = %q, want %q", path, name, got, want)
+		}
+	}
+
+	// IDs are reported in the reader's user namespace. The child namespace
+	// has no mappings, so every ID overflows.
+	childNS, err := auth.NewRootCredentials(k.RootUserNamespace()).NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace(): %v", err)
+	}
+	creds := auth.NewUserCredentials(auth.RootKUID, auth.RootKGID, nil, nil, childNS)
+	data := readFileAs(t, s, creds, path)
+	for _, want := range []string{
+		fmt.Sprintf("Uid:\t%d\t%d\t%d\t%d\n", auth.OverflowUID, auth.OverflowUID, auth.OverflowUID, auth.OverflowUID),
+		fmt.Sprintf("Gid:\t%d\t%d\t%d\t%d\n", auth.OverflowGID, auth.OverflowGID, auth.OverflowGID, auth.OverflowGID),
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("%s read from a child user namespace = %q, want line %q", path, data, want)
+		}
+	}
+}
+
+func TestCPUMaskString(t *testing.T) {
+	for _, tc := range []struct {
+		numCPUs  uint
+		cpus     []uint
+		wantMask string
+		wantList string
+	}{
+		{numCPUs: 1, cpus: []uint{0}, wantMask: "1", wantList: "0"},
+		{numCPUs: 8, cpus: []uint{0, 1, 2, 3, 4, 5, 6, 7}, wantMask: "ff", wantList: "0-7"},
+		{numCPUs: 8, cpus: []uint{0, 1, 2, 3, 6}, wantMask: "4f", wantList: "0-3,6"},
+		{numCPUs: 32, cpus: []uint{31}, wantMask: "80000000", wantList: "31"},
+		{numCPUs: 40, cpus: []uint{1, 32, 33, 39}, wantMask: "83,00000002", wantList: "1,32-33,39"},
+	} {
+		mask := sched.NewCPUSet(tc.numCPUs)
+		for _, cpu := range tc.cpus {
+			mask.Set(cpu)
+		}
+		if got := cpuMaskString(mask, tc.numCPUs); got != tc.wantMask {
+			t.Errorf("cpuMaskString(%v, %d) = %q, want %q", tc.cpus, tc.numCPUs, got, tc.wantMask)
+		}
+		if got := cpuListString(mask, tc.numCPUs); got != tc.wantList {
+			t.Errorf("cpuListString(%v, %d) = %q, want %q", tc.cpus, tc.numCPUs, got, tc.wantList)
+		}
+	}
+}
+
+func TestTaskTracedFilesAccess(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+	tid := createStatusTask(t, s)
+
+	// Create a reader that can't trace the task: it's in another thread group
+	// and doesn't share the task's credentials.
+	k := kernel.KernelFromContext(s.Ctx)
+	creds := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	reader, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, creds), "reader", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+
+	for _, name := range []string{"auxv", "environ"} {
+		for _, path := range []string{fmt.Sprintf("/%d/%s", tid, name), fmt.Sprintf("/%d/task/%d/%s", tid, tid, name)} {
+			if _, err := s.VFS.OpenAt(reader, creds, s.PathOpAtRoot(path), &vfs.OpenOptions{}); err != syserror.EACCES {
+				t.Errorf("OpenAt(%q) by unauthorized reader got error: %v, want: %v", path, err, syserror.EACCES)
+			}
+
+			fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{})
+			if err != nil {
+				t.Errorf("OpenAt(%q) by supervisor failed: %v", path, err)
+				continue
+			}
+			fd.DecRef()
+		}
+	}
+
+	// Files that don't require ptrace access can still be opened.
+	path := fmt.Sprintf("/%d/cmdline", tid)
+	fd, err := s.VFS.OpenAt(reader, creds, s.PathOpAtRoot(path), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("OpenAt(%q) by unauthorized reader failed: %v", path, err)
+	}
+	fd.DecRef()
+}
+
+// createTaskWithMM creates a task with an address space in which length bytes
+// are mapped at the returned address.
+func createTaskWithMM(t *testing.T, s *testutil.System, length uint64) (*kernel.Task, *mm.MemoryManager, usermem.Addr) {
+	k := kernel.KernelFromContext(s.Ctx)
+	m := mm.NewMemoryManager(k, k)
+	if _, err := m.SetMmapLayout(arch.New(arch.Host, k.FeatureSet()), k.GlobalInit().Limits()); err != nil {
+		t.Fatalf("SetMmapLayout(): %v", err)
+	}
+	addr, err := m.MMap(s.Ctx, memmap.MMapOpts{
+		Length:   length,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap(): %v", err)
+	}
+
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := k.TaskSet().NewTask(&kernel.TaskConfig{
+		Kernel:                  k,
+		ThreadGroup:             tc,
+		TaskContext:             &kernel.TaskContext{Name: "name", MemoryManager: m},
+		Credentials:             auth.CredentialsFromContext(s.Ctx),
+		FDTable:                 k.NewFDTable(),
+		AllowedCPUMask:          sched.NewFullCPUSet(k.ApplicationCores()),
+		UTSNamespace:            kernel.UTSNamespaceFromContext(s.Ctx),
+		IPCNamespace:            kernel.IPCNamespaceFromContext(s.Ctx),
+		AbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
+	})
+	if err != nil {
+		t.Fatalf("NewTask(): %v", err)
+	}
+	return task, m, addr
+}
+
+// openTaskMem opens /proc/[pid]/mem of task for reading and writing.
+func openTaskMem(t *testing.T, s *testutil.System, task *kernel.Task) *vfs.FileDescription {
+	t.Helper()
+	path := fmt.Sprintf("/%d/mem", kernel.KernelFromContext(s.Ctx).RootPIDNamespace().IDOfTask(task))
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{Flags: linux.O_RDWR})
+	if err != nil {
+		t.Fatalf("OpenAt(%s): %v", path, err)
+	}
+	return fd
+}
+
+// TestTaskMemHole checks that reads and writes of /proc/[pid]/mem stop at
+// unmapped addresses, and succeed if they transferred any bytes.
+func TestTaskMemHole(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	task, m, addr := createTaskWithMM(t, s, 3*usermem.PageSize)
+	want := bytes.Repeat([]byte("mem"), usermem.PageSize)
+	if _, err := m.CopyOut(s.Ctx, addr, want, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut(): %v", err)
+	}
+	hole := addr + usermem.PageSize
+	if err := m.MUnmap(s.Ctx, hole, usermem.PageSize); err != nil {
+		t.Fatalf("MUnmap(): %v", err)
+	}
+	fd := openTaskMem(t, s, task)
+	defer fd.DecRef()
+
+	// Reads and writes crossing into the hole are partial.
+	got := make([]byte, 3*usermem.PageSize)
+	if n, err := fd.PRead(s.Ctx, usermem.BytesIOSequence(got), int64(addr), vfs.ReadOptions{}); n != usermem.PageSize || err != nil {
+		t.Errorf("PRead(3 pages) = %d, %v, want %d, nil", n, err, usermem.PageSize)
+	}
+	if !bytes.Equal(got[:usermem.PageSize], want[:usermem.PageSize]) {
+		t.Errorf("PRead(3 pages) read %q, want %q", got[:usermem.PageSize], want[:usermem.PageSize])
+	}
+	data := bytes.Repeat([]byte("x"), 2*usermem.PageSize)
+	if n, err := fd.PWrite(s.Ctx, usermem.BytesIOSequence(data), int64(hole-16), vfs.WriteOptions{}); n != 16 || err != nil {
+		t.Errorf("PWrite(2 pages) = %d, %v, want 16, nil", n, err)
+	}
+	tail := make([]byte, 16)
+	if _, err := m.CopyIn(s.Ctx, hole-16, tail, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyIn(): %v", err)
+	}
+	if !bytes.Equal(tail, data[:16]) {
+		t.Errorf("memory before the hole is %q, want %q", tail, data[:16])
+	}
+
+	// Reads and writes starting in the hole fail.
+	if n, err := fd.PRead(s.Ctx, usermem.BytesIOSequence(got), int64(hole), vfs.ReadOptions{}); err != syserror.EIO {
+		t.Errorf("PRead(hole) = %d, %v, want error %v", n, err, syserror.EIO)
+	}
+	if n, err := fd.PWrite(s.Ctx, usermem.BytesIOSequence(data), int64(hole), vfs.WriteOptions{}); err != syserror.EIO {
+		t.Errorf("PWrite(hole) = %d, %v, want error %v", n, err, syserror.EIO)
+	}
+
+	// Reads after the hole succeed, and advance the offset.
+	if _, err := fd.Seek(s.Ctx, int64(hole+usermem.PageSize), linux.SEEK_SET); err != nil {
+		t.Fatalf("Seek(): %v", err)
+	}
+	if n, err := fd.Read(s.Ctx, usermem.BytesIOSequence(got[:usermem.PageSize]), vfs.ReadOptions{}); n != usermem.PageSize || err != nil {
+		t.Errorf("Read(page after hole) = %d, %v, want %d, nil", n, err, usermem.PageSize)
+	}
+	if off, err := fd.Seek(s.Ctx, 0, linux.SEEK_CUR); off != int64(hole+2*usermem.PageSize) || err != nil {
+		t.Errorf("Seek(0, SEEK_CUR) = %d, %v, want %d, nil", off, err, hole+2*usermem.PageSize)
+	}
+}
+
+// TestTaskMemConcurrentUnmap checks that reads of /proc/[pid]/mem return a
+// consistent prefix while the task's memory is unmapped and remapped.
+func TestTaskMemConcurrentUnmap(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	task, m, addr := createTaskWithMM(t, s, 2*usermem.PageSize)
+	fd := openTaskMem(t, s, task)
+	defer fd.DecRef()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := m.MUnmap(s.Ctx, addr+usermem.PageSize, usermem.PageSize); err != nil {
+				t.Errorf("MUnmap(): %v", err)
+				return
+			}
+			if _, err := m.MMap(s.Ctx, memmap.MMapOpts{
+				Length:   usermem.PageSize,
+				Addr:     addr + usermem.PageSize,
+				Fixed:    true,
+				Private:  true,
+				Perms:    usermem.ReadWrite,
+				MaxPerms: usermem.AnyAccess,
+			}); err != nil {
+				t.Errorf("MMap(): %v", err)
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 2*usermem.PageSize)
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		n, err := fd.PRead(s.Ctx, usermem.BytesIOSequence(buf), int64(addr), vfs.ReadOptions{})
+		if err != nil || (n != usermem.PageSize && n != 2*usermem.PageSize) {
+			t.Fatalf("PRead() = %d, %v, want 1 or 2 pages", n, err)
+		}
+	}
+}
+
+// TestTaskMemAccess checks that /proc/[pid]/mem can only be opened by callers
+// that can attach to the task.
+func TestTaskMemAccess(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	task, _, _ := createTaskWithMM(t, s, usermem.PageSize)
+	k := kernel.KernelFromContext(s.Ctx)
+	creds := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	reader, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, creds), "reader", tc)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	path := fmt.Sprintf("/%d/mem", k.RootPIDNamespace().IDOfTask(task))
+	if _, err := s.VFS.OpenAt(reader, creds, s.PathOpAtRoot(path), &vfs.OpenOptions{}); err != syserror.EACCES {
+		t.Errorf("OpenAt(%s) by another user: got error %v, want %v", path, err, syserror.EACCES)
+	}
+}
+
+func TestExecArgsBounds(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	// The bounds of the exec args span far more than what is mapped.
+	const hugeLen = 1 << 30
+
+	for _, tc := range []struct {
+		name      string
+		mapped    uint64
+		wantLen   int
+		wantBytes []byte
+	}{
+		{
+			// Reads stop at the hard cap, even though more is mapped.
+			name:    "cap",
+			mapped:  2 * maxExecArgsLen,
+			wantLen: maxExecArgsLen,
+		},
+		{
+			// Reads return what was read before the first fault.
+			name:      "fault",
+			mapped:    2 * usermem.PageSize,
+			wantLen:   2 * usermem.PageSize,
+			wantBytes: []byte("arg0\x00arg1\x00"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			task, m, addr := createTaskWithMM(t, s, tc.mapped)
+			if len(tc.wantBytes) > 0 {
+				if _, err := m.CopyOut(s.Ctx, addr, tc.wantBytes, usermem.IOOpts{}); err != nil {
+					t.Fatalf("CopyOut(): %v", err)
+				}
+			}
+			end := addr + hugeLen
+			m.SetArgvStart(addr)
+			m.SetArgvEnd(end)
+			m.SetEnvvStart(addr)
+			m.SetEnvvEnd(end)
+
+			for _, arg := range []execArgType{cmdlineDataArg, environDataArg} {
+				// The buffer's capacity counts the memory allocated to
+				// generate the file.
+				var buf bytes.Buffer
+				d := &cmdlineData{task: task, arg: arg}
+				if err := d.Generate(s.Ctx, &buf); err != nil {
+					t.Fatalf("Generate(%v): %v", arg, err)
+				}
+				if got := buf.Len(); got != tc.wantLen {
+					t.Errorf("Generate(%v) returned %d bytes, want %d", arg, got, tc.wantLen)
+				}
+				// bytes.Buffer at most doubles its capacity when growing.
+				if got, max := buf.Cap(), 2*maxExecArgsLen; got > max {
+					t.Errorf("Generate(%v) allocated %d bytes, want at most %d", arg, got, max)
+				}
+				if got := buf.Bytes()[:len(tc.wantBytes)]; !bytes.Equal(got, tc.wantBytes) {
+					t.Errorf("Generate(%v) returned %q..., want %q...", arg, got, tc.wantBytes)
+				}
+			}
+		})
+	}
+}
+
+// readStat returns the fields of the stat file at path, indexed as in proc(5)
+// minus one, i.e. the pid is at index 0.
+func readStat(t *testing.T, s *testutil.System, path string) []string {
+	t.Helper()
+	data := readFile(t, s, path)
+	// The comm field is parenthesized and may contain spaces.
+	end := strings.LastIndexByte(data, ')')
+	if end == -1 {
+		t.Fatalf("%s: malformed stat %q", path, data)
+	}
+	fields := strings.Fields(data[end+1:])
+	return append([]string{strings.Fields(data)[0], data[strings.IndexByte(data, '(') : end+1]}, fields...)
+}
+
+// TestTaskStatFields checks every field of /proc/[pid]/stat against the
+// task it describes.
+func TestTaskStatFields(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	// Parsers find the end of comm by its last parenthesis.
+	const name = "a) (b c"
+	task, err := testutil.CreateTask(s.Ctx, name, tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	if _, err := testutil.CreateTask(s.Ctx, "thread", tg); err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	task.TestOnly_AddCPUTime(3*time.Second, time.Second)
+
+	pidns := k.RootPIDNamespace()
+	pid := strconv.Itoa(int(pidns.IDOfThreadGroup(tg)))
+	starttime := strconv.Itoa(int(linux.ClockTFromDuration(task.StartTime().Sub(k.Timekeeper().BootTime()))))
+	rsslim := strconv.FormatUint(tg.Limits().Get(limits.Rss).Cur, 10)
+	want := []string{
+		pid,                    // pid
+		"(" + name + ")",       // comm
+		task.StateStatus()[:1], // state
+		"0",                    // ppid
+		pid,                    // pgrp
+		pid,                    // session
+		"0",                    // tty_nr
+		"-1",                   // tpgid
+		"0",                    // flags
+		"0", "0", "0", "0",     // minflt cminflt majflt cmajflt
+		"300", "100", // utime stime
+		"0", "0", // cutime cstime
+		strconv.Itoa(task.Priority()), // priority
+		"0",                           // nice
+		"2",                           // num_threads
+		"0",                           // itrealvalue
+		starttime,                     // starttime
+		"0", "0",                      // vsize rss
+		rsslim,                  // rsslim
+		"0", "0", "0", "0", "0", // startcode endcode startstack kstkesp kstkeip
+		"0", "0", "0", "0", "0", // signal blocked sigignore sigcatch wchan
+		"0", "0", // nswap cnswap
+		strconv.Itoa(int(linux.SIGCHLD)), // exit_signal
+		strconv.Itoa(int(task.CPU())),    // processor
+		"0", "0",                         // rt_priority policy
+		"0", "0", "0", // delayacct_blkio_ticks guest_time cguest_time
+		"0", "0", // start_data end_data
+		"0",                // start_brk
+		"0", "0", "0", "0", // arg_start arg_end env_start env_end
+		"0", // exit_code
+	}
+	if len(want) != 52 {
+		t.Fatalf("test expects %d fields, want 52", len(want))
+	}
+	path := fmt.Sprintf("/%s/stat", pid)
+	if got := readStat(t, s, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+
+	// Once the session has a controlling terminal, tty_nr identifies it
+	// and tpgid is the foreground process group.
+	if err := tg.SetControllingTTY(&kernel.TTY{Index: 3}, 0); err != nil {
+		t.Fatalf("SetControllingTTY(): %v", err)
+	}
+	stat := readStat(t, s, path)
+	if got, want := stat[6:8], []string{strconv.Itoa(int(linux.MakeDeviceID(linux.UNIX98_PTY_SLAVE_MAJOR, 3))), pid}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: tty_nr, tpgid = %q, want %q", path, got, want)
+	}
+}
+
+func TestTaskStatThreadFields(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	for _, name := range []string{"busy", "idle"} {
+		thread, err := testutil.CreateTask(s.Ctx, name, tc)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		threads = append(threads, thread)
+	}
+	busy, idle := threads[0], threads[1]
+	busy.TestOnly_AddCPUTime(3*time.Second, time.Second)
+
+	pidns := k.RootPIDNamespace()
+	pid := pidns.IDOfThreadGroup(tc)
+	busyStat := readStat(t, s, fmt.Sprintf("/%d/task/%d/stat", pid, pidns.IDOfTask(busy)))
+	idleStat := readStat(t, s, fmt.Sprintf("/%d/task/%d/stat", pid, pidns.IDOfTask(idle)))
+	groupStat := readStat(t, s, fmt.Sprintf("/%d/stat", pid))
+
+	const (
+		ppid       = 3
+		pgrp       = 4
+		session    = 5
+		utime      = 13
+		stime      = 14
+		cutime     = 15
+		cstime     = 16
+		numThreads = 19
+		processor  = 38
+	)
+
+	// Thread-level fields.
+	for _, field := range []struct {
+		name  string
+		stat  []string
+		index int
+		want  string
+	}{
+		{"busy utime", busyStat, utime, "300"},
+		{"busy stime", busyStat, stime, "100"},
+		{"idle utime", idleStat, utime, "0"},
+		{"idle stime", idleStat, stime, "0"},
+		{"group utime", groupStat, utime, "300"},
+		{"group stime", groupStat, stime, "100"},
+		{"busy processor", busyStat, processor, strconv.Itoa(int(busy.CPU()))},
+		{"idle processor", idleStat, processor, strconv.Itoa(int(idle.CPU()))},
+	} {
+		if got := field.stat[field.index]; got != field.want {
+			t.Errorf("%s = %q, want %q", field.name, got, field.want)
+		}
+	}
+	if busyStat[utime] == idleStat[utime] {
+		t.Errorf("busy and idle threads both have utime %q", busyStat[utime])
+	}
+
+	// Fields shared by the thread group.
+	for _, index := range []int{ppid, pgrp, session, cutime, cstime, numThreads} {
+		if busyStat[index] != groupStat[index] || idleStat[index] != groupStat[index] {
+			t.Errorf("stat field %d: busy thread has %q, idle thread has %q, want both to be %q", index+1, busyStat[index], idleStat[index], groupStat[index])
+		}
+	}
+	if got := groupStat[numThreads]; got != "2" {
+		t.Errorf("num_threads = %q, want %q", got, "2")
+	}
+}
+
+// TestTaskThreadLevelFiles checks that the files under /proc/[pid]/task/[tid]
+// describe the thread, including the thread group leader's own entry, while
+// /proc/[pid]/stat aggregates CPU time across the thread group.
+func TestTaskThreadLevelFiles(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	for _, name := range []string{"leader", "worker"} {
+		thread, err := testutil.CreateTask(s.Ctx, name, tg)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		threads = append(threads, thread)
+	}
+	leader, worker := threads[0], threads[1]
+	worker.TestOnly_AddCPUTime(2*time.Second, time.Second)
+	// Neither task goroutine is running, so the test stands in for them.
+	leader.SetSignalMask(linux.SignalSetOf(linux.SIGUSR1))
+	worker.SetSignalMask(linux.SignalSetOf(linux.SIGUSR2))
+
+	const (
+		utime = 13
+		stime = 14
+	)
+	pidns := k.RootPIDNamespace()
+	pid := pidns.IDOfThreadGroup(tg)
+	for _, tc := range []struct {
+		path      string
+		task      *kernel.Task
+		wantUtime string
+		wantStime string
+	}{
+		{fmt.Sprintf("/%d", pid), leader, "200", "100"},
+		{fmt.Sprintf("/%d/task/%d", pid, pidns.IDOfTask(leader)), leader, "0", "0"},
+		{fmt.Sprintf("/%d/task/%d", pid, pidns.IDOfTask(worker)), worker, "200", "100"},
+	} {
+		tid := strconv.Itoa(int(pidns.IDOfTask(tc.task)))
+		stat := readStat(t, s, tc.path+"/stat")
+		if got := stat[0]; got != tid {
+			t.Errorf("%s/stat: pid = %q, want %q", tc.path, got, tid)
+		}
+		if got := stat[utime]; got != tc.wantUtime {
+			t.Errorf("%s/stat: utime = %q, want %q", tc.path, got, tc.wantUtime)
+		}
+		if got := stat[stime]; got != tc.wantStime {
+			t.Errorf("%s/stat: stime = %q, want %q", tc.path, got, tc.wantStime)
+		}
+
+		status := readStatus(t, s, tc.path+"/status")
+		for name, want := range map[string]string{
+			"Name":   tc.task.Name(),
+			"Pid":    tid,
+			"Tgid":   strconv.Itoa(int(pid)),
+			"SigBlk": fmt.Sprintf("%016x", uint64(tc.task.SignalMask())),
+		} {
+			if got := status[name]; got != want {
+				t.Errorf("%s/status: %s = %q, want %q", tc.path, name, got, want)
+			}
+		}
+
+		if got, want := readFile(t, s, tc.path+"/comm"), tc.task.Name()+"\n"; got != want {
+			t.Errorf("%s/comm = %q, want %q", tc.path, got, want)
+		}
+
+		schedData := readFile(t, s, tc.path+"/sched")
+		if got, want := strings.SplitN(schedData, "\n", 2)[0], fmt.Sprintf("%s (%s, #threads: 2)", tc.task.Name(), tid); got != want {
+			t.Errorf("%s/sched: first line = %q, want %q", tc.path, got, want)
+		}
+	}
+}
+
+// TestTaskChildren checks that /proc/[pid]/task/[tid]/children lists the
+// children of each thread, and that the thread group has no children file.
+func TestTaskChildren(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	pidns := k.RootPIDNamespace()
+	tg := k.NewThreadGroup(nil, pidns, kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	for _, name := range []string{"leader", "worker"} {
+		thread, err := testutil.CreateTask(s.Ctx, name, tg)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		threads = append(threads, thread)
+	}
+	leader, worker := threads[0], threads[1]
+
+	// Both children are forked by the worker.
+	var children []string
+	for _, name := range []string{"child1", "child2"} {
+		child, err := k.TaskSet().NewTask(&kernel.TaskConfig{
+			Kernel:                  k,
+			ThreadGroup:             k.NewThreadGroup(nil, pidns, kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits()),
+			Parent:                  worker,
+			TaskContext:             &kernel.TaskContext{Name: name},
+			Credentials:             auth.CredentialsFromContext(s.Ctx),
+			FDTable:                 k.NewFDTable(),
+			AllowedCPUMask:          sched.NewFullCPUSet(k.ApplicationCores()),
+			UTSNamespace:            kernel.UTSNamespaceFromContext(s.Ctx),
+			IPCNamespace:            kernel.IPCNamespaceFromContext(s.Ctx),
+			AbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
+		})
+		if err != nil {
+			t.Fatalf("NewTask(): %v", err)
+		}
+		children = append(children, strconv.Itoa(int(pidns.IDOfThreadGroup(child.ThreadGroup()))))
+	}
+
+	pid := pidns.IDOfThreadGroup(tg)
+	for _, tc := range []struct {
+		task *kernel.Task
+		want string
+	}{
+		{leader, ""},
+		{worker, strings.Join(children, " ") + " "},
+	} {
+		path := fmt.Sprintf("/%d/task/%d/children", pid, pidns.IDOfTask(tc.task))
+		if got := readFile(t, s, path); got != tc.want {
+			t.Errorf("%s = %q, want %q", path, got, tc.want)
+		}
+	}
+
+	path := fmt.Sprintf("/%d/children", pid)
+	if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{}); err != syserror.ENOENT {
+		t.Errorf("vfsfs.OpenAt(%s): got error %v, want %v", path, err, syserror.ENOENT)
+	}
+}
+
+func TestTaskStatStartTime(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(1e9, 0))
+	s := setupWithOptions(t, &InternalData{}, testutil.BootOptions{Clock: clock})
+	defer s.Destroy()
+
+	const (
+		starttime = 21
+		interval  = 2*time.Second + 500*time.Millisecond
+	)
+	startTime := func() int {
+		t.Helper()
+		pid := createStatusTask(t, s)
+		ticks, err := strconv.Atoi(readStat(t, s, fmt.Sprintf("/%d/stat", pid))[starttime])
+		if err != nil {
+			t.Fatalf("malformed starttime: %v", err)
+		}
+		return ticks
+	}
+
+	clock.Advance(10 * time.Second)
+	first := startTime()
+	if want := int(10 * time.Second / linux.ClockTick); first != want {
+		t.Errorf("got starttime %d for a task created 10s after boot, want %d", first, want)
+	}
+	clock.Advance(interval)
+	second := startTime()
+	if got, want := second-first, int(interval/linux.ClockTick); got != want {
+		t.Errorf("got starttime %d and %d for tasks created %v apart, want a difference of %d ticks", first, second, interval, want)
+	}
+}
+
+// TestTaskExec checks what /proc reports about a thread group after one of
+// its non-leader threads execs: comm is the new name, only the leader's entry
+// remains under /proc/[pid]/task, and CPU time is preserved.
+func TestTaskExec(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	for i, name := range []string{"leader", "sibling", "execer"} {
+		thread, err := testutil.CreateTask(s.Ctx, name, tg)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		thread.TestOnly_AddCPUTime(time.Duration(i+1)*time.Second, 0)
+		threads = append(threads, thread)
+	}
+	leader, sibling, execer := threads[0], threads[1], threads[2]
+
+	const (
+		comm       = 1
+		utime      = 13
+		numThreads = 19
+		starttime  = 21
+	)
+	pidns := k.RootPIDNamespace()
+	pid := pidns.IDOfThreadGroup(tg)
+	siblingTID, execerTID := pidns.IDOfTask(sibling), pidns.IDOfTask(execer)
+	before := readStat(t, s, fmt.Sprintf("/%d/stat", pid))
+	// Cache the dentries of the threads that are about to lose their TIDs.
+	readStat(t, s, fmt.Sprintf("/%d/task/%d/stat", pid, siblingTID))
+	readStat(t, s, fmt.Sprintf("/%d/task/%d/stat", pid, execerTID))
+
+	execer.TestOnly_Exec("new-program")
+
+	if got := leader.ExitState(); got != kernel.TaskExitDead {
+		t.Errorf("old leader has exit state %v, want %v", got, kernel.TaskExitDead)
+	}
+	if got := pidns.IDOfTask(execer); got != pid {
+		t.Fatalf("execing thread has TID %d, want the TGID %d", got, pid)
+	}
+
+	path := fmt.Sprintf("/%d", pid)
+	if got, want := readFile(t, s, path+"/comm"), "new-program\n"; got != want {
+		t.Errorf("%s/comm = %q, want %q", path, got, want)
+	}
+	after := readStat(t, s, path+"/stat")
+	for _, field := range []struct {
+		name  string
+		index int
+		want  string
+	}{
+		{"comm", comm, "(new-program)"},
+		{"utime", utime, "600"},
+		{"num_threads", numThreads, "1"},
+		{"starttime", starttime, before[starttime]},
+	} {
+		if got := after[field.index]; got != field.want {
+			t.Errorf("%s/stat: %s = %q, want %q", path, field.name, got, field.want)
+		}
+	}
+
+	s.AssertAllDirentTypes(s.ListDirents(s.PathOpAtRoot(path+"/task")), map[string]testutil.DirentType{
+		strconv.Itoa(int(pid)): linux.DT_DIR,
+	})
+	for _, tid := range []kernel.ThreadID{siblingTID, execerTID} {
+		taskPath := fmt.Sprintf("%s/task/%d", path, tid)
+		vd, err := s.VFS.GetDentryAt(s.Ctx, s.Creds, s.PathOpAtRoot(taskPath), &vfs.GetDentryOptions{})
+		if err == nil {
+			vd.DecRef()
+		}
+		if err != syserror.ENOENT {
+			t.Errorf("GetDentryAt(%s) = %v, want %v", taskPath, err, syserror.ENOENT)
+		}
+	}
+}
+
+func TestTaskLimits(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	// Limits that aren't set are unlimited.
+	ls := limits.NewLimitSet()
+	ls.SetUnchecked(limits.NumberOfFiles, limits.Limit{Cur: 1024, Max: 4096})
+	ls.SetUnchecked(limits.Nice, limits.Limit{Cur: 0, Max: 0})
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, ls)
+	task, err := testutil.CreateTask(s.Ctx, "name", tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+
+	path := fmt.Sprintf("/%d/limits", k.RootPIDNamespace().IDOfTask(task))
+	lines := strings.Split(readFile(t, s, path), "\n")
+	if got, want := len(lines), len(limitNames)+2; got != want {
+		t.Fatalf("%s has %d lines, want %d:\n%s", path, got, want, strings.Join(lines, "\n"))
+	}
+	for i, want := range map[int]string{
+		0:                       "Limit                     Soft Limit           Hard Limit           Units     ",
+		1:                       "Max cpu time              unlimited            unlimited            seconds   ",
+		1 + linux.RLIMIT_NOFILE: "Max open files            1024                 4096                 files     ",
+		1 + linux.RLIMIT_NICE:   "Max nice priority         0                    0                    ",
+		1 + linux.RLIMIT_RTTIME: "Max realtime timeout      unlimited            unlimited            us        ",
+		len(lines) - 1:          "",
+	} {
+		if got := lines[i]; got != want {
+			t.Errorf("%s line %d = %q, want %q", path, i, got, want)
+		}
+	}
+
+	// The file reflects later changes to the task's limits, e.g. by
+	// setrlimit(2) or prlimit(2).
+	tg.Limits().SetUnchecked(limits.NumberOfFiles, limits.Limit{Cur: 64, Max: limits.Infinity})
+	lines = strings.Split(readFile(t, s, path), "\n")
+	if got, want := lines[1+linux.RLIMIT_NOFILE], "Max open files            64                   unlimited            files     "; got != want {
+		t.Errorf("%s line %d after setrlimit = %q, want %q", path, 1+linux.RLIMIT_NOFILE, got, want)
+	}
+}
+
+func TestTaskWaitChannel(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	// The task isn't running, so it isn't blocked anywhere.
+	tid := createStatusTask(t, s)
+	if got, want := readFile(t, s, fmt.Sprintf("/%d/wchan", tid)), "0"; got != want {
+		t.Errorf("got /%d/wchan = %q, want %q", tid, got, want)
+	}
+}
+
+// nanosleepBlockSite is the block site of tasks in nanosleep(2).
+var nanosleepBlockSite = kernel.NewBlockSite("hrtimer_nanosleep")
+
+// fakeNanosleep blocks task on timer as nanosleep(2) would, until the returned
+// function is called.
+func fakeNanosleep(task *kernel.Task, timer *ktime.Timer) func() {
+	return task.TestOnly_BlockOnTimer(nanosleepBlockSite, timer)
+}
+
+// TestTaskBlockedOnTimer checks that a task sleeping in nanosleep(2) is shown
+// blocked in the per-task and per-thread wchan and stat files, and that its
+// timer is listed in /proc/timer_list.
+func TestTaskBlockedOnTimer(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(1e9, 0))
+	s := setupWithOptions(t, &InternalData{}, testutil.BootOptions{Clock: clock})
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "sleeper", tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	tid := k.RootPIDNamespace().IDOfTask(task)
+	paths := []string{fmt.Sprintf("/%d", tid), fmt.Sprintf("/%d/task/%d", tid, tid)}
+	entry := fmt.Sprintf("hrtimer_wakeup, S:01, hrtimer_nanosleep, sleeper/%d\n # expires at ", tid)
+
+	timer, _, _ := ktime.After(k.MonotonicClock(), time.Hour)
+	defer timer.Destroy()
+	unblock := fakeNanosleep(task, timer)
+	for _, path := range paths {
+		if got, want := readFile(t, s, path+"/wchan"), "hrtimer_nanosleep"; got != want {
+			t.Errorf("got %s/wchan = %q while sleeping, want %q", path, got, want)
+		}
+		if got, want := readStat(t, s, path+"/stat")[34], "1"; got != want {
+			t.Errorf("got %s/stat wchan = %q while sleeping, want %q", path, got, want)
+		}
+	}
+	timerList := readFile(t, s, "/timer_list")
+	if !strings.Contains(timerList, entry) || !strings.Contains(timerList, "[in 3600000000000 to 3600000000000 nsecs]\n") {
+		t.Errorf("/timer_list doesn't list the timer of task %d:\n%s", tid, timerList)
+	}
+
+	// The expiry is shown relative to the current time.
+	clock.Advance(time.Minute)
+	if timerList := readFile(t, s, "/timer_list"); !strings.Contains(timerList, "[in 3540000000000 to 3540000000000 nsecs]\n") {
+		t.Errorf("/timer_list doesn't show the remaining time of the timer of task %d:\n%s", tid, timerList)
+	}
+
+	unblock()
+	for _, path := range paths {
+		if got, want := readFile(t, s, path+"/wchan"), "0"; got != want {
+			t.Errorf("got %s/wchan = %q after waking, want %q", path, got, want)
+		}
+		if got, want := readStat(t, s, path+"/stat")[34], "0"; got != want {
+			t.Errorf("got %s/stat wchan = %q after waking, want %q", path, got, want)
+		}
+	}
+	if timerList := readFile(t, s, "/timer_list"); strings.Contains(timerList, "hrtimer_wakeup") {
+		t.Errorf("/timer_list still lists the timer of task %d after waking:\n%s", tid, timerList)
+	}
+}
+
+func TestTimerListPermissions(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	creds := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+	if _, err := s.VFS.OpenAt(s.Ctx, creds, s.PathOpAtRoot("/timer_list"), &vfs.OpenOptions{}); err != syserror.EACCES {
+		t.Errorf("OpenAt(/timer_list) as UID 1000 got error %v, want %v", err, syserror.EACCES)
+	}
+	if got := readFile(t, s, "/timer_list"); !strings.HasPrefix(got, "Timer List Version: v0.8\n") {
+		t.Errorf("got /timer_list = %q, want a timer list", got)
+	}
+}
+
+// readSchedField returns the named field of the sched file at path.
+func readSchedField(t *testing.T, s *testutil.System, path, name string) string {
+	t.Helper()
+	for _, line := range strings.Split(readFile(t, s, path), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == name {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+	t.Fatalf("%s has no %s field", path, name)
+	return ""
+}
+
+func TestTaskNiceness(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	var threads []*kernel.Task
+	for _, name := range []string{"leader", "worker"} {
+		thread, err := testutil.CreateTask(s.Ctx, name, tg)
+		if err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		threads = append(threads, thread)
+	}
+
+	const (
+		priority = 17
+		nice     = 18
+	)
+	pidns := k.RootPIDNamespace()
+	pid := pidns.IDOfThreadGroup(tg)
+	for _, tc := range []struct {
+		set  int32
+		want int
+	}{
+		{set: 5, want: 5},
+		{set: -7, want: -7},
+		// Values out of range are clamped, like setpriority(2).
+		{set: 100, want: linux.MAX_NICE},
+		{set: -100, want: linux.MIN_NICE},
+	} {
+		tg.SetNiceness(tc.set)
+		paths := []string{fmt.Sprintf("/%d", pid)}
+		for _, thread := range threads {
+			if got := thread.Niceness(); got != tc.want {
+				t.Errorf("after SetNiceness(%d): %s has niceness %d, want %d", tc.set, thread.Name(), got, tc.want)
+			}
+			paths = append(paths, fmt.Sprintf("/%d/task/%d", pid, pidns.IDOfTask(thread)))
+		}
+		for _, path := range paths {
+			stat := readStat(t, s, path+"/stat")
+			if got, want := stat[priority], strconv.Itoa(20+tc.want); got != want {
+				t.Errorf("after SetNiceness(%d): %s/stat: priority = %q, want %q", tc.set, path, got, want)
+			}
+			if got, want := stat[nice], strconv.Itoa(tc.want); got != want {
+				t.Errorf("after SetNiceness(%d): %s/stat: nice = %q, want %q", tc.set, path, got, want)
+			}
+			if got, want := readSchedField(t, s, path+"/sched", "prio"), strconv.Itoa(linux.DEFAULT_PRIO+tc.want); got != want {
+				t.Errorf("after SetNiceness(%d): %s/sched: prio = %q, want %q", tc.set, path, got, want)
+			}
+		}
+	}
+}
+
+func TestTaskSched(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	tid := createStatusTask(t, s)
+	want := fmt.Sprintf("name (%d, #threads: 1)\n", tid) +
+		strings.Repeat("-", 67) + "\n" +
+		"se.sum_exec_runtime                          :      0.000000\n" +
+		"nr_switches                                  :                    0\n" +
+		"nr_voluntary_switches                        :                    0\n" +
+		"nr_involuntary_switches                      :                    0\n" +
+		"policy                                       :                    0\n" +
+		"prio                                         :                  120\n"
+	if got := readFile(t, s, fmt.Sprintf("/%d/sched", tid)); got != want {
+		t.Errorf("got /%d/sched:\n%s\nwant:\n%s", tid, got, want)
+	}
+}
+
+// TestTaskSchedStats checks that the statistics in /proc/[pid]/sched follow
+// the CPU time and context switches of the task, and that other users may
+// read them.
+func TestTaskSchedStats(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, "name", tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	path := fmt.Sprintf("/%d/sched", k.RootPIDNamespace().IDOfTask(task))
+	other := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+
+	var prevRuntime float64
+	var prevSwitches int
+	for i := 1; i <= 3; i++ {
+		// Run, then block and resume.
+		task.TestOnly_AddCPUTime(time.Second, 500*time.Millisecond)
+		task.TestOnly_BlockOnTimer(nil, nil)()
+
+		data := readFileAs(t, s, other, path)
+		fields := make(map[string]string)
+		for _, line := range strings.Split(data, "\n") {
+			if kv := strings.Split(line, ":"); len(kv) == 2 {
+				fields[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		for name, want := range map[string]string{
+			"se.sum_exec_runtime":     fmt.Sprintf("%d.000000", i*1500),
+			"nr_switches":             strconv.Itoa(i),
+			"nr_voluntary_switches":   strconv.Itoa(i),
+			"nr_involuntary_switches": "0",
+		} {
+			if got := fields[name]; got != want {
+				t.Errorf("got %s %s = %q after %d runs, want %q", path, name, got, i, want)
+			}
+		}
+
+		runtime, err := strconv.ParseFloat(fields["se.sum_exec_runtime"], 64)
+		if err != nil {
+			t.Fatalf("%s: malformed se.sum_exec_runtime: %v", path, err)
+		}
+		switches, err := strconv.Atoi(fields["nr_switches"])
+		if err != nil {
+			t.Fatalf("%s: malformed nr_switches: %v", path, err)
+		}
+		if runtime < prevRuntime || switches < prevSwitches {
+			t.Errorf("%s went backwards: se.sum_exec_runtime %v -> %v, nr_switches %d -> %d", path, prevRuntime, runtime, prevSwitches, switches)
+		}
+		prevRuntime, prevSwitches = runtime, switches
+	}
+}
+
+func TestTaskSetMMArgv(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	task, m, addr := createTaskWithMM(t, s, usermem.PageSize)
+	const cmdline = "foo\x00bar\x00"
+	if _, err := m.CopyOut(s.Ctx, addr, []byte(cmdline), usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut(): %v", err)
+	}
+	end := addr + usermem.Addr(len(cmdline))
+	if err := m.SetMMField(s.Ctx, linux.PR_SET_MM_ARG_END, end); err != nil {
+		t.Fatalf("SetMMField(PR_SET_MM_ARG_END): %v", err)
+	}
+	if err := m.SetMMField(s.Ctx, linux.PR_SET_MM_ARG_START, addr); err != nil {
+		t.Fatalf("SetMMField(PR_SET_MM_ARG_START): %v", err)
+	}
+
+	tid := kernel.KernelFromContext(s.Ctx).RootPIDNamespace().IDOfTask(task)
+	path := fmt.Sprintf("/%d/cmdline", tid)
+	if got := readFile(t, s, path); got != cmdline {
+		t.Errorf("%s = %q, want %q", path, got, cmdline)
+	}
+
+	// arg_start and arg_end are fields 48 and 49.
+	path = fmt.Sprintf("/%d/stat", tid)
+	stat := readStat(t, s, path)
+	if got, want := stat[47:49], []string{strconv.Itoa(int(addr)), strconv.Itoa(int(end))}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: arg_start, arg_end = %q, want %q", path, got, want)
+	}
+}
+
+// TestTaskRSSAgreement checks that stat, statm and status report the same
+// RSS for a task, including when it touched part of a page.
+func TestTaskRSSAgreement(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	const length = 16 * usermem.PageSize
+	task, m, addr := createTaskWithMM(t, s, length)
+	tid := kernel.KernelFromContext(s.Ctx).RootPIDNamespace().IDOfTask(task)
+	for _, touched := range []uint64{0, 1, usermem.PageSize + 1, 3*usermem.PageSize + usermem.PageSize/2, length} {
+		if touched > 0 {
+			if _, err := m.CopyOut(s.Ctx, addr, make([]byte, touched), usermem.IOOpts{}); err != nil {
+				t.Fatalf("CopyOut(%d bytes): %v", touched, err)
+			}
+		}
+
+		statmPath := fmt.Sprintf("/%d/statm", tid)
+		statm := strings.Fields(readFile(t, s, statmPath))
+		if len(statm) < 2 {
+			t.Fatalf("%s: malformed statm %q", statmPath, statm)
+		}
+		resident, err := strconv.ParseUint(statm[1], 10, 64)
+		if err != nil {
+			t.Fatalf("%s: malformed resident %q: %v", statmPath, statm[1], err)
+		}
+		if touched > 0 && resident == 0 {
+			t.Errorf("%s: resident = 0 after touching %d bytes, want more", statmPath, touched)
+		}
+
+		statusPath := fmt.Sprintf("/%d/status", tid)
+		vmRSS := readStatus(t, s, statusPath)["VmRSS"]
+		if want := fmt.Sprintf("%d kB", resident*usermem.PageSize>>10); vmRSS != want {
+			t.Errorf("after touching %d bytes: %s VmRSS = %q, want %q to match %d resident pages in %s", touched, statusPath, vmRSS, want, resident, statmPath)
+		}
+
+		// rss is field 24.
+		statPath := fmt.Sprintf("/%d/stat", tid)
+		if rss := readStat(t, s, statPath)[23]; rss != statm[1] {
+			t.Errorf("after touching %d bytes: %s rss = %s, want %s to match %s", touched, statPath, rss, statm[1], statmPath)
+		}
+	}
+}
+
+func TestTaskOOMScore(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	// Linux's OOM score counts in thousandths of the total memory, so the
+	// resident sets must differ by more than that.
+	const length = 8 << 20
+	small, _, _ := createTaskWithMM(t, s, length)
+	large, m, addr := createTaskWithMM(t, s, length)
+	if _, err := m.CopyOut(s.Ctx, addr, make([]byte, length), usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut(): %v", err)
+	}
+
+	pidns := kernel.KernelFromContext(s.Ctx).RootPIDNamespace()
+	score := func(task *kernel.Task) int {
+		t.Helper()
+		path := fmt.Sprintf("/%d/oom_score", pidns.IDOfTask(task))
+		data := readFile(t, s, path)
+		score, err := strconv.Atoi(strings.TrimSuffix(data, "\n"))
+		if err != nil || score < 0 || score > 1000 {
+			t.Fatalf("%s = %q, want an integer in [0, 1000]", path, data)
+		}
+		return score
+	}
+
+	smallScore, largeScore := score(small), score(large)
+	if smallScore >= largeScore {
+		t.Errorf("oom_score with a %d byte resident set = %d, want more than %d with an empty resident set", length, largeScore, smallScore)
+	}
+
+	if err := small.WriteOOMScoreAdj(s.Creds, 500); err != nil {
+		t.Fatalf("WriteOOMScoreAdj(500): %v", err)
+	}
+	if got := score(small); got <= smallScore {
+		t.Errorf("oom_score with oom_score_adj 500 = %d, want more than %d", got, smallScore)
+	}
+	if err := small.WriteOOMScoreAdj(s.Creds, linux.OOM_SCORE_ADJ_MIN); err != nil {
+		t.Fatalf("WriteOOMScoreAdj(%d): %v", linux.OOM_SCORE_ADJ_MIN, err)
+	}
+	if got := score(small); got != 0 {
+		t.Errorf("oom_score with oom_score_adj %d = %d, want 0", linux.OOM_SCORE_ADJ_MIN, got)
+	}
+	if err := small.WriteOOMScoreAdj(s.Creds, linux.OOM_SCORE_ADJ_MAX+1); err != syserror.EINVAL {
+		t.Errorf("WriteOOMScoreAdj(%d) got err %v, want EINVAL", linux.OOM_SCORE_ADJ_MAX+1, err)
+	}
+}
+
+func TestTaskOOMScoreAdj(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	owner := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+	other := auth.NewUserCredentials(2000, 2000, nil, nil, k.RootUserNamespace())
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, owner), "task", tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	path := fmt.Sprintf("/%d/oom_score_adj", k.RootPIDNamespace().IDOfTask(task))
+	if got, want := readFile(t, s, path), "0\n"; got != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+
+	// The file is opened by the supervisor, and written on behalf of the
+	// writers, as if they had inherited it.
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{Flags: linux.O_RDWR})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+	}
+	defer fd.DecRef()
+	for _, tc := range []struct {
+		name    string
+		creds   *auth.Credentials
+		data    string
+		wantErr error
+		want    string
+	}{
+		{name: "privileged lowers", creds: s.Creds, data: "-500\n", want: "-500"},
+		{name: "owner raises", creds: owner, data: "100", want: "100"},
+		{name: "owner lowers to privileged value", creds: owner, data: "-500", want: "-500"},
+		{name: "owner lowers below privileged value", creds: owner, data: "-501", wantErr: syserror.EACCES, want: "-500"},
+		{name: "other user", creds: other, data: "0", wantErr: syserror.EPERM, want: "-500"},
+		{name: "too low", creds: s.Creds, data: "-1001", wantErr: syserror.EINVAL, want: "-500"},
+		{name: "too high", creds: s.Creds, data: "1001", wantErr: syserror.EINVAL, want: "-500"},
+		{name: "not an integer", creds: s.Creds, data: "high", wantErr: syserror.EINVAL, want: "-500"},
+		{name: "whitespace", creds: s.Creds, data: " \t42 \n", want: "42"},
+		{name: "trailing garbage", creds: s.Creds, data: "100 abc", wantErr: syserror.EINVAL, want: "42"},
+		{name: "two integers", creds: s.Creds, data: "1 2\n", wantErr: syserror.EINVAL, want: "42"},
+		{name: "maximum", creds: s.Creds, data: "1000", want: "1000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contexttest.WithCreds(s.Ctx, tc.creds)
+			n, err := fd.PWrite(ctx, usermem.BytesIOSequence([]byte(tc.data)), 0, vfs.WriteOptions{})
+			if err != tc.wantErr {
+				t.Errorf("PWrite(%q) got error %v, want %v", tc.data, err, tc.wantErr)
+			} else if err == nil && n != int64(len(tc.data)) {
+				t.Errorf("PWrite(%q) = %d, want %d", tc.data, n, len(tc.data))
+			}
+			if got := readFile(t, s, path); got != tc.want+"\n" {
+				t.Errorf("%s = %q, want %q", path, got, tc.want+"\n")
+			}
+		})
+	}
+}
+
+// testDevice is a vfs.Device that can't be opened.
+type testDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (testDevice) Open(ctx context.Context, mnt *vfs.Mount, d *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	return nil, syserror.ENXIO
+}
+
+func TestDevices(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	for _, reg := range []vfs.DeviceRegistration{
+		{Kind: vfs.CharDevice, Major: linux.MEM_MAJOR, Minor: 3, Opts: vfs.RegisterDeviceOptions{GroupName: "mem"}},
+		{Kind: vfs.CharDevice, Major: linux.MEM_MAJOR, Minor: 5, Opts: vfs.RegisterDeviceOptions{GroupName: "mem"}},
+		{Kind: vfs.CharDevice, Major: linux.TTYAUX_MAJOR, Minor: 0, Opts: vfs.RegisterDeviceOptions{GroupName: "/dev/tty"}},
+		{Kind: vfs.CharDevice, Major: linux.TTYAUX_MAJOR, Minor: 2, Opts: vfs.RegisterDeviceOptions{GroupName: "/dev/ptmx"}},
+		{Kind: vfs.CharDevice, Major: linux.MISC_MAJOR, Minor: 229, Opts: vfs.RegisterDeviceOptions{GroupName: "misc", Name: "fuse"}},
+		{Kind: vfs.CharDevice, Major: linux.MISC_MAJOR, Minor: 200, Opts: vfs.RegisterDeviceOptions{GroupName: "misc", Name: "tun"}},
+		// Devices without a group aren't listed.
+		{Kind: vfs.CharDevice, Major: 4, Minor: 0},
+		{Kind: vfs.BlockDevice, Major: 7, Minor: 0, Opts: vfs.RegisterDeviceOptions{GroupName: "loop"}},
+	} {
+		if err := s.VFS.RegisterDevice(reg.Kind, reg.Major, reg.Minor, testDevice{}, &reg.Opts); err != nil {
+			t.Fatalf("RegisterDevice(%v, %d, %d): %v", reg.Kind, reg.Major, reg.Minor, err)
+		}
+	}
+
+	wantDevices := "Character devices:\n" +
+		"  1 mem\n" +
+		"  5 /dev/tty\n" +
+		"  5 /dev/ptmx\n" +
+		" 10 misc\n" +
+		"\n" +
+		"Block devices:\n" +
+		"  7 loop\n"
+	if got := readFile(t, s, "/devices"); got != wantDevices {
+		t.Errorf("/proc/devices got:\n%s\nwant:\n%s", got, wantDevices)
+	}
+	wantMisc := "200 tun\n" +
+		"229 fuse\n"
+	if got := readFile(t, s, "/misc"); got != wantMisc {
+		t.Errorf("/proc/misc got:\n%s\nwant:\n%s", got, wantMisc)
+	}
+
+	// Unregistered devices disappear.
+	s.VFS.UnregisterDevice(vfs.CharDevice, linux.MISC_MAJOR, 200)
+	s.VFS.UnregisterDevice(vfs.CharDevice, linux.MISC_MAJOR, 229)
+	s.VFS.UnregisterDevice(vfs.BlockDevice, 7, 0)
+	wantDevices = "Character devices:\n" +
+		"  1 mem\n" +
+		"  5 /dev/tty\n" +
+		"  5 /dev/ptmx\n" +
+		"\n" +
+		"Block devices:\n"
+	if got := readFile(t, s, "/devices"); got != wantDevices {
+		t.Errorf("/proc/devices after UnregisterDevice got:\n%s\nwant:\n%s", got, wantDevices)
+	}
+	if got := readFile(t, s, "/misc"); got != "" {
+		t.Errorf("/proc/misc after UnregisterDevice got:\n%s\nwant empty", got)
+	}
+}
+
+func TestTTYDrivers(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	if got := readFile(t, s, "/tty/drivers"); got != "" {
+		t.Errorf("/proc/tty/drivers without ttys got:\n%s\nwant empty", got)
+	}
+
+	tty := &vfs.TTYDriver{Name: "/dev/tty", DevName: "tty", Type: "system:/dev/tty"}
+	ptmx := &vfs.TTYDriver{Name: "/dev/ptmx", DevName: "ptmx", Type: "system"}
+	ptySlave := &vfs.TTYDriver{Name: "pty_slave", DevName: "pts", Type: "pty:slave"}
+	for _, reg := range []vfs.DeviceRegistration{
+		{Major: linux.TTYAUX_MAJOR, Minor: 0, Opts: vfs.RegisterDeviceOptions{TTYDriver: tty}},
+		{Major: linux.TTYAUX_MAJOR, Minor: 2, Opts: vfs.RegisterDeviceOptions{TTYDriver: ptmx}},
+		{Major: linux.UNIX98_PTY_SLAVE_MAJOR, Minor: 0, Opts: vfs.RegisterDeviceOptions{TTYDriver: ptySlave}},
+		{Major: linux.UNIX98_PTY_SLAVE_MAJOR, Minor: 1, Opts: vfs.RegisterDeviceOptions{TTYDriver: ptySlave}},
+		{Major: linux.UNIX98_PTY_SLAVE_MAJOR, Minor: 2, Opts: vfs.RegisterDeviceOptions{TTYDriver: ptySlave}},
+		{Major: linux.UNIX98_PTY_SLAVE_MAJOR, Minor: 3, Opts: vfs.RegisterDeviceOptions{TTYDriver: ptySlave}},
+		// Devices that aren't ttys aren't listed.
+		{Major: linux.MEM_MAJOR, Minor: 3},
+	} {
+		if err := s.VFS.RegisterDevice(vfs.CharDevice, reg.Major, reg.Minor, testDevice{}, &reg.Opts); err != nil {
+			t.Fatalf("RegisterDevice(%d, %d): %v", reg.Major, reg.Minor, err)
+		}
+	}
+
+	want := "/dev/tty             /dev/tty        5       0 system:/dev/tty\n" +
+		"/dev/ptmx            /dev/ptmx       5       2 system\n" +
+		"pty_slave            /dev/pts      136 0-3 pty:slave\n"
+	if got := readFile(t, s, "/tty/drivers"); got != want {
+		t.Errorf("/proc/tty/drivers got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMaskedAndReadOnlyPaths(t *testing.T) {
+	s := setupWithData(t, &InternalData{
+		MaskedPaths:   []string{"meminfo", "/sys/kernel", "does/not/exist"},
+		ReadOnlyPaths: []string{"sys/vm/max_map_count"},
+	})
+	defer s.Destroy()
+
+	if got := readFile(t, s, "/meminfo"); got != "" {
+		t.Errorf("Masked /proc/meminfo got:\n%s\nwant empty", got)
+	}
+	if got := readFile(t, s, "/sys/kernel/hostname"); got != "" {
+		t.Errorf("/proc/sys/kernel/hostname in masked directory got:\n%s\nwant empty", got)
+	}
+	if got := readFile(t, s, "/sys/vm/max_map_count"); got == "" {
+		t.Errorf("Read-only /proc/sys/vm/max_map_count got empty contents")
+	}
+	if got := readFile(t, s, "/uptime"); got == "" {
+		t.Errorf("Unmasked /proc/uptime got empty contents")
+	}
+
+	// Masked entries can still be stat'ed.
+	for path, want := range map[string]linux.FileMode{
+		"/meminfo":    linux.ModeRegular,
+		"/sys/kernel": linux.ModeDirectory,
+	} {
+		stat, err := s.VFS.StatAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.StatOptions{})
+		if err != nil {
+			t.Errorf("StatAt(%s) failed: %v", path, err)
+			continue
+		}
+		if got := linux.FileMode(stat.Mode).FileType(); got != want {
+			t.Errorf("StatAt(%s) got file type %v, want %v", path, got, want)
+		}
+	}
+
+	collector := s.ListDirents(s.PathOpAtRoot("/sys/kernel"))
+	s.AssertAllDirentTypes(collector, map[string]testutil.DirentType{})
+
+	for _, path := range []string{"/meminfo", "/sys/kernel/hostname", "/sys/vm/max_map_count"} {
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{Flags: linux.O_RDWR})
+		if err != syserror.EROFS {
+			t.Errorf("OpenAt(%s, O_RDWR) got error %v, want %v", path, err, syserror.EROFS)
+		}
+		if fd != nil {
+			fd.DecRef()
+		}
+	}
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/sys/vm/mmap_min_addr"), &vfs.OpenOptions{Flags: linux.O_RDWR})
+	if err != nil {
+		t.Fatalf("OpenAt(/sys/vm/mmap_min_addr, O_RDWR) failed: %v", err)
+	}
+	fd.DecRef()
+}
+
+func TestTaskComm(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "name", want: "name\n"},
+		{name: "fifteen-chars-x", want: "fifteen-chars-x\n"},
+		{name: "sixteen-chars-xy", want: "sixteen-chars-x\n"},
+		{name: "a-much-longer-task-name", want: "a-much-longer-t\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setup(t)
+			defer s.Destroy()
+
+			k := kernel.KernelFromContext(s.Ctx)
+			tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+			if _, err := testutil.CreateTask(s.Ctx, tc.name, tg); err != nil {
+				t.Fatalf("CreateTask(): %v", err)
+			}
+
+			got := readFile(t, s, "/1/comm")
+			if got != tc.want {
+				t.Errorf("got /1/comm = %q, want = %q", got, tc.want)
+			}
+			if len(got) > linux.TASK_COMM_LEN {
+				t.Errorf("got %d bytes from /1/comm, want at most %d", len(got), linux.TASK_COMM_LEN)
+			}
+		})
+	}
+}
+
+// TestTaskNameEscaping checks that each file showing a task name with
+// delimiters, escapes and newlines in it can still be parsed.
+func TestTaskNameEscaping(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	const name = ") ( \\n\n evil"
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task, err := testutil.CreateTask(s.Ctx, name, tg)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	path := fmt.Sprintf("/%d", k.RootPIDNamespace().IDOfTask(task))
+
+	// comm holds the raw name.
+	if got, want := readFile(t, s, path+"/comm"), name+"\n"; got != want {
+		t.Errorf("%s/comm = %q, want %q", path, got, want)
+	}
+
+	// stat holds the raw name, between the first '(' and the last ')'. The
+	// other fields follow, starting with the state.
+	stat := readStat(t, s, path+"/stat")
+	if got, want := stat[1], "("+name+")"; got != want {
+		t.Errorf("%s/stat: comm = %q, want %q", path, got, want)
+	}
+	if got := stat[2]; len(got) != 1 || !strings.Contains("RSDZTtXxKWPI", got) {
+		t.Errorf("%s/stat: state = %q, want a single state letter", path, got)
+	}
+	if got, want := len(stat), 52; got != want {
+		t.Errorf("%s/stat has %d fields, want %d: %q", path, got, want, stat)
+	}
+
+	// status escapes newlines and backslashes, so every field stays on its
+	// own line. readStatus fails on malformed lines.
+	if got, want := readStatus(t, s, path+"/status")["Name"], `) ( \\n\n evil`; got != want {
+		t.Errorf("%s/status: Name = %q, want %q", path, got, want)
+	}
+}
+
+// readFileAs returns the contents of the file at path, as read with creds.
+func readFileAs(t *testing.T, s *testutil.System, creds *auth.Credentials, path string) string {
+	t.Helper()
+	ctx := contexttest.WithCreds(s.Ctx, creds)
+	fd, err := s.VFS.OpenAt(ctx, creds, s.PathOpAtRoot(path), &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+	}
+	defer fd.DecRef()
+	buf := make([]byte, usermem.PageSize)
+	n, err := fd.Read(ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{})
+	if err != nil && err != io.EOF {
+		t.Fatalf("Read(%s) failed: %v", path, err)
+	}
+	return string(buf[:n])
+}
+
+func TestKeys(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	allCreds := []*auth.Credentials{s.Creds}
+	for _, id := range []int{1000, 2000} {
+		creds := auth.NewUserCredentials(auth.KUID(id), auth.KGID(id), nil, nil, k.RootUserNamespace())
+		tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		if _, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, creds), fmt.Sprintf("user-%d", id), tg); err != nil {
+			t.Fatalf("CreateTask(): %v", err)
+		}
+		allCreds = append(allCreds, creds)
+	}
+
+	// Each user only sees its own session keyring, owned by its UID.
+	for _, creds := range allCreds {
+		keyring := k.Keys().SessionKeyring(creds)
+		uid := creds.RealKUID
+		want := fmt.Sprintf("%08x I--Q---     1 perm 3f030000 %5d %5d keyring   _uid_ses.%d: empty\n", keyring.ID, uid, uid, uid)
+		if got := readFileAs(t, s, creds, "/keys"); got != want {
+			t.Errorf("got /keys = %q as UID %d, want %q", got, uid, want)
+		}
+	}
+
+	want := "    0:     1 1/1 1/1000000 10/25000000\n" +
+		" 1000:     1 1/1 1/200 13/20000\n" +
+		" 2000:     1 1/1 1/200 13/20000\n"
+	if got := readFile(t, s, "/key-users"); got != want {
+		t.Errorf("got /key-users = %q, want %q", got, want)
+	}
+}
+
+// setupOnTmpfs is like setup, but mounts procfs at /proc of a tmpfs root,
+// which also has an empty /mnt directory and an empty /mnt-file.
+func setupOnTmpfs(t *testing.T) *testutil.System {
+	k, err := testutil.Boot()
+	if err != nil {
+		t.Fatalf("Error creating kernel: %v", err)
+	}
+
+	ctx := k.SupervisorContext()
+	creds := auth.CredentialsFromContext(ctx)
+
+	vfsObj := vfs.New()
+	vfsObj.MustRegisterFilesystemType("tmpfs", tmpfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+	})
+	vfsObj.MustRegisterFilesystemType("procfs", &procFSType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+	})
+	mntns, err := vfsObj.NewMountNamespace(ctx, creds, "", "tmpfs", &vfs.GetFilesystemOptions{})
+	if err != nil {
+		t.Fatalf("NewMountNamespace(): %v", err)
+	}
+	s := testutil.NewSystem(ctx, t, vfsObj, mntns)
+
+	for _, dir := range []string{"/proc", "/mnt"} {
+		if err := vfsObj.MkdirAt(ctx, creds, s.PathOpAtRoot(dir), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+			t.Fatalf("MkdirAt(%s): %v", dir, err)
+		}
+	}
+	fd, err := vfsObj.OpenAt(ctx, creds, s.PathOpAtRoot("/mnt-file"), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0644})
+	if err != nil {
+		t.Fatalf("OpenAt(/mnt-file, O_CREAT): %v", err)
+	}
+	fd.DecRef()
+	procOpts := &vfs.MountOptions{
+		GetFilesystemOptions: vfs.GetFilesystemOptions{InternalData: &InternalData{}},
+	}
+	if err := vfsObj.MountAt(ctx, creds, "", s.PathOpAtRoot("/proc"), "procfs", procOpts); err != nil {
+		t.Fatalf("MountAt(/proc): %v", err)
+	}
+	return s
+}
+
+// writeFile writes data to the file at path.
+func writeFile(t *testing.T, s *testutil.System, path, data string) {
+	t.Helper()
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.OpenOptions{Flags: linux.O_WRONLY})
+	if err != nil {
+		t.Fatalf("vfsfs.OpenAt(%s) failed: %v", path, err)
+	}
+	defer fd.DecRef()
+	if _, err := fd.Write(s.Ctx, usermem.BytesIOSequence([]byte(data)), vfs.WriteOptions{}); err != nil {
+		t.Fatalf("Write(%s) failed: %v", path, err)
+	}
+}
+
+func TestBindMountSys(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	if err := s.VFS.BindAt(s.Ctx, s.Creds, s.PathOpAtRoot("/proc/sys"), s.PathOpAtRoot("/mnt")); err != nil {
+		t.Fatalf("BindAt(/proc/sys, /mnt): %v", err)
+	}
+
+	const sysctl = "user/max_user_namespaces"
+	writeFile(t, s, "/mnt/"+sysctl, "1234\n")
+	for _, path := range []string{"/mnt/" + sysctl, "/proc/sys/" + sysctl} {
+		if got, want := readFile(t, s, path), "1234\n"; got != want {
+			t.Errorf("got %s = %q after writing through the bind mount, want %q", path, got, want)
+		}
+	}
+	if got, want := readFile(t, s, "/mnt/kernel/hostname"), readFile(t, s, "/proc/sys/kernel/hostname"); got != want {
+		t.Errorf("got /mnt/kernel/hostname = %q, want %q", got, want)
+	}
+
+	// The bind mount holds its own references on the shared procfs dentries.
+	if err := s.VFS.UmountAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt"), &vfs.UmountOptions{}); err != nil {
+		t.Fatalf("UmountAt(/mnt): %v", err)
+	}
+	if got, want := readFile(t, s, "/proc/sys/"+sysctl), "1234\n"; got != want {
+		t.Errorf("got /proc/sys/%s = %q after unmounting the bind mount, want %q", sysctl, got, want)
+	}
+	if err := s.ListDirents(s.PathOpAtRoot("/mnt")).Contains("user", linux.DT_DIR); err == nil {
+		t.Errorf("/mnt still lists the entries of /proc/sys after unmounting the bind mount")
+	}
+}
+
+func TestBindMountTaskFile(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	tid := createStatusTask(t, s)
+	source := fmt.Sprintf("/proc/%d/status", tid)
+	if err := s.VFS.BindAt(s.Ctx, s.Creds, s.PathOpAtRoot(source), s.PathOpAtRoot("/mnt-file")); err != nil {
+		t.Fatalf("BindAt(%s, /mnt-file): %v", source, err)
+	}
+
+	// The task is still looked up in the PID namespace of the procfs mount.
+	got := readStatus(t, s, "/mnt-file")
+	if want := strconv.Itoa(int(tid)); got["Pid"] != want {
+		t.Errorf("got Pid = %q through the bind mount, want %q", got["Pid"], want)
+	}
+	if want := readStatus(t, s, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("got status %v through the bind mount, want %v", got, want)
+	}
+}
+
+func TestBindMountTypeMismatch(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	tid := createStatusTask(t, s)
+	for _, tc := range []struct {
+		source string
+		target string
+	}{
+		{source: "/proc/sys", target: "/mnt-file"},
+		{source: fmt.Sprintf("/proc/%d/status", tid), target: "/mnt"},
+	} {
+		if err := s.VFS.BindAt(s.Ctx, s.Creds, s.PathOpAtRoot(tc.source), s.PathOpAtRoot(tc.target)); err != syserror.ENOTDIR {
+			t.Errorf("BindAt(%s, %s): got error %v, want %v", tc.source, tc.target, err, syserror.ENOTDIR)
+		}
+	}
+	if err := s.VFS.MountAt(s.Ctx, s.Creds, "", s.PathOpAtRoot("/mnt-file"), "tmpfs", &vfs.MountOptions{}); err != syserror.ENOTDIR {
+		t.Errorf("MountAt(/mnt-file): got error %v, want %v", err, syserror.ENOTDIR)
+	}
+
+	// Nothing was mounted over the targets.
+	if got, want := readFile(t, s, "/mnt-file"), ""; got != want {
+		t.Errorf("got /mnt-file = %q, want %q", got, want)
+	}
+	if err := s.ListDirents(s.PathOpAtRoot("/mnt")).Contains("user", linux.DT_DIR); err == nil {
+		t.Errorf("/mnt lists the entries of /proc/sys after a failed bind mount")
+	}
+}
+
+// mntnsContext is a context.Context with a VFS mount namespace, which is
+// required to delete files.
+type mntnsContext struct {
+	context.Context
+	mntns *vfs.MountNamespace
+}
+
+// Value implements context.Context.Value.
+func (ctx *mntnsContext) Value(key interface{}) interface{} {
+	if key == vfs.CtxMountNamespace {
+		return ctx.mntns
+	}
+	return ctx.Context.Value(key)
+}
+
+// createTaskWithFSContext creates a task in tg that uses fsc, on which it takes
+// a reference, and has an empty address space.
+func createTaskWithFSContext(t *testing.T, s *testutil.System, name string, tg *kernel.ThreadGroup, fsc *kernel.FSContext) *kernel.Task {
+	t.Helper()
+	k := kernel.KernelFromContext(s.Ctx)
+	fsc.IncRef()
+	task, err := k.TaskSet().NewTask(&kernel.TaskConfig{
+		Kernel:                  k,
+		ThreadGroup:             tg,
+		TaskContext:             &kernel.TaskContext{Name: name, MemoryManager: mm.NewMemoryManager(k, k)},
+		Credentials:             auth.CredentialsFromContext(s.Ctx),
+		FSContext:               fsc,
+		FDTable:                 k.NewFDTable(),
+		AllowedCPUMask:          sched.NewFullCPUSet(k.ApplicationCores()),
+		UTSNamespace:            kernel.UTSNamespaceFromContext(s.Ctx),
+		IPCNamespace:            kernel.IPCNamespaceFromContext(s.Ctx),
+		AbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
+	})
+	if err != nil {
+		t.Fatalf("NewTask(%q): %v", name, err)
+	}
+	return task
+}
+
+func TestTaskCwd(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	for _, dir := range []string{"/mnt/a", "/mnt/b"} {
+		if err := s.VFS.MkdirAt(s.Ctx, s.Creds, s.PathOpAtRoot(dir), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+			t.Fatalf("MkdirAt(%s): %v", dir, err)
+		}
+	}
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a/file"), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0644})
+	if err != nil {
+		t.Fatalf("OpenAt(/mnt/a/file, O_CREAT): %v", err)
+	}
+	fd.DecRef()
+
+	// Two threads of the same thread group share an FSContext.
+	cwd := s.GetDentryOrDie(s.PathOpAtRoot("/mnt/a"))
+	fsc := kernel.NewFSContextVFS2(s.Root, cwd, 0022)
+	cwd.DecRef()
+	defer fsc.DecRef()
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	leader := createTaskWithFSContext(t, s, "leader", tg, fsc)
+	thread := createTaskWithFSContext(t, s, "thread", tg, fsc)
+	pidns := k.RootPIDNamespace()
+	tgid, tid := pidns.IDOfThreadGroup(tg), pidns.IDOfTask(thread)
+	links := []string{
+		fmt.Sprintf("/proc/%d/cwd", tgid),
+		fmt.Sprintf("/proc/%d/task/%d/cwd", tgid, pidns.IDOfTask(leader)),
+		fmt.Sprintf("/proc/%d/task/%d/cwd", tgid, tid),
+	}
+	checkLinks := func(want string) {
+		t.Helper()
+		for _, link := range links {
+			got, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(link))
+			if err != nil {
+				t.Errorf("ReadlinkAt(%s) failed: %v", link, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("ReadlinkAt(%s) = %q, want %q", link, got, want)
+			}
+		}
+	}
+
+	listLinks := func(want map[string]testutil.DirentType) {
+		t.Helper()
+		for _, link := range links {
+			pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(link), FollowFinalSymlink: true}
+			s.AssertAllDirentTypes(s.ListDirents(pop), want)
+		}
+	}
+
+	checkLinks("/mnt/a")
+	listLinks(map[string]testutil.DirentType{"file": linux.DT_REG})
+
+	// A chdir by either thread is seen through all links.
+	cwd = s.GetDentryOrDie(s.PathOpAtRoot("/mnt/b"))
+	thread.FSContext().SetWorkingDirectoryVFS2(cwd)
+	cwd.DecRef()
+	checkLinks("/mnt/b")
+
+	// The working directory can still be opened through the links once it has
+	// been deleted, like in Linux.
+	ctx := &mntnsContext{Context: s.Ctx, mntns: s.MountNamespace()}
+	if err := s.VFS.RmdirAt(ctx, s.Creds, s.PathOpAtRoot("/mnt/b")); err != nil {
+		t.Fatalf("RmdirAt(/mnt/b): %v", err)
+	}
+	checkLinks("/mnt/b (deleted)")
+	listLinks(map[string]testutil.DirentType{})
+}
+
+func TestTaskExeAndRoot(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/exe"), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0755})
+	if err != nil {
+		t.Fatalf("OpenAt(/mnt/exe, O_CREAT): %v", err)
+	}
+	fd.DecRef()
+
+	// The task is chrooted to /mnt, and runs /mnt/exe.
+	root := s.GetDentryOrDie(s.PathOpAtRoot("/mnt"))
+	fsc := kernel.NewFSContextVFS2(root, root, 0022)
+	root.DecRef()
+	defer fsc.DecRef()
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task := createTaskWithFSContext(t, s, "task", tg, fsc)
+	exe := s.GetDentryOrDie(s.PathOpAtRoot("/mnt/exe"))
+	task.MemoryManager().SetExecutableVFS2(exe)
+	exe.DecRef()
+	dir := fmt.Sprintf("/proc/%d/", k.RootPIDNamespace().IDOfTask(task))
+
+	for _, tc := range []struct {
+		name string
+		want string
+		// wantType is the type of the file the link refers to.
+		wantType uint16
+	}{
+		{name: "cwd", want: "/mnt", wantType: linux.S_IFDIR},
+		{name: "exe", want: "/mnt/exe", wantType: linux.S_IFREG},
+		{name: "root", want: "/mnt", wantType: linux.S_IFDIR},
+	} {
+		path := dir + tc.name
+		got, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(path))
+		if err != nil {
+			t.Errorf("ReadlinkAt(%s) failed: %v", path, err)
+		} else if got != tc.want {
+			t.Errorf("ReadlinkAt(%s) = %q, want %q", path, got, tc.want)
+		}
+
+		// Like Linux, the links are world accessible, but only followed for
+		// callers that can trace the task.
+		stat, err := s.VFS.StatAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.StatOptions{})
+		if err != nil {
+			t.Fatalf("StatAt(%s) failed: %v", path, err)
+		}
+		if want := uint16(linux.S_IFLNK | 0777); stat.Mode != want {
+			t.Errorf("StatAt(%s) got mode %#o, want %#o", path, stat.Mode, want)
+		}
+		pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(path), FollowFinalSymlink: true}
+		stat, err = s.VFS.StatAt(s.Ctx, s.Creds, pop, &vfs.StatOptions{})
+		if err != nil {
+			t.Fatalf("StatAt(%s) following the link failed: %v", path, err)
+		}
+		if got := stat.Mode & linux.S_IFMT; got != tc.wantType {
+			t.Errorf("StatAt(%s) following the link got type %#o, want %#o", path, got, tc.wantType)
+		}
+	}
+
+	// Create a reader that can't trace the task.
+	creds := auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace())
+	readerTG := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	reader, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, creds), "reader", readerTG)
+	if err != nil {
+		t.Fatalf("CreateTask(): %v", err)
+	}
+	for _, name := range []string{"cwd", "exe", "root"} {
+		path := dir + name
+		if _, err := s.VFS.ReadlinkAt(reader, creds, s.PathOpAtRoot(path)); err != syserror.EACCES {
+			t.Errorf("ReadlinkAt(%s) by unauthorized reader got error %v, want %v", path, err, syserror.EACCES)
+		}
+		pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(path), FollowFinalSymlink: true}
+		if _, err := s.VFS.OpenAt(reader, creds, pop, &vfs.OpenOptions{}); err != syserror.EACCES {
+			t.Errorf("OpenAt(%s) by unauthorized reader got error %v, want %v", path, err, syserror.EACCES)
+		}
+	}
+}
+
+// TestTaskExeChanged checks that /proc/[pid]/exe follows the executable set by
+// prctl(PR_SET_MM_EXE_FILE), which may only be changed once.
+func TestTaskExeChanged(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	for _, name := range []string{"/exe-a", "/exe-b"} {
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot(name), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0755})
+		if err != nil {
+			t.Fatalf("OpenAt(%s, O_CREAT): %v", name, err)
+		}
+		fd.DecRef()
+	}
+
+	fsc := kernel.NewFSContextVFS2(s.Root, s.Root, 0022)
+	defer fsc.DecRef()
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task := createTaskWithFSContext(t, s, "task", tg, fsc)
+	mm := task.MemoryManager()
+	path := fmt.Sprintf("/proc/%d/exe", k.RootPIDNamespace().IDOfTask(task))
+	checkExe := func(want string) {
+		t.Helper()
+		got, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(path))
+		if err != nil {
+			t.Errorf("ReadlinkAt(%s) failed: %v", path, err)
+		} else if got != want {
+			t.Errorf("ReadlinkAt(%s) = %q, want %q", path, got, want)
+		}
+	}
+
+	exeA := s.GetDentryOrDie(s.PathOpAtRoot("/exe-a"))
+	defer exeA.DecRef()
+	exeB := s.GetDentryOrDie(s.PathOpAtRoot("/exe-b"))
+	defer exeB.DecRef()
+	mm.SetExecutableVFS2(exeA)
+	checkExe("/exe-a")
+
+	if err := mm.ChangeExecutableVFS2(exeB); err != nil {
+		t.Fatalf("ChangeExecutableVFS2(/exe-b): %v", err)
+	}
+	checkExe("/exe-b")
+
+	if err := mm.ChangeExecutableVFS2(exeA); err != syserror.EPERM {
+		t.Errorf("ChangeExecutableVFS2(/exe-a) after a change: got error %v, want %v", err, syserror.EPERM)
+	}
+	checkExe("/exe-b")
+}
+
+// TestTaskRootTraversal tests walking through /proc/[pid]/root into the
+// subtree of a chrooted task, by readers in different user namespaces.
+func TestTaskRootTraversal(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	for _, dir := range []string{"/mnt/dir", "/mnt/dir/sub"} {
+		if err := s.VFS.MkdirAt(s.Ctx, s.Creds, s.PathOpAtRoot(dir), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+			t.Fatalf("MkdirAt(%s): %v", dir, err)
+		}
+	}
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/file"), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0644})
+	if err != nil {
+		t.Fatalf("OpenAt(/mnt/file, O_CREAT): %v", err)
+	}
+	fd.DecRef()
+
+	// The task is chrooted to /mnt, and works in /mnt/dir.
+	root := s.GetDentryOrDie(s.PathOpAtRoot("/mnt"))
+	cwd := s.GetDentryOrDie(s.PathOpAtRoot("/mnt/dir"))
+	fsc := kernel.NewFSContextVFS2(root, cwd, 0022)
+	root.DecRef()
+	cwd.DecRef()
+	defer fsc.DecRef()
+	k := kernel.KernelFromContext(s.Ctx)
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task := createTaskWithFSContext(t, s, "task", tg, fsc)
+	link := fmt.Sprintf("/proc/%d/root", k.RootPIDNamespace().IDOfTask(task))
+
+	// The supervisor sees the task's root as /mnt.
+	pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(link + "/"), FollowFinalSymlink: true}
+	s.AssertAllDirentTypes(s.ListDirents(pop), map[string]testutil.DirentType{
+		"dir":  linux.DT_DIR,
+		"file": linux.DT_REG,
+	})
+	pop = &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(link + "/dir"), FollowFinalSymlink: true}
+	s.AssertAllDirentTypes(s.ListDirents(pop), map[string]testutil.DirentType{
+		"sub": linux.DT_DIR,
+	})
+	// Dot-dot components are resolved from the task's root, not from the
+	// link.
+	pop = &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(link + "/dir/../file"), FollowFinalSymlink: true}
+	stat, err := s.VFS.StatAt(s.Ctx, s.Creds, pop, &vfs.StatOptions{})
+	if err != nil {
+		t.Fatalf("StatAt(%s/dir/../file) failed: %v", link, err)
+	}
+	if got := stat.Mode & linux.S_IFMT; got != linux.S_IFREG {
+		t.Errorf("StatAt(%s/dir/../file) got type %#o, want %#o", link, got, linux.S_IFREG)
+	}
+
+	// The task runs as root in the root user namespace. Readers need
+	// CAP_SYS_PTRACE in it, even if they have the same UID and all
+	// capabilities in a child user namespace.
+	childCreds := auth.NewRootCredentials(k.RootUserNamespace())
+	childNS, err := childCreds.NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace(): %v", err)
+	}
+	allCaps := &auth.TaskCapabilities{
+		PermittedCaps: auth.AllCapabilities,
+		EffectiveCaps: auth.AllCapabilities,
+		BoundingCaps:  auth.AllCapabilities,
+	}
+	ptraceCaps := &auth.TaskCapabilities{
+		PermittedCaps: auth.CapabilitySetOf(linux.CAP_SYS_PTRACE),
+		EffectiveCaps: auth.CapabilitySetOf(linux.CAP_SYS_PTRACE),
+		BoundingCaps:  auth.AllCapabilities,
+	}
+	for _, tc := range []struct {
+		name    string
+		creds   *auth.Credentials
+		wantErr error
+	}{
+		{
+			name:  "CAP_SYS_PTRACE in the task's user namespace",
+			creds: auth.NewUserCredentials(1000, 1000, nil, ptraceCaps, k.RootUserNamespace()),
+		},
+		{
+			name:    "no capabilities",
+			creds:   auth.NewUserCredentials(1000, 1000, nil, nil, k.RootUserNamespace()),
+			wantErr: syserror.EACCES,
+		},
+		{
+			name:    "child user namespace",
+			creds:   auth.NewUserCredentials(auth.RootKUID, auth.RootKGID, nil, allCaps, childNS),
+			wantErr: syserror.EACCES,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			readerTG := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+			reader, err := testutil.CreateTask(contexttest.WithCreds(s.Ctx, tc.creds), "reader", readerTG)
+			if err != nil {
+				t.Fatalf("CreateTask(): %v", err)
+			}
+			got, err := s.VFS.ReadlinkAt(reader, tc.creds, s.PathOpAtRoot(link))
+			if err != tc.wantErr {
+				t.Errorf("ReadlinkAt(%s) got error %v, want %v", link, err, tc.wantErr)
+			} else if err == nil && got != "/mnt" {
+				t.Errorf("ReadlinkAt(%s) = %q, want %q", link, got, "/mnt")
+			}
+			for _, path := range []string{link, link + "/dir/sub", link + "/file"} {
+				pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(path), FollowFinalSymlink: true}
+				fd, err := s.VFS.OpenAt(reader, tc.creds, pop, &vfs.OpenOptions{})
+				if err != tc.wantErr {
+					t.Errorf("OpenAt(%s) got error %v, want %v", path, err, tc.wantErr)
+				}
+				if err == nil {
+					fd.DecRef()
+				}
+			}
+		})
+	}
+}
+
+func TestTaskMounts(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	if err := s.VFS.MkdirAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a b"), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+		t.Fatalf("MkdirAt(/mnt/a b): %v", err)
+	}
+	k := kernel.KernelFromContext(s.Ctx)
+	newTask := func(name, rootPath string) string {
+		root := s.GetDentryOrDie(s.PathOpAtRoot(rootPath))
+		fsc := kernel.NewFSContextVFS2(root, root, 0022)
+		root.DecRef()
+		defer fsc.DecRef()
+		tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		task := createTaskWithFSContext(t, s, name, tg, fsc)
+		return fmt.Sprintf("/proc/%d/mounts", k.RootPIDNamespace().IDOfTask(task))
+	}
+	// One task sees the whole tree, the other is chrooted to /mnt.
+	mounts := newTask("task", "/")
+	chrootedMounts := newTask("chrooted", "/mnt")
+
+	// Mounts are shown in the order they were created.
+	want := "none / tmpfs rw 0 0\nnone /proc procfs rw 0 0\n"
+	if got := readFile(t, s, mounts); got != want {
+		t.Errorf("%s = %q, want %q", mounts, got, want)
+	}
+	// Mounts that aren't below the task's root are hidden.
+	if got := readFile(t, s, chrootedMounts); got != "" {
+		t.Errorf("%s = %q, want %q", chrootedMounts, got, "")
+	}
+
+	// New mounts are shown by the next read. Whitespace in the source and
+	// mount point is escaped.
+	if err := s.VFS.MountAt(s.Ctx, s.Creds, "my\tsrc", s.PathOpAtRoot("/mnt/a b"), "tmpfs", &vfs.MountOptions{}); err != nil {
+		t.Fatalf("MountAt(/mnt/a b): %v", err)
+	}
+	if err := s.VFS.BindAt(s.Ctx, s.Creds, s.PathOpAtRoot("/proc"), s.PathOpAtRoot("/mnt")); err != nil {
+		t.Fatalf("BindAt(/proc, /mnt): %v", err)
+	}
+	want += "my\\011src /mnt/a\\040b tmpfs rw 0 0\n"
+	// Bind mounts show the source and type of the mount they're bound from.
+	want += "none /mnt procfs rw 0 0\n"
+	if got := readFile(t, s, mounts); got != want {
+		t.Errorf("%s = %q, want %q", mounts, got, want)
+	}
+	// Like in Linux, the mount over the chrooted task's root is shown at "/".
+	wantChrooted := "my\\011src /a\\040b tmpfs rw 0 0\nnone / procfs rw 0 0\n"
+	if got := readFile(t, s, chrootedMounts); got != wantChrooted {
+		t.Errorf("%s = %q, want %q", chrootedMounts, got, wantChrooted)
+	}
+
+	// Unmounted mounts disappear.
+	if err := s.VFS.UmountAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt"), &vfs.UmountOptions{Flags: linux.MNT_DETACH}); err != nil {
+		t.Fatalf("UmountAt(/mnt): %v", err)
+	}
+	if err := s.VFS.UmountAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a b"), &vfs.UmountOptions{Flags: linux.MNT_DETACH}); err != nil {
+		t.Fatalf("UmountAt(/mnt/a b): %v", err)
+	}
+	want = "none / tmpfs rw 0 0\nnone /proc procfs rw 0 0\n"
+	if got := readFile(t, s, mounts); got != want {
+		t.Errorf("%s = %q, want %q", mounts, got, want)
+	}
+	if got := readFile(t, s, chrootedMounts); got != "" {
+		t.Errorf("%s = %q, want %q", chrootedMounts, got, "")
+	}
+}
+
+func TestTaskMountInfo(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	if err := s.VFS.MkdirAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a b"), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+		t.Fatalf("MkdirAt(/mnt/a b): %v", err)
+	}
+	if err := s.VFS.MountAt(s.Ctx, s.Creds, "my\tsrc", s.PathOpAtRoot("/mnt/a b"), "tmpfs", &vfs.MountOptions{}); err != nil {
+		t.Fatalf("MountAt(/mnt/a b): %v", err)
+	}
+	if err := s.VFS.MkdirAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a b/dir"), &vfs.MkdirOptions{Mode: 0755}); err != nil {
+		t.Fatalf("MkdirAt(/mnt/a b/dir): %v", err)
+	}
+	if err := s.VFS.BindAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/a b/dir"), s.PathOpAtRoot("/mnt")); err != nil {
+		t.Fatalf("BindAt(/mnt/a b/dir, /mnt): %v", err)
+	}
+
+	// mountID returns the ID of the mount at path.
+	mountID := func(path string) uint64 {
+		vd := s.GetDentryOrDie(s.PathOpAtRoot(path))
+		defer vd.DecRef()
+		return vd.Mount().ID
+	}
+	// devNumber returns the major:minor device number of the file at path.
+	devNumber := func(path string) string {
+		stat, err := s.VFS.StatAt(s.Ctx, s.Creds, s.PathOpAtRoot(path), &vfs.StatOptions{})
+		if err != nil {
+			t.Fatalf("StatAt(%s): %v", path, err)
+		}
+		return fmt.Sprintf("%d:%d", stat.DevMajor, stat.DevMinor)
+	}
+	rootID, procID, tmpfsID, bindID := mountID("/"), mountID("/proc"), mountID("/mnt/a b"), mountID("/mnt")
+
+	k := kernel.KernelFromContext(s.Ctx)
+	root := s.GetDentryOrDie(s.PathOpAtRoot("/"))
+	fsc := kernel.NewFSContextVFS2(root, root, 0022)
+	root.DecRef()
+	defer fsc.DecRef()
+	tg := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task := createTaskWithFSContext(t, s, "task", tg, fsc)
+	mountInfo := fmt.Sprintf("/proc/%d/mountinfo", k.RootPIDNamespace().IDOfTask(task))
+
+	// The root mount is its own parent. The bind mount shows the directory
+	// it was bound from as its root, and the source and device of the mount
+	// it was bound from.
+	want := fmt.Sprintf("%d %d %s / / rw - tmpfs none rw\n", rootID, rootID, devNumber("/")) +
+		fmt.Sprintf("%d %d %s / /proc rw - procfs none rw\n", procID, rootID, devNumber("/proc")) +
+		fmt.Sprintf("%d %d %s / /mnt/a\\040b rw - tmpfs my\\011src rw\n", tmpfsID, rootID, devNumber("/mnt/a b")) +
+		fmt.Sprintf("%d %d %s /dir /mnt rw - tmpfs my\\011src rw\n", bindID, rootID, devNumber("/mnt/a b"))
+	if got := readFile(t, s, mountInfo); got != want {
+		t.Errorf("%s = %q, want %q", mountInfo, got, want)
+	}
+
+	// Every mount's parent is shown while mounts are added and removed
+	// concurrently.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := s.VFS.MountAt(s.Ctx, s.Creds, "", s.PathOpAtRoot("/proc"), "tmpfs", &vfs.MountOptions{}); err != nil {
+				t.Errorf("MountAt(/proc): %v", err)
+				return
+			}
+			if err := s.VFS.UmountAt(s.Ctx, s.Creds, s.PathOpAtRoot("/proc"), &vfs.UmountOptions{Flags: linux.MNT_DETACH}); err != nil {
+				t.Errorf("UmountAt(/proc): %v", err)
+				return
+			}
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		ids := make(map[string]struct{})
+		var parents []string
+		for _, line := range strings.Split(strings.TrimSuffix(readFile(t, s, mountInfo), "\n"), "\n") {
+			fields := strings.Fields(line)
+			ids[fields[0]] = struct{}{}
+			parents = append(parents, fields[1])
+		}
+		for _, parent := range parents {
+			if _, ok := ids[parent]; !ok {
+				t.Fatalf("parent mount %s isn't in %s", parent, mountInfo)
+			}
+		}
+	}
+}
+
+// TestTaskExeMissing tests /proc/[pid]/exe for tasks without an executable, and
+// for a deleted executable.
+func TestTaskExeMissing(t *testing.T) {
+	s := setupOnTmpfs(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	pidns := k.RootPIDNamespace()
+
+	// The task has no MemoryManager.
+	path := fmt.Sprintf("/proc/%d/exe", createStatusTask(t, s))
+	if _, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(path)); err != syserror.ENOENT {
+		t.Errorf("ReadlinkAt(%s) without a MemoryManager got error %v, want %v", path, err, syserror.ENOENT)
+	}
+
+	// The task has a MemoryManager, but no executable.
+	fsc := kernel.NewFSContextVFS2(s.Root, s.Root, 0022)
+	defer fsc.DecRef()
+	tg := k.NewThreadGroup(nil, pidns, kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+	task := createTaskWithFSContext(t, s, "task", tg, fsc)
+	path = fmt.Sprintf("/proc/%d/exe", pidns.IDOfTask(task))
+	if _, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(path)); err != syserror.ENOENT {
+		t.Errorf("ReadlinkAt(%s) without an executable got error %v, want %v", path, err, syserror.ENOENT)
+	}
+	pop := &vfs.PathOperation{Root: s.Root, Start: s.Root, Path: fspath.Parse(path), FollowFinalSymlink: true}
+	if _, err := s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{}); err != syserror.ENOENT {
+		t.Errorf("OpenAt(%s) without an executable got error %v, want %v", path, err, syserror.ENOENT)
+	}
+
+	// The executable is unlinked while the task runs it.
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, s.PathOpAtRoot("/mnt/exe"), &vfs.OpenOptions{Flags: linux.O_CREAT | linux.O_WRONLY, Mode: 0755})
+	if err != nil {
+		t.Fatalf("OpenAt(/mnt/exe, O_CREAT): %v", err)
+	}
+	fd.DecRef()
+	exe := s.GetDentryOrDie(s.PathOpAtRoot("/mnt/exe"))
+	task.MemoryManager().SetExecutableVFS2(exe)
+	exe.DecRef()
+	ctx := &mntnsContext{Context: s.Ctx, mntns: s.MountNamespace()}
+	if err := s.VFS.UnlinkAt(ctx, s.Creds, s.PathOpAtRoot("/mnt/exe")); err != nil {
+		t.Fatalf("UnlinkAt(/mnt/exe): %v", err)
+	}
+	got, err := s.VFS.ReadlinkAt(s.Ctx, s.Creds, s.PathOpAtRoot(path))
+	if err != nil {
+		t.Fatalf("ReadlinkAt(%s) failed: %v", path, err)
+	}
+	if want := "/mnt/exe (deleted)"; got != want {
+		t.Errorf("ReadlinkAt(%s) = %q, want %q", path, got, want)
+	}
+	// The deleted executable can still be opened through the link.
+	fd, err = s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("OpenAt(%s) of a deleted executable failed: %v", path, err)
+	}
+	fd.DecRef()
+}
+
+// BenchmarkTasksIterDirents measures listing /proc with 10k thread groups.
+func BenchmarkTasksIterDirents(b *testing.B) {
+	k, err := testutil.Boot()
+	if err != nil {
+		b.Fatalf("Error creating kernel: %v", err)
+	}
+	ctx := k.SupervisorContext()
+	vfsObj, mntns, err := mountProc(ctx, &InternalData{})
+	if err != nil {
+		b.Fatalf("NewMountNamespace(): %v", err)
+	}
+	defer mntns.DecRef()
+	root := mntns.Root()
+	defer root.DecRef()
+
+	const numTasks = 10000
+	for i := 0; i < numTasks; i++ {
+		tc := k.NewThreadGroup(nil, k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		if _, err := testutil.CreateTask(ctx, fmt.Sprintf("name-%d", i), tc); err != nil {
+			b.Fatalf("CreateTask(): %v", err)
+		}
+	}
+
+	fd, err := vfsObj.OpenAt(ctx, auth.CredentialsFromContext(ctx), &vfs.PathOperation{Root: root, Start: root}, &vfs.OpenOptions{})
+	if err != nil {
+		b.Fatalf("vfsfs.OpenAt(/) failed: %v", err)
+	}
+	defer fd.DecRef()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fd.Seek(ctx, 0, linux.SEEK_SET); err != nil {
+			b.Fatalf("Seek(0, SEEK_SET): %v", err)
+		}
+		// Read in getdents64-sized chunks, resuming from the offset each
+		// time, as ls does.
+		for {
+			c := limitedCollector{limit: 128}
+			if err := fd.IterDirents(ctx, &c); err != nil {
+				b.Fatalf("IterDirents(): %v", err)
+			}
+			if len(c.dirents) == 0 {
+				break
+			}
+		}
 	}
-	iterateDir(ctx, t, s, fd)
 }
@@ -0,0 +1,46 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/time"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+)
+
+// fakeClocks implements time.Clocks using a faketime.ManualClock, so that the
+// kernel's clocks only change when the test sets or advances it.
+type fakeClocks struct {
+	c *faketime.ManualClock
+}
+
+// Update implements time.Clocks.Update. The clocks have no cycle counter to
+// calibrate against, so the parameters are never ready and the VDSO falls
+// back to system calls.
+func (*fakeClocks) Update() (time.Parameters, bool, time.Parameters, bool) {
+	return time.Parameters{}, false, time.Parameters{}, false
+}
+
+// GetTime implements time.Clocks.GetTime.
+func (f *fakeClocks) GetTime(c time.ClockID) (int64, error) {
+	switch c {
+	case time.Monotonic:
+		return f.c.NowMonotonic(), nil
+	case time.Realtime:
+		return f.c.NowNanoseconds(), nil
+	default:
+		return 0, syserror.EINVAL
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/time"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 
 	// Platforms are plugable.
 	_ "gvisor.dev/gvisor/pkg/sentry/platform/kvm"
@@ -43,8 +44,21 @@ var (
 	platformFlag = flag.String("platform", "ptrace", "specify which platform to use")
 )
 
+// BootOptions configures the kernel created by BootWithOptions.
+type BootOptions struct {
+	// Clock, if non-nil, is the source of the kernel's clocks instead of the
+	// host's clocks. Kernel timers check for expirations whenever Clock is
+	// set or advanced.
+	Clock *faketime.ManualClock
+}
+
 // Boot initializes a new bare bones kernel for test.
 func Boot() (*kernel.Kernel, error) {
+	return BootWithOptions(BootOptions{})
+}
+
+// BootWithOptions is like Boot, but configures the kernel with opts.
+func BootWithOptions(opts BootOptions) (*kernel.Kernel, error) {
 	platformCtr, err := platform.Lookup(*platformFlag)
 	if err != nil {
 		return nil, fmt.Errorf("platform not found: %v", err)
@@ -79,7 +93,12 @@ func Boot() (*kernel.Kernel, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating timekeeper: %v", err)
 	}
-	tk.SetClocks(time.NewCalibratedClocks())
+	if opts.Clock != nil {
+		tk.SetClocks(&fakeClocks{c: opts.Clock})
+		opts.Clock.OnChange(tk.NotifyClocksChanged)
+	} else {
+		tk.SetClocks(time.NewCalibratedClocks())
+	}
 
 	creds := auth.NewRootCredentials(auth.NewRootUserNamespace())
 
@@ -125,6 +144,7 @@ func CreateTask(ctx context.Context, name string, tc *kernel.ThreadGroup) (*kern
 		ThreadGroup:             tc,
 		TaskContext:             &kernel.TaskContext{Name: name},
 		Credentials:             auth.CredentialsFromContext(ctx),
+		FDTable:                 k.NewFDTable(),
 		AllowedCPUMask:          sched.NewFullCPUSet(k.ApplicationCores()),
 		UTSNamespace:            kernel.UTSNamespaceFromContext(ctx),
 		IPCNamespace:            kernel.IPCNamespaceFromContext(ctx),
@@ -101,6 +101,12 @@ func (s *System) Destroy() {
 	s.mns.DecRef() // Reference on mns passed to NewSystem.
 }
 
+// MountNamespace returns the mount namespace of s. It does not take a
+// reference on the returned MountNamespace.
+func (s *System) MountNamespace() *vfs.MountNamespace {
+	return s.mns
+}
+
 // ReadToEnd reads the contents of fd until EOF to a string.
 func (s *System) ReadToEnd(fd *vfs.FileDescription) (string, error) {
 	buf := make([]byte, usermem.PageSize)
@@ -120,6 +126,17 @@ func (s *System) ReadToEnd(fd *vfs.FileDescription) (string, error) {
 	}
 }
 
+// ReadFile opens the file at pop, reads its contents until EOF and closes it.
+func (s *System) ReadFile(pop *vfs.PathOperation) ([]byte, error) {
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{Flags: linux.O_RDONLY})
+	if err != nil {
+		return nil, err
+	}
+	defer fd.DecRef()
+	content, err := s.ReadToEnd(fd)
+	return []byte(content), err
+}
+
 // PathOpAtRoot constructs a PathOperation with the given path from
 // the root of the filesystem.
 func (s *System) PathOpAtRoot(path string) *vfs.PathOperation {
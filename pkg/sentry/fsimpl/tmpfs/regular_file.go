@@ -178,6 +178,11 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 		offset += fd.off
 	case linux.SEEK_END:
 		offset += int64(atomic.LoadUint64(&fd.inode().impl.(*regularFile).size))
+	case linux.SEEK_DATA, linux.SEEK_HOLE:
+		var err error
+		if offset, err = fd.inode().impl.(*regularFile).seekDataOrHole(offset, whence); err != nil {
+			return 0, err
+		}
 	default:
 		return 0, syserror.EINVAL
 	}
@@ -188,6 +193,40 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 	return offset, nil
 }
 
+// seekDataOrHole returns the result of lseek(2) with whence SEEK_DATA or
+// SEEK_HOLE from offset. Holes are the ranges of the file without allocated
+// pages. As in Linux, there is an implicit hole at the end of the file.
+func (rf *regularFile) seekDataOrHole(offset int64, whence int32) (int64, error) {
+	rf.mu.RLock()
+	defer rf.mu.RUnlock()
+	if offset < 0 || uint64(offset) >= rf.size {
+		return 0, syserror.ENXIO
+	}
+	off := uint64(offset)
+	switch whence {
+	case linux.SEEK_DATA:
+		seg := rf.data.LowerBoundSegment(off)
+		if !seg.Ok() || seg.Start() >= rf.size {
+			return 0, syserror.ENXIO
+		}
+		if seg.Start() > off {
+			off = seg.Start()
+		}
+	case linux.SEEK_HOLE:
+		// Adjacent segments may be separated by empty gaps.
+		gap := rf.data.LowerBoundGap(off)
+		for gap.Ok() && gap.IsEmpty() {
+			gap = gap.NextGap()
+		}
+		if !gap.Ok() || gap.Start() >= rf.size {
+			off = rf.size
+		} else if gap.Start() > off {
+			off = gap.Start()
+		}
+	}
+	return int64(off), nil
+}
+
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *regularFileFD) Sync(ctx context.Context) error {
 	return nil
@@ -490,3 +490,75 @@ func TestTruncate(t *testing.T) {
 		t.Errorf("fd.Stat got Ctime %v, want %v", got, statAfterTruncateUp.Ctime)
 	}
 }
+
+func TestSeekDataHole(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fd, cleanup, err := newFileFD(ctx, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Lay out the file as data in the first page, a hole over the next
+	// three pages, data in the fifth and sixth pages, and a hole up to the
+	// end of the file.
+	const (
+		page = usermem.PageSize
+		size = 8 * page
+	)
+	for _, off := range []int64{0, 4 * page, 5 * page} {
+		if _, err := fd.PWrite(ctx, usermem.BytesIOSequence([]byte("gVisor")), off, vfs.WriteOptions{}); err != nil {
+			t.Fatalf("fd.PWrite(%d) failed: %v", off, err)
+		}
+	}
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask: linux.STATX_SIZE,
+			Size: size,
+		},
+	}); err != nil {
+		t.Fatalf("fd.SetStat failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		whence  int32
+		offset  int64
+		want    int64
+		wantErr error
+	}{
+		{whence: linux.SEEK_DATA, offset: 0, want: 0},
+		{whence: linux.SEEK_DATA, offset: 10, want: 10},
+		{whence: linux.SEEK_DATA, offset: page, want: 4 * page},
+		{whence: linux.SEEK_DATA, offset: 5*page + 1, want: 5*page + 1},
+		{whence: linux.SEEK_DATA, offset: 6 * page, wantErr: syserror.ENXIO},
+		{whence: linux.SEEK_DATA, offset: size, wantErr: syserror.ENXIO},
+		{whence: linux.SEEK_HOLE, offset: 0, want: page},
+		{whence: linux.SEEK_HOLE, offset: 2 * page, want: 2 * page},
+		{whence: linux.SEEK_HOLE, offset: 4 * page, want: 6 * page},
+		{whence: linux.SEEK_HOLE, offset: 7 * page, want: 7 * page},
+		{whence: linux.SEEK_HOLE, offset: size, wantErr: syserror.ENXIO},
+		{whence: linux.SEEK_HOLE, offset: -1, wantErr: syserror.ENXIO},
+	} {
+		got, err := fd.Seek(ctx, tc.offset, tc.whence)
+		if err != tc.wantErr {
+			t.Errorf("fd.Seek(%d, %d) got err %v, want %v", tc.offset, tc.whence, err, tc.wantErr)
+			continue
+		}
+		if err == nil && got != tc.want {
+			t.Errorf("fd.Seek(%d, %d) = %d, want %d", tc.offset, tc.whence, got, tc.want)
+		}
+	}
+
+	// A file without a hole ends with the implicit hole at its end.
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask: linux.STATX_SIZE,
+			Size: 3,
+		},
+	}); err != nil {
+		t.Fatalf("fd.SetStat failed: %v", err)
+	}
+	if got, err := fd.Seek(ctx, 0, linux.SEEK_HOLE); err != nil || got != 3 {
+		t.Errorf("fd.Seek(0, SEEK_HOLE) = %d, %v, want 3, nil", got, err)
+	}
+}
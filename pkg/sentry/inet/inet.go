@@ -15,7 +15,11 @@
 // Package inet defines semantics for IP stacks.
 package inet
 
-import "gvisor.dev/gvisor/pkg/tcpip/stack"
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
 
 // Stack represents a TCP/IP stack.
 type Stack interface {
@@ -56,6 +60,15 @@ type Stack interface {
 	// settings.
 	SetTCPSACKEnabled(enabled bool) error
 
+	// ConnTrackLimits returns connection tracking limits.
+	ConnTrackLimits() (ConnTrackLimits, error)
+
+	// SetConnTrackLimits attempts to change connection tracking limits.
+	SetConnTrackLimits(limits ConnTrackLimits) error
+
+	// ConnTrackEntries returns the tracked connections.
+	ConnTrackEntries() ([]ConnTrackEntry, error)
+
 	// Statistics reports stack statistics.
 	Statistics(stat interface{}, arg string) error
 
@@ -93,6 +106,21 @@ type Interface struct {
 
 	// MTU is the maximum transmission unit.
 	MTU uint32
+
+	// MulticastAddrs is the hardware multicast addresses the device receives
+	// packets for.
+	MulticastAddrs []MulticastAddr
+}
+
+// MulticastAddr contains information about a hardware multicast address of a
+// network interface.
+type MulticastAddr struct {
+	// Addr is the hardware address.
+	Addr []byte
+
+	// Users is the number of references to the address, one for each
+	// network-layer multicast group joined that maps to it.
+	Users int
 }
 
 // InterfaceAddr contains information about a network interface address.
@@ -189,3 +217,89 @@ type StatSNMPUDP [8]uint64
 
 // StatSNMPUDPLite describes UdpLite line of /proc/net/snmp.
 type StatSNMPUDPLite [8]uint64
+
+// Below SNMP6 metrics are from Linux/net/ipv6/proc.c.
+
+// StatSNMP6IP describes Ip6 lines of /proc/net/snmp6.
+type StatSNMP6IP [32]uint64
+
+// StatSNMP6ICMP describes Icmp6 lines of /proc/net/snmp6 that aren't per
+// message type.
+type StatSNMP6ICMP [5]uint64
+
+// StatSNMP6ICMPMSG describes per message type Icmp6 lines of /proc/net/snmp6.
+// Inbound messages are counted at their type, and outbound ones at 256 plus
+// their type.
+type StatSNMP6ICMPMSG [512]uint64
+
+// StatSNMP6UDP describes Udp6 lines of /proc/net/snmp6.
+type StatSNMP6UDP [8]uint64
+
+// StatSNMP6UDPLite describes UdpLite6 lines of /proc/net/snmp6.
+type StatSNMP6UDPLite [8]uint64
+
+// ConnTrackLimits contains settings controlling connection tracking.
+//
+// +stateify savable
+type ConnTrackLimits struct {
+	// Max is the maximum number of tracked connections. New connections
+	// are dropped while it is reached. Zero means no limit.
+	Max int
+
+	// TCPEstablishedTimeout is the time after which idle established TCP
+	// connections expire.
+	TCPEstablishedTimeout time.Duration
+
+	// UDPTimeout is the time after which idle UDP flows expire.
+	UDPTimeout time.Duration
+
+	// ICMPTimeout is the time after which idle ICMP echo exchanges expire.
+	ICMPTimeout time.Duration
+}
+
+// ConnTrackEntry contains information about a tracked connection.
+type ConnTrackEntry struct {
+	// Protocol is the transport protocol, a Linux IPPROTO_* constant.
+	Protocol uint8
+
+	// Original is the tuple of the packet that started the connection.
+	Original ConnTrackTuple
+
+	// Reply is the tuple of replies.
+	Reply ConnTrackTuple
+
+	// State is the state of TCP connections, e.g. "ESTABLISHED". It is
+	// empty for other protocols.
+	State string
+
+	// Timeout is the time left before the connection expires.
+	Timeout time.Duration
+
+	// Replied is true if a reply was seen.
+	Replied bool
+
+	// Assured is true if the connection won't be evicted early.
+	Assured bool
+}
+
+// ConnTrackTuple identifies one direction of a tracked connection.
+type ConnTrackTuple struct {
+	// SrcAddr is the source address.
+	SrcAddr []byte
+
+	// DstAddr is the destination address.
+	DstAddr []byte
+
+	// SrcPort is the source port. For ICMP, it holds the echo identifier.
+	SrcPort uint16
+
+	// DstPort is the destination port. For ICMP, it holds the echo
+	// identifier.
+	DstPort uint16
+
+	// ICMPType is the type of ICMP messages.
+	ICMPType uint8
+
+	// ICMPCode is the code of ICMP messages.
+	ICMPCode uint8
+}
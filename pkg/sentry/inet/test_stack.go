@@ -25,6 +25,8 @@ type TestStack struct {
 	TCPRecvBufSize    TCPBufferSize
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
+	ConnTrack         ConnTrackLimits
+	ConnTrackList     []ConnTrackEntry
 }
 
 // NewTestStack returns a TestStack with no network interfaces. The value of
@@ -91,6 +93,22 @@ func (s *TestStack) SetTCPSACKEnabled(enabled bool) error {
 	return nil
 }
 
+// ConnTrackLimits implements Stack.ConnTrackLimits.
+func (s *TestStack) ConnTrackLimits() (ConnTrackLimits, error) {
+	return s.ConnTrack, nil
+}
+
+// SetConnTrackLimits implements Stack.SetConnTrackLimits.
+func (s *TestStack) SetConnTrackLimits(limits ConnTrackLimits) error {
+	s.ConnTrack = limits
+	return nil
+}
+
+// ConnTrackEntries implements Stack.ConnTrackEntries.
+func (s *TestStack) ConnTrackEntries() ([]ConnTrackEntry, error) {
+	return s.ConnTrackList, nil
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *TestStack) Statistics(stat interface{}, arg string) error {
 	return nil
@@ -0,0 +1,136 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"math"
+
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// A UCountType is a kind of object whose creation is limited per user by user
+// namespaces. It is analogous to Linux's enum ucount_type.
+type UCountType int
+
+// UCountTypes, in the order of Linux's /proc/sys/user.
+const (
+	UCountUserNamespaces UCountType = iota
+	UCountPIDNamespaces
+	UCountUTSNamespaces
+	UCountIPCNamespaces
+	UCountNetNamespaces
+	UCountMntNamespaces
+	UCountCgroupNamespaces
+
+	// NumUCountTypes is the number of UCountTypes.
+	NumUCountTypes
+)
+
+// DefaultRootUCountMax is the limit of each UCountType in the root user
+// namespace. Linux uses half of max_threads; this is half of the sentry's
+// kernel.TasksLimit.
+const DefaultRootUCountMax = 1 << 15
+
+// newUCountMax returns the limits of a new user namespace, root if it is the
+// root user namespace. In Linux, the limits of other user namespaces start
+// at INT_MAX, so that they are only bounded by the limits of their ancestors.
+func newUCountMax(root bool) [NumUCountTypes]int32 {
+	var max [NumUCountTypes]int32
+	for i := range max {
+		if root {
+			max[i] = DefaultRootUCountMax
+		} else {
+			max[i] = math.MaxInt32
+		}
+	}
+	return max
+}
+
+// UCountMax returns the limit on the number of objects of type typ that each
+// user may create in ns, as set by /proc/sys/user.
+func (ns *UserNamespace) UCountMax(typ UCountType) int32 {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.ucountMax[typ]
+}
+
+// SetUCountMax sets the limit returned by UCountMax. Objects that were
+// created before the limit was lowered aren't affected.
+func (ns *UserNamespace) SetUCountMax(typ UCountType, max int32) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.ucountMax[typ] = max
+}
+
+// IncUCount counts the creation of an object of type typ by the user uid in
+// ns, and returns ENOSPC if that would exceed a limit.
+//
+// As in Linux's kernel/ucount.c:inc_ucount(), the object is also counted in
+// every ancestor of ns, against the user that owns the ancestor's child on
+// the path to ns. Each count must stay within the limit of its namespace.
+func (ns *UserNamespace) IncUCount(uid KUID, typ UCountType) error {
+	for iter, iterUID := ns, uid; iter != nil; iter, iterUID = iter.parent, iter.owner {
+		if !iter.incUCount(iterUID, typ) {
+			// Undo the counts in the descendants of iter.
+			for undo, undoUID := ns, uid; undo != iter; undo, undoUID = undo.parent, undo.owner {
+				undo.decUCount(undoUID, typ)
+			}
+			return syserror.ENOSPC
+		}
+	}
+	return nil
+}
+
+// DecUCount reverses a successful call to IncUCount with the same arguments,
+// when the object it counted is destroyed.
+func (ns *UserNamespace) DecUCount(uid KUID, typ UCountType) {
+	for iter, iterUID := ns, uid; iter != nil; iter, iterUID = iter.parent, iter.owner {
+		iter.decUCount(iterUID, typ)
+	}
+}
+
+// incUCount increments the count of objects of type typ created by uid in
+// ns, and returns true, unless the count is at its limit.
+func (ns *UserNamespace) incUCount(uid KUID, typ UCountType) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	counts := ns.ucounts[uid]
+	if counts[typ] >= ns.ucountMax[typ] {
+		return false
+	}
+	counts[typ]++
+	if ns.ucounts == nil {
+		ns.ucounts = make(map[KUID][NumUCountTypes]int32)
+	}
+	ns.ucounts[uid] = counts
+	return true
+}
+
+// decUCount decrements the count of objects of type typ created by uid in
+// ns.
+func (ns *UserNamespace) decUCount(uid KUID, typ UCountType) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	counts, ok := ns.ucounts[uid]
+	if !ok || counts[typ] == 0 {
+		panic("ucount underflow")
+	}
+	counts[typ]--
+	if counts == ([NumUCountTypes]int32{}) {
+		delete(ns.ucounts, uid)
+	} else {
+		ns.ucounts[uid] = counts
+	}
+}
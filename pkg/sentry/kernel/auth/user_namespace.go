@@ -16,6 +16,7 @@ package auth
 
 import (
 	"math"
+	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserror"
@@ -49,13 +50,31 @@ type UserNamespace struct {
 	gidMapFromParent idMapSet
 	gidMapToParent   idMapSet
 
+	// ucountMax holds the limits set by /proc/sys/user, indexed by
+	// UCountType.
+	ucountMax [NumUCountTypes]int32
+
+	// ucounts holds the number of objects of each UCountType counted
+	// against each user in this namespace. Users with no objects are
+	// omitted.
+	ucounts map[KUID][NumUCountTypes]int32
+
+	// refs is the number of references held on a namespace other than the
+	// root namespace by tasks whose credentials are in it, by its children,
+	// and by its creator until the creator is done with it. While refs is
+	// positive, the namespace is counted against UCountUserNamespaces for
+	// owner in parent. refs is accessed using atomic memory operations.
+	refs int64
+
 	// TODO(b/27454212): Support disabling setgroups(2).
 }
 
 // NewRootUserNamespace returns a UserNamespace that is appropriate for a
 // system's root user namespace.
 func NewRootUserNamespace() *UserNamespace {
-	var ns UserNamespace
+	ns := UserNamespace{
+		ucountMax: newUCountMax(true),
+	}
 	// """
 	// The initial user namespace has no parent namespace, but, for
 	// consistency, the kernel provides dummy user and group ID mapping files
@@ -100,7 +119,14 @@ func (ns *UserNamespace) depth() int {
 }
 
 // NewChildUserNamespace returns a new user namespace created by a caller with
-// credentials c.
+// credentials c. The namespace is counted against
+// /proc/sys/user/max_user_namespaces for the effective user of c in the
+// caller's user namespace until it is released, and NewChildUserNamespace
+// returns ENOSPC if that would exceed the limit.
+//
+// The caller holds a reference on the returned namespace, which it must drop
+// with DecRef once a task has been moved into the namespace, or if none will
+// be.
 func (c *Credentials) NewChildUserNamespace() (*UserNamespace, error) {
 	if c.UserNamespace.depth() >= maxUserNamespaceDepth {
 		// "... Calls to unshare(2) or clone(2) that would cause this limit to
@@ -119,11 +145,44 @@ func (c *Credentials) NewChildUserNamespace() (*UserNamespace, error) {
 	if !c.EffectiveKGID.In(c.UserNamespace).Ok() {
 		return nil, syserror.EPERM
 	}
+	// "ENOSPC (since Linux 4.9): One of the values in flags specified the
+	// creation of a new namespace, but doing so would have caused the limit
+	// defined by the corresponding file in /proc/sys/user to be exceeded." -
+	// clone(2)
+	if err := c.UserNamespace.IncUCount(c.EffectiveKUID, UCountUserNamespaces); err != nil {
+		return nil, err
+	}
+	c.UserNamespace.IncRef()
 	return &UserNamespace{
 		parent: c.UserNamespace,
 		owner:  c.EffectiveKUID,
 		// "When a user namespace is created, it starts without a mapping of
 		// user IDs (group IDs) to the parent user namespace." -
 		// user_namespaces(7)
+		ucountMax: newUCountMax(false),
+		refs:      1,
 	}, nil
 }
+
+// IncRef takes a reference on ns.
+func (ns *UserNamespace) IncRef() {
+	if ns.parent != nil {
+		atomic.AddInt64(&ns.refs, 1)
+	}
+}
+
+// DecRef drops a reference on ns. When the last reference is dropped, ns
+// stops being counted against its owner's limit, and drops its reference on
+// its parent.
+func (ns *UserNamespace) DecRef() {
+	if ns.parent == nil {
+		return
+	}
+	switch refs := atomic.AddInt64(&ns.refs, -1); {
+	case refs == 0:
+		ns.parent.DecUCount(ns.owner, UCountUserNamespaces)
+		ns.parent.DecRef()
+	case refs < 0:
+		panic("UserNamespace.refs < 0")
+	}
+}
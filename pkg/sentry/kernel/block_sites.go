@@ -0,0 +1,114 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+)
+
+// A BlockSite is a place at which tasks block, such as a blocking system call.
+// It names the wait channel reported for tasks blocked there by
+// /proc/[pid]/wchan.
+//
+// BlockSites are static: each is created once, by NewBlockSite, when the
+// package that blocks there is initialized.
+type BlockSite struct {
+	// name is the Linux symbol that the equivalent Linux tasks sleep in. It
+	// is immutable.
+	name string
+}
+
+// NewBlockSite returns a BlockSite for tasks that block where Linux tasks
+// sleep in the symbol name, e.g. "do_wait".
+func NewBlockSite(name string) *BlockSite {
+	return &BlockSite{name: name}
+}
+
+// EnterBlockSite records site as the site at which t blocks until the matching
+// call to LeaveBlockSite, which must be passed the value returned by
+// EnterBlockSite. It is typically used as:
+//
+//	defer t.LeaveBlockSite(t.EnterBlockSite(site))
+//
+// Blocking sites are recorded by their callers, rather than by the
+// Task.Block methods, so that blocking stays cheap: Task.block only ever
+// stores the timer that will wake the task.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) EnterBlockSite(site *BlockSite) *BlockSite {
+	prev := t.blockSite.Load()
+	t.blockSite.Store(site)
+	return prev
+}
+
+// LeaveBlockSite restores the block site that was recorded before the
+// matching call to EnterBlockSite, which returned prev.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) LeaveBlockSite(prev *BlockSite) {
+	t.blockSite.Store(prev)
+}
+
+// WaitChannel returns the name of the block site at which t is blocked, or ""
+// if t isn't blocked or isn't at a block site.
+func (t *Task) WaitChannel() string {
+	if t.TaskGoroutineSchedInfo().State != TaskGoroutineBlockedInterruptible {
+		return ""
+	}
+	if site := t.blockSite.Load(); site != nil {
+		return site.name
+	}
+	return ""
+}
+
+// wakeTimer returns the timer that will wake t from its current blocking
+// call, or nil if t isn't blocked or the call has no timeout. The timer may be
+// destroyed concurrently if t is woken, so it should only be peeked at.
+func (t *Task) wakeTimer() *ktime.Timer {
+	if t.TaskGoroutineSchedInfo().State != TaskGoroutineBlockedInterruptible {
+		return nil
+	}
+	return t.blockTimer.Load()
+}
+
+// TestOnly_BlockOnTimer makes t appear blocked at site until timer expires,
+// as if its task goroutine had called BlockWithTimer there, so that tests can
+// observe blocked tasks without running task goroutines. It returns a function
+// that makes t appear running again.
+//
+// Preconditions: t's task goroutine must not be running.
+func (t *Task) TestOnly_BlockOnTimer(site *BlockSite, timer *ktime.Timer) func() {
+	prev := t.EnterBlockSite(site)
+	t.blockTimer.Store(timer)
+	atomic.AddUint64(&t.blockCount, 1)
+	t.goschedSeq.BeginWrite()
+	state := t.gosched.State
+	t.gosched.State = TaskGoroutineBlockedInterruptible
+	t.goschedSeq.EndWrite()
+	return func() {
+		t.goschedSeq.BeginWrite()
+		t.gosched.State = state
+		t.goschedSeq.EndWrite()
+		t.LeaveBlockSite(prev)
+	}
+}
+
+// Block sites of the Task methods that block on behalf of syscalls.
+var (
+	waitBlockSite         = NewBlockSite("do_wait")
+	sigtimedwaitBlockSite = NewBlockSite("do_sigtimedwait")
+)
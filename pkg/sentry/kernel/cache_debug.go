@@ -0,0 +1,71 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+// CacheDebugger is implemented by caches that can be inspected and trimmed for
+// debugging, e.g. when hunting for leaks.
+type CacheDebugger interface {
+	// CacheStats returns a human-readable description of the cache's
+	// contents.
+	CacheStats() string
+
+	// TrimCache releases unused entries from the cache and returns the number
+	// of entries released.
+	TrimCache() int
+}
+
+// RegisterCacheDebugger registers c under name. It panics if name is already
+// registered.
+func (k *Kernel) RegisterCacheDebugger(name string, c CacheDebugger) {
+	k.cacheDebuggersMu.Lock()
+	defer k.cacheDebuggersMu.Unlock()
+	if _, ok := k.cacheDebuggers[name]; ok {
+		panic("cache debugger " + name + " already registered")
+	}
+	if k.cacheDebuggers == nil {
+		k.cacheDebuggers = make(map[string]CacheDebugger)
+	}
+	k.cacheDebuggers[name] = c
+}
+
+// UnregisterCacheDebugger removes the cache registered under name, if any.
+func (k *Kernel) UnregisterCacheDebugger(name string) {
+	k.cacheDebuggersMu.Lock()
+	defer k.cacheDebuggersMu.Unlock()
+	delete(k.cacheDebuggers, name)
+}
+
+// CacheStats returns the stats of every registered cache, keyed by name.
+func (k *Kernel) CacheStats() map[string]string {
+	k.cacheDebuggersMu.Lock()
+	defer k.cacheDebuggersMu.Unlock()
+	stats := make(map[string]string, len(k.cacheDebuggers))
+	for name, c := range k.cacheDebuggers {
+		stats[name] = c.CacheStats()
+	}
+	return stats
+}
+
+// TrimCaches trims every registered cache and returns the total number of
+// entries released.
+func (k *Kernel) TrimCaches() int {
+	k.cacheDebuggersMu.Lock()
+	defer k.cacheDebuggersMu.Unlock()
+	trimmed := 0
+	for _, c := range k.cacheDebuggers {
+		trimmed += c.TrimCache()
+	}
+	return trimmed
+}
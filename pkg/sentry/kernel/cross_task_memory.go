@@ -0,0 +1,143 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"io"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// crossTaskChunkSize is the maximum number of bytes copied between address
+// spaces at once.
+const crossTaskChunkSize = usermem.PageSize
+
+// CrossTaskMemory copies data between the address space of a target task and
+// caller-provided IOSequences, without stopping the target. It is used by
+// /proc/[pid]/mem and process_vm_readv(2)/process_vm_writev(2), so that both
+// check access to the target the same way.
+//
+// CrossTaskMemory is analogous to Linux's mm/process_vm_access.c and
+// fs/proc/base.c:mem_rw(), both of which get the target's mm with
+// kernel/fork.c:mm_access().
+//
+// +stateify savable
+type CrossTaskMemory struct {
+	// mm is the address space of the target at the time the CrossTaskMemory
+	// was created. It is immutable. No user reference is held on mm between
+	// copies, so copies fail once all users of mm have released it, like in
+	// Linux.
+	mm *mm.MemoryManager
+
+	// ignorePermissions is the IgnorePermissions option of the copies to and
+	// from mm. It is immutable.
+	ignorePermissions bool
+}
+
+// NewCrossTaskMemory returns a CrossTaskMemory for the address space of
+// target. It checks that ctx may access target in PTRACE_MODE_ATTACH mode,
+// returning EACCES otherwise. It returns ESRCH if target has no address space,
+// e.g. because it exited.
+//
+// opts are the options of the copies to and from target. If
+// opts.IgnorePermissions is true, memory can be accessed regardless of its
+// protection, like by ptrace(2).
+func NewCrossTaskMemory(ctx context.Context, target *Task, opts usermem.IOOpts) (*CrossTaskMemory, error) {
+	if !ContextCanTrace(ctx, target, true /* attach */) {
+		return nil, syserror.EACCES
+	}
+	var m *mm.MemoryManager
+	target.WithMuLocked(func(t *Task) {
+		m = t.MemoryManager()
+	})
+	if m == nil {
+		return nil, syserror.ESRCH
+	}
+	// opts.AddressSpaceActive is ignored: the target's address space isn't
+	// active from the caller's task goroutine.
+	return &CrossTaskMemory{mm: m, ignorePermissions: opts.IgnorePermissions}, nil
+}
+
+// ReadAt copies up to dst.NumBytes() bytes from the target's address space,
+// starting at addr, to dst. It returns the number of bytes copied. If the
+// copy stops early, e.g. at an unmapped address, the bytes before that point
+// are copied and an error is returned along with their number. ReadAt returns
+// io.EOF if the target's address space has been released.
+func (ctm *CrossTaskMemory) ReadAt(ctx context.Context, dst usermem.IOSequence, addr usermem.Addr) (int64, error) {
+	return ctm.copy(ctx, dst, addr, false /* write */)
+}
+
+// WriteAt copies up to src.NumBytes() bytes from src to the target's address
+// space, starting at addr. Partial copies are reported as by ReadAt.
+func (ctm *CrossTaskMemory) WriteAt(ctx context.Context, src usermem.IOSequence, addr usermem.Addr) (int64, error) {
+	return ctm.copy(ctx, src, addr, true /* write */)
+}
+
+// copy copies between seq and the target's address space at addr, through
+// an intermediate buffer so that the locks of both address spaces are never
+// held at once, even if they are the same.
+func (ctm *CrossTaskMemory) copy(ctx context.Context, seq usermem.IOSequence, addr usermem.Addr, write bool) (int64, error) {
+	if seq.NumBytes() == 0 {
+		return 0, nil
+	}
+	if !ctm.mm.IncUsers() {
+		return 0, io.EOF
+	}
+	defer ctm.mm.DecUsers(ctx)
+
+	bufLen := seq.NumBytes()
+	if bufLen > crossTaskChunkSize {
+		bufLen = crossTaskChunkSize
+	}
+	buf := make([]byte, bufLen)
+	opts := usermem.IOOpts{IgnorePermissions: ctm.ignorePermissions}
+	var done int64
+	for seq.NumBytes() > 0 {
+		chunk := buf
+		if rem := seq.NumBytes(); rem < int64(len(chunk)) {
+			chunk = chunk[:rem]
+		}
+
+		var n int
+		var err error
+		if write {
+			var cn int
+			cn, err = seq.CopyIn(ctx, chunk)
+			var werr error
+			n, werr = ctm.mm.CopyOut(ctx, addr, chunk[:cn], opts)
+			if werr != nil {
+				err = werr
+			}
+		} else {
+			var rn int
+			rn, err = ctm.mm.CopyIn(ctx, addr, chunk, opts)
+			var werr error
+			n, werr = seq.CopyOut(ctx, chunk[:rn])
+			if werr != nil {
+				err = werr
+			}
+		}
+		done += int64(n)
+		if err != nil {
+			return done, err
+		}
+		seq = seq.DropFirst(n)
+		addr += usermem.Addr(n)
+	}
+	return done, nil
+}
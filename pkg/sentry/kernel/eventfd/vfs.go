@@ -0,0 +1,88 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventfd
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// This file contains types enabling the eventfd package to be used with the
+// vfs package.
+
+// VFSEventFD implements vfs.FileDescriptionImpl for eventfds.
+type VFSEventFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+
+	// event is the event object, which has the same semantics as in VFS1.
+	event EventOperations
+}
+
+// NewVFSEventFD returns a FileDescription for a new event object with the
+// supplied initial value and mode, as for eventfd2(2) with the given status
+// flags.
+func NewVFSEventFD(vfsObj *vfs.VirtualFilesystem, initVal uint64, semMode bool, flags uint32) (*vfs.FileDescription, error) {
+	// name matches fs/eventfd.c:eventfd_file_create.
+	vd := vfsObj.NewAnonVirtualDentry("[eventfd]")
+	defer vd.DecRef()
+	efd := &VFSEventFD{
+		event: EventOperations{
+			val:     initVal,
+			semMode: semMode,
+			hostfd:  -1,
+		},
+	}
+	if err := efd.vfsfd.Init(efd, linux.O_RDWR|flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &efd.vfsfd, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (efd *VFSEventFD) Release() {
+	efd.event.Release()
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (efd *VFSEventFD) Read(ctx context.Context, dst usermem.IOSequence, _ vfs.ReadOptions) (int64, error) {
+	return efd.event.Read(ctx, nil /* file */, dst, 0 /* offset */)
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (efd *VFSEventFD) Write(ctx context.Context, src usermem.IOSequence, _ vfs.WriteOptions) (int64, error) {
+	return efd.event.Write(ctx, nil /* file */, src, 0 /* offset */)
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (efd *VFSEventFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return efd.event.Readiness(mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (efd *VFSEventFD) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	efd.event.EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (efd *VFSEventFD) EventUnregister(e *waiter.Entry) {
+	efd.event.EventUnregister(e)
+}
@@ -31,6 +31,58 @@ import (
 	"gvisor.dev/gvisor/pkg/sync"
 )
 
+const (
+	// DefaultNROpen is the default maximum value of RLIMIT_NOFILE, equivalent
+	// to Linux's INR_OPEN_MAX.
+	DefaultNROpen = 1024 * 1024
+
+	// MinNROpen and MaxNROpen are the bounds of NROpen, equivalent to
+	// Linux's sysctl_nr_open_min and sysctl_nr_open_max on 64-bit systems.
+	MinNROpen = 64
+	MaxNROpen = math.MaxInt32 &^ (MinNROpen - 1)
+)
+
+// nrOpen is the maximum value of RLIMIT_NOFILE, and the maximum number of
+// files any FDTable may hold. Like Linux's sysctl_nr_open, it applies to all
+// FDTables. nrOpen is accessed using atomic memory operations.
+var nrOpen int32 = DefaultNROpen
+
+// NROpen returns the maximum value of RLIMIT_NOFILE, as exposed by
+// /proc/sys/fs/nr_open.
+func NROpen() int32 {
+	return atomic.LoadInt32(&nrOpen)
+}
+
+// SetNROpen sets the maximum value of RLIMIT_NOFILE. Existing limits are not
+// changed, but no FD at or above n can be allocated.
+//
+// Preconditions: MinNROpen <= n <= MaxNROpen.
+func SetNROpen(n int32) {
+	atomic.StoreInt32(&nrOpen, n)
+}
+
+// CheckNROpen returns EPERM if lim can't be set as RLIMIT_NOFILE because its
+// maximum exceeds NROpen. From setrlimit(2): "EPERM: An attempt was made to
+// increase the RLIMIT_NOFILE limit above /proc/sys/fs/nr_open".
+func CheckNROpen(lim limits.Limit) error {
+	if lim.Max > uint64(NROpen()) {
+		return syscall.EPERM
+	}
+	return nil
+}
+
+// fdLimit returns the exclusive upper bound of FDs that may be allocated with
+// ctx: its RLIMIT_NOFILE, clamped to NROpen.
+func fdLimit(ctx context.Context) int32 {
+	end := NROpen()
+	if limitSet := limits.FromContext(ctx); limitSet != nil {
+		if lim := limitSet.Get(limits.NumberOfFiles); lim.Cur < uint64(end) {
+			end = int32(lim.Cur)
+		}
+	}
+	return end
+}
+
 // FDFlags define flags for an individual descriptor.
 //
 // +stateify savable
@@ -250,18 +302,10 @@ func (f *FDTable) NewFDs(ctx context.Context, fd int32, files []*fs.File, flags
 		return nil, syscall.EINVAL
 	}
 
-	// Default limit.
-	end := int32(math.MaxInt32)
-
 	// Ensure we don't get past the provided limit.
-	if limitSet := limits.FromContext(ctx); limitSet != nil {
-		lim := limitSet.Get(limits.NumberOfFiles)
-		if lim.Cur != limits.Infinity {
-			end = int32(lim.Cur)
-		}
-		if fd >= end {
-			return nil, syscall.EMFILE
-		}
+	end := fdLimit(ctx)
+	if fd >= end {
+		return nil, syscall.EMFILE
 	}
 
 	f.mu.Lock()
@@ -320,10 +364,8 @@ func (f *FDTable) newFDAt(ctx context.Context, fd int32, file *fs.File, fileVFS2
 	defer f.mu.Unlock()
 
 	// Check the limit for the provided file.
-	if limitSet := limits.FromContext(ctx); limitSet != nil {
-		if lim := limitSet.Get(limits.NumberOfFiles); lim.Cur != limits.Infinity && uint64(fd) >= lim.Cur {
-			return syscall.EMFILE
-		}
+	if fd >= fdLimit(ctx) {
+		return syscall.EMFILE
 	}
 
 	// Install the entry.
@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"runtime"
+	"syscall"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/context"
@@ -226,3 +227,30 @@ func BenchmarkFDLookupAndDecRefConcurrent(b *testing.B) {
 		wg.Wait()
 	})
 }
+
+func TestFDTableNROpen(t *testing.T) {
+	runTest(t, func(ctx context.Context, fdTable *FDTable, file *fs.File, _ *limits.LimitSet) {
+		defer SetNROpen(NROpen())
+		const nrOpen = maxFD / 2
+		SetNROpen(nrOpen)
+
+		// RLIMIT_NOFILE can't be raised above nr_open.
+		if err := CheckNROpen(limits.Limit{Cur: maxFD, Max: maxFD}); err != syscall.EPERM {
+			t.Errorf("CheckNROpen(%d) got %v, wanted EPERM", maxFD, err)
+		}
+		if err := CheckNROpen(limits.Limit{Cur: nrOpen, Max: nrOpen}); err != nil {
+			t.Errorf("CheckNROpen(%d) got %v, wanted nil", nrOpen, err)
+		}
+
+		// An existing, higher RLIMIT_NOFILE is clamped to nr_open.
+		if _, err := fdTable.NewFDs(ctx, nrOpen, []*fs.File{file}, FDFlags{}); err != syscall.EMFILE {
+			t.Errorf("fdTable.NewFDs(nrOpen, f): got %v, wanted EMFILE", err)
+		}
+		if err := fdTable.NewFDAt(ctx, nrOpen, file, FDFlags{}); err != syscall.EMFILE {
+			t.Errorf("fdTable.NewFDAt(nrOpen, f): got %v, wanted EMFILE", err)
+		}
+		if fds, err := fdTable.NewFDs(ctx, nrOpen-1, []*fs.File{file}, FDFlags{}); err != nil || fds[0] != nrOpen-1 {
+			t.Errorf("fdTable.NewFDs(nrOpen-1, f): got %v, %v, wanted [%d], nil", fds, err, nrOpen-1)
+		}
+	})
+}
@@ -19,6 +19,7 @@ import (
 
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 )
 
@@ -26,6 +27,8 @@ import (
 //
 // This includes umask and working directory.
 //
+// It contains both VFS1 and VFS2 directories, but only one of them is set.
+//
 // +stateify savable
 type FSContext struct {
 	refs.AtomicRefCount
@@ -34,21 +37,32 @@ type FSContext struct {
 	mu sync.Mutex `state:"nosave"`
 
 	// root is the filesystem root. Will be nil iff the FSContext has been
-	// destroyed.
+	// destroyed or uses VFS2.
+	//
+	// TODO(gvisor.dev/issue/1624): Remove the VFS1 directories.
 	root *fs.Dirent
 
+	// rootVFS2 is the VFS2 filesystem root. It is the zero value iff the
+	// FSContext has been destroyed or uses VFS1.
+	rootVFS2 vfs.VirtualDentry
+
 	// cwd is the current working directory. Will be nil iff the FSContext
-	// has been destroyed.
+	// has been destroyed or uses VFS2.
 	cwd *fs.Dirent
 
+	// cwdVFS2 is the VFS2 current working directory. It is the zero value iff
+	// the FSContext has been destroyed or uses VFS1.
+	cwdVFS2 vfs.VirtualDentry
+
 	// umask is the current file mode creation mask. When a thread using this
 	// context invokes a syscall that creates a file, bits set in umask are
 	// removed from the permissions that the file is created with.
 	umask uint
 }
 
-// newFSContext returns a new filesystem context.
-func newFSContext(root, cwd *fs.Dirent, umask uint) *FSContext {
+// NewFSContext returns a new filesystem context. It takes references on root
+// and cwd.
+func NewFSContext(root, cwd *fs.Dirent, umask uint) *FSContext {
 	root.IncRef()
 	cwd.IncRef()
 	f := FSContext{
@@ -60,6 +74,20 @@ func newFSContext(root, cwd *fs.Dirent, umask uint) *FSContext {
 	return &f
 }
 
+// NewFSContextVFS2 returns a new filesystem context using VFS2. It takes
+// references on root and cwd.
+func NewFSContextVFS2(root, cwd vfs.VirtualDentry, umask uint) *FSContext {
+	root.IncRef()
+	cwd.IncRef()
+	f := FSContext{
+		rootVFS2: root,
+		cwdVFS2:  cwd,
+		umask:    umask,
+	}
+	f.EnableLeakCheck("kernel.FSContext")
+	return &f
+}
+
 // destroy is the destructor for an FSContext.
 //
 // This will call DecRef on both root and cwd Dirents.  If either call to
@@ -75,6 +103,14 @@ func (f *FSContext) destroy() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	if f.rootVFS2.Ok() {
+		f.rootVFS2.DecRef()
+		f.rootVFS2 = vfs.VirtualDentry{}
+		f.cwdVFS2.DecRef()
+		f.cwdVFS2 = vfs.VirtualDentry{}
+		return
+	}
+
 	f.root.DecRef()
 	f.root = nil
 
@@ -93,12 +129,19 @@ func (f *FSContext) DecRef() {
 func (f *FSContext) Fork() *FSContext {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.cwd.IncRef()
-	f.root.IncRef()
+	if f.rootVFS2.Ok() {
+		f.cwdVFS2.IncRef()
+		f.rootVFS2.IncRef()
+	} else {
+		f.cwd.IncRef()
+		f.root.IncRef()
+	}
 	return &FSContext{
-		cwd:   f.cwd,
-		root:  f.root,
-		umask: f.umask,
+		cwd:      f.cwd,
+		root:     f.root,
+		cwdVFS2:  f.cwdVFS2,
+		rootVFS2: f.rootVFS2,
+		umask:    f.umask,
 	}
 }
 
@@ -115,6 +158,19 @@ func (f *FSContext) WorkingDirectory() *fs.Dirent {
 	return f.cwd
 }
 
+// WorkingDirectoryVFS2 returns the current working directory.
+//
+// This will return a zero value if called after destroy() or if f uses VFS1,
+// otherwise it will return a VirtualDentry with a reference taken.
+func (f *FSContext) WorkingDirectoryVFS2() vfs.VirtualDentry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cwdVFS2.Ok() {
+		f.cwdVFS2.IncRef()
+	}
+	return f.cwdVFS2
+}
+
 // SetWorkingDirectory sets the current working directory.
 // This will take an extra reference on the Dirent.
 //
@@ -137,6 +193,24 @@ func (f *FSContext) SetWorkingDirectory(d *fs.Dirent) {
 	old.DecRef()
 }
 
+// SetWorkingDirectoryVFS2 sets the current working directory.
+// This will take an extra reference on the VirtualDentry.
+//
+// This is not a valid call after destroy, or if f uses VFS1.
+func (f *FSContext) SetWorkingDirectoryVFS2(d vfs.VirtualDentry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.cwdVFS2.Ok() {
+		panic(fmt.Sprintf("FSContext.SetWorkingDirectoryVFS2(%v)) called after destroy", d))
+	}
+
+	old := f.cwdVFS2
+	f.cwdVFS2 = d
+	d.IncRef()
+	old.DecRef()
+}
+
 // RootDirectory returns the current filesystem root.
 //
 // This will return nil if called after destroy(), otherwise it will return a
@@ -150,6 +224,19 @@ func (f *FSContext) RootDirectory() *fs.Dirent {
 	return f.root
 }
 
+// RootDirectoryVFS2 returns the current filesystem root.
+//
+// This will return a zero value if called after destroy() or if f uses VFS1,
+// otherwise it will return a VirtualDentry with a reference taken.
+func (f *FSContext) RootDirectoryVFS2() vfs.VirtualDentry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rootVFS2.Ok() {
+		f.rootVFS2.IncRef()
+	}
+	return f.rootVFS2
+}
+
 // SetRootDirectory sets the root directory.
 // This will take an extra reference on the Dirent.
 //
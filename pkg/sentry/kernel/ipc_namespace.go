@@ -29,6 +29,10 @@ type IPCNamespace struct {
 
 	semaphores *semaphore.Registry
 	shms       *shm.Registry
+
+	// charge counts the namespace against max_ipc_namespaces. It is nil if
+	// the namespace wasn't created by a task. Immutable.
+	charge *namespaceCharge
 }
 
 // NewIPCNamespace creates a new IPC namespace.
@@ -40,6 +44,30 @@ func NewIPCNamespace(userNS *auth.UserNamespace) *IPCNamespace {
 	}
 }
 
+// newChildIPCNamespace creates a new IPC namespace, owned by userNS, for a
+// task with credentials creds. It returns ENOSPC if the namespace would
+// exceed /proc/sys/user/max_ipc_namespaces. The caller holds a reference on
+// the returned namespace.
+func newChildIPCNamespace(creds *auth.Credentials, userNS *auth.UserNamespace) (*IPCNamespace, error) {
+	charge, err := newNamespaceCharge(creds, userNS, auth.UCountIPCNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	i := NewIPCNamespace(userNS)
+	i.charge = charge
+	return i, nil
+}
+
+// IncRef takes a reference on i, held by a task in i.
+func (i *IPCNamespace) IncRef() {
+	i.charge.IncRef()
+}
+
+// DecRef drops a reference on i.
+func (i *IPCNamespace) DecRef() {
+	i.charge.DecRef()
+}
+
 // SemaphoreRegistry returns the semaphore set registry for this namespace.
 func (i *IPCNamespace) SemaphoreRegistry() *semaphore.Registry {
 	return i.semaphores
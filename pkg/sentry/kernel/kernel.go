@@ -137,6 +137,9 @@ type Kernel struct {
 	// syslog is the kernel log.
 	syslog syslog
 
+	// keys holds the kernel's keys and keyrings.
+	keys KeyRegistry
+
 	// runningTasksMu synchronizes disable/enable of cpuClockTicker when
 	// the kernel is idle (runningTasks == 0).
 	//
@@ -201,6 +204,12 @@ type Kernel struct {
 	// operations.
 	nextInotifyCookie uint32
 
+	// tainted is the mask of taint flags shown in /proc/sys/kernel/tainted.
+	// Flags are never cleared.
+	//
+	// tainted is mutable, and is accessed using atomic memory operations.
+	tainted uint64
+
 	// netlinkPorts manages allocation of netlink socket port IDs.
 	netlinkPorts *port.Manager
 
@@ -236,6 +245,14 @@ type Kernel struct {
 	// syscall.
 	unimplementedSyscallEmitter eventchannel.Emitter `state:"nosave"`
 
+	// cacheDebuggersMu protects cacheDebuggers.
+	cacheDebuggersMu sync.Mutex `state:"nosave"`
+
+	// cacheDebuggers maps names to the caches registered with
+	// RegisterCacheDebugger. Registrations aren't saved; caches must register
+	// again after restore.
+	cacheDebuggers map[string]CacheDebugger `state:"nosave"`
+
 	// SpecialOpts contains special kernel options.
 	SpecialOpts
 }
@@ -769,7 +786,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 
 	// Get the root directory from the MountNamespace.
 	root := mounts.Root()
-	// The call to newFSContext below will take a reference on root, so we
+	// The call to NewFSContext below will take a reference on root, so we
 	// don't need to hold this one.
 	defer root.DecRef()
 
@@ -834,7 +851,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		Kernel:                  k,
 		ThreadGroup:             tg,
 		TaskContext:             tc,
-		FSContext:               newFSContext(root, wd, args.Umask),
+		FSContext:               NewFSContext(root, wd, args.Umask),
 		FDTable:                 args.FDTable,
 		Credentials:             args.Credentials,
 		AllowedCPUMask:          sched.NewFullCPUSet(k.applicationCores),
@@ -1224,6 +1241,11 @@ func (k *Kernel) Syslog() *syslog {
 	return &k.syslog
 }
 
+// Keys returns the kernel's key registry.
+func (k *Kernel) Keys() *KeyRegistry {
+	return &k.keys
+}
+
 // GenerateInotifyCookie generates a unique inotify event cookie.
 //
 // Returned values may overlap with previously returned values if the value
@@ -1238,6 +1260,22 @@ func (k *Kernel) GenerateInotifyCookie() uint32 {
 	return id
 }
 
+// Tainted returns the mask of taint flags set on k.
+func (k *Kernel) Tainted() uint64 {
+	return atomic.LoadUint64(&k.tainted)
+}
+
+// AddTaint sets the taint flags in mask on k, in addition to those already
+// set. As in Linux, taint flags can't be cleared.
+func (k *Kernel) AddTaint(mask uint64) {
+	for {
+		old := atomic.LoadUint64(&k.tainted)
+		if old|mask == old || atomic.CompareAndSwapUint64(&k.tainted, old, old|mask) {
+			return
+		}
+	}
+}
+
 // NetlinkPorts returns the netlink port manager.
 func (k *Kernel) NetlinkPorts() *port.Manager {
 	return k.netlinkPorts
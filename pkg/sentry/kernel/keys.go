@@ -0,0 +1,179 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// KeyTypeKeyring is the type of keys that hold links to other keys.
+const KeyTypeKeyring = "keyring"
+
+// Key is a key or keyring, as described by keyrings(7). Keys are immutable.
+//
+// +stateify savable
+type Key struct {
+	// ID is the key's serial number.
+	ID int32
+
+	// Type is the name of the key's type, e.g. KeyTypeKeyring.
+	Type string
+
+	// Description is the key's description, used to search for it.
+	Description string
+
+	// UID and GID own the key.
+	UID auth.KUID
+	GID auth.KGID
+
+	// Perm is the key's permission mask, made of linux.KEY_* permissions.
+	Perm uint32
+}
+
+// KeyUser summarizes the keys owned by a user, as reported by
+// /proc/key-users.
+type KeyUser struct {
+	// UID is the user.
+	UID auth.KUID
+
+	// Keys is the number of keys owned by the user.
+	Keys int
+
+	// Bytes is the number of bytes charged to the user's quota.
+	Bytes int
+}
+
+// KeyRegistry holds the kernel's keys.
+//
+// Currently, it contains only the default session keyring of each user, which
+// is created along with the user's first task. These keyrings are never
+// linked to other keys.
+//
+// +stateify savable
+type KeyRegistry struct {
+	// mu protects the below.
+	mu sync.Mutex `state:"nosave"`
+
+	// keys maps serial numbers to keys. It is lazily initialized.
+	keys map[int32]*Key
+
+	// sessionKeyrings maps users to their default session keyring. It is
+	// lazily initialized.
+	sessionKeyrings map[auth.KUID]*Key
+}
+
+// SessionKeyring returns the default session keyring of the user of creds,
+// creating it if necessary.
+func (r *KeyRegistry) SessionKeyring(creds *auth.Credentials) *Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.sessionKeyrings[creds.RealKUID]; ok {
+		return key
+	}
+	if r.keys == nil {
+		r.keys = make(map[int32]*Key)
+		r.sessionKeyrings = make(map[auth.KUID]*Key)
+	}
+	key := &Key{
+		ID:          r.newIDLocked(),
+		Type:        KeyTypeKeyring,
+		Description: fmt.Sprintf("_uid_ses.%d", creds.RealKUID),
+		UID:         creds.RealKUID,
+		GID:         creds.RealKGID,
+		Perm:        linux.KEY_POS_ALL | linux.KEY_USR_VIEW | linux.KEY_USR_READ,
+	}
+	r.keys[key.ID] = key
+	r.sessionKeyrings[creds.RealKUID] = key
+	return key
+}
+
+// newIDLocked returns an unused serial number. Like Linux, serial numbers are
+// random, and the small positive ones are reserved.
+//
+// Preconditions: r.mu must be locked.
+func (r *KeyRegistry) newIDLocked() int32 {
+	for {
+		id := rand.Int31()
+		if _, ok := r.keys[id]; id >= 3 && !ok {
+			return id
+		}
+	}
+}
+
+// ViewableKeys returns the keys that creds may view, sorted by serial number.
+func (r *KeyRegistry) ViewableKeys(creds *auth.Credentials) []*Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var keys []*Key
+	for _, key := range r.keys {
+		if r.permLocked(key, creds)&linux.KEY_OTH_VIEW != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// permLocked returns the permissions that creds has on key, shifted into the
+// linux.KEY_OTH_* bits. See Linux's security/keys/permission.c:key_task_permission.
+//
+// Preconditions: r.mu must be locked.
+func (r *KeyRegistry) permLocked(key *Key, creds *auth.Credentials) uint32 {
+	var perm uint32
+	switch {
+	case key.UID == creds.EffectiveKUID:
+		perm = key.Perm >> 16
+	case creds.InGroup(key.GID):
+		perm = key.Perm >> 8
+	default:
+		perm = key.Perm
+	}
+	// Tasks possess the keyrings they are subscribed to.
+	if r.sessionKeyrings[creds.RealKUID] == key {
+		perm |= key.Perm >> 24
+	}
+	return perm
+}
+
+// Users returns the users that own keys, sorted by UID.
+func (r *KeyRegistry) Users() []KeyUser {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make(map[auth.KUID]*KeyUser)
+	for _, key := range r.keys {
+		user, ok := users[key.UID]
+		if !ok {
+			user = &KeyUser{UID: key.UID}
+			users[key.UID] = user
+		}
+		user.Keys++
+		user.Bytes += len(key.Description)
+	}
+	ret := make([]KeyUser, 0, len(users))
+	for _, user := range users {
+		ret = append(ret, *user)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].UID < ret[j].UID })
+	return ret
+}
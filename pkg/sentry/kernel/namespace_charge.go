@@ -0,0 +1,91 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// namespaceCharge counts a namespace created by clone(2) or unshare(2)
+// against the limit set by /proc/sys/user for its type, like the ucounts
+// field of Linux's struct uts_namespace, ipc_namespace and net. The namespace
+// is counted while tasks are in it.
+//
+// A nil *namespaceCharge counts nothing. Namespaces that aren't created by
+// tasks, such as the root namespaces, have none.
+//
+// +stateify savable
+type namespaceCharge struct {
+	// refs is the number of references held on the charge by the tasks in
+	// the namespace, and by its creator until the creator is done with it.
+	// refs is accessed using atomic memory operations.
+	refs int64
+
+	// userns is the user namespace that owns the namespace, in which it is
+	// counted. A reference is held on userns while refs is positive. userns
+	// is immutable.
+	userns *auth.UserNamespace
+
+	// uid is the effective user of the namespace's creator. It is
+	// immutable.
+	uid auth.KUID
+
+	// typ is the type of the namespace. It is immutable.
+	typ auth.UCountType
+}
+
+// newNamespaceCharge counts a new namespace of type typ, owned by userns and
+// created by a caller with credentials creds. It returns ENOSPC if that would
+// exceed the limit. The caller holds a reference on the returned charge.
+func newNamespaceCharge(creds *auth.Credentials, userns *auth.UserNamespace, typ auth.UCountType) (*namespaceCharge, error) {
+	// "ENOSPC (since Linux 4.9): One of the values in flags specified the
+	// creation of a new namespace, but doing so would have caused the limit
+	// defined by the corresponding file in /proc/sys/user to be exceeded." -
+	// clone(2)
+	if err := userns.IncUCount(creds.EffectiveKUID, typ); err != nil {
+		return nil, err
+	}
+	userns.IncRef()
+	return &namespaceCharge{
+		refs:   1,
+		userns: userns,
+		uid:    creds.EffectiveKUID,
+		typ:    typ,
+	}, nil
+}
+
+// IncRef takes a reference on nc.
+func (nc *namespaceCharge) IncRef() {
+	if nc != nil {
+		atomic.AddInt64(&nc.refs, 1)
+	}
+}
+
+// DecRef drops a reference on nc. When the last reference is dropped, the
+// namespace stops being counted.
+func (nc *namespaceCharge) DecRef() {
+	if nc == nil {
+		return
+	}
+	switch refs := atomic.AddInt64(&nc.refs, -1); {
+	case refs == 0:
+		nc.userns.DecUCount(nc.uid, nc.typ)
+		nc.userns.DecRef()
+	case refs < 0:
+		panic("namespaceCharge.refs < 0")
+	}
+}
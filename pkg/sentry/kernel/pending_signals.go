@@ -140,3 +140,12 @@ func (p *pendingSignals) discardSpecific(sig linux.Signal) {
 	q.length = 0
 	p.pendingSet &^= linux.SignalSetOf(sig)
 }
+
+// queued returns the number of pending signals.
+func (p *pendingSignals) queued() int {
+	var n int
+	for i := range p.signals {
+		n += p.signals[i].length
+	}
+	return n
+}
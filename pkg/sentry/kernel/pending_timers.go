@@ -0,0 +1,106 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+)
+
+// A PendingTimer is a snapshot of an enabled timer, as listed by
+// /proc/timer_list.
+type PendingTimer struct {
+	// Clock is the clock that drives the timer.
+	Clock ktime.Clock
+
+	// Expires is the time of the timer's next expiration, according to
+	// Clock. It may be in the past if the expiration hasn't been processed
+	// yet.
+	Expires ktime.Time
+
+	// Period is the period of periodic timers, or 0.
+	Period time.Duration
+
+	// Function is the Linux function that handles the expirations of the
+	// equivalent Linux timer, e.g. "hrtimer_wakeup" for timers that wake
+	// blocked tasks.
+	Function string
+
+	// Site is the Linux symbol of the function that started the equivalent
+	// Linux timer. For timers that wake blocked tasks, it is the wait channel
+	// of the task, e.g. "hrtimer_nanosleep", or "" if it isn't known.
+	Site string
+
+	// Task is the blocked task for timers that wake blocked tasks, and the
+	// leader of the owning thread group for interval timers.
+	Task *Task
+}
+
+// PendingTimers returns the enabled timers of the tasks in k: the timers that
+// will wake blocked tasks, and the ITIMER_REAL and POSIX interval timers of
+// thread groups. The timers are sorted by expiration time, then by owner.
+//
+// ITIMER_VIRTUAL and ITIMER_PROF, which don't have Timers, aren't included.
+func (k *Kernel) PendingTimers() []PendingTimer {
+	var timers []PendingTimer
+	add := func(timer *ktime.Timer, function, site string, t *Task) {
+		s := timer.Peek()
+		if !s.Enabled {
+			return
+		}
+		timers = append(timers, PendingTimer{
+			Clock:    timer.Clock(),
+			Expires:  s.Next,
+			Period:   s.Period,
+			Function: function,
+			Site:     site,
+			Task:     t,
+		})
+	}
+
+	for _, t := range k.tasks.Root.Tasks() {
+		if timer := t.wakeTimer(); timer != nil {
+			add(timer, "hrtimer_wakeup", t.WaitChannel(), t)
+		}
+	}
+	for _, tg := range k.tasks.Root.ThreadGroups() {
+		leader := tg.Leader()
+		if leader == nil {
+			continue
+		}
+		add(tg.itimerRealTimer, "it_real_fn", "do_setitimer", leader)
+		tg.timerMu.Lock()
+		ids := make([]linux.TimerID, 0, len(tg.timers))
+		for id := range tg.timers {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			add(tg.timers[id].timer, "posix_timer_fn", "common_timer_set", leader)
+		}
+		tg.timerMu.Unlock()
+	}
+
+	sort.SliceStable(timers, func(i, j int) bool {
+		if timers[i].Expires != timers[j].Expires {
+			return timers[i].Expires.Before(timers[j].Expires)
+		}
+		return timers[i].Task.ThreadID() < timers[j].Task.ThreadID()
+	})
+	return timers
+}
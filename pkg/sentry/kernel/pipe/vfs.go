@@ -15,9 +15,12 @@
 package pipe
 
 import (
+	"fmt"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserror"
@@ -174,6 +177,15 @@ func (fd *VFSPipeFD) Release() {
 	fd.pipe.Notify(event)
 }
 
+// PseudoName implements vfs.PseudoNamer.PseudoName.
+func (fd *VFSPipeFD) PseudoName() string {
+	if fd.pipe.isNamed {
+		// Named pipes are identified by their pathname.
+		return ""
+	}
+	return fmt.Sprintf("pipe:[%d]", fd.vfsfd.InodeID())
+}
+
 // OnClose implements vfs.FileDescriptionImpl.OnClose.
 func (fd *VFSPipeFD) OnClose(_ context.Context) error {
 	return nil
@@ -211,3 +223,115 @@ func (fd *VFSPipeFD) Write(ctx context.Context, src usermem.IOSequence, _ vfs.Wr
 func (fd *VFSPipeFD) Ioctl(ctx context.Context, uio usermem.IO, args arch.SyscallArguments) (uintptr, error) {
 	return fd.pipe.Ioctl(ctx, uio, args)
 }
+
+// NewConnectedVFSPipeFDs returns FileDescriptions for the read and write ends
+// of a new unnamed pipe, as for pipe2(2) with the given status flags. Like
+// NewConnectedPipe, each pipe has its own inode number, which Stat reports and
+// which names the pipe in /proc/[pid]/fd.
+func NewConnectedVFSPipeFDs(ctx context.Context, vfsObj *vfs.VirtualFilesystem, flags uint32) (*vfs.FileDescription, *vfs.FileDescription, error) {
+	var vp VFSPipe
+	initPipe(&vp.pipe, false /* isNamed */, DefaultPipeSize, usermem.PageSize)
+
+	// Unnamed pipes have no pathname, so both ends share an anonymous
+	// Dentry; they are named by VFSPipeFD.PseudoName instead.
+	vd := vfsObj.NewAnonVirtualDentry("pipe")
+	defer vd.DecRef()
+	creds := auth.CredentialsFromContext(ctx)
+	ino := pipeDevice.NextIno()
+
+	r, err := vp.newUnnamedPipeFD(vd, linux.O_RDONLY|flags, ino, creds)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := vp.newUnnamedPipeFD(vd, linux.O_WRONLY|flags, ino, creds)
+	if err != nil {
+		r.DecRef()
+		return nil, nil, err
+	}
+	return r, w, nil
+}
+
+func (vp *VFSPipe) newUnnamedPipeFD(vd vfs.VirtualDentry, flags uint32, ino uint64, creds *auth.Credentials) (*vfs.FileDescription, error) {
+	fd := &unnamedPipeFD{
+		ino: ino,
+		uid: creds.EffectiveKUID,
+		gid: creds.EffectiveKGID,
+	}
+	vp.mu.Lock()
+	pfd, err := vp.open(vd.Dentry(), &fd.vfsfd, flags)
+	vp.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	fd.VFSPipeFD = pfd
+	if err := fd.vfsfd.Init(fd, flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		// fd.vfsfd can't be released, since it wasn't initialized. Close
+		// the end of the pipe opened above directly.
+		if pfd.readable {
+			vp.pipe.rClose()
+		} else {
+			vp.pipe.wClose()
+		}
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// unnamedPipeFD implements vfs.FileDescriptionImpl for the ends of unnamed
+// pipes.
+type unnamedPipeFD struct {
+	vfsfd vfs.FileDescription
+	*VFSPipeFD
+	unnamedPipeFDDefaults
+
+	// ino is the pipe's inode number. ino is immutable.
+	ino uint64
+
+	// uid and gid are the owner of the pipe. They are immutable.
+	uid auth.KUID
+	gid auth.KGID
+}
+
+// unnamedPipeFDDefaults provides the vfs.FileDescriptionImpl methods that
+// VFSPipeFD doesn't implement. It is embedded more deeply than the methods of
+// VFSPipeFD, which take precedence.
+type unnamedPipeFDDefaults struct {
+	vfs.FileDescriptionDefaultImpl
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *unnamedPipeFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	// See fs/pipe.c:get_pipe_inode().
+	return linux.Statx{
+		Mask:    linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK | linux.STATX_UID | linux.STATX_GID | linux.STATX_INO,
+		Blksize: usermem.PageSize,
+		Nlink:   1,
+		UID:     uint32(fd.uid),
+		GID:     uint32(fd.gid),
+		Mode:    uint16(linux.ModeNamedPipe | 0600),
+		Ino:     fd.ino,
+	}, nil
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *unnamedPipeFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) error {
+	return syserror.EPERM
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *unnamedPipeFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	if fd.readable {
+		return fd.pipe.rReadiness() & mask
+	}
+	return fd.pipe.wReadiness() & mask
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *unnamedPipeFD) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	fd.pipe.EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *unnamedPipeFD) EventUnregister(e *waiter.Entry) {
+	fd.pipe.EventUnregister(e)
+}
@@ -76,6 +76,23 @@ func (sh *SignalHandlers) IsIgnored(sig linux.Signal) bool {
 	return ok && sa.Handler == arch.SignalActIgnore
 }
 
+// IgnoredAndCaught returns the set of signals that are ignored and the set of
+// signals that are caught by a handler.
+func (sh *SignalHandlers) IgnoredAndCaught() (ignored, caught linux.SignalSet) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for sig, sa := range sh.actions {
+		switch sa.Handler {
+		case arch.SignalActDefault:
+		case arch.SignalActIgnore:
+			ignored |= linux.SignalSetOf(sig)
+		default:
+			caught |= linux.SignalSetOf(sig)
+		}
+	}
+	return ignored, caught
+}
+
 // dequeueActionLocked returns the SignalAct that should be used to handle sig.
 //
 // Preconditions: sh.mu must be locked.
@@ -88,14 +88,35 @@ type Task struct {
 	goschedSeq sync.SeqCount `state:"nosave"`
 	gosched    TaskGoroutineSchedInfo
 
+	// blockSite is the site at which the task goroutine is blocking, or
+	// would block if it called one of the Task.Block methods, or nil if it
+	// isn't at a block site. It is used to report the task's wait
+	// channel.
+	//
+	// blockSite is owned by the task goroutine.
+	blockSite AtomicPtrBlockSite `state:"nosave"`
+
+	// blockTimer is the timer that wakes the task from the last blocking
+	// call to Task.block, or nil if the call had no timeout. It is used to
+	// list the timers of blocked tasks in /proc/timer_list.
+	//
+	// blockTimer is owned by the task goroutine.
+	blockTimer AtomicPtrTimer `state:"nosave"`
+
 	// yieldCount is the number of times the task goroutine has called
-	// Task.InterruptibleSleepStart, Task.UninterruptibleSleepStart, or
 	// Task.Yield(), voluntarily ceasing execution.
 	//
 	// yieldCount is accessed using atomic memory operations. yieldCount is
 	// owned by the task goroutine.
 	yieldCount uint64
 
+	// blockCount is the number of times the task goroutine has blocked or
+	// stopped, voluntarily ceasing execution until it is resumed.
+	//
+	// blockCount is accessed using atomic memory operations. blockCount is
+	// owned by the task goroutine.
+	blockCount uint64
+
 	// pendingSignals is the set of pending signals that may be handled only by
 	// this task.
 	//
@@ -458,16 +479,6 @@ type Task struct {
 	// cpu is accessed using atomic memory operations.
 	cpu int32
 
-	// This is used to keep track of changes made to a process' priority/niceness.
-	// It is mostly used to provide some reasonable return value from
-	// getpriority(2) after a call to setpriority(2) has been made.
-	// We currently do not actually modify a process' scheduling priority.
-	// NOTE: This represents the userspace view of priority (nice).
-	// This means that the value should be in the range [-20, 19].
-	//
-	// niceness is protected by mu.
-	niceness int
-
 	// This is used to track the numa policy for the current thread. This can be
 	// modified through a set_mempolicy(2) syscall. Since we always report a
 	// single numa node, all policies are no-ops. We only track this information
@@ -489,6 +500,14 @@ type Task struct {
 	// netns is protected by mu. netns is owned by the task goroutine.
 	netns bool
 
+	// netnsCharge counts the task's network namespace against
+	// max_net_namespaces. It is nil if the task isn't in a network namespace
+	// created by a task. The task holds a reference on it.
+	//
+	// netnsCharge is protected by mu. netnsCharge is owned by the task
+	// goroutine.
+	netnsCharge *namespaceCharge
+
 	// If rseqPreempted is true, before the next call to p.Switch(),
 	// interrupt rseq critical regions as defined by rseqAddr and
 	// tg.oldRSeqCritical and write the task goroutine's CPU number to
@@ -638,6 +657,12 @@ func (t *Task) Value(key interface{}) interface{} {
 		return int32(t.ThreadGroup().ID())
 	case fs.CtxRoot:
 		return t.fsContext.RootDirectory()
+	case vfs.CtxRoot:
+		if t.fsContext == nil {
+			// Tasks created by tests may not have an FSContext.
+			return nil
+		}
+		return t.fsContext.RootDirectoryVFS2()
 	case fs.CtxDirentCacheLimiter:
 		return t.k.DirentCacheLimiter
 	case inet.CtxStack:
@@ -17,11 +17,15 @@ package kernel
 // Accounting, limits, timers.
 
 import (
+	"sync/atomic"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // Getitimer implements getitimer(2).
@@ -194,3 +198,86 @@ func (t *Task) MaxRSS(which int32) uint64 {
 		return 0
 	}
 }
+
+// OOMScoreAdj returns the OOM score adjustment of tg.
+func (tg *ThreadGroup) OOMScoreAdj() int32 {
+	return atomic.LoadInt32(&tg.oomScoreAdj)
+}
+
+// WriteOOMScoreAdj sets the OOM score adjustment of t's thread group to adj on
+// behalf of a writer of /proc/[pid]/oom_score_adj with credentials creds. See
+// Linux's fs/proc/base.c:__set_oom_adj().
+//
+// Writers must own t or have CAP_SYS_RESOURCE in its user namespace, and can
+// only lower the adjustment below the last value set with CAP_SYS_RESOURCE
+// if they have it too.
+func (t *Task) WriteOOMScoreAdj(creds *auth.Credentials, adj int32) error {
+	if adj < linux.OOM_SCORE_ADJ_MIN || adj > linux.OOM_SCORE_ADJ_MAX {
+		return syserror.EINVAL
+	}
+	tcreds := t.Credentials()
+	privileged := creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, tcreds.UserNamespace)
+	if creds.EffectiveKUID != tcreds.RealKUID && creds.EffectiveKUID != tcreds.EffectiveKUID && !privileged {
+		return syserror.EPERM
+	}
+
+	t.tg.pidns.owner.mu.Lock()
+	defer t.tg.pidns.owner.mu.Unlock()
+	if adj < atomic.LoadInt32(&t.tg.oomScoreAdjMin) && !privileged {
+		return syserror.EACCES
+	}
+	atomic.StoreInt32(&t.tg.oomScoreAdj, adj)
+	if privileged {
+		atomic.StoreInt32(&t.tg.oomScoreAdjMin, adj)
+	}
+	return nil
+}
+
+// OOMScore returns the badness score of t reported by /proc/[pid]/oom_score,
+// in [0, 1000]. As in Linux's mm/oom_kill.c:oom_badness(), it is the share of
+// the sandbox's memory used by t's resident set, in thousandths, offset by the
+// OOM score adjustment of t's thread group. Tasks that can't be killed score
+// 0.
+func (t *Task) OOMScore() int64 {
+	adj := int64(t.tg.OOMScoreAdj())
+	if adj == linux.OOM_SCORE_ADJ_MIN || t.tg == t.k.GlobalInit() {
+		return 0
+	}
+
+	var (
+		rssPages uint64
+		hasMM    bool
+	)
+	t.WithMuLocked(func(t *Task) {
+		if mm := t.MemoryManager(); mm != nil {
+			rssPages = mm.ResidentSetPages()
+			hasMM = true
+		}
+	})
+	if !hasMM {
+		// Like Linux's kernel threads, tasks without an address space
+		// can't free memory by being killed.
+		return 0
+	}
+
+	// As in /proc/meminfo, the total memory is bounded below by the memory
+	// in use, which is ignored if it can't be determined.
+	mf := t.k.MemoryFile()
+	used, err := mf.TotalUsage()
+	if err != nil {
+		used = 0
+	}
+	totalPages := int64(usage.TotalMemory(mf.TotalSize(), used) / usermem.PageSize)
+	if totalPages == 0 {
+		return 0
+	}
+	points := int64(rssPages) + adj*(totalPages/1000)
+	if points <= 0 {
+		points = 1
+	}
+	score := points * 1000 / totalPages
+	if score > 1000 {
+		score = 1000
+	}
+	return score
+}
@@ -34,7 +34,7 @@ import (
 // expired, and syserror.ErrInterrupted if t is interrupted.
 func (t *Task) BlockWithTimeout(C chan struct{}, haveTimeout bool, timeout time.Duration) (time.Duration, error) {
 	if !haveTimeout {
-		return timeout, t.block(C, nil)
+		return timeout, t.block(C, nil, nil)
 	}
 
 	start := t.Kernel().MonotonicClock().Now()
@@ -68,7 +68,7 @@ func (t *Task) BlockWithTimeout(C chan struct{}, haveTimeout bool, timeout time.
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) BlockWithDeadline(C chan struct{}, haveDeadline bool, deadline ktime.Time) error {
 	if !haveDeadline {
-		return t.block(C, nil)
+		return t.block(C, nil, nil)
 	}
 
 	// Start the timeout timer.
@@ -77,7 +77,7 @@ func (t *Task) BlockWithDeadline(C chan struct{}, haveDeadline bool, deadline kt
 		Next:    deadline,
 	})
 
-	err := t.block(C, t.blockingTimerChan)
+	err := t.block(C, t.blockingTimer, t.blockingTimerChan)
 
 	// Stop the timeout timer and drain the channel.
 	t.blockingTimer.Swap(ktime.Setting{})
@@ -94,11 +94,14 @@ func (t *Task) BlockWithDeadline(C chan struct{}, haveDeadline bool, deadline kt
 // event is received from tchan, and syserror.ErrInterrupted if t is
 // interrupted.
 //
+// timer is the Timer that sends to tchan. It is listed in /proc/timer_list
+// while t is blocked.
+//
 // Most clients should use BlockWithDeadline or BlockWithTimeout instead.
 //
 // Preconditions: The caller must be running on the task goroutine.
-func (t *Task) BlockWithTimer(C <-chan struct{}, tchan <-chan struct{}) error {
-	return t.block(C, tchan)
+func (t *Task) BlockWithTimer(C <-chan struct{}, timer *ktime.Timer, tchan <-chan struct{}) error {
+	return t.block(C, timer, tchan)
 }
 
 // Block blocks t until an event is received from C or t is interrupted. It
@@ -107,12 +110,13 @@ func (t *Task) BlockWithTimer(C <-chan struct{}, tchan <-chan struct{}) error {
 //
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) Block(C <-chan struct{}) error {
-	return t.block(C, nil)
+	return t.block(C, nil, nil)
 }
 
-// block blocks a task on one of many events.
+// block blocks a task on one of many events. If timerChan isn't nil, timer is
+// the Timer that sends to it.
 // N.B. defer is too expensive to be used here.
-func (t *Task) block(C <-chan struct{}, timerChan <-chan struct{}) error {
+func (t *Task) block(C <-chan struct{}, timer *ktime.Timer, timerChan <-chan struct{}) error {
 	// Fast path if the request is already done.
 	select {
 	case <-C:
@@ -120,6 +124,10 @@ func (t *Task) block(C <-chan struct{}, timerChan <-chan struct{}) error {
 	default:
 	}
 
+	// Record the timer that will wake us before becoming visibly blocked,
+	// for /proc/timer_list.
+	t.blockTimer.Store(timer)
+
 	// Deactive our address space, we don't need it.
 	interrupt := t.SleepStart()
 
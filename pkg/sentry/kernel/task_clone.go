@@ -15,8 +15,11 @@
 package kernel
 
 import (
+	"sync/atomic"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -180,23 +183,62 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		if err != nil {
 			return 0, nil, err
 		}
+		// The new task holds its own reference on userns, if it's created.
+		defer userns.DecRef()
 	}
 	if (opts.NewPIDNamespace || opts.NewNetworkNamespace || opts.NewUTSNamespace) && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
 		return 0, nil, syserror.EPERM
 	}
 
+	pidns := t.tg.pidns
+	if t.childPIDNamespace != nil {
+		pidns = t.childPIDNamespace
+	} else if opts.NewPIDNamespace {
+		var err error
+		pidns, err = pidns.NewChildWithCreds(creds, userns)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The new task holds its own reference on pidns, if it's created.
+		defer pidns.DecRef()
+	}
+
 	utsns := t.UTSNamespace()
 	if opts.NewUTSNamespace {
+		var err error
 		// Note that this must happen after NewUserNamespace so we get
 		// the new userns if there is one.
-		utsns = t.UTSNamespace().Clone(userns)
+		utsns, err = t.UTSNamespace().cloneForTask(creds, userns)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The new task holds its own reference on utsns, if it's created.
+		defer utsns.DecRef()
 	}
 
 	ipcns := t.IPCNamespace()
 	if opts.NewIPCNamespace {
+		var err error
 		// Note that "If CLONE_NEWIPC is set, then create the process in a new IPC
 		// namespace"
-		ipcns = NewIPCNamespace(userns)
+		ipcns, err = newChildIPCNamespace(creds, userns)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The new task holds its own reference on ipcns, if it's created.
+		defer ipcns.DecRef()
+	}
+
+	netnsCharge := t.netnsCharge
+	if opts.NewNetworkNamespace {
+		var err error
+		netnsCharge, err = newNamespaceCharge(creds, userns, auth.UCountNetNamespaces)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The new task holds its own reference on netnsCharge, if it's
+		// created.
+		defer netnsCharge.DecRef()
 	}
 
 	tc, err := t.tc.Fork(t, t.k, !opts.NewAddressSpace)
@@ -230,13 +272,6 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		fdTable.IncRef()
 	}
 
-	pidns := t.tg.pidns
-	if t.childPIDNamespace != nil {
-		pidns = t.childPIDNamespace
-	} else if opts.NewPIDNamespace {
-		pidns = pidns.NewChild(userns)
-	}
-
 	tg := t.tg
 	rseqAddr := usermem.Addr(0)
 	rseqSignature := uint32(0)
@@ -247,6 +282,9 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 			sh = sh.Fork()
 		}
 		tg = t.k.NewThreadGroup(tg.mounts, pidns, sh, opts.TerminationSignal, tg.limits.GetCopy())
+		tg.oomScoreAdj = t.tg.OOMScoreAdj()
+		tg.oomScoreAdjMin = atomic.LoadInt32(&t.tg.oomScoreAdjMin)
+		tg.niceness = t.tg.Niceness()
 		rseqAddr = t.rseqAddr
 		rseqSignature = t.rseqSignature
 	}
@@ -259,8 +297,8 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		FSContext:               fsContext,
 		FDTable:                 fdTable,
 		Credentials:             creds,
-		Niceness:                t.Niceness(),
 		NetworkNamespaced:       t.netns,
+		netnsCharge:             netnsCharge,
 		AllowedCPUMask:          t.CPUMask(),
 		UTSNamespace:            utsns,
 		IPCNamespace:            ipcns,
@@ -453,6 +491,8 @@ func (t *Task) Unshare(opts *SharingOptions) error {
 			return err
 		}
 		err = t.SetUserNamespace(newUserNS)
+		// t holds its own reference on newUserNS, if it moved into it.
+		newUserNS.DecRef()
 		if err != nil {
 			return err
 		}
@@ -464,34 +504,71 @@ func (t *Task) Unshare(opts *SharingOptions) error {
 		if !haveCapSysAdmin {
 			return syserror.EPERM
 		}
-		t.childPIDNamespace = t.tg.pidns.NewChild(t.UserNamespace())
+		childPIDNamespace, err := t.tg.pidns.NewChildWithCreds(creds, t.UserNamespace())
+		if err != nil {
+			return err
+		}
+		if t.childPIDNamespace != nil {
+			t.childPIDNamespace.DecRef()
+		}
+		t.childPIDNamespace = childPIDNamespace
 	}
-	t.mu.Lock()
-	// Can't defer unlock: DecRefs must occur without holding t.mu.
+	if (opts.NewNetworkNamespace || opts.NewUTSNamespace || opts.NewIPCNamespace) && !haveCapSysAdmin {
+		return syserror.EPERM
+	}
+	// Create the new namespaces before installing any of them, so that none
+	// is installed if one would exceed its limit. t takes over the
+	// references on them.
+	var netnsCharge *namespaceCharge
 	if opts.NewNetworkNamespace {
-		if !haveCapSysAdmin {
-			t.mu.Unlock()
-			return syserror.EPERM
+		var err error
+		netnsCharge, err = newNamespaceCharge(creds, creds.UserNamespace, auth.UCountNetNamespaces)
+		if err != nil {
+			return err
 		}
-		t.netns = true
 	}
+	var utsns *UTSNamespace
 	if opts.NewUTSNamespace {
-		if !haveCapSysAdmin {
-			t.mu.Unlock()
-			return syserror.EPERM
-		}
+		var err error
 		// Note that this must happen after NewUserNamespace, so the
 		// new user namespace is used if there is one.
-		t.utsns = t.utsns.Clone(creds.UserNamespace)
+		utsns, err = t.UTSNamespace().cloneForTask(creds, creds.UserNamespace)
+		if err != nil {
+			netnsCharge.DecRef()
+			return err
+		}
 	}
+	var ipcns *IPCNamespace
 	if opts.NewIPCNamespace {
-		if !haveCapSysAdmin {
-			t.mu.Unlock()
-			return syserror.EPERM
-		}
+		var err error
 		// Note that "If CLONE_NEWIPC is set, then create the process in a new IPC
 		// namespace"
-		t.ipcns = NewIPCNamespace(creds.UserNamespace)
+		ipcns, err = newChildIPCNamespace(creds, creds.UserNamespace)
+		if err != nil {
+			netnsCharge.DecRef()
+			if utsns != nil {
+				utsns.DecRef()
+			}
+			return err
+		}
+	}
+	t.mu.Lock()
+	// Can't defer unlock: DecRefs must occur without holding t.mu.
+	var oldNetnsCharge *namespaceCharge
+	if opts.NewNetworkNamespace {
+		t.netns = true
+		oldNetnsCharge = t.netnsCharge
+		t.netnsCharge = netnsCharge
+	}
+	var oldUTSNS *UTSNamespace
+	if opts.NewUTSNamespace {
+		oldUTSNS = t.utsns
+		t.utsns = utsns
+	}
+	var oldIPCNS *IPCNamespace
+	if opts.NewIPCNamespace {
+		oldIPCNS = t.ipcns
+		t.ipcns = ipcns
 	}
 	var oldFDTable *FDTable
 	if opts.NewFiles {
@@ -504,6 +581,13 @@ func (t *Task) Unshare(opts *SharingOptions) error {
 		t.fsContext = oldFSContext.Fork()
 	}
 	t.mu.Unlock()
+	oldNetnsCharge.DecRef()
+	if oldUTSNS != nil {
+		oldUTSNS.DecRef()
+	}
+	if oldIPCNS != nil {
+		oldIPCNS.DecRef()
+	}
 	if oldFDTable != nil {
 		oldFDTable.DecRef()
 	}
@@ -122,6 +122,14 @@ func (t *Task) SyscallTable() *SyscallTable {
 	return t.tc.st
 }
 
+// TestOnly_SetSyscallTable sets t's syscall table, so that tests can create
+// tasks without loading an executable.
+//
+// Preconditions: t's task goroutine must not be running.
+func (t *Task) TestOnly_SetSyscallTable(st *SyscallTable) {
+	t.tc.st = st
+}
+
 // Stack returns the userspace stack.
 //
 // Preconditions: The caller must be running on the task goroutine, or t.mu
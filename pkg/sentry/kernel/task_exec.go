@@ -271,3 +271,51 @@ func (t *Task) promoteLocked() {
 	}
 	oldLeader.exitNotifyLocked(false)
 }
+
+// TestOnly_Exec applies the thread group transitions of a successful execve(2)
+// by t, so that tests can observe them without running task goroutines: every
+// other task in t's thread group is reaped, t becomes the thread group leader,
+// and t is renamed to name.
+//
+// Preconditions: No task goroutine in t's thread group may be running.
+func (t *Task) TestOnly_Exec(name string) {
+	t.tg.pidns.owner.mu.Lock()
+	defer t.tg.pidns.owner.mu.Unlock()
+	var others []*Task
+	for other := t.tg.tasks.Front(); other != nil; other = other.Next() {
+		if other != t {
+			others = append(others, other)
+		}
+	}
+	for _, other := range others {
+		other.testOnlyExitLocked()
+	}
+	t.promoteLocked()
+	t.mu.Lock()
+	t.tc.Name = name
+	t.mu.Unlock()
+}
+
+// TestOnly_Exit makes t exit, so that tests can observe it without running
+// task goroutines. t is reaped unless it is traced.
+//
+// Preconditions: No task goroutine in t's thread group may be running. t must
+// not be its thread group's leader.
+func (t *Task) TestOnly_Exit() {
+	t.tg.pidns.owner.mu.Lock()
+	defer t.tg.pidns.owner.mu.Unlock()
+	t.testOnlyExitLocked()
+}
+
+// testOnlyExitLocked makes t a zombie and, unless it is traced, reaps it.
+//
+// Preconditions: The TaskSet mutex must be locked for writing.
+func (t *Task) testOnlyExitLocked() {
+	t.tg.signalHandlers.mu.Lock()
+	t.advanceExitStateLocked(TaskExitNone, TaskExitInitiated)
+	t.tg.activeTasks--
+	t.tg.liveTasks--
+	t.tg.signalHandlers.mu.Unlock()
+	t.advanceExitStateLocked(TaskExitInitiated, TaskExitZombie)
+	t.exitNotifyLocked(false)
+}
@@ -655,9 +655,18 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 			delete(ns.tasks, tid)
 			delete(ns.tids, t)
 			if t == t.tg.leader {
-				delete(ns.tgids, t.tg)
+				ns.removeTGIDLocked(t.tg)
 			}
 		}
+		t.tg.pidns.decRefLocked()
+		if t.childPIDNamespace != nil {
+			t.childPIDNamespace.decRefLocked()
+			t.childPIDNamespace = nil
+		}
+		t.Credentials().UserNamespace.DecRef()
+		t.utsns.DecRef()
+		t.ipcns.DecRef()
+		t.netnsCharge.DecRef()
 		t.tg.exitedCPUStats.Accumulate(t.CPUStats())
 		t.tg.ioUsage.Accumulate(t.ioUsage)
 		t.tg.signalHandlers.mu.Lock()
@@ -860,6 +869,7 @@ func (t *Task) Wait(opts *WaitOptions) (*WaitResult, error) {
 	w, ch := waiter.NewChannelEntry(nil)
 	t.tg.eventQueue.EventRegister(&w, opts.Events)
 	defer t.tg.eventQueue.EventUnregister(&w)
+	defer t.LeaveBlockSite(t.EnterBlockSite(waitBlockSite))
 	for {
 		wr, err := t.waitOnce(opts)
 		if err != ErrNoWaitableEvent {
@@ -425,6 +425,7 @@ func (t *Task) SetUserNamespace(ns *auth.UserNamespace) error {
 		return syserror.EPERM
 	}
 
+	oldNS := creds.UserNamespace
 	creds = creds.Fork() // The credentials object is immutable. See doc for creds.
 	creds.UserNamespace = ns
 	// "The child process created by clone(2) with the CLONE_NEWUSER flag
@@ -442,6 +443,8 @@ func (t *Task) SetUserNamespace(ns *auth.UserNamespace) error {
 	// unshare(2), or setns(2)." - user_namespaces(7)
 	creds.KeepCaps = false
 	t.creds.Store(creds)
+	ns.IncRef()
+	oldNS.DecRef()
 
 	return nil
 }
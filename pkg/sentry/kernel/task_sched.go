@@ -130,6 +130,9 @@ func (t *Task) accountTaskGoroutineEnter(state TaskGoroutineState) {
 	if state != TaskGoroutineRunningApp {
 		// Task is blocking/stopping.
 		t.k.decRunningTasks()
+		if state != TaskGoroutineNonexistent {
+			atomic.AddUint64(&t.blockCount, 1)
+		}
 	}
 }
 
@@ -162,6 +165,18 @@ func (t *Task) TaskGoroutineSchedInfo() TaskGoroutineSchedInfo {
 	return SeqAtomicLoadTaskGoroutineSchedInfo(&t.goschedSeq, &t.gosched)
 }
 
+// TestOnly_AddCPUTime adds user and sys to the time t has spent executing
+// application and sentry code respectively, so that tests can make a task
+// appear busy without running it.
+//
+// Preconditions: t's task goroutine must not be running.
+func (t *Task) TestOnly_AddCPUTime(user, sys time.Duration) {
+	t.goschedSeq.BeginWrite()
+	t.gosched.UserTicks += uint64(user / linux.ClockTick)
+	t.gosched.SysTicks += uint64(sys / linux.ClockTick)
+	t.goschedSeq.EndWrite()
+}
+
 // CPUStats returns the CPU usage statistics of t.
 func (t *Task) CPUStats() usage.CPUStats {
 	return t.cpuStatsAt(t.k.CPUClockNow())
@@ -173,7 +188,7 @@ func (t *Task) cpuStatsAt(now uint64) usage.CPUStats {
 	return usage.CPUStats{
 		UserTime:          time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick)),
 		SysTime:           time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick)),
-		VoluntarySwitches: atomic.LoadUint64(&t.yieldCount),
+		VoluntarySwitches: atomic.LoadUint64(&t.yieldCount) + atomic.LoadUint64(&t.blockCount),
 	}
 }
 
@@ -543,17 +558,20 @@ func (t *Task) StateStatus() string {
 			return "R (running)"
 		}
 	case TaskGoroutineRunningSys, TaskGoroutineRunningApp:
+		// A task that has begun a group or ptrace stop may not have entered
+		// Task.doStop() yet, and may have already notified its parent or
+		// tracer of the stop. Linux sets TASK_STOPPED or TASK_TRACED before
+		// doing so (kernel/signal.c:do_signal_stop(), ptrace_stop()), so
+		// report the task as stopped as well.
+		if status, ok := t.stopStateStatus(); ok {
+			return status
+		}
 		return "R (running)"
 	case TaskGoroutineBlockedInterruptible:
 		return "S (sleeping)"
 	case TaskGoroutineStopped:
-		t.tg.signalHandlers.mu.Lock()
-		defer t.tg.signalHandlers.mu.Unlock()
-		switch t.stop.(type) {
-		case *groupStop:
-			return "T (stopped)"
-		case *ptraceStop:
-			return "t (tracing stop)"
+		if status, ok := t.stopStateStatus(); ok {
+			return status
 		}
 		fallthrough
 	case TaskGoroutineBlockedUninterruptible:
@@ -566,6 +584,22 @@ func (t *Task) StateStatus() string {
 	}
 }
 
+// stopStateStatus returns the representation of the task's state for
+// StateStatus if it is in a group or ptrace stop, and true, or false if it
+// isn't.
+func (t *Task) stopStateStatus() (string, bool) {
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	switch t.stop.(type) {
+	case *groupStop:
+		return "T (stopped)", true
+	case *ptraceStop:
+		return "t (tracing stop)", true
+	default:
+		return "", false
+	}
+}
+
 // CPUMask returns a copy of t's allowed CPU mask.
 func (t *Task) CPUMask() sched.CPUSet {
 	t.mu.Lock()
@@ -631,25 +665,30 @@ func assignCPU(allowed sched.CPUSet, tid ThreadID) (cpu int32) {
 	return cpu
 }
 
-// Niceness returns t's niceness.
-func (t *Task) Niceness() int {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.niceness
+// Niceness returns the niceness of tg.
+func (tg *ThreadGroup) Niceness() int32 {
+	return atomic.LoadInt32(&tg.niceness)
 }
 
-// Priority returns t's priority.
-func (t *Task) Priority() int {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.niceness + 20
+// SetNiceness sets the niceness of tg to n, which is clamped to
+// [linux.MIN_NICE, linux.MAX_NICE] like in Linux.
+func (tg *ThreadGroup) SetNiceness(n int32) {
+	if n < linux.MIN_NICE {
+		n = linux.MIN_NICE
+	} else if n > linux.MAX_NICE {
+		n = linux.MAX_NICE
+	}
+	atomic.StoreInt32(&tg.niceness, n)
 }
 
-// SetNiceness sets t's niceness to n.
-func (t *Task) SetNiceness(n int) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.niceness = n
+// Niceness returns t's niceness, which is shared by its thread group.
+func (t *Task) Niceness() int {
+	return int(t.tg.Niceness())
+}
+
+// Priority returns t's priority, as shown in /proc/[pid]/stat.
+func (t *Task) Priority() int {
+	return t.Niceness() + 20
 }
 
 // NumaPolicy returns t's current numa policy.
@@ -154,6 +154,26 @@ func (t *Task) PendingSignals() linux.SignalSet {
 	return t.pendingSignals.pendingSet | t.tg.pendingSignals.pendingSet
 }
 
+// PendingSignalSets returns the set of signals pending for t alone and the
+// set of signals pending for its whole thread group.
+func (t *Task) PendingSignalSets() (thread, group linux.SignalSet) {
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	return t.pendingSignals.pendingSet, t.tg.pendingSignals.pendingSet
+}
+
+// QueuedSignals returns the number of signals queued for t and for its thread
+// group.
+func (t *Task) QueuedSignals() int {
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	return t.pendingSignals.queued() + t.tg.pendingSignals.queued()
+}
+
 // deliverSignal delivers the given signal and returns the following run state.
 func (t *Task) deliverSignal(info *arch.SignalInfo, act arch.SignalAct) taskRunState {
 	sigact := computeAction(linux.Signal(info.Signo), act)
@@ -328,7 +348,9 @@ func (t *Task) Sigtimedwait(set linux.SignalSet, timeout time.Duration) (*arch.S
 
 	// Wait for a timeout or new signal.
 	t.tg.signalHandlers.mu.Unlock()
+	prevSite := t.EnterBlockSite(sigtimedwaitBlockSite)
 	_, err := t.BlockWithTimeout(nil, true, timeout)
+	t.LeaveBlockSite(prevSite)
 	t.tg.signalHandlers.mu.Lock()
 
 	// Restore the original signal mask.
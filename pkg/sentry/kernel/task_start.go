@@ -61,13 +61,14 @@ type TaskConfig struct {
 	// Credentials is the Credentials of the new task.
 	Credentials *auth.Credentials
 
-	// Niceness is the niceness of the new task.
-	Niceness int
-
 	// If NetworkNamespaced is true, the new task should observe a non-root
 	// network namespace.
 	NetworkNamespaced bool
 
+	// netnsCharge counts the network namespace of the new task, if it was
+	// created by a task.
+	netnsCharge *namespaceCharge
+
 	// AllowedCPUMask contains the cpus that this task can run on.
 	AllowedCPUMask sched.CPUSet
 
@@ -128,8 +129,8 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		ptraceTracees:   make(map[*Task]struct{}),
 		allowedCPUMask:  cfg.AllowedCPUMask.Copy(),
 		ioUsage:         &usage.IO{},
-		niceness:        cfg.Niceness,
 		netns:           cfg.NetworkNamespaced,
+		netnsCharge:     cfg.netnsCharge,
 		utsns:           cfg.UTSNamespace,
 		ipcns:           cfg.IPCNamespace,
 		abstractSockets: cfg.AbstractSocketNamespace,
@@ -140,6 +141,8 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		containerID:     cfg.ContainerID,
 	}
 	t.creds.Store(cfg.Credentials)
+	// Create the user's default session keyring, as seen in /proc/keys.
+	t.k.Keys().SessionKeyring(cfg.Credentials)
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.ptraceTracer.Store((*Task)(nil))
 	// We don't construct t.blockingTimer until Task.run(); see that function
@@ -164,6 +167,11 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 	// Below this point, newTask is expected not to fail (there is no rollback
 	// of assignTIDsLocked or any of the following).
 
+	cfg.Credentials.UserNamespace.IncRef()
+	cfg.UTSNamespace.IncRef()
+	cfg.IPCNamespace.IncRef()
+	cfg.netnsCharge.IncRef()
+
 	// Logging on t's behalf will panic if t.logPrefix hasn't been
 	// initialized. This is the earliest point at which we can do so
 	// (since t now has thread IDs).
@@ -225,16 +233,22 @@ func (ts *TaskSet) assignTIDsLocked(t *Task) error {
 				delete(a.ns.tasks, a.tid)
 				delete(a.ns.tids, t)
 				if t.tg.leader == nil {
-					delete(a.ns.tgids, t.tg)
+					a.ns.removeTGIDLocked(t.tg)
 				}
 			}
+			if len(allocatedTIDs) != 0 {
+				t.tg.pidns.decRefLocked()
+			}
 			return err
 		}
+		if ns == t.tg.pidns {
+			ns.incRefLocked()
+		}
 		ns.tasks[tid] = t
 		ns.tids[t] = tid
 		if t.tg.leader == nil {
 			// New thread group.
-			ns.tgids[t.tg] = tid
+			ns.addTGIDLocked(t.tg, tid)
 		}
 		allocatedTIDs = append(allocatedTIDs, allocatedTID{ns, tid})
 	}
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 func TestTaskCPU(t *testing.T) {
@@ -67,3 +68,88 @@ func TestTaskCPU(t *testing.T) {
 	}
 
 }
+
+func TestWaitChannel(t *testing.T) {
+	site := NewBlockSite("fake_wait")
+	inner := NewBlockSite("fake_wait_inner")
+
+	task := &Task{}
+	prev := task.EnterBlockSite(site)
+	if got := task.WaitChannel(); got != "" {
+		t.Errorf("got WaitChannel() = %q for a running task, want \"\"", got)
+	}
+
+	task.gosched.State = TaskGoroutineBlockedInterruptible
+	if got, want := task.WaitChannel(), "fake_wait"; got != want {
+		t.Errorf("got WaitChannel() = %q, want %q", got, want)
+	}
+
+	// The innermost block site is reported.
+	innerPrev := task.EnterBlockSite(inner)
+	if got, want := task.WaitChannel(), "fake_wait_inner"; got != want {
+		t.Errorf("got WaitChannel() = %q in a nested site, want %q", got, want)
+	}
+	task.LeaveBlockSite(innerPrev)
+	if got, want := task.WaitChannel(), "fake_wait"; got != want {
+		t.Errorf("got WaitChannel() = %q after leaving a nested site, want %q", got, want)
+	}
+
+	task.LeaveBlockSite(prev)
+	if got := task.WaitChannel(); got != "" {
+		t.Errorf("got WaitChannel() = %q outside of any block site, want \"\"", got)
+	}
+}
+
+func TestVoluntarySwitches(t *testing.T) {
+	// The task goroutine isn't running, so start with it counted as a
+	// running task.
+	task := &Task{k: &Kernel{runningTasks: 1}}
+	task.gosched.State = TaskGoroutineRunningSys
+
+	want := uint64(0)
+	for _, state := range []TaskGoroutineState{
+		TaskGoroutineRunningApp,
+		TaskGoroutineBlockedInterruptible,
+		TaskGoroutineBlockedUninterruptible,
+		TaskGoroutineStopped,
+	} {
+		task.accountTaskGoroutineEnter(state)
+		if state != TaskGoroutineRunningApp {
+			want++
+		}
+		// The switch is counted as soon as the task blocks.
+		if got := task.CPUStats().VoluntarySwitches; got != want {
+			t.Errorf("got VoluntarySwitches = %d in state %v, want %d", got, state, want)
+		}
+		task.accountTaskGoroutineLeave(state)
+	}
+
+	task.Yield()
+	want++
+	if got := task.CPUStats().VoluntarySwitches; got != want {
+		t.Errorf("got VoluntarySwitches = %d after Yield, want %d", got, want)
+	}
+}
+
+// BenchmarkTaskBlock measures the cost of a call to Task.block that doesn't
+// take the fast path.
+func BenchmarkTaskBlock(b *testing.B) {
+	// The task goroutine isn't running, so start with it counted as a
+	// running task.
+	task := &Task{
+		k:             &Kernel{runningTasks: 1},
+		interruptChan: make(chan struct{}, 1),
+	}
+	task.gosched.State = TaskGoroutineRunningSys
+	// Each call to block is interrupted, and requeues the interrupt on its
+	// way out.
+	task.interruptSelf()
+	var never chan struct{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := task.block(never, nil, nil); err != syserror.ErrInterrupted {
+			b.Fatalf("got block() = %v, want %v", err, syserror.ErrInterrupted)
+		}
+	}
+}
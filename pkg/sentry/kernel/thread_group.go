@@ -226,6 +226,31 @@ type ThreadGroup struct {
 	// Resource limits for this ThreadGroup. The limits pointer is immutable.
 	limits *limits.LimitSet
 
+	// oomScoreAdj is the thread group's OOM score adjustment, in
+	// [linux.OOM_SCORE_ADJ_MIN, linux.OOM_SCORE_ADJ_MAX]. It is inherited by
+	// the thread groups it creates.
+	//
+	// oomScoreAdj is accessed using atomic memory operations, and is
+	// only mutated with the TaskSet mutex locked.
+	oomScoreAdj int32
+
+	// oomScoreAdjMin is the lowest OOM score adjustment that writers of
+	// /proc/[pid]/oom_score_adj without CAP_SYS_RESOURCE may set. It is
+	// the last value set by a writer with CAP_SYS_RESOURCE, and is
+	// inherited by the thread groups it creates.
+	//
+	// oomScoreAdjMin is accessed using atomic memory operations, and is
+	// only mutated with the TaskSet mutex locked.
+	oomScoreAdjMin int32
+
+	// niceness is the nice value of every task in the thread group, in
+	// [linux.MIN_NICE, linux.MAX_NICE], as set by setpriority(2). It is
+	// only bookkeeping: the sentry doesn't schedule tasks by priority. It is
+	// inherited by the thread groups it creates.
+	//
+	// niceness is accessed using atomic memory operations.
+	niceness int32
+
 	// processGroup is the processGroup for this thread group.
 	//
 	// processGroup is protected by the TaskSet mutex.
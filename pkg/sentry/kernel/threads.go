@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"fmt"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -130,8 +131,21 @@ type PIDNamespace struct {
 	// appropriate capabilities in userns. The userns pointer is immutable.
 	userns *auth.UserNamespace
 
+	// If charged is true, the namespace was created by a task, and is
+	// counted against auth.UCountPIDNamespaces for creator in userns until
+	// it is released. charged and creator are immutable.
+	charged bool
+	creator auth.KUID
+
 	// The following fields are protected by owner.mu.
 
+	// refs is the number of references on a charged namespace, held by its
+	// creator until it hands the namespace off, by tasks in the namespace,
+	// by tasks whose children will be created in the namespace, and by
+	// charged child namespaces. The namespace is released when refs drops
+	// to 0. refs is unused if charged is false.
+	refs int64
+
 	// last is the last ThreadID to be allocated in this namespace.
 	last ThreadID
 
@@ -150,6 +164,11 @@ type PIDNamespace struct {
 	// primarily as an optimization to quickly find all thread groups.
 	tgids map[*ThreadGroup]ThreadID
 
+	// sortedTGIDs holds the values of tgids in increasing order, so that
+	// thread groups can be listed from a given ID without sorting all of
+	// them. It is maintained by addTGIDLocked and removeTGIDLocked.
+	sortedTGIDs []ThreadID
+
 	// sessions is a mapping from SessionIDs in this namespace to sessions
 	// visible in the namespace.
 	sessions map[SessionID]*Session
@@ -198,6 +217,64 @@ func (ns *PIDNamespace) NewChild(userns *auth.UserNamespace) *PIDNamespace {
 	return newPIDNamespace(ns.owner, ns, userns)
 }
 
+// NewChildWithCreds is like NewChild, but creates the namespace on behalf of a
+// task with credentials creds. The namespace is counted against
+// /proc/sys/user/max_pid_namespaces for the effective user of creds in userns
+// until it is released, and NewChildWithCreds returns ENOSPC if that would
+// exceed the limit.
+//
+// The caller holds a reference on the returned namespace, which it must drop
+// with DecRef once tasks have been created in the namespace, or if none will
+// be.
+func (ns *PIDNamespace) NewChildWithCreds(creds *auth.Credentials, userns *auth.UserNamespace) (*PIDNamespace, error) {
+	if err := userns.IncUCount(creds.EffectiveKUID, auth.UCountPIDNamespaces); err != nil {
+		return nil, err
+	}
+	child := newPIDNamespace(ns.owner, ns, userns)
+	child.charged = true
+	child.creator = creds.EffectiveKUID
+	child.refs = 1
+	ns.owner.mu.Lock()
+	ns.incRefLocked()
+	ns.owner.mu.Unlock()
+	return child, nil
+}
+
+// DecRef drops a reference on ns returned by NewChildWithCreds.
+func (ns *PIDNamespace) DecRef() {
+	ns.owner.mu.Lock()
+	defer ns.owner.mu.Unlock()
+	ns.decRefLocked()
+}
+
+// incRefLocked takes a reference on ns, if ns is charged.
+//
+// Preconditions: ns.owner.mu must be locked for writing.
+func (ns *PIDNamespace) incRefLocked() {
+	if ns.charged {
+		ns.refs++
+	}
+}
+
+// decRefLocked drops a reference on ns, if ns is charged. When the last
+// reference is dropped, ns stops being counted against its creator's limit,
+// and drops its reference on its parent.
+//
+// Preconditions: ns.owner.mu must be locked for writing.
+func (ns *PIDNamespace) decRefLocked() {
+	if !ns.charged {
+		return
+	}
+	ns.refs--
+	switch {
+	case ns.refs == 0:
+		ns.userns.DecUCount(ns.creator, auth.UCountPIDNamespaces)
+		ns.parent.decRefLocked()
+	case ns.refs < 0:
+		panic("PIDNamespace.refs < 0")
+	}
+}
+
 // TaskWithID returns the task with thread ID tid in PID namespace ns. If no
 // task has that TID, TaskWithID returns nil.
 func (ns *PIDNamespace) TaskWithID(tid ThreadID) *Task {
@@ -271,6 +348,61 @@ func (ns *PIDNamespace) ThreadGroupsAppend(tgs []*ThreadGroup) []*ThreadGroup {
 	return tgs
 }
 
+// ThreadGroupIDsFrom appends to ids, in increasing order, up to n TGIDs of
+// thread groups in ns that are greater than or equal to start, and returns
+// the extended slice.
+func (ns *PIDNamespace) ThreadGroupIDsFrom(ids []ThreadID, start ThreadID, n int) []ThreadID {
+	ns.owner.mu.RLock()
+	defer ns.owner.mu.RUnlock()
+	i := sort.Search(len(ns.sortedTGIDs), func(i int) bool {
+		return ns.sortedTGIDs[i] >= start
+	})
+	end := len(ns.sortedTGIDs)
+	if n < end-i {
+		end = i + n
+	}
+	return append(ids, ns.sortedTGIDs[i:end]...)
+}
+
+// NumThreadGroups returns the number of thread groups in ns.
+func (ns *PIDNamespace) NumThreadGroups() int {
+	ns.owner.mu.RLock()
+	defer ns.owner.mu.RUnlock()
+	return len(ns.tgids)
+}
+
+// addTGIDLocked makes tg visible in ns with TGID tid.
+//
+// Preconditions: ns.owner.mu must be locked for writing. tg must not be
+// visible in ns.
+func (ns *PIDNamespace) addTGIDLocked(tg *ThreadGroup, tid ThreadID) {
+	ns.tgids[tg] = tid
+	i := sort.Search(len(ns.sortedTGIDs), func(i int) bool {
+		return ns.sortedTGIDs[i] >= tid
+	})
+	ns.sortedTGIDs = append(ns.sortedTGIDs, 0)
+	copy(ns.sortedTGIDs[i+1:], ns.sortedTGIDs[i:])
+	ns.sortedTGIDs[i] = tid
+}
+
+// removeTGIDLocked makes tg invisible in ns.
+//
+// Preconditions: ns.owner.mu must be locked for writing.
+func (ns *PIDNamespace) removeTGIDLocked(tg *ThreadGroup) {
+	tid, ok := ns.tgids[tg]
+	if !ok {
+		return
+	}
+	delete(ns.tgids, tg)
+	i := sort.Search(len(ns.sortedTGIDs), func(i int) bool {
+		return ns.sortedTGIDs[i] >= tid
+	})
+	if i == len(ns.sortedTGIDs) || ns.sortedTGIDs[i] != tid {
+		panic(fmt.Sprintf("TGID %d missing from sorted TGIDs", tid))
+	}
+	ns.sortedTGIDs = append(ns.sortedTGIDs[:i], ns.sortedTGIDs[i+1:]...)
+}
+
 // UserNamespace returns the user namespace associated with PID namespace ns.
 func (ns *PIDNamespace) UserNamespace() *auth.UserNamespace {
 	return ns.userns
@@ -433,7 +565,8 @@ type taskNode struct {
 	// this task becomes unable to create sibling tasks in the same thread
 	// group.)
 	//
-	// childPIDNamespace is exclusive to the task goroutine.
+	// childPIDNamespace is exclusive to the task goroutine. The task holds a
+	// reference on childPIDNamespace, dropped when the task is released.
 	childPIDNamespace *PIDNamespace
 }
 
@@ -464,6 +597,17 @@ func (t *Task) Parent() *Task {
 	return t.parent
 }
 
+// Children returns t's children, in no particular order.
+func (t *Task) Children() []*Task {
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	children := make([]*Task, 0, len(t.children))
+	for child := range t.children {
+		children = append(children, child)
+	}
+	return children
+}
+
 // ThreadID returns t's thread ID in its own PID namespace. If the task is
 // dead, ThreadID returns 0.
 func (t *Task) ThreadID() ThreadID {
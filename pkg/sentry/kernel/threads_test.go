@@ -0,0 +1,243 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+func TestMaxPIDNamespaces(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	creds := auth.NewRootCredentials(userns)
+	root := NewRootPIDNamespace(userns)
+	newTaskSet(root)
+
+	userns.SetUCountMax(auth.UCountPIDNamespaces, 1)
+
+	child, err := root.NewChildWithCreds(creds, userns)
+	if err != nil {
+		t.Fatalf("NewChildWithCreds failed: %v", err)
+	}
+	if _, err := root.NewChildWithCreds(creds, userns); err != syserror.ENOSPC {
+		t.Errorf("NewChildWithCreds at max_pid_namespaces: got error %v, want %v", err, syserror.ENOSPC)
+	}
+	// Namespaces created by another user aren't counted against creds.
+	other := auth.NewUserCredentials(1000, 1000, nil, nil, userns)
+	otherChild, err := root.NewChildWithCreds(other, userns)
+	if err != nil {
+		t.Errorf("NewChildWithCreds by another user failed: %v", err)
+	} else {
+		otherChild.DecRef()
+	}
+
+	// A grandchild is counted in the same user namespace, and keeps child
+	// alive.
+	userns.SetUCountMax(auth.UCountPIDNamespaces, 2)
+	grandchild, err := child.NewChildWithCreds(creds, userns)
+	if err != nil {
+		t.Fatalf("NewChildWithCreds for grandchild failed: %v", err)
+	}
+	child.DecRef()
+	userns.SetUCountMax(auth.UCountPIDNamespaces, 1)
+	if _, err := root.NewChildWithCreds(creds, userns); err != syserror.ENOSPC {
+		t.Errorf("NewChildWithCreds with live grandchild: got error %v, want %v", err, syserror.ENOSPC)
+	}
+
+	// Releasing the grandchild releases both namespaces.
+	grandchild.DecRef()
+	child, err = root.NewChildWithCreds(creds, userns)
+	if err != nil {
+		t.Fatalf("NewChildWithCreds after release failed: %v", err)
+	}
+	child.DecRef()
+}
+
+func TestMaxPIDNamespacesInChildUserNamespace(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	creds := auth.NewRootCredentials(userns)
+	root := NewRootPIDNamespace(userns)
+	newTaskSet(root)
+
+	childUserns, err := creds.NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace failed: %v", err)
+	}
+	userns.SetUCountMax(auth.UCountPIDNamespaces, 1)
+
+	// The limit of the parent user namespace also bounds namespaces created
+	// in the child.
+	child, err := root.NewChildWithCreds(creds, childUserns)
+	if err != nil {
+		t.Fatalf("NewChildWithCreds failed: %v", err)
+	}
+	if _, err := root.NewChildWithCreds(creds, childUserns); err != syserror.ENOSPC {
+		t.Errorf("NewChildWithCreds at parent's max_pid_namespaces: got error %v, want %v", err, syserror.ENOSPC)
+	}
+	child.DecRef()
+	if got, want := childUserns.UCountMax(auth.UCountPIDNamespaces), int32(math.MaxInt32); got != want {
+		t.Errorf("child user namespace max_pid_namespaces: got %d, want %d", got, want)
+	}
+}
+
+func TestMaxUserNamespaces(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	creds := auth.NewRootCredentials(userns)
+	userns.SetUCountMax(auth.UCountUserNamespaces, 1)
+
+	child, err := creds.NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace failed: %v", err)
+	}
+	if _, err := creds.NewChildUserNamespace(); err != syserror.ENOSPC {
+		t.Errorf("NewChildUserNamespace at max_user_namespaces: got error %v, want %v", err, syserror.ENOSPC)
+	}
+
+	// A task in the namespace keeps it counted after its creator is done
+	// with it.
+	child.IncRef()
+	child.DecRef()
+	if _, err := creds.NewChildUserNamespace(); err != syserror.ENOSPC {
+		t.Errorf("NewChildUserNamespace with live child: got error %v, want %v", err, syserror.ENOSPC)
+	}
+
+	child.DecRef()
+	child, err = creds.NewChildUserNamespace()
+	if err != nil {
+		t.Fatalf("NewChildUserNamespace after release failed: %v", err)
+	}
+	child.DecRef()
+}
+
+func TestMaxNamespaces(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	creds := auth.NewRootCredentials(userns)
+	utsns := NewUTSNamespace("hostname", "domain", userns)
+
+	for _, tc := range []struct {
+		name string
+		typ  auth.UCountType
+		// create creates a namespace of type typ, and returns a function
+		// that drops the reference on it.
+		create func() (func(), error)
+	}{
+		{
+			name: "ipc",
+			typ:  auth.UCountIPCNamespaces,
+			create: func() (func(), error) {
+				ns, err := newChildIPCNamespace(creds, userns)
+				if err != nil {
+					return nil, err
+				}
+				return ns.DecRef, nil
+			},
+		},
+		{
+			name: "net",
+			typ:  auth.UCountNetNamespaces,
+			create: func() (func(), error) {
+				nc, err := newNamespaceCharge(creds, userns, auth.UCountNetNamespaces)
+				if err != nil {
+					return nil, err
+				}
+				return nc.DecRef, nil
+			},
+		},
+		{
+			name: "uts",
+			typ:  auth.UCountUTSNamespaces,
+			create: func() (func(), error) {
+				ns, err := utsns.cloneForTask(creds, userns)
+				if err != nil {
+					return nil, err
+				}
+				return ns.DecRef, nil
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			userns.SetUCountMax(tc.typ, 1)
+			defer userns.SetUCountMax(tc.typ, auth.DefaultRootUCountMax)
+
+			release, err := tc.create()
+			if err != nil {
+				t.Fatalf("creating a namespace failed: %v", err)
+			}
+			if _, err := tc.create(); err != syserror.ENOSPC {
+				t.Errorf("creating a namespace at the limit: got error %v, want %v", err, syserror.ENOSPC)
+			}
+			release()
+			release, err = tc.create()
+			if err != nil {
+				t.Fatalf("creating a namespace after release failed: %v", err)
+			}
+			release()
+		})
+	}
+}
+
+func TestThreadGroupIDsFrom(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	ns := NewRootPIDNamespace(userns)
+	newTaskSet(ns)
+
+	ids := func(start ThreadID, n int) []ThreadID {
+		return ns.ThreadGroupIDsFrom(nil, start, n)
+	}
+
+	// Add thread groups out of order.
+	tgs := make(map[ThreadID]*ThreadGroup)
+	ns.owner.mu.Lock()
+	for _, tid := range []ThreadID{5, 1, 9, 3, 7} {
+		tg := &ThreadGroup{}
+		tgs[tid] = tg
+		ns.addTGIDLocked(tg, tid)
+	}
+	ns.owner.mu.Unlock()
+
+	for _, tc := range []struct {
+		start ThreadID
+		n     int
+		want  []ThreadID
+	}{
+		{start: 0, n: 10, want: []ThreadID{1, 3, 5, 7, 9}},
+		{start: 1, n: 2, want: []ThreadID{1, 3}},
+		{start: 4, n: 10, want: []ThreadID{5, 7, 9}},
+		{start: 9, n: 10, want: []ThreadID{9}},
+		{start: 10, n: 10, want: nil},
+		{start: 0, n: 0, want: nil},
+	} {
+		if got := ids(tc.start, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ThreadGroupIDsFrom(nil, %d, %d) = %v, want %v", tc.start, tc.n, got, tc.want)
+		}
+	}
+
+	ns.owner.mu.Lock()
+	ns.removeTGIDLocked(tgs[5])
+	ns.removeTGIDLocked(tgs[1])
+	// Removing a thread group that isn't visible is a no-op.
+	ns.removeTGIDLocked(tgs[1])
+	ns.owner.mu.Unlock()
+	if got, want := ids(0, 10), []ThreadID{3, 7, 9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ThreadGroupIDsFrom(nil, 0, 10) after removal = %v, want %v", got, want)
+	}
+	if got, want := ns.NumThreadGroups(), 3; got != want {
+		t.Errorf("NumThreadGroups() = %d, want %d", got, want)
+	}
+}
@@ -601,6 +601,17 @@ func (t *Timer) Get() (Time, Setting) {
 	return now, s
 }
 
+// Peek returns the Timer's current Setting, without advancing it to the
+// current time or notifying the Timer's listener of expirations. Unlike Get,
+// it may be called on paused Timers, and on destroyed Timers, whose Setting is
+// disabled. The Next time of a Timer whose expirations haven't been processed
+// yet may be in the past.
+func (t *Timer) Peek() Setting {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.setting
+}
+
 // Swap atomically changes the Timer's Setting and returns the Timer's previous
 // Setting and the time (according to the Timer's Clock) at which the snapshot
 // was taken. Setting s.Enabled to true starts the Timer, while setting
@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // Timekeeper manages all of the kernel clocks.
@@ -80,6 +81,11 @@ type Timekeeper struct {
 
 	// wg is used to indicate that the update goroutine has exited.
 	wg sync.WaitGroup `state:"nosave"`
+
+	// clockEvents is used to notify Timers on the Timekeeper's clocks of
+	// discontinuous changes to the clocks. Timers re-register after
+	// restore.
+	clockEvents ktime.ClockEventsQueue `state:"nosave"`
 }
 
 // NewTimekeeper returns a Timekeeper that is automatically kept up-to-date.
@@ -275,6 +281,14 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	return now, err
 }
 
+// NotifyClocksChanged notifies Timers on t's clocks that the clocks changed
+// discontinuously, so that they check for expirations immediately. The host's
+// clocks don't jump, but fake clocks used by tests may call it after each
+// change.
+func (t *Timekeeper) NotifyClocksChanged() {
+	t.clockEvents.Notify(ktime.ClockEventSet)
+}
+
 // BootTime returns the system boot real time.
 func (t *Timekeeper) BootTime() ktime.Time {
 	return t.bootTime
@@ -290,10 +304,6 @@ type timekeeperClock struct {
 
 	// Implements ktime.Clock.WallTimeUntil.
 	ktime.WallRateClock `state:"nosave"`
-
-	// Implements waiter.Waitable. (We have no ability to detect
-	// discontinuities from external changes to CLOCK_REALTIME).
-	ktime.NoClockEvents `state:"nosave"`
 }
 
 // Now implements ktime.Clock.Now.
@@ -304,3 +314,20 @@ func (tc *timekeeperClock) Now() ktime.Time {
 	}
 	return ktime.FromNanoseconds(now)
 }
+
+// Readiness implements waiter.Waitable.Readiness.
+func (tc *timekeeperClock) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return 0
+}
+
+// EventRegister implements waiter.Waitable.EventRegister. Waiters are notified
+// by Timekeeper.NotifyClocksChanged. (We have no ability to detect
+// discontinuities from external changes to CLOCK_REALTIME).
+func (tc *timekeeperClock) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	tc.tk.clockEvents.EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (tc *timekeeperClock) EventUnregister(e *waiter.Entry) {
+	tc.tk.clockEvents.EventUnregister(e)
+}
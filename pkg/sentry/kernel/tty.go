@@ -39,3 +39,17 @@ func (tg *ThreadGroup) TTY() *TTY {
 	defer tg.signalHandlers.mu.Unlock()
 	return tg.tty
 }
+
+// ForegroundTTY returns the thread group's controlling terminal and the
+// foreground process group of its session. If there is no controlling
+// terminal, it returns nil, nil.
+func (tg *ThreadGroup) ForegroundTTY() (*TTY, *ProcessGroup) {
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	tg.signalHandlers.mu.Lock()
+	defer tg.signalHandlers.mu.Unlock()
+	if tg.tty == nil {
+		return nil, nil
+	}
+	return tg.tty, tg.processGroup.session.foreground
+}
@@ -35,6 +35,10 @@ type UTSNamespace struct {
 	//
 	// userns is immutable.
 	userns *auth.UserNamespace
+
+	// charge counts the namespace against max_uts_namespaces. It is nil if
+	// the namespace wasn't created by a task. Immutable.
+	charge *namespaceCharge
 }
 
 // NewUTSNamespace creates a new UTS namespace.
@@ -99,3 +103,27 @@ func (u *UTSNamespace) Clone(userns *auth.UserNamespace) *UTSNamespace {
 		userns:     userns,
 	}
 }
+
+// cloneForTask is like Clone, but the copy is created for a task with
+// credentials creds. It returns ENOSPC if the copy would exceed
+// /proc/sys/user/max_uts_namespaces. The caller holds a reference on the
+// returned namespace.
+func (u *UTSNamespace) cloneForTask(creds *auth.Credentials, userns *auth.UserNamespace) (*UTSNamespace, error) {
+	charge, err := newNamespaceCharge(creds, userns, auth.UCountUTSNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	c := u.Clone(userns)
+	c.charge = charge
+	return c, nil
+}
+
+// IncRef takes a reference on u, held by a task in u.
+func (u *UTSNamespace) IncRef() {
+	u.charge.IncRef()
+}
+
+// DecRef drops a reference on u.
+func (u *UTSNamespace) DecRef() {
+	u.charge.DecRef()
+}
@@ -25,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -70,6 +71,7 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		users:       1,
 		brk:         mm.brk,
 		usageAS:     mm.usageAS,
+		peakAS:      mm.peakAS,
 		dataAS:      mm.dataAS,
 		// "The child does not inherit its parent's memory locks (mlock(2),
 		// mlockall(2))." - fork(2). So lockedAS is 0 and defMLockMode is
@@ -80,9 +82,10 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		envv:                 mm.envv,
 		auxv:                 append(arch.Auxv(nil), mm.auxv...),
 		// IncRef'd below, once we know that there isn't an error.
-		executable:  mm.executable,
-		dumpability: mm.dumpability,
-		aioManager:  aioManager{contexts: make(map[uint64]*AIOContext)},
+		executable:     mm.executable,
+		executableVFS2: mm.executableVFS2,
+		dumpability:    mm.dumpability,
+		aioManager:     aioManager{contexts: make(map[uint64]*AIOContext)},
 	}
 
 	// Copy vmas.
@@ -223,6 +226,9 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 	if mm2.executable != nil {
 		mm2.executable.IncRef()
 	}
+	if mm2.executableVFS2.Ok() {
+		mm2.executableVFS2.IncRef()
+	}
 	return mm2, nil
 }
 
@@ -246,10 +252,15 @@ func (mm *MemoryManager) DecUsers(ctx context.Context) {
 	mm.metadataMu.Lock()
 	exe := mm.executable
 	mm.executable = nil
+	exeVFS2 := mm.executableVFS2
+	mm.executableVFS2 = vfs.VirtualDentry{}
 	mm.metadataMu.Unlock()
 	if exe != nil {
 		exe.DecRef()
 	}
+	if exeVFS2.Ok() {
+		exeVFS2.DecRef()
+	}
 
 	mm.activeMu.Lock()
 	// Sanity check.
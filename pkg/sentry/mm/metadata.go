@@ -15,8 +15,13 @@
 package mm
 
 import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -114,6 +119,79 @@ func (mm *MemoryManager) SetEnvvEnd(a usermem.Addr) {
 	mm.envv.End = a
 }
 
+// BrkRange returns the range between the initial and the current brk.
+func (mm *MemoryManager) BrkRange() usermem.AddrRange {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.brk
+}
+
+// SetMMField implements the address-setting options of prctl(PR_SET_MM): it
+// sets the field identified by opt, one of linux.PR_SET_MM_START_BRK,
+// PR_SET_MM_BRK, PR_SET_MM_ARG_START, PR_SET_MM_ARG_END, PR_SET_MM_ENV_START
+// and PR_SET_MM_ENV_END, to addr. As in Linux, the mappings aren't changed.
+//
+// It returns EINVAL if addr isn't a valid application address or would invert
+// the range the field belongs to, EFAULT if addr is part of the argument or
+// environment vector but isn't mapped, and ENOSPC if the brk would exceed
+// RLIMIT_DATA.
+func (mm *MemoryManager) SetMMField(ctx context.Context, opt int32, addr usermem.Addr) error {
+	mm.metadataMu.Lock()
+	defer mm.metadataMu.Unlock()
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+
+	// Linux: kernel/sys.c:prctl_set_mm()
+	if addr < MMapMinAddr() || addr < mm.layout.MinAddr || addr >= mm.layout.MaxAddr {
+		return syserror.EINVAL
+	}
+
+	brk, argv, envv := mm.brk, mm.argv, mm.envv
+	// vector is the address that must be mapped, if any. Since the end of a
+	// vector is exclusive, its last byte must be mapped.
+	var vector *usermem.AddrRange
+	mapped := addr
+	switch opt {
+	case linux.PR_SET_MM_START_BRK:
+		brk.Start = addr
+	case linux.PR_SET_MM_BRK:
+		brk.End = addr
+	case linux.PR_SET_MM_ARG_START:
+		argv.Start = addr
+		vector = &argv
+	case linux.PR_SET_MM_ARG_END:
+		argv.End = addr
+		vector, mapped = &argv, addr-1
+	case linux.PR_SET_MM_ENV_START:
+		envv.Start = addr
+		vector = &envv
+	case linux.PR_SET_MM_ENV_END:
+		envv.End = addr
+		vector, mapped = &envv, addr-1
+	default:
+		return syserror.EINVAL
+	}
+
+	if vector != nil {
+		if !vector.WellFormed() {
+			return syserror.EINVAL
+		}
+		if !mm.vmas.FindSegment(mapped).Ok() {
+			return syserror.EFAULT
+		}
+	} else {
+		if !brk.WellFormed() {
+			return syserror.EINVAL
+		}
+		if uint64(brk.Length()) > limits.FromContext(ctx).Get(limits.Data).Cur {
+			return syserror.ENOSPC
+		}
+	}
+
+	mm.brk, mm.argv, mm.envv = brk, argv, envv
+	return nil
+}
+
 // Auxv returns the current map of auxiliary vectors.
 func (mm *MemoryManager) Auxv() arch.Auxv {
 	mm.metadataMu.Lock()
@@ -149,21 +227,88 @@ func (mm *MemoryManager) Executable() *fs.Dirent {
 // This takes a reference on d.
 func (mm *MemoryManager) SetExecutable(d *fs.Dirent) {
 	mm.metadataMu.Lock()
+	mm.setExecutableAndUnlock(d, vfs.VirtualDentry{})
+}
+
+// ExecutableVFS2 returns the VFS2 executable, if available.
+//
+// An additional reference will be taken in the case of a non-zero executable,
+// which must be released by the caller.
+func (mm *MemoryManager) ExecutableVFS2() vfs.VirtualDentry {
+	mm.metadataMu.Lock()
+	defer mm.metadataMu.Unlock()
+
+	if mm.executableVFS2.Ok() {
+		mm.executableVFS2.IncRef()
+	}
+	return mm.executableVFS2
+}
+
+// SetExecutableVFS2 sets the VFS2 executable.
+//
+// This takes a reference on vd.
+func (mm *MemoryManager) SetExecutableVFS2(vd vfs.VirtualDentry) {
+	mm.metadataMu.Lock()
+	mm.setExecutableAndUnlock(nil, vd)
+}
 
-	// Grab a new reference.
-	d.IncRef()
+// ChangeExecutable sets the executable, as for prctl(PR_SET_MM_EXE_FILE). It
+// returns EPERM if the executable was already changed this way.
+//
+// This takes a reference on d.
+func (mm *MemoryManager) ChangeExecutable(d *fs.Dirent) error {
+	return mm.changeExecutable(d, vfs.VirtualDentry{})
+}
 
-	// Set the executable.
-	orig := mm.executable
-	mm.executable = d
+// ChangeExecutableVFS2 is like ChangeExecutable, but sets the VFS2
+// executable.
+//
+// This takes a reference on vd.
+func (mm *MemoryManager) ChangeExecutableVFS2(vd vfs.VirtualDentry) error {
+	return mm.changeExecutable(nil, vd)
+}
+
+// changeExecutable implements ChangeExecutable and ChangeExecutableVFS2.
+func (mm *MemoryManager) changeExecutable(d *fs.Dirent, vd vfs.VirtualDentry) error {
+	mm.metadataMu.Lock()
+	if mm.executableChanged {
+		mm.metadataMu.Unlock()
+		return syserror.EPERM
+	}
+	mm.executableChanged = true
+	mm.setExecutableAndUnlock(d, vd)
+	return nil
+}
+
+// setExecutableAndUnlock sets the executable to d and the VFS2 executable to
+// vd, taking references on them, and unlocks mm.metadataMu. Since only one of
+// the executables may be set, either d must be nil or vd must be the zero
+// value.
+//
+// Preconditions: mm.metadataMu must be locked.
+func (mm *MemoryManager) setExecutableAndUnlock(d *fs.Dirent, vd vfs.VirtualDentry) {
+	// Grab new references.
+	if d != nil {
+		d.IncRef()
+	}
+	if vd.Ok() {
+		vd.IncRef()
+	}
+
+	// Set the executable, replacing the executable of either kind.
+	orig, origVFS2 := mm.executable, mm.executableVFS2
+	mm.executable, mm.executableVFS2 = d, vd
 
 	mm.metadataMu.Unlock()
 
-	// Release the old reference.
+	// Release the old references.
 	//
 	// Do this without holding the lock, since it may wind up doing some
 	// I/O to sync the dirent, etc.
 	if orig != nil {
 		orig.DecRef()
 	}
+	if origVFS2.Ok() {
+		origVFS2.DecRef()
+	}
 }
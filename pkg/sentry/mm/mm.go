@@ -41,6 +41,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -103,6 +104,13 @@ type MemoryManager struct {
 	// usageAS is protected by mappingMu.
 	usageAS uint64
 
+	// peakAS is the maximum value of usageAS, like mm_struct->hiwater_vm.
+	//
+	// peakAS should be modified only via updatePeakASLocked.
+	//
+	// peakAS is protected by mappingMu.
+	peakAS uint64
+
 	// lockedAS is the combined size in bytes of all vmas with vma.mlockMode !=
 	// memmap.MLockNone.
 	//
@@ -217,6 +225,21 @@ type MemoryManager struct {
 	// executable is protected by metadataMu.
 	executable *fs.Dirent
 
+	// executableVFS2 is the VFS2 executable for this MemoryManager. Only one
+	// of executable and executableVFS2 is set. If executableVFS2 is not the
+	// zero value, it holds a reference on the VirtualDentry.
+	//
+	// executableVFS2 is protected by metadataMu.
+	//
+	// TODO(gvisor.dev/issue/1624): Replace executable.
+	executableVFS2 vfs.VirtualDentry
+
+	// executableChanged is true if executable was replaced by
+	// prctl(PR_SET_MM_EXE_FILE), which may only happen once.
+	//
+	// executableChanged is protected by metadataMu.
+	executableChanged bool
+
 	// dumpability describes if and how this MemoryManager may be dumped to
 	// userspace.
 	//
@@ -15,11 +15,14 @@
 package mm
 
 import (
+	"strings"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
@@ -68,6 +71,50 @@ func TestUsageASUpdates(t *testing.T) {
 	}
 }
 
+func TestPeakASUpdates(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length: 2 * usermem.PageSize,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	mm.MUnmap(ctx, addr, 2*usermem.PageSize)
+	if got, want := mm.PeakVirtualMemorySize(), uint64(2*usermem.PageSize); got != want {
+		t.Errorf("PeakVirtualMemorySize() = %d after unmapping, want %d", got, want)
+	}
+
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length: 3 * usermem.PageSize,
+	}); err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if got, want := mm.PeakVirtualMemorySize(), uint64(3*usermem.PageSize); got != want {
+		t.Errorf("PeakVirtualMemorySize() = %d, want %d", got, want)
+	}
+}
+
+func TestVirtualStackSize(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	for _, opts := range []memmap.MMapOpts{
+		{Length: 2 * usermem.PageSize, Private: true, GrowsDown: true},
+		{Length: usermem.PageSize, Private: true},
+	} {
+		if _, err := mm.MMap(ctx, opts); err != nil {
+			t.Fatalf("MMap(%+v) got err %v want nil", opts, err)
+		}
+	}
+	if got, want := mm.VirtualStackSize(), uint64(2*usermem.PageSize); got != want {
+		t.Errorf("VirtualStackSize() = %d, want %d", got, want)
+	}
+}
+
 func (mm *MemoryManager) realDataAS() uint64 {
 	var sz uint64
 	for seg := mm.vmas.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
@@ -228,3 +275,331 @@ func TestIOAfterMProtect(t *testing.T) {
 		t.Errorf("CopyOut got %d want 1", n)
 	}
 }
+
+func TestMaxMapCount(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	defer SetMaxMapCount(MaxMapCount())
+	SetMaxMapCount(2)
+
+	// Mappings with different permissions can't be merged, so each creates a
+	// vma.
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   3 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	}); err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if got := mm.vmas.NumSegments(); got != 2 {
+		t.Fatalf("got %d vmas want 2", got)
+	}
+
+	// Another mapping would exceed the limit.
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	}); err != syserror.ENOMEM {
+		t.Errorf("MMap got err %v want ENOMEM", err)
+	}
+
+	// So would splitting the first mapping.
+	if err := mm.MProtect(addr+usermem.PageSize, usermem.PageSize, usermem.ReadWrite, false); err != syserror.ENOMEM {
+		t.Errorf("MProtect got err %v want ENOMEM", err)
+	}
+
+	// Changing the permissions of a whole mapping doesn't split it.
+	if err := mm.MProtect(addr, 3*usermem.PageSize, usermem.Execute, false); err != nil {
+		t.Errorf("MProtect got err %v want nil", err)
+	}
+	if got := mm.vmas.NumSegments(); got != 2 {
+		t.Errorf("got %d vmas want 2", got)
+	}
+
+	// Unmapping the middle of the first mapping would split it.
+	if err := mm.MUnmap(ctx, addr+usermem.PageSize, usermem.PageSize); err != syserror.ENOMEM {
+		t.Errorf("MUnmap got err %v want ENOMEM", err)
+	}
+
+	// So would shrinking it in place without reaching its end.
+	if _, err := mm.MRemap(ctx, addr, 2*usermem.PageSize, usermem.PageSize, MRemapOpts{
+		Move: MRemapNoMove,
+	}); err != syserror.ENOMEM {
+		t.Errorf("MRemap shrink got err %v want ENOMEM", err)
+	}
+
+	// And moving its middle page elsewhere.
+	if _, err := mm.MRemap(ctx, addr+usermem.PageSize, usermem.PageSize, 2*usermem.PageSize, MRemapOpts{
+		Move: MRemapMayMove,
+	}); err != syserror.ENOMEM {
+		t.Errorf("MRemap move got err %v want ENOMEM", err)
+	}
+	if got := mm.vmas.NumSegments(); got != 2 {
+		t.Errorf("got %d vmas want 2", got)
+	}
+
+	// Unmapping the start of a mapping doesn't split it.
+	if err := mm.MUnmap(ctx, addr, usermem.PageSize); err != nil {
+		t.Errorf("MUnmap got err %v want nil", err)
+	}
+	if got := mm.vmas.NumSegments(); got != 2 {
+		t.Errorf("got %d vmas want 2", got)
+	}
+}
+
+func TestMMapMinAddr(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	defer SetMMapMinAddr(MMapMinAddr())
+	min := mm.layout.MinAddr + 16*usermem.PageSize
+	SetMMapMinAddr(min)
+
+	// Fixed mappings below the minimum are rejected.
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Addr:     min - usermem.PageSize,
+		Fixed:    true,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	}); err != syserror.EPERM {
+		t.Errorf("MMap below mmap_min_addr got err %v want EPERM", err)
+	}
+
+	// Fixed mappings at the minimum are allowed.
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Addr:     min,
+		Fixed:    true,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	}); err != nil {
+		t.Errorf("MMap at mmap_min_addr got err %v want nil", err)
+	}
+
+	// Hints below the minimum are ignored.
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Addr:     mm.layout.MinAddr,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if addr < min {
+		t.Errorf("MMap got addr %#x below mmap_min_addr %#x", addr, min)
+	}
+
+	// CAP_SYS_RAWIO bypasses the minimum.
+	rootCtx := contexttest.WithCreds(ctx, auth.NewRootCredentials(auth.NewRootUserNamespace()))
+	if _, err := mm.MMap(rootCtx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Addr:     min - usermem.PageSize,
+		Fixed:    true,
+		Private:  true,
+		Perms:    usermem.Read,
+		MaxPerms: usermem.AnyAccess,
+	}); err != nil {
+		t.Errorf("MMap below mmap_min_addr with CAP_SYS_RAWIO got err %v want nil", err)
+	}
+}
+
+func TestSetMMField(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	defer SetMMapMinAddr(MMapMinAddr())
+	min := mm.layout.MinAddr + 16*usermem.PageSize
+	SetMMapMinAddr(min)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	end := addr + 2*usermem.PageSize
+
+	for _, test := range []struct {
+		name string
+		opt  int32
+		addr usermem.Addr
+		want error
+	}{
+		// Ends are set first, since the ranges are initially empty.
+		{"argv end", linux.PR_SET_MM_ARG_END, addr + usermem.PageSize, nil},
+		{"argv start", linux.PR_SET_MM_ARG_START, addr, nil},
+		{"argv end at end of mapping", linux.PR_SET_MM_ARG_END, end, nil},
+		{"argv end before start", linux.PR_SET_MM_ARG_END, addr - 1, syserror.EINVAL},
+		{"unmapped argv end", linux.PR_SET_MM_ARG_END, end + usermem.PageSize, syserror.EFAULT},
+		{"envv end", linux.PR_SET_MM_ENV_END, end, nil},
+		{"envv start", linux.PR_SET_MM_ENV_START, addr + usermem.PageSize, nil},
+		{"unmapped envv start", linux.PR_SET_MM_ENV_START, end, syserror.EFAULT},
+		{"brk", linux.PR_SET_MM_BRK, end, nil},
+		{"brk start", linux.PR_SET_MM_START_BRK, addr, nil},
+		{"brk before start", linux.PR_SET_MM_BRK, addr - usermem.PageSize, syserror.EINVAL},
+		{"address below mmap_min_addr", linux.PR_SET_MM_ARG_START, min - 1, syserror.EINVAL},
+		{"address above application range", linux.PR_SET_MM_ARG_END, mm.layout.MaxAddr, syserror.EINVAL},
+		{"unsupported field", linux.PR_SET_MM_START_CODE, addr, syserror.EINVAL},
+	} {
+		if err := mm.SetMMField(ctx, test.opt, test.addr); err != test.want {
+			t.Errorf("%s: SetMMField(%d, %#x) got err %v want %v", test.name, test.opt, test.addr, err, test.want)
+		}
+	}
+
+	if got, want := (usermem.AddrRange{mm.ArgvStart(), mm.ArgvEnd()}), (usermem.AddrRange{addr, end}); got != want {
+		t.Errorf("got argv %v want %v", got, want)
+	}
+	if got, want := (usermem.AddrRange{mm.EnvvStart(), mm.EnvvEnd()}), (usermem.AddrRange{addr + usermem.PageSize, end}); got != want {
+		t.Errorf("got envv %v want %v", got, want)
+	}
+	if got, want := mm.BrkRange(), (usermem.AddrRange{addr, end}); got != want {
+		t.Errorf("got brk %v want %v", got, want)
+	}
+}
+
+// smapsFields returns the VmFlags, Rss and Locked fields of the
+// /proc/[pid]/smaps entry for the vma containing addr.
+func smapsFields(ctx context.Context, mm *MemoryManager, addr usermem.Addr) (flags, rss, locked string) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	entry := string(mm.vmaSmapsEntryLocked(ctx, mm.vmas.FindSegment(addr)))
+	for _, line := range strings.Split(entry, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "VmFlags:":
+			flags = strings.Join(fields[1:], " ")
+		case "Rss:":
+			rss = fields[1]
+		case "Locked:":
+			locked = fields[1]
+		}
+	}
+	return flags, rss, locked
+}
+
+func TestSmapsVmFlags(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	for _, test := range []struct {
+		name string
+		opts memmap.MMapOpts
+		// setup is called with the mapping's address, if not nil.
+		setup func(addr usermem.Addr) error
+		want  string
+	}{
+		{
+			name: "private read-write",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			want: "rd wr mr mw me ac",
+		},
+		{
+			name: "private read-only",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.Read, MaxPerms: usermem.AnyAccess},
+			want: "rd mr mw me",
+		},
+		{
+			name: "private read-execute",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.AccessType{Read: true, Execute: true}, MaxPerms: usermem.AnyAccess},
+			want: "rd ex mr mw me",
+		},
+		{
+			name: "shared read-write",
+			opts: memmap.MMapOpts{Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			want: "rd wr sh mr mw me ms",
+		},
+		{
+			name: "shared read-only",
+			opts: memmap.MMapOpts{Perms: usermem.Read, MaxPerms: usermem.Read},
+			want: "rd mr ms",
+		},
+		{
+			name: "grows down",
+			opts: memmap.MMapOpts{Private: true, GrowsDown: true, Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			want: "rd wr mr mw me gd ac",
+		},
+		{
+			name: "mlocked",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			setup: func(addr usermem.Addr) error {
+				if _, err := mm.CopyOut(ctx, addr, []byte{1}, usermem.IOOpts{}); err != nil {
+					return err
+				}
+				return mm.MLock(ctx, addr, usermem.PageSize, memmap.MLockEager)
+			},
+			want: "rd wr mr mw me lo ac",
+		},
+		{
+			name: "mlocked on fault",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			setup: func(addr usermem.Addr) error {
+				return mm.MLock(ctx, addr, usermem.PageSize, memmap.MLockLazy)
+			},
+			want: "rd wr mr mw me lo ac",
+		},
+		{
+			name: "don't fork",
+			opts: memmap.MMapOpts{Private: true, Perms: usermem.ReadWrite, MaxPerms: usermem.AnyAccess},
+			setup: func(addr usermem.Addr) error {
+				return mm.SetDontFork(addr, usermem.PageSize, true)
+			},
+			want: "rd wr mr mw me dc ac",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.opts.Length = usermem.PageSize
+			addr, err := mm.MMap(ctx, test.opts)
+			if err != nil {
+				t.Fatalf("MMap got err %v want nil", err)
+			}
+			defer mm.MUnmap(ctx, addr, usermem.PageSize)
+			if test.setup != nil {
+				if err := test.setup(addr); err != nil {
+					t.Fatalf("setup got err %v want nil", err)
+				}
+			}
+
+			flags, rss, locked := smapsFields(ctx, mm, addr)
+			if flags != test.want {
+				t.Errorf("got VmFlags %q want %q", flags, test.want)
+			}
+			// Locked must account the whole RSS of locked vmas, and nothing
+			// otherwise.
+			wantLocked := "0"
+			if strings.Contains(" "+flags+" ", " lo ") {
+				wantLocked = rss
+			}
+			if locked != wantLocked {
+				t.Errorf("got Locked %s kB want %s kB (Rss %s kB, VmFlags %q)", locked, wantLocked, rss, flags)
+			}
+		})
+	}
+}
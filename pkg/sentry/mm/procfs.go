@@ -289,41 +289,58 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	fmt.Fprintf(b, "Locked:         %8d kB\n", locked/1024)
 
 	b.WriteString("VmFlags: ")
+	for _, flag := range vma.smapsFlagsLocked() {
+		b.WriteString(flag)
+		b.WriteString(" ")
+	}
+	b.WriteString("\n")
+}
+
+// smapsFlagsLocked returns the two-letter codes of the Linux VM_* flags that
+// describe vma, in the order used by Linux's
+// fs/proc/task_mmu.c:show_smap_vma_flags(). Flags that have no code there, or
+// whose state isn't tracked by vma (e.g. MADV_HUGEPAGE hints, which are
+// ignored), are omitted.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (vma *vma) smapsFlagsLocked() []string {
+	var flags []string
 	if vma.realPerms.Read {
-		b.WriteString("rd ")
+		flags = append(flags, "rd")
 	}
 	if vma.realPerms.Write {
-		b.WriteString("wr ")
+		flags = append(flags, "wr")
 	}
 	if vma.realPerms.Execute {
-		b.WriteString("ex ")
+		flags = append(flags, "ex")
 	}
 	if vma.canWriteMappableLocked() { // VM_SHARED
-		b.WriteString("sh ")
+		flags = append(flags, "sh")
 	}
 	if vma.maxPerms.Read {
-		b.WriteString("mr ")
+		flags = append(flags, "mr")
 	}
 	if vma.maxPerms.Write {
-		b.WriteString("mw ")
+		flags = append(flags, "mw")
 	}
 	if vma.maxPerms.Execute {
-		b.WriteString("me ")
+		flags = append(flags, "me")
 	}
 	if !vma.private { // VM_MAYSHARE
-		b.WriteString("ms ")
+		flags = append(flags, "ms")
 	}
 	if vma.growsDown {
-		b.WriteString("gd ")
+		flags = append(flags, "gd")
 	}
+	// VM_LOCKONFAULT, set for memmap.MLockLazy, has no code and is omitted.
 	if vma.mlockMode != memmap.MLockNone { // VM_LOCKED
-		b.WriteString("lo ")
+		flags = append(flags, "lo")
 	}
-	if vma.mlockMode == memmap.MLockLazy { // VM_LOCKONFAULT
-		b.WriteString("?? ") // no explicit encoding in fs/proc/task_mmu.c:show_smap_vma_flags()
+	if vma.dontfork { // VM_DONTCOPY
+		flags = append(flags, "dc")
 	}
 	if vma.private && vma.effectivePerms.Write { // VM_ACCOUNT
-		b.WriteString("ac ")
+		flags = append(flags, "ac")
 	}
-	b.WriteString("\n")
+	return flags
 }
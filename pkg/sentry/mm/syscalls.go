@@ -306,6 +306,9 @@ func (mm *MemoryManager) MUnmap(ctx context.Context, addr usermem.Addr, length u
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
+	if err := mm.checkMapCountLocked(mm.unmapSplitsLocked(ar)); err != nil {
+		return err
+	}
 	mm.unmapLocked(ctx, ar)
 	return nil
 }
@@ -402,7 +405,11 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 				// If oldAddr+oldSize didn't overflow, oldAddr+newSize can't
 				// either.
 				newEnd := oldAddr + usermem.Addr(newSize)
-				mm.unmapLocked(ctx, usermem.AddrRange{newEnd, oldEnd})
+				unmapAR := usermem.AddrRange{newEnd, oldEnd}
+				if err := mm.checkMapCountLocked(mm.unmapSplitsLocked(unmapAR)); err != nil {
+					return 0, err
+				}
+				mm.unmapLocked(ctx, unmapAR)
 			}
 			return oldAddr, nil
 		}
@@ -446,6 +453,24 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 		}
 	}
 
+	// Count the vmas that copying or moving [oldAddr, oldEnd) adds to mm, so
+	// that vm.max_map_count can be checked before anything is unmapped. A copy
+	// adds the new vma. A move replaces the old vma with the new one, but
+	// splits off the parts of the old vma outside of [oldAddr, oldEnd). Like
+	// Linux's mm/mremap.c:move_vma(), this doesn't account for vmas that are
+	// merged or removed.
+	var splits int
+	if oldSize == 0 {
+		splits = 1
+	} else {
+		if vseg.Start() < oldAddr {
+			splits++
+		}
+		if oldEnd < vseg.End() {
+			splits++
+		}
+	}
+
 	// Find a location for the new mapping.
 	var newAR usermem.AddrRange
 	switch opts.Move {
@@ -455,6 +480,9 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 			return 0, err
 		}
 		newAR, _ = newAddr.ToRange(newSize)
+		if err := mm.checkMapCountLocked(splits); err != nil {
+			return 0, err
+		}
 
 	case MRemapMustMove:
 		newAddr := opts.NewAddr
@@ -469,6 +497,9 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 		if (usermem.AddrRange{oldAddr, oldEnd}).Overlaps(newAR) {
 			return 0, syserror.EINVAL
 		}
+		if err := checkMMapMinAddr(ctx, newAddr); err != nil {
+			return 0, err
+		}
 
 		// Check that the new region is valid.
 		_, err := mm.findAvailableLocked(newSize, findAvailableOpts{
@@ -480,6 +511,12 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 			return 0, err
 		}
 
+		// Check against vm.max_map_count, including a vma split by unmapping
+		// the destination.
+		if err := mm.checkMapCountLocked(splits + mm.unmapSplitsLocked(newAR)); err != nil {
+			return 0, err
+		}
+
 		// Unmap any mappings at the destination.
 		mm.unmapLocked(ctx, newAR)
 
@@ -537,6 +574,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 		}
 		vseg := mm.vmas.Insert(mm.vmas.FindGap(newAR.Start), newAR, vma)
 		mm.usageAS += uint64(newAR.Length())
+		mm.updatePeakASLocked()
 		if vma.isPrivateDataLocked() {
 			mm.dataAS += uint64(newAR.Length())
 		}
@@ -569,6 +607,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr usermem.Addr, oldSi
 	mm.vmas.Remove(vseg)
 	vseg = mm.vmas.Insert(mm.vmas.FindGap(newAR.Start), newAR, vma)
 	mm.usageAS = mm.usageAS - uint64(oldAR.Length()) + uint64(newAR.Length())
+	mm.updatePeakASLocked()
 	if vma.isPrivateDataLocked() {
 		mm.dataAS = mm.dataAS - uint64(oldAR.Length()) + uint64(newAR.Length())
 	}
@@ -639,6 +678,20 @@ func (mm *MemoryManager) MProtect(addr usermem.Addr, length uint64, realPerms us
 		}
 	}
 
+	// Check that splitting the vmas at the boundaries of ar won't exceed
+	// vm.max_map_count, as in Linux's mm/mmap.c:__split_vma(). vmas whose
+	// permissions don't change aren't split.
+	var splits int
+	if vseg.Start() < ar.Start && vseg.ValuePtr().realPerms != realPerms {
+		splits++
+	}
+	if lastSeg := mm.vmas.FindSegment(ar.End - 1); lastSeg.Ok() && ar.End < lastSeg.End() && lastSeg.ValuePtr().realPerms != realPerms {
+		splits++
+	}
+	if err := mm.checkMapCountLocked(splits); err != nil {
+		return err
+	}
+
 	mm.activeMu.Lock()
 	defer mm.activeMu.Unlock()
 	defer func() {
@@ -1256,6 +1309,23 @@ func (mm *MemoryManager) VirtualMemorySize() uint64 {
 	return mm.usageAS
 }
 
+// PeakVirtualMemorySize returns the maximum combined length in bytes of all
+// mappings in mm over its lifetime.
+func (mm *MemoryManager) PeakVirtualMemorySize() uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.peakAS
+}
+
+// updatePeakASLocked records mm.usageAS in mm.peakAS if it is a new maximum.
+//
+// Preconditions: mm.mappingMu must be locked for writing.
+func (mm *MemoryManager) updatePeakASLocked() {
+	if mm.usageAS > mm.peakAS {
+		mm.peakAS = mm.usageAS
+	}
+}
+
 // VirtualMemorySizeRange returns the combined length in bytes of all mappings
 // in ar in mm.
 func (mm *MemoryManager) VirtualMemorySizeRange(ar usermem.AddrRange) uint64 {
@@ -1271,6 +1341,13 @@ func (mm *MemoryManager) ResidentSetSize() uint64 {
 	return mm.curRSS
 }
 
+// ResidentSetPages returns the value advertised as mm's RSS in pages. It is
+// the RSS reported by /proc/[pid]/stat, statm and status, which must agree.
+func (mm *MemoryManager) ResidentSetPages() uint64 {
+	// curRSS is the span of pmas, which are page-aligned.
+	return mm.ResidentSetSize() / usermem.PageSize
+}
+
 // MaxResidentSetSize returns the value advertised as mm's max RSS in bytes.
 func (mm *MemoryManager) MaxResidentSetSize() uint64 {
 	mm.activeMu.RLock()
@@ -1278,6 +1355,20 @@ func (mm *MemoryManager) MaxResidentSetSize() uint64 {
 	return mm.maxRSS
 }
 
+// VirtualStackSize returns the combined length in bytes of all mappings in mm
+// that grow down, like mm_struct->stack_vm.
+func (mm *MemoryManager) VirtualStackSize() uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	var size uint64
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		if vseg.ValuePtr().growsDown {
+			size += uint64(vseg.Range().Length())
+		}
+	}
+	return size
+}
+
 // VirtualDataSize returns the size of private data segments in mm.
 func (mm *MemoryManager) VirtualDataSize() uint64 {
 	mm.mappingMu.RLock()
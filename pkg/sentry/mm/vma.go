@@ -16,6 +16,7 @@ package mm
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -27,6 +28,89 @@ import (
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
+// DefaultMaxMapCount is the default maximum number of vmas in a
+// MemoryManager, equivalent to Linux's DEFAULT_MAX_MAP_COUNT.
+const DefaultMaxMapCount = 65530
+
+// maxMapCount is the maximum number of vmas in a MemoryManager. Like Linux's
+// sysctl_max_map_count, it applies to all MemoryManagers. maxMapCount is
+// accessed using atomic memory operations.
+var maxMapCount int32 = DefaultMaxMapCount
+
+// MaxMapCount returns the maximum number of vmas in a MemoryManager, as
+// exposed by /proc/sys/vm/max_map_count.
+func MaxMapCount() int32 {
+	return atomic.LoadInt32(&maxMapCount)
+}
+
+// SetMaxMapCount sets the maximum number of vmas in a MemoryManager. Existing
+// vmas are unaffected, but operations that would create vmas beyond the limit
+// fail with ENOMEM.
+//
+// Preconditions: n >= 0.
+func SetMaxMapCount(n int32) {
+	atomic.StoreInt32(&maxMapCount, n)
+}
+
+// mmapMinAddr is the lowest address at which applications may create
+// mappings without CAP_SYS_RAWIO, in addition to the platform's minimum. Like
+// Linux's dac_mmap_min_addr, it applies to all MemoryManagers. mmapMinAddr is
+// accessed using atomic memory operations.
+var mmapMinAddr uint64
+
+// MMapMinAddr returns the lowest address at which applications may create
+// mappings, as set by SetMMapMinAddr.
+func MMapMinAddr() usermem.Addr {
+	return usermem.Addr(atomic.LoadUint64(&mmapMinAddr))
+}
+
+// SetMMapMinAddr sets the lowest address at which applications may create
+// mappings. Existing mappings are unaffected, but MAP_FIXED mappings below
+// addr fail with EPERM, and other mappings are placed above it.
+//
+// Preconditions: addr must be page-aligned.
+func SetMMapMinAddr(addr usermem.Addr) {
+	atomic.StoreUint64(&mmapMinAddr, uint64(addr))
+}
+
+// checkMMapMinAddr returns EPERM if addr is below MMapMinAddr and ctx lacks
+// CAP_SYS_RAWIO, equivalent to Linux's security/commoncap.c:cap_mmap_addr().
+func checkMMapMinAddr(ctx context.Context, addr usermem.Addr) error {
+	if addr >= MMapMinAddr() {
+		return nil
+	}
+	if creds := auth.CredentialsFromContext(ctx); creds.HasCapabilityIn(linux.CAP_SYS_RAWIO, creds.UserNamespace.Root()) {
+		return nil
+	}
+	return syserror.EPERM
+}
+
+// checkMapCountLocked returns ENOMEM if adding n vmas to mm would exceed
+// MaxMapCount. Operations that don't add vmas (n <= 0) always succeed, even if
+// mm already exceeds a lowered limit.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) checkMapCountLocked(n int) error {
+	if n > 0 && mm.vmas.NumSegments()+n > int(MaxMapCount()) {
+		return syserror.ENOMEM
+	}
+	return nil
+}
+
+// unmapSplitsLocked returns the number of vmas that unmapping ar would add to
+// mm: 1 if ar lies strictly within a single vma, which must be split in two,
+// and 0 otherwise. As in Linux's mm/mmap.c:__do_munmap(), this is the only
+// case in which unmapping can exceed vm.max_map_count; unmapping is otherwise
+// allowed at the limit, so that vmas can be released.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) unmapSplitsLocked(ar usermem.AddrRange) int {
+	if vseg := mm.vmas.FindSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.Start && ar.End < vseg.End() {
+		return 1
+	}
+	return 0
+}
+
 // Preconditions: mm.mappingMu must be locked for writing. opts must be valid
 // as defined by the checks in MMap.
 func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOpts) (vmaIterator, usermem.AddrRange, error) {
@@ -34,6 +118,14 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		panic(fmt.Sprintf("Non-effective MaxPerms %s cannot be enforced", opts.MaxPerms))
 	}
 
+	// Check against vm.mmap_min_addr. Non-fixed mappings are never placed
+	// below it by findAvailableLocked.
+	if opts.Fixed {
+		if err := checkMMapMinAddr(ctx, opts.Addr); err != nil {
+			return vmaIterator{}, usermem.AddrRange{}, err
+		}
+	}
+
 	// Find a usable range.
 	addr, err := mm.findAvailableLocked(opts.Length, findAvailableOpts{
 		Addr:     opts.Addr,
@@ -55,6 +147,12 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		return vmaIterator{}, usermem.AddrRange{}, syserror.ENOMEM
 	}
 
+	// Check against vm.max_map_count. Like Linux's mm/mmap.c:do_mmap(), this
+	// doesn't account for merging with adjacent vmas.
+	if err := mm.checkMapCountLocked(1); err != nil {
+		return vmaIterator{}, usermem.AddrRange{}, err
+	}
+
 	if opts.MLockMode != memmap.MLockNone {
 		// Check against RLIMIT_MEMLOCK.
 		if creds := auth.CredentialsFromContext(ctx); !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, creds.UserNamespace.Root()) {
@@ -114,6 +212,7 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 
 	vseg := mm.vmas.Insert(vgap, ar, v)
 	mm.usageAS += opts.Length
+	mm.updatePeakASLocked()
 	if v.isPrivateDataLocked() {
 		mm.dataAS += opts.Length
 	}
@@ -155,6 +254,11 @@ func (mm *MemoryManager) findAvailableLocked(length uint64, opts findAvailableOp
 	if opts.Map32Bit {
 		allowedAR = allowedAR.Intersect(usermem.AddrRange{map32Start, map32End})
 	}
+	if !opts.Fixed {
+		// Like Linux's mm/mmap.c:arch_get_unmapped_area(), don't place
+		// non-fixed mappings below vm.mmap_min_addr, even if hinted to.
+		allowedAR = allowedAR.Intersect(usermem.AddrRange{MMapMinAddr(), allowedAR.End})
+	}
 
 	// Does the provided suggestion work?
 	if ar, ok := opts.Addr.ToRange(length); ok {
@@ -184,9 +288,9 @@ func (mm *MemoryManager) findAvailableLocked(length uint64, opts findAvailableOp
 		return mm.findLowestAvailableLocked(length, alignment, allowedAR)
 	}
 	if mm.layout.DefaultDirection == arch.MmapBottomUp {
-		return mm.findLowestAvailableLocked(length, alignment, usermem.AddrRange{mm.layout.BottomUpBase, mm.layout.MaxAddr})
+		return mm.findLowestAvailableLocked(length, alignment, usermem.AddrRange{mm.layout.BottomUpBase, mm.layout.MaxAddr}.Intersect(allowedAR))
 	}
-	return mm.findHighestAvailableLocked(length, alignment, usermem.AddrRange{mm.layout.MinAddr, mm.layout.TopDownBase})
+	return mm.findHighestAvailableLocked(length, alignment, usermem.AddrRange{mm.layout.MinAddr, mm.layout.TopDownBase}.Intersect(allowedAR))
 }
 
 func (mm *MemoryManager) applicationAddrRange() usermem.AddrRange {
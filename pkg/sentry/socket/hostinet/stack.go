@@ -350,6 +350,21 @@ func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserror.EACCES
 }
 
+// ConnTrackLimits implements inet.Stack.ConnTrackLimits.
+func (s *Stack) ConnTrackLimits() (inet.ConnTrackLimits, error) {
+	return inet.ConnTrackLimits{}, syserror.ENOENT
+}
+
+// SetConnTrackLimits implements inet.Stack.SetConnTrackLimits.
+func (s *Stack) SetConnTrackLimits(limits inet.ConnTrackLimits) error {
+	return syserror.EACCES
+}
+
+// ConnTrackEntries implements inet.Stack.ConnTrackEntries.
+func (s *Stack) ConnTrackEntries() ([]inet.ConnTrackEntry, error) {
+	return nil, syserror.ENOENT
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
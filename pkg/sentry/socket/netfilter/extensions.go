@@ -16,6 +16,8 @@ package netfilter
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/binary"
@@ -93,3 +95,30 @@ func unmarshalMatcher(match linux.XTEntryMatch, filter iptables.IPHeaderFilter,
 	}
 	return matchMaker.unmarshal(buf, filter)
 }
+
+// portMatchOptions returns the iptables-save options of a matcher for the
+// given source and destination port ranges. Ranges that match any port are
+// omitted, as iptables-save does.
+func portMatchOptions(srcStart, srcEnd, dstStart, dstEnd uint16) string {
+	var opts []string
+	if opt := portRangeOption("--sport", srcStart, srcEnd); opt != "" {
+		opts = append(opts, opt)
+	}
+	if opt := portRangeOption("--dport", dstStart, dstEnd); opt != "" {
+		opts = append(opts, opt)
+	}
+	return strings.Join(opts, " ")
+}
+
+// portRangeOption returns the option for a port range, e.g. "--dport 53" or
+// "--dport 1024:2048", or "" if the range matches any port.
+func portRangeOption(name string, start, end uint16) string {
+	switch {
+	case start == 0 && end == math.MaxUint16:
+		return ""
+	case start == end:
+		return fmt.Sprintf("%s %d", name, start)
+	default:
+		return fmt.Sprintf("%s %d:%d", name, start, end)
+	}
+}
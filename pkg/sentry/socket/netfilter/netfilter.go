@@ -17,8 +17,10 @@
 package netfilter
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/binary"
@@ -26,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/iptables"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -35,6 +38,9 @@ import (
 // shouldn't be reached - an error has occurred if we fall through to one.
 const errorTargetName = "ERROR"
 
+// rejectTargetName is the name of the REJECT extension target.
+const rejectTargetName = "REJECT"
+
 // Metadata is used to verify that we are correctly serializing and
 // deserializing iptables into structs consumable by the iptables tool. We save
 // a metadata struct when the tables are written, and when they are read out we
@@ -166,8 +172,21 @@ func convertNetstackToBinary(tablename string, table iptables.Table) (linux.Kern
 	}
 	copy(entries.Name[:], tablename)
 
+	// Jumps are marshalled as the offset of the rule they jump to, so the
+	// offsets of all rules are computed first.
+	offsets := make([]uint32, len(table.Rules))
+	var offset uint32
+	for ruleIdx, rule := range table.Rules {
+		offsets[ruleIdx] = offset
+		offset += linux.SizeOfIPTEntry + uint32(len(marshalTarget(rule.Target)))
+		for _, matcher := range rule.Matchers {
+			offset += uint32(len(marshalMatcher(matcher)))
+		}
+	}
+
 	for ruleIdx, rule := range table.Rules {
 		nflog("convert to binary: current offset: %d", entries.Size)
+		counters := table.RuleCounter(ruleIdx)
 
 		// Is this a chain entry point?
 		for hook, hookRuleIdx := range table.BuiltinChains {
@@ -181,17 +200,25 @@ func convertNetstackToBinary(tablename string, table iptables.Table) (linux.Kern
 			if underflowRuleIdx == ruleIdx {
 				nflog("convert to binary: found underflow %d at offset %d", underflow, entries.Size)
 				meta.Underflow[underflow] = entries.Size
+				// Linux has an entry per policy, so the packets handled by
+				// the policy of each chain sharing the entry are reported
+				// on it.
+				policy := table.PolicyCounter(underflow)
+				counters.Packets += policy.Packets
+				counters.Bytes += policy.Bytes
 			}
 		}
 
 		// Each rule corresponds to an entry.
 		entry := linux.KernelIPTEntry{
 			IPTEntry: linux.IPTEntry{
-				IP: linux.IPTIP{
-					Protocol: uint16(rule.Filter.Protocol),
-				},
+				IP:           iptipFromFilter(rule.Filter),
 				NextOffset:   linux.SizeOfIPTEntry,
 				TargetOffset: linux.SizeOfIPTEntry,
+				Counters: linux.XTCounters{
+					Pcnt: counters.Packets,
+					Bcnt: counters.Bytes,
+				},
 			},
 		}
 
@@ -209,6 +236,10 @@ func convertNetstackToBinary(tablename string, table iptables.Table) (linux.Kern
 		}
 
 		// Serialize and append the target.
+		if jt, ok := rule.Target.(iptables.JumpTarget); ok {
+			jt.Offset = offsets[jt.RuleNum]
+			rule.Target = jt
+		}
 		serialized := marshalTarget(rule.Target)
 		if len(serialized)%8 != 0 {
 			panic(fmt.Sprintf("target %T is not 64-bit aligned", rule.Target))
@@ -240,6 +271,10 @@ func marshalTarget(target iptables.Target) []byte {
 		return marshalErrorTarget(tg.Name)
 	case iptables.ReturnTarget:
 		return marshalStandardTarget(iptables.RuleReturn)
+	case iptables.JumpTarget:
+		return marshalJumpTarget(tg)
+	case iptables.RejectTarget:
+		return marshalRejectTarget(tg)
 	default:
 		panic(fmt.Errorf("unknown target of type %T", target))
 	}
@@ -260,6 +295,21 @@ func marshalStandardTarget(verdict iptables.RuleVerdict) []byte {
 	return binary.Marshal(ret, usermem.ByteOrder, target)
 }
 
+func marshalJumpTarget(jt iptables.JumpTarget) []byte {
+	nflog("convert to binary: marshalling jump target to offset %d", jt.Offset)
+
+	// Jumps are standard targets whose verdict is the offset to jump to.
+	target := linux.XTStandardTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTStandardTarget,
+		},
+		Verdict: int32(jt.Offset),
+	}
+
+	ret := make([]byte, 0, linux.SizeOfXTStandardTarget)
+	return binary.Marshal(ret, usermem.ByteOrder, target)
+}
+
 func marshalErrorTarget(errorName string) []byte {
 	// This is an error target named error
 	target := linux.XTErrorTarget{
@@ -274,6 +324,21 @@ func marshalErrorTarget(errorName string) []byte {
 	return binary.Marshal(ret, usermem.ByteOrder, target)
 }
 
+func marshalRejectTarget(rt iptables.RejectTarget) []byte {
+	nflog("convert to binary: marshalling reject target with %s", rt.With)
+
+	target := linux.XTRejectTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTRejectTarget,
+		},
+		RejectWith: uint32(rt.With),
+	}
+	copy(target.Target.Name[:], rejectTargetName)
+
+	ret := make([]byte, 0, linux.SizeOfXTRejectTarget)
+	return binary.Marshal(ret, usermem.ByteOrder, target)
+}
+
 // translateFromStandardVerdict translates verdicts the same way as the iptables
 // tool.
 func translateFromStandardVerdict(verdict iptables.RuleVerdict) int32 {
@@ -285,14 +350,21 @@ func translateFromStandardVerdict(verdict iptables.RuleVerdict) int32 {
 	case iptables.RuleReturn:
 		return linux.NF_RETURN
 	default:
-		// TODO(gvisor.dev/issue/170): Support Jump.
+		// Jumps are marshalled by marshalJumpTarget.
 		panic(fmt.Sprintf("unknown standard verdict: %d", verdict))
 	}
 }
 
 // translateToStandardTarget translates from the value in a
-// linux.XTStandardTarget to an iptables.Verdict.
+// linux.XTStandardTarget to an iptables.Target. Like Linux, built-in verdicts
+// are encoded as -verdict-1, so that they are negative, and jumps as the
+// non-negative byte offset of the rule to jump to. The RuleNum of jumps is set
+// once the offsets of all rules are known.
 func translateToStandardTarget(val int32) (iptables.Target, error) {
+	if val >= 0 {
+		return iptables.JumpTarget{Offset: uint32(val)}, nil
+	}
+
 	// TODO(gvisor.dev/issue/170): Support other verdicts.
 	switch val {
 	case -linux.NF_ACCEPT - 1:
@@ -391,6 +463,17 @@ func SetEntries(stack *stack.Stack, optVal []byte) *syserr.Error {
 		}
 		optVal = optVal[targetSize:]
 
+		// Rejected packets are answered by the stack. Like Linux, only
+		// TCP packets can be answered with a reset.
+		if rt, ok := target.(iptables.RejectTarget); ok {
+			if rt.With == iptables.RejectWithTCPReset && filter.Protocol != header.TCPProtocolNumber {
+				nflog("REJECT --reject-with tcp-reset is only valid for TCP rules")
+				return syserr.ErrInvalidArgument
+			}
+			rt.Responder = stack
+			target = rt
+		}
+
 		table.Rules = append(table.Rules, iptables.Rule{
 			Filter:   filter,
 			Target:   target,
@@ -404,6 +487,27 @@ func SetEntries(stack *stack.Stack, optVal []byte) *syserr.Error {
 		}
 	}
 
+	// Resolve the rules that jumps go to from their offsets.
+	for ruleIdx, rule := range table.Rules {
+		jt, ok := rule.Target.(iptables.JumpTarget)
+		if !ok {
+			continue
+		}
+		found := false
+		for i, offset := range offsets {
+			if offset == jt.Offset {
+				jt.RuleNum = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			nflog("jump to offset %d doesn't land on a rule.", jt.Offset)
+			return syserr.ErrInvalidArgument
+		}
+		table.Rules[ruleIdx].Target = jt
+	}
+
 	// Go through the list of supported hooks for this table and, for each
 	// one, set the rule it corresponds to.
 	for hook, _ := range replace.HookEntry {
@@ -432,6 +536,21 @@ func SetEntries(stack *stack.Stack, optVal []byte) *syserr.Error {
 		}
 	}
 
+	// Packets have no output interface at PREROUTING and INPUT, and no input
+	// interface at OUTPUT and POSTROUTING. Like iptables, reject built-in
+	// chain rules that match the missing one.
+	for hook, ruleIdx := range table.BuiltinChains {
+		if ruleIdx == iptables.HookUnset {
+			continue
+		}
+		for ; ruleIdx < table.Underflows[hook]; ruleIdx++ {
+			if !table.Rules[ruleIdx].Filter.ValidForHook(hook) {
+				nflog("rule %d matches an interface that isn't known at hook %v.", ruleIdx, hook)
+				return syserr.ErrInvalidArgument
+			}
+		}
+	}
+
 	// Add the user chains.
 	for ruleIdx, rule := range table.Rules {
 		target, ok := rule.Target.(iptables.UserChainTarget)
@@ -479,6 +598,7 @@ func SetEntries(stack *stack.Stack, optVal []byte) *syserr.Error {
 		Size:       replace.Size,
 	})
 	ipt.Tables[replace.Name.String()] = table
+	ipt.UpdatePriorities()
 	stack.SetIPTables(ipt)
 
 	return nil
@@ -575,6 +695,23 @@ func parseTarget(optVal []byte) (iptables.Target, error) {
 			nflog("set entries: user-defined target %q", name)
 			return iptables.UserChainTarget{Name: name}, nil
 		}
+
+	case rejectTargetName:
+		// Reject target.
+		if len(optVal) != linux.SizeOfXTRejectTarget {
+			return nil, fmt.Errorf("optVal has wrong size for reject target %d", len(optVal))
+		}
+		var rejectTarget linux.XTRejectTarget
+		buf = optVal[:linux.SizeOfXTRejectTarget]
+		binary.Unmarshal(buf, usermem.ByteOrder, &rejectTarget)
+
+		// Like Linux, don't reply with ICMP echo replies.
+		with := rejectTarget.RejectWith
+		if with == linux.IPT_ICMP_ECHOREPLY || with > linux.IPT_ICMP_ADMIN_PROHIBITED {
+			return nil, fmt.Errorf("unsupported REJECT response %d", with)
+		}
+		nflog("set entries: reject target with %d", with)
+		return iptables.RejectTarget{With: iptables.RejectWith(with)}, nil
 	}
 
 	// Unknown target.
@@ -585,25 +722,115 @@ func filterFromIPTIP(iptip linux.IPTIP) (iptables.IPHeaderFilter, error) {
 	if containsUnsupportedFields(iptip) {
 		return iptables.IPHeaderFilter{}, fmt.Errorf("unsupported fields in struct iptip: %+v", iptip)
 	}
-	return iptables.IPHeaderFilter{
-		Protocol: tcpip.TransportProtocolNumber(iptip.Protocol),
-	}, nil
+	filter := iptables.IPHeaderFilter{
+		Protocol:              tcpip.TransportProtocolNumber(iptip.Protocol),
+		SrcInvert:             iptip.InverseFlags&linux.IPT_INV_SRCIP != 0,
+		DstInvert:             iptip.InverseFlags&linux.IPT_INV_DSTIP != 0,
+		InputInterfaceInvert:  iptip.InverseFlags&linux.IPT_INV_VIA_IN != 0,
+		OutputInterfaceInvert: iptip.InverseFlags&linux.IPT_INV_VIA_OUT != 0,
+	}
+	var err error
+	if filter.InputInterface, err = interfaceFromIPTIP(iptip.InputInterface, iptip.InputInterfaceMask); err != nil {
+		return iptables.IPHeaderFilter{}, fmt.Errorf("bad input interface: %v", err)
+	}
+	if filter.OutputInterface, err = interfaceFromIPTIP(iptip.OutputInterface, iptip.OutputInterfaceMask); err != nil {
+		return iptables.IPHeaderFilter{}, fmt.Errorf("bad output interface: %v", err)
+	}
+	// A zero mask matches every address, so the address is only recorded
+	// if the mask isn't zero.
+	var emptyInetAddr = linux.InetAddr{}
+	if iptip.SrcMask != emptyInetAddr {
+		filter.Src = tcpip.Address(iptip.Src[:])
+		filter.SrcMask = tcpip.Address(iptip.SrcMask[:])
+	}
+	if iptip.DstMask != emptyInetAddr {
+		filter.Dst = tcpip.Address(iptip.Dst[:])
+		filter.DstMask = tcpip.Address(iptip.DstMask[:])
+	}
+	return filter, nil
+}
+
+// iptipFromFilter returns the struct ipt_ip describing filter.
+func iptipFromFilter(filter iptables.IPHeaderFilter) linux.IPTIP {
+	iptip := linux.IPTIP{
+		Protocol: uint16(filter.Protocol),
+	}
+	copy(iptip.Src[:], filter.Src)
+	copy(iptip.SrcMask[:], filter.SrcMask)
+	copy(iptip.Dst[:], filter.Dst)
+	copy(iptip.DstMask[:], filter.DstMask)
+	if filter.SrcInvert {
+		iptip.InverseFlags |= linux.IPT_INV_SRCIP
+	}
+	if filter.DstInvert {
+		iptip.InverseFlags |= linux.IPT_INV_DSTIP
+	}
+	iptip.InputInterface, iptip.InputInterfaceMask = interfaceToIPTIP(filter.InputInterface)
+	if filter.InputInterfaceInvert {
+		iptip.InverseFlags |= linux.IPT_INV_VIA_IN
+	}
+	iptip.OutputInterface, iptip.OutputInterfaceMask = interfaceToIPTIP(filter.OutputInterface)
+	if filter.OutputInterfaceInvert {
+		iptip.InverseFlags |= linux.IPT_INV_VIA_OUT
+	}
+	return iptip
+}
+
+// interfaceFromIPTIP returns the filter interface described by name and mask,
+// the interface fields of struct ipt_ip. Only the bytes of name covered by
+// mask are compared with the NIC's name. As set by iptables, the mask of an
+// interface covers its name and terminating NUL, while the mask of a wildcard
+// interface, e.g. "eth+", stops before the "+".
+func interfaceFromIPTIP(name, mask [linux.IFNAMSIZ]byte) (string, error) {
+	n := bytes.IndexByte(name[:], 0)
+	if n == -1 {
+		return "", fmt.Errorf("interface name %q isn't NUL-terminated", name[:])
+	}
+	m := bytes.IndexByte(mask[:], 0)
+	if m == -1 {
+		m = len(mask)
+	}
+	for _, b := range mask[m:] {
+		if b != 0 {
+			return "", fmt.Errorf("unsupported mask %v for interface %q", mask, name[:n])
+		}
+	}
+	switch {
+	case m == 0:
+		// Every interface matches.
+		return "", nil
+	case m == n+1:
+		return string(name[:n]), nil
+	case m <= n:
+		return string(name[:m]) + "+", nil
+	default:
+		return "", fmt.Errorf("mask %v covers more than interface %q", mask, name[:n])
+	}
+}
+
+// interfaceToIPTIP returns the interface fields of struct ipt_ip describing
+// the filter interface ifName, as iptables sets them. It is the inverse of
+// interfaceFromIPTIP.
+func interfaceToIPTIP(ifName string) (name, mask [linux.IFNAMSIZ]byte) {
+	copy(name[:], ifName)
+	m := len(ifName) + 1
+	if ifName == "" {
+		m = 0
+	} else if strings.HasSuffix(ifName, "+") {
+		m = len(ifName) - 1
+	}
+	for i := 0; i < m && i < len(mask); i++ {
+		mask[i] = 0xff
+	}
+	return name, mask
 }
 
 func containsUnsupportedFields(iptip linux.IPTIP) bool {
-	// Currently we check that everything except protocol is zeroed.
-	var emptyInetAddr = linux.InetAddr{}
-	var emptyInterface = [linux.IFNAMSIZ]byte{}
-	return iptip.Dst != emptyInetAddr ||
-		iptip.Src != emptyInetAddr ||
-		iptip.SrcMask != emptyInetAddr ||
-		iptip.DstMask != emptyInetAddr ||
-		iptip.InputInterface != emptyInterface ||
-		iptip.OutputInterface != emptyInterface ||
-		iptip.InputInterfaceMask != emptyInterface ||
-		iptip.OutputInterfaceMask != emptyInterface ||
-		iptip.Flags != 0 ||
-		iptip.InverseFlags != 0
+	// The addresses, the interfaces, their masks and their inverse flags are
+	// supported, as is the protocol. Everything else must be zeroed.
+	const supportedInverseFlags = linux.IPT_INV_SRCIP | linux.IPT_INV_DSTIP | linux.IPT_INV_VIA_IN | linux.IPT_INV_VIA_OUT
+	return iptip.Flags != 0 ||
+		iptip.InverseFlags&^supportedInverseFlags != 0
 }
 
 func validUnderflow(rule iptables.Rule) bool {
@@ -0,0 +1,296 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// standardTarget returns a marshalled linux.XTStandardTarget with verdict.
+func standardTarget(verdict int32) []byte {
+	target := linux.XTStandardTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTStandardTarget,
+		},
+		Verdict: verdict,
+	}
+	return binary.Marshal(nil, usermem.ByteOrder, target)
+}
+
+func TestParseStandardTarget(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		verdict int32
+		want    iptables.Target
+	}{
+		{name: "ACCEPT", verdict: -linux.NF_ACCEPT - 1, want: iptables.AcceptTarget{}},
+		{name: "DROP", verdict: -linux.NF_DROP - 1, want: iptables.DropTarget{}},
+		{name: "RETURN", verdict: linux.NF_RETURN, want: iptables.ReturnTarget{}},
+		{name: "jump to the first rule", verdict: 0, want: iptables.JumpTarget{Offset: 0}},
+		{name: "jump", verdict: 1234, want: iptables.JumpTarget{Offset: 1234}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTarget(standardTarget(tc.verdict))
+			if err != nil {
+				t.Fatalf("parseTarget(verdict %d) failed: %v", tc.verdict, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseTarget(verdict %d) = %#v, want %#v", tc.verdict, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseStandardTargetInvalid(t *testing.T) {
+	for _, verdict := range []int32{
+		-linux.NF_QUEUE - 1,
+		-100,
+	} {
+		if got, err := parseTarget(standardTarget(verdict)); err == nil {
+			t.Errorf("parseTarget(verdict %d) = %#v, want error", verdict, got)
+		}
+	}
+}
+
+func TestMarshalStandardTarget(t *testing.T) {
+	for _, target := range []iptables.Target{
+		iptables.AcceptTarget{},
+		iptables.DropTarget{},
+		iptables.ReturnTarget{},
+		iptables.JumpTarget{Offset: 1234},
+	} {
+		got, err := parseTarget(marshalTarget(target))
+		if err != nil {
+			t.Fatalf("parseTarget(marshalTarget(%#v)) failed: %v", target, err)
+		}
+		if got != target {
+			t.Errorf("parseTarget(marshalTarget(%#v)) = %#v", target, got)
+		}
+	}
+}
+
+// rejectTarget returns a marshalled linux.XTRejectTarget with rejectWith.
+func rejectTarget(rejectWith uint32) []byte {
+	target := linux.XTRejectTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTRejectTarget,
+		},
+		RejectWith: rejectWith,
+	}
+	copy(target.Target.Name[:], rejectTargetName)
+	return binary.Marshal(nil, usermem.ByteOrder, target)
+}
+
+func TestParseRejectTarget(t *testing.T) {
+	for _, tc := range []struct {
+		rejectWith uint32
+		want       iptables.RejectWith
+	}{
+		{rejectWith: linux.IPT_ICMP_NET_UNREACHABLE, want: iptables.RejectWithICMPNetUnreachable},
+		{rejectWith: linux.IPT_ICMP_PORT_UNREACHABLE, want: iptables.RejectWithICMPPortUnreachable},
+		{rejectWith: linux.IPT_TCP_RESET, want: iptables.RejectWithTCPReset},
+		{rejectWith: linux.IPT_ICMP_ADMIN_PROHIBITED, want: iptables.RejectWithICMPAdminProhibited},
+	} {
+		got, err := parseTarget(rejectTarget(tc.rejectWith))
+		if err != nil {
+			t.Fatalf("parseTarget(reject with %d) failed: %v", tc.rejectWith, err)
+		}
+		if want := (iptables.RejectTarget{With: tc.want}); got != want {
+			t.Errorf("parseTarget(reject with %d) = %#v, want %#v", tc.rejectWith, got, want)
+		}
+	}
+}
+
+func TestParseRejectTargetInvalid(t *testing.T) {
+	for _, rejectWith := range []uint32{
+		linux.IPT_ICMP_ECHOREPLY,
+		linux.IPT_ICMP_ADMIN_PROHIBITED + 1,
+	} {
+		if got, err := parseTarget(rejectTarget(rejectWith)); err == nil {
+			t.Errorf("parseTarget(reject with %d) = %#v, want error", rejectWith, got)
+		}
+	}
+}
+
+func TestMarshalRejectTarget(t *testing.T) {
+	target := iptables.RejectTarget{With: iptables.RejectWithTCPReset}
+	got, err := parseTarget(marshalTarget(target))
+	if err != nil {
+		t.Fatalf("parseTarget(marshalTarget(%#v)) failed: %v", target, err)
+	}
+	if got != target {
+		t.Errorf("parseTarget(marshalTarget(%#v)) = %#v", target, got)
+	}
+}
+
+func TestConvertJumpToBinary(t *testing.T) {
+	table := iptables.EmptyFilterTable()
+	table.Rules = []iptables.Rule{
+		{Target: iptables.JumpTarget{RuleNum: 3}},
+		{Target: iptables.AcceptTarget{}},
+		{Target: iptables.UserChainTarget{Name: "chain"}},
+		{Target: iptables.ReturnTarget{}},
+		{Target: iptables.ErrorTarget{}},
+	}
+	table.BuiltinChains[iptables.Input] = 0
+	table.BuiltinChains[iptables.Forward] = 1
+	table.BuiltinChains[iptables.Output] = 1
+	table.Underflows[iptables.Input] = 1
+	table.Underflows[iptables.Forward] = 1
+	table.Underflows[iptables.Output] = 1
+	table.UserChains["chain"] = 3
+
+	entries, _, err := convertNetstackToBinary(iptables.TablenameFilter, table)
+	if err != nil {
+		t.Fatalf("convertNetstackToBinary failed: %v", err)
+	}
+	var wantOffset uint32
+	for _, entry := range entries.Entrytable[:3] {
+		wantOffset += uint32(entry.NextOffset)
+	}
+	jump := entries.Entrytable[0]
+	got, err := parseTarget(jump.Elems[jump.TargetOffset-linux.SizeOfIPTEntry:])
+	if err != nil {
+		t.Fatalf("parseTarget failed: %v", err)
+	}
+	if want := (iptables.JumpTarget{Offset: wantOffset}); got != want {
+		t.Errorf("got jump target %#v, want %#v", got, want)
+	}
+}
+
+func TestConvertCountersToBinary(t *testing.T) {
+	// Every other packet is accepted by rule 0, the others by INPUT's policy.
+	ipt := backendTables(statisticMatcher(t, nthInfo(2, 0)))
+	const packets = 6
+	for i := 0; i < packets; i++ {
+		pkt := udpPacket()
+		if !ipt.Check(iptables.Input, &pkt, "") {
+			t.Fatalf("packet %d was dropped", i)
+		}
+	}
+
+	entries, _, err := convertNetstackToBinary(iptables.TablenameFilter, ipt.Tables[iptables.TablenameFilter])
+	if err != nil {
+		t.Fatalf("convertNetstackToBinary failed: %v", err)
+	}
+	size := uint64(header.IPv4MinimumSize + header.UDPMinimumSize)
+	for i, want := range []linux.XTCounters{
+		{Pcnt: packets / 2, Bcnt: packets / 2 * size},
+		// The policy entry is shared by all built-in chains, but only
+		// INPUT's policy was reached.
+		{Pcnt: packets / 2, Bcnt: packets / 2 * size},
+		{},
+	} {
+		if got := entries.Entrytable[i].Counters; got != want {
+			t.Errorf("got counters %+v for entry %d, want %+v", got, i, want)
+		}
+	}
+}
+
+func TestFilterFromIPTIP(t *testing.T) {
+	iptip := linux.IPTIP{
+		Src:          linux.InetAddr{10, 0, 0, 0},
+		SrcMask:      linux.InetAddr{255, 0, 0, 0},
+		Dst:          linux.InetAddr{192, 168, 1, 1},
+		DstMask:      linux.InetAddr{255, 255, 255, 255},
+		Protocol:     uint16(header.UDPProtocolNumber),
+		InverseFlags: linux.IPT_INV_DSTIP,
+	}
+	filter, err := filterFromIPTIP(iptip)
+	if err != nil {
+		t.Fatalf("filterFromIPTIP(%+v) failed: %v", iptip, err)
+	}
+	want := iptables.IPHeaderFilter{
+		Protocol:  header.UDPProtocolNumber,
+		Src:       "\x0a\x00\x00\x00",
+		SrcMask:   "\xff\x00\x00\x00",
+		Dst:       "\xc0\xa8\x01\x01",
+		DstMask:   "\xff\xff\xff\xff",
+		DstInvert: true,
+	}
+	if filter != want {
+		t.Errorf("filterFromIPTIP(%+v) = %+v, want %+v", iptip, filter, want)
+	}
+	if got := iptipFromFilter(filter); got != iptip {
+		t.Errorf("iptipFromFilter(%+v) = %+v, want %+v", filter, got, iptip)
+	}
+
+	// Addresses with a zero mask match everything, and aren't recorded.
+	if filter, err := filterFromIPTIP(linux.IPTIP{Src: linux.InetAddr{10, 0, 0, 1}}); err != nil || filter != (iptables.IPHeaderFilter{}) {
+		t.Errorf("filterFromIPTIP(unmasked source) = %+v, %v, want empty filter", filter, err)
+	}
+
+	// Other inverse flags aren't supported.
+	if _, err := filterFromIPTIP(linux.IPTIP{InverseFlags: linux.IPT_INV_PROTO}); err == nil {
+		t.Errorf("filterFromIPTIP(IPT_INV_PROTO) succeeded, want error")
+	}
+}
+
+// ifnam returns s as a NUL-padded interface name or mask.
+func ifnam(s string) [linux.IFNAMSIZ]byte {
+	var b [linux.IFNAMSIZ]byte
+	copy(b[:], s)
+	return b
+}
+
+func TestInterfaceFromIPTIP(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mask string
+		want string
+	}{
+		{name: "", mask: "", want: ""},
+		// iptables -i eth0
+		{name: "eth0", mask: "\xff\xff\xff\xff\xff", want: "eth0"},
+		// iptables -i eth+
+		{name: "eth+", mask: "\xff\xff\xff", want: "eth+"},
+		// iptables -i +
+		{name: "+", mask: "", want: ""},
+	} {
+		got, err := interfaceFromIPTIP(ifnam(tc.name), ifnam(tc.mask))
+		if err != nil {
+			t.Fatalf("interfaceFromIPTIP(%q, %q) failed: %v", tc.name, tc.mask, err)
+		}
+		if got != tc.want {
+			t.Errorf("interfaceFromIPTIP(%q, %q) = %q, want %q", tc.name, tc.mask, got, tc.want)
+		}
+		if tc.want == "" {
+			continue
+		}
+		if name, mask := interfaceToIPTIP(got); name != ifnam(tc.name) || mask != ifnam(tc.mask) {
+			t.Errorf("interfaceToIPTIP(%q) = %q, %q, want %q, %q", got, name[:], mask[:], tc.name, tc.mask)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		mask string
+	}{
+		// The mask covers bytes past the terminating NUL.
+		{name: "eth0", mask: "\xff\xff\xff\xff\xff\xff"},
+		// The mask has holes.
+		{name: "eth0", mask: "\xff\x00\xff"},
+	} {
+		if got, err := interfaceFromIPTIP(ifnam(tc.name), ifnam(tc.mask)); err == nil {
+			t.Errorf("interfaceFromIPTIP(%q, %q) = %q, want error", tc.name, tc.mask, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"math"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+)
+
+// splitPacket returns an inbound IPv4 packet for proto whose transport bytes
+// are in Data, split in views at offsets.
+func splitPacket(proto tcpip.TransportProtocolNumber, transport buffer.View, offsets ...int) tcpip.PacketBuffer {
+	ipHdr := header.IPv4(make(buffer.View, header.IPv4MinimumSize))
+	ipHdr.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(header.IPv4MinimumSize + len(transport)),
+		TTL:         64,
+		Protocol:    uint8(proto),
+		SrcAddr:     "\x0a\x00\x00\x01",
+		DstAddr:     "\x0a\x00\x00\x02",
+	})
+	var views []buffer.View
+	prev := 0
+	for _, off := range append(offsets, len(transport)) {
+		views = append(views, append(buffer.View{}, transport[prev:off]...))
+		prev = off
+	}
+	return tcpip.PacketBuffer{
+		NetworkHeader: buffer.View(ipHdr),
+		Data:          buffer.NewVectorisedView(len(transport), views),
+	}
+}
+
+// TestPortMatchersSplitHeader checks that the TCP and UDP matchers find the
+// ports of headers split across views at any offsets.
+func TestPortMatchersSplitHeader(t *testing.T) {
+	// A TCP header with an MSS option, followed by a payload.
+	const tcpHdrLen = header.TCPMinimumSize + 4
+	tcpSeg := header.TCP(make(buffer.View, tcpHdrLen+4))
+	tcpSeg.Encode(&header.TCPFields{
+		SrcPort:    1234,
+		DstPort:    80,
+		DataOffset: tcpHdrLen,
+		Flags:      header.TCPFlagSyn,
+		WindowSize: 1024,
+	})
+	copy(tcpSeg[header.TCPMinimumSize:], []byte{2, 4, 0x05, 0xb4, 'd', 'a', 't', 'a'})
+
+	udpDgram := header.UDP(make(buffer.View, header.UDPMinimumSize+4))
+	udpDgram.Encode(&header.UDPFields{
+		SrcPort: 1234,
+		DstPort: 53,
+		Length:  uint16(len(udpDgram)),
+	})
+	copy(udpDgram[header.UDPMinimumSize:], "data")
+
+	for _, tc := range []struct {
+		name      string
+		proto     tcpip.TransportProtocolNumber
+		transport buffer.View
+		match     iptables.Matcher
+		noMatch   iptables.Matcher
+	}{
+		{
+			name:      "TCP",
+			proto:     header.TCPProtocolNumber,
+			transport: buffer.View(tcpSeg),
+			match: &TCPMatcher{
+				sourcePortStart:      1234,
+				sourcePortEnd:        1234,
+				destinationPortStart: 80,
+				destinationPortEnd:   80,
+			},
+			noMatch: &TCPMatcher{
+				sourcePortStart:      1234,
+				sourcePortEnd:        1234,
+				destinationPortStart: 81,
+				destinationPortEnd:   0xffff,
+			},
+		},
+		{
+			name:      "UDP",
+			proto:     header.UDPProtocolNumber,
+			transport: buffer.View(udpDgram),
+			match: &UDPMatcher{
+				sourcePortStart:      0,
+				sourcePortEnd:        0xffff,
+				destinationPortStart: 53,
+				destinationPortEnd:   53,
+			},
+			noMatch: &UDPMatcher{
+				sourcePortStart:      1,
+				sourcePortEnd:        1233,
+				destinationPortStart: 53,
+				destinationPortEnd:   53,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i <= len(tc.transport); i++ {
+				for j := i; j <= len(tc.transport); j++ {
+					pkt := splitPacket(tc.proto, tc.transport, i, j)
+					if matches, hotdrop := tc.match.Match(iptables.Input, pkt, ""); !matches || hotdrop {
+						t.Errorf("%s.Match(packet split at %d and %d) = %t, %t, want true, false", tc.match, i, j, matches, hotdrop)
+					}
+					if matches, hotdrop := tc.noMatch.Match(iptables.Input, pkt, ""); matches || hotdrop {
+						t.Errorf("%s.Match(packet split at %d and %d) = %t, %t, want false, false", tc.noMatch, i, j, matches, hotdrop)
+					}
+				}
+			}
+
+			// Truncated headers are dropped, however they are split.
+			truncated := tc.transport[:5]
+			for i := 0; i <= len(truncated); i++ {
+				pkt := splitPacket(tc.proto, truncated, i)
+				if matches, hotdrop := tc.match.Match(iptables.Input, pkt, ""); matches || !hotdrop {
+					t.Errorf("%s.Match(truncated packet split at %d) = %t, %t, want false, true", tc.match, i, matches, hotdrop)
+				}
+			}
+		})
+	}
+}
+
+func TestTCPMatcher(t *testing.T) {
+	tcpSeg := header.TCP(make(buffer.View, header.TCPMinimumSize))
+	tcpSeg.Encode(&header.TCPFields{
+		SrcPort:    1234,
+		DstPort:    443,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      header.TCPFlagSyn,
+		WindowSize: 1024,
+	})
+	const synFlags = header.TCPFlagSyn | header.TCPFlagRst | header.TCPFlagAck | header.TCPFlagFin
+
+	for _, tc := range []struct {
+		name    string
+		matcher *TCPMatcher
+		want    bool
+		desc    string
+	}{
+		{
+			name:    "destination port range",
+			matcher: NewTCPMatcher(0, math.MaxUint16, 80, 443, 0, 0),
+			want:    true,
+			desc:    "--dport 80:443",
+		},
+		{
+			name:    "destination port outside range",
+			matcher: NewTCPMatcher(0, math.MaxUint16, 80, 442, 0, 0),
+			want:    false,
+			desc:    "--dport 80:442",
+		},
+		{
+			name:    "SYN",
+			matcher: NewTCPMatcher(0, math.MaxUint16, 443, 443, synFlags, header.TCPFlagSyn),
+			want:    true,
+			desc:    "--dport 443 --tcp-flags FIN,SYN,RST,ACK SYN",
+		},
+		{
+			name:    "SYN-ACK",
+			matcher: NewTCPMatcher(1234, 1234, 0, math.MaxUint16, synFlags, header.TCPFlagSyn|header.TCPFlagAck),
+			want:    false,
+			desc:    "--sport 1234 --tcp-flags FIN,SYN,RST,ACK SYN,ACK",
+		},
+		{
+			name:    "no flags",
+			matcher: NewTCPMatcher(0, math.MaxUint16, 0, math.MaxUint16, header.TCPFlagSyn, 0),
+			want:    false,
+			desc:    "--tcp-flags SYN NONE",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkt := splitPacket(header.TCPProtocolNumber, buffer.View(tcpSeg))
+			if matches, hotdrop := tc.matcher.Match(iptables.Input, pkt, ""); matches != tc.want || hotdrop {
+				t.Errorf("%s.Match() = %t, %t, want %t, false", tc.matcher, matches, hotdrop, tc.want)
+			}
+			if got := tc.matcher.String(); got != tc.desc {
+				t.Errorf("String() = %q, want %q", got, tc.desc)
+			}
+		})
+	}
+}
+
+// TestTCPMatcherNoTransportHeader checks that packets without a transport
+// header, or that aren't TCP, don't match and aren't dropped.
+func TestTCPMatcherNoTransportHeader(t *testing.T) {
+	matcher := NewTCPMatcher(0, math.MaxUint16, 0, math.MaxUint16, 0, 0)
+	for _, tc := range []struct {
+		name string
+		pkt  tcpip.PacketBuffer
+	}{
+		{name: "no header", pkt: splitPacket(header.TCPProtocolNumber, nil)},
+		{name: "UDP", pkt: splitPacket(header.UDPProtocolNumber, make(buffer.View, header.UDPMinimumSize))},
+	} {
+		if matches, hotdrop := matcher.Match(iptables.Input, tc.pkt, ""); matches || hotdrop {
+			t.Errorf("%s: Match() = %t, %t, want false, false", tc.name, matches, hotdrop)
+		}
+	}
+}
+
+// udpPacketWithPorts returns an inbound UDP packet from srcPort to dstPort.
+func udpPacketWithPorts(srcPort, dstPort uint16) tcpip.PacketBuffer {
+	udpDgram := header.UDP(make(buffer.View, header.UDPMinimumSize))
+	udpDgram.Encode(&header.UDPFields{
+		SrcPort: srcPort,
+		DstPort: dstPort,
+		Length:  header.UDPMinimumSize,
+	})
+	return splitPacket(header.UDPProtocolNumber, buffer.View(udpDgram))
+}
+
+func TestUDPMatcher(t *testing.T) {
+	matcher := NewUDPMatcher(1000, 2000, 53, 54)
+	for _, tc := range []struct {
+		srcPort uint16
+		dstPort uint16
+		want    bool
+	}{
+		{srcPort: 1000, dstPort: 53, want: true},
+		{srcPort: 2000, dstPort: 54, want: true},
+		{srcPort: 1500, dstPort: 53, want: true},
+		{srcPort: 999, dstPort: 53, want: false},
+		{srcPort: 2001, dstPort: 53, want: false},
+		{srcPort: 1000, dstPort: 52, want: false},
+		{srcPort: 1000, dstPort: 55, want: false},
+		{srcPort: 0, dstPort: math.MaxUint16, want: false},
+	} {
+		pkt := udpPacketWithPorts(tc.srcPort, tc.dstPort)
+		if matches, hotdrop := matcher.Match(iptables.Input, pkt, ""); matches != tc.want || hotdrop {
+			t.Errorf("%s.Match(ports %d -> %d) = %t, %t, want %t, false", matcher, tc.srcPort, tc.dstPort, matches, hotdrop, tc.want)
+		}
+	}
+	if got, want := matcher.String(), "--sport 1000:2000 --dport 53:54"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// TestUDPMatcherShortTransportHeader checks that UDP packets whose transport
+// header is missing or too short don't match.
+func TestUDPMatcherShortTransportHeader(t *testing.T) {
+	matcher := NewUDPMatcher(0, math.MaxUint16, 0, math.MaxUint16)
+
+	noHeader := splitPacket(header.UDPProtocolNumber, nil)
+	if matches, hotdrop := matcher.Match(iptables.Input, noHeader, ""); matches || hotdrop {
+		t.Errorf("Match(no header) = %t, %t, want false, false", matches, hotdrop)
+	}
+
+	// The transport header may already have been parsed by the stack.
+	short := splitPacket(header.UDPProtocolNumber, nil)
+	short.TransportHeader = make(buffer.View, header.UDPMinimumSize-1)
+	if matches, _ := matcher.Match(iptables.Input, short, ""); matches {
+		t.Errorf("Match(short TransportHeader) = true, want false")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const matcherNameState = "state"
+
+// stateMask holds the valid bits of linux.XTStateInfo.StateMask.
+const stateMask = linux.XT_STATE_INVALID | linux.XT_STATE_ESTABLISHED | linux.XT_STATE_RELATED | linux.XT_STATE_NEW | linux.XT_STATE_UNTRACKED
+
+func init() {
+	registerMatchMaker(stateMarshaler{})
+}
+
+// stateMarshaler implements matchMaker for connection state matching.
+type stateMarshaler struct{}
+
+// name implements matchMaker.name.
+func (stateMarshaler) name() string {
+	return matcherNameState
+}
+
+// marshal implements matchMaker.marshal.
+func (stateMarshaler) marshal(mr iptables.Matcher) []byte {
+	matcher := mr.(*StateMatcher)
+	info := linux.XTStateInfo{
+		StateMask: uint32(matcher.states),
+	}
+	buf := make([]byte, 0, linux.SizeOfXTStateInfo)
+	return marshalEntryMatch(matcherNameState, binary.Marshal(buf, usermem.ByteOrder, info))
+}
+
+// unmarshal implements matchMaker.unmarshal.
+func (stateMarshaler) unmarshal(buf []byte, filter iptables.IPHeaderFilter) (iptables.Matcher, error) {
+	if len(buf) < linux.SizeOfXTStateInfo {
+		return nil, fmt.Errorf("buf has insufficient size for state match: %d", len(buf))
+	}
+
+	var matchData linux.XTStateInfo
+	binary.Unmarshal(buf[:linux.SizeOfXTStateInfo], usermem.ByteOrder, &matchData)
+	nflog("parseMatchers: parsed XTStateInfo: %+v", matchData)
+
+	if matchData.StateMask&^stateMask != 0 {
+		return nil, fmt.Errorf("unsupported state matcher states set: %#x", matchData.StateMask)
+	}
+	return NewStateMatcher(iptables.ConnState(matchData.StateMask)), nil
+}
+
+// StateMatcher matches packets by the state of their connection, as
+// classified by connection tracking. It implements Matcher.
+//
+// Packets whose connection wasn't classified, e.g. because the stack doesn't
+// track connections, don't match.
+type StateMatcher struct {
+	// states is the set of matching iptables.ConnState* values.
+	states iptables.ConnState
+}
+
+// NewStateMatcher returns a StateMatcher matching packets in any of states,
+// which are or'ed iptables.ConnState* values. For example, "-m state --state
+// ESTABLISHED,RELATED" is represented by
+//
+//	NewStateMatcher(iptables.ConnStateEstablished | iptables.ConnStateRelated)
+func NewStateMatcher(states iptables.ConnState) *StateMatcher {
+	return &StateMatcher{states: states}
+}
+
+// Name implements Matcher.Name.
+func (*StateMatcher) Name() string {
+	return matcherNameState
+}
+
+// String returns the matcher's options in the format of iptables-save. It
+// is used by iptables.IPTables.Describe.
+func (sm *StateMatcher) String() string {
+	var names []string
+	// The states are listed in the order of iptables-save.
+	for _, state := range []struct {
+		state iptables.ConnState
+		name  string
+	}{
+		{iptables.ConnStateInvalid, "INVALID"},
+		{iptables.ConnStateNew, "NEW"},
+		{iptables.ConnStateRelated, "RELATED"},
+		{iptables.ConnStateEstablished, "ESTABLISHED"},
+		{iptables.ConnStateUntracked, "UNTRACKED"},
+	} {
+		if sm.states&state.state != 0 {
+			names = append(names, state.name)
+		}
+	}
+	return "--state " + strings.Join(names, ",")
+}
+
+// Match implements Matcher.Match.
+func (sm *StateMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfaceName string) (bool, bool) {
+	return sm.states&iptables.ConnState(pkt.ConnState) != 0, false
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+	remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+)
+
+// udpPacketBetween returns a UDP packet from src:srcPort to dst:dstPort with
+// a parsed network header.
+func udpPacketBetween(src tcpip.Address, srcPort uint16, dst tcpip.Address, dstPort uint16) tcpip.PacketBuffer {
+	hdr := buffer.NewView(header.IPv4MinimumSize + header.UDPMinimumSize)
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	header.UDP(hdr[header.IPv4MinimumSize:]).Encode(&header.UDPFields{
+		SrcPort: srcPort,
+		DstPort: dstPort,
+		Length:  header.UDPMinimumSize,
+	})
+	return tcpip.PacketBuffer{
+		Data:          hdr.ToVectorisedView(),
+		NetworkHeader: hdr[:header.IPv4MinimumSize],
+	}
+}
+
+func TestStateMatcherMarshal(t *testing.T) {
+	info := linux.XTStateInfo{StateMask: linux.XT_STATE_ESTABLISHED | linux.XT_STATE_RELATED}
+	matcher, err := stateMarshaler{}.unmarshal(binary.Marshal(nil, usermem.ByteOrder, info), iptables.IPHeaderFilter{})
+	if err != nil {
+		t.Fatalf("unmarshal(%+v) failed: %v", info, err)
+	}
+	want := NewStateMatcher(iptables.ConnStateEstablished | iptables.ConnStateRelated)
+	if *matcher.(*StateMatcher) != *want {
+		t.Errorf("unmarshal(%+v) = %+v, want %+v", info, matcher, want)
+	}
+	if got, want := matcher.(*StateMatcher).String(), "--state RELATED,ESTABLISHED"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// The marshalled match follows its linux.XTEntryMatch.
+	marshalled := stateMarshaler{}.marshal(matcher)
+	if got, err := (stateMarshaler{}).unmarshal(marshalled[linux.SizeOfXTEntryMatch:], iptables.IPHeaderFilter{}); err != nil || *got.(*StateMatcher) != *want {
+		t.Errorf("unmarshal(marshal(%+v)) = %+v, %v, want %+v, nil", want, got, err, want)
+	}
+
+	info.StateMask |= 1 << 4
+	if got, err := (stateMarshaler{}).unmarshal(binary.Marshal(nil, usermem.ByteOrder, info), iptables.IPHeaderFilter{}); err == nil {
+		t.Errorf("unmarshal(%+v) = %+v, want error", info, got)
+	}
+}
+
+// TestStateMatcherEstablished checks that "-A INPUT -m state --state
+// ESTABLISHED,RELATED -j ACCEPT" followed by "-P INPUT DROP" accepts replies
+// to outbound packets, and drops other inbound packets.
+func TestStateMatcherEstablished(t *testing.T) {
+	ipt := iptables.DefaultTables()
+	filter := iptables.EmptyFilterTable()
+	filter.Rules = []iptables.Rule{
+		{
+			Matchers: []iptables.Matcher{NewStateMatcher(iptables.ConnStateEstablished | iptables.ConnStateRelated)},
+			Target:   iptables.AcceptTarget{},
+		},
+		{Target: iptables.DropTarget{}},
+		{Target: iptables.AcceptTarget{}},
+		{Target: iptables.ErrorTarget{}},
+	}
+	filter.BuiltinChains[iptables.Input] = 0
+	filter.BuiltinChains[iptables.Forward] = 2
+	filter.BuiltinChains[iptables.Output] = 2
+	filter.Underflows[iptables.Input] = 1
+	filter.Underflows[iptables.Forward] = 2
+	filter.Underflows[iptables.Output] = 2
+	ipt.Tables[iptables.TablenameFilter] = filter
+	ipt.ConnTrack = iptables.NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	ipt.InitCounters()
+
+	// inbound runs pkt through the hooks of inbound packets.
+	inbound := func(pkt tcpip.PacketBuffer) bool {
+		return ipt.Check(iptables.Prerouting, &pkt, "") && ipt.Check(iptables.Input, &pkt, "")
+	}
+
+	request := udpPacketBetween(localAddr, 1000, remoteAddr, 53)
+	if !ipt.Check(iptables.Output, &request, "") {
+		t.Fatalf("Check(Output) = false for a request, want true")
+	}
+	if !inbound(udpPacketBetween(remoteAddr, 53, localAddr, 1000)) {
+		t.Errorf("reply was dropped")
+	}
+	if inbound(udpPacketBetween(remoteAddr, 53, localAddr, 1001)) {
+		t.Errorf("packet to another port was accepted")
+	}
+
+	// Without connection tracking, no packet is classified.
+	ipt.ConnTrack = nil
+	if inbound(udpPacketBetween(remoteAddr, 53, localAddr, 1000)) {
+		t.Errorf("reply was accepted without connection tracking")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const matcherNameStatistic = "statistic"
+
+// statisticProbabilityOne is the scaled probability of a random match that
+// always matches.
+const statisticProbabilityOne = 0x80000000
+
+func init() {
+	registerMatchMaker(statisticMarshaler{})
+}
+
+// statisticMarshaler implements matchMaker for statistic matching.
+type statisticMarshaler struct{}
+
+// name implements matchMaker.name.
+func (statisticMarshaler) name() string {
+	return matcherNameStatistic
+}
+
+// marshal implements matchMaker.marshal.
+func (statisticMarshaler) marshal(mr iptables.Matcher) []byte {
+	matcher := mr.(*StatisticMatcher)
+	info := linux.XTStatisticInfo{
+		Mode:   matcher.mode,
+		Packet: matcher.packet,
+		Count:  matcher.initialCount,
+	}
+	if matcher.invert {
+		info.Flags = linux.XT_STATISTIC_INVERT
+	}
+	if matcher.mode == linux.XT_STATISTIC_MODE_RANDOM {
+		info.SetProbability(matcher.probability)
+	} else {
+		info.Every = matcher.every
+	}
+	buf := make([]byte, 0, linux.SizeOfXTStatisticInfo)
+	return marshalEntryMatch(matcherNameStatistic, binary.Marshal(buf, usermem.ByteOrder, info))
+}
+
+// unmarshal implements matchMaker.unmarshal.
+func (statisticMarshaler) unmarshal(buf []byte, filter iptables.IPHeaderFilter) (iptables.Matcher, error) {
+	if len(buf) < linux.SizeOfXTStatisticInfo {
+		return nil, fmt.Errorf("buf has insufficient size for statistic match: %d", len(buf))
+	}
+
+	var matchData linux.XTStatisticInfo
+	binary.Unmarshal(buf[:linux.SizeOfXTStatisticInfo], usermem.ByteOrder, &matchData)
+	nflog("parseMatchers: parsed XTStatisticInfo: %+v", matchData)
+
+	if matchData.Flags&^linux.XT_STATISTIC_INVERT != 0 {
+		return nil, fmt.Errorf("unsupported statistic matcher flags set: %#x", matchData.Flags)
+	}
+
+	matcher := &StatisticMatcher{
+		mode:   matchData.Mode,
+		invert: matchData.Flags&linux.XT_STATISTIC_INVERT != 0,
+	}
+	switch matchData.Mode {
+	case linux.XT_STATISTIC_MODE_RANDOM:
+		matcher.probability = matchData.Probability()
+	case linux.XT_STATISTIC_MODE_NTH:
+		// iptables starts the counter at every-packet, so that the packet
+		// at offset packet is the first to match.
+		if matchData.Count > matchData.Every {
+			return nil, fmt.Errorf("statistic matcher count %d exceeds every %d", matchData.Count, matchData.Every)
+		}
+		matcher.every = matchData.Every
+		matcher.packet = matchData.Packet
+		matcher.initialCount = matchData.Count
+		matcher.count = matchData.Count
+	default:
+		return nil, fmt.Errorf("unsupported statistic matcher mode %d", matchData.Mode)
+	}
+	return matcher, nil
+}
+
+// StatisticMatcher matches a share of packets, either at random or every nth
+// packet. It implements Matcher.
+//
+// Rules hold a pointer to their StatisticMatcher, so the nth mode counter is
+// shared by every traversal of the rule.
+type StatisticMatcher struct {
+	// mode is linux.XT_STATISTIC_MODE_RANDOM or linux.XT_STATISTIC_MODE_NTH.
+	mode uint16
+
+	// invert inverts the result of the match.
+	invert bool
+
+	// probability is the probability of a match in random mode, scaled so
+	// that statisticProbabilityOne always matches.
+	probability uint32
+
+	// every is one less than the period of the match in nth mode, and packet
+	// is the offset of the matching packet in each period.
+	every  uint32
+	packet uint32
+
+	// initialCount is the initial value of count, as set by iptables.
+	initialCount uint32
+
+	// count counts packets in nth mode, from 0 to every. A packet matches
+	// when it wraps to 0. It is accessed atomically.
+	count uint32
+}
+
+// Name implements Matcher.Name.
+func (*StatisticMatcher) Name() string {
+	return matcherNameStatistic
+}
+
+// String returns the matcher's options in the format of iptables-save. It
+// is used by iptables.IPTables.Describe.
+func (sm *StatisticMatcher) String() string {
+	var invert string
+	if sm.invert {
+		invert = "! "
+	}
+	var opts []string
+	switch sm.mode {
+	case linux.XT_STATISTIC_MODE_RANDOM:
+		opts = append(opts, "--mode random", fmt.Sprintf("%s--probability %.11f", invert, float64(sm.probability)/statisticProbabilityOne))
+	case linux.XT_STATISTIC_MODE_NTH:
+		opts = append(opts, "--mode nth", fmt.Sprintf("%s--every %d", invert, sm.every+1), fmt.Sprintf("--packet %d", sm.packet))
+	}
+	return strings.Join(opts, " ")
+}
+
+// Match implements Matcher.Match.
+func (sm *StatisticMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfaceName string) (bool, bool) {
+	matches := sm.invert
+	switch sm.mode {
+	case linux.XT_STATISTIC_MODE_RANDOM:
+		var b [4]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(fmt.Sprintf("rand.Read failed: %v", err))
+		}
+		if usermem.ByteOrder.Uint32(b[:])&(statisticProbabilityOne-1) < sm.probability {
+			matches = !matches
+		}
+	case linux.XT_STATISTIC_MODE_NTH:
+		// Like Linux, advance the counter with compare-and-swap, so that
+		// exactly one of every every+1 concurrent packets sees it wrap.
+		for {
+			count := atomic.LoadUint32(&sm.count)
+			next := count + 1
+			if count == sm.every {
+				next = 0
+			}
+			if atomic.CompareAndSwapUint32(&sm.count, count, next) {
+				if next == 0 {
+					matches = !matches
+				}
+				break
+			}
+		}
+	}
+	return matches, false
+}
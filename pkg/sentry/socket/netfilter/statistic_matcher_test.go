@@ -0,0 +1,246 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"sync"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// statisticMatcher returns the matcher parsed from info, as set by iptables.
+func statisticMatcher(t *testing.T, info linux.XTStatisticInfo) iptables.Matcher {
+	t.Helper()
+	buf := binary.Marshal(nil, usermem.ByteOrder, info)
+	matcher, err := statisticMarshaler{}.unmarshal(buf, iptables.IPHeaderFilter{})
+	if err != nil {
+		t.Fatalf("unmarshal(%+v) failed: %v", info, err)
+	}
+	return matcher
+}
+
+// randomInfo returns the match set by "-m statistic --mode random
+// --probability p".
+func randomInfo(p float64) linux.XTStatisticInfo {
+	info := linux.XTStatisticInfo{Mode: linux.XT_STATISTIC_MODE_RANDOM}
+	info.SetProbability(uint32(p * statisticProbabilityOne))
+	return info
+}
+
+// nthInfo returns the match set by "-m statistic --mode nth --every every
+// --packet packet".
+func nthInfo(every, packet uint32) linux.XTStatisticInfo {
+	return linux.XTStatisticInfo{
+		Mode:   linux.XT_STATISTIC_MODE_NTH,
+		Every:  every - 1,
+		Packet: packet,
+		Count:  every - 1 - packet,
+	}
+}
+
+// backendTables returns tables whose filter INPUT chain accepts packets
+// matching matcher in rule 0, standing in for the first backend, and accepts
+// the others in rule 1, standing in for the second.
+func backendTables(matcher iptables.Matcher) iptables.IPTables {
+	ipt := iptables.DefaultTables()
+	filter := iptables.EmptyFilterTable()
+	filter.Rules = []iptables.Rule{
+		{
+			Matchers: []iptables.Matcher{matcher},
+			Target:   iptables.AcceptTarget{},
+		},
+		{Target: iptables.AcceptTarget{}},
+		{Target: iptables.ErrorTarget{}},
+	}
+	filter.BuiltinChains[iptables.Input] = 0
+	filter.BuiltinChains[iptables.Forward] = 1
+	filter.BuiltinChains[iptables.Output] = 1
+	filter.Underflows[iptables.Input] = 1
+	filter.Underflows[iptables.Forward] = 1
+	filter.Underflows[iptables.Output] = 1
+	ipt.Tables[iptables.TablenameFilter] = filter
+	ipt.InitCounters()
+	return ipt
+}
+
+// udpPacket returns an inbound UDP packet with a parsed network header.
+func udpPacket() tcpip.PacketBuffer {
+	hdr := buffer.NewView(header.IPv4MinimumSize + header.UDPMinimumSize)
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     "\x0a\x00\x00\x01",
+		DstAddr:     "\x0a\x00\x00\x02",
+	})
+	return tcpip.PacketBuffer{
+		Data:          hdr.ToVectorisedView(),
+		NetworkHeader: hdr[:header.IPv4MinimumSize],
+	}
+}
+
+// backendPackets returns the number of packets accepted by each backend of
+// ipt, as set up by backendTables.
+func backendPackets(t *testing.T, ipt *iptables.IPTables) (uint64, uint64) {
+	t.Helper()
+	for _, table := range ipt.Describe() {
+		if table.Name != iptables.TablenameFilter {
+			continue
+		}
+		for _, chain := range table.Chains {
+			if chain.Name == iptables.ChainNameInput {
+				return chain.Rules[0].Counters.Packets, chain.PolicyCounters.Packets
+			}
+		}
+	}
+	t.Fatalf("filter INPUT chain not found in %+v", ipt.Describe())
+	return 0, 0
+}
+
+func TestStatisticRandom(t *testing.T) {
+	const packets = 10000
+	for _, tc := range []struct {
+		name string
+		p    float64
+	}{
+		{"never", 0},
+		{"half", 0.5},
+		{"quarter", 0.25},
+		{"always", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ipt := backendTables(statisticMatcher(t, randomInfo(tc.p)))
+			for i := 0; i < packets; i++ {
+				pkt := udpPacket()
+				if !ipt.Check(iptables.Input, &pkt, "") {
+					t.Fatalf("Check dropped packet %d", i)
+				}
+			}
+			first, second := backendPackets(t, &ipt)
+			if first+second != packets {
+				t.Fatalf("got %d+%d packets accepted, want %d", first, second, packets)
+			}
+			// Allow 10 standard deviations of the binomial distribution, or
+			// 500 packets for p=0.5.
+			want := tc.p * packets
+			if diff := float64(first) - want; diff > 500 || diff < -500 {
+				t.Errorf("got %d packets to the first backend, want %v±500", first, want)
+			}
+		})
+	}
+}
+
+func TestStatisticNth(t *testing.T) {
+	for _, tc := range []struct {
+		every  uint32
+		packet uint32
+	}{
+		{every: 2, packet: 0},
+		{every: 2, packet: 1},
+		{every: 3, packet: 1},
+		{every: 1, packet: 0},
+	} {
+		matcher := statisticMatcher(t, nthInfo(tc.every, tc.packet))
+		for i := uint32(0); i < 3*tc.every; i++ {
+			pkt := udpPacket()
+			matches, hotdrop := matcher.Match(iptables.Input, pkt, "")
+			if hotdrop {
+				t.Fatalf("--every %d --packet %d: packet %d was hotdropped", tc.every, tc.packet, i)
+			}
+			if want := i%tc.every == tc.packet; matches != want {
+				t.Errorf("--every %d --packet %d: packet %d matches = %t, want %t", tc.every, tc.packet, i, matches, want)
+			}
+		}
+	}
+}
+
+func TestStatisticNthConcurrent(t *testing.T) {
+	const (
+		goroutines = 8
+		perRoutine = 3000
+		every      = 3
+	)
+	ipt := backendTables(statisticMatcher(t, nthInfo(every, 0)))
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perRoutine; i++ {
+				pkt := udpPacket()
+				ipt.Check(iptables.Input, &pkt, "")
+			}
+		}()
+	}
+	wg.Wait()
+
+	first, second := backendPackets(t, &ipt)
+	if want := uint64(goroutines * perRoutine / every); first != want {
+		t.Errorf("got %d packets to the first backend, want exactly %d", first, want)
+	}
+	if want := uint64(goroutines * perRoutine * (every - 1) / every); second != want {
+		t.Errorf("got %d packets to the second backend, want exactly %d", second, want)
+	}
+}
+
+func TestStatisticInvert(t *testing.T) {
+	info := nthInfo(2, 0)
+	info.Flags = linux.XT_STATISTIC_INVERT
+	matcher := statisticMatcher(t, info)
+	for i, want := range []bool{false, true, false, true} {
+		if matches, _ := matcher.Match(iptables.Input, udpPacket(), ""); matches != want {
+			t.Errorf("packet %d matches = %t, want %t", i, matches, want)
+		}
+	}
+}
+
+func TestStatisticString(t *testing.T) {
+	invertedRandom := randomInfo(0.5)
+	invertedRandom.Flags = linux.XT_STATISTIC_INVERT
+	for _, tc := range []struct {
+		info linux.XTStatisticInfo
+		want string
+	}{
+		{randomInfo(0.5), "--mode random --probability 0.50000000000"},
+		{invertedRandom, "--mode random ! --probability 0.50000000000"},
+		{nthInfo(3, 1), "--mode nth --every 3 --packet 1"},
+	} {
+		matcher := statisticMatcher(t, tc.info).(*StatisticMatcher)
+		if got := matcher.String(); got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestStatisticUnmarshalInvalid(t *testing.T) {
+	for _, info := range []linux.XTStatisticInfo{
+		{Mode: 2},
+		{Mode: linux.XT_STATISTIC_MODE_RANDOM, Flags: 0x2},
+		{Mode: linux.XT_STATISTIC_MODE_NTH, Every: 1, Count: 2},
+	} {
+		buf := binary.Marshal(nil, usermem.ByteOrder, info)
+		if _, err := (statisticMarshaler{}).unmarshal(buf, iptables.IPHeaderFilter{}); err == nil {
+			t.Errorf("unmarshal(%+v) succeeded, want error", info)
+		}
+	}
+}
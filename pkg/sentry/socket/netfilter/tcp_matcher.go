@@ -16,6 +16,7 @@ package netfilter
 
 import (
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/binary"
@@ -47,6 +48,8 @@ func (tcpMarshaler) marshal(mr iptables.Matcher) []byte {
 		SourcePortEnd:        matcher.sourcePortEnd,
 		DestinationPortStart: matcher.destinationPortStart,
 		DestinationPortEnd:   matcher.destinationPortEnd,
+		FlagMask:             matcher.flagMask,
+		FlagCompare:          matcher.flagCompare,
 	}
 	buf := make([]byte, 0, linux.SizeOfXTTCP)
 	return marshalEntryMatch(matcherNameTCP, binary.Marshal(buf, usermem.ByteOrder, xttcp))
@@ -64,10 +67,7 @@ func (tcpMarshaler) unmarshal(buf []byte, filter iptables.IPHeaderFilter) (iptab
 	binary.Unmarshal(buf[:linux.SizeOfXTTCP], usermem.ByteOrder, &matchData)
 	nflog("parseMatchers: parsed XTTCP: %+v", matchData)
 
-	if matchData.Option != 0 ||
-		matchData.FlagMask != 0 ||
-		matchData.FlagCompare != 0 ||
-		matchData.InverseFlags != 0 {
+	if matchData.Option != 0 || matchData.InverseFlags != 0 {
 		return nil, fmt.Errorf("unsupported TCP matcher flags set")
 	}
 
@@ -75,12 +75,7 @@ func (tcpMarshaler) unmarshal(buf []byte, filter iptables.IPHeaderFilter) (iptab
 		return nil, fmt.Errorf("TCP matching is only valid for protocol %d.", header.TCPProtocolNumber)
 	}
 
-	return &TCPMatcher{
-		sourcePortStart:      matchData.SourcePortStart,
-		sourcePortEnd:        matchData.SourcePortEnd,
-		destinationPortStart: matchData.DestinationPortStart,
-		destinationPortEnd:   matchData.DestinationPortEnd,
-	}, nil
+	return NewTCPMatcher(matchData.SourcePortStart, matchData.SourcePortEnd, matchData.DestinationPortStart, matchData.DestinationPortEnd, matchData.FlagMask, matchData.FlagCompare), nil
 }
 
 // TCPMatcher matches TCP packets and their headers. It implements Matcher.
@@ -89,6 +84,28 @@ type TCPMatcher struct {
 	sourcePortEnd        uint16
 	destinationPortStart uint16
 	destinationPortEnd   uint16
+
+	// flagMask selects the TCP flags that are compared to flagCompare. The
+	// flags are header.TCPFlag*.
+	flagMask    uint8
+	flagCompare uint8
+}
+
+// NewTCPMatcher returns a TCPMatcher matching TCP segments whose source and
+// destination ports are in the given inclusive ranges, and whose flags
+// selected by flagMask are exactly flagCompare. For example, "-p tcp --dport
+// 80:443 --syn" is represented by
+//
+//	NewTCPMatcher(0, math.MaxUint16, 80, 443, header.TCPFlagSyn|header.TCPFlagRst|header.TCPFlagAck|header.TCPFlagFin, header.TCPFlagSyn)
+func NewTCPMatcher(sourcePortStart, sourcePortEnd, destinationPortStart, destinationPortEnd uint16, flagMask, flagCompare uint8) *TCPMatcher {
+	return &TCPMatcher{
+		sourcePortStart:      sourcePortStart,
+		sourcePortEnd:        sourcePortEnd,
+		destinationPortStart: destinationPortStart,
+		destinationPortEnd:   destinationPortEnd,
+		flagMask:             flagMask,
+		flagCompare:          flagCompare,
+	}
 }
 
 // Name implements Matcher.Name.
@@ -96,6 +113,51 @@ func (*TCPMatcher) Name() string {
 	return matcherNameTCP
 }
 
+// String returns the matcher's options in the format of iptables-save. It
+// is used by iptables.IPTables.Describe.
+func (tm *TCPMatcher) String() string {
+	opts := portMatchOptions(tm.sourcePortStart, tm.sourcePortEnd, tm.destinationPortStart, tm.destinationPortEnd)
+	if tm.flagMask == 0 {
+		return opts
+	}
+	flags := fmt.Sprintf("--tcp-flags %s %s", tcpFlagNames(tm.flagMask), tcpFlagNames(tm.flagCompare))
+	if opts == "" {
+		return flags
+	}
+	return opts + " " + flags
+}
+
+// tcpFlagNames returns the names of flags as printed by iptables-save, e.g.
+// "SYN,ACK", or "NONE" if no flag is set.
+func tcpFlagNames(flags uint8) string {
+	var names []string
+	for _, flag := range []struct {
+		flag uint8
+		name string
+	}{
+		{header.TCPFlagFin, "FIN"},
+		{header.TCPFlagSyn, "SYN"},
+		{header.TCPFlagRst, "RST"},
+		{header.TCPFlagPsh, "PSH"},
+		{header.TCPFlagAck, "ACK"},
+		{header.TCPFlagUrg, "URG"},
+	} {
+		if flags&flag.flag != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, ",")
+}
+
+// NetworkProtocol implements iptables.NetworkMatcher.NetworkProtocol. The
+// matcher reads IPv4 headers, so it never matches IPv6 packets.
+func (*TCPMatcher) NetworkProtocol() tcpip.NetworkProtocolNumber {
+	return header.IPv4ProtocolNumber
+}
+
 // Match implements Matcher.Match.
 func (tm *TCPMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfaceName string) (bool, bool) {
 	netHeader := header.IPv4(pkt.NetworkHeader)
@@ -117,17 +179,16 @@ func (tm *TCPMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfac
 	// TODO(gvisor.dev/issue/170): Parsing the transport header should
 	// ultimately be moved into the iptables.Check codepath as matchers are
 	// added.
-	var tcpHeader header.TCP
-	if pkt.TransportHeader != nil {
-		tcpHeader = header.TCP(pkt.TransportHeader)
-	} else {
-		// The TCP header hasn't been parsed yet. We have to do it here.
-		if len(pkt.Data.First()) < header.TCPMinimumSize {
-			// There's no valid TCP header here, so we hotdrop the
-			// packet.
-			return false, true
-		}
-		tcpHeader = header.TCP(pkt.Data.First())
+	var buf [header.TCPMinimumSize]byte
+	tcpHeader := header.TCP(iptables.PeekTransportHeader(pkt, len(buf), buf[:]))
+	if len(tcpHeader) == 0 {
+		// There's no transport header at all, so there's nothing to
+		// match.
+		return false, false
+	}
+	if len(tcpHeader) < header.TCPMinimumSize {
+		// There's no valid TCP header here, so we hotdrop the packet.
+		return false, true
 	}
 
 	// Check whether the source and destination ports are within the
@@ -138,6 +199,9 @@ func (tm *TCPMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfac
 	if destinationPort := tcpHeader.DestinationPort(); destinationPort < tm.destinationPortStart || tm.destinationPortEnd < destinationPort {
 		return false, false
 	}
+	if tcpHeader.Flags()&tm.flagMask != tm.flagCompare {
+		return false, false
+	}
 
 	return true, false
 }
@@ -72,12 +72,7 @@ func (udpMarshaler) unmarshal(buf []byte, filter iptables.IPHeaderFilter) (iptab
 		return nil, fmt.Errorf("UDP matching is only valid for protocol %d.", header.UDPProtocolNumber)
 	}
 
-	return &UDPMatcher{
-		sourcePortStart:      matchData.SourcePortStart,
-		sourcePortEnd:        matchData.SourcePortEnd,
-		destinationPortStart: matchData.DestinationPortStart,
-		destinationPortEnd:   matchData.DestinationPortEnd,
-	}, nil
+	return NewUDPMatcher(matchData.SourcePortStart, matchData.SourcePortEnd, matchData.DestinationPortStart, matchData.DestinationPortEnd), nil
 }
 
 // UDPMatcher matches UDP packets and their headers. It implements Matcher.
@@ -88,11 +83,37 @@ type UDPMatcher struct {
 	destinationPortEnd   uint16
 }
 
+// NewUDPMatcher returns a UDPMatcher matching UDP datagrams whose source and
+// destination ports are in the given inclusive ranges. For example, "-p udp
+// --dport 53" is represented by
+//
+//	NewUDPMatcher(0, math.MaxUint16, 53, 53)
+func NewUDPMatcher(sourcePortStart, sourcePortEnd, destinationPortStart, destinationPortEnd uint16) *UDPMatcher {
+	return &UDPMatcher{
+		sourcePortStart:      sourcePortStart,
+		sourcePortEnd:        sourcePortEnd,
+		destinationPortStart: destinationPortStart,
+		destinationPortEnd:   destinationPortEnd,
+	}
+}
+
 // Name implements Matcher.Name.
 func (*UDPMatcher) Name() string {
 	return matcherNameUDP
 }
 
+// String returns the matcher's options in the format of iptables-save. It
+// is used by iptables.IPTables.Describe.
+func (um *UDPMatcher) String() string {
+	return portMatchOptions(um.sourcePortStart, um.sourcePortEnd, um.destinationPortStart, um.destinationPortEnd)
+}
+
+// NetworkProtocol implements iptables.NetworkMatcher.NetworkProtocol. The
+// matcher reads IPv4 headers, so it never matches IPv6 packets.
+func (*UDPMatcher) NetworkProtocol() tcpip.NetworkProtocolNumber {
+	return header.IPv4ProtocolNumber
+}
+
 // Match implements Matcher.Match.
 func (um *UDPMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfaceName string) (bool, bool) {
 	netHeader := header.IPv4(pkt.NetworkHeader)
@@ -116,17 +137,16 @@ func (um *UDPMatcher) Match(hook iptables.Hook, pkt tcpip.PacketBuffer, interfac
 	// TODO(gvisor.dev/issue/170): Parsing the transport header should
 	// ultimately be moved into the iptables.Check codepath as matchers are
 	// added.
-	var udpHeader header.UDP
-	if pkt.TransportHeader != nil {
-		udpHeader = header.UDP(pkt.TransportHeader)
-	} else {
-		// The UDP header hasn't been parsed yet. We have to do it here.
-		if len(pkt.Data.First()) < header.UDPMinimumSize {
-			// There's no valid UDP header here, so we hotdrop the
-			// packet.
-			return false, true
-		}
-		udpHeader = header.UDP(pkt.Data.First())
+	var buf [header.UDPMinimumSize]byte
+	udpHeader := header.UDP(iptables.PeekTransportHeader(pkt, len(buf), buf[:]))
+	if len(udpHeader) == 0 {
+		// There's no transport header at all, so there's nothing to
+		// match.
+		return false, false
+	}
+	if len(udpHeader) < header.UDPMinimumSize {
+		// There's no valid UDP header here, so we hotdrop the packet.
+		return false, true
 	}
 
 	// Check whether the source and destination ports are within the
@@ -146,6 +146,18 @@ var Metrics = tcpip.Stats{
 		OutgoingPacketErrors:                mustCreateMetric("/netstack/ip/outgoing_packet_errors", "Total number of IP packets which failed to write to a link-layer endpoint."),
 		MalformedPacketsReceived:            mustCreateMetric("/netstack/ip/malformed_packets_received", "Total number of IP packets which failed IP header validation checks."),
 		MalformedFragmentsReceived:          mustCreateMetric("/netstack/ip/malformed_fragments_received", "Total number of IP fragments which failed IP fragment validation checks."),
+		IPTablesMalformedPackets:            mustCreateMetric("/netstack/ip/iptables_malformed_packets", "Total number of IP packets checked by iptables whose network header was missing or truncated."),
+	},
+	IPv6: tcpip.IPStats{
+		PacketsReceived:                     mustCreateMetric("/netstack/ipv6/packets_received", "Total number of IPv6 packets received from the link layer in nic.DeliverNetworkPacket."),
+		InvalidDestinationAddressesReceived: mustCreateMetric("/netstack/ipv6/invalid_addresses_received", "Total number of IPv6 packets received with an unknown or invalid destination address."),
+		InvalidSourceAddressesReceived:      mustCreateMetric("/netstack/ipv6/invalid_source_addresses_received", "Total number of IPv6 packets received with an unknown or invalid source address."),
+		PacketsDelivered:                    mustCreateMetric("/netstack/ipv6/packets_delivered", "Total number of incoming IPv6 packets that are successfully delivered to the transport layer via HandlePacket."),
+		PacketsSent:                         mustCreateMetric("/netstack/ipv6/packets_sent", "Total number of IPv6 packets sent via WritePacket."),
+		OutgoingPacketErrors:                mustCreateMetric("/netstack/ipv6/outgoing_packet_errors", "Total number of IPv6 packets which failed to write to a link-layer endpoint."),
+		MalformedPacketsReceived:            mustCreateMetric("/netstack/ipv6/malformed_packets_received", "Total number of IPv6 packets which failed IP header validation checks."),
+		MalformedFragmentsReceived:          mustCreateMetric("/netstack/ipv6/malformed_fragments_received", "Total number of IPv6 fragments which failed IP fragment validation checks."),
+		IPTablesMalformedPackets:            mustCreateMetric("/netstack/ipv6/iptables_malformed_packets", "Total number of IPv6 packets checked by ip6tables whose network header was missing or truncated."),
 	},
 	TCP: tcpip.TCPStats{
 		ActiveConnectionOpenings:           mustCreateMetric("/netstack/tcp/active_connection_openings", "Number of connections opened successfully via Connect."),
@@ -50,12 +50,20 @@ func (s *Stack) Interfaces() map[int32]inet.Interface {
 		if ni.Flags.Loopback {
 			devType = linux.ARPHRD_LOOPBACK
 		}
+		var mcastAddrs []inet.MulticastAddr
+		for _, g := range ni.LinkMulticastGroups {
+			mcastAddrs = append(mcastAddrs, inet.MulticastAddr{
+				Addr:  []byte(g.Address),
+				Users: g.Users,
+			})
+		}
 		is[int32(id)] = inet.Interface{
-			Name:       ni.Name,
-			Addr:       []byte(ni.LinkAddress),
-			Flags:      uint32(nicStateFlagsToLinux(ni.Flags)),
-			DeviceType: devType,
-			MTU:        ni.MTU,
+			Name:           ni.Name,
+			Addr:           []byte(ni.LinkAddress),
+			Flags:          uint32(nicStateFlagsToLinux(ni.Flags)),
+			DeviceType:     devType,
+			MTU:            ni.MTU,
+			MulticastAddrs: mcastAddrs,
 		}
 	}
 	return is
@@ -197,6 +205,69 @@ func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, tcp.SACKEnabled(enabled))).ToError()
 }
 
+// ConnTrackLimits implements inet.Stack.ConnTrackLimits.
+func (s *Stack) ConnTrackLimits() (inet.ConnTrackLimits, error) {
+	ct := s.Stack.ConnTrack()
+	if ct == nil {
+		return inet.ConnTrackLimits{}, syserror.ENOENT
+	}
+	timeouts := ct.Timeouts()
+	return inet.ConnTrackLimits{
+		Max:                   ct.Max(),
+		TCPEstablishedTimeout: timeouts.TCPEstablished,
+		UDPTimeout:            timeouts.UDP,
+		ICMPTimeout:           timeouts.ICMP,
+	}, nil
+}
+
+// SetConnTrackLimits implements inet.Stack.SetConnTrackLimits.
+func (s *Stack) SetConnTrackLimits(limits inet.ConnTrackLimits) error {
+	ct := s.Stack.ConnTrack()
+	if ct == nil {
+		return syserror.ENOENT
+	}
+	timeouts := ct.Timeouts()
+	timeouts.TCPEstablished = limits.TCPEstablishedTimeout
+	timeouts.UDP = limits.UDPTimeout
+	timeouts.ICMP = limits.ICMPTimeout
+	ct.SetTimeouts(timeouts)
+	ct.SetMax(limits.Max)
+	return nil
+}
+
+// ConnTrackEntries implements inet.Stack.ConnTrackEntries.
+func (s *Stack) ConnTrackEntries() ([]inet.ConnTrackEntry, error) {
+	ct := s.Stack.ConnTrack()
+	if ct == nil {
+		return nil, syserror.ENOENT
+	}
+	var entries []inet.ConnTrackEntry
+	for _, e := range ct.Entries() {
+		entries = append(entries, inet.ConnTrackEntry{
+			Protocol: uint8(e.Original.Protocol),
+			Original: connTrackTuple(e.Original),
+			Reply:    connTrackTuple(e.Reply),
+			State:    e.State,
+			Timeout:  e.Timeout,
+			Replied:  e.Replied,
+			Assured:  e.Assured,
+		})
+	}
+	return entries, nil
+}
+
+// connTrackTuple converts a netstack connection tuple to an inet one.
+func connTrackTuple(t iptables.ConnTuple) inet.ConnTrackTuple {
+	return inet.ConnTrackTuple{
+		SrcAddr:  []byte(t.SrcAddr),
+		DstAddr:  []byte(t.DstAddr),
+		SrcPort:  t.SrcPort,
+		DstPort:  t.DstPort,
+		ICMPType: uint8(t.ICMPType),
+		ICMPCode: t.ICMPCode,
+	}
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat interface{}, arg string) error {
 	switch stats := stat.(type) {
@@ -287,12 +358,89 @@ func (s *Stack) Statistics(stat interface{}, arg string) error {
 			0,                               // TODO(gvisor.dev/issue/969): Support Udp/InCsumErrors.
 			0,                               // TODO(gvisor.dev/issue/969): Support Udp/IgnoredMulti.
 		}
+	case *inet.StatSNMP6IP:
+		ip := Metrics.IPv6
+		*stats = inet.StatSNMP6IP{
+			ip.PacketsReceived.Value(),          // InReceives.
+			ip.MalformedPacketsReceived.Value(), // InHdrErrors.
+			0,                                   // TODO(gvisor.dev/issue/969): Support Ip6/InTooBigErrors.
+			0,                                   // TODO(gvisor.dev/issue/969): Support Ip6/InNoRoutes.
+			ip.InvalidDestinationAddressesReceived.Value(), // InAddrErrors.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InUnknownProtos.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InTruncatedPkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InDiscards.
+			ip.PacketsDelivered.Value(),     // InDelivers.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutForwDatagrams.
+			ip.PacketsSent.Value(),          // OutRequests.
+			ip.OutgoingPacketErrors.Value(), // OutDiscards.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutNoRoutes.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/ReasmTimeout.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/ReasmReqds.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/ReasmOKs.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/ReasmFails.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/FragOKs.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/FragFails.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/FragCreates.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InMcastPkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutMcastPkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InMcastOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutMcastOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InBcastOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/OutBcastOctets.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InNoECTPkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InECT1Pkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InECT0Pkts.
+			0,                               // TODO(gvisor.dev/issue/969): Support Ip6/InCEPkts.
+		}
+	case *inet.StatSNMP6ICMP:
+		var inMsgs, outMsgs uint64
+		for _, c := range icmpv6TypeStats(Metrics.ICMP.V6PacketsReceived.ICMPv6PacketStats) {
+			inMsgs += c.Value()
+		}
+		for _, c := range icmpv6TypeStats(Metrics.ICMP.V6PacketsSent.ICMPv6PacketStats) {
+			outMsgs += c.Value()
+		}
+		*stats = inet.StatSNMP6ICMP{
+			inMsgs, // InMsgs.
+			Metrics.ICMP.V6PacketsReceived.Invalid.Value(), // InErrors.
+			outMsgs, // OutMsgs.
+			Metrics.ICMP.V6PacketsSent.Dropped.Value(), // OutErrors.
+			0, // TODO(gvisor.dev/issue/969): Support Icmp6/InCsumErrors.
+		}
+	case *inet.StatSNMP6ICMPMSG:
+		*stats = inet.StatSNMP6ICMPMSG{}
+		for typ, c := range icmpv6TypeStats(Metrics.ICMP.V6PacketsReceived.ICMPv6PacketStats) {
+			stats[typ] = c.Value()
+		}
+		for typ, c := range icmpv6TypeStats(Metrics.ICMP.V6PacketsSent.ICMPv6PacketStats) {
+			stats[256+int(typ)] = c.Value()
+		}
 	default:
 		return syserr.ErrEndpointOperation.ToError()
 	}
 	return nil
 }
 
+// icmpv6TypeStats returns the counters of s by the ICMPv6 message type they
+// count.
+func icmpv6TypeStats(s tcpip.ICMPv6PacketStats) map[header.ICMPv6Type]*tcpip.StatCounter {
+	return map[header.ICMPv6Type]*tcpip.StatCounter{
+		header.ICMPv6DstUnreachable:  s.DstUnreachable,
+		header.ICMPv6PacketTooBig:    s.PacketTooBig,
+		header.ICMPv6TimeExceeded:    s.TimeExceeded,
+		header.ICMPv6ParamProblem:    s.ParamProblem,
+		header.ICMPv6EchoRequest:     s.EchoRequest,
+		header.ICMPv6EchoReply:       s.EchoReply,
+		header.ICMPv6RouterSolicit:   s.RouterSolicit,
+		header.ICMPv6RouterAdvert:    s.RouterAdvert,
+		header.ICMPv6NeighborSolicit: s.NeighborSolicit,
+		header.ICMPv6NeighborAdvert:  s.NeighborAdvert,
+		header.ICMPv6RedirectMsg:     s.RedirectMsg,
+	}
+}
+
 // RouteTable implements inet.Stack.RouteTable.
 func (s *Stack) RouteTable() []inet.Route {
 	var routeTable []inet.Route
@@ -24,6 +24,9 @@ import (
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
+// epollBlockSite is the block site of tasks waiting in epoll_wait(2).
+var epollBlockSite = kernel.NewBlockSite("ep_poll")
+
 // CreateEpoll implements the epoll_create(2) linux syscall.
 func CreateEpoll(t *kernel.Task, closeOnExec bool) (int32, error) {
 	file := epoll.NewEventPoll(t)
@@ -119,6 +122,8 @@ func RemoveEpoll(t *kernel.Task, epfd int32, fd int32) error {
 
 // WaitEpoll implements the epoll_wait(2) linux syscall.
 func WaitEpoll(t *kernel.Task, fd int32, max int, timeout int) ([]epoll.Event, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(epollBlockSite))
+
 	// Get epoll from the file descriptor.
 	epollfile := t.GetFile(fd)
 	if epollfile == nil {
@@ -0,0 +1,31 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// Block sites of the syscalls that block tasks, named by the symbols that
+// Linux reports in /proc/[pid]/wchan for them.
+var (
+	futexWaitBlockSite   = kernel.NewBlockSite("futex_wait_queue_me")
+	futexLockPIBlockSite = kernel.NewBlockSite("futex_lock_pi")
+	nanosleepBlockSite   = kernel.NewBlockSite("hrtimer_nanosleep")
+	pollBlockSite        = kernel.NewBlockSite("do_sys_poll")
+	selectBlockSite      = kernel.NewBlockSite("do_select")
+	pauseBlockSite       = kernel.NewBlockSite("sys_pause")
+	sigsuspendBlockSite  = kernel.NewBlockSite("sigsuspend")
+)
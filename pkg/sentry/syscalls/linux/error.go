@@ -45,6 +45,9 @@ func HandleIOErrorVFS2(t *kernel.Task, partialResult bool, err, intr error, op s
 		// An unknown error is encountered with a partial read/write.
 		fs := f.Mount().Filesystem().VirtualFilesystem()
 		root := vfs.RootFromContext(t)
+		if root.Ok() {
+			defer root.DecRef()
+		}
 		name, _ := fs.PathnameWithDeleted(t, root, f.VirtualDentry())
 		log.Traceback("Invalid request partialResult %v and err (type %T) %v for %s operation on %q", partialResult, err, err, op, name)
 		partialResultOnce.Do(partialResultMetric.Increment)
@@ -176,8 +176,8 @@ var ARM64 = &kernel.SyscallTable{
 		137: syscalls.Supported("rt_sigtimedwait", RtSigtimedwait),
 		138: syscalls.Supported("rt_sigqueueinfo", RtSigqueueinfo),
 		139: syscalls.Supported("rt_sigreturn", RtSigreturn),
-		140: syscalls.PartiallySupported("setpriority", Setpriority, "Stub implementation.", nil),
-		141: syscalls.PartiallySupported("getpriority", Getpriority, "Stub implementation.", nil),
+		140: syscalls.PartiallySupported("setpriority", Setpriority, "Priorities are tracked per thread group, but don't affect scheduling.", nil),
+		141: syscalls.PartiallySupported("getpriority", Getpriority, "Priorities are tracked per thread group, but don't affect scheduling.", nil),
 		142: syscalls.CapError("reboot", linux.CAP_SYS_BOOT, "", nil),
 		143: syscalls.Supported("setregid", Setregid),
 		144: syscalls.Supported("setgid", Setgid),
@@ -290,8 +290,8 @@ var ARM64 = &kernel.SyscallTable{
 		267: syscalls.PartiallySupported("syncfs", Syncfs, "Depends on backing file system.", nil),
 		268: syscalls.ErrorWithEvent("setns", syserror.EOPNOTSUPP, "Needs filesystem support", []string{"gvisor.dev/issue/140"}), // TODO(b/29354995)
 		269: syscalls.PartiallySupported("sendmmsg", SendMMsg, "Not all flags and control messages are supported.", nil),
-		270: syscalls.ErrorWithEvent("process_vm_readv", syserror.ENOSYS, "", []string{"gvisor.dev/issue/158"}),
-		271: syscalls.ErrorWithEvent("process_vm_writev", syserror.ENOSYS, "", []string{"gvisor.dev/issue/158"}),
+		270: syscalls.Supported("process_vm_readv", ProcessVMReadv),
+		271: syscalls.Supported("process_vm_writev", ProcessVMWritev),
 		272: syscalls.CapError("kcmp", linux.CAP_SYS_PTRACE, "", nil),
 		273: syscalls.CapError("finit_module", linux.CAP_SYS_MODULE, "", nil),
 		274: syscalls.ErrorWithEvent("sched_setattr", syserror.ENOSYS, "gVisor does not implement a scheduler.", []string{"gvisor.dev/issue/264"}), // TODO(b/118902272)
@@ -52,6 +52,8 @@ func (f *futexWaitRestartBlock) Restart(t *kernel.Task) (uintptr, error) {
 // If blocking is interrupted, the syscall is restarted with the original
 // arguments.
 func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr usermem.Addr, private bool, val, mask uint32) (uintptr, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(futexWaitBlockSite))
+
 	w := t.FutexWaiter()
 	err := t.Futex().WaitPrepare(w, t, addr, private, val, mask)
 	if err != nil {
@@ -67,7 +69,7 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 			Enabled: true,
 			Next:    ktime.FromTimespec(ts),
 		})
-		err = t.BlockWithTimer(w.C, tchan)
+		err = t.BlockWithTimer(w.C, timer, tchan)
 		timer.Destroy()
 	} else {
 		err = t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
@@ -88,6 +90,8 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 // arguments. If forever is false, duration is a relative timeout and the
 // syscall is restarted with the remaining timeout.
 func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, addr usermem.Addr, private bool, val, mask uint32) (uintptr, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(futexWaitBlockSite))
+
 	w := t.FutexWaiter()
 	err := t.Futex().WaitPrepare(w, t, addr, private, val, mask)
 	if err != nil {
@@ -125,6 +129,8 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 }
 
 func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr usermem.Addr, private bool) error {
+	defer t.LeaveBlockSite(t.EnterBlockSite(futexLockPIBlockSite))
+
 	w := t.FutexWaiter()
 	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, false)
 	if err != nil {
@@ -144,7 +150,7 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr usermem.A
 			Enabled: true,
 			Next:    ktime.FromTimespec(ts),
 		})
-		err = t.BlockWithTimer(w.C, tchan)
+		err = t.BlockWithTimer(w.C, timer, tchan)
 		timer.Destroy()
 	}
 
@@ -33,7 +33,7 @@ func InotifyInit1(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 		return 0, nil, syserror.EINVAL
 	}
 
-	dirent := fs.NewDirent(t, anon.NewInode(t), "inotify")
+	dirent := fs.NewDirent(t, anon.NewInode(t), "anon_inode:inotify")
 	fileFlags := fs.FileFlags{
 		Read:        true,
 		Write:       true,
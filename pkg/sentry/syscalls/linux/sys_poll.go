@@ -171,6 +171,8 @@ func CopyInPollFDs(t *kernel.Task, addr usermem.Addr, nfds uint) ([]linux.PollFD
 }
 
 func doPoll(t *kernel.Task, addr usermem.Addr, nfds uint, timeout time.Duration) (time.Duration, uintptr, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(pollBlockSite))
+
 	pfd, err := CopyInPollFDs(t, addr, nfds)
 	if err != nil {
 		return timeout, 0, err
@@ -216,6 +218,8 @@ func CopyInFDSet(t *kernel.Task, addr usermem.Addr, nBytes, nBitsInLastPartialBy
 }
 
 func doSelect(t *kernel.Task, nfds int, readFDs, writeFDs, exceptFDs usermem.Addr, timeout time.Duration) (uintptr, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(selectBlockSite))
+
 	if nfds < 0 || nfds > fileCap {
 		return 0, syserror.EINVAL
 	}
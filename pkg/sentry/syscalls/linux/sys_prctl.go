@@ -115,11 +115,18 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		}
 
 	case linux.PR_SET_MM:
+		opt := args[1].Int()
+		// Only PR_SET_MM_AUXV, PR_SET_MM_MAP and PR_SET_MM_MAP_SIZE take a
+		// fourth argument.
+		if args[4].Int() != 0 || (args[3].Int() != 0 && opt != linux.PR_SET_MM_AUXV && opt != linux.PR_SET_MM_MAP && opt != linux.PR_SET_MM_MAP_SIZE) {
+			return 0, nil, syserror.EINVAL
+		}
+
 		if !t.HasCapability(linux.CAP_SYS_RESOURCE) {
 			return 0, nil, syserror.EPERM
 		}
 
-		switch args[1].Int() {
+		switch opt {
 		case linux.PR_SET_MM_EXE_FILE:
 			fd := args[2].Int()
 
@@ -129,13 +136,27 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 			}
 			defer file.DecRef()
 
-			// They trying to set exe to a non-file?
-			if !fs.IsFile(file.Dirent.Inode.StableAttr) {
-				return 0, nil, syserror.EBADF
+			// The new executable must be a regular file that can be executed,
+			// like the original one.
+			if !fs.IsRegular(file.Dirent.Inode.StableAttr) {
+				return 0, nil, syserror.EACCES
 			}
+			if err := file.Dirent.Inode.CheckPermission(t, fs.PermMask{Execute: true}); err != nil {
+				return 0, nil, err
+			}
+
+			// Set the underlying executable. Unlike Linux, this doesn't
+			// require the original executable to be unmapped.
+			return 0, nil, t.MemoryManager().ChangeExecutable(file.Dirent)
+
+		case linux.PR_SET_MM_START_BRK,
+			linux.PR_SET_MM_BRK,
+			linux.PR_SET_MM_ARG_START,
+			linux.PR_SET_MM_ARG_END,
+			linux.PR_SET_MM_ENV_START,
+			linux.PR_SET_MM_ENV_END:
 
-			// Set the underlying executable.
-			t.MemoryManager().SetExecutable(file.Dirent)
+			return 0, nil, t.MemoryManager().SetMMField(t, opt, args[2].Pointer())
 
 		case linux.PR_SET_MM_AUXV,
 			linux.PR_SET_MM_START_CODE,
@@ -143,12 +164,8 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 			linux.PR_SET_MM_START_DATA,
 			linux.PR_SET_MM_END_DATA,
 			linux.PR_SET_MM_START_STACK,
-			linux.PR_SET_MM_START_BRK,
-			linux.PR_SET_MM_BRK,
-			linux.PR_SET_MM_ARG_START,
-			linux.PR_SET_MM_ARG_END,
-			linux.PR_SET_MM_ENV_START,
-			linux.PR_SET_MM_ENV_END:
+			linux.PR_SET_MM_MAP,
+			linux.PR_SET_MM_MAP_SIZE:
 
 			t.Kernel().EmitUnimplementedEvent(t)
 			fallthrough
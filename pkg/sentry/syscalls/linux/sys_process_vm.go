@@ -0,0 +1,115 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"io"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// ProcessVMReadv implements linux syscall process_vm_readv(2).
+func ProcessVMReadv(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	n, err := processVMRW(t, args, false /* write */)
+	return uintptr(n), nil, err
+}
+
+// ProcessVMWritev implements linux syscall process_vm_writev(2).
+func ProcessVMWritev(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	n, err := processVMRW(t, args, true /* write */)
+	return uintptr(n), nil, err
+}
+
+// processVMRW implements process_vm_readv(2) and process_vm_writev(2). See
+// mm/process_vm_access.c:process_vm_rw() and process_vm_rw_core().
+func processVMRW(t *kernel.Task, args arch.SyscallArguments, write bool) (int64, error) {
+	pid := kernel.ThreadID(args[0].Int())
+	localAddr := args[1].Pointer()
+	localIovcnt := args[2].Uint64()
+	remoteAddr := args[3].Pointer()
+	remoteIovcnt := args[4].Uint64()
+	flags := args[5].Uint64()
+
+	if flags != 0 {
+		return 0, syserror.EINVAL
+	}
+	if localIovcnt > linux.UIO_MAXIOV || remoteIovcnt > linux.UIO_MAXIOV {
+		return 0, syserror.EINVAL
+	}
+
+	local, err := t.IovecsIOSequence(localAddr, int(localIovcnt), usermem.IOOpts{
+		AddressSpaceActive: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	remote, err := t.CopyInIovecs(remoteAddr, int(remoteIovcnt))
+	if err != nil {
+		return 0, err
+	}
+	if local.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	target := t.PIDNamespace().TaskWithID(pid)
+	if target == nil {
+		return 0, syserror.ESRCH
+	}
+	mem, err := kernel.NewCrossTaskMemory(t, target, usermem.IOOpts{})
+	if err != nil {
+		// Unlike other users of mm_access(), process_vm_rw_core() reports
+		// denied access as EPERM.
+		if err == syserror.EACCES {
+			return 0, syserror.EPERM
+		}
+		return 0, err
+	}
+
+	// Copy each remote iovec in turn, until the local iovecs are exhausted
+	// or a copy stops early. As in Linux, only failures to copy anything are
+	// reported.
+	var total int64
+	for ; !remote.IsEmpty() && local.NumBytes() > 0; remote = remote.Tail() {
+		ar := remote.Head()
+		if ar.Length() == 0 {
+			continue
+		}
+		seq := local.TakeFirst64(int64(ar.Length()))
+		var n int64
+		if write {
+			n, err = mem.WriteAt(t, seq, ar.Start)
+		} else {
+			n, err = mem.ReadAt(t, seq, ar.Start)
+		}
+		total += n
+		if err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			if err == io.EOF {
+				// The target's address space was released
+				// since mem was created.
+				return 0, syserror.ESRCH
+			}
+			return 0, err
+		}
+		local = local.DropFirst64(n)
+	}
+	return total, nil
+}
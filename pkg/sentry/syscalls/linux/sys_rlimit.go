@@ -107,6 +107,12 @@ func prlimit64(t *kernel.Task, resource limits.LimitType, newLim *limits.Limit)
 		return limits.Limit{}, syserror.EPERM
 	}
 
+	if resource == limits.NumberOfFiles {
+		if err := kernel.CheckNROpen(*newLim); err != nil {
+			return limits.Limit{}, err
+		}
+	}
+
 	// "A privileged process (under Linux: one with the CAP_SYS_RESOURCE
 	// capability in the initial user namespace) may make arbitrary changes
 	// to either limit value."
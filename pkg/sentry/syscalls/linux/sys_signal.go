@@ -348,6 +348,7 @@ func Sigaltstack(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.S
 
 // Pause implements linux syscall pause(2).
 func Pause(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(pauseBlockSite))
 	return 0, nil, syserror.ConvertIntr(t.Block(nil), kernel.ERESTARTNOHAND)
 }
 
@@ -481,6 +482,8 @@ func RtTgsigqueueinfo(t *kernel.Task, args arch.SyscallArguments) (uintptr, *ker
 
 // RtSigsuspend implements linux syscall rt_sigsuspend(2).
 func RtSigsuspend(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	defer t.LeaveBlockSite(t.EnterBlockSite(sigsuspendBlockSite))
+
 	sigset := args[0].Pointer()
 
 	// Copy in the signal mask.
@@ -22,7 +22,9 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -671,84 +673,143 @@ func Getsid(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	return uintptr(t.PIDNamespace().IDOfSession(target.ThreadGroup().Session())), nil, nil
 }
 
-// Getpriority pretends to implement the linux syscall getpriority(2).
-//
-// This is a stub; real priorities require a full scheduler.
-func Getpriority(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	which := args[0].Int()
-	who := kernel.ThreadID(args[1].Int())
-
+// priorityThreadGroups returns the thread groups selected by which and who for
+// getpriority(2) and setpriority(2). Since niceness is tracked per thread
+// group, PRIO_PROCESS selects the thread group of the task who.
+func priorityThreadGroups(t *kernel.Task, which, who int32) ([]*kernel.ThreadGroup, error) {
+	pidns := t.PIDNamespace()
 	switch which {
 	case linux.PRIO_PROCESS:
-		// Look for who, return ESRCH if not found.
-		var task *kernel.Task
-		if who == 0 {
-			task = t
-		} else {
-			task = t.PIDNamespace().TaskWithID(who)
+		task := t
+		if who != 0 {
+			task = pidns.TaskWithID(kernel.ThreadID(who))
 		}
-
 		if task == nil {
-			return 0, nil, syserror.ESRCH
+			return nil, nil
 		}
-
-		// From kernel/sys.c:getpriority:
-		// "To avoid negative return values, 'getpriority()'
-		// will not return the normal nice-value, but a negated
-		// value that has been offset by 20"
-		return uintptr(20 - task.Niceness()), nil, nil
-	case linux.PRIO_USER:
-		fallthrough
+		return []*kernel.ThreadGroup{task.ThreadGroup()}, nil
 	case linux.PRIO_PGRP:
-		// PRIO_USER and PRIO_PGRP have no further implementation yet.
-		return 0, nil, nil
+		pg := t.ThreadGroup().ProcessGroup()
+		if who != 0 {
+			pg = pidns.ProcessGroupWithID(kernel.ProcessGroupID(who))
+		}
+		if pg == nil {
+			return nil, nil
+		}
+		var tgs []*kernel.ThreadGroup
+		for _, tg := range pidns.ThreadGroups() {
+			if tg.ProcessGroup() == pg {
+				tgs = append(tgs, tg)
+			}
+		}
+		return tgs, nil
+	case linux.PRIO_USER:
+		creds := t.Credentials()
+		uid := creds.RealKUID
+		if who != 0 {
+			uid = creds.UserNamespace.MapToKUID(auth.UID(who))
+		}
+		var tgs []*kernel.ThreadGroup
+		for _, tg := range pidns.ThreadGroups() {
+			if leader := tg.Leader(); leader != nil && leader.Credentials().RealKUID == uid {
+				tgs = append(tgs, tg)
+			}
+		}
+		return tgs, nil
 	default:
-		return 0, nil, syserror.EINVAL
+		return nil, syserror.EINVAL
+	}
+}
+
+// Getpriority implements the linux syscall getpriority(2).
+//
+// Priorities are only bookkeeping, since the sentry doesn't schedule tasks by
+// priority.
+func Getpriority(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	which := args[0].Int()
+	who := args[1].Int()
+
+	tgs, err := priorityThreadGroups(t, which, who)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(tgs) == 0 {
+		return 0, nil, syserror.ESRCH
+	}
+
+	// From kernel/sys.c:getpriority:
+	// "To avoid negative return values, 'getpriority()'
+	// will not return the normal nice-value, but a negated
+	// value that has been offset by 20"
+	//
+	// The highest priority among the selected thread groups is returned.
+	var ret int32
+	for _, tg := range tgs {
+		if prio := 20 - tg.Niceness(); prio > ret {
+			ret = prio
+		}
 	}
+	return uintptr(ret), nil, nil
 }
 
-// Setpriority pretends to implement the linux syscall setpriority(2).
+// Setpriority implements the linux syscall setpriority(2).
 //
-// This is a stub; real priorities require a full scheduler.
+// Priorities are only bookkeeping, since the sentry doesn't schedule tasks by
+// priority.
 func Setpriority(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	which := args[0].Int()
-	who := kernel.ThreadID(args[1].Int())
-	niceval := int(args[2].Int())
+	who := args[1].Int()
+	niceval := args[2].Int()
 
 	// In the kernel's implementation, values outside the range
 	// of [-20, 19] are truncated to these minimum and maximum
 	// values.
-	if niceval < -20 /* min niceval */ {
-		niceval = -20
-	} else if niceval > 19 /* max niceval */ {
-		niceval = 19
+	if niceval < linux.MIN_NICE {
+		niceval = linux.MIN_NICE
+	} else if niceval > linux.MAX_NICE {
+		niceval = linux.MAX_NICE
 	}
 
-	switch which {
-	case linux.PRIO_PROCESS:
-		// Look for who, return ESRCH if not found.
-		var task *kernel.Task
-		if who == 0 {
-			task = t
-		} else {
-			task = t.PIDNamespace().TaskWithID(who)
-		}
+	tgs, err := priorityThreadGroups(t, which, who)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = syserror.ESRCH
+	for _, tg := range tgs {
+		err = setOnePriority(t, tg, niceval, err)
+	}
+	return 0, nil, err
+}
 
-		if task == nil {
-			return 0, nil, syserror.ESRCH
+// setOnePriority sets the niceness of tg to niceval on behalf of t, and
+// returns the error setpriority(2) should return given err, the error returned
+// for the thread groups before tg. It is analogous to
+// kernel/sys.c:set_one_prio().
+func setOnePriority(t *kernel.Task, tg *kernel.ThreadGroup, niceval int32, err error) error {
+	leader := tg.Leader()
+	if leader == nil {
+		return err
+	}
+	creds := t.Credentials()
+	tcreds := leader.Credentials()
+	if tcreds.RealKUID != creds.EffectiveKUID && tcreds.EffectiveKUID != creds.EffectiveKUID && !creds.HasCapabilityIn(linux.CAP_SYS_NICE, tcreds.UserNamespace) {
+		return syserror.EPERM
+	}
+
+	// Lowering the nice value is limited by RLIMIT_NICE, whose value is
+	// 20 - niceval for the lowest niceval allowed. See
+	// kernel/sched/core.c:can_nice().
+	if niceval < tg.Niceness() {
+		if lim := tg.Limits().Get(limits.Nice).Cur; uint64(20-niceval) > lim && !creds.HasCapability(linux.CAP_SYS_NICE) {
+			return syserror.EACCES
 		}
-
-		task.SetNiceness(niceval)
-	case linux.PRIO_USER:
-		fallthrough
-	case linux.PRIO_PGRP:
-		// PRIO_USER and PRIO_PGRP have no further implementation yet.
-		return 0, nil, nil
-	default:
-		return 0, nil, syserror.EINVAL
 	}
 
-	return 0, nil, nil
+	tg.SetNiceness(niceval)
+	if err == syserror.ESRCH {
+		return nil
+	}
+	return err
 }
 
 // Ptrace implements linux system call ptrace(2).
@@ -194,6 +194,8 @@ func (n *clockNanosleepRestartBlock) Restart(t *kernel.Task) (uintptr, error) {
 // If blocking is interrupted, the syscall is restarted with the original
 // arguments.
 func clockNanosleepUntil(t *kernel.Task, c ktime.Clock, ts linux.Timespec) error {
+	defer t.LeaveBlockSite(t.EnterBlockSite(nanosleepBlockSite))
+
 	notifier, tchan := ktime.NewChannelNotifier()
 	timer := ktime.NewTimer(c, notifier)
 
@@ -204,7 +206,7 @@ func clockNanosleepUntil(t *kernel.Task, c ktime.Clock, ts linux.Timespec) error
 		Next:    ktime.FromTimespec(ts),
 	})
 
-	err := t.BlockWithTimer(nil, tchan)
+	err := t.BlockWithTimer(nil, timer, tchan)
 
 	timer.Destroy()
 
@@ -221,9 +223,11 @@ func clockNanosleepUntil(t *kernel.Task, c ktime.Clock, ts linux.Timespec) error
 // If blocking is interrupted, the syscall is restarted with the remaining
 // duration timeout.
 func clockNanosleepFor(t *kernel.Task, c ktime.Clock, dur time.Duration, rem usermem.Addr) error {
+	defer t.LeaveBlockSite(t.EnterBlockSite(nanosleepBlockSite))
+
 	timer, start, tchan := ktime.After(c, dur)
 
-	err := t.BlockWithTimer(nil, tchan)
+	err := t.BlockWithTimer(nil, timer, tchan)
 
 	after := c.Now()
 
@@ -22,4 +22,5 @@ import (
 // Override syscall table to add syscalls implementations from this package.
 func Override(table map[uintptr]kernel.Syscall) {
 	table[0] = syscalls.Supported("read", Read)
+	table[157] = syscalls.PartiallySupported("prctl", Prctl, "Not all options are supported.", nil)
 }
@@ -0,0 +1,64 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs2
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	slinux "gvisor.dev/gvisor/pkg/sentry/syscalls/linux"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// Prctl implements linux syscall prctl(2). Only PR_SET_MM_EXE_FILE, which
+// takes a file descriptor, differs from the VFS1 implementation.
+func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	if args[0].Int() != linux.PR_SET_MM || args[1].Int() != linux.PR_SET_MM_EXE_FILE {
+		return slinux.Prctl(t, args)
+	}
+
+	// Check the arguments and capabilities as in the VFS1 implementation.
+	if args[3].Int() != 0 || args[4].Int() != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if !t.HasCapability(linux.CAP_SYS_RESOURCE) {
+		return 0, nil, syserror.EPERM
+	}
+
+	file := t.GetFileVFS2(args[2].Int())
+	if file == nil {
+		return 0, nil, syserror.EBADF
+	}
+	defer file.DecRef()
+
+	// The new executable must be a regular file that can be executed, like
+	// the original one.
+	stat, err := file.Stat(t, vfs.StatOptions{Mask: linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID})
+	if err != nil {
+		return 0, nil, err
+	}
+	if linux.FileMode(stat.Mode).FileType() != linux.ModeRegular {
+		return 0, nil, syserror.EACCES
+	}
+	if err := vfs.GenericCheckPermissions(t.Credentials(), vfs.MayExec, false /* isDir */, stat.Mode, auth.KUID(stat.UID), auth.KGID(stat.GID)); err != nil {
+		return 0, nil, err
+	}
+
+	// Set the underlying executable. Unlike Linux, this doesn't require the
+	// original executable to be unmapped.
+	return 0, nil, t.MemoryManager().ChangeExecutableVFS2(file.VirtualDentry())
+}
@@ -16,6 +16,7 @@ package vfs
 
 import (
 	"fmt"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/syserror"
@@ -68,6 +69,28 @@ type RegisterDeviceOptions struct {
 	// /proc/devices. If GroupName is empty, this registration will not be
 	// shown in /proc/devices.
 	GroupName string
+
+	// Name is the name of this device. Character devices with major device
+	// number linux.MISC_MAJOR are listed by Name in /proc/misc.
+	Name string
+
+	// TTYDriver is the tty driver this device belongs to, which is listed in
+	// /proc/tty/drivers. All devices of a driver share the same TTYDriver. If
+	// TTYDriver is nil, this device isn't a tty.
+	TTYDriver *TTYDriver
+}
+
+// TTYDriver describes a tty driver, as shown in /proc/tty/drivers.
+type TTYDriver struct {
+	// Name is the name of the driver, e.g. "pty_slave".
+	Name string
+
+	// DevName is the name of the driver's device files relative to /dev,
+	// e.g. "pts".
+	DevName string
+
+	// Type is the type of the driver, e.g. "pty:slave".
+	Type string
 }
 
 // RegisterDevice registers the given Device in vfs with the given major and
@@ -86,6 +109,50 @@ func (vfs *VirtualFilesystem) RegisterDevice(kind DeviceKind, major, minor uint3
 	return nil
 }
 
+// UnregisterDevice removes the Device registered with the given major and
+// minor device numbers, if any, from vfs. Device special files representing it
+// can no longer be opened.
+func (vfs *VirtualFilesystem) UnregisterDevice(kind DeviceKind, major, minor uint32) {
+	vfs.devicesMu.Lock()
+	defer vfs.devicesMu.Unlock()
+	delete(vfs.devices, devTuple{kind, major, minor})
+}
+
+// DeviceRegistration describes a Device registered in a VirtualFilesystem.
+type DeviceRegistration struct {
+	Kind  DeviceKind
+	Major uint32
+	Minor uint32
+	Opts  RegisterDeviceOptions
+}
+
+// DeviceRegistrations returns the Devices registered in vfs, sorted by kind
+// and device numbers.
+func (vfs *VirtualFilesystem) DeviceRegistrations() []DeviceRegistration {
+	vfs.devicesMu.RLock()
+	regs := make([]DeviceRegistration, 0, len(vfs.devices))
+	for tup, rd := range vfs.devices {
+		regs = append(regs, DeviceRegistration{
+			Kind:  tup.kind,
+			Major: tup.major,
+			Minor: tup.minor,
+			Opts:  rd.opts,
+		})
+	}
+	vfs.devicesMu.RUnlock()
+
+	sort.Slice(regs, func(i, j int) bool {
+		if regs[i].Kind != regs[j].Kind {
+			return regs[i].Kind < regs[j].Kind
+		}
+		if regs[i].Major != regs[j].Major {
+			return regs[i].Major < regs[j].Major
+		}
+		return regs[i].Minor < regs[j].Minor
+	})
+	return regs
+}
+
 // OpenDeviceSpecialFile returns a FileDescription representing the given
 // device.
 func (vfs *VirtualFilesystem) OpenDeviceSpecialFile(ctx context.Context, mnt *Mount, d *Dentry, kind DeviceKind, major, minor uint32, opts *OpenOptions) (*FileDescription, error) {
@@ -15,6 +15,10 @@
 package vfs
 
 import (
+	"bytes"
+	"fmt"
+	"sort"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -106,6 +110,11 @@ func (vfs *VirtualFilesystem) NewEpollInstanceFD() (*FileDescription, error) {
 	return &ep.vfsfd, nil
 }
 
+// PseudoName implements PseudoNamer.PseudoName.
+func (ep *EpollInstance) PseudoName() string {
+	return "anon_inode:[eventpoll]"
+}
+
 // Release implements FileDescriptionImpl.Release.
 func (ep *EpollInstance) Release() {
 	// Unregister all polled fds.
@@ -148,6 +157,54 @@ func (ep *EpollInstance) EventUnregister(e *waiter.Entry) {
 	ep.q.EventUnregister(e)
 }
 
+// WriteFDInfo implements FDInfoWriter.WriteFDInfo. Like Linux's
+// fs/eventpoll.c:ep_show_fdinfo(), it shows one line per registered file
+// descriptor.
+func (ep *EpollInstance) WriteFDInfo(ctx context.Context, buf *bytes.Buffer) {
+	type interest struct {
+		file     *FileDescription
+		num      int32
+		mask     uint32
+		userData [2]int32
+	}
+	// Snapshot the interests, so that ep isn't locked while their files are
+	// queried.
+	var interests []interest
+	ep.interestMu.Lock()
+	ep.mu.Lock()
+	for key, epi := range ep.interest {
+		if !key.file.TryIncRef() {
+			// The file is being released, and about to be unregistered.
+			continue
+		}
+		interests = append(interests, interest{
+			file:     key.file,
+			num:      key.num,
+			mask:     epi.mask,
+			userData: epi.userData,
+		})
+	}
+	ep.mu.Unlock()
+	ep.interestMu.Unlock()
+	sort.Slice(interests, func(i, j int) bool {
+		return interests[i].num < interests[j].num
+	})
+
+	for _, i := range interests {
+		var ino uint64
+		var dev uint32
+		if stat, err := i.file.Stat(ctx, StatOptions{Mask: linux.STATX_INO}); err == nil {
+			ino = stat.Ino
+			// s_dev is shown in the kernel's internal encoding, see
+			// include/linux/kdev_t.h:MKDEV().
+			dev = stat.DevMajor<<20 | stat.DevMinor
+		}
+		data := uint64(uint32(i.userData[0])) | uint64(uint32(i.userData[1]))<<32
+		fmt.Fprintf(buf, "tfd: %8d events: %8x data: %16x  pos:%d ino:%x sdev:%x\n", i.num, i.mask, data, i.file.InfoOffset(ctx), ino, dev)
+		i.file.DecRef()
+	}
+}
+
 // Seek implements FileDescriptionImpl.Seek.
 func (ep *EpollInstance) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
 	// Linux: fs/eventpoll.c:eventpoll_fops.llseek == noop_llseek
@@ -202,6 +259,9 @@ func (ep *EpollInstance) AddInterest(file *FileDescription, num int32, mask uint
 	// Add epi to file.epolls so that it is removed when the last
 	// FileDescription reference is dropped.
 	file.epollMu.Lock()
+	if file.epolls == nil {
+		file.epolls = make(map[*epollInterest]struct{})
+	}
 	file.epolls[epi] = struct{}{}
 	file.epollMu.Unlock()
 
@@ -15,6 +15,7 @@
 package vfs
 
 import (
+	"bytes"
 	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -415,6 +416,27 @@ type FileDescriptionImpl interface {
 	UnlockPOSIX(ctx context.Context, uid lock.UniqueID, rng lock.LockRange) error
 }
 
+// PseudoNamer is an optional interface that may be implemented by
+// FileDescriptionImpls representing files that have no pathname, such as
+// pipes, sockets and anonymous inodes.
+type PseudoNamer interface {
+	// PseudoName returns the name that stands in for the file's pathname,
+	// e.g. in the target of /proc/[pid]/fd/[fd]. For example, "pipe:[12345]"
+	// or "anon_inode:[eventpoll]". If PseudoName returns an empty string, the
+	// file is named by its pathname instead.
+	PseudoName() string
+}
+
+// FDInfoWriter is an optional interface that may be implemented by
+// FileDescriptionImpls whose /proc/[pid]/fdinfo/[fd] files show lines specific
+// to their type, such as epoll instances, inotify instances, timerfds and
+// signalfds.
+type FDInfoWriter interface {
+	// WriteFDInfo writes the lines specific to the file's type to buf. They
+	// follow the lines common to all files, e.g. "pos:" and "flags:".
+	WriteFDInfo(ctx context.Context, buf *bytes.Buffer)
+}
+
 // Dirent holds the information contained in struct linux_dirent64.
 type Dirent struct {
 	// Name is the filename.
@@ -662,6 +684,40 @@ func (fd *FileDescription) MappedName(ctx context.Context) string {
 	return s
 }
 
+// PseudoName returns the pseudo-name of the file represented by fd if its
+// implementation provides one (see PseudoNamer), or an empty string otherwise.
+func (fd *FileDescription) PseudoName() string {
+	if pn, ok := fd.impl.(PseudoNamer); ok {
+		return pn.PseudoName()
+	}
+	return ""
+}
+
+// WriteFDInfo writes the lines specific to the type of the file represented
+// by fd to buf, if its implementation provides any (see FDInfoWriter).
+func (fd *FileDescription) WriteFDInfo(ctx context.Context, buf *bytes.Buffer) {
+	if w, ok := fd.impl.(FDInfoWriter); ok {
+		w.WriteFDInfo(ctx, buf)
+	}
+}
+
+// InfoOffset returns the offset of fd as shown in /proc/[pid]/fdinfo, or 0 if
+// it has none.
+func (fd *FileDescription) InfoOffset(ctx context.Context) int64 {
+	// Seeking a file backed by a DynamicBytesSource locks it, which may
+	// already be locked by its reader if it's one of the fdinfo files
+	// generating the offset. Its offset can be read without locking it.
+	if dfd, ok := fd.impl.(interface{ Offset() int64 }); ok {
+		return dfd.Offset()
+	}
+	off, err := fd.Seek(ctx, 0, linux.SEEK_CUR)
+	if err != nil {
+		// The file isn't seekable.
+		return 0
+	}
+	return off
+}
+
 // DeviceID implements memmap.MappingIdentity.DeviceID.
 func (fd *FileDescription) DeviceID() uint64 {
 	stat, err := fd.Stat(context.Background(), StatOptions{
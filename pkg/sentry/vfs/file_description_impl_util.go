@@ -17,6 +17,7 @@ package vfs
 import (
 	"bytes"
 	"io"
+	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -248,9 +249,11 @@ type WritableDynamicBytesSource interface {
 // DynamicBytesFileDescriptionImpl.SetDataSource() must be called before first
 // use.
 type DynamicBytesFileDescriptionImpl struct {
-	data     DynamicBytesSource // immutable
-	mu       sync.Mutex         // protects the following fields
-	buf      bytes.Buffer
+	data DynamicBytesSource // immutable
+	mu   sync.Mutex         // protects the following fields
+	buf  bytes.Buffer
+	// off is only mutated with mu locked, using atomic memory operations, so
+	// that it can be read by Offset without locking mu.
 	off      int64
 	lastRead int64 // offset at which the last Read, PRead, or Seek ended
 }
@@ -260,6 +263,13 @@ func (fd *DynamicBytesFileDescriptionImpl) SetDataSource(data DynamicBytesSource
 	fd.data = data
 }
 
+// Offset returns the current offset of fd. Unlike Seek, it doesn't lock fd, so
+// it may be called by DynamicBytesSource.Generate implementations, e.g. to
+// report the offset of another file.
+func (fd *DynamicBytesFileDescriptionImpl) Offset() int64 {
+	return atomic.LoadInt64(&fd.off)
+}
+
 // Preconditions: fd.mu must be locked.
 func (fd *DynamicBytesFileDescriptionImpl) preadLocked(ctx context.Context, dst usermem.IOSequence, offset int64, opts *ReadOptions) (int64, error) {
 	// Regenerate the buffer if it's empty, or before pread() at a new offset.
@@ -297,7 +307,7 @@ func (fd *DynamicBytesFileDescriptionImpl) PRead(ctx context.Context, dst userme
 func (fd *DynamicBytesFileDescriptionImpl) Read(ctx context.Context, dst usermem.IOSequence, opts ReadOptions) (int64, error) {
 	fd.mu.Lock()
 	n, err := fd.preadLocked(ctx, dst, fd.off, &opts)
-	fd.off += n
+	atomic.StoreInt64(&fd.off, fd.off+n)
 	fd.mu.Unlock()
 	return n, err
 }
@@ -324,13 +334,13 @@ func (fd *DynamicBytesFileDescriptionImpl) Seek(ctx context.Context, offset int6
 		fd.buf.Reset()
 		if err := fd.data.Generate(ctx, &fd.buf); err != nil {
 			fd.buf.Reset()
-			fd.off = 0
+			atomic.StoreInt64(&fd.off, 0)
 			fd.lastRead = 0
 			return 0, err
 		}
 		fd.lastRead = offset
 	}
-	fd.off = offset
+	atomic.StoreInt64(&fd.off, offset)
 	return offset, nil
 }
 
@@ -366,7 +376,7 @@ func (fd *DynamicBytesFileDescriptionImpl) PWrite(ctx context.Context, src userm
 func (fd *DynamicBytesFileDescriptionImpl) Write(ctx context.Context, src usermem.IOSequence, opts WriteOptions) (int64, error) {
 	fd.mu.Lock()
 	n, err := fd.pwriteLocked(ctx, src, fd.off, opts)
-	fd.off += n
+	atomic.StoreInt64(&fd.off, fd.off+n)
 	fd.mu.Unlock()
 	return n, err
 }
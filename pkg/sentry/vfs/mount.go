@@ -15,7 +15,11 @@
 package vfs
 
 import (
+	"bytes"
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync/atomic"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -46,6 +50,16 @@ type Mount struct {
 	fs   *Filesystem
 	root *Dentry
 
+	// source is the source passed to mount(2), and fsType is the name of the
+	// FilesystemType that created fs. They're shown in /proc/[pid]/mounts.
+	// source and fsType are immutable.
+	source string
+	fsType string
+
+	// ID is the immutable ID of this Mount, unique within its
+	// VirtualFilesystem. It is analogous to Linux's mount.mnt_id.
+	ID uint64
+
 	// key is protected by VirtualFilesystem.mountMu and
 	// VirtualFilesystem.mounts.seq, and may be nil. References are held on
 	// key.parent and key.point if they are not nil.
@@ -124,16 +138,26 @@ func (vfs *VirtualFilesystem) NewMountNamespace(ctx context.Context, creds *auth
 		refs:        1,
 		mountpoints: make(map[*Dentry]uint32),
 	}
-	mntns.root = &Mount{
-		vfs:  vfs,
-		fs:   fs,
-		root: root,
-		ns:   mntns,
-		refs: 1,
-	}
+	mntns.root = vfs.newMount(fs, root, mntns, source, fsTypeName)
 	return mntns, nil
 }
 
+// newMount returns a new Mount of fs rooted at root in mntns, holding a single
+// reference. It takes ownership of the caller's references on fs and root.
+// source and fsType are as in Mount.
+func (vfs *VirtualFilesystem) newMount(fs *Filesystem, root *Dentry, mntns *MountNamespace, source, fsType string) *Mount {
+	return &Mount{
+		vfs:    vfs,
+		fs:     fs,
+		root:   root,
+		source: source,
+		fsType: fsType,
+		ID:     atomic.AddUint64(&vfs.lastMountID, 1),
+		ns:     mntns,
+		refs:   1,
+	}
+}
+
 // MountAt creates and mounts a Filesystem configured by the given arguments.
 func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentials, source string, target *PathOperation, fsTypeName string, opts *MountOptions) error {
 	rft := vfs.getFilesystemType(fsTypeName)
@@ -147,6 +171,38 @@ func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentia
 	if err != nil {
 		return err
 	}
+	return vfs.attachAt(ctx, creds, fs, root, target, nil /* sourceNS */, source, fsTypeName, false /* readOnly */)
+}
+
+// BindAt makes the file or directory at source visible at target, as by
+// mount(2) with MS_BIND. The new Mount shares the Filesystem of the Mount at
+// source, so files that depend on the state of the Filesystem, like those of
+// procfs, are the same through both Mounts. Like Linux's
+// fs/namespace.c:clone_mnt(), the new Mount is read-only if the Mount at source
+// is.
+func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credentials, source, target *PathOperation) error {
+	sourceVD, err := vfs.GetDentryAt(ctx, creds, source, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	fs := sourceVD.mount.fs
+	fs.IncRef()
+	root := sourceVD.dentry
+	root.IncRef()
+	sourceNS := sourceVD.mount.ns
+	// Like Linux, the new Mount shows the source and filesystem type of the
+	// Mount it's bound from.
+	mntSource, fsType := sourceVD.mount.source, sourceVD.mount.fsType
+	readOnly := sourceVD.mount.ReadOnly()
+	sourceVD.DecRef()
+	return vfs.attachAt(ctx, creds, fs, root, target, sourceNS, mntSource, fsType, readOnly)
+}
+
+// attachAt mounts root, which belongs to fs, at target. attachAt takes
+// ownership of the caller's references on fs and root. If sourceNS is not nil,
+// target must be in sourceNS. source and fsType are as in Mount. If readOnly is
+// true, the new Mount is read-only.
+func (vfs *VirtualFilesystem) attachAt(ctx context.Context, creds *auth.Credentials, fs *Filesystem, root *Dentry, target *PathOperation, sourceNS *MountNamespace, source, fsType string, readOnly bool) error {
 	// We can't hold vfs.mountMu while calling FilesystemImpl methods due to
 	// lock ordering.
 	vd, err := vfs.GetDentryAt(ctx, creds, target, &GetDentryOptions{})
@@ -155,6 +211,17 @@ func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentia
 		fs.DecRef()
 		return err
 	}
+	// mnt isn't in a mount namespace until it's connected below.
+	mnt := vfs.newMount(fs, root, nil /* mntns */, source, fsType)
+	// Like Linux's fs/namespace.c:graft_tree(), either both the mount point
+	// and the mount root must be directories, or neither can be. Mounts that
+	// vd may be mounted over below satisfy the same check, so they don't
+	// need to be checked again.
+	if err := vfs.checkMountTypes(ctx, creds, vd, VirtualDentry{mount: mnt, dentry: root}); err != nil {
+		vd.DecRef()
+		mnt.DecRef()
+		return err
+	}
 	vfs.mountMu.Lock()
 	vd.dentry.mu.Lock()
 	for {
@@ -162,8 +229,7 @@ func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentia
 			vd.dentry.mu.Unlock()
 			vfs.mountMu.Unlock()
 			vd.DecRef()
-			root.DecRef()
-			fs.DecRef()
+			mnt.DecRef()
 			return syserror.ENOENT
 		}
 		// vd might have been mounted over between vfs.GetDentryAt() and
@@ -192,16 +258,21 @@ func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentia
 		}
 		vd.dentry.mu.Lock()
 	}
-	// TODO: Linux requires that either both the mount point and the mount root
-	// are directories, or neither are, and returns ENOTDIR if this is not the
-	// case.
 	mntns := vd.mount.ns
-	mnt := &Mount{
-		vfs:  vfs,
-		fs:   fs,
-		root: root,
-		ns:   mntns,
-		refs: 1,
+	if sourceNS != nil && sourceNS != mntns {
+		// Linux's fs/namespace.c:do_loopback() only binds Mounts from the
+		// caller's namespace.
+		vd.dentry.mu.Unlock()
+		vfs.mountMu.Unlock()
+		vd.DecRef()
+		mnt.DecRef()
+		return syserror.EINVAL
+	}
+	mnt.ns = mntns
+	if readOnly {
+		// This can't fail since mnt isn't reachable yet, so it has no
+		// writers.
+		mnt.setReadOnlyLocked(true)
 	}
 	vfs.mounts.seq.BeginWrite()
 	vfs.connectLocked(mnt, vd, mntns)
@@ -211,6 +282,33 @@ func (vfs *VirtualFilesystem) MountAt(ctx context.Context, creds *auth.Credentia
 	return nil
 }
 
+// checkMountTypes returns ENOTDIR unless the file at mountpoint and the file
+// at root, which is to be mounted over it, are either both directories or both
+// non-directories.
+func (vfs *VirtualFilesystem) checkMountTypes(ctx context.Context, creds *auth.Credentials, mountpoint, root VirtualDentry) error {
+	mountpointIsDir, err := vfs.isDir(ctx, creds, mountpoint)
+	if err != nil {
+		return err
+	}
+	rootIsDir, err := vfs.isDir(ctx, creds, root)
+	if err != nil {
+		return err
+	}
+	if mountpointIsDir != rootIsDir {
+		return syserror.ENOTDIR
+	}
+	return nil
+}
+
+// isDir returns true if the file at vd is a directory.
+func (vfs *VirtualFilesystem) isDir(ctx context.Context, creds *auth.Credentials, vd VirtualDentry) (bool, error) {
+	stat, err := vfs.StatAt(ctx, creds, &PathOperation{Root: vd, Start: vd}, &StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return false, err
+	}
+	return linux.FileMode(stat.Mode).FileType() == linux.ModeDirectory, nil
+}
+
 // UmountAt removes the Mount at the given path.
 func (vfs *VirtualFilesystem) UmountAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, opts *UmountOptions) error {
 	if opts.Flags&^(linux.MNT_FORCE|linux.MNT_DETACH) != 0 {
@@ -611,6 +709,11 @@ func (mnt *Mount) Filesystem() *Filesystem {
 	return mnt.fs
 }
 
+// ReadOnly returns true if mnt is mounted MS_RDONLY.
+func (mnt *Mount) ReadOnly() bool {
+	return atomic.LoadInt64(&mnt.writers) < 0
+}
+
 // Root returns mntns' root. A reference is taken on the returned
 // VirtualDentry.
 func (mntns *MountNamespace) Root() VirtualDentry {
@@ -621,3 +724,155 @@ func (mntns *MountNamespace) Root() VirtualDentry {
 	vd.IncRef()
 	return vd
 }
+
+// GenerateProcMounts emits the contents of /proc/[pid]/mounts for a task whose
+// root directory is taskRootDir to buf. It shows one line per mount in the
+// mount namespace of taskRootDir, ordered by mount ID. Mounts that aren't
+// reachable from taskRootDir, e.g. because the task is chrooted, are skipped.
+//
+// GenerateProcMounts is analogous to Linux's fs/proc_namespace.c:show_vfsmnt().
+//
+// Preconditions: taskRootDir.Ok().
+func (vfs *VirtualFilesystem) GenerateProcMounts(ctx context.Context, taskRootDir VirtualDentry, buf *bytes.Buffer) {
+	mounts, _ := vfs.procMountsSnapshot(taskRootDir)
+	defer func() {
+		for _, mnt := range mounts {
+			mnt.DecRef()
+		}
+	}()
+
+	for _, mnt := range mounts {
+		path, err := vfs.PathnameReachable(ctx, taskRootDir, VirtualDentry{mount: mnt, dentry: mnt.root})
+		if err != nil {
+			ctx.Warningf("Failed to get the pathname of mount %d: %v", mnt.ID, err)
+			continue
+		}
+		if path == "" {
+			// The mount isn't reachable from taskRootDir.
+			continue
+		}
+		// The "dump" and "pass" fields are always 0, like in Linux.
+		fmt.Fprintf(buf, "%s %s %s %s 0 0\n", mangleProcMounts(mnt.procSource()), mangleProcMounts(path), mangleProcMounts(mnt.fsType), mnt.procOptions())
+	}
+}
+
+// GenerateProcMountInfo emits the contents of /proc/[pid]/mountinfo for a task
+// whose root directory is taskRootDir to buf. It shows the same mounts as
+// GenerateProcMounts, along with their IDs, the IDs of their parents, and
+// their roots within their filesystems. The lines are consistent with each
+// other even if mounts are added or removed concurrently.
+//
+// GenerateProcMountInfo is analogous to Linux's
+// fs/proc_namespace.c:show_mountinfo().
+//
+// Preconditions: taskRootDir.Ok().
+func (vfs *VirtualFilesystem) GenerateProcMountInfo(ctx context.Context, taskRootDir VirtualDentry, buf *bytes.Buffer) {
+	mounts, parentIDs := vfs.procMountsSnapshot(taskRootDir)
+	defer func() {
+		for _, mnt := range mounts {
+			mnt.DecRef()
+		}
+	}()
+
+	creds := auth.CredentialsFromContext(ctx)
+	for _, mnt := range mounts {
+		mntRoot := VirtualDentry{mount: mnt, dentry: mnt.root}
+		path, err := vfs.PathnameReachable(ctx, taskRootDir, mntRoot)
+		if err != nil {
+			ctx.Warningf("Failed to get the pathname of mount %d: %v", mnt.ID, err)
+			continue
+		}
+		if path == "" {
+			// The mount isn't reachable from taskRootDir.
+			continue
+		}
+		root, err := vfs.pathnameInFilesystem(ctx, mntRoot)
+		if err != nil {
+			ctx.Warningf("Failed to get the root of mount %d: %v", mnt.ID, err)
+			continue
+		}
+		stat, err := vfs.StatAt(ctx, creds, &PathOperation{Root: mntRoot, Start: mntRoot}, &StatOptions{})
+		if err != nil {
+			ctx.Warningf("Failed to stat the root of mount %d: %v", mnt.ID, err)
+			continue
+		}
+		// There are no optional fields, since mount propagation isn't
+		// supported. Filesystems are never read-only themselves, so their
+		// super options are always "rw".
+		fmt.Fprintf(buf, "%d %d %d:%d %s %s %s - %s %s rw\n",
+			mnt.ID, parentIDs[mnt], stat.DevMajor, stat.DevMinor,
+			mangleProcMounts(root), mangleProcMounts(path), mnt.procOptions(),
+			mangleProcMounts(mnt.fsType), mangleProcMounts(mnt.procSource()))
+	}
+}
+
+// procMountsSnapshot returns the Mounts in the mount namespace of taskRootDir
+// ordered by mount ID, taking a reference on each, and the IDs of their
+// parents at the same point in time. The root of the namespace is its own
+// parent, like the root of Linux's mount tree.
+func (vfs *VirtualFilesystem) procMountsSnapshot(taskRootDir VirtualDentry) ([]*Mount, map[*Mount]uint64) {
+	vfs.mountMu.Lock()
+	var mounts []*Mount
+	if mntns := taskRootDir.mount.ns; mntns != nil {
+		mounts = appendSubmountsLocked(mounts, mntns.root)
+	}
+	parentIDs := make(map[*Mount]uint64, len(mounts))
+	for _, mnt := range mounts {
+		parentIDs[mnt] = mnt.ID
+		if parent := mnt.parent(); parent != nil {
+			parentIDs[mnt] = parent.ID
+		}
+	}
+	vfs.mountMu.Unlock()
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].ID < mounts[j].ID })
+	return mounts, parentIDs
+}
+
+// procSource returns the source of mnt as shown in /proc/[pid]/mounts.
+func (mnt *Mount) procSource() string {
+	if mnt.source == "" {
+		return "none"
+	}
+	return mnt.source
+}
+
+// procOptions returns the per-mount options of mnt as shown in
+// /proc/[pid]/mounts.
+func (mnt *Mount) procOptions() string {
+	if mnt.ReadOnly() {
+		return "ro"
+	}
+	return "rw"
+}
+
+// appendSubmountsLocked appends mnt and the Mounts mounted below it to mounts,
+// taking a reference on each, and returns the updated slice.
+//
+// Preconditions: vfs.mountMu must be locked.
+func appendSubmountsLocked(mounts []*Mount, mnt *Mount) []*Mount {
+	if mnt.umounted {
+		return mounts
+	}
+	// VirtualFilesystem holds a reference on mnt, since it isn't umounted.
+	mnt.IncRef()
+	mounts = append(mounts, mnt)
+	for child := range mnt.children {
+		mounts = appendSubmountsLocked(mounts, child)
+	}
+	return mounts
+}
+
+// mangleProcMounts escapes the characters of s that would break up the fields
+// of /proc/[pid]/mounts, as by Linux's fs/seq_file.c:seq_escape().
+func mangleProcMounts(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\\':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -90,6 +90,47 @@ loop:
 	return b.String(), nil
 }
 
+// PathnameReachable returns an absolute pathname to vd, consistent with
+// Linux's __d_path() as used by seq_path_root(). If vd isn't reachable from
+// vfsroot, PathnameReachable returns ("", nil).
+func (vfs *VirtualFilesystem) PathnameReachable(ctx context.Context, vfsroot, vd VirtualDentry) (string, error) {
+	b := getFSPathBuilder()
+	defer putFSPathBuilder(b)
+	haveRef := false
+	defer func() {
+		if haveRef {
+			vd.DecRef()
+		}
+	}()
+loop:
+	for {
+		err := vd.mount.fs.impl.PrependPath(ctx, vfsroot, vd, b)
+		switch err.(type) {
+		case nil:
+			if vd.mount == vfsroot.mount && vd.mount.root == vfsroot.dentry {
+				break loop
+			}
+			nextVD := vfs.getMountpointAt(vd.mount, vfsroot)
+			if !nextVD.Ok() {
+				return "", nil
+			}
+			if haveRef {
+				vd.DecRef()
+			}
+			vd = nextVD
+			haveRef = true
+		case PrependPathAtVFSRootError:
+			break loop
+		case PrependPathAtNonMountRootError, PrependPathSyntheticError:
+			return "", nil
+		default:
+			return "", err
+		}
+	}
+	b.PrependByte('/')
+	return b.String(), nil
+}
+
 // PathnameForGetcwd returns an absolute pathname to vd, consistent with
 // Linux's sys_getcwd().
 func (vfs *VirtualFilesystem) PathnameForGetcwd(ctx context.Context, vfsroot, vd VirtualDentry) (string, error) {
@@ -140,13 +181,34 @@ loop:
 	return b.String(), nil
 }
 
+// pathnameInFilesystem returns the pathname of vd relative to the root of its
+// Filesystem, without walking up Mounts. It is consistent with Linux's
+// dentry_path_raw(), as used by the "root" field of /proc/[pid]/mountinfo.
+func (vfs *VirtualFilesystem) pathnameInFilesystem(ctx context.Context, vd VirtualDentry) (string, error) {
+	b := getFSPathBuilder()
+	defer putFSPathBuilder(b)
+	// A Mount without a root never stops FilesystemImpl.PrependPath() before
+	// it reaches the root of the Filesystem.
+	unrooted := &Mount{vfs: vfs, fs: vd.mount.fs}
+	err := vd.mount.fs.impl.PrependPath(ctx, VirtualDentry{}, VirtualDentry{mount: unrooted, dentry: vd.dentry}, b)
+	switch err.(type) {
+	case nil, PrependPathAtNonMountRootError:
+	case PrependPathSyntheticError:
+		// Skip prepending "/".
+		return b.String(), nil
+	default:
+		return "", err
+	}
+	b.PrependByte('/')
+	return b.String(), nil
+}
+
 // As of this writing, we do not have equivalents to:
 //
 // - d_absolute_path(), which returns EINVAL if (effectively) any call to
 // FilesystemImpl.PrependPath() would return PrependPathAtNonMountRootError.
 //
-// - dentry_path(), which does not walk up mounts (and only returns the path
-// relative to Filesystem root), but also appends "//deleted" for disowned
-// Dentries.
+// - dentry_path(), which is like pathnameInFilesystem, but also appends
+// "//deleted" for disowned Dentries.
 //
 // These should be added as necessary.
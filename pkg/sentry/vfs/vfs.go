@@ -87,6 +87,10 @@ type VirtualFilesystem struct {
 	// anonMount is analogous to Linux's anon_inode_mnt.
 	anonMount *Mount
 
+	// lastMountID is the ID of the last Mount created. It is accessed using
+	// atomic memory operations.
+	lastMountID uint64
+
 	// devices contains all registered Devices. devices is protected by
 	// devicesMu.
 	devicesMu sync.RWMutex
@@ -132,11 +136,7 @@ func New() *VirtualFilesystem {
 		devMinor: anonfsDevMinor,
 	}
 	anonfs.vfsfs.Init(vfs, &anonfs)
-	vfs.anonMount = &Mount{
-		vfs:  vfs,
-		fs:   &anonfs.vfsfs,
-		refs: 1,
-	}
+	vfs.anonMount = vfs.newMount(&anonfs.vfsfs, nil /* root */, nil /* mntns */, "" /* source */, "" /* fsType */)
 
 	return vfs
 }
@@ -0,0 +1,187 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faketime provides a fake clock for tests that depend on the passage
+// of time.
+package faketime
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// ManualClock is a clock that only changes when it is set or advanced. It
+// implements tcpip.Clock, and runs functions scheduled with AfterFunc when it
+// is advanced past their expiry.
+//
+// ManualClock is safe for concurrent use.
+type ManualClock struct {
+	mu sync.Mutex
+
+	// realtime is the real time, in nanoseconds since the Unix epoch. It is
+	// protected by mu.
+	realtime int64
+
+	// monotonic is the monotonic time, in nanoseconds. It is protected by
+	// mu.
+	monotonic int64
+
+	// timers is the set of pending timers. It is protected by mu.
+	timers map[*Timer]struct{}
+
+	// seq is the sequence number of the last timer created. It is protected
+	// by mu.
+	seq uint64
+
+	// listeners are called whenever the clock is set or advanced. It is
+	// protected by mu.
+	listeners []func()
+}
+
+// NewManualClock returns a ManualClock whose real time is realtime and whose
+// monotonic time is 0.
+func NewManualClock(realtime time.Time) *ManualClock {
+	return &ManualClock{
+		realtime: realtime.UnixNano(),
+		timers:   make(map[*Timer]struct{}),
+	}
+}
+
+// NowNanoseconds implements tcpip.Clock.NowNanoseconds.
+func (c *ManualClock) NowNanoseconds() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.realtime
+}
+
+// NowMonotonic implements tcpip.Clock.NowMonotonic.
+func (c *ManualClock) NowMonotonic() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monotonic
+}
+
+// Set sets the real time to t. Like setting CLOCK_REALTIME, it doesn't affect
+// the monotonic time, so no timers expire.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.realtime = t.UnixNano()
+	c.mu.Unlock()
+	c.notify()
+}
+
+// Advance advances the real and monotonic times by d. Timers expiring on the
+// way are run in order of expiry, with the clock reading their expiry time.
+//
+// Precondition: d >= 0.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.monotonic + d.Nanoseconds()
+	for {
+		t := c.nextTimerLocked(end)
+		if t == nil {
+			break
+		}
+		delete(c.timers, t)
+		c.realtime += t.at - c.monotonic
+		c.monotonic = t.at
+		// t.f may use the clock.
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.realtime += end - c.monotonic
+	c.monotonic = end
+	c.mu.Unlock()
+	c.notify()
+}
+
+// nextTimerLocked returns the pending timer that expires first, if it expires
+// no later than end. Timers expiring at the same time are returned in the
+// order they were created.
+//
+// Preconditions: c.mu must be locked.
+func (c *ManualClock) nextTimerLocked(end int64) *Timer {
+	var next *Timer
+	for t := range c.timers {
+		if t.at > end {
+			continue
+		}
+		if next == nil || t.at < next.at || (t.at == next.at && t.seq < next.seq) {
+			next = t
+		}
+	}
+	return next
+}
+
+// OnChange registers f to be called whenever the clock is set or advanced,
+// after any expired timers have run. It is used to propagate clock changes to
+// users of the clock that don't schedule timers with AfterFunc.
+func (c *ManualClock) OnChange(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, f)
+}
+
+func (c *ManualClock) notify() {
+	c.mu.Lock()
+	listeners := make([]func(), len(c.listeners))
+	copy(listeners, c.listeners)
+	c.mu.Unlock()
+	for _, f := range listeners {
+		f()
+	}
+}
+
+// AfterFunc schedules f to be called once the clock's monotonic time has
+// advanced by d. f is called by Advance, in its goroutine.
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) *Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &Timer{
+		c:   c,
+		at:  c.monotonic + d.Nanoseconds(),
+		seq: c.seq,
+		f:   f,
+	}
+	c.timers[t] = struct{}{}
+	return t
+}
+
+// Timer is a function scheduled to run by ManualClock.AfterFunc.
+type Timer struct {
+	c *ManualClock
+
+	// at is the monotonic time at which the timer expires.
+	at int64
+
+	// seq orders timers expiring at the same time.
+	seq uint64
+
+	f func()
+}
+
+// Stop prevents the timer from running. It returns true if the timer was
+// pending, and false if it already ran or was stopped.
+func (t *Timer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if _, ok := t.c.timers[t]; !ok {
+		return false
+	}
+	delete(t.c.timers, t)
+	return true
+}
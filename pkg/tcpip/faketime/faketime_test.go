@@ -0,0 +1,92 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faketime
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManualClockAdvance(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewManualClock(start)
+	if got, want := c.NowNanoseconds(), start.UnixNano(); got != want {
+		t.Errorf("got NowNanoseconds() = %d, want = %d", got, want)
+	}
+	if got := c.NowMonotonic(); got != 0 {
+		t.Errorf("got NowMonotonic() = %d, want = 0", got)
+	}
+
+	c.Advance(time.Second)
+	if got, want := c.NowNanoseconds(), start.Add(time.Second).UnixNano(); got != want {
+		t.Errorf("got NowNanoseconds() = %d, want = %d", got, want)
+	}
+	if got, want := c.NowMonotonic(), time.Second.Nanoseconds(); got != want {
+		t.Errorf("got NowMonotonic() = %d, want = %d", got, want)
+	}
+
+	// Setting the real time doesn't affect the monotonic time.
+	c.Set(start)
+	if got, want := c.NowNanoseconds(), start.UnixNano(); got != want {
+		t.Errorf("got NowNanoseconds() = %d, want = %d", got, want)
+	}
+	if got, want := c.NowMonotonic(), time.Second.Nanoseconds(); got != want {
+		t.Errorf("got NowMonotonic() = %d, want = %d", got, want)
+	}
+}
+
+func TestManualClockTimers(t *testing.T) {
+	c := NewManualClock(time.Unix(0, 0))
+	var fired []string
+	record := func(name string, at time.Duration) func() {
+		return func() {
+			fired = append(fired, name)
+			if got, want := c.NowMonotonic(), at.Nanoseconds(); got != want {
+				t.Errorf("timer %s: got NowMonotonic() = %d, want = %d", name, got, want)
+			}
+		}
+	}
+	c.AfterFunc(2*time.Second, record("b", 2*time.Second))
+	c.AfterFunc(time.Second, record("a", time.Second))
+	c.AfterFunc(2*time.Second, record("c", 2*time.Second))
+	stopped := c.AfterFunc(time.Second, record("stopped", time.Second))
+	late := c.AfterFunc(3*time.Second, record("late", 3*time.Second))
+
+	if !stopped.Stop() {
+		t.Errorf("got stopped.Stop() = false, want = true")
+	}
+	c.Advance(2 * time.Second)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(fired, want) {
+		t.Errorf("got fired = %v, want = %v", fired, want)
+	}
+	if stopped.Stop() {
+		t.Errorf("got stopped.Stop() = true after Stop, want = false")
+	}
+	if !late.Stop() {
+		t.Errorf("got late.Stop() = false, want = true")
+	}
+}
+
+func TestManualClockOnChange(t *testing.T) {
+	c := NewManualClock(time.Unix(0, 0))
+	var changes int
+	c.OnChange(func() { changes++ })
+	c.Advance(time.Second)
+	c.Set(time.Unix(5, 0))
+	if changes != 2 {
+		t.Errorf("got %d changes, want = 2", changes)
+	}
+}
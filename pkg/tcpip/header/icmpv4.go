@@ -71,10 +71,21 @@ const (
 
 // Values for ICMP code as defined in RFC 792.
 const (
+	ICMPv4NetUnreachable      = 0
+	ICMPv4HostUnreachable     = 1
+	ICMPv4ProtoUnreachable    = 2
 	ICMPv4PortUnreachable     = 3
 	ICMPv4FragmentationNeeded = 4
 )
 
+// Values for ICMP destination unreachable codes as defined in RFC 1122 and
+// RFC 1812.
+const (
+	ICMPv4NetProhibited   = 9
+	ICMPv4HostProhibited  = 10
+	ICMPv4AdminProhibited = 13
+)
+
 // Type is the ICMP type field.
 func (b ICMPv4) Type() ICMPv4Type { return ICMPv4Type(b[0]) }
 
@@ -0,0 +1,942 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// DefaultConnTrackMax returns the default maximum number of connections
+// tracked on a system with totalMem bytes of memory. It is computed like the
+// default value of Linux's net.netfilter.nf_conntrack_max, see
+// net/netfilter/nf_conntrack_core.c:nf_conntrack_init_start().
+func DefaultConnTrackMax(totalMem uint64) int {
+	const (
+		gb = 1 << 30
+
+		// minConnTrackMax is the smallest default maximum.
+		minConnTrackMax = 1024
+	)
+	switch {
+	case totalMem > 4*gb:
+		return 262144
+	case totalMem > gb:
+		return 65536
+	}
+	// Linux allocates one 8-byte hash bucket per 16KB of memory, and allows
+	// one connection per bucket.
+	if max := int(totalMem / 16384 / 8); max > minConnTrackMax {
+		return max
+	}
+	return minConnTrackMax
+}
+
+// connTrackEvictRange is the number of connections examined for expired ones
+// when a new connection is started while the table is full, like Linux's
+// NF_CT_EVICTION_RANGE. It bounds the work done for each such packet.
+const connTrackEvictRange = 8
+
+// ConnTrackTimeouts holds the times after which idle tracked connections
+// expire.
+type ConnTrackTimeouts struct {
+	// TCPEstablished applies to established TCP connections, like Linux's
+	// net.netfilter.nf_conntrack_tcp_timeout_established.
+	TCPEstablished time.Duration
+
+	// TCPTransient applies to TCP connections that are being opened or
+	// closed.
+	TCPTransient time.Duration
+
+	// UDP applies to UDP flows, like Linux's
+	// net.netfilter.nf_conntrack_udp_timeout.
+	UDP time.Duration
+
+	// ICMP applies to ICMP echo exchanges, like Linux's
+	// net.netfilter.nf_conntrack_icmp_timeout.
+	ICMP time.Duration
+}
+
+// DefaultConnTrackTimeouts returns the default timeouts of Linux.
+func DefaultConnTrackTimeouts() ConnTrackTimeouts {
+	return ConnTrackTimeouts{
+		TCPEstablished: 5 * 24 * time.Hour,
+		TCPTransient:   2 * time.Minute,
+		UDP:            30 * time.Second,
+		ICMP:           30 * time.Second,
+	}
+}
+
+// A ConnTuple identifies one direction of a tracked connection.
+type ConnTuple struct {
+	// Protocol is the transport protocol of the connection.
+	Protocol tcpip.TransportProtocolNumber
+
+	// SrcAddr is the source address of packets in this direction.
+	SrcAddr tcpip.Address
+
+	// DstAddr is the destination address of packets in this direction.
+	DstAddr tcpip.Address
+
+	// SrcPort is the source port of TCP and UDP packets. For ICMP, it holds
+	// the echo identifier.
+	SrcPort uint16
+
+	// DstPort is the destination port of TCP and UDP packets. For ICMP, it
+	// holds the echo identifier.
+	DstPort uint16
+
+	// ICMPType is the type of ICMP messages.
+	ICMPType header.ICMPv4Type
+
+	// ICMPCode is the code of ICMP messages.
+	ICMPCode byte
+}
+
+// reply returns the tuple of the opposite direction.
+func (t ConnTuple) reply() ConnTuple {
+	r := ConnTuple{
+		Protocol: t.Protocol,
+		SrcAddr:  t.DstAddr,
+		DstAddr:  t.SrcAddr,
+		SrcPort:  t.DstPort,
+		DstPort:  t.SrcPort,
+		ICMPCode: t.ICMPCode,
+	}
+	if t.Protocol == header.ICMPv4ProtocolNumber && t.ICMPType == header.ICMPv4Echo {
+		r.ICMPType = header.ICMPv4EchoReply
+	}
+	return r
+}
+
+// A ConnTrackEntry is a read-only snapshot of a tracked connection, as
+// returned by ConnTrack.Entries.
+type ConnTrackEntry struct {
+	// Original is the tuple of the packet that started the connection.
+	Original ConnTuple
+
+	// Reply is the tuple of replies.
+	Reply ConnTuple
+
+	// State is the state of TCP connections as named by Linux, e.g.
+	// "ESTABLISHED". It is empty for other protocols.
+	State string
+
+	// Timeout is the time left before the connection expires, unless
+	// another of its packets is seen.
+	Timeout time.Duration
+
+	// Replied is true if a reply was seen.
+	Replied bool
+
+	// Assured is true if the connection is established (TCP) or traffic was
+	// seen in both directions (UDP).
+	Assured bool
+}
+
+// ConnState is the state of a packet's connection, as classified by
+// ConnTrack.Track. The values are the bits Linux uses for the states in the
+// masks of "-m state" rules, see include/uapi/linux/netfilter/xt_state.h.
+type ConnState uint8
+
+// Connection states of packets.
+const (
+	// ConnStateInvalid is the state of packets that can't be tracked, such
+	// as TCP segments that neither belong to a tracked connection nor may
+	// start one.
+	ConnStateInvalid ConnState = 1 << 0
+
+	// ConnStateEstablished is the state of packets of connections that have
+	// seen packets in both directions.
+	ConnStateEstablished ConnState = 1 << 1
+
+	// ConnStateRelated is the state of ICMP errors about packets of a
+	// tracked connection.
+	ConnStateRelated ConnState = 1 << 2
+
+	// ConnStateNew is the state of packets that start a connection, or that
+	// belong to a connection that hasn't seen a reply yet.
+	ConnStateNew ConnState = 1 << 3
+
+	// ConnStateUntracked is the state of packets marked with NoTrack.
+	ConnStateUntracked ConnState = 1 << 6
+)
+
+// tcpConnState is the state of a tracked TCP connection.
+type tcpConnState int
+
+// TCP connection states, named after those of Linux in
+// include/uapi/linux/netfilter/nf_conntrack_tcp.h.
+const (
+	tcpSynSent tcpConnState = iota
+	tcpSynRecv
+	tcpEstablished
+	tcpFinWait
+	tcpLastAck
+	tcpTimeWait
+	tcpClose
+)
+
+// String returns the name Linux uses for s in /proc/net/nf_conntrack.
+func (s tcpConnState) String() string {
+	switch s {
+	case tcpSynSent:
+		return "SYN_SENT"
+	case tcpSynRecv:
+		return "SYN_RECV"
+	case tcpEstablished:
+		return "ESTABLISHED"
+	case tcpFinWait:
+		return "FIN_WAIT"
+	case tcpLastAck:
+		return "LAST_ACK"
+	case tcpTimeWait:
+		return "TIME_WAIT"
+	default:
+		return "CLOSE"
+	}
+}
+
+// conn is a tracked connection.
+type conn struct {
+	original ConnTuple
+	reply    ConnTuple
+
+	// id orders connections by creation.
+	id uint64
+
+	// tcpState is the state of TCP connections.
+	tcpState tcpConnState
+
+	// finReply is true if the first FIN of a closing TCP connection was
+	// sent in the reply direction.
+	finReply bool
+
+	replied bool
+	assured bool
+
+	// expires is the monotonic time at which the connection expires.
+	expires int64
+}
+
+// ConnTrack tracks the connections of the packets that go through a network
+// stack, like Linux's nf_conntrack. Connections are started by TCP SYNs, UDP
+// datagrams and ICMP echo requests, and expire when they have been idle for
+// the timeout of their protocol and state.
+//
+// The number of tracked connections may be limited. When the table is full,
+// a few connections are examined and those that expired are evicted; if there
+// are none, packets starting new connections are dropped and counted.
+type ConnTrack struct {
+	clock tcpip.Clock
+
+	mu sync.Mutex
+
+	// max is the maximum number of tracked connections. If it is 0, the
+	// number isn't limited. max is protected by mu.
+	max int
+
+	// timeouts is protected by mu.
+	timeouts ConnTrackTimeouts
+
+	// conns maps both tuples of each tracked connection to it. It is
+	// protected by mu.
+	conns map[ConnTuple]*conn
+
+	// count is the number of tracked connections. It is protected by mu.
+	count int
+
+	// nextID is the id of the next connection. It is protected by mu.
+	nextID uint64
+
+	// dropped is the number of packets dropped because the table was full.
+	// It is protected by mu.
+	dropped uint64
+}
+
+// NewConnTrack returns a ConnTrack that tracks at most max connections, with
+// the default timeouts, and uses clock to expire them.
+func NewConnTrack(clock tcpip.Clock, max int) *ConnTrack {
+	return &ConnTrack{
+		clock:    clock,
+		max:      max,
+		timeouts: DefaultConnTrackTimeouts(),
+		conns:    make(map[ConnTuple]*conn),
+	}
+}
+
+// Max returns the maximum number of tracked connections, or 0 if it isn't
+// limited.
+func (ct *ConnTrack) Max() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.max
+}
+
+// SetMax sets the maximum number of tracked connections. If max is 0, the
+// number isn't limited. Connections that are already tracked are kept even if
+// there are more than max.
+func (ct *ConnTrack) SetMax(max int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.max = max
+}
+
+// Timeouts returns the times after which idle connections expire.
+func (ct *ConnTrack) Timeouts() ConnTrackTimeouts {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.timeouts
+}
+
+// SetTimeouts sets the times after which idle connections expire. Tracked
+// connections get the new timeouts when their next packet is seen.
+func (ct *ConnTrack) SetTimeouts(timeouts ConnTrackTimeouts) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.timeouts = timeouts
+}
+
+// Count returns the number of tracked connections that haven't expired.
+func (ct *ConnTrack) Count() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.reapLocked(ct.clock.NowMonotonic())
+	return ct.count
+}
+
+// Dropped returns the number of packets dropped because they would have
+// started a new connection while the table was full.
+func (ct *ConnTrack) Dropped() uint64 {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.dropped
+}
+
+// Entries returns the tracked connections that haven't expired, in the order
+// they were started.
+func (ct *ConnTrack) Entries() []ConnTrackEntry {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := ct.clock.NowMonotonic()
+	ct.reapLocked(now)
+
+	conns := make([]*conn, 0, ct.count)
+	for tuple, c := range ct.conns {
+		if tuple == c.original {
+			conns = append(conns, c)
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].id < conns[j].id
+	})
+
+	entries := make([]ConnTrackEntry, 0, len(conns))
+	for _, c := range conns {
+		entry := ConnTrackEntry{
+			Original: c.original,
+			Reply:    c.reply,
+			Timeout:  time.Duration(c.expires - now),
+			Replied:  c.replied,
+			Assured:  c.assured,
+		}
+		if c.original.Protocol == header.TCPProtocolNumber {
+			entry.State = c.tcpState.String()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// HandlePacket tracks the connection pkt belongs to, starting a new one if
+// pkt may start one. It returns false if pkt should be dropped because it
+// would start a new connection while the table is full.
+//
+// Packets that neither belong to a tracked connection nor may start one, such
+// as TCP segments other than SYNs and ICMP errors, aren't tracked and are
+// always accepted. Neither are packets marked with NoTrack.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (ct *ConnTrack) HandlePacket(pkt tcpip.PacketBuffer) bool {
+	return ct.Track(&pkt)
+}
+
+// Track is like HandlePacket, but also sets pkt.ConnState to the state of
+// pkt's connection. If the destination of the connection is translated, pkt's
+// addresses and ports are rewritten, see DNATTarget.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (ct *ConnTrack) Track(pkt *tcpip.PacketBuffer) bool {
+	ok, _ := ct.track(pkt)
+	return ok
+}
+
+// track is like Track, but also returns whether pkt's connection is
+// translated, or whether pkt is a looped back packet whose connection was
+// already tracked and translated at the Output hook. Either way, the nat table
+// must not be consulted for pkt.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (ct *ConnTrack) track(pkt *tcpip.PacketBuffer) (ok, translated bool) {
+	if pkt.ConnTracked {
+		return true, true
+	}
+	if pkt.NoTrack {
+		pkt.ConnState = uint8(ConnStateUntracked)
+		return true, false
+	}
+	tuple, tcpFlags, ok := packetTuple(*pkt)
+	if !ok {
+		pkt.ConnState = uint8(ConnStateInvalid)
+		if inner, ok := icmpErrorTuple(*pkt); ok && ct.tracks(inner) {
+			pkt.ConnState = uint8(ConnStateRelated)
+		}
+		return true, false
+	}
+	state, rw, ok := ct.handle(tuple, tcpFlags)
+	pkt.ConnState = uint8(state)
+	if rw != nil {
+		rewriteAddress(pkt, rw.src, rw.addr, rw.port)
+	}
+	return ok, rw != nil
+}
+
+// classify is like track, but doesn't track pkt's connection. It sets
+// pkt.ConnState to the state track would give pkt, rewrites pkt like track
+// would if its connection is translated, and returns whether track would
+// accept pkt and whether the nat table must be skipped. Dry runs use it on
+// their own packets so that they don't change the table.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (ct *ConnTrack) classify(pkt *tcpip.PacketBuffer) (ok, translated bool) {
+	if pkt.ConnTracked {
+		return true, true
+	}
+	if pkt.NoTrack {
+		pkt.ConnState = uint8(ConnStateUntracked)
+		return true, false
+	}
+	tuple, tcpFlags, ok := packetTuple(*pkt)
+	if !ok {
+		pkt.ConnState = uint8(ConnStateInvalid)
+		if inner, ok := icmpErrorTuple(*pkt); ok && ct.tracks(inner) {
+			pkt.ConnState = uint8(ConnStateRelated)
+		}
+		return true, false
+	}
+	state, rw, ok := ct.lookup(tuple, tcpFlags)
+	pkt.ConnState = uint8(state)
+	if rw != nil {
+		rewriteAddress(pkt, rw.src, rw.addr, rw.port)
+	}
+	return ok, rw != nil
+}
+
+// Seed tracks the connection of a packet with tuple and, for TCP, flags
+// tcpFlags, as if the packet had been tracked. The stack may use it to track
+// the connections it opens before their first packet is sent, so that replies
+// are classified as established. It returns false if the packet neither
+// belongs to a tracked connection nor may start one, or if the table is full.
+func (ct *ConnTrack) Seed(tuple ConnTuple, tcpFlags uint8) bool {
+	state, _, ok := ct.handle(tuple, tcpFlags)
+	return ok && state != ConnStateInvalid
+}
+
+// handle tracks the connection of a packet with tuple and TCP flags tcpFlags,
+// and returns the state of the packet and, if its connection is translated,
+// how it must be rewritten. It returns false if the packet should be dropped
+// because the table is full.
+func (ct *ConnTrack) handle(tuple ConnTuple, tcpFlags uint8) (ConnState, *addrRewrite, bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := ct.clock.NowMonotonic()
+
+	if c, ok := ct.conns[tuple]; ok {
+		reply := tuple != c.original
+		switch {
+		case c.expires <= now:
+			ct.removeLocked(c)
+		case !reply && c.closed() && startsConn(tuple, tcpFlags):
+			// The connection is being reopened.
+			ct.removeLocked(c)
+		default:
+			c.update(reply, tcpFlags, &ct.timeouts, now)
+			if c.replied {
+				return ConnStateEstablished, c.rewrite(reply), true
+			}
+			return ConnStateNew, c.rewrite(reply), true
+		}
+	}
+
+	if !startsConn(tuple, tcpFlags) {
+		return ConnStateInvalid, nil, true
+	}
+	reply := tuple.reply()
+	if c, ok := ct.conns[reply]; ok {
+		if c.expires > now {
+			// The reply tuple belongs to another connection, so this
+			// one can't be tracked.
+			return ConnStateInvalid, nil, true
+		}
+		ct.removeLocked(c)
+	}
+	if ct.max > 0 && ct.count >= ct.max {
+		ct.evictLocked(now)
+		if ct.count >= ct.max {
+			ct.dropped++
+			return ConnStateInvalid, nil, false
+		}
+	}
+
+	c := &conn{
+		original: tuple,
+		reply:    reply,
+		id:       ct.nextID,
+		tcpState: tcpSynSent,
+	}
+	ct.nextID++
+	ct.conns[c.original] = c
+	ct.conns[c.reply] = c
+	ct.count++
+	c.update(false /* reply */, tcpFlags, &ct.timeouts, now)
+	return ConnStateNew, nil, true
+}
+
+// lookup is like handle, but doesn't change the table. It returns the state
+// and the rewriting handle would return for a packet with tuple and TCP flags
+// tcpFlags, and whether handle would accept it. When the
+// table is full, lookup examines as many connections as handle would, but
+// since both pick them at random, they may disagree if only some connections
+// expired.
+func (ct *ConnTrack) lookup(tuple ConnTuple, tcpFlags uint8) (ConnState, *addrRewrite, bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := ct.clock.NowMonotonic()
+
+	c, found := ct.conns[tuple]
+	if found && c.expires > now {
+		reply := tuple != c.original
+		if reply || !c.closed() || !startsConn(tuple, tcpFlags) {
+			if reply || c.replied {
+				return ConnStateEstablished, c.rewrite(reply), true
+			}
+			return ConnStateNew, c.rewrite(reply), true
+		}
+	}
+	// Otherwise handle removes c, if found, so it is ignored below.
+
+	if !startsConn(tuple, tcpFlags) {
+		return ConnStateInvalid, nil, true
+	}
+	old, oldFound := ct.conns[tuple.reply()]
+	if oldFound && old != c && old.expires > now {
+		return ConnStateInvalid, nil, true
+	}
+	if ct.max > 0 && ct.count >= ct.max {
+		// handle removes c and old, if found, before evicting.
+		live := ct.count
+		if found {
+			live--
+		}
+		if oldFound && old != c {
+			live--
+		}
+		examined := 0
+		for t, other := range ct.conns {
+			if examined == connTrackEvictRange || live < ct.max {
+				break
+			}
+			if t != other.original || other == c || other == old {
+				continue
+			}
+			examined++
+			if other.expires <= now {
+				live--
+			}
+		}
+		if live >= ct.max {
+			return ConnStateInvalid, nil, false
+		}
+	}
+	return ConnStateNew, nil, true
+}
+
+// bindDestination translates the destination of the connection started by a
+// packet with tuple to addr and, for TCP and UDP, port. Its later packets are
+// then rewritten by Track: those in the original direction are sent to addr
+// and port, and the source of replies is translated back to the original
+// destination.
+//
+// Like Linux, which only consults the nat table for the first packet of a
+// connection, destinations are only bound for packets in the original
+// direction of connections that haven't been replied to nor translated yet.
+// bound is false for other packets, which must not be rewritten. ok is false
+// if the packet should be dropped because the translated connection would
+// clash with another tracked one.
+func (ct *ConnTrack) bindDestination(tuple ConnTuple, addr tcpip.Address, port uint16) (bound, ok bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := ct.clock.NowMonotonic()
+
+	c, found := ct.conns[tuple]
+	if !found || tuple != c.original || c.replied || c.translated() || c.expires <= now {
+		return false, true
+	}
+	reply, bound, ok := ct.boundReplyLocked(c, addr, port, now)
+	if !bound {
+		return false, ok
+	}
+	if other, found := ct.conns[reply]; found {
+		// boundReplyLocked checked that other expired.
+		ct.removeLocked(other)
+	}
+	delete(ct.conns, c.reply)
+	c.reply = reply
+	ct.conns[c.reply] = c
+	return true, true
+}
+
+// previewDestination is like bindDestination, but doesn't change the table.
+// It returns whether bindDestination would bind the destination of the
+// connection started by a packet with tuple and TCP flags tcpFlags, as tracked
+// by handle, and whether it would accept it. Dry runs use it, since their
+// packets don't start tracked connections.
+func (ct *ConnTrack) previewDestination(tuple ConnTuple, tcpFlags uint8, addr tcpip.Address, port uint16) (bound, ok bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := ct.clock.NowMonotonic()
+
+	c, found := ct.conns[tuple]
+	if found && c.expires > now && (tuple != c.original || !c.closed() || !startsConn(tuple, tcpFlags)) {
+		// handle would keep c.
+		if tuple != c.original || c.replied || c.translated() {
+			return false, true
+		}
+	} else {
+		if !startsConn(tuple, tcpFlags) {
+			return false, true
+		}
+		// handle would start a new connection.
+		c = &conn{original: tuple, reply: tuple.reply()}
+	}
+	_, bound, ok = ct.boundReplyLocked(c, addr, port, now)
+	return bound, ok
+}
+
+// boundReplyLocked returns the reply tuple of c once its destination is bound
+// to addr and port, and whether it changes. ok is false if the new reply tuple
+// belongs to another connection that hasn't expired, or to c itself.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *ConnTrack) boundReplyLocked(c *conn, addr tcpip.Address, port uint16, now int64) (reply ConnTuple, bound, ok bool) {
+	reply = c.reply
+	reply.SrcAddr = addr
+	if reply.Protocol == header.TCPProtocolNumber || reply.Protocol == header.UDPProtocolNumber {
+		reply.SrcPort = port
+	}
+	if reply == c.reply {
+		// The destination is unchanged.
+		return reply, false, true
+	}
+	if reply == c.original {
+		return reply, false, false
+	}
+	if other, found := ct.conns[reply]; found && other.expires > now {
+		return reply, false, false
+	}
+	return reply, true, true
+}
+
+// tracks returns true if tuple belongs to a tracked connection that hasn't
+// expired.
+func (ct *ConnTrack) tracks(tuple ConnTuple) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	c, ok := ct.conns[tuple]
+	return ok && c.expires > ct.clock.NowMonotonic()
+}
+
+// reapLocked removes the connections that expired at or before now.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *ConnTrack) reapLocked(now int64) {
+	for tuple, c := range ct.conns {
+		if tuple == c.original && c.expires <= now {
+			ct.removeLocked(c)
+		}
+	}
+}
+
+// evictLocked examines at most connTrackEvictRange connections, and removes
+// those that expired at or before now. Go randomizes map iteration, so
+// successive calls examine different connections.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *ConnTrack) evictLocked(now int64) {
+	examined := 0
+	for tuple, c := range ct.conns {
+		if examined == connTrackEvictRange {
+			return
+		}
+		if tuple != c.original {
+			continue
+		}
+		examined++
+		if c.expires <= now {
+			ct.removeLocked(c)
+		}
+	}
+}
+
+// removeLocked stops tracking c.
+//
+// Preconditions: ct.mu must be locked. c must be tracked by ct.
+func (ct *ConnTrack) removeLocked(c *conn) {
+	delete(ct.conns, c.original)
+	delete(ct.conns, c.reply)
+	ct.count--
+}
+
+// translated returns true if the destination of c is translated, i.e. if its
+// replies don't come from its original destination.
+func (c *conn) translated() bool {
+	return c.reply.SrcAddr != c.original.DstAddr || c.reply.SrcPort != c.original.DstPort
+}
+
+// An addrRewrite is the rewriting of the packets of a translated connection.
+type addrRewrite struct {
+	// src is true if the source of packets is rewritten, and false if it
+	// is their destination.
+	src bool
+
+	addr tcpip.Address
+	port uint16
+}
+
+// rewrite returns how packets of c are rewritten in the reply direction if
+// reply is true, or in the original direction otherwise. It returns nil if c
+// isn't translated.
+func (c *conn) rewrite(reply bool) *addrRewrite {
+	if !c.translated() {
+		return nil
+	}
+	if reply {
+		// Replies appear to come from the original destination.
+		return &addrRewrite{src: true, addr: c.original.DstAddr, port: c.original.DstPort}
+	}
+	return &addrRewrite{addr: c.reply.SrcAddr, port: c.reply.SrcPort}
+}
+
+// closed returns true if c is a TCP connection that is closed or closing, so
+// that a new SYN may reopen it.
+func (c *conn) closed() bool {
+	return c.original.Protocol == header.TCPProtocolNumber && (c.tcpState == tcpTimeWait || c.tcpState == tcpClose)
+}
+
+// update records that a packet with TCP flags tcpFlags was seen in the reply
+// direction if reply is true, or in the original direction otherwise, and
+// extends c's lifetime.
+func (c *conn) update(reply bool, tcpFlags uint8, timeouts *ConnTrackTimeouts, now int64) {
+	if reply {
+		c.replied = true
+	}
+
+	var timeout time.Duration
+	switch c.original.Protocol {
+	case header.TCPProtocolNumber:
+		c.updateTCP(reply, tcpFlags)
+		timeout = timeouts.TCPTransient
+		if c.tcpState == tcpEstablished {
+			timeout = timeouts.TCPEstablished
+		}
+	case header.UDPProtocolNumber:
+		if reply {
+			c.assured = true
+		}
+		timeout = timeouts.UDP
+	default:
+		timeout = timeouts.ICMP
+	}
+	c.expires = now + timeout.Nanoseconds()
+}
+
+// updateTCP moves c to its next state after a segment with flags was seen in
+// the reply direction if reply is true, or in the original direction
+// otherwise. Unlike Linux, sequence numbers aren't checked.
+func (c *conn) updateTCP(reply bool, flags uint8) {
+	const synAck = header.TCPFlagSyn | header.TCPFlagAck
+	if flags&header.TCPFlagRst != 0 {
+		c.tcpState = tcpClose
+		return
+	}
+	switch c.tcpState {
+	case tcpSynSent:
+		if reply && flags&synAck == synAck {
+			c.tcpState = tcpSynRecv
+		}
+	case tcpSynRecv:
+		if !reply && flags&synAck == header.TCPFlagAck {
+			c.tcpState = tcpEstablished
+			c.assured = true
+		}
+	case tcpEstablished:
+		if flags&header.TCPFlagFin != 0 {
+			c.tcpState = tcpFinWait
+			c.finReply = reply
+		}
+	case tcpFinWait:
+		if flags&header.TCPFlagFin != 0 && reply != c.finReply {
+			c.tcpState = tcpLastAck
+		}
+	case tcpLastAck:
+		// The side that closed first acknowledges the other side's FIN.
+		if flags&header.TCPFlagAck != 0 && reply == c.finReply {
+			c.tcpState = tcpTimeWait
+		}
+	}
+}
+
+// packetTuple returns the tuple of pkt in the direction it travels and, for
+// TCP, its flags. It returns false if pkt can't be tracked.
+//
+// Precondition: pkt.NetworkHeader is set.
+func packetTuple(pkt tcpip.PacketBuffer) (ConnTuple, uint8, bool) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	// Only the first fragment of a datagram holds the transport header.
+	if ipHdr.FragmentOffset() != 0 {
+		return ConnTuple{}, 0, false
+	}
+
+	// buf is large enough for every header parsed below.
+	var buf [header.TCPMinimumSize]byte
+	payload := PeekTransportHeader(pkt, len(buf), buf[:])
+
+	tuple := ConnTuple{
+		Protocol: ipHdr.TransportProtocol(),
+		SrcAddr:  ipHdr.SourceAddress(),
+		DstAddr:  ipHdr.DestinationAddress(),
+	}
+	switch tuple.Protocol {
+	case header.TCPProtocolNumber:
+		if len(payload) < header.TCPMinimumSize {
+			return ConnTuple{}, 0, false
+		}
+		tcp := header.TCP(payload)
+		tuple.SrcPort = tcp.SourcePort()
+		tuple.DstPort = tcp.DestinationPort()
+		return tuple, tcp.Flags(), true
+	case header.UDPProtocolNumber:
+		if len(payload) < header.UDPMinimumSize {
+			return ConnTuple{}, 0, false
+		}
+		udp := header.UDP(payload)
+		tuple.SrcPort = udp.SourcePort()
+		tuple.DstPort = udp.DestinationPort()
+		return tuple, 0, true
+	case header.ICMPv4ProtocolNumber:
+		if len(payload) < header.ICMPv4MinimumSize {
+			return ConnTuple{}, 0, false
+		}
+		icmp := header.ICMPv4(payload)
+		if typ := icmp.Type(); typ != header.ICMPv4Echo && typ != header.ICMPv4EchoReply {
+			return ConnTuple{}, 0, false
+		}
+		tuple.ICMPType = icmp.Type()
+		tuple.ICMPCode = icmp.Code()
+		tuple.SrcPort = icmp.Ident()
+		tuple.DstPort = icmp.Ident()
+		return tuple, 0, true
+	default:
+		return ConnTuple{}, 0, false
+	}
+}
+
+// icmpErrorTuple returns the tuple of the packet quoted by pkt, if pkt is an
+// ICMP error. The quoted packet holds the IPv4 header and the first
+// ICMPErrorQuoteLen bytes of the payload of the packet that caused the error,
+// which hold the ports of TCP and UDP packets.
+//
+// Precondition: pkt.NetworkHeader is set.
+func icmpErrorTuple(pkt tcpip.PacketBuffer) (ConnTuple, bool) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	if ipHdr.TransportProtocol() != header.ICMPv4ProtocolNumber || ipHdr.FragmentOffset() != 0 {
+		return ConnTuple{}, false
+	}
+	var buf [header.ICMPv4MinimumSize + header.IPv4MaximumHeaderSize + ICMPErrorQuoteLen]byte
+	icmp := header.ICMPv4(PeekTransportHeader(pkt, len(buf), buf[:]))
+	if len(icmp) < header.ICMPv4MinimumSize {
+		return ConnTuple{}, false
+	}
+	switch icmp.Type() {
+	case header.ICMPv4DstUnreachable, header.ICMPv4SrcQuench, header.ICMPv4Redirect, header.ICMPv4TimeExceeded, header.ICMPv4ParamProblem:
+	default:
+		return ConnTuple{}, false
+	}
+
+	quoted := header.IPv4(icmp.Payload())
+	if len(quoted) < header.IPv4MinimumSize {
+		return ConnTuple{}, false
+	}
+	hlen := int(quoted.HeaderLength())
+	if hlen < header.IPv4MinimumSize || len(quoted) < hlen+ICMPErrorQuoteLen {
+		return ConnTuple{}, false
+	}
+	transport := []byte(quoted[hlen:])
+	tuple := ConnTuple{
+		Protocol: quoted.TransportProtocol(),
+		SrcAddr:  quoted.SourceAddress(),
+		DstAddr:  quoted.DestinationAddress(),
+	}
+	switch tuple.Protocol {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(transport)
+		tuple.SrcPort = tcp.SourcePort()
+		tuple.DstPort = tcp.DestinationPort()
+	case header.UDPProtocolNumber:
+		udp := header.UDP(transport)
+		tuple.SrcPort = udp.SourcePort()
+		tuple.DstPort = udp.DestinationPort()
+	case header.ICMPv4ProtocolNumber:
+		quotedICMP := header.ICMPv4(transport)
+		if typ := quotedICMP.Type(); typ != header.ICMPv4Echo && typ != header.ICMPv4EchoReply {
+			return ConnTuple{}, false
+		}
+		tuple.ICMPType = quotedICMP.Type()
+		tuple.ICMPCode = quotedICMP.Code()
+		tuple.SrcPort = quotedICMP.Ident()
+		tuple.DstPort = quotedICMP.Ident()
+	default:
+		return ConnTuple{}, false
+	}
+	return tuple, true
+}
+
+// startsConn returns true if a packet with tuple and TCP flags tcpFlags may
+// start a new connection.
+func startsConn(tuple ConnTuple, tcpFlags uint8) bool {
+	switch tuple.Protocol {
+	case header.TCPProtocolNumber:
+		const mask = header.TCPFlagSyn | header.TCPFlagAck | header.TCPFlagRst | header.TCPFlagFin
+		return tcpFlags&mask == header.TCPFlagSyn
+	case header.ICMPv4ProtocolNumber:
+		return tuple.ICMPType == header.ICMPv4Echo
+	default:
+		return true
+	}
+}
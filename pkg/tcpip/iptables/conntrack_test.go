@@ -0,0 +1,557 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	clientAddr = tcpip.Address("\x0a\x00\x00\x01")
+	serverAddr = tcpip.Address("\x0a\x00\x00\x02")
+)
+
+// udpPacket returns a UDP packet from the client's srcPort to the server's
+// port 53.
+func udpPacket(srcPort uint16) tcpip.PacketBuffer {
+	return PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  srcPort,
+		DstPort:  53,
+	}.packet()
+}
+
+// tcpPacket returns a TCP segment with flags between the client's port 1234
+// and the server's port 80, sent by the server if reply is true.
+func tcpPacket(reply bool, flags uint8) tcpip.PacketBuffer {
+	spec := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: flags,
+	}
+	if reply {
+		spec.SrcAddr, spec.DstAddr = spec.DstAddr, spec.SrcAddr
+		spec.SrcPort, spec.DstPort = spec.DstPort, spec.SrcPort
+	}
+	return spec.packet()
+}
+
+// icmpEchoPacket returns an ICMP echo message of type typ with identifier 7,
+// sent from src to dst.
+func icmpEchoPacket(typ header.ICMPv4Type, src, dst tcpip.Address) tcpip.PacketBuffer {
+	hdr := buffer.NewView(header.IPv4MinimumSize + header.ICMPv4MinimumSize)
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.ICMPv4ProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	icmp := header.ICMPv4(hdr[header.IPv4MinimumSize:])
+	icmp.SetType(typ)
+	icmp.SetIdent(7)
+	return tcpip.PacketBuffer{
+		Data:            hdr.ToVectorisedView(),
+		NetworkHeader:   hdr[:header.IPv4MinimumSize],
+		TransportHeader: buffer.View(icmp),
+	}
+}
+
+func TestDefaultConnTrackMax(t *testing.T) {
+	for _, tc := range []struct {
+		totalMem uint64
+		want     int
+	}{
+		{totalMem: 0, want: 1024},
+		{totalMem: 64 << 20, want: 1024},
+		{totalMem: 512 << 20, want: 4096},
+		{totalMem: 1 << 30, want: 8192},
+		{totalMem: 2 << 30, want: 65536},
+		{totalMem: 8 << 30, want: 262144},
+	} {
+		if got := DefaultConnTrackMax(tc.totalMem); got != tc.want {
+			t.Errorf("DefaultConnTrackMax(%d) = %d, want %d", tc.totalMem, got, tc.want)
+		}
+	}
+}
+
+func TestConnTrackFull(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, 3)
+
+	for port := uint16(1000); port < 1003; port++ {
+		if !ct.HandlePacket(udpPacket(port)) {
+			t.Fatalf("HandlePacket(UDP from port %d) = false, want true", port)
+		}
+	}
+	if got := ct.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+
+	// New connections are refused and counted while the table is full.
+	for i := 0; i < 2; i++ {
+		if ct.HandlePacket(udpPacket(2000)) {
+			t.Errorf("HandlePacket(new UDP flow) = true with a full table, want false")
+		}
+	}
+	if got := ct.Dropped(); got != 2 {
+		t.Errorf("Dropped() = %d, want 2", got)
+	}
+
+	// Tracked connections and packets that can't start one aren't affected.
+	if !ct.HandlePacket(udpPacket(1000)) {
+		t.Errorf("HandlePacket(tracked UDP flow) = false, want true")
+	}
+	if !ct.HandlePacket(tcpPacket(false /* reply */, header.TCPFlagAck)) {
+		t.Errorf("HandlePacket(untracked TCP ACK) = false, want true")
+	}
+	if got := ct.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+
+	// Once connections expire, they are evicted to make room.
+	clock.Advance(ct.Timeouts().UDP)
+	if !ct.HandlePacket(udpPacket(2000)) {
+		t.Errorf("HandlePacket(new UDP flow) = false after connections expired, want true")
+	}
+	if got := ct.Count(); got != 1 {
+		t.Errorf("Count() = %d, want 1", got)
+	}
+
+	// Lowering the limit keeps tracked connections, and raising it makes
+	// room.
+	ct.SetMax(1)
+	if ct.HandlePacket(udpPacket(3000)) {
+		t.Errorf("HandlePacket(new UDP flow) = true with a full table, want false")
+	}
+	ct.SetMax(0)
+	for port := uint16(3000); port < 3100; port++ {
+		if !ct.HandlePacket(udpPacket(port)) {
+			t.Fatalf("HandlePacket(UDP from port %d) = false with no limit, want true", port)
+		}
+	}
+	if got := ct.Count(); got != 101 {
+		t.Errorf("Count() = %d, want 101", got)
+	}
+}
+
+// TestConnTrackFullEviction fills a large table and checks that starting a
+// connection while it is full only examines a few of its connections.
+func TestConnTrackFullEviction(t *testing.T) {
+	const max = 1000
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, max)
+
+	for port := uint16(1000); port < 1000+max; port++ {
+		if !ct.HandlePacket(udpPacket(port)) {
+			t.Fatalf("HandlePacket(UDP from port %d) = false, want true", port)
+		}
+	}
+	tuple, _, _ := packetTuple(udpPacket(5000))
+	if _, _, ok := ct.lookup(tuple, 0); ok {
+		t.Errorf("lookup(new UDP flow) accepted with a full table, want refused")
+	}
+	if ct.HandlePacket(udpPacket(5000)) {
+		t.Errorf("HandlePacket(new UDP flow) = true with a full table, want false")
+	}
+
+	// Once all connections expired, the next new one evicts a bounded
+	// number of them rather than all.
+	clock.Advance(ct.Timeouts().UDP)
+	if _, _, ok := ct.lookup(tuple, 0); !ok {
+		t.Errorf("lookup(new UDP flow) refused after connections expired, want accepted")
+	}
+	if !ct.HandlePacket(udpPacket(5000)) {
+		t.Fatalf("HandlePacket(new UDP flow) = false after connections expired, want true")
+	}
+	ct.mu.Lock()
+	count := ct.count
+	ct.mu.Unlock()
+	if want := max - connTrackEvictRange + 1; count < want {
+		t.Errorf("got %d tracked connections, want at least %d", count, want)
+	}
+	if got := ct.Count(); got != 1 {
+		t.Errorf("Count() = %d, want 1", got)
+	}
+}
+
+func TestConnTrackExpiry(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, 0)
+	timeouts := DefaultConnTrackTimeouts()
+	timeouts.UDP = 10 * time.Second
+	ct.SetTimeouts(timeouts)
+
+	ct.HandlePacket(udpPacket(1000))
+	clock.Advance(9 * time.Second)
+	if got := ct.Count(); got != 1 {
+		t.Fatalf("Count() = %d before the timeout, want 1", got)
+	}
+
+	// Packets refresh the timeout.
+	ct.HandlePacket(udpPacket(1000))
+	clock.Advance(9 * time.Second)
+	entries := ct.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries after refreshing, want 1", len(entries))
+	}
+	if got, want := entries[0].Timeout, time.Second; got != want {
+		t.Errorf("got timeout %s, want %s", got, want)
+	}
+
+	clock.Advance(time.Second)
+	if got := ct.Count(); got != 0 {
+		t.Errorf("Count() = %d after the timeout, want 0", got)
+	}
+	if entries := ct.Entries(); len(entries) != 0 {
+		t.Errorf("got entries %+v after the timeout, want none", entries)
+	}
+}
+
+func TestConnTrackTCP(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, 0)
+	timeouts := ct.Timeouts()
+
+	original := ConnTuple{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+	}
+	reply := ConnTuple{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  serverAddr,
+		DstAddr:  clientAddr,
+		SrcPort:  80,
+		DstPort:  1234,
+	}
+	for _, step := range []struct {
+		name    string
+		reply   bool
+		flags   uint8
+		want    string
+		timeout time.Duration
+		replied bool
+		assured bool
+	}{
+		{
+			name:    "SYN",
+			flags:   header.TCPFlagSyn,
+			want:    "SYN_SENT",
+			timeout: timeouts.TCPTransient,
+		},
+		{
+			name:    "SYN-ACK",
+			reply:   true,
+			flags:   header.TCPFlagSyn | header.TCPFlagAck,
+			want:    "SYN_RECV",
+			timeout: timeouts.TCPTransient,
+			replied: true,
+		},
+		{
+			name:    "ACK",
+			flags:   header.TCPFlagAck,
+			want:    "ESTABLISHED",
+			timeout: timeouts.TCPEstablished,
+			replied: true,
+			assured: true,
+		},
+		{
+			name:    "data",
+			reply:   true,
+			flags:   header.TCPFlagAck | header.TCPFlagPsh,
+			want:    "ESTABLISHED",
+			timeout: timeouts.TCPEstablished,
+			replied: true,
+			assured: true,
+		},
+		{
+			name:    "FIN",
+			flags:   header.TCPFlagFin | header.TCPFlagAck,
+			want:    "FIN_WAIT",
+			timeout: timeouts.TCPTransient,
+			replied: true,
+			assured: true,
+		},
+		{
+			name:    "reply FIN",
+			reply:   true,
+			flags:   header.TCPFlagFin | header.TCPFlagAck,
+			want:    "LAST_ACK",
+			timeout: timeouts.TCPTransient,
+			replied: true,
+			assured: true,
+		},
+		{
+			name:    "last ACK",
+			flags:   header.TCPFlagAck,
+			want:    "TIME_WAIT",
+			timeout: timeouts.TCPTransient,
+			replied: true,
+			assured: true,
+		},
+	} {
+		if !ct.HandlePacket(tcpPacket(step.reply, step.flags)) {
+			t.Fatalf("%s: HandlePacket() = false, want true", step.name)
+		}
+		want := []ConnTrackEntry{{
+			Original: original,
+			Reply:    reply,
+			State:    step.want,
+			Timeout:  step.timeout,
+			Replied:  step.replied,
+			Assured:  step.assured,
+		}}
+		if diff := cmp.Diff(want, ct.Entries()); diff != "" {
+			t.Fatalf("%s: Entries() mismatch (-want +got):\n%s", step.name, diff)
+		}
+	}
+
+	// A new SYN reopens the connection.
+	ct.HandlePacket(tcpPacket(false /* reply */, header.TCPFlagSyn))
+	if entries := ct.Entries(); len(entries) != 1 || entries[0].State != "SYN_SENT" || entries[0].Replied {
+		t.Errorf("got entries %+v after a new SYN, want one unreplied SYN_SENT connection", entries)
+	}
+
+	// A reset closes it.
+	ct.HandlePacket(tcpPacket(true /* reply */, header.TCPFlagRst|header.TCPFlagAck))
+	if entries := ct.Entries(); len(entries) != 1 || entries[0].State != "CLOSE" {
+		t.Errorf("got entries %+v after a reset, want one CLOSE connection", entries)
+	}
+	clock.Advance(timeouts.TCPTransient)
+	if got := ct.Count(); got != 0 {
+		t.Errorf("Count() = %d after the connection expired, want 0", got)
+	}
+}
+
+func TestConnTrackICMP(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, 0)
+
+	// Echo replies don't start connections.
+	ct.HandlePacket(icmpEchoPacket(header.ICMPv4EchoReply, serverAddr, clientAddr))
+	if got := ct.Count(); got != 0 {
+		t.Fatalf("Count() = %d after an echo reply, want 0", got)
+	}
+
+	ct.HandlePacket(icmpEchoPacket(header.ICMPv4Echo, clientAddr, serverAddr))
+	ct.HandlePacket(icmpEchoPacket(header.ICMPv4EchoReply, serverAddr, clientAddr))
+	want := []ConnTrackEntry{{
+		Original: ConnTuple{
+			Protocol: header.ICMPv4ProtocolNumber,
+			SrcAddr:  clientAddr,
+			DstAddr:  serverAddr,
+			SrcPort:  7,
+			DstPort:  7,
+			ICMPType: header.ICMPv4Echo,
+		},
+		Reply: ConnTuple{
+			Protocol: header.ICMPv4ProtocolNumber,
+			SrcAddr:  serverAddr,
+			DstAddr:  clientAddr,
+			SrcPort:  7,
+			DstPort:  7,
+			ICMPType: header.ICMPv4EchoReply,
+		},
+		Timeout: ct.Timeouts().ICMP,
+		Replied: true,
+	}}
+	if diff := cmp.Diff(want, ct.Entries()); diff != "" {
+		t.Errorf("Entries() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// dstPortMatcher matches UDP packets to a destination port.
+type dstPortMatcher struct {
+	port uint16
+}
+
+// Name implements Matcher.Name.
+func (*dstPortMatcher) Name() string {
+	return "udp"
+}
+
+// Match implements Matcher.Match.
+func (m *dstPortMatcher) Match(_ Hook, pkt tcpip.PacketBuffer, _ string) (bool, bool) {
+	return header.UDP(pkt.TransportHeader).DestinationPort() == m.port, false
+}
+
+// noTrackDNSTables returns the default tables with a raw table rule exempting
+// UDP packets to port 53 from connection tracking, like
+// "iptables -t raw -A PREROUTING -p udp --dport 53 -j CT --notrack".
+func noTrackDNSTables() IPTables {
+	ipt := DefaultTables()
+	raw := ipt.Tables[TablenameRaw]
+	raw.Rules = append([]Rule{{
+		Filter:   IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+		Matchers: []Matcher{&dstPortMatcher{port: 53}},
+		Target:   CTTarget{NoTrack: true},
+	}}, raw.Rules...)
+	raw.BuiltinChains[Output]++
+	raw.Underflows[Prerouting]++
+	raw.Underflows[Output]++
+	ipt.Tables[TablenameRaw] = raw
+	ipt.InitCounters()
+	return ipt
+}
+
+func TestCTTargetNoTrack(t *testing.T) {
+	ipt := noTrackDNSTables()
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ct := NewConnTrack(clock, 0)
+
+	for port := uint16(1000); port < 1010; port++ {
+		pkt := udpPacket(port)
+		if !ipt.Check(Prerouting, &pkt, "") {
+			t.Fatalf("Check(Prerouting, UDP to port 53) = false, want true")
+		}
+		if !pkt.NoTrack {
+			t.Fatalf("UDP packet to port 53 wasn't marked NoTrack")
+		}
+		if !ct.HandlePacket(pkt) {
+			t.Fatalf("HandlePacket(untracked UDP) = false, want true")
+		}
+	}
+	if got := ct.Count(); got != 0 {
+		t.Errorf("Count() = %d after untracked packets, want 0", got)
+	}
+
+	// Other traffic is still tracked.
+	other := PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1000,
+		DstPort:  123,
+	}.packet()
+	syn := tcpPacket(false /* reply */, header.TCPFlagSyn)
+	for _, pkt := range []tcpip.PacketBuffer{other, syn} {
+		if !ipt.Check(Prerouting, &pkt, "") {
+			t.Fatalf("Check(Prerouting, %d packet) = false, want true", header.IPv4(pkt.NetworkHeader).TransportProtocol())
+		}
+		if pkt.NoTrack {
+			t.Errorf("%d packet was marked NoTrack", header.IPv4(pkt.NetworkHeader).TransportProtocol())
+		}
+		ct.HandlePacket(pkt)
+	}
+	if got := ct.Count(); got != 2 {
+		t.Errorf("Count() = %d, want 2", got)
+	}
+
+	// Dry runs give the same verdict without tracking anything.
+	if verdict, _ := ipt.CheckDryRun(Prerouting, PacketSpec{Protocol: header.UDPProtocolNumber, DstPort: 53}); !verdict {
+		t.Errorf("CheckDryRun(Prerouting, UDP to port 53) = false, want true")
+	}
+}
+
+// icmpErrorPacket returns a destination unreachable error about pkt, sent from
+// src to dst.
+func icmpErrorPacket(t *testing.T, pkt tcpip.PacketBuffer, src, dst tcpip.Address) tcpip.PacketBuffer {
+	t.Helper()
+	msg, ok := ICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable)
+	if !ok {
+		t.Fatalf("ICMPv4Error() = _, false, want true")
+	}
+	hdr := buffer.NewView(header.IPv4MinimumSize + len(msg))
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.ICMPv4ProtocolNumber),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	copy(hdr[header.IPv4MinimumSize:], msg)
+	return tcpip.PacketBuffer{
+		Data:          hdr[header.IPv4MinimumSize:].ToVectorisedView(),
+		NetworkHeader: hdr[:header.IPv4MinimumSize],
+	}
+}
+
+func TestConnTrackStates(t *testing.T) {
+	ct := NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	untracked := udpPacket(2000)
+	untracked.NoTrack = true
+
+	for _, step := range []struct {
+		name string
+		pkt  tcpip.PacketBuffer
+		want ConnState
+	}{
+		{name: "SYN", pkt: tcpPacket(false /* reply */, header.TCPFlagSyn), want: ConnStateNew},
+		{name: "retransmitted SYN", pkt: tcpPacket(false /* reply */, header.TCPFlagSyn), want: ConnStateNew},
+		{name: "SYN-ACK", pkt: tcpPacket(true /* reply */, header.TCPFlagSyn|header.TCPFlagAck), want: ConnStateEstablished},
+		{name: "ACK", pkt: tcpPacket(false /* reply */, header.TCPFlagAck), want: ConnStateEstablished},
+		{name: "UDP request", pkt: udpPacket(1000), want: ConnStateNew},
+		{name: "error about the UDP request", pkt: icmpErrorPacket(t, udpPacket(1000), serverAddr, clientAddr), want: ConnStateRelated},
+		{name: "error about another port", pkt: icmpErrorPacket(t, udpPacket(1001), serverAddr, clientAddr), want: ConnStateInvalid},
+		{name: "untracked", pkt: untracked, want: ConnStateUntracked},
+	} {
+		pkt := step.pkt
+		if !ct.Track(&pkt) {
+			t.Fatalf("%s: Track() = false, want true", step.name)
+		}
+		if got := ConnState(pkt.ConnState); got != step.want {
+			t.Errorf("%s: got state %#x, want %#x", step.name, got, step.want)
+		}
+	}
+
+	// Segments that don't belong to a connection are invalid.
+	ct = NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	pkt := tcpPacket(false /* reply */, header.TCPFlagAck)
+	ct.Track(&pkt)
+	if got := ConnState(pkt.ConnState); got != ConnStateInvalid {
+		t.Errorf("got state %#x for an ACK without a connection, want %#x", got, ConnStateInvalid)
+	}
+}
+
+// TestConnTrackSeed checks that replies to seeded connections are
+// established.
+func TestConnTrackSeed(t *testing.T) {
+	ct := NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	original := ConnTuple{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+	}
+	if ct.Seed(original, header.TCPFlagAck) {
+		t.Errorf("Seed(ACK) = true, want false")
+	}
+	if !ct.Seed(original, header.TCPFlagSyn) {
+		t.Fatalf("Seed(SYN) = false, want true")
+	}
+	pkt := tcpPacket(true /* reply */, header.TCPFlagSyn|header.TCPFlagAck)
+	ct.Track(&pkt)
+	if got := ConnState(pkt.ConnState); got != ConnStateEstablished {
+		t.Errorf("got state %#x for the SYN-ACK, want %#x", got, ConnStateEstablished)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// CountTarget counts the packets it acts on in a named counter of its table,
+// then lets them continue to the next rule. Rules using it are accounting
+// rules: they don't affect the verdict. Several rules may share a counter by
+// using the same name.
+type CountTarget struct {
+	// Name is the name of the counter.
+	Name string
+}
+
+// Action implements Target.Action.
+func (CountTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleContinue, ""
+}
+
+// A CounterDescription is a read-only snapshot of a named counter.
+type CounterDescription struct {
+	// Name is the name of the counter.
+	Name string
+
+	// Counters counts the packets that reached a CountTarget using the
+	// counter.
+	Counters RuleCounters
+}
+
+// newNamedCounters returns zeroed counters for each name used by a
+// CountTarget in rules.
+func newNamedCounters(rules []Rule) map[string]*RuleCounters {
+	counters := make(map[string]*RuleCounters)
+	for _, rule := range rules {
+		if target, ok := rule.Target.(CountTarget); ok {
+			counters[target.Name] = &RuleCounters{}
+		}
+	}
+	return counters
+}
+
+// countNamed records that pkt reached a CountTarget using the counter name.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (table *Table) countNamed(name string, pkt tcpip.PacketBuffer) {
+	c, ok := table.namedCounters[name]
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&c.Packets, 1)
+	atomic.AddUint64(&c.Bytes, uint64(packetLength(pkt)))
+}
+
+// describeCounters returns descriptions of the named counters of table,
+// sorted by name.
+func (table *Table) describeCounters() []CounterDescription {
+	var counters []CounterDescription
+	for name, c := range table.namedCounters {
+		counters = append(counters, CounterDescription{
+			Name: name,
+			Counters: RuleCounters{
+				Packets: atomic.LoadUint64(&c.Packets),
+				Bytes:   atomic.LoadUint64(&c.Bytes),
+			},
+		})
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Name < counters[j].Name
+	})
+	return counters
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// countTables returns tables holding only a filter table, whose INPUT chain
+// counts UDP packets in "udp", counts every packet in "all", and drops TCP
+// packets. Counters are initialized.
+func countTables() IPTables {
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: CountTarget{Name: "udp"},
+		},
+		Rule{Target: CountTarget{Name: "all"}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 3
+	filter.BuiltinChains[Output] = 3
+	filter.Underflows[Input] = 3
+	filter.Underflows[Forward] = 3
+	filter.Underflows[Output] = 3
+
+	ipt := IPTables{
+		Tables: map[string]Table{
+			TablenameFilter: filter,
+		},
+		Priorities: map[Hook][]string{
+			Input: []string{TablenameFilter},
+		},
+	}
+	ipt.InitCounters()
+	return ipt
+}
+
+func TestCountTarget(t *testing.T) {
+	ipt := countTables()
+
+	// batchPackets cycles through TCP, UDP and ICMP packets.
+	const n = 9
+	for i, pkt := range batchPackets(n) {
+		proto := header.IPv4(pkt.NetworkHeader).TransportProtocol()
+		if got, want := ipt.Check(Input, &pkt, ""), proto != header.TCPProtocolNumber; got != want {
+			t.Errorf("packet %d: Check() = %t, want %t", i, got, want)
+		}
+	}
+
+	// Dry runs aren't counted.
+	ipt.CheckDryRun(Input, PacketSpec{Protocol: header.UDPProtocolNumber})
+
+	const size = header.IPv4MinimumSize
+	want := []CounterDescription{
+		{Name: "all", Counters: RuleCounters{Packets: n, Bytes: n * size}},
+		{Name: "udp", Counters: RuleCounters{Packets: n / 3, Bytes: n / 3 * size}},
+	}
+	desc := ipt.Describe()
+	if len(desc) != 1 {
+		t.Fatalf("Describe() returned %d tables, want 1", len(desc))
+	}
+	if diff := cmp.Diff(want, desc[0].Counters); diff != "" {
+		t.Errorf("Describe() counters mismatch (-want +got):\n%s", diff)
+	}
+
+	// Accounting rules are counted like any other rule.
+	rules := desc[0].Chains[0].Rules
+	if got, want := rules[0].Counters, want[1].Counters; got != want {
+		t.Errorf("counters of rule %q = %+v, want %+v", rules[0].Text, got, want)
+	}
+	if got, want := rules[1].Text, "-A INPUT -j COUNT --counter all"; got != want {
+		t.Errorf("rule text = %q, want %q", got, want)
+	}
+}
+
+func TestRuleCounters(t *testing.T) {
+	ipt := countTables()
+	filter := ipt.Tables[TablenameFilter]
+	if got, want := len(filter.Counters()), len(filter.Rules); got != want {
+		t.Fatalf("got %d counters, want one per rule (%d)", got, want)
+	}
+
+	// Counters accumulate across calls to Check. Every packet is
+	// header.IPv4MinimumSize bytes long.
+	const rounds = 3
+	for i := 0; i < rounds; i++ {
+		for _, pkt := range batchPackets(3) {
+			ipt.Check(Input, &pkt, "")
+		}
+		size := uint64(header.IPv4MinimumSize)
+		n := uint64(i + 1)
+		want := []RuleCounters{
+			{Packets: n, Bytes: n * size},
+			{Packets: 3 * n, Bytes: 3 * n * size},
+			{Packets: n, Bytes: n * size},
+			// The UDP and ICMP packets reach the policy, which isn't
+			// counted as a rule.
+			{},
+			{},
+		}
+		if diff := cmp.Diff(want, filter.Counters()); diff != "" {
+			t.Fatalf("counters after %d rounds mismatch (-want +got):\n%s", n, diff)
+		}
+	}
+
+	// Snapshots aren't affected by later packets.
+	snapshot := filter.Counters()
+	pkt := ipv4Packet(header.TCPProtocolNumber)
+	ipt.Check(Input, &pkt, "")
+	if got, want := snapshot[1].Packets, uint64(3*rounds); got != want {
+		t.Errorf("snapshot changed to %d packets, want %d", got, want)
+	}
+
+	filter.ZeroRuleCounters()
+	if diff := cmp.Diff(make([]RuleCounters, len(filter.Rules)), filter.Counters()); diff != "" {
+		t.Errorf("counters after ZeroRuleCounters mismatch (-want +got):\n%s", diff)
+	}
+}
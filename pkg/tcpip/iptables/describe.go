@@ -0,0 +1,454 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// A TableDescription is a read-only snapshot of a table, as returned by
+// IPTables.Describe.
+type TableDescription struct {
+	// Name is the name of the table.
+	Name string
+
+	// Chains holds the table's built-in chains in hook order, followed by
+	// its user chains in the order they appear in the table.
+	Chains []ChainDescription
+
+	// Counters holds the table's named counters, used by CountTargets,
+	// sorted by name.
+	Counters []CounterDescription
+}
+
+// A ChainDescription is a read-only snapshot of a chain.
+type ChainDescription struct {
+	// Name is the name of the chain.
+	Name string
+
+	// Builtin is true if the chain is a built-in chain.
+	Builtin bool
+
+	// Policy is the name of the target taken when a packet reaches the end
+	// of a built-in chain. It is "-" for user chains, as in iptables-save.
+	Policy string
+
+	// PolicyCounters counts the packets that reached the end of a built-in
+	// chain, or returned from it. Packets that are given a verdict by one of
+	// the chain's rules aren't counted.
+	PolicyCounters RuleCounters
+
+	// Priority is the priority at which the table of a built-in chain is
+	// visited for the chain's hook. Tables with lower priorities are
+	// visited first. It is 0 for user chains and tables without a priority.
+	Priority int
+
+	// Position is the index of the table of a built-in chain in the order
+	// the tables are visited for the chain's hook, or -1 if the chain isn't
+	// visited. It is -1 for user chains.
+	Position int
+
+	// Rules holds the chain's rules, in order. The policy isn't included.
+	Rules []RuleDescription
+}
+
+// A RuleDescription is a read-only snapshot of a rule.
+type RuleDescription struct {
+	// Index is the index of the rule in its table's Rules.
+	Index int
+
+	// Text is the rule in the format of iptables-save, e.g.
+	// "-A INPUT -p udp -m udp --dport 53 -j DROP".
+	Text string
+
+	// Source and Destination are the source and destination addresses
+	// matched by the rule's filter in the format of iptables-save, e.g.
+	// "10.0.0.0/8", or empty if the rule matches any address. They are
+	// preceded by "!" if the match is inverted.
+	Source      string
+	Destination string
+
+	// InputInterface and OutputInterface are the interfaces matched by the
+	// rule's filter, e.g. "eth+", or empty if the rule matches any
+	// interface. They are preceded by "!" if the match is inverted.
+	InputInterface  string
+	OutputInterface string
+
+	// Protocol is the transport protocol matched by the rule's filter, or
+	// 0 if the rule matches any protocol.
+	Protocol tcpip.TransportProtocolNumber
+
+	// Matchers describes the rule's matchers, in order.
+	Matchers []MatcherDescription
+
+	// Target describes the rule's target.
+	Target TargetDescription
+
+	// Counters counts the packets that matched the rule.
+	Counters RuleCounters
+}
+
+// A MatcherDescription describes a Matcher. Matchers that implement
+// fmt.Stringer are described by String, which should return their options in
+// the format of iptables-save, e.g. "--dport 53".
+type MatcherDescription struct {
+	// Name is the name of the matcher.
+	Name string
+
+	// Options holds the matcher's options, if any.
+	Options string
+}
+
+// A TargetDescription describes a Target.
+type TargetDescription struct {
+	// Name is the name of the target, e.g. "ACCEPT".
+	Name string
+
+	// Options holds the target's options in the format of iptables-save,
+	// e.g. "--reject-with tcp-reset", if any.
+	Options string
+}
+
+// Describe returns a read-only snapshot of the tables in it, sorted by name.
+// It doesn't modify it and is cheap enough to be called periodically, e.g. to
+// export counters.
+//
+// The snapshot is consistent with the tables in it. To describe a stack's
+// tables, call Describe on the value returned by Stack.IPTables.
+func (it *IPTables) Describe() []TableDescription {
+	names := make([]string, 0, len(it.Tables))
+	for name := range it.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tables := make([]TableDescription, 0, len(names))
+	for _, name := range names {
+		table := it.Tables[name]
+		tables = append(tables, TableDescription{
+			Name:     name,
+			Chains:   table.describeChains(it, name),
+			Counters: table.describeCounters(),
+		})
+	}
+	return tables
+}
+
+// Save returns the tables in it in the format of iptables-save -c, i.e. with
+// counters.
+func (it *IPTables) Save() string {
+	var b strings.Builder
+	for _, table := range it.Describe() {
+		fmt.Fprintf(&b, "*%s\n", table.Name)
+		for _, chain := range table.Chains {
+			fmt.Fprintf(&b, ":%s %s [%d:%d]\n", chain.Name, chain.Policy, chain.PolicyCounters.Packets, chain.PolicyCounters.Bytes)
+		}
+		for _, chain := range table.Chains {
+			for _, rule := range chain.Rules {
+				fmt.Fprintf(&b, "[%d:%d] %s\n", rule.Counters.Packets, rule.Counters.Bytes, rule.Text)
+			}
+		}
+		b.WriteString("COMMIT\n")
+	}
+	return b.String()
+}
+
+// describeChains returns descriptions of the chains in table, named tablename
+// in it.
+func (table *Table) describeChains(it *IPTables, tablename string) []ChainDescription {
+	var chains []ChainDescription
+	for hook := Hook(0); hook < NumHooks; hook++ {
+		start, ok := table.BuiltinChains[hook]
+		if !ok || start == HookUnset {
+			continue
+		}
+		underflow, ok := table.Underflows[hook]
+		if !ok || underflow < start || underflow >= len(table.Rules) {
+			continue
+		}
+		name := hookChainName(hook)
+		policy, _ := describeTarget(table.Rules[underflow].Target)
+		priority, _ := it.priority(hook, tablename)
+		position := -1
+		for i, visited := range it.Priorities[hook] {
+			if visited == tablename {
+				position = i
+				break
+			}
+		}
+		chains = append(chains, ChainDescription{
+			Name:           name,
+			Builtin:        true,
+			Policy:         policy,
+			PolicyCounters: table.PolicyCounter(hook),
+			Priority:       priority,
+			Position:       position,
+			Rules:          table.describeRules(name, start, underflow),
+		})
+	}
+
+	// User chains are listed in the order they appear in the table.
+	userChains := make([]string, 0, len(table.UserChains))
+	for name := range table.UserChains {
+		userChains = append(userChains, name)
+	}
+	sort.Slice(userChains, func(i, j int) bool {
+		return table.UserChains[userChains[i]] < table.UserChains[userChains[j]]
+	})
+	for _, name := range userChains {
+		start := table.UserChains[name]
+		end := start
+		for end < len(table.Rules) && !isChainBoundary(table.Rules[end]) {
+			end++
+		}
+		// The chain's final unconditional RETURN is its implicit policy.
+		if end > start && isUnconditionalReturn(table.Rules[end-1]) {
+			end--
+		}
+		chains = append(chains, ChainDescription{
+			Name:     name,
+			Policy:   "-",
+			Position: -1,
+			Rules:    table.describeRules(name, start, end),
+		})
+	}
+	return chains
+}
+
+// describeRules returns descriptions of the rules in table with indices in
+// [start, end), which belong to chain.
+func (table *Table) describeRules(chain string, start, end int) []RuleDescription {
+	var rules []RuleDescription
+	for i := start; i < end; i++ {
+		rule := table.Rules[i]
+		desc := RuleDescription{
+			Index:       i,
+			Source:      describeAddress(rule.Filter.Src, rule.Filter.SrcMask, rule.Filter.SrcInvert),
+			Destination: describeAddress(rule.Filter.Dst, rule.Filter.DstMask, rule.Filter.DstInvert),
+			Protocol:    rule.Filter.Protocol,
+			Counters:    table.RuleCounter(i),
+		}
+		desc.InputInterface = describeInterface(rule.Filter.InputInterface, rule.Filter.InputInterfaceInvert)
+		desc.OutputInterface = describeInterface(rule.Filter.OutputInterface, rule.Filter.OutputInterfaceInvert)
+		for _, matcher := range rule.Matchers {
+			md := MatcherDescription{Name: matcher.Name()}
+			if s, ok := matcher.(fmt.Stringer); ok {
+				md.Options = s.String()
+			}
+			desc.Matchers = append(desc.Matchers, md)
+		}
+		desc.Target.Name, desc.Target.Options = describeTarget(rule.Target)
+		if jt, ok := rule.Target.(JumpTarget); ok {
+			desc.Target.Name = table.jumpTargetName(jt)
+		}
+		desc.Text = desc.text(chain)
+		rules = append(rules, desc)
+	}
+	return rules
+}
+
+// text returns the rule in the format of iptables-save.
+func (rd *RuleDescription) text(chain string) string {
+	parts := []string{"-A", chain}
+	for _, field := range []struct {
+		flag string
+		desc string
+	}{
+		{"-s", rd.Source},
+		{"-d", rd.Destination},
+		{"-i", rd.InputInterface},
+		{"-o", rd.OutputInterface},
+	} {
+		if strings.HasPrefix(field.desc, "!") {
+			parts = append(parts, "!", field.flag, field.desc[1:])
+		} else if field.desc != "" {
+			parts = append(parts, field.flag, field.desc)
+		}
+	}
+	if rd.Protocol != 0 {
+		parts = append(parts, "-p", protocolName(rd.Protocol))
+	}
+	for _, md := range rd.Matchers {
+		parts = append(parts, "-m", md.Name)
+		if md.Options != "" {
+			parts = append(parts, md.Options)
+		}
+	}
+	parts = append(parts, "-j", rd.Target.Name)
+	if rd.Target.Options != "" {
+		parts = append(parts, rd.Target.Options)
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeAddress returns the description of a filter address, as used by
+// RuleDescription.Source and RuleDescription.Destination. Masks that aren't
+// a prefix are described in full, like iptables-save does.
+func describeAddress(addr, mask tcpip.Address, invert bool) string {
+	if addr == "" && mask == "" {
+		if invert {
+			return "!0.0.0.0/0"
+		}
+		return ""
+	}
+	masked := []byte(addr)
+	for i := range masked {
+		if i < len(mask) {
+			masked[i] &= mask[i]
+		} else {
+			masked[i] = 0
+		}
+	}
+	desc := fmt.Sprintf("%s/%s", tcpip.Address(masked), mask)
+	if prefix := tcpip.AddressMask(mask).Prefix(); len(mask) == len(addr) && isPrefixMask(mask, prefix) {
+		desc = fmt.Sprintf("%s/%d", tcpip.Address(masked), prefix)
+	}
+	if invert {
+		return "!" + desc
+	}
+	return desc
+}
+
+// describeInterface returns the description of a filter interface, as used by
+// RuleDescription.InputInterface and RuleDescription.OutputInterface.
+func describeInterface(name string, invert bool) string {
+	if name == "" {
+		return ""
+	}
+	if invert {
+		return "!" + name
+	}
+	return name
+}
+
+// isPrefixMask returns whether the first prefix bits of mask are set, and the
+// others are not.
+func isPrefixMask(mask tcpip.Address, prefix int) bool {
+	for i := 0; i < len(mask); i++ {
+		var want byte
+		switch bits := prefix - 8*i; {
+		case bits >= 8:
+			want = 0xff
+		case bits > 0:
+			want = ^byte(0xff >> uint(bits))
+		}
+		if mask[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTarget returns the name and options of target.
+func describeTarget(target Target) (string, string) {
+	switch t := target.(type) {
+	case AcceptTarget:
+		return "ACCEPT", ""
+	case DropTarget:
+		return "DROP", ""
+	case ErrorTarget:
+		return "ERROR", ""
+	case ReturnTarget:
+		return "RETURN", ""
+	case RejectTarget:
+		return "REJECT", "--reject-with " + t.With.String()
+	case UserChainTarget:
+		return t.Name, ""
+	case CountTarget:
+		return "COUNT", "--counter " + t.Name
+	case LogTarget:
+		opts := fmt.Sprintf("--log-level %d", t.Level)
+		if t.Prefix != "" {
+			opts = fmt.Sprintf("--log-prefix %q %s", t.Prefix, opts)
+		}
+		return "LOG", opts
+	case ChecksumFillTarget:
+		return "CHECKSUM", "--checksum-fill"
+	case ECNTarget:
+		if t.RemoveTCP {
+			return "ECN", "--ecn-tcp-remove"
+		}
+		return "ECN", ""
+	case CTTarget:
+		if t.NoTrack {
+			return "CT", "--notrack"
+		}
+		return "CT", ""
+	case DNATTarget:
+		dst := ""
+		if t.Addr != "" {
+			dst = t.Addr.String()
+		}
+		if t.Port != 0 {
+			dst += fmt.Sprintf(":%d", t.Port)
+		}
+		return "DNAT", "--to-destination " + dst
+	case RedirectTarget:
+		if t.Port != 0 {
+			return "REDIRECT", fmt.Sprintf("--to-ports %d", t.Port)
+		}
+		return "REDIRECT", ""
+	default:
+		return fmt.Sprintf("%T", target), ""
+	}
+}
+
+// jumpTargetName returns the name of the user chain jt jumps to. Jumps into
+// the middle of a chain, which iptables-save can't express, are named after
+// the index of the rule they jump to.
+func (table *Table) jumpTargetName(jt JumpTarget) string {
+	for name, ruleIdx := range table.UserChains {
+		if ruleIdx == jt.RuleNum {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", jt.RuleNum)
+}
+
+// isChainBoundary returns whether rule marks the start of a user chain or the
+// end of the table.
+func isChainBoundary(rule Rule) bool {
+	switch rule.Target.(type) {
+	case UserChainTarget, ErrorTarget:
+		return true
+	default:
+		return false
+	}
+}
+
+// isUnconditionalReturn returns whether rule returns every packet.
+func isUnconditionalReturn(rule Rule) bool {
+	_, ok := rule.Target.(ReturnTarget)
+	return ok && rule.Filter == IPHeaderFilter{} && len(rule.Matchers) == 0
+}
+
+// protocolName returns the name iptables uses for protocol.
+func protocolName(protocol tcpip.TransportProtocolNumber) string {
+	switch protocol {
+	case header.TCPProtocolNumber:
+		return "tcp"
+	case header.UDPProtocolNumber:
+		return "udp"
+	case header.ICMPv4ProtocolNumber:
+		return "icmp"
+	default:
+		return fmt.Sprintf("%d", protocol)
+	}
+}
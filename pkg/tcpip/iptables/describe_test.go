@@ -0,0 +1,326 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// optionsMatcher is a Matcher that matches every packet and is described by
+// fixed options.
+type optionsMatcher struct {
+	options string
+}
+
+// Name implements Matcher.Name.
+func (*optionsMatcher) Name() string {
+	return "udp"
+}
+
+// String implements fmt.Stringer.String.
+func (m *optionsMatcher) String() string {
+	return m.options
+}
+
+// Match implements Matcher.Match.
+func (*optionsMatcher) Match(Hook, tcpip.PacketBuffer, string) (bool, bool) {
+	return true, false
+}
+
+// describeTables returns tables holding only a filter table, whose INPUT
+// chain drops UDP packets to port 53 and rejects TCP packets, and whose user
+// chain "icmp" drops ICMP packets. Counters are initialized.
+func describeTables() IPTables {
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{
+			Filter:   IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Matchers: []Matcher{&optionsMatcher{options: "--dport 53"}},
+			Target:   DropTarget{},
+		},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: RejectTarget{With: RejectWithTCPReset},
+		},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: UserChainTarget{Name: "icmp"}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.ICMPv4ProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: ReturnTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 2
+	filter.BuiltinChains[Output] = 2
+	filter.Underflows[Input] = 2
+	filter.Underflows[Forward] = 2
+	filter.Underflows[Output] = 2
+	filter.UserChains["icmp"] = 4
+
+	ipt := IPTables{
+		Tables: map[string]Table{
+			TablenameFilter: filter,
+		},
+		Priorities: map[Hook][]string{
+			Input: []string{TablenameFilter},
+		},
+	}
+	ipt.InitCounters()
+	return ipt
+}
+
+func TestDescribe(t *testing.T) {
+	ipt := describeTables()
+	for _, proto := range []tcpip.TransportProtocolNumber{
+		header.UDPProtocolNumber,
+		header.UDPProtocolNumber,
+		header.TCPProtocolNumber,
+		header.ICMPv4ProtocolNumber,
+		header.ICMPv4ProtocolNumber,
+		header.ICMPv4ProtocolNumber,
+	} {
+		pkt := ipv4Packet(proto)
+		ipt.Check(Input, &pkt, "")
+	}
+
+	// Dry runs aren't counted.
+	ipt.CheckDryRun(Input, PacketSpec{Protocol: header.UDPProtocolNumber})
+
+	const size = header.IPv4MinimumSize
+	accept := ChainDescription{
+		Builtin:  true,
+		Policy:   "ACCEPT",
+		Position: -1,
+	}
+	input, forward, output := accept, accept, accept
+	input.Name = ChainNameInput
+	// Only INPUT is visited.
+	input.Position = 0
+	forward.Name = ChainNameForward
+	output.Name = ChainNameOutput
+	// The chains share their underflow rule, but only INPUT's policy was
+	// reached.
+	input.PolicyCounters = RuleCounters{Packets: 3, Bytes: 3 * size}
+	input.Rules = []RuleDescription{
+		{
+			Index:    0,
+			Text:     "-A INPUT -p udp -m udp --dport 53 -j DROP",
+			Protocol: header.UDPProtocolNumber,
+			Matchers: []MatcherDescription{{Name: "udp", Options: "--dport 53"}},
+			Target:   TargetDescription{Name: "DROP"},
+			Counters: RuleCounters{Packets: 2, Bytes: 2 * size},
+		},
+		{
+			Index:    1,
+			Text:     "-A INPUT -p tcp -j REJECT --reject-with tcp-reset",
+			Protocol: header.TCPProtocolNumber,
+			Target:   TargetDescription{Name: "REJECT", Options: "--reject-with tcp-reset"},
+			Counters: RuleCounters{Packets: 1, Bytes: size},
+		},
+	}
+	want := []TableDescription{
+		{
+			Name: TablenameFilter,
+			Chains: []ChainDescription{
+				input,
+				forward,
+				output,
+				{
+					Name:     "icmp",
+					Policy:   "-",
+					Position: -1,
+					Rules: []RuleDescription{
+						{
+							Index:    4,
+							Text:     "-A icmp -p icmp -j DROP",
+							Protocol: header.ICMPv4ProtocolNumber,
+							Target:   TargetDescription{Name: "DROP"},
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, ipt.Describe()); diff != "" {
+		t.Errorf("Describe() mismatch (-want +got):\n%s", diff)
+	}
+
+	wantSave := "*filter\n" +
+		":INPUT ACCEPT [3:60]\n" +
+		":FORWARD ACCEPT [0:0]\n" +
+		":OUTPUT ACCEPT [0:0]\n" +
+		":icmp - [0:0]\n" +
+		"[2:40] -A INPUT -p udp -m udp --dport 53 -j DROP\n" +
+		"[1:20] -A INPUT -p tcp -j REJECT --reject-with tcp-reset\n" +
+		"[0:0] -A icmp -p icmp -j DROP\n" +
+		"COMMIT\n"
+	if got := ipt.Save(); got != wantSave {
+		t.Errorf("Save() = %q, want %q", got, wantSave)
+	}
+}
+
+func TestDescribeCountersMonotonic(t *testing.T) {
+	ipt := describeTables()
+
+	// counters returns the counters of every rule and policy in desc, in
+	// order.
+	counters := func(desc []TableDescription) []RuleCounters {
+		var cs []RuleCounters
+		for _, table := range desc {
+			for _, chain := range table.Chains {
+				cs = append(cs, chain.PolicyCounters)
+				for _, rule := range chain.Rules {
+					cs = append(cs, rule.Counters)
+				}
+			}
+		}
+		return cs
+	}
+
+	prev := counters(ipt.Describe())
+	for i := 0; i < 3; i++ {
+		for _, pkt := range batchPackets(10) {
+			ipt.Check(Input, &pkt, "")
+		}
+		cur := counters(ipt.Describe())
+		if len(cur) != len(prev) {
+			t.Fatalf("snapshot %d has %d counters, want %d", i, len(cur), len(prev))
+		}
+		var grew bool
+		for j := range cur {
+			if cur[j].Packets < prev[j].Packets || cur[j].Bytes < prev[j].Bytes {
+				t.Errorf("snapshot %d: counter %d decreased from %+v to %+v", i, j, prev[j], cur[j])
+			}
+			if cur[j].Packets > prev[j].Packets {
+				grew = true
+			}
+		}
+		if !grew {
+			t.Errorf("snapshot %d: no counter grew after checking packets", i)
+		}
+		prev = cur
+	}
+
+	// Initializing counters again, as Stack.SetIPTables does when any
+	// table is replaced, keeps existing counters.
+	ipt.InitCounters()
+	if got := counters(ipt.Describe()); !cmp.Equal(got, prev) {
+		t.Errorf("counters after InitCounters() = %+v, want %+v", got, prev)
+	}
+}
+
+func TestPolicyCounters(t *testing.T) {
+	ipt := describeTables()
+	check := func(proto tcpip.TransportProtocolNumber) {
+		t.Helper()
+		pkt := ipv4Packet(proto)
+		ipt.Check(Input, &pkt, "")
+	}
+	// counters returns the counters of INPUT's policy and of its first
+	// rule.
+	counters := func() (policy, rule uint64) {
+		t.Helper()
+		input := ipt.Describe()[0].Chains[0]
+		if input.Name != ChainNameInput {
+			t.Fatalf("got chain %s, want %s", input.Name, ChainNameInput)
+		}
+		return input.PolicyCounters.Packets, input.Rules[0].Counters.Packets
+	}
+
+	// ICMP packets match no rule of INPUT, so only its policy counts them.
+	check(header.ICMPv4ProtocolNumber)
+	check(header.ICMPv4ProtocolNumber)
+	for _, chain := range ipt.Describe()[0].Chains {
+		for _, rule := range chain.Rules {
+			if rule.Counters.Packets != 0 {
+				t.Errorf("rule %q counted %d packets, want 0", rule.Text, rule.Counters.Packets)
+			}
+		}
+	}
+	check(header.UDPProtocolNumber)
+	if policy, rule := counters(); policy != 2 || rule != 1 {
+		t.Errorf("got policy and rule counters %d and %d, want 2 and 1", policy, rule)
+	}
+
+	// Policy and rule counters are zeroed independently.
+	filter := ipt.Tables[TablenameFilter]
+	filter.ZeroRuleCounters()
+	if policy, rule := counters(); policy != 2 || rule != 0 {
+		t.Errorf("got policy and rule counters %d and %d after zeroing rule counters, want 2 and 0", policy, rule)
+	}
+	check(header.UDPProtocolNumber)
+	filter.ZeroPolicyCounters()
+	if policy, rule := counters(); policy != 0 || rule != 1 {
+		t.Errorf("got policy and rule counters %d and %d after zeroing policy counters, want 0 and 1", policy, rule)
+	}
+}
+
+func TestDescribeFilters(t *testing.T) {
+	for _, tc := range []struct {
+		filter IPHeaderFilter
+		want   string
+	}{
+		{
+			filter: IPHeaderFilter{Src: "\x0a\x01\x02\x03", SrcMask: "\xff\x00\x00\x00"},
+			want:   "-A INPUT -s 10.0.0.0/8 -m udp --dport 53 -j DROP",
+		},
+		{
+			filter: IPHeaderFilter{Dst: "\xc0\xa8\x01\x01", DstMask: "\xff\xff\xff\xff", DstInvert: true, Protocol: header.UDPProtocolNumber},
+			want:   "-A INPUT ! -d 192.168.1.1/32 -p udp -m udp --dport 53 -j DROP",
+		},
+		{
+			filter: IPHeaderFilter{Src: "\x0a\x00\x00\x01", SrcMask: "\xff\x00\xff\xff", Dst: "\x0a\x00\x00\x02", DstMask: "\xff\xff\xff\x00"},
+			want:   "-A INPUT -s 10.0.0.1/255.0.255.255 -d 10.0.0.0/24 -m udp --dport 53 -j DROP",
+		},
+		{
+			filter: IPHeaderFilter{Src: "\x0a\x00\x00\x00", SrcMask: "\xff\x00\x00\x00", InputInterface: "eth+", Protocol: header.UDPProtocolNumber},
+			want:   "-A INPUT -s 10.0.0.0/8 -i eth+ -p udp -m udp --dport 53 -j DROP",
+		},
+		{
+			filter: IPHeaderFilter{InputInterface: "lo", InputInterfaceInvert: true, OutputInterface: "eth0"},
+			want:   "-A INPUT ! -i lo -o eth0 -m udp --dport 53 -j DROP",
+		},
+	} {
+		ipt := describeTables()
+		filter := ipt.Tables[TablenameFilter]
+		filter.Rules[0].Filter = tc.filter
+		if got := ipt.Describe()[0].Chains[0].Rules[0].Text; got != tc.want {
+			t.Errorf("rule with filter %+v described as %q, want %q", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestDescribeMangleTargets(t *testing.T) {
+	for _, tc := range []struct {
+		target   Target
+		wantName string
+		wantOpts string
+	}{
+		{ChecksumFillTarget{}, "CHECKSUM", "--checksum-fill"},
+		{ECNTarget{RemoveTCP: true}, "ECN", "--ecn-tcp-remove"},
+		{ECNTarget{}, "ECN", ""},
+	} {
+		name, opts := describeTarget(tc.target)
+		if name != tc.wantName || opts != tc.wantOpts {
+			t.Errorf("describeTarget(%+v) = %q, %q, want %q, %q", tc.target, name, opts, tc.wantName, tc.wantOpts)
+		}
+	}
+}
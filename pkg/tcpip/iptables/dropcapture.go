@@ -0,0 +1,208 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+)
+
+const (
+	// DefaultDropCaptureSnapLen is the default number of bytes captured from
+	// each dropped packet. It covers the IPv4 and transport headers of most
+	// packets, like tcpdump's historical default.
+	DefaultDropCaptureSnapLen = 96
+
+	// DefaultDropCaptureBytesPerSecond is the default budget of a
+	// DropCapture, in bytes per second.
+	DefaultDropCaptureBytesPerSecond = 64 << 10
+
+	// dropCaptureOverhead is the number of bytes each capture is charged on
+	// top of the bytes it copies, approximating the memory used by its
+	// DroppedPacket. It keeps a small snap length from allowing an unbounded
+	// number of captures.
+	dropCaptureOverhead = 64
+)
+
+// DroppedPacket describes a packet dropped by a rule, as passed to the
+// callback of a DropCapture.
+type DroppedPacket struct {
+	// Hook is the hook the packet was dropped at.
+	Hook Hook
+
+	// Table is the name of the table containing the rule.
+	Table string
+
+	// RuleIdx is the index of the rule in the table's Rules, or -1 if the
+	// packet was dropped because it reached the end of the table.
+	RuleIdx int
+
+	// Data holds the first bytes of the packet, starting at its network
+	// header, up to the snap length of the DropCapture. It is a copy owned
+	// by the callback.
+	Data []byte
+
+	// Length is the length of the whole packet, which may exceed len(Data).
+	Length int
+}
+
+// DropCaptureStats holds the counters of a DropCapture.
+type DropCaptureStats struct {
+	// Captured is the number of dropped packets passed to the callback.
+	Captured tcpip.StatCounter
+
+	// Suppressed is the number of dropped packets that weren't captured
+	// because the budget was exhausted.
+	Suppressed tcpip.StatCounter
+}
+
+// DropCapture copies packets dropped by DROP and REJECT rules and passes them
+// to a callback, e.g. to write them to a pcap file. It is enabled by setting
+// IPTables.DropCapture.
+//
+// Captures are budgeted with a token bucket that gains bytesPerSecond bytes
+// each second and holds at most a second's worth, so that a flood of dropped
+// packets can't be amplified into memory pressure. Each capture is charged
+// the bytes it copies plus dropCaptureOverhead.
+type DropCapture struct {
+	clock tcpip.Clock
+
+	// snapLen is the maximum number of bytes copied from each packet. It is
+	// immutable.
+	snapLen int
+
+	// callback is called with each captured packet. It is immutable.
+	callback func(DroppedPacket)
+
+	// stats is accessed atomically.
+	stats DropCaptureStats
+
+	mu sync.Mutex
+
+	// bytesPerSecond is the rate at which the budget is refilled. If it is
+	// 0, captures aren't budgeted. It is protected by mu.
+	bytesPerSecond int64
+
+	// tokens is the budget left, in bytes multiplied by time.Second, so that
+	// it can be refilled without rounding. It is protected by mu.
+	tokens int64
+
+	// last is the monotonic time tokens was last updated at. It is
+	// protected by mu.
+	last int64
+}
+
+// NewDropCapture returns a DropCapture that copies up to snapLen bytes of each
+// dropped packet and passes them to callback, with a budget of
+// bytesPerSecond. The budget starts full.
+//
+// callback is called synchronously by IPTables.Check while the packet is
+// being processed, so it must not block; it should hand the packet off to be
+// written elsewhere. No table locks are held while it is called.
+func NewDropCapture(clock tcpip.Clock, snapLen int, bytesPerSecond int64, callback func(DroppedPacket)) *DropCapture {
+	return &DropCapture{
+		clock:          clock,
+		snapLen:        snapLen,
+		callback:       callback,
+		bytesPerSecond: bytesPerSecond,
+		tokens:         bytesPerSecond * int64(time.Second),
+		last:           clock.NowMonotonic(),
+	}
+}
+
+// Stats returns the counters of dc.
+func (dc *DropCapture) Stats() *DropCaptureStats {
+	return &dc.stats
+}
+
+// SetBytesPerSecond sets the budget of dc. A budget of 0 disables budgeting.
+func (dc *DropCapture) SetBytesPerSecond(bytesPerSecond int64) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.bytesPerSecond = bytesPerSecond
+	if max := bytesPerSecond * int64(time.Second); dc.tokens > max {
+		dc.tokens = max
+	}
+}
+
+// capture passes a copy of pkt, dropped by rule ruleIdx of table tablename at
+// hook, to dc's callback if the budget allows it.
+//
+// The packet's bytes are the outbound headers in pkt.Header followed by
+// pkt.Data, which holds the whole packet for inbound packets.
+func (dc *DropCapture) capture(hook Hook, tablename string, ruleIdx int, pkt *tcpip.PacketBuffer) {
+	length := pkt.Header.UsedLength() + pkt.Data.Size()
+	snapLen := length
+	if snapLen > dc.snapLen {
+		snapLen = dc.snapLen
+	}
+	if !dc.allow(snapLen + dropCaptureOverhead) {
+		dc.stats.Suppressed.Increment()
+		return
+	}
+
+	// Only the bytes that fit in the snap length are copied.
+	data := make([]byte, 0, snapLen)
+	views := append([]buffer.View{pkt.Header.View()}, pkt.Data.Views()...)
+	for _, v := range views {
+		if left := snapLen - len(data); len(v) > left {
+			v = v[:left]
+		}
+		data = append(data, v...)
+	}
+
+	dc.stats.Captured.Increment()
+	dc.callback(DroppedPacket{
+		Hook:    hook,
+		Table:   tablename,
+		RuleIdx: ruleIdx,
+		Data:    data,
+		Length:  length,
+	})
+}
+
+// allow returns true if size bytes may be captured now, consuming them from
+// the budget if so.
+func (dc *DropCapture) allow(size int) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.bytesPerSecond <= 0 {
+		return true
+	}
+
+	// The bucket holds at most a second's worth of tokens, so longer
+	// intervals are clamped to avoid overflowing.
+	now := dc.clock.NowMonotonic()
+	elapsed := now - dc.last
+	if elapsed > int64(time.Second) {
+		elapsed = int64(time.Second)
+	}
+	dc.last = now
+	maxTokens := dc.bytesPerSecond * int64(time.Second)
+	dc.tokens += elapsed * dc.bytesPerSecond
+	if dc.tokens > maxTokens {
+		dc.tokens = maxTokens
+	}
+
+	cost := int64(size) * int64(time.Second)
+	if dc.tokens < cost {
+		return false
+	}
+	dc.tokens -= cost
+	return true
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// capturingTables returns dropUDPTables with a DropCapture that appends
+// captured packets to the returned slice.
+func capturingTables(clock tcpip.Clock, snapLen int, bytesPerSecond int64) (IPTables, *[]DroppedPacket) {
+	var captured []DroppedPacket
+	ipt := dropUDPTables()
+	ipt.InitCounters()
+	ipt.DropCapture = NewDropCapture(clock, snapLen, bytesPerSecond, func(pkt DroppedPacket) {
+		captured = append(captured, pkt)
+	})
+	return ipt, &captured
+}
+
+// udpPayloadPacket returns an inbound UDP packet carrying payloadLen bytes of
+// data, with its bytes split across several views.
+func udpPayloadPacket(payloadLen int) (tcpip.PacketBuffer, []byte) {
+	pkt := PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  53,
+	}.packet()
+	hdr := pkt.Data.ToView()
+	payload := buffer.View(bytes.Repeat([]byte{0xaa}, payloadLen))
+	header.IPv4(hdr).SetTotalLength(uint16(len(hdr) + payloadLen))
+	pkt.Data = buffer.NewVectorisedView(len(hdr)+payloadLen, []buffer.View{hdr, payload})
+	return pkt, append(append([]byte(nil), hdr...), payload...)
+}
+
+func TestDropCapture(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		snapLen int
+	}{
+		{name: "whole packet", snapLen: 1500},
+		{name: "truncated in header", snapLen: 24},
+		{name: "truncated in payload", snapLen: 40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := faketime.NewManualClock(time.Unix(0, 0))
+			ipt, captured := capturingTables(clock, tc.snapLen, DefaultDropCaptureBytesPerSecond)
+			pkt, want := udpPayloadPacket(100)
+			if ipt.Check(Input, &pkt, "") {
+				t.Fatalf("Check(Input) = true, want false")
+			}
+
+			wantData := want
+			if len(wantData) > tc.snapLen {
+				wantData = wantData[:tc.snapLen]
+			}
+			wantCaptured := []DroppedPacket{{
+				Hook:    Input,
+				Table:   TablenameFilter,
+				RuleIdx: 0,
+				Data:    wantData,
+				Length:  len(want),
+			}}
+			if diff := cmp.Diff(wantCaptured, *captured); diff != "" {
+				t.Errorf("captured packets mismatch (-want +got):\n%s", diff)
+			}
+			if got := ipt.DropCapture.Stats().Captured.Value(); got != 1 {
+				t.Errorf("got Captured = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestDropCaptureOutbound(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ipt, captured := capturingTables(clock, DefaultDropCaptureSnapLen, DefaultDropCaptureBytesPerSecond)
+	filter := ipt.Tables[TablenameFilter]
+	filter.BuiltinChains[Output] = 0
+	ipt.Tables[TablenameFilter] = filter
+
+	// Outbound packets carry their headers in Header and their payload in
+	// Data.
+	pkt, want := udpPayloadPacket(10)
+	hdrLen := header.IPv4MinimumSize + header.UDPMinimumSize
+	pkt.Header = buffer.NewPrependable(hdrLen)
+	copy(pkt.Header.Prepend(hdrLen), want[:hdrLen])
+	pkt.NetworkHeader = buffer.View(pkt.Header.View()[:header.IPv4MinimumSize])
+	pkt.TransportHeader = buffer.View(pkt.Header.View()[header.IPv4MinimumSize:])
+	pkt.Data = buffer.View(want[hdrLen:]).ToVectorisedView()
+	if ipt.Check(Output, &pkt, "") {
+		t.Fatalf("Check(Output) = true, want false")
+	}
+
+	if len(*captured) != 1 {
+		t.Fatalf("got %d captured packets, want 1", len(*captured))
+	}
+	got := (*captured)[0]
+	if got.Hook != Output || got.RuleIdx != 0 {
+		t.Errorf("got hook %d and rule %d, want hook %d and rule 0", got.Hook, got.RuleIdx, Output)
+	}
+	if !bytes.Equal(got.Data, want) {
+		t.Errorf("got data %x, want %x", got.Data, want)
+	}
+}
+
+func TestDropCaptureIgnoresAcceptedPackets(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ipt, captured := capturingTables(clock, DefaultDropCaptureSnapLen, DefaultDropCaptureBytesPerSecond)
+	pkt := ipv4Packet(header.TCPProtocolNumber)
+	if !ipt.Check(Input, &pkt, "") {
+		t.Fatalf("Check(Input) = false, want true")
+	}
+	if len(*captured) != 0 {
+		t.Errorf("got captured packets %+v, want none", *captured)
+	}
+}
+
+func TestDropCaptureDryRun(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ipt, captured := capturingTables(clock, DefaultDropCaptureSnapLen, DefaultDropCaptureBytesPerSecond)
+	if ok, _ := ipt.CheckDryRun(Input, PacketSpec{Protocol: header.UDPProtocolNumber}); ok {
+		t.Fatalf("CheckDryRun(Input) = true, want false")
+	}
+	if len(*captured) != 0 {
+		t.Errorf("dry run captured packets %+v, want none", *captured)
+	}
+}
+
+func TestDropCaptureBudget(t *testing.T) {
+	const (
+		snapLen = 36
+		// Each capture costs the copied bytes plus the overhead, so the
+		// budget allows four captures per second.
+		perCapture     = snapLen + dropCaptureOverhead
+		bytesPerSecond = 4 * perCapture
+	)
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	ipt, captured := capturingTables(clock, snapLen, bytesPerSecond)
+	drop := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			pkt, _ := udpPayloadPacket(100)
+			if ipt.Check(Input, &pkt, "") {
+				t.Fatalf("Check(Input) = true, want false")
+			}
+		}
+	}
+
+	drop(10)
+	stats := ipt.DropCapture.Stats()
+	if got, want := len(*captured), 4; got != want {
+		t.Errorf("got %d captured packets in a burst, want %d", got, want)
+	}
+	if got, want := stats.Suppressed.Value(), uint64(6); got != want {
+		t.Errorf("got Suppressed = %d, want %d", got, want)
+	}
+
+	// The budget is refilled over time, but never beyond a second's worth.
+	clock.Advance(time.Second / 4)
+	drop(2)
+	if got, want := len(*captured), 5; got != want {
+		t.Errorf("got %d captured packets after a quarter of a second, want %d", got, want)
+	}
+	clock.Advance(time.Hour)
+	drop(10)
+	if got, want := len(*captured), 9; got != want {
+		t.Errorf("got %d captured packets after an hour, want %d", got, want)
+	}
+	if got, want := stats.Captured.Value(), uint64(9); got != want {
+		t.Errorf("got Captured = %d, want %d", got, want)
+	}
+
+	// A budget of 0 disables budgeting.
+	ipt.DropCapture.SetBytesPerSecond(0)
+	drop(10)
+	if got, want := len(*captured), 19; got != want {
+		t.Errorf("got %d captured packets without a budget, want %d", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// A PacketSpec describes a packet to be evaluated by CheckDryRun. Only the
+// fields relevant to rule evaluation are included.
+type PacketSpec struct {
+	// NetworkProtocol is the network protocol of the packet. It is IPv4 if
+	// it is zero, or header.IPv6ProtocolNumber for IPv6 packets, which are
+	// only filtered by ip6tables.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+
+	// Protocol is the transport protocol of the packet.
+	Protocol tcpip.TransportProtocolNumber
+
+	// SrcAddr and DstAddr are the source and destination addresses, of the
+	// length of NetworkProtocol's addresses.
+	SrcAddr tcpip.Address
+	DstAddr tcpip.Address
+
+	// SrcPort and DstPort are the transport source and destination ports.
+	// They are ignored for protocols without ports.
+	SrcPort uint16
+	DstPort uint16
+
+	// TCPFlags holds the TCP flags of the packet. It is ignored for
+	// protocols other than TCP.
+	TCPFlags uint8
+
+	// InputInterface and OutputInterface are the names of the NICs the
+	// packet arrives on and leaves through. Like in Check, only
+	// InputInterface is used at the Prerouting and Input hooks, and only
+	// OutputInterface at the Output and Postrouting hooks.
+	InputInterface  string
+	OutputInterface string
+}
+
+// A TraceStep records a rule that produced a verdict while a packet traversed
+// the tables.
+type TraceStep struct {
+	// Table is the name of the table containing the rule.
+	Table string
+
+	// Chain is the name of the chain the rule was evaluated in.
+	Chain string
+
+	// RuleIdx is the index of the rule in the table's Rules.
+	RuleIdx int
+
+	// Verdict is the verdict returned by the rule.
+	Verdict RuleVerdict
+}
+
+// tracer records the steps taken during a traversal. A nil *tracer records
+// nothing. Only dry runs are traced, so Repliers don't reply to packets when
+// a tracer is used.
+type tracer struct {
+	// tablename is the name of the table currently being traversed.
+	tablename string
+
+	// steps holds the steps taken so far, in order.
+	steps []TraceStep
+}
+
+// record adds a step to tr. Rules that only continue traversal to the next
+// rule aren't recorded.
+func (tr *tracer) record(hook Hook, ruleIdx int, verdict RuleVerdict) {
+	if tr == nil || verdict == RuleContinue {
+		return
+	}
+	tr.steps = append(tr.steps, TraceStep{
+		Table:   tr.tablename,
+		Chain:   hookChainName(hook),
+		RuleIdx: ruleIdx,
+		Verdict: verdict,
+	})
+}
+
+// CheckDryRun evaluates a packet built from spec against the rules for hook
+// without sending any traffic. It returns the same verdict Check would return
+// for that packet along with the ordered list of steps that produced it.
+//
+// Like Check, CheckDryRun accepts packets of a network protocol it doesn't
+// filter without traversing the tables. It classifies the packet's connection
+// before the tables that follow connection tracking, and skips the nat table
+// for translated connections. The packet's addresses are translated as Check
+// would translate them, either for the connection it belongs to or by the nat
+// table, so that later tables see the same packet. CheckDryRun doesn't modify
+// it or it.ConnTrack.
+func (it *IPTables) CheckDryRun(hook Hook, spec PacketSpec) (bool, []TraceStep) {
+	pkt := spec.packet()
+	if !parseNetworkHeader(hook, &pkt) {
+		return it.malformedVerdict(hook), nil
+	}
+	if packetNetworkProtocol(pkt) != it.networkProtocol() {
+		return true, nil
+	}
+	nicName := spec.InputInterface
+	if hook == Output || hook == Postrouting {
+		nicName = spec.OutputInterface
+	}
+	tablenames := it.Priorities[hook]
+	trackAt := it.connTrackIndex(hook)
+	translated := false
+	var tr tracer
+	for i, tablename := range tablenames {
+		if i == trackAt {
+			var ok bool
+			if ok, translated = it.ConnTrack.classify(&pkt); !ok {
+				return false, tr.steps
+			}
+		}
+		if translated && tablename == TablenameNat {
+			continue
+		}
+		tr.tablename = tablename
+		if !it.checkTableVerdict(hook, &pkt, nicName, tablename, it.Tables[tablename], &tr) {
+			return false, tr.steps
+		}
+	}
+	if trackAt == len(tablenames) {
+		if ok, _ := it.ConnTrack.classify(&pkt); !ok {
+			return false, tr.steps
+		}
+	}
+	return true, tr.steps
+}
+
+// packet builds a synthetic IPv4 or IPv6 packet matching spec with its
+// network and transport headers set.
+func (spec PacketSpec) packet() tcpip.PacketBuffer {
+	var transportSize int
+	switch spec.Protocol {
+	case header.TCPProtocolNumber:
+		transportSize = header.TCPMinimumSize
+	case header.UDPProtocolNumber:
+		transportSize = header.UDPMinimumSize
+	}
+
+	var hdr buffer.View
+	var networkSize int
+	if spec.NetworkProtocol == header.IPv6ProtocolNumber {
+		networkSize = header.IPv6MinimumSize
+		hdr = buffer.NewView(networkSize + transportSize)
+		header.IPv6(hdr).Encode(&header.IPv6Fields{
+			PayloadLength: uint16(transportSize),
+			NextHeader:    uint8(spec.Protocol),
+			HopLimit:      64,
+			SrcAddr:       spec.SrcAddr,
+			DstAddr:       spec.DstAddr,
+		})
+	} else {
+		networkSize = header.IPv4MinimumSize
+		hdr = buffer.NewView(networkSize + transportSize)
+		header.IPv4(hdr).Encode(&header.IPv4Fields{
+			IHL:         header.IPv4MinimumSize,
+			TotalLength: uint16(len(hdr)),
+			TTL:         64,
+			Protocol:    uint8(spec.Protocol),
+			SrcAddr:     spec.SrcAddr,
+			DstAddr:     spec.DstAddr,
+		})
+	}
+
+	transport := hdr[networkSize:]
+	switch spec.Protocol {
+	case header.TCPProtocolNumber:
+		header.TCP(transport).Encode(&header.TCPFields{
+			SrcPort:    spec.SrcPort,
+			DstPort:    spec.DstPort,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      spec.TCPFlags,
+		})
+	case header.UDPProtocolNumber:
+		header.UDP(transport).Encode(&header.UDPFields{
+			SrcPort: spec.SrcPort,
+			DstPort: spec.DstPort,
+			Length:  header.UDPMinimumSize,
+		})
+	}
+
+	pkt := tcpip.PacketBuffer{
+		Data:          hdr.ToVectorisedView(),
+		NetworkHeader: hdr[:networkSize],
+	}
+	if transportSize != 0 {
+		pkt.TransportHeader = transport
+	}
+	return pkt
+}
+
+// hookChainName returns the name of the built-in chain for hook.
+func hookChainName(hook Hook) string {
+	switch hook {
+	case Prerouting:
+		return ChainNamePrerouting
+	case Input:
+		return ChainNameInput
+	case Forward:
+		return ChainNameForward
+	case Output:
+		return ChainNameOutput
+	case Postrouting:
+		return ChainNamePostrouting
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// dropNATTables returns the default tables with the nat table's PREROUTING
+// chain dropping TCP.
+func dropNATTables() IPTables {
+	ipt := DefaultTables()
+	nat := ipt.Tables[TablenameNat]
+	nat.Rules = append([]Rule{
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: DropTarget{},
+		},
+	}, nat.Rules...)
+	for hook := range nat.BuiltinChains {
+		if hook != Prerouting {
+			nat.BuiltinChains[hook]++
+		}
+		nat.Underflows[hook]++
+	}
+	ipt.Tables[TablenameNat] = nat
+	return ipt
+}
+
+func TestCheckDryRun(t *testing.T) {
+	tcpSpec := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagSyn,
+	}
+	udpSpec := PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  53,
+	}
+
+	for _, tc := range []struct {
+		name      string
+		ipt       IPTables
+		hook      Hook
+		spec      PacketSpec
+		wantOK    bool
+		wantSteps []TraceStep
+	}{
+		{
+			name:   "accept",
+			ipt:    DefaultTables(),
+			hook:   Input,
+			spec:   tcpSpec,
+			wantOK: true,
+			wantSteps: []TraceStep{
+				{Table: TablenameFilter, Chain: ChainNameInput, RuleIdx: 0, Verdict: RuleAccept},
+				{Table: TablenameNat, Chain: ChainNameInput, RuleIdx: 1, Verdict: RuleAccept},
+			},
+		},
+		{
+			name:   "filter drop",
+			ipt:    dropUDPTables(),
+			hook:   Input,
+			spec:   udpSpec,
+			wantOK: false,
+			wantSteps: []TraceStep{
+				{Table: TablenameFilter, Chain: ChainNameInput, RuleIdx: 0, Verdict: RuleDrop},
+			},
+		},
+		{
+			name:   "filter accept past drop rule",
+			ipt:    dropUDPTables(),
+			hook:   Input,
+			spec:   tcpSpec,
+			wantOK: true,
+			wantSteps: []TraceStep{
+				{Table: TablenameFilter, Chain: ChainNameInput, RuleIdx: 1, Verdict: RuleAccept},
+				{Table: TablenameNat, Chain: ChainNameInput, RuleIdx: 1, Verdict: RuleAccept},
+			},
+		},
+		{
+			name:   "nat drop",
+			ipt:    dropNATTables(),
+			hook:   Prerouting,
+			spec:   tcpSpec,
+			wantOK: false,
+			wantSteps: []TraceStep{
+				{Table: TablenameRaw, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+				{Table: TablenameMangle, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+				{Table: TablenameNat, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleDrop},
+			},
+		},
+		{
+			name:   "nat accept",
+			ipt:    dropNATTables(),
+			hook:   Prerouting,
+			spec:   udpSpec,
+			wantOK: true,
+			wantSteps: []TraceStep{
+				{Table: TablenameRaw, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+				{Table: TablenameMangle, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+				{Table: TablenameNat, Chain: ChainNamePrerouting, RuleIdx: 1, Verdict: RuleAccept},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, steps := tc.ipt.CheckDryRun(tc.hook, tc.spec)
+			if ok != tc.wantOK {
+				t.Errorf("CheckDryRun(%d, %+v) = %t, want %t", tc.hook, tc.spec, ok, tc.wantOK)
+			}
+			if !reflect.DeepEqual(steps, tc.wantSteps) {
+				t.Errorf("CheckDryRun(%d, %+v) steps = %+v, want %+v", tc.hook, tc.spec, steps, tc.wantSteps)
+			}
+
+			// The dry run must agree with a real packet.
+			pkt := tc.spec.packet()
+			if real := tc.ipt.Check(tc.hook, &pkt, ""); real != ok {
+				t.Errorf("Check(%d, %+v) = %t, but CheckDryRun returned %t", tc.hook, tc.spec, real, ok)
+			}
+		})
+	}
+}
+
+// stateMatcher matches packets whose connection is in one of states, like
+// "-m state".
+type stateMatcher struct {
+	states ConnState
+}
+
+// Name implements Matcher.Name.
+func (stateMatcher) Name() string {
+	return "state"
+}
+
+// Match implements Matcher.Match.
+func (sm stateMatcher) Match(hook Hook, pkt tcpip.PacketBuffer, interfaceName string) (bool, bool) {
+	return sm.states&ConnState(pkt.ConnState) != 0, false
+}
+
+// TestCheckDryRunConnState tests that dry runs classify the connection of
+// packets without tracking it.
+func TestCheckDryRunConnState(t *testing.T) {
+	ipt := DefaultTables()
+	// PREROUTING only accepts established connections.
+	ipt.Tables[TablenameMangle] = Table{
+		Rules: []Rule{
+			{Matchers: []Matcher{stateMatcher{states: ConnStateEstablished}}, Target: AcceptTarget{}},
+			{Target: DropTarget{}},
+			{Target: AcceptTarget{}},
+			{Target: ErrorTarget{}},
+		},
+		BuiltinChains: map[Hook]int{Prerouting: 0, Output: 2},
+		Underflows:    map[Hook]int{Prerouting: 1, Output: 2},
+		UserChains:    map[string]int{},
+	}
+	ipt.ConnTrack = NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	ipt.InitCounters()
+
+	syn := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagSyn,
+	}
+	synAck := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  serverAddr,
+		DstAddr:  clientAddr,
+		SrcPort:  80,
+		DstPort:  1234,
+		TCPFlags: header.TCPFlagSyn | header.TCPFlagAck,
+	}
+
+	// The reply of an unknown connection isn't established.
+	if ok, steps := ipt.CheckDryRun(Prerouting, synAck); ok {
+		t.Errorf("CheckDryRun(Prerouting, SYN-ACK) = true, %+v before the SYN, want false", steps)
+	}
+	if got := ipt.ConnTrack.Count(); got != 0 {
+		t.Fatalf("Count() = %d after a dry run, want 0", got)
+	}
+
+	pkt := syn.packet()
+	if !ipt.Check(Output, &pkt, "") {
+		t.Fatalf("Check(Output, SYN) = false, want true")
+	}
+	ok, steps := ipt.CheckDryRun(Prerouting, synAck)
+	if !ok {
+		t.Errorf("CheckDryRun(Prerouting, SYN-ACK) = false after the SYN, want true")
+	}
+	wantSteps := []TraceStep{
+		{Table: TablenameRaw, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+		{Table: TablenameMangle, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+		{Table: TablenameNat, Chain: ChainNamePrerouting, RuleIdx: 0, Verdict: RuleAccept},
+	}
+	if !reflect.DeepEqual(steps, wantSteps) {
+		t.Errorf("CheckDryRun(Prerouting, SYN-ACK) steps = %+v, want %+v", steps, wantSteps)
+	}
+	if entries := ipt.ConnTrack.Entries(); len(entries) != 1 || entries[0].Replied {
+		t.Errorf("got entries %+v after a dry run of the reply, want one unreplied connection", entries)
+	}
+
+	// The dry run must agree with a real packet.
+	pkt = synAck.packet()
+	if !ipt.Check(Prerouting, &pkt, "") {
+		t.Errorf("Check(Prerouting, SYN-ACK) = false, but CheckDryRun returned true")
+	}
+}
+
+func TestCheckDryRunIPv6(t *testing.T) {
+	ipt := dropUDPTables()
+	ip6t := dropUDPTables()
+	ip6t.NetworkProtocol = header.IPv6ProtocolNumber
+
+	udpSpec := PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  53,
+	}
+	udp6Spec := PacketSpec{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+		Protocol:        header.UDPProtocolNumber,
+		SrcAddr:         "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01",
+		DstAddr:         "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02",
+		SrcPort:         1234,
+		DstPort:         53,
+	}
+
+	for _, tc := range []struct {
+		name      string
+		ipt       IPTables
+		spec      PacketSpec
+		wantOK    bool
+		wantSteps []TraceStep
+	}{
+		{
+			name:   "ip6tables IPv6 UDP",
+			ipt:    ip6t,
+			spec:   udp6Spec,
+			wantOK: false,
+			wantSteps: []TraceStep{
+				{Table: TablenameFilter, Chain: ChainNameInput, RuleIdx: 0, Verdict: RuleDrop},
+			},
+		},
+		{
+			name:   "ip6tables IPv4 UDP",
+			ipt:    ip6t,
+			spec:   udpSpec,
+			wantOK: true,
+		},
+		{
+			name:   "iptables IPv6 UDP",
+			ipt:    ipt,
+			spec:   udp6Spec,
+			wantOK: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, steps := tc.ipt.CheckDryRun(Input, tc.spec)
+			if ok != tc.wantOK {
+				t.Errorf("CheckDryRun(Input, %+v) = %t, want %t", tc.spec, ok, tc.wantOK)
+			}
+			if !reflect.DeepEqual(steps, tc.wantSteps) {
+				t.Errorf("CheckDryRun(Input, %+v) steps = %+v, want %+v", tc.spec, steps, tc.wantSteps)
+			}
+
+			// The dry run must agree with a real packet.
+			pkt := tc.spec.packet()
+			if real := tc.ipt.Check(Input, &pkt, ""); real != ok {
+				t.Errorf("Check(Input, %+v) = %t, but CheckDryRun returned %t", tc.spec, real, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// ICMPErrorQuoteLen is the maximum number of bytes following the IP header of
+// an offending packet that are quoted in the ICMP errors generated for it.
+// This is enough to hold the ports of TCP and UDP packets (RFC 792).
+const ICMPErrorQuoteLen = 8
+
+// ICMPv4Error builds an ICMPv4 error message of type typ and code reporting
+// pkt. The message quotes pkt's IP header, including options, followed by at
+// most ICMPErrorQuoteLen bytes of its payload.
+//
+// ICMPv4Error returns false if no error may be sent in response to pkt, as
+// required by RFC 1122 section 3.2.2: pkt is itself an ICMP error, isn't the
+// first fragment of a datagram, or was sent from or to a broadcast or
+// multicast address.
+//
+// Precondition: pkt.NetworkHeader is set.
+func ICMPv4Error(pkt tcpip.PacketBuffer, typ header.ICMPv4Type, code byte) (buffer.View, bool) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	if !mayRespond(ipHdr) {
+		return nil, false
+	}
+
+	var buf [ICMPErrorQuoteLen]byte
+	payload := PeekTransportHeader(pkt, len(buf), buf[:])
+	if ipHdr.TransportProtocol() == header.ICMPv4ProtocolNumber {
+		if len(payload) == 0 || isICMPv4Error(header.ICMPv4(payload).Type()) {
+			return nil, false
+		}
+	}
+
+	msg := buffer.NewView(header.ICMPv4MinimumSize + len(ipHdr) + len(payload))
+	icmpHdr := header.ICMPv4(msg)
+	icmpHdr.SetType(typ)
+	icmpHdr.SetCode(code)
+	n := copy(msg[header.ICMPv4MinimumSize:], ipHdr)
+	copy(msg[header.ICMPv4MinimumSize+n:], payload)
+	icmpHdr.SetChecksum(^header.Checksum(msg, 0))
+	return msg, true
+}
+
+// mayRespond returns true if a packet with IP header ipHdr may elicit a
+// response: it must be the first fragment of its datagram and be sent from a
+// unicast address to a unicast address.
+func mayRespond(ipHdr header.IPv4) bool {
+	if ipHdr.FragmentOffset() != 0 {
+		return false
+	}
+	for _, addr := range []tcpip.Address{ipHdr.SourceAddress(), ipHdr.DestinationAddress()} {
+		if addr == header.IPv4Broadcast || header.IsV4MulticastAddress(addr) {
+			return false
+		}
+	}
+	return ipHdr.SourceAddress() != header.IPv4Any
+}
+
+// isICMPv4Error returns true if typ is an ICMPv4 error message type.
+func isICMPv4Error(typ header.ICMPv4Type) bool {
+	switch typ {
+	case header.ICMPv4DstUnreachable, header.ICMPv4SrcQuench, header.ICMPv4Redirect, header.ICMPv4TimeExceeded, header.ICMPv4ParamProblem:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	// DefaultICMPErrorInterval is the default interval at which tokens are
+	// added to each destination's bucket by ICMPErrorLimiter. It is the
+	// default value of Linux's net.ipv4.icmp_ratelimit.
+	DefaultICMPErrorInterval = time.Second
+
+	// icmpErrorBurst is the number of ICMP errors that can be sent to a
+	// destination in a single burst (XRLIM_BURST_FACTOR in Linux).
+	icmpErrorBurst = 6
+
+	// maxICMPErrorPeers is the number of destinations tracked by an
+	// ICMPErrorLimiter, bounding its memory use.
+	maxICMPErrorPeers = 1024
+)
+
+// ICMPErrorLimiter limits the rate at which ICMP errors are sent to each
+// destination, like Linux's net.ipv4.icmp_ratelimit. It keeps a token bucket
+// per destination that gains a token every interval and holds at most
+// icmpErrorBurst tokens, so that a flood of packets eliciting errors can't be
+// amplified.
+type ICMPErrorLimiter struct {
+	clock tcpip.Clock
+
+	mu sync.Mutex
+
+	// interval is the time it takes a bucket to gain a token, in
+	// nanoseconds. If it is 0, rate limiting is disabled. interval is
+	// protected by mu.
+	interval int64
+
+	// peers maps destinations to their buckets. It is protected by mu.
+	peers map[tcpip.Address]*icmpErrorPeer
+}
+
+// icmpErrorPeer is the token bucket of a single destination.
+type icmpErrorPeer struct {
+	// tokens is the amount of time accumulated by the bucket, in
+	// nanoseconds. Sending an error costs interval.
+	tokens int64
+
+	// last is the monotonic time tokens was last updated at.
+	last int64
+}
+
+// NewICMPErrorLimiter returns an ICMPErrorLimiter that uses clock to refill
+// its buckets every DefaultICMPErrorInterval.
+func NewICMPErrorLimiter(clock tcpip.Clock) *ICMPErrorLimiter {
+	return &ICMPErrorLimiter{
+		clock:    clock,
+		interval: DefaultICMPErrorInterval.Nanoseconds(),
+		peers:    make(map[tcpip.Address]*icmpErrorPeer),
+	}
+}
+
+// Interval returns the time it takes a destination to gain a token.
+func (l *ICMPErrorLimiter) Interval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(l.interval)
+}
+
+// SetInterval sets the time it takes a destination to gain a token. An
+// interval of 0 disables rate limiting.
+func (l *ICMPErrorLimiter) SetInterval(interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = interval.Nanoseconds()
+}
+
+// Allow returns true if an ICMP error may be sent to dst now, consuming a
+// token if so.
+func (l *ICMPErrorLimiter) Allow(dst tcpip.Address) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interval <= 0 {
+		return true
+	}
+
+	now := l.clock.NowMonotonic()
+	maxTokens := icmpErrorBurst * l.interval
+	peer, ok := l.peers[dst]
+	if !ok {
+		if len(l.peers) >= maxICMPErrorPeers {
+			l.evictLocked(now, maxTokens)
+		}
+		// New destinations start with a full bucket.
+		peer = &icmpErrorPeer{tokens: maxTokens, last: now}
+		l.peers[dst] = peer
+	}
+
+	peer.tokens += now - peer.last
+	peer.last = now
+	if peer.tokens > maxTokens {
+		peer.tokens = maxTokens
+	}
+	if peer.tokens < l.interval {
+		return false
+	}
+	peer.tokens -= l.interval
+	return true
+}
+
+// evictLocked makes room for a new destination. Destinations whose buckets
+// are full are indistinguishable from new ones and are dropped first; if
+// there are none, an arbitrary destination is dropped.
+//
+// Preconditions: l.mu must be locked.
+func (l *ICMPErrorLimiter) evictLocked(now, maxTokens int64) {
+	for addr, peer := range l.peers {
+		if peer.tokens+now-peer.last >= maxTokens {
+			delete(l.peers, addr)
+		}
+	}
+	if len(l.peers) < maxICMPErrorPeers {
+		return
+	}
+	for addr := range l.peers {
+		delete(l.peers, addr)
+		return
+	}
+}
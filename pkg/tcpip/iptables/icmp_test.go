@@ -0,0 +1,188 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// tcpDataPacket returns an inbound TCP packet carrying payloadLen bytes of
+// data, with Data trimmed to start at the transport header as it is when
+// iptables sees it.
+func tcpDataPacket(payloadLen int) tcpip.PacketBuffer {
+	pkt := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagAck | header.TCPFlagPsh,
+	}.packet()
+	data := append(buffer.View(nil), pkt.TransportHeader...)
+	data = append(data, bytes.Repeat([]byte{0xaa}, payloadLen)...)
+	pkt.Data = data.ToVectorisedView()
+	pkt.TransportHeader = nil
+	return pkt
+}
+
+func TestICMPv4ErrorQuote(t *testing.T) {
+	pkt := tcpDataPacket(100)
+	msg, ok := ICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable)
+	if !ok {
+		t.Fatalf("ICMPv4Error(TCP packet) = _, false, want true")
+	}
+
+	if got, want := len(msg), header.ICMPv4MinimumSize+header.IPv4MinimumSize+ICMPErrorQuoteLen; got != want {
+		t.Errorf("got message length %d, want %d", got, want)
+	}
+	icmp := header.ICMPv4(msg)
+	if got, want := icmp.Type(), header.ICMPv4DstUnreachable; got != want {
+		t.Errorf("got type %d, want %d", got, want)
+	}
+	if got, want := icmp.Code(), byte(header.ICMPv4PortUnreachable); got != want {
+		t.Errorf("got code %d, want %d", got, want)
+	}
+	if got := header.Checksum(msg, 0); got != 0xffff {
+		t.Errorf("got checksum over message %#x, want 0xffff", got)
+	}
+
+	quote := icmp.Payload()
+	if got, want := quote[:header.IPv4MinimumSize], []byte(pkt.NetworkHeader); !bytes.Equal(got, want) {
+		t.Errorf("got quoted IP header %x, want %x", got, want)
+	}
+	if got, want := quote[header.IPv4MinimumSize:], pkt.Data.First()[:ICMPErrorQuoteLen]; !bytes.Equal(got, want) {
+		t.Errorf("got quoted transport bytes %x, want %x", got, want)
+	}
+}
+
+func TestICMPv4ErrorShortPayload(t *testing.T) {
+	pkt := ipv4Packet(header.UDPProtocolNumber)
+	pkt.Data = buffer.NewViewFromBytes([]byte{1, 2, 3}).ToVectorisedView()
+	msg, ok := ICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable)
+	if !ok {
+		t.Fatalf("ICMPv4Error(short UDP packet) = _, false, want true")
+	}
+	if got, want := len(msg), header.ICMPv4MinimumSize+header.IPv4MinimumSize+3; got != want {
+		t.Errorf("got message length %d, want %d", got, want)
+	}
+}
+
+func TestICMPv4ErrorSuppressed(t *testing.T) {
+	icmpError := func(typ header.ICMPv4Type) tcpip.PacketBuffer {
+		pkt := ipv4Packet(header.ICMPv4ProtocolNumber)
+		icmp := header.ICMPv4(buffer.NewView(header.ICMPv4MinimumSize))
+		icmp.SetType(typ)
+		pkt.Data = buffer.View(icmp).ToVectorisedView()
+		return pkt
+	}
+	withAddrs := func(src, dst tcpip.Address) tcpip.PacketBuffer {
+		pkt := ipv4Packet(header.UDPProtocolNumber)
+		header.IPv4(pkt.NetworkHeader).SetSourceAddress(src)
+		header.IPv4(pkt.NetworkHeader).SetDestinationAddress(dst)
+		return pkt
+	}
+	fragment := ipv4Packet(header.UDPProtocolNumber)
+	header.IPv4(fragment.NetworkHeader).SetFlagsFragmentOffset(0, 8)
+
+	for _, tc := range []struct {
+		name string
+		pkt  tcpip.PacketBuffer
+		want bool
+	}{
+		{"echo request", icmpError(header.ICMPv4Echo), true},
+		{"destination unreachable", icmpError(header.ICMPv4DstUnreachable), false},
+		{"time exceeded", icmpError(header.ICMPv4TimeExceeded), false},
+		{"non-initial fragment", fragment, false},
+		{"broadcast destination", withAddrs("\x0a\x00\x00\x01", header.IPv4Broadcast), false},
+		{"multicast destination", withAddrs("\x0a\x00\x00\x01", "\xe0\x00\x00\x01"), false},
+		{"multicast source", withAddrs("\xe0\x00\x00\x01", "\x0a\x00\x00\x02"), false},
+		{"unspecified source", withAddrs(header.IPv4Any, "\x0a\x00\x00\x02"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, got := ICMPv4Error(tc.pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable); got != tc.want {
+				t.Errorf("ICMPv4Error(...) = _, %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestICMPErrorLimiterFlood(t *testing.T) {
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	l := NewICMPErrorLimiter(clock)
+	const dst = tcpip.Address("\x0a\x00\x00\x01")
+
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		if l.Allow(dst) {
+			allowed++
+		}
+	}
+	if allowed != icmpErrorBurst {
+		t.Errorf("allowed %d of a flood of errors, want %d", allowed, icmpErrorBurst)
+	}
+
+	// Other destinations have their own bucket.
+	if !l.Allow("\x0a\x00\x00\x02") {
+		t.Errorf("Allow(other destination) = false, want true")
+	}
+
+	// A token is gained every interval.
+	clock.Advance(DefaultICMPErrorInterval)
+	if !l.Allow(dst) {
+		t.Errorf("Allow() after an interval = false, want true")
+	}
+	if l.Allow(dst) {
+		t.Errorf("second Allow() after an interval = true, want false")
+	}
+
+	// An interval of 0 disables rate limiting.
+	l.SetInterval(0)
+	for i := 0; i < 100; i++ {
+		if !l.Allow(dst) {
+			t.Fatalf("Allow() with rate limiting disabled = false, want true")
+		}
+	}
+}
+
+func TestICMPErrorLimiterBounded(t *testing.T) {
+	l := NewICMPErrorLimiter(faketime.NewManualClock(time.Unix(0, 0)))
+	for i := 0; i < 2*maxICMPErrorPeers; i++ {
+		dst := tcpip.Address([]byte{10, 0, byte(i >> 8), byte(i)})
+		if !l.Allow(dst) {
+			t.Fatalf("Allow(%s) = false for a new destination, want true", dst)
+		}
+	}
+	if got := len(l.peers); got > maxICMPErrorPeers {
+		t.Errorf("limiter tracks %d destinations, want at most %d", got, maxICMPErrorPeers)
+	}
+}
+
+func TestICMPErrorLimiterInterval(t *testing.T) {
+	l := NewICMPErrorLimiter(faketime.NewManualClock(time.Unix(0, 0)))
+	if got := l.Interval(); got != DefaultICMPErrorInterval {
+		t.Errorf("Interval() = %v, want %v", got, DefaultICMPErrorInterval)
+	}
+	l.SetInterval(250 * time.Millisecond)
+	if got, want := l.Interval(), 250*time.Millisecond; got != want {
+		t.Errorf("Interval() = %v, want %v", got, want)
+	}
+}
@@ -18,8 +18,11 @@ package iptables
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
@@ -28,6 +31,11 @@ const (
 	TablenameNat    = "nat"
 	TablenameMangle = "mangle"
 	TablenameFilter = "filter"
+	TablenameRaw    = "raw"
+
+	// TablenameSecurity is the name of Linux's security table. It isn't
+	// one of DefaultTables, but is visited at its Linux priority if added.
+	TablenameSecurity = "security"
 )
 
 // Chain names as defined by net/ipv4/netfilter/ip_tables.c.
@@ -43,12 +51,16 @@ const (
 // underflow.
 const HookUnset = -1
 
+// maxJumpDepth is the number of nested jumps a packet may take through a
+// table. It bounds traversals of tables with jump loops.
+const maxJumpDepth = 1024
+
 // DefaultTables returns a default set of tables. Each chain is set to accept
 // all packets.
 func DefaultTables() IPTables {
 	// TODO(gvisor.dev/issue/170): We may be able to swap out some strings for
 	// iotas.
-	return IPTables{
+	ipt := IPTables{
 		Tables: map[string]Table{
 			TablenameNat: Table{
 				Rules: []Rule{
@@ -88,32 +100,162 @@ func DefaultTables() IPTables {
 				},
 				UserChains: map[string]int{},
 			},
-			TablenameFilter: Table{
+			TablenameFilter: AcceptAllFilterTable(),
+			TablenameRaw: Table{
 				Rules: []Rule{
-					Rule{Target: AcceptTarget{}},
 					Rule{Target: AcceptTarget{}},
 					Rule{Target: AcceptTarget{}},
 					Rule{Target: ErrorTarget{}},
 				},
 				BuiltinChains: map[Hook]int{
-					Input:   0,
-					Forward: 1,
-					Output:  2,
+					Prerouting: 0,
+					Output:     1,
 				},
 				Underflows: map[Hook]int{
-					Input:   0,
-					Forward: 1,
-					Output:  2,
+					Prerouting: 0,
+					Output:     1,
 				},
 				UserChains: map[string]int{},
 			},
 		},
-		Priorities: map[Hook][]string{
-			Input:      []string{TablenameNat, TablenameFilter},
-			Prerouting: []string{TablenameMangle, TablenameNat},
-			Output:     []string{TablenameMangle, TablenameNat, TablenameFilter},
-		},
 	}
+	// Tables are visited in the order of their Linux priorities, see
+	// tablePriority. The raw table is visited first, so that its rules can
+	// exempt packets from connection tracking.
+	ipt.UpdatePriorities()
+	return ipt
+}
+
+// DefaultIP6Tables returns a default set of ip6tables. It holds the same
+// tables as DefaultTables, but filters IPv6 packets.
+func DefaultIP6Tables() IPTables {
+	ipt := DefaultTables()
+	ipt.NetworkProtocol = header.IPv6ProtocolNumber
+	return ipt
+}
+
+// Table priorities, and the priority at which connections are tracked, as
+// defined by include/uapi/linux/netfilter_ipv4.h. Lower priorities are visited
+// first.
+const (
+	priorityRaw       = -300
+	priorityConnTrack = -200
+	priorityMangle    = -150
+	priorityNatDst    = -100
+	priorityFilter    = 0
+	prioritySecurity  = 50
+	priorityNatSrc    = 100
+)
+
+// tablePriority returns the Linux priority of the built-in table named
+// tablename at hook. ok is false for user tables, which have no priority.
+func tablePriority(hook Hook, tablename string) (priority int, ok bool) {
+	switch tablename {
+	case TablenameRaw:
+		return priorityRaw, true
+	case TablenameMangle:
+		return priorityMangle, true
+	case TablenameNat:
+		// Destination NAT happens before routing, and source NAT after it.
+		if hook == Prerouting || hook == Output {
+			return priorityNatDst, true
+		}
+		return priorityNatSrc, true
+	case TablenameFilter:
+		return priorityFilter, true
+	case TablenameSecurity:
+		return prioritySecurity, true
+	}
+	return 0, false
+}
+
+// priority returns the priority at which the table named tablename is visited
+// for hook: the one set by SetPriority if any, or else its Linux priority. ok
+// is false if the table has no priority, and isn't visited by
+// UpdatePriorities.
+func (it *IPTables) priority(hook Hook, tablename string) (priority int, ok bool) {
+	if priority, ok := it.PriorityOverrides[TableHook{Table: tablename, Hook: hook}]; ok {
+		return priority, true
+	}
+	return tablePriority(hook, tablename)
+}
+
+// SetPriority sets the priority at which the table named tablename is visited
+// for hook, overriding its Linux priority, and updates it.Priorities. It lets
+// tables without a Linux priority be visited, and built-in tables be
+// reordered.
+func (it *IPTables) SetPriority(tablename string, hook Hook, priority int) {
+	if it.PriorityOverrides == nil {
+		it.PriorityOverrides = make(map[TableHook]int)
+	}
+	it.PriorityOverrides[TableHook{Table: tablename, Hook: hook}] = priority
+	it.UpdatePriorities()
+}
+
+// UpdatePriorities sets it.Priorities to visit, for each hook, the tables in
+// it that have a built-in chain for the hook and a priority, in increasing
+// order of priority. Tables with the same priority are visited in order of
+// name. It must be called after tables are added to or removed from it.
+func (it *IPTables) UpdatePriorities() {
+	priorities := make(map[Hook][]string)
+	for hook := Hook(0); hook < NumHooks; hook++ {
+		var tablenames []string
+		for tablename, table := range it.Tables {
+			if _, ok := table.BuiltinChains[hook]; !ok {
+				continue
+			}
+			if _, ok := it.priority(hook, tablename); ok {
+				tablenames = append(tablenames, tablename)
+			}
+		}
+		if len(tablenames) == 0 {
+			continue
+		}
+		sort.Slice(tablenames, func(i, j int) bool {
+			pi, _ := it.priority(hook, tablenames[i])
+			pj, _ := it.priority(hook, tablenames[j])
+			if pi != pj {
+				return pi < pj
+			}
+			return tablenames[i] < tablenames[j]
+		})
+		priorities[hook] = tablenames
+	}
+	it.Priorities = priorities
+}
+
+// ValidatePriorities returns an error if it.Priorities lists a table more than
+// once for a hook, lists a table that doesn't exist or has no built-in chain
+// for the hook, or orders tables against their priorities.
+func (it *IPTables) ValidatePriorities() error {
+	for hook, tablenames := range it.Priorities {
+		seen := make(map[string]struct{}, len(tablenames))
+		// last is the name and priority of the last table with a
+		// priority visited.
+		last, lastPriority := "", 0
+		for _, tablename := range tablenames {
+			if _, ok := seen[tablename]; ok {
+				return fmt.Errorf("table %q is listed more than once for hook %d", tablename, hook)
+			}
+			seen[tablename] = struct{}{}
+			table, ok := it.Tables[tablename]
+			if !ok {
+				return fmt.Errorf("table %q listed for hook %d doesn't exist", tablename, hook)
+			}
+			if _, ok := table.BuiltinChains[hook]; !ok {
+				return fmt.Errorf("table %q has no built-in chain for hook %d", tablename, hook)
+			}
+			priority, ok := it.priority(hook, tablename)
+			if !ok {
+				continue
+			}
+			if last != "" && priority < lastPriority {
+				return fmt.Errorf("table %q is visited after table %q for hook %d, but has a lower priority", tablename, last, hook)
+			}
+			last, lastPriority = tablename, priority
+		}
+	}
+	return nil
 }
 
 // EmptyFilterTable returns a Table with no rules and the filter table chains
@@ -135,68 +277,309 @@ func EmptyFilterTable() Table {
 	}
 }
 
+// AcceptAllFilterTable returns a filter Table whose built-in chains each
+// accept all packets with a single unconditional rule.
+func AcceptAllFilterTable() Table {
+	return Table{
+		Rules: []Rule{
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: ErrorTarget{}},
+		},
+		BuiltinChains: map[Hook]int{
+			Input:   0,
+			Forward: 1,
+			Output:  2,
+		},
+		Underflows: map[Hook]int{
+			Input:   0,
+			Forward: 1,
+			Output:  2,
+		},
+		UserChains: map[string]int{},
+	}
+}
+
+// InitCounters gives each table in it that doesn't have counters a zeroed
+// packet and byte counter for each rule, for each counter named by a
+// CountTarget and for the policy of each built-in chain. Tables that already
+// have counters keep them, so replacing one table doesn't reset the counters
+// of the others.
+func (it *IPTables) InitCounters() {
+	for name, table := range it.Tables {
+		if len(table.counters) != len(table.Rules) {
+			table.counters = make([]RuleCounters, len(table.Rules))
+			table.namedCounters = newNamedCounters(table.Rules)
+			table.policyCounters = make([]RuleCounters, NumHooks)
+			it.Tables[name] = table
+		}
+	}
+}
+
 // Check runs pkt through the rules for hook. It returns true when the packet
 // should continue traversing the network stack and false when it should be
-// dropped.
+// dropped. Targets may mark pkt, e.g. to exempt it from connection tracking.
 //
-// Precondition: pkt.NetworkHeader is set.
-func (it *IPTables) Check(hook Hook, pkt tcpip.PacketBuffer) bool {
-	// TODO(gvisor.dev/issue/170): A lot of this is uncomplicated because
-	// we're missing features. Jumps, the call stack, etc. aren't checked
-	// for yet because we're yet to support them.
-
+// If it.ConnTrack is set, the connection of pkt is tracked at the Prerouting
+// and Output hooks, between the tables visited before Linux's connection
+// tracking, like raw, and the others. pkt is dropped if the connection
+// tracking table is full. The packets of connections whose destination was
+// translated by a DNATTarget or a RedirectTarget are rewritten when they're
+// tracked, and skip the nat table: like in Linux, it only sees the packets
+// of connections that aren't translated yet.
+//
+// Packets of a network protocol other than it.NetworkProtocol are accepted
+// without being checked.
+//
+// nicName is the name of the NIC pkt arrived on at the Prerouting and Input
+// hooks, and of the NIC it leaves through at the Output and Postrouting hooks.
+//
+// If pkt.NetworkHeader is missing or truncated, it is parsed from pkt.Data at
+// the hooks of inbound packets, whose headers haven't been consumed yet. If
+// that fails, or at the hooks of outbound packets, pkt is given its verdict by
+// it.MalformedPolicy.
+func (it *IPTables) Check(hook Hook, pkt *tcpip.PacketBuffer, nicName string) bool {
+	if !parseNetworkHeader(hook, pkt) {
+		return it.checkMalformed(hook)
+	}
+	if packetNetworkProtocol(*pkt) != it.networkProtocol() {
+		return true
+	}
+	tablenames := it.Priorities[hook]
+	trackAt := it.connTrackIndex(hook)
+	translated := false
 	// Go through each table containing the hook.
-	for _, tablename := range it.Priorities[hook] {
-		switch verdict := it.checkTable(hook, pkt, tablename); verdict {
-		// If the table returns Accept, move on to the next table.
-		case TableAccept:
+	for i, tablename := range tablenames {
+		if i == trackAt {
+			var ok bool
+			if ok, translated = it.ConnTrack.track(pkt); !ok {
+				return false
+			}
+		}
+		if translated && tablename == TablenameNat {
 			continue
-		// The Drop verdict is final.
-		case TableDrop:
+		}
+		if !it.checkTableVerdict(hook, pkt, nicName, tablename, it.Tables[tablename], nil) {
 			return false
-		default:
-			panic(fmt.Sprintf("Unknown verdict %v.", verdict))
 		}
 	}
+	if trackAt == len(tablenames) && !it.ConnTrack.Track(pkt) {
+		return false
+	}
 
 	// Every table returned Accept.
 	return true
 }
 
+// CheckBatch runs each packet in pkts through the rules for hook. It returns
+// one verdict per packet, with the same meaning and result as calling Check
+// on that packet. The tables for hook are only looked up once for the whole
+// batch, whose packets all go through the NIC named nicName.
+func (it *IPTables) CheckBatch(hook Hook, pkts []tcpip.PacketBuffer, nicName string) []bool {
+	tablenames := it.Priorities[hook]
+	tables := make([]Table, 0, len(tablenames))
+	for _, tablename := range tablenames {
+		tables = append(tables, it.Tables[tablename])
+	}
+	trackAt := it.connTrackIndex(hook)
+
+	verdicts := make([]bool, len(pkts))
+	for i := range pkts {
+		if !parseNetworkHeader(hook, &pkts[i]) {
+			verdicts[i] = it.checkMalformed(hook)
+			continue
+		}
+		verdicts[i] = true
+		if packetNetworkProtocol(pkts[i]) != it.networkProtocol() {
+			continue
+		}
+		translated := false
+		for j, table := range tables {
+			if j == trackAt {
+				var ok bool
+				if ok, translated = it.ConnTrack.track(&pkts[i]); !ok {
+					verdicts[i] = false
+					break
+				}
+			}
+			if translated && tablenames[j] == TablenameNat {
+				continue
+			}
+			if !it.checkTableVerdict(hook, &pkts[i], nicName, tablenames[j], table, nil) {
+				verdicts[i] = false
+				break
+			}
+		}
+		if verdicts[i] && trackAt == len(tables) && !it.ConnTrack.Track(&pkts[i]) {
+			verdicts[i] = false
+		}
+	}
+	return verdicts
+}
+
+// checkMalformed counts a packet whose network header couldn't be found at
+// hook, and returns whether it should continue traversing the network stack.
+func (it *IPTables) checkMalformed(hook Hook) bool {
+	if it.MalformedPackets != nil {
+		it.MalformedPackets.Increment()
+	}
+	return it.malformedVerdict(hook)
+}
+
+// malformedVerdict returns whether a packet whose network header couldn't be
+// found at hook should continue traversing the network stack.
+func (it *IPTables) malformedVerdict(hook Hook) bool {
+	if verdict, ok := it.MalformedPolicy[hook]; ok {
+		return verdict == TableAccept
+	}
+	return hook == Output
+}
+
+// parseNetworkHeader makes sure that pkt.NetworkHeader holds a whole IPv4 or
+// IPv6 header, and returns whether it does. If it doesn't, the header is
+// parsed from the first view of pkt.Data at the hooks of inbound packets,
+// whose Data starts with their network header until it is consumed. Headers
+// aren't split across views. Data isn't modified.
+//
+// The Data of outbound packets holds their payload, which could be mistaken
+// for a header, so it isn't parsed.
+func parseNetworkHeader(hook Hook, pkt *tcpip.PacketBuffer) bool {
+	if networkHeaderLength(pkt.NetworkHeader) != 0 {
+		return true
+	}
+	switch hook {
+	case Prerouting, Input, Forward:
+		hdr := pkt.Data.First()
+		n := networkHeaderLength(hdr)
+		if n == 0 {
+			return false
+		}
+		pkt.NetworkHeader = hdr[:n]
+		return true
+	default:
+		return false
+	}
+}
+
+// networkHeaderLength returns the length of the IPv4 or IPv6 header at the
+// start of hdr, or 0 if hdr doesn't start with a whole one. IPv6 extension
+// headers aren't included.
+func networkHeaderLength(hdr buffer.View) int {
+	switch header.IPVersion(hdr) {
+	case header.IPv4Version:
+		if len(hdr) < header.IPv4MinimumSize {
+			return 0
+		}
+		n := int(header.IPv4(hdr).HeaderLength())
+		if n < header.IPv4MinimumSize || n > len(hdr) {
+			return 0
+		}
+		return n
+	case header.IPv6Version:
+		if len(hdr) < header.IPv6MinimumSize {
+			return 0
+		}
+		return header.IPv6MinimumSize
+	default:
+		return 0
+	}
+}
+
+// connTrackIndex returns the index in it.Priorities[hook] of the first table
+// visited after connections are tracked, or -1 if connections aren't tracked
+// at hook. As in Linux, connections are tracked at the Prerouting and Output
+// hooks, after the tables with a lower priority than priorityConnTrack. Tables
+// without a priority are visited after connections are tracked. Only IPv4
+// connections are tracked.
+func (it *IPTables) connTrackIndex(hook Hook) int {
+	if it.ConnTrack == nil || it.networkProtocol() != header.IPv4ProtocolNumber || (hook != Prerouting && hook != Output) {
+		return -1
+	}
+	tablenames := it.Priorities[hook]
+	for i, tablename := range tablenames {
+		if priority, ok := it.priority(hook, tablename); !ok || priority > priorityConnTrack {
+			return i
+		}
+	}
+	return len(tablenames)
+}
+
+// checkTableVerdict runs pkt through table, named tablename, and returns
+// whether the packet should continue on to the next table. If tr is not nil,
+// each rule that yields a verdict is recorded in it. Otherwise, dropped
+// packets are passed to it.DropCapture, if set.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (it *IPTables) checkTableVerdict(hook Hook, pkt *tcpip.PacketBuffer, nicName, tablename string, table Table, tr *tracer) bool {
+	switch verdict, ruleIdx := it.checkTable(hook, pkt, nicName, table, tr); verdict {
+	// If the table returns Accept, move on to the next table.
+	case TableAccept:
+		return true
+	// The Drop verdict is final.
+	case TableDrop:
+		if it.DropCapture != nil && tr == nil {
+			it.DropCapture.capture(hook, tablename, ruleIdx, pkt)
+		}
+		return false
+	default:
+		panic(fmt.Sprintf("Unknown verdict %v.", verdict))
+	}
+}
+
+// checkTable runs pkt through table and returns its verdict along with the
+// index of the rule that produced it, or -1 if pkt reached the end of the
+// table.
+//
 // Precondition: pkt.NetworkHeader is set.
-func (it *IPTables) checkTable(hook Hook, pkt tcpip.PacketBuffer, tablename string) TableVerdict {
+func (it *IPTables) checkTable(hook Hook, pkt *tcpip.PacketBuffer, nicName string, table Table, tr *tracer) (TableVerdict, int) {
+	// returnRules holds the rules to continue from when returning from the
+	// chains that were jumped to, innermost last.
+	var returnRules []int
+
+	underflow, hasUnderflow := table.Underflows[hook]
+
 	// Start from ruleIdx and walk the list of rules until a rule gives us
 	// a verdict.
-	table := it.Tables[tablename]
 	for ruleIdx := table.BuiltinChains[hook]; ruleIdx < len(table.Rules); ruleIdx++ {
-		switch verdict := it.checkRule(hook, pkt, table, ruleIdx); verdict {
+		// Reaching the underflow rule in the built-in chain, rather than
+		// in a chain jumped to from it, applies the chain's policy.
+		if hasUnderflow && ruleIdx == underflow && len(returnRules) == 0 {
+			return it.checkPolicy(hook, pkt, table, tr)
+		}
+		verdict := it.checkRule(hook, pkt, nicName, table, ruleIdx, tr)
+		tr.record(hook, ruleIdx, verdict)
+		switch verdict {
 		case RuleAccept:
-			return TableAccept
+			return TableAccept, ruleIdx
 
 		case RuleDrop:
-			return TableDrop
+			return TableDrop, ruleIdx
 
 		case RuleContinue:
 			continue
 
+		case RuleJump:
+			// Linux rejects tables with loops, which are the only way
+			// to jump this deep, when they're set. Drop the packet
+			// rather than loop forever.
+			if len(returnRules) >= maxJumpDepth {
+				return TableDrop, ruleIdx
+			}
+			returnRules = append(returnRules, ruleIdx+1)
+			// ruleIdx is incremented before the next iteration.
+			ruleIdx = table.Rules[ruleIdx].Target.(JumpTarget).RuleNum - 1
+
 		case RuleReturn:
-			// TODO(gvisor.dev/issue/170): We don't implement jump
-			// yet, so any Return is from a built-in chain. That
-			// means we have to to call the underflow.
-			underflow := table.Rules[table.Underflows[hook]]
-			// Underflow is guaranteed to be an unconditional
-			// ACCEPT or DROP.
-			switch v, _ := underflow.Target.Action(pkt); v {
-			case RuleAccept:
-				return TableAccept
-			case RuleDrop:
-				return TableDrop
-			case RuleContinue, RuleReturn:
-				panic("Underflows should only return RuleAccept or RuleDrop.")
-			default:
-				panic(fmt.Sprintf("Unknown verdict: %d", v))
+			if n := len(returnRules); n > 0 {
+				ruleIdx = returnRules[n-1] - 1
+				returnRules = returnRules[:n-1]
+				continue
 			}
 
+			// Returning from a built-in chain calls its underflow.
+			return it.checkPolicy(hook, pkt, table, tr)
+
 		default:
 			panic(fmt.Sprintf("Unknown verdict: %d", verdict))
 		}
@@ -205,23 +588,52 @@ func (it *IPTables) checkTable(hook Hook, pkt tcpip.PacketBuffer, tablename stri
 
 	// We got through the entire table without a decision. Default to DROP
 	// for safety.
-	return TableDrop
+	return TableDrop, -1
+}
+
+// checkPolicy runs pkt through the policy of the built-in chain for hook in
+// table, i.e. its underflow rule, and returns the table's verdict along with
+// the index of the underflow rule. The packet is counted by the chain's policy
+// counters rather than by the rule's.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (it *IPTables) checkPolicy(hook Hook, pkt *tcpip.PacketBuffer, table Table, tr *tracer) (TableVerdict, int) {
+	ruleIdx := table.Underflows[hook]
+	// Underflow is guaranteed to be an unconditional ACCEPT or DROP.
+	if tr == nil {
+		table.countPolicy(hook, *pkt)
+	}
+	v, _ := table.Rules[ruleIdx].Target.Action(*pkt)
+	tr.record(hook, ruleIdx, v)
+	switch v {
+	case RuleAccept:
+		return TableAccept, ruleIdx
+	case RuleDrop:
+		return TableDrop, ruleIdx
+	case RuleContinue, RuleReturn, RuleJump:
+		panic("Underflows should only return RuleAccept or RuleDrop.")
+	default:
+		panic(fmt.Sprintf("Unknown verdict: %d", v))
+	}
 }
 
 // Precondition: pk.NetworkHeader is set.
-func (it *IPTables) checkRule(hook Hook, pkt tcpip.PacketBuffer, table Table, ruleIdx int) RuleVerdict {
+func (it *IPTables) checkRule(hook Hook, pkt *tcpip.PacketBuffer, nicName string, table Table, ruleIdx int, tr *tracer) RuleVerdict {
 	rule := table.Rules[ruleIdx]
+	netProto := packetNetworkProtocol(*pkt)
 
 	// First check whether the packet matches the IP header filter.
-	// TODO(gvisor.dev/issue/170): Support other fields of the filter.
-	if rule.Filter.Protocol != 0 && rule.Filter.Protocol != header.IPv4(pkt.NetworkHeader).TransportProtocol() {
+	if !rule.Filter.match(hook, *pkt, nicName) {
 		return RuleContinue
 	}
 
 	// Go through each rule matcher. If they all match, run
-	// the rule target.
+	// the rule target. Matchers for another network protocol never match.
 	for _, matcher := range rule.Matchers {
-		matches, hotdrop := matcher.Match(hook, pkt, "")
+		if nm, ok := matcher.(NetworkMatcher); ok && nm.NetworkProtocol() != netProto {
+			return RuleContinue
+		}
+		matches, hotdrop := matcher.Match(hook, *pkt, nicName)
 		if hotdrop {
 			return RuleDrop
 		}
@@ -230,7 +642,154 @@ func (it *IPTables) checkRule(hook Hook, pkt tcpip.PacketBuffer, table Table, ru
 		}
 	}
 
-	// All the matchers matched, so run the target.
-	verdict, _ := rule.Target.Action(pkt)
+	// All the matchers matched, so count the packet and run the target.
+	// Dry runs aren't counted.
+	if tr == nil {
+		table.count(ruleIdx, *pkt)
+	}
+	verdict, _ := rule.Target.Action(*pkt)
+	if counter, ok := rule.Target.(CountTarget); ok && tr == nil {
+		table.countNamed(counter.Name, *pkt)
+	}
+	if logger, ok := rule.Target.(LogTarget); ok && tr == nil {
+		it.logPacket(logger, hook, *pkt)
+	}
+	if ct, ok := rule.Target.(CTTarget); ok && ct.NoTrack {
+		pkt.NoTrack = true
+	}
+	// Mangling and replies are only implemented for IPv4.
+	if netProto != header.IPv4ProtocolNumber {
+		return verdict
+	}
+	if mangler, ok := rule.Target.(Mangler); ok && tr == nil {
+		mangler.Mangle(pkt)
+	}
+	if replier, ok := rule.Target.(Replier); ok && tr == nil {
+		replier.Reply(*pkt)
+	}
+	if dt, ok := rule.Target.(destinationTarget); ok {
+		if tr == nil && !it.translateDestination(hook, pkt, dt) {
+			return RuleDrop
+		}
+		if tr != nil && !it.previewDestination(hook, pkt, dt) {
+			return RuleDrop
+		}
+	}
 	return verdict
 }
+
+// match returns whether pkt, going through the NIC named nicName at hook,
+// matches fl.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (fl IPHeaderFilter) match(hook Hook, pkt tcpip.PacketBuffer, nicName string) bool {
+	if fl.Protocol != 0 && fl.Protocol != packetTransportProtocol(pkt) {
+		return false
+	}
+	src, dst := packetAddresses(pkt)
+	if !filterAddress(src, fl.SrcMask, fl.Src, fl.SrcInvert) || !filterAddress(dst, fl.DstMask, fl.Dst, fl.DstInvert) {
+		return false
+	}
+	switch hook {
+	case Prerouting, Input:
+		return filterInterface(nicName, fl.InputInterface, fl.InputInterfaceInvert)
+	case Output, Postrouting:
+		return filterInterface(nicName, fl.OutputInterface, fl.OutputInterfaceInvert)
+	default:
+		// Netstack doesn't forward packets, so there's no interface to
+		// check.
+		return true
+	}
+}
+
+// filterInterface returns whether nicName matches the filter interface
+// ifName. If ifName ends with "+", every name starting with what precedes it
+// matches. An empty ifName matches every name. If invert is true, the result
+// is inverted.
+func filterInterface(nicName, ifName string, invert bool) bool {
+	if ifName == "" {
+		return !invert
+	}
+	var matches bool
+	if strings.HasSuffix(ifName, "+") {
+		matches = strings.HasPrefix(nicName, ifName[:len(ifName)-1])
+	} else {
+		matches = nicName == ifName
+	}
+	return matches != invert
+}
+
+// filterAddress returns whether addr matches the filter address filterAddr
+// once both are masked by mask. If invert is true, the result is inverted.
+// Addresses of a different length than filterAddr never match it, unless
+// filterAddr is empty.
+func filterAddress(addr, mask, filterAddr tcpip.Address, invert bool) bool {
+	matches := true
+	if len(filterAddr) != 0 && (len(addr) != len(filterAddr) || len(mask) != len(filterAddr)) {
+		matches = false
+	} else {
+		for i := 0; i < len(filterAddr); i++ {
+			if addr[i]&mask[i] != filterAddr[i]&mask[i] {
+				matches = false
+				break
+			}
+		}
+	}
+	return matches != invert
+}
+
+// networkProtocol returns the network protocol of the packets filtered by it.
+func (it *IPTables) networkProtocol() tcpip.NetworkProtocolNumber {
+	if it.NetworkProtocol == 0 {
+		return header.IPv4ProtocolNumber
+	}
+	return it.NetworkProtocol
+}
+
+// packetNetworkProtocol returns the network protocol of pkt, given by the
+// version of its network header, or 0 if it is neither IPv4 nor IPv6.
+func packetNetworkProtocol(pkt tcpip.PacketBuffer) tcpip.NetworkProtocolNumber {
+	switch header.IPVersion(pkt.NetworkHeader) {
+	case header.IPv4Version:
+		return header.IPv4ProtocolNumber
+	case header.IPv6Version:
+		return header.IPv6ProtocolNumber
+	default:
+		return 0
+	}
+}
+
+// packetTransportProtocol returns the transport protocol of pkt. For IPv6
+// packets, it is the next header of the fixed header, so packets with
+// extension headers don't match transport protocol filters.
+//
+// Precondition: pkt.NetworkHeader is set.
+func packetTransportProtocol(pkt tcpip.PacketBuffer) tcpip.TransportProtocolNumber {
+	if packetNetworkProtocol(pkt) == header.IPv6ProtocolNumber {
+		return header.IPv6(pkt.NetworkHeader).TransportProtocol()
+	}
+	return header.IPv4(pkt.NetworkHeader).TransportProtocol()
+}
+
+// packetAddresses returns the source and destination addresses of pkt.
+//
+// Precondition: pkt.NetworkHeader is set.
+func packetAddresses(pkt tcpip.PacketBuffer) (tcpip.Address, tcpip.Address) {
+	if packetNetworkProtocol(pkt) == header.IPv6ProtocolNumber {
+		ipHdr := header.IPv6(pkt.NetworkHeader)
+		return ipHdr.SourceAddress(), ipHdr.DestinationAddress()
+	}
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	return ipHdr.SourceAddress(), ipHdr.DestinationAddress()
+}
+
+// packetLength returns the length of pkt, including its network header, as
+// recorded in the network header.
+//
+// Precondition: pkt.NetworkHeader is set.
+func packetLength(pkt tcpip.PacketBuffer) int {
+	if packetNetworkProtocol(pkt) == header.IPv6ProtocolNumber {
+		return header.IPv6MinimumSize + int(header.IPv6(pkt.NetworkHeader).PayloadLength())
+	}
+	return int(header.IPv4(pkt.NetworkHeader).TotalLength())
+}
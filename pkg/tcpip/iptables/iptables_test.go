@@ -0,0 +1,1020 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// ipv4Packet returns a PacketBuffer holding an IPv4 header for proto with a
+// parsed NetworkHeader.
+func ipv4Packet(proto tcpip.TransportProtocolNumber) tcpip.PacketBuffer {
+	hdr := buffer.NewView(header.IPv4MinimumSize)
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: header.IPv4MinimumSize,
+		TTL:         64,
+		Protocol:    uint8(proto),
+		SrcAddr:     "\x0a\x00\x00\x01",
+		DstAddr:     "\x0a\x00\x00\x02",
+	})
+	return tcpip.PacketBuffer{
+		Data:          hdr.ToVectorisedView(),
+		NetworkHeader: hdr,
+	}
+}
+
+// dropUDPTables returns the default tables with the filter table's INPUT chain
+// dropping UDP and accepting everything else.
+func dropUDPTables() IPTables {
+	ipt := DefaultTables()
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 1
+	filter.BuiltinChains[Output] = 1
+	filter.Underflows[Input] = 1
+	filter.Underflows[Forward] = 1
+	filter.Underflows[Output] = 1
+	ipt.Tables[TablenameFilter] = filter
+	return ipt
+}
+
+func batchPackets(n int) []tcpip.PacketBuffer {
+	protos := []tcpip.TransportProtocolNumber{
+		header.TCPProtocolNumber,
+		header.UDPProtocolNumber,
+		header.ICMPv4ProtocolNumber,
+	}
+	pkts := make([]tcpip.PacketBuffer, n)
+	for i := range pkts {
+		pkts[i] = ipv4Packet(protos[i%len(protos)])
+	}
+	return pkts
+}
+
+func TestCheckBatchMatchesCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ipt  IPTables
+	}{
+		{"default", DefaultTables()},
+		{"drop UDP", dropUDPTables()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkts := batchPackets(9)
+			for hook := Prerouting; hook < NumHooks; hook++ {
+				verdicts := tc.ipt.CheckBatch(hook, pkts, "")
+				if len(verdicts) != len(pkts) {
+					t.Fatalf("CheckBatch(%d, pkts) returned %d verdicts, want %d", hook, len(verdicts), len(pkts))
+				}
+				for i, pkt := range pkts {
+					if want := tc.ipt.Check(hook, &pkt, ""); verdicts[i] != want {
+						t.Errorf("CheckBatch(%d, pkts)[%d] = %t, want %t", hook, i, verdicts[i], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBatchDropsUDP(t *testing.T) {
+	ipt := dropUDPTables()
+	pkts := []tcpip.PacketBuffer{
+		ipv4Packet(header.TCPProtocolNumber),
+		ipv4Packet(header.UDPProtocolNumber),
+	}
+	verdicts := ipt.CheckBatch(Input, pkts, "")
+	if want := []bool{true, false}; verdicts[0] != want[0] || verdicts[1] != want[1] {
+		t.Errorf("CheckBatch(Input, {TCP, UDP}) = %v, want %v", verdicts, want)
+	}
+}
+
+func TestCheckBatchEmpty(t *testing.T) {
+	ipt := DefaultTables()
+	if verdicts := ipt.CheckBatch(Input, nil, ""); len(verdicts) != 0 {
+		t.Errorf("CheckBatch(Input, nil) = %v, want no verdicts", verdicts)
+	}
+}
+
+const benchmarkBatchSize = 64
+
+func BenchmarkCheckPerPacket(b *testing.B) {
+	ipt := dropUDPTables()
+	pkts := batchPackets(benchmarkBatchSize)
+	verdicts := make([]bool, len(pkts))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, pkt := range pkts {
+			verdicts[i] = ipt.Check(Input, &pkt, "")
+		}
+	}
+}
+
+func BenchmarkCheckBatch(b *testing.B) {
+	ipt := dropUDPTables()
+	pkts := batchPackets(benchmarkBatchSize)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ipt.CheckBatch(Input, pkts, "")
+	}
+}
+
+func TestAcceptAllFilterTable(t *testing.T) {
+	for _, hook := range []Hook{Input, Forward, Output} {
+		ipt := IPTables{
+			Tables:     map[string]Table{TablenameFilter: AcceptAllFilterTable()},
+			Priorities: map[Hook][]string{hook: []string{TablenameFilter}},
+		}
+		ipt.InitCounters()
+		pkt := ipv4Packet(header.UDPProtocolNumber)
+		if !ipt.Check(hook, &pkt, "") {
+			t.Errorf("Check(%v) = false, want true", hook)
+		}
+		// The chain's only rule is its policy.
+		filter := ipt.Tables[TablenameFilter]
+		if got := filter.PolicyCounter(hook).Packets; got != 1 {
+			t.Errorf("got %d packets accepted by the %v chain's policy, want 1", got, hook)
+		}
+		if got := filter.RuleCounter(filter.BuiltinChains[hook]).Packets; got != 0 {
+			t.Errorf("got %d packets counted by the %v chain's underflow rule, want 0", got, hook)
+		}
+	}
+}
+
+// jumpTables returns the default tables with the filter table's INPUT chain
+// jumping to a user chain that accepts TCP, then dropping UDP.
+func jumpTables() IPTables {
+	ipt := DefaultTables()
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{Target: JumpTarget{RuleNum: 4}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: UserChainTarget{Name: "chain"}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: AcceptTarget{},
+		},
+		Rule{Target: ReturnTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 2
+	filter.BuiltinChains[Output] = 2
+	filter.Underflows[Input] = 2
+	filter.Underflows[Forward] = 2
+	filter.Underflows[Output] = 2
+	filter.UserChains["chain"] = 4
+	ipt.Tables[TablenameFilter] = filter
+	ipt.InitCounters()
+	return ipt
+}
+
+func TestJump(t *testing.T) {
+	ipt := jumpTables()
+	for _, tc := range []struct {
+		proto tcpip.TransportProtocolNumber
+		want  bool
+		// wantRule is the rule that counts the packet, or -1 if it's
+		// counted by INPUT's policy.
+		wantRule int
+	}{
+		// Accepted by the user chain.
+		{proto: header.TCPProtocolNumber, want: true, wantRule: 4},
+		// Returned from the user chain, then dropped by INPUT.
+		{proto: header.UDPProtocolNumber, want: false, wantRule: 1},
+		// Returned from the user chain, then accepted by INPUT's policy.
+		{proto: header.ICMPv4ProtocolNumber, want: true, wantRule: -1},
+	} {
+		pkt := ipv4Packet(tc.proto)
+		if got := ipt.Check(Input, &pkt, ""); got != tc.want {
+			t.Errorf("Check(Input) = %t for protocol %d, want %t", got, tc.proto, tc.want)
+		}
+		filter := ipt.Tables[TablenameFilter]
+		if tc.wantRule == -1 {
+			if got := filter.PolicyCounter(Input).Packets; got != 1 {
+				t.Errorf("got %d packets counted by INPUT's policy for protocol %d, want 1", got, tc.proto)
+			}
+		} else if got := filter.RuleCounter(tc.wantRule).Packets; got != 1 {
+			t.Errorf("got %d packets counted by rule %d for protocol %d, want 1", got, tc.wantRule, tc.proto)
+		}
+	}
+
+	for _, table := range ipt.Describe() {
+		if table.Name != TablenameFilter {
+			continue
+		}
+		if got, want := table.Chains[0].Rules[0].Text, "-A INPUT -j chain"; got != want {
+			t.Errorf("got rule %q, want %q", got, want)
+		}
+	}
+}
+
+func TestJumpLoop(t *testing.T) {
+	ipt := jumpTables()
+	// Jump back to the start of the user chain from within it.
+	ipt.Tables[TablenameFilter].Rules[5] = Rule{Target: JumpTarget{RuleNum: 4}}
+	pkt := ipv4Packet(header.UDPProtocolNumber)
+	if ipt.Check(Input, &pkt, "") {
+		t.Errorf("Check(Input) = true for a packet caught in a jump loop, want false")
+	}
+}
+
+func TestNestedJump(t *testing.T) {
+	ipt := DefaultTables()
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		// INPUT jumps to chain1, then drops UDP.
+		Rule{Target: JumpTarget{RuleNum: 4}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: AcceptTarget{}},
+		// chain1 jumps to chain2, then accepts TCP.
+		Rule{Target: UserChainTarget{Name: "chain1"}},
+		Rule{Target: JumpTarget{RuleNum: 8}},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: AcceptTarget{},
+		},
+		Rule{Target: ReturnTarget{}},
+		// chain2 returns straight away.
+		Rule{Target: UserChainTarget{Name: "chain2"}},
+		Rule{Target: ReturnTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 2
+	filter.BuiltinChains[Output] = 2
+	filter.Underflows[Input] = 2
+	filter.Underflows[Forward] = 2
+	filter.Underflows[Output] = 2
+	filter.UserChains["chain1"] = 4
+	filter.UserChains["chain2"] = 8
+	ipt.Tables[TablenameFilter] = filter
+	ipt.InitCounters()
+
+	for _, tc := range []struct {
+		proto tcpip.TransportProtocolNumber
+		want  bool
+		// wantRule is as in TestJump.
+		wantRule int
+	}{
+		// Accepted by chain1 after returning from chain2.
+		{proto: header.TCPProtocolNumber, want: true, wantRule: 5},
+		// Returned from both chains, then dropped by INPUT.
+		{proto: header.UDPProtocolNumber, want: false, wantRule: 1},
+		// Returned from both chains, then accepted by INPUT's policy.
+		{proto: header.ICMPv4ProtocolNumber, want: true, wantRule: -1},
+	} {
+		pkt := ipv4Packet(tc.proto)
+		if got := ipt.Check(Input, &pkt, ""); got != tc.want {
+			t.Errorf("Check(Input) = %t for protocol %d, want %t", got, tc.proto, tc.want)
+		}
+		filter := ipt.Tables[TablenameFilter]
+		if tc.wantRule == -1 {
+			if got := filter.PolicyCounter(Input).Packets; got != 1 {
+				t.Errorf("got %d packets counted by INPUT's policy for protocol %d, want 1", got, tc.proto)
+			}
+		} else if got := filter.RuleCounter(tc.wantRule).Packets; got != 1 {
+			t.Errorf("got %d packets counted by rule %d for protocol %d, want 1", got, tc.wantRule, tc.proto)
+		}
+	}
+	// Each packet went through both returns.
+	filter = ipt.Tables[TablenameFilter]
+	if got := filter.RuleCounter(8).Packets; got != 3 {
+		t.Errorf("got %d packets returned from chain2, want 3", got)
+	}
+}
+
+func TestJumpToUserChainHead(t *testing.T) {
+	ipt := jumpTables()
+	// Jump to the rule marking the beginning of the user chain, rather than
+	// the chain's first rule.
+	ipt.Tables[TablenameFilter].Rules[0] = Rule{Target: JumpTarget{RuleNum: 3}}
+	pkt := ipv4Packet(header.TCPProtocolNumber)
+	if ipt.Check(Input, &pkt, "") {
+		t.Errorf("Check(Input) = true for a packet that jumped to a user chain's head, want false")
+	}
+}
+
+// recordTarget appends its name to log, then lets packets continue to the next
+// rule. It stands in for targets whose effects depend on the order in which
+// tables are visited, like MARK and REDIRECT.
+type recordTarget struct {
+	name string
+	log  *[]string
+}
+
+// Action implements Target.Action.
+func (rt recordTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	*rt.log = append(*rt.log, rt.name)
+	return RuleContinue, ""
+}
+
+// recordTable returns a table with a chain for each of hooks that runs a
+// recordTarget named after the table and hook, then accepts.
+func recordTable(tablename string, log *[]string, hooks ...Hook) Table {
+	table := Table{
+		BuiltinChains: map[Hook]int{},
+		Underflows:    map[Hook]int{},
+		UserChains:    map[string]int{},
+	}
+	for _, hook := range hooks {
+		table.BuiltinChains[hook] = len(table.Rules)
+		table.Rules = append(table.Rules, Rule{Target: recordTarget{
+			name: fmt.Sprintf("%s/%d", tablename, hook),
+			log:  log,
+		}})
+		table.Underflows[hook] = len(table.Rules)
+		table.Rules = append(table.Rules, Rule{Target: AcceptTarget{}})
+	}
+	table.Rules = append(table.Rules, Rule{Target: ErrorTarget{}})
+	return table
+}
+
+// TestHookOrder tests that the default priorities visit tables in the order
+// Linux does: a packet is marked by mangle before nat redirects it at
+// PREROUTING, and filtered before source NAT at INPUT.
+func TestHookOrder(t *testing.T) {
+	var log []string
+	ipt := DefaultTables()
+	ipt.Tables[TablenameMangle] = recordTable(TablenameMangle, &log, Prerouting, Output)
+	ipt.Tables[TablenameNat] = recordTable(TablenameNat, &log, Prerouting, Input, Output, Postrouting)
+	ipt.Tables[TablenameFilter] = recordTable(TablenameFilter, &log, Input, Forward, Output)
+	ipt.InitCounters()
+	if err := ipt.ValidatePriorities(); err != nil {
+		t.Fatalf("ValidatePriorities failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		hooks []Hook
+		want  []string
+	}{
+		{
+			// Inbound packets.
+			hooks: []Hook{Prerouting, Input},
+			want: []string{
+				fmt.Sprintf("%s/%d", TablenameMangle, Prerouting),
+				fmt.Sprintf("%s/%d", TablenameNat, Prerouting),
+				fmt.Sprintf("%s/%d", TablenameFilter, Input),
+				fmt.Sprintf("%s/%d", TablenameNat, Input),
+			},
+		},
+		{
+			// Outbound packets.
+			hooks: []Hook{Output, Postrouting},
+			want: []string{
+				fmt.Sprintf("%s/%d", TablenameMangle, Output),
+				fmt.Sprintf("%s/%d", TablenameNat, Output),
+				fmt.Sprintf("%s/%d", TablenameFilter, Output),
+				fmt.Sprintf("%s/%d", TablenameNat, Postrouting),
+			},
+		},
+	} {
+		log = nil
+		for _, hook := range tc.hooks {
+			pkt := ipv4Packet(header.TCPProtocolNumber)
+			if !ipt.Check(hook, &pkt, "") {
+				t.Fatalf("Check(%d) = false, want true", hook)
+			}
+		}
+		if !reflect.DeepEqual(log, tc.want) {
+			t.Errorf("tables visited for hooks %v: got %v, want %v", tc.hooks, log, tc.want)
+		}
+	}
+}
+
+// TestUpdatePriorities tests that tables added to the defaults are visited at
+// their priorities, and that embedders can reorder tables with SetPriority.
+func TestUpdatePriorities(t *testing.T) {
+	var log []string
+	ipt := DefaultTables()
+	ipt.Tables[TablenameFilter] = recordTable(TablenameFilter, &log, Input, Forward, Output)
+	ipt.Tables[TablenameNat] = recordTable(TablenameNat, &log, Prerouting, Input, Output, Postrouting)
+	ipt.Tables[TablenameSecurity] = recordTable(TablenameSecurity, &log, Input, Forward, Output)
+	// User tables aren't visited until they are given a priority.
+	ipt.Tables["user"] = recordTable("user", &log, Input)
+	ipt.UpdatePriorities()
+	ipt.InitCounters()
+
+	check := func(want ...string) {
+		t.Helper()
+		log = nil
+		pkt := ipv4Packet(header.TCPProtocolNumber)
+		if !ipt.Check(Input, &pkt, "") {
+			t.Fatalf("Check(Input) = false, want true")
+		}
+		if !reflect.DeepEqual(log, want) {
+			t.Errorf("tables visited for INPUT: got %v, want %v", log, want)
+		}
+		if err := ipt.ValidatePriorities(); err != nil {
+			t.Errorf("ValidatePriorities failed: %v", err)
+		}
+	}
+	check(
+		fmt.Sprintf("%s/%d", TablenameFilter, Input),
+		fmt.Sprintf("%s/%d", TablenameSecurity, Input),
+		fmt.Sprintf("%s/%d", TablenameNat, Input),
+	)
+
+	ipt.SetPriority("user", Input, priorityFilter)
+	ipt.SetPriority(TablenameNat, Input, priorityFilter-1)
+	check(
+		fmt.Sprintf("%s/%d", TablenameNat, Input),
+		fmt.Sprintf("%s/%d", TablenameFilter, Input),
+		fmt.Sprintf("user/%d", Input),
+		fmt.Sprintf("%s/%d", TablenameSecurity, Input),
+	)
+
+	// The order is described with the built-in chains.
+	for _, table := range ipt.Describe() {
+		for _, chain := range table.Chains {
+			if chain.Name != ChainNameInput {
+				continue
+			}
+			wantPriority, _ := ipt.priority(Input, table.Name)
+			if chain.Priority != wantPriority {
+				t.Errorf("table %q: got INPUT priority %d, want %d", table.Name, chain.Priority, wantPriority)
+			}
+			if got := ipt.Priorities[Input][chain.Position]; got != table.Name {
+				t.Errorf("table %q: got INPUT position %d, which is table %q", table.Name, chain.Position, got)
+			}
+		}
+	}
+}
+
+// stateTarget records the connection state of packets in states, then lets
+// them continue to the next rule.
+type stateTarget struct {
+	states *[]ConnState
+}
+
+// Action implements Target.Action.
+func (st stateTarget) Action(pkt tcpip.PacketBuffer) (RuleVerdict, string) {
+	*st.states = append(*st.states, ConnState(pkt.ConnState))
+	return RuleContinue, ""
+}
+
+// TestCheckConnTrack tests that connections are tracked after the raw table
+// and before the mangle table is visited.
+func TestCheckConnTrack(t *testing.T) {
+	var states []ConnState
+	ipt := DefaultTables()
+	for _, tablename := range []string{TablenameRaw, TablenameMangle} {
+		ipt.Tables[tablename] = Table{
+			Rules: []Rule{
+				{Target: stateTarget{states: &states}},
+				{Target: AcceptTarget{}},
+				{Target: stateTarget{states: &states}},
+				{Target: AcceptTarget{}},
+				{Target: ErrorTarget{}},
+			},
+			BuiltinChains: map[Hook]int{Prerouting: 0, Output: 2},
+			Underflows:    map[Hook]int{Prerouting: 1, Output: 3},
+			UserChains:    map[string]int{},
+		}
+	}
+	ipt.ConnTrack = NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	ipt.InitCounters()
+
+	pkt := tcpPacket(false /* reply */, header.TCPFlagSyn)
+	if !ipt.Check(Prerouting, &pkt, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	pkts := []tcpip.PacketBuffer{tcpPacket(true /* reply */, header.TCPFlagSyn|header.TCPFlagAck)}
+	if verdicts := ipt.CheckBatch(Output, pkts, ""); !verdicts[0] {
+		t.Fatalf("CheckBatch(Output) = %v, want [true]", verdicts)
+	}
+	// Input doesn't track connections.
+	pkt = tcpPacket(false /* reply */, header.TCPFlagAck)
+	if !ipt.Check(Input, &pkt, "") {
+		t.Fatalf("Check(Input) = false, want true")
+	}
+
+	want := []ConnState{0, ConnStateNew, 0, ConnStateEstablished}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v seen by raw and mangle, want %v", states, want)
+	}
+	if got := ipt.ConnTrack.Count(); got != 1 {
+		t.Errorf("Count() = %d, want 1", got)
+	}
+}
+
+func TestValidatePriorities(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		priorities map[Hook][]string
+		wantErr    bool
+	}{
+		{
+			name:       "defaults",
+			priorities: DefaultTables().Priorities,
+		},
+		{
+			name:       "nat after mangle at PREROUTING",
+			priorities: map[Hook][]string{Prerouting: {TablenameMangle, TablenameNat}},
+		},
+		{
+			name:       "nat before mangle at PREROUTING",
+			priorities: map[Hook][]string{Prerouting: {TablenameNat, TablenameMangle}},
+			wantErr:    true,
+		},
+		{
+			name:       "nat before filter at INPUT",
+			priorities: map[Hook][]string{Input: {TablenameNat, TablenameFilter}},
+			wantErr:    true,
+		},
+		{
+			name:       "filter at PREROUTING",
+			priorities: map[Hook][]string{Prerouting: {TablenameMangle, TablenameNat, TablenameFilter}},
+			wantErr:    true,
+		},
+		{
+			name:       "duplicate table",
+			priorities: map[Hook][]string{Output: {TablenameFilter, TablenameFilter}},
+			wantErr:    true,
+		},
+		{
+			name:       "missing table",
+			priorities: map[Hook][]string{Input: {"missing"}},
+			wantErr:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ipt := DefaultTables()
+			ipt.Priorities = tc.priorities
+			if err := ipt.ValidatePriorities(); (err != nil) != tc.wantErr {
+				t.Errorf("ValidatePriorities() = %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// ipv6Packet returns a PacketBuffer holding an IPv6 header for proto with a
+// parsed NetworkHeader.
+func ipv6Packet(proto tcpip.TransportProtocolNumber) tcpip.PacketBuffer {
+	hdr := buffer.NewView(header.IPv6MinimumSize)
+	header.IPv6(hdr).Encode(&header.IPv6Fields{
+		NextHeader: uint8(proto),
+		HopLimit:   64,
+		SrcAddr:    "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01",
+		DstAddr:    "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02",
+	})
+	return tcpip.PacketBuffer{
+		Data:          hdr.ToVectorisedView(),
+		NetworkHeader: hdr,
+	}
+}
+
+func TestIP6Tables(t *testing.T) {
+	ipt := dropUDPTables()
+	ipt.InitCounters()
+	ip6t := dropUDPTables()
+	ip6t.NetworkProtocol = header.IPv6ProtocolNumber
+	ip6t.InitCounters()
+
+	for _, tc := range []struct {
+		name string
+		ipt  IPTables
+		pkt  tcpip.PacketBuffer
+		want bool
+	}{
+		{name: "iptables IPv4 UDP", ipt: ipt, pkt: ipv4Packet(header.UDPProtocolNumber), want: false},
+		{name: "iptables IPv4 TCP", ipt: ipt, pkt: ipv4Packet(header.TCPProtocolNumber), want: true},
+		{name: "iptables IPv6 UDP", ipt: ipt, pkt: ipv6Packet(header.UDPProtocolNumber), want: true},
+		{name: "ip6tables IPv6 UDP", ipt: ip6t, pkt: ipv6Packet(header.UDPProtocolNumber), want: false},
+		{name: "ip6tables IPv6 TCP", ipt: ip6t, pkt: ipv6Packet(header.TCPProtocolNumber), want: true},
+		{name: "ip6tables IPv4 UDP", ipt: ip6t, pkt: ipv4Packet(header.UDPProtocolNumber), want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkt := tc.pkt
+			if got := tc.ipt.Check(Input, &pkt, ""); got != tc.want {
+				t.Errorf("Check(Input) = %t, want %t", got, tc.want)
+			}
+			if got := tc.ipt.CheckBatch(Input, []tcpip.PacketBuffer{tc.pkt}, ""); !reflect.DeepEqual(got, []bool{tc.want}) {
+				t.Errorf("CheckBatch(Input) = %v, want [%t]", got, tc.want)
+			}
+		})
+	}
+
+	// Each table only counted the packets of its network protocol, by
+	// their length in the network header.
+	for _, tc := range []struct {
+		name string
+		ipt  IPTables
+		want RuleCounters
+	}{
+		{name: "iptables", ipt: ipt, want: RuleCounters{Packets: 2, Bytes: 2 * header.IPv4MinimumSize}},
+		{name: "ip6tables", ipt: ip6t, want: RuleCounters{Packets: 2, Bytes: 2 * header.IPv6MinimumSize}},
+	} {
+		filter := tc.ipt.Tables[TablenameFilter]
+		if got := filter.RuleCounter(0); got != tc.want {
+			t.Errorf("%s: UDP rule counters = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// networkMatcher is a NetworkMatcher that matches every packet of its
+// network protocol, and counts the packets it is called for.
+type networkMatcher struct {
+	netProto tcpip.NetworkProtocolNumber
+	calls    *int
+}
+
+// Name implements Matcher.Name.
+func (networkMatcher) Name() string {
+	return "network"
+}
+
+// NetworkProtocol implements NetworkMatcher.NetworkProtocol.
+func (nm networkMatcher) NetworkProtocol() tcpip.NetworkProtocolNumber {
+	return nm.netProto
+}
+
+// Match implements Matcher.Match.
+func (nm networkMatcher) Match(Hook, tcpip.PacketBuffer, string) (bool, bool) {
+	*nm.calls++
+	return true, false
+}
+
+func TestNetworkMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		netProto  tcpip.NetworkProtocolNumber
+		pkt       tcpip.PacketBuffer
+		wantCalls int
+		want      bool
+	}{
+		{name: "IPv4 matcher IPv4 packet", netProto: header.IPv4ProtocolNumber, pkt: ipv4Packet(header.UDPProtocolNumber), wantCalls: 1, want: false},
+		{name: "IPv4 matcher IPv6 packet", netProto: header.IPv4ProtocolNumber, pkt: ipv6Packet(header.UDPProtocolNumber), wantCalls: 0, want: true},
+		{name: "IPv6 matcher IPv6 packet", netProto: header.IPv6ProtocolNumber, pkt: ipv6Packet(header.UDPProtocolNumber), wantCalls: 1, want: false},
+		{name: "IPv6 matcher IPv4 packet", netProto: header.IPv6ProtocolNumber, pkt: ipv4Packet(header.UDPProtocolNumber), wantCalls: 0, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The tables filter the packet's network protocol, so only the
+			// matcher decides whether it is dropped.
+			ipt := dropUDPTables()
+			if header.IPVersion(tc.pkt.NetworkHeader) == header.IPv6Version {
+				ipt.NetworkProtocol = header.IPv6ProtocolNumber
+			}
+			var calls int
+			filter := ipt.Tables[TablenameFilter]
+			filter.Rules[0].Matchers = []Matcher{networkMatcher{netProto: tc.netProto, calls: &calls}}
+			ipt.Tables[TablenameFilter] = filter
+
+			pkt := tc.pkt
+			if got := ipt.Check(Input, &pkt, ""); got != tc.want {
+				t.Errorf("Check(Input) = %t, want %t", got, tc.want)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("matcher called %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDefaultIP6Tables(t *testing.T) {
+	ipt := DefaultTables()
+	ip6t := DefaultIP6Tables()
+	if ip6t.NetworkProtocol != header.IPv6ProtocolNumber {
+		t.Errorf("DefaultIP6Tables().NetworkProtocol = %d, want %d", ip6t.NetworkProtocol, header.IPv6ProtocolNumber)
+	}
+	if !reflect.DeepEqual(ip6t.Priorities, ipt.Priorities) {
+		t.Errorf("DefaultIP6Tables().Priorities = %v, want %v", ip6t.Priorities, ipt.Priorities)
+	}
+	for _, proto := range []tcpip.TransportProtocolNumber{header.UDPProtocolNumber, header.TCPProtocolNumber} {
+		pkt := ipv6Packet(proto)
+		for _, hook := range []Hook{Prerouting, Input, Output, Postrouting} {
+			if !ip6t.Check(hook, &pkt, "") {
+				t.Errorf("DefaultIP6Tables().Check(%v) dropped packet with protocol %d", hook, proto)
+			}
+		}
+	}
+}
+
+func TestCheckMalformed(t *testing.T) {
+	full := ipv4Packet(header.UDPProtocolNumber).NetworkHeader
+	short := full[:header.IPv4MinimumSize/2]
+	for _, tc := range []struct {
+		name string
+		pkt  func() tcpip.PacketBuffer
+		// parsed is whether the header is parsed from Data at the hooks of
+		// inbound packets.
+		parsed bool
+	}{
+		{
+			name: "nil header without data",
+			pkt:  func() tcpip.PacketBuffer { return tcpip.PacketBuffer{} },
+		},
+		{
+			name: "truncated header",
+			pkt: func() tcpip.PacketBuffer {
+				return tcpip.PacketBuffer{Data: short.ToVectorisedView(), NetworkHeader: short}
+			},
+		},
+		{
+			name: "nil header with truncated data",
+			pkt: func() tcpip.PacketBuffer {
+				return tcpip.PacketBuffer{Data: short.ToVectorisedView()}
+			},
+		},
+		{
+			name: "nil header with header in data",
+			pkt: func() tcpip.PacketBuffer {
+				return tcpip.PacketBuffer{Data: full.ToVectorisedView()}
+			},
+			parsed: true,
+		},
+		{
+			name: "truncated header with header in data",
+			pkt: func() tcpip.PacketBuffer {
+				return tcpip.PacketBuffer{Data: full.ToVectorisedView(), NetworkHeader: short}
+			},
+			parsed: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for hook := Prerouting; hook < NumHooks; hook++ {
+				ipt := DefaultTables()
+				ipt.InitCounters()
+				ipt.MalformedPackets = &tcpip.StatCounter{}
+				// The default tables accept every packet, so only
+				// malformed packets may be dropped.
+				parsed := tc.parsed && (hook == Prerouting || hook == Input || hook == Forward)
+				want := parsed || hook == Output
+				var wantMalformed uint64
+				if !parsed {
+					wantMalformed = 1
+				}
+
+				pkt := tc.pkt()
+				if got := ipt.Check(hook, &pkt, ""); got != want {
+					t.Errorf("Check(%d) = %t, want %t", hook, got, want)
+				}
+				if got := ipt.MalformedPackets.Value(); got != wantMalformed {
+					t.Errorf("Check(%d) counted %d malformed packets, want %d", hook, got, wantMalformed)
+				}
+				if parsed && !reflect.DeepEqual(pkt.NetworkHeader, full) {
+					t.Errorf("Check(%d) parsed network header %x, want %x", hook, pkt.NetworkHeader, full)
+				}
+
+				if got := ipt.CheckBatch(hook, []tcpip.PacketBuffer{tc.pkt()}, ""); !reflect.DeepEqual(got, []bool{want}) {
+					t.Errorf("CheckBatch(%d) = %v, want [%t]", hook, got, want)
+				}
+				if got := ipt.MalformedPackets.Value(); got != 2*wantMalformed {
+					t.Errorf("CheckBatch(%d) counted %d malformed packets, want %d", hook, got-wantMalformed, wantMalformed)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMalformedPolicy(t *testing.T) {
+	ipt := DefaultTables()
+	ipt.MalformedPolicy = map[Hook]TableVerdict{
+		Input:  TableAccept,
+		Output: TableDrop,
+	}
+	for hook, want := range map[Hook]bool{
+		Prerouting:  false,
+		Input:       true,
+		Forward:     false,
+		Output:      false,
+		Postrouting: false,
+	} {
+		// Counting malformed packets is optional.
+		var pkt tcpip.PacketBuffer
+		if got := ipt.Check(hook, &pkt, ""); got != want {
+			t.Errorf("Check(%d) = %t, want %t", hook, got, want)
+		}
+	}
+}
+
+func TestFilterAddresses(t *testing.T) {
+	// ipv4Packet is sent from 10.0.0.1 to 10.0.0.2.
+	for _, tc := range []struct {
+		name    string
+		filter  IPHeaderFilter
+		matches bool
+	}{
+		{
+			name:    "source subnet",
+			filter:  IPHeaderFilter{Src: "\x0a\x00\x00\x00", SrcMask: "\xff\x00\x00\x00"},
+			matches: true,
+		},
+		{
+			name:    "other source subnet",
+			filter:  IPHeaderFilter{Src: "\xc0\xa8\x00\x00", SrcMask: "\xff\xff\x00\x00"},
+			matches: false,
+		},
+		{
+			name:    "inverted source subnet",
+			filter:  IPHeaderFilter{Src: "\x0a\x00\x00\x00", SrcMask: "\xff\x00\x00\x00", SrcInvert: true},
+			matches: false,
+		},
+		{
+			name:    "destination host",
+			filter:  IPHeaderFilter{Dst: "\x0a\x00\x00\x02", DstMask: "\xff\xff\xff\xff"},
+			matches: true,
+		},
+		{
+			name:    "other destination host",
+			filter:  IPHeaderFilter{Dst: "\x0a\x00\x00\x01", DstMask: "\xff\xff\xff\xff"},
+			matches: false,
+		},
+		{
+			name:    "inverted other destination host",
+			filter:  IPHeaderFilter{Dst: "\x0a\x00\x00\x01", DstMask: "\xff\xff\xff\xff", DstInvert: true},
+			matches: true,
+		},
+		{
+			name:    "matching source but not destination",
+			filter:  IPHeaderFilter{Src: "\x0a\x00\x00\x01", SrcMask: "\xff\xff\xff\xff", Dst: "\x0a\x00\x00\x01", DstMask: "\xff\xff\xff\xff"},
+			matches: false,
+		},
+		{
+			name:    "zero mask",
+			filter:  IPHeaderFilter{Src: "\xc0\xa8\x00\x00", SrcMask: "\x00\x00\x00\x00"},
+			matches: true,
+		},
+		{
+			name:    "IPv6 source",
+			filter:  IPHeaderFilter{Src: "\x0a\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", SrcMask: "\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"},
+			matches: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The filter decides whether the packet is dropped.
+			ipt := dropUDPTables()
+			filter := ipt.Tables[TablenameFilter]
+			filter.Rules[0].Filter = tc.filter
+			ipt.Tables[TablenameFilter] = filter
+
+			pkt := ipv4Packet(header.UDPProtocolNumber)
+			if got, want := ipt.Check(Input, &pkt, ""), !tc.matches; got != want {
+				t.Errorf("Check(Input) = %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestFilterInterfaces(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		filter  IPHeaderFilter
+		hook    Hook
+		nicName string
+		matches bool
+	}{
+		{
+			name:    "input interface",
+			filter:  IPHeaderFilter{InputInterface: "eth0"},
+			hook:    Input,
+			nicName: "eth0",
+			matches: true,
+		},
+		{
+			name:    "other input interface",
+			filter:  IPHeaderFilter{InputInterface: "eth0"},
+			hook:    Input,
+			nicName: "eth1",
+			matches: false,
+		},
+		{
+			name:    "input interface prefix isn't a wildcard",
+			filter:  IPHeaderFilter{InputInterface: "eth"},
+			hook:    Input,
+			nicName: "eth0",
+			matches: false,
+		},
+		{
+			name:    "wildcard input interface",
+			filter:  IPHeaderFilter{InputInterface: "eth+"},
+			hook:    Input,
+			nicName: "eth1",
+			matches: true,
+		},
+		{
+			name:    "other wildcard input interface",
+			filter:  IPHeaderFilter{InputInterface: "eth+"},
+			hook:    Input,
+			nicName: "lo",
+			matches: false,
+		},
+		{
+			name:    "inverted input interface",
+			filter:  IPHeaderFilter{InputInterface: "lo", InputInterfaceInvert: true},
+			hook:    Input,
+			nicName: "eth0",
+			matches: true,
+		},
+		{
+			name:    "inverted wildcard input interface",
+			filter:  IPHeaderFilter{InputInterface: "eth+", InputInterfaceInvert: true},
+			hook:    Input,
+			nicName: "eth0",
+			matches: false,
+		},
+		{
+			name:    "output interface",
+			filter:  IPHeaderFilter{OutputInterface: "eth0"},
+			hook:    Output,
+			nicName: "eth0",
+			matches: true,
+		},
+		{
+			name:    "other output interface",
+			filter:  IPHeaderFilter{OutputInterface: "eth+"},
+			hook:    Output,
+			nicName: "lo",
+			matches: false,
+		},
+		{
+			name:    "input interface at output",
+			filter:  IPHeaderFilter{InputInterface: "lo"},
+			hook:    Output,
+			nicName: "eth0",
+			matches: true,
+		},
+		{
+			name:    "output interface at input",
+			filter:  IPHeaderFilter{OutputInterface: "lo"},
+			hook:    Input,
+			nicName: "eth0",
+			matches: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The filter decides whether the packet is dropped.
+			ipt := dropUDPTables()
+			filter := ipt.Tables[TablenameFilter]
+			filter.Rules[0].Filter = tc.filter
+			filter.Rules[0].Filter.Protocol = header.UDPProtocolNumber
+			filter.BuiltinChains[Output] = 0
+			filter.Underflows[Output] = 1
+			ipt.Tables[TablenameFilter] = filter
+
+			pkt := ipv4Packet(header.UDPProtocolNumber)
+			if got, want := ipt.Check(tc.hook, &pkt, tc.nicName), !tc.matches; got != want {
+				t.Errorf("Check(%v, %q) = %t, want %t", tc.hook, tc.nicName, got, want)
+			}
+		})
+	}
+}
+
+func TestValidForHook(t *testing.T) {
+	for _, tc := range []struct {
+		filter IPHeaderFilter
+		hook   Hook
+		want   bool
+	}{
+		{IPHeaderFilter{InputInterface: "eth0"}, Prerouting, true},
+		{IPHeaderFilter{InputInterface: "eth0"}, Input, true},
+		{IPHeaderFilter{InputInterface: "eth0"}, Forward, true},
+		{IPHeaderFilter{InputInterface: "eth0"}, Output, false},
+		{IPHeaderFilter{InputInterface: "eth0"}, Postrouting, false},
+		{IPHeaderFilter{OutputInterface: "eth0"}, Prerouting, false},
+		{IPHeaderFilter{OutputInterface: "eth0"}, Input, false},
+		{IPHeaderFilter{OutputInterface: "eth0"}, Forward, true},
+		{IPHeaderFilter{OutputInterface: "eth0"}, Output, true},
+		{IPHeaderFilter{OutputInterface: "eth0"}, Postrouting, true},
+		{IPHeaderFilter{}, Output, true},
+	} {
+		if got := tc.filter.ValidForHook(tc.hook); got != tc.want {
+			t.Errorf("%+v.ValidForHook(%v) = %t, want %t", tc.filter, tc.hook, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"fmt"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// LogLevel is a syslog level, as set by iptables' --log-level.
+type LogLevel uint8
+
+// Syslog levels, as defined by include/linux/kern_levels.h.
+const (
+	LogLevelEmergency LogLevel = iota
+	LogLevelAlert
+	LogLevelCritical
+	LogLevelError
+	LogLevelWarning
+	LogLevelNotice
+	LogLevelInfo
+	LogLevelDebug
+)
+
+// DefaultLogLevel is the level of LOG rules that don't set one, as in
+// iptables.
+const DefaultLogLevel = LogLevelWarning
+
+// LogTarget logs the packets it acts on, then lets them continue to the next
+// rule, like Linux's LOG target. Packets aren't modified.
+type LogTarget struct {
+	// Prefix starts each entry, as set by iptables' --log-prefix.
+	Prefix string
+
+	// Level is the level of the entries.
+	Level LogLevel
+}
+
+// Action implements Target.Action. The packet is logged by IPTables.Check,
+// which knows the hook it is checked at, except when it is evaluated by
+// CheckDryRun.
+func (LogTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleContinue, ""
+}
+
+// A LogEntry describes a packet that reached a LogTarget.
+type LogEntry struct {
+	// Prefix and Level are those of the LogTarget.
+	Prefix string
+	Level  LogLevel
+
+	// Hook is the hook the packet was checked at.
+	Hook Hook
+
+	// Protocol, SrcAddr, DstAddr, SrcPort and DstPort are the 5-tuple of the
+	// packet. The ports are only set for TCP and UDP packets holding a whole
+	// transport header.
+	Protocol tcpip.TransportProtocolNumber
+	SrcAddr  tcpip.Address
+	DstAddr  tcpip.Address
+	SrcPort  uint16
+	DstPort  uint16
+
+	// Verdict is the verdict of the rule. LogTargets always let packets
+	// continue to the next rule.
+	Verdict RuleVerdict
+}
+
+// String formats e like the kernel log lines of Linux's LOG target, e.g.
+// "prefix HOOK=INPUT SRC=10.0.0.1 DST=10.0.0.2 PROTO=UDP SPT=53 DPT=1024".
+func (e LogEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sHOOK=%s SRC=%s DST=%s PROTO=%s", e.Prefix, hookChainName(e.Hook), e.SrcAddr, e.DstAddr, strings.ToUpper(protocolName(e.Protocol)))
+	switch e.Protocol {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+		fmt.Fprintf(&b, " SPT=%d DPT=%d", e.SrcPort, e.DstPort)
+	}
+	return b.String()
+}
+
+// newLogEntry returns the entry logged by target for pkt at hook.
+//
+// Precondition: pkt.NetworkHeader is set.
+func newLogEntry(target LogTarget, hook Hook, pkt tcpip.PacketBuffer) LogEntry {
+	src, dst := packetAddresses(pkt)
+	e := LogEntry{
+		Prefix:   target.Prefix,
+		Level:    target.Level,
+		Hook:     hook,
+		Protocol: packetTransportProtocol(pkt),
+		SrcAddr:  src,
+		DstAddr:  dst,
+		Verdict:  RuleContinue,
+	}
+	// Both headers start with the ports.
+	var buf [header.UDPMinimumSize]byte
+	switch payload := PeekTransportHeader(pkt, len(buf), buf[:]); e.Protocol {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber:
+		if len(payload) == header.UDPMinimumSize {
+			udp := header.UDP(payload)
+			e.SrcPort = udp.SourcePort()
+			e.DstPort = udp.DestinationPort()
+		}
+	}
+	return e
+}
+
+// logPacket logs pkt, which reached target at hook, by passing it to
+// it.LogCallback if set, or to the sentry log otherwise.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (it *IPTables) logPacket(target LogTarget, hook Hook, pkt tcpip.PacketBuffer) {
+	e := newLogEntry(target, hook, pkt)
+	if it.LogCallback != nil {
+		it.LogCallback(e)
+		return
+	}
+	switch {
+	case e.Level <= LogLevelWarning:
+		log.Warningf("iptables: %s", e)
+	case e.Level <= LogLevelInfo:
+		log.Infof("iptables: %s", e)
+	default:
+		log.Debugf("iptables: %s", e)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// logTables returns tables holding only a filter table, whose INPUT chain logs
+// TCP and UDP packets with different prefixes, then drops UDP packets. Logged
+// entries are appended to the returned slice.
+func logTables() (IPTables, *[]LogEntry) {
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+			Target: LogTarget{Prefix: "tcp: ", Level: LogLevelInfo},
+		},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: LogTarget{Prefix: "udp: ", Level: DefaultLogLevel},
+		},
+		Rule{
+			Filter: IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+			Target: DropTarget{},
+		},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 3
+	filter.BuiltinChains[Output] = 3
+	filter.Underflows[Input] = 3
+	filter.Underflows[Forward] = 3
+	filter.Underflows[Output] = 3
+
+	var entries []LogEntry
+	ipt := IPTables{
+		Tables: map[string]Table{
+			TablenameFilter: filter,
+		},
+		Priorities: map[Hook][]string{
+			Input: []string{TablenameFilter},
+		},
+		LogCallback: func(e LogEntry) {
+			entries = append(entries, e)
+		},
+	}
+	ipt.InitCounters()
+	return ipt, &entries
+}
+
+func TestLogTarget(t *testing.T) {
+	ipt, entries := logTables()
+
+	// Logging doesn't affect the verdict: UDP packets reach the DROP rule
+	// after the LOG rule.
+	udp := udpPacket(1024)
+	if ipt.Check(Input, &udp, "") {
+		t.Errorf("Check(UDP) = true, want false")
+	}
+	tcp := tcpPacket(false /* reply */, header.TCPFlagSyn)
+	if !ipt.Check(Input, &tcp, "") {
+		t.Errorf("Check(TCP) = false, want true")
+	}
+	icmp := icmpEchoPacket(header.ICMPv4Echo, clientAddr, serverAddr)
+	if !ipt.Check(Input, &icmp, "") {
+		t.Errorf("Check(ICMP) = false, want true")
+	}
+
+	want := []LogEntry{
+		{
+			Prefix:   "udp: ",
+			Level:    LogLevelWarning,
+			Hook:     Input,
+			Protocol: header.UDPProtocolNumber,
+			SrcAddr:  clientAddr,
+			DstAddr:  serverAddr,
+			SrcPort:  1024,
+			DstPort:  53,
+			Verdict:  RuleContinue,
+		},
+		{
+			Prefix:   "tcp: ",
+			Level:    LogLevelInfo,
+			Hook:     Input,
+			Protocol: header.TCPProtocolNumber,
+			SrcAddr:  clientAddr,
+			DstAddr:  serverAddr,
+			SrcPort:  1234,
+			DstPort:  80,
+			Verdict:  RuleContinue,
+		},
+	}
+	if diff := cmp.Diff(want, *entries); diff != "" {
+		t.Errorf("logged entries mismatch (-want +got):\n%s", diff)
+	}
+	if len(*entries) != 0 {
+		if got, want := (*entries)[0].String(), "udp: HOOK=INPUT SRC=10.0.0.1 DST=10.0.0.2 PROTO=UDP SPT=1024 DPT=53"; got != want {
+			t.Errorf("entry.String() = %q, want %q", got, want)
+		}
+	}
+
+	// Dry runs don't log packets.
+	*entries = nil
+	if accepted, _ := ipt.CheckDryRun(Input, PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1024,
+		DstPort:  53,
+	}); accepted {
+		t.Errorf("CheckDryRun(UDP) = true, want false")
+	}
+	if len(*entries) != 0 {
+		t.Errorf("CheckDryRun() logged %v, want no entries", *entries)
+	}
+}
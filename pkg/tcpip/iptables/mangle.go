@@ -0,0 +1,110 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// ChecksumFillTarget computes the transport checksum of packets whose checksum
+// was left to the link endpoint. It is used in the mangle table for peers that
+// can't handle checksum offload, like Linux's "-j CHECKSUM --checksum-fill".
+type ChecksumFillTarget struct{}
+
+// Action implements Target.Action.
+func (ChecksumFillTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleContinue, ""
+}
+
+// Mangle implements Mangler.Mangle.
+func (ChecksumFillTarget) Mangle(pkt *tcpip.PacketBuffer) {
+	// Only outbound packets have a pending checksum, and their transport
+	// header is always set.
+	if !pkt.ChecksumPending || pkt.TransportHeader == nil {
+		return
+	}
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	payloadLen := int(ipHdr.TotalLength()) - len(pkt.NetworkHeader) - len(pkt.TransportHeader)
+	proto := ipHdr.TransportProtocol()
+	xsum := header.PseudoHeaderChecksum(proto, ipHdr.SourceAddress(), ipHdr.DestinationAddress(), uint16(len(pkt.TransportHeader)+payloadLen))
+	xsum = header.ChecksumVVWithOffset(pkt.Data, xsum, pkt.DataOffset, payloadLen)
+
+	switch proto {
+	case header.TCPProtocolNumber:
+		tcpHdr := header.TCP(pkt.TransportHeader)
+		tcpHdr.SetChecksum(0)
+		tcpHdr.SetChecksum(^tcpHdr.CalculateChecksum(xsum))
+	case header.UDPProtocolNumber:
+		udpHdr := header.UDP(pkt.TransportHeader)
+		udpHdr.SetChecksum(0)
+		// A zero UDP checksum means none was computed, so it's sent as all
+		// ones instead (RFC 768).
+		udpXsum := ^udpHdr.CalculateChecksum(xsum)
+		if udpXsum == 0 {
+			udpXsum = 0xffff
+		}
+		udpHdr.SetChecksum(udpXsum)
+	default:
+		return
+	}
+	pkt.ChecksumPending = false
+}
+
+// ECNTarget modifies the ECN bits of packets, like Linux's "-j ECN".
+type ECNTarget struct {
+	// RemoveTCP clears the ECE and CWR flags of TCP segments, so that ECN
+	// isn't negotiated with peers that mishandle it.
+	RemoveTCP bool
+}
+
+// Action implements Target.Action.
+func (ECNTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleContinue, ""
+}
+
+// Mangle implements Mangler.Mangle.
+func (et ECNTarget) Mangle(pkt *tcpip.PacketBuffer) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	if !et.RemoveTCP || ipHdr.TransportProtocol() != header.TCPProtocolNumber || ipHdr.FragmentOffset() != 0 {
+		return
+	}
+
+	// The flags and checksum are in the fixed part of the header.
+	var buf [header.TCPMinimumSize]byte
+	tcpHdr := header.TCP(PeekTransportHeader(*pkt, len(buf), buf[:]))
+	if len(tcpHdr) < header.TCPMinimumSize {
+		return
+	}
+	const ecnFlags = header.TCPFlagEce | header.TCPFlagCwr
+	if tcpHdr.Flags()&ecnFlags == 0 {
+		return
+	}
+
+	tcpHdr = header.TCP(writableTransportHeader(pkt, header.TCPMinimumSize))
+
+	// The flags share a 16-bit word with the data offset, which is used to
+	// update the checksum incrementally (RFC 1624).
+	oldWord := uint16(tcpHdr[header.TCPDataOffset])<<8 | uint16(tcpHdr[header.TCPFlagsOffset])
+	tcpHdr[header.TCPFlagsOffset] &^= ecnFlags
+	if pkt.ChecksumPending {
+		return
+	}
+	newWord := uint16(tcpHdr[header.TCPDataOffset])<<8 | uint16(tcpHdr[header.TCPFlagsOffset])
+	xsum := ^tcpHdr.Checksum()
+	xsum = header.ChecksumCombine(xsum, ^oldWord)
+	xsum = header.ChecksumCombine(xsum, newWord)
+	tcpHdr.SetChecksum(^xsum)
+}
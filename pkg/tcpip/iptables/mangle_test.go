@@ -0,0 +1,212 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// mangleTables returns the default tables with target followed by ACCEPT in
+// the mangle table's PREROUTING and OUTPUT chains.
+func mangleTables(target Target) IPTables {
+	ipt := DefaultTables()
+	ipt.Tables[TablenameMangle] = Table{
+		Rules: []Rule{
+			Rule{Target: target},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: target},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: ErrorTarget{}},
+		},
+		BuiltinChains: map[Hook]int{
+			Prerouting: 0,
+			Output:     2,
+		},
+		Underflows: map[Hook]int{
+			Prerouting: 1,
+			Output:     3,
+		},
+		UserChains: map[string]int{},
+	}
+	ipt.InitCounters()
+	return ipt
+}
+
+// pendingPacket returns an outbound packet for proto carrying payloadLen
+// bytes of data, whose transport checksum is left to the link endpoint.
+func pendingPacket(proto tcpip.TransportProtocolNumber, payloadLen int) tcpip.PacketBuffer {
+	pkt := PacketSpec{
+		Protocol: proto,
+		SrcAddr:  "\x0a\x00\x00\x01",
+		DstAddr:  "\x0a\x00\x00\x02",
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagAck | header.TCPFlagPsh,
+	}.packet()
+	ip := header.IPv4(pkt.NetworkHeader)
+	ip.SetTotalLength(uint16(len(pkt.NetworkHeader) + len(pkt.TransportHeader) + payloadLen))
+	if proto == header.UDPProtocolNumber {
+		header.UDP(pkt.TransportHeader).Encode(&header.UDPFields{
+			SrcPort: 1234,
+			DstPort: 80,
+			Length:  uint16(len(pkt.TransportHeader) + payloadLen),
+		})
+	}
+	pkt.Data = buffer.View(bytes.Repeat([]byte{0xaa}, payloadLen)).ToVectorisedView()
+	pkt.ChecksumPending = true
+	return pkt
+}
+
+// transportChecksumValid returns whether the transport checksum of pkt, as
+// laid out by pendingPacket, is valid.
+func transportChecksumValid(pkt tcpip.PacketBuffer) bool {
+	ip := header.IPv4(pkt.NetworkHeader)
+	length := uint16(len(pkt.TransportHeader) + pkt.Data.Size())
+	xsum := header.PseudoHeaderChecksum(ip.TransportProtocol(), ip.SourceAddress(), ip.DestinationAddress(), length)
+	xsum = header.ChecksumVV(pkt.Data, xsum)
+	return header.Checksum(pkt.TransportHeader, xsum) == 0xffff
+}
+
+func TestChecksumFill(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		proto tcpip.TransportProtocolNumber
+	}{
+		{name: "TCP", proto: header.TCPProtocolNumber},
+		{name: "UDP", proto: header.UDPProtocolNumber},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ipt := mangleTables(ChecksumFillTarget{})
+			pkt := pendingPacket(tc.proto, 100)
+			if transportChecksumValid(pkt) {
+				t.Fatalf("checksum of pending packet is already valid")
+			}
+			if !ipt.Check(Output, &pkt, "") {
+				t.Fatalf("Check(Output) = false, want true")
+			}
+			if !transportChecksumValid(pkt) {
+				t.Errorf("checksum after CHECKSUM --checksum-fill is invalid")
+			}
+			if pkt.ChecksumPending {
+				t.Errorf("ChecksumPending = true after CHECKSUM --checksum-fill, want false")
+			}
+		})
+	}
+}
+
+func TestChecksumFillIgnoresComputedChecksum(t *testing.T) {
+	ipt := mangleTables(ChecksumFillTarget{})
+	pkt := pendingPacket(header.UDPProtocolNumber, 10)
+	pkt.ChecksumPending = false
+	header.UDP(pkt.TransportHeader).SetChecksum(0x1234)
+	if !ipt.Check(Output, &pkt, "") {
+		t.Fatalf("Check(Output) = false, want true")
+	}
+	if got, want := header.UDP(pkt.TransportHeader).Checksum(), uint16(0x1234); got != want {
+		t.Errorf("got checksum %#x, want %#x", got, want)
+	}
+}
+
+func TestChecksumFillDryRun(t *testing.T) {
+	ipt := mangleTables(ChecksumFillTarget{})
+	if ok, _ := ipt.CheckDryRun(Output, PacketSpec{Protocol: header.UDPProtocolNumber}); !ok {
+		t.Errorf("CheckDryRun(Output) = false, want true")
+	}
+}
+
+func TestECNRemoveTCP(t *testing.T) {
+	const ecnFlags = header.TCPFlagEce | header.TCPFlagCwr
+	for _, tc := range []struct {
+		name     string
+		hook     Hook
+		inbound  bool
+		pending  bool
+		flags    uint8
+		wantFlag uint8
+	}{
+		{
+			name:     "outbound SYN",
+			hook:     Output,
+			flags:    header.TCPFlagSyn | ecnFlags,
+			wantFlag: header.TCPFlagSyn,
+		},
+		{
+			name:     "outbound with pending checksum",
+			hook:     Output,
+			pending:  true,
+			flags:    header.TCPFlagSyn | ecnFlags,
+			wantFlag: header.TCPFlagSyn,
+		},
+		{
+			name:     "inbound SYN-ACK",
+			hook:     Prerouting,
+			inbound:  true,
+			flags:    header.TCPFlagSyn | header.TCPFlagAck | header.TCPFlagEce,
+			wantFlag: header.TCPFlagSyn | header.TCPFlagAck,
+		},
+		{
+			name:     "without ECN",
+			hook:     Output,
+			flags:    header.TCPFlagAck,
+			wantFlag: header.TCPFlagAck,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ipt := mangleTables(ECNTarget{RemoveTCP: true})
+			pkt := pendingPacket(header.TCPProtocolNumber, 20)
+			tcp := header.TCP(pkt.TransportHeader)
+			tcp[header.TCPFlagsOffset] = tc.flags
+			if !tc.pending {
+				(ChecksumFillTarget{}).Mangle(&pkt)
+			}
+			var orig buffer.View
+			if tc.inbound {
+				orig = append(orig, pkt.TransportHeader...)
+				orig = append(orig, pkt.Data.ToView()...)
+				pkt.Data = orig.ToVectorisedView()
+				pkt.TransportHeader = nil
+			}
+
+			if !ipt.Check(tc.hook, &pkt, "") {
+				t.Fatalf("Check = false, want true")
+			}
+
+			if tc.inbound {
+				if got := header.TCP(orig).Flags(); got != tc.flags {
+					t.Errorf("got flags %#x in the original inbound data, want %#x", got, tc.flags)
+				}
+				data := pkt.Data.ToView()
+				pkt.TransportHeader = data[:header.TCPMinimumSize]
+				pkt.Data = data[header.TCPMinimumSize:].ToVectorisedView()
+			}
+			tcp = header.TCP(pkt.TransportHeader)
+			if got := tcp.Flags(); got != tc.wantFlag {
+				t.Errorf("got flags %#x, want %#x", got, tc.wantFlag)
+			}
+			if tc.pending {
+				if got := tcp.Checksum(); got != 0 {
+					t.Errorf("got checksum %#x for pending packet, want 0", got)
+				}
+			} else if !transportChecksumValid(pkt) {
+				t.Errorf("checksum after ECN --ecn-tcp-remove is invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// loopbackAddr is the address RedirectTarget sends locally generated packets
+// to.
+const loopbackAddr = tcpip.Address("\x7f\x00\x00\x01")
+
+// DNATTarget translates the destination of connections, like Linux's
+// "-j DNAT". It applies to the first packet of a connection tracked by
+// IPTables.ConnTrack, at the Prerouting and Output hooks, and accepts it. The
+// later packets of the connection are translated when they're tracked, and
+// the source of its replies is translated back to the original destination,
+// so that neither end sees the translation.
+//
+// Like Linux, locally generated packets whose destination is translated to a
+// local address at the Output hook are rerouted to the local host. Unlike
+// Linux, those translated to a remote address aren't rerouted: they leave
+// through the route chosen for their original destination.
+//
+// Packets that aren't tracked, such as the ones marked with NoTrack or whose
+// transport header is truncated, are accepted unchanged.
+type DNATTarget struct {
+	// Addr is the new destination address. If it is empty, the address
+	// isn't translated.
+	Addr tcpip.Address
+
+	// Port is the new destination port of TCP and UDP connections. If it is
+	// 0, the port isn't translated.
+	Port uint16
+}
+
+// Action implements Target.Action. The packet is translated by IPTables.Check,
+// which knows the hook it is checked at.
+func (DNATTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleAccept, ""
+}
+
+// destination implements destinationTarget.destination.
+func (dt DNATTarget) destination(hook Hook, tuple ConnTuple) (tcpip.Address, uint16) {
+	addr, port := tuple.DstAddr, tuple.DstPort
+	if dt.Addr != "" {
+		addr = dt.Addr
+	}
+	if dt.Port != 0 {
+		port = dt.Port
+	}
+	return addr, port
+}
+
+// RedirectTarget redirects connections to the local host, like Linux's
+// "-j REDIRECT". It is a DNATTarget whose address is 127.0.0.1 for locally
+// generated packets, at the Output hook. Unlike Linux, which uses the primary
+// address of the interface packets arrive on, the destination address of
+// incoming packets is kept at the Prerouting hook: it is already local, since
+// packets aren't forwarded.
+type RedirectTarget struct {
+	// Port is the new destination port of TCP and UDP connections. If it is
+	// 0, the port isn't translated.
+	Port uint16
+}
+
+// Action implements Target.Action. The packet is translated by IPTables.Check,
+// which knows the hook it is checked at.
+func (RedirectTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleAccept, ""
+}
+
+// destination implements destinationTarget.destination.
+func (rt RedirectTarget) destination(hook Hook, tuple ConnTuple) (tcpip.Address, uint16) {
+	dt := DNATTarget{Port: rt.Port}
+	if hook == Output {
+		dt.Addr = loopbackAddr
+	}
+	return dt.destination(hook, tuple)
+}
+
+// destinationTarget is implemented by the targets that translate the
+// destination of connections.
+type destinationTarget interface {
+	Target
+
+	// destination returns the new destination of the connection started by
+	// a packet with tuple, checked at hook.
+	destination(hook Hook, tuple ConnTuple) (tcpip.Address, uint16)
+}
+
+// translateDestination translates the destination of the connection started
+// by pkt to the one chosen by target, and rewrites pkt accordingly. It returns
+// false if pkt should be dropped because the translated connection would clash
+// with another tracked one.
+//
+// Like in Linux, destinations are only translated before routing, at the
+// Prerouting and Output hooks, and only for tracked connections.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (it *IPTables) translateDestination(hook Hook, pkt *tcpip.PacketBuffer, target destinationTarget) bool {
+	if it.ConnTrack == nil || (hook != Prerouting && hook != Output) {
+		return true
+	}
+	tuple, _, ok := packetTuple(*pkt)
+	if !ok {
+		return true
+	}
+	addr, port := target.destination(hook, tuple)
+	bound, ok := it.ConnTrack.bindDestination(tuple, addr, port)
+	if bound {
+		rewriteAddress(pkt, false /* src */, addr, port)
+	}
+	return ok
+}
+
+// previewDestination is like translateDestination, but doesn't change
+// it.ConnTrack. Dry runs use it to rewrite their own packets.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (it *IPTables) previewDestination(hook Hook, pkt *tcpip.PacketBuffer, target destinationTarget) bool {
+	if it.ConnTrack == nil || (hook != Prerouting && hook != Output) {
+		return true
+	}
+	tuple, tcpFlags, ok := packetTuple(*pkt)
+	if !ok {
+		return true
+	}
+	addr, port := target.destination(hook, tuple)
+	bound, ok := it.ConnTrack.previewDestination(tuple, tcpFlags, addr, port)
+	if bound {
+		rewriteAddress(pkt, false /* src */, addr, port)
+	}
+	return ok
+}
+
+// rewriteAddress rewrites the source of pkt if src is true, or its destination
+// otherwise, to addr and, for TCP and UDP, port. The checksums of the IPv4
+// header and of TCP and UDP headers are updated.
+//
+// pkt is left unchanged if it isn't the first fragment of its datagram, or if
+// its TCP or UDP header is truncated.
+//
+// Precondition: pkt.NetworkHeader is set.
+func rewriteAddress(pkt *tcpip.PacketBuffer, src bool, addr tcpip.Address, port uint16) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	if ipHdr.FragmentOffset() != 0 {
+		return
+	}
+
+	// The ports are in the fixed part of the header, along with the
+	// checksum.
+	proto := ipHdr.TransportProtocol()
+	var transport []byte
+	switch proto {
+	case header.TCPProtocolNumber:
+		if transport = writableTransportHeader(pkt, header.TCPMinimumSize); transport == nil {
+			return
+		}
+	case header.UDPProtocolNumber:
+		if transport = writableTransportHeader(pkt, header.UDPMinimumSize); transport == nil {
+			return
+		}
+	}
+
+	if pkt.TransportHeader == nil {
+		// The network header of inbound packets shares the immutable
+		// bytes backing Data, so it is replaced with a copy.
+		pkt.NetworkHeader = append([]byte(nil), pkt.NetworkHeader...)
+		ipHdr = header.IPv4(pkt.NetworkHeader)
+	}
+	var oldAddr tcpip.Address
+	if src {
+		oldAddr = ipHdr.SourceAddress()
+		ipHdr.SetSourceAddress(addr)
+	} else {
+		oldAddr = ipHdr.DestinationAddress()
+		ipHdr.SetDestinationAddress(addr)
+	}
+	ipHdr.SetChecksum(0)
+	ipHdr.SetChecksum(^ipHdr.CalculateChecksum())
+
+	// The transport checksums cover the addresses through the
+	// pseudo-header, and are updated incrementally (RFC 1624). Pending
+	// checksums are computed later from the rewritten headers.
+	switch proto {
+	case header.TCPProtocolNumber:
+		tcpHdr := header.TCP(transport)
+		var oldPort uint16
+		if src {
+			oldPort = tcpHdr.SourcePort()
+			tcpHdr.SetSourcePort(port)
+		} else {
+			oldPort = tcpHdr.DestinationPort()
+			tcpHdr.SetDestinationPort(port)
+		}
+		if !pkt.ChecksumPending {
+			tcpHdr.SetChecksum(updateChecksum(tcpHdr.Checksum(), oldAddr, addr, oldPort, port))
+		}
+	case header.UDPProtocolNumber:
+		udpHdr := header.UDP(transport)
+		var oldPort uint16
+		if src {
+			oldPort = udpHdr.SourcePort()
+			udpHdr.SetSourcePort(port)
+		} else {
+			oldPort = udpHdr.DestinationPort()
+			udpHdr.SetDestinationPort(port)
+		}
+		// A zero checksum means that the sender didn't compute one.
+		if pkt.ChecksumPending || udpHdr.Checksum() == 0 {
+			return
+		}
+		// A computed checksum of zero is sent as all ones instead
+		// (RFC 768).
+		xsum := updateChecksum(udpHdr.Checksum(), oldAddr, addr, oldPort, port)
+		if xsum == 0 {
+			xsum = 0xffff
+		}
+		udpHdr.SetChecksum(xsum)
+	}
+}
+
+// updateChecksum returns xsum, a checksum covering oldAddr and oldPort,
+// updated for their replacement with addr and port.
+func updateChecksum(xsum uint16, oldAddr, addr tcpip.Address, oldPort, port uint16) uint16 {
+	sum := ^xsum
+	sum = header.ChecksumCombine(sum, ^header.Checksum([]byte(oldAddr), 0))
+	sum = header.ChecksumCombine(sum, header.Checksum([]byte(addr), 0))
+	sum = header.ChecksumCombine(sum, ^oldPort)
+	sum = header.ChecksumCombine(sum, port)
+	return ^sum
+}
@@ -0,0 +1,368 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// otherServerAddr is the address connections are translated to.
+const otherServerAddr = tcpip.Address("\x0a\x00\x00\x03")
+
+// udpPacketSpec describes a UDP datagram from the client's port 1024 to the
+// server's port 53.
+func udpPacketSpec() PacketSpec {
+	return PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1024,
+		DstPort:  53,
+	}
+}
+
+// natTables returns the default tables with target in the nat table's
+// PREROUTING and OUTPUT chains, and a connection tracking table.
+func natTables(target Target) IPTables {
+	ipt := DefaultTables()
+	ipt.Tables[TablenameNat] = Table{
+		Rules: []Rule{
+			Rule{Target: target},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: target},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: ErrorTarget{}},
+		},
+		BuiltinChains: map[Hook]int{
+			Prerouting: 0,
+			Output:     2,
+		},
+		Underflows: map[Hook]int{
+			Prerouting: 1,
+			Output:     3,
+		},
+		UserChains: map[string]int{},
+	}
+	ipt.ConnTrack = NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 0)
+	ipt.InitCounters()
+	return ipt
+}
+
+// outboundPacket returns a packet matching spec with valid checksums, laid out
+// as at the Output hook.
+func outboundPacket(spec PacketSpec) tcpip.PacketBuffer {
+	pkt := spec.packet()
+	ip := header.IPv4(pkt.NetworkHeader)
+	ip.SetChecksum(^ip.CalculateChecksum())
+	xsum := header.PseudoHeaderChecksum(spec.Protocol, spec.SrcAddr, spec.DstAddr, uint16(len(pkt.TransportHeader)))
+	switch spec.Protocol {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(pkt.TransportHeader)
+		tcp.SetChecksum(^tcp.CalculateChecksum(xsum))
+	case header.UDPProtocolNumber:
+		udp := header.UDP(pkt.TransportHeader)
+		udp.SetChecksum(^udp.CalculateChecksum(xsum))
+	}
+	return pkt
+}
+
+// wirePacket returns the bytes of a packet matching spec with valid
+// checksums.
+func wirePacket(spec PacketSpec) buffer.View {
+	return outboundPacket(spec).Data.ToView()
+}
+
+// transportHeader returns the transport header of pkt, laid out by
+// outboundPacket or inboundPacket, which is the whole payload.
+func transportHeader(pkt tcpip.PacketBuffer) buffer.View {
+	if pkt.TransportHeader != nil {
+		return pkt.TransportHeader
+	}
+	return pkt.Data.ToView()
+}
+
+// checkPacket checks the addresses, ports and checksums of pkt, a TCP or UDP
+// packet laid out by outboundPacket or inboundPacket.
+func checkPacket(t *testing.T, pkt tcpip.PacketBuffer, srcAddr, dstAddr tcpip.Address, srcPort, dstPort uint16) {
+	t.Helper()
+	ip := header.IPv4(pkt.NetworkHeader)
+	if got := ip.SourceAddress(); got != srcAddr {
+		t.Errorf("got source address %s, want %s", got, srcAddr)
+	}
+	if got := ip.DestinationAddress(); got != dstAddr {
+		t.Errorf("got destination address %s, want %s", got, dstAddr)
+	}
+	if got := ip.CalculateChecksum(); got != 0xffff {
+		t.Errorf("IPv4 checksum is invalid, sums to %#x", got)
+	}
+
+	transport := transportHeader(pkt)
+	var gotSrcPort, gotDstPort uint16
+	switch ip.TransportProtocol() {
+	case header.TCPProtocolNumber:
+		tcp := header.TCP(transport)
+		gotSrcPort, gotDstPort = tcp.SourcePort(), tcp.DestinationPort()
+	case header.UDPProtocolNumber:
+		udp := header.UDP(transport)
+		gotSrcPort, gotDstPort = udp.SourcePort(), udp.DestinationPort()
+	}
+	if gotSrcPort != srcPort || gotDstPort != dstPort {
+		t.Errorf("got ports %d -> %d, want %d -> %d", gotSrcPort, gotDstPort, srcPort, dstPort)
+	}
+	xsum := header.PseudoHeaderChecksum(ip.TransportProtocol(), ip.SourceAddress(), ip.DestinationAddress(), uint16(len(transport)))
+	if got := header.Checksum(transport, xsum); got != 0xffff {
+		t.Errorf("transport checksum is invalid, sums to %#x", got)
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	ipt := natTables(RedirectTarget{Port: 8080})
+	spec := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagSyn,
+	}
+
+	// The SYN is redirected without modifying the bytes it was received in.
+	wire := wirePacket(spec)
+	wireCopy := append(buffer.View(nil), wire...)
+	syn := inboundPacket(wire)
+	if !ipt.Check(Prerouting, &syn, "") {
+		t.Fatalf("Check(Prerouting, SYN) = false, want true")
+	}
+	checkPacket(t, syn, clientAddr, serverAddr, 1234, 8080)
+	if !bytes.Equal(wire, wireCopy) {
+		t.Errorf("received bytes were modified")
+	}
+
+	// The reply appears to come from the original port.
+	replySpec := PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  serverAddr,
+		DstAddr:  clientAddr,
+		SrcPort:  8080,
+		DstPort:  1234,
+		TCPFlags: header.TCPFlagSyn | header.TCPFlagAck,
+	}
+	synAck := outboundPacket(replySpec)
+	if !ipt.Check(Output, &synAck, "") {
+		t.Fatalf("Check(Output, SYN-ACK) = false, want true")
+	}
+	checkPacket(t, synAck, serverAddr, clientAddr, 80, 1234)
+
+	// Later segments are redirected by connection tracking, even if their
+	// header is split across views.
+	spec.TCPFlags = header.TCPFlagAck
+	ack := inboundPacket(wirePacket(spec), header.IPv4MinimumSize+3)
+	if !ipt.Check(Prerouting, &ack, "") {
+		t.Fatalf("Check(Prerouting, ACK) = false, want true")
+	}
+	checkPacket(t, ack, clientAddr, serverAddr, 1234, 8080)
+
+	entries := ipt.ConnTrack.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d tracked connections, want 1", len(entries))
+	}
+	if got, want := entries[0].Reply, (ConnTuple{Protocol: header.TCPProtocolNumber, SrcAddr: serverAddr, DstAddr: clientAddr, SrcPort: 8080, DstPort: 1234}); got != want {
+		t.Errorf("got reply tuple %+v, want %+v", got, want)
+	}
+	if got, want := entries[0].State, "ESTABLISHED"; got != want {
+		t.Errorf("got state %q, want %q", got, want)
+	}
+}
+
+func TestDNATTargetOutput(t *testing.T) {
+	ipt := natTables(DNATTarget{Addr: otherServerAddr, Port: 5353})
+
+	pkts := []tcpip.PacketBuffer{outboundPacket(udpPacketSpec())}
+	if verdicts := ipt.CheckBatch(Output, pkts, ""); !verdicts[0] {
+		t.Fatalf("CheckBatch(Output) = %v, want [true]", verdicts)
+	}
+	checkPacket(t, pkts[0], clientAddr, otherServerAddr, 1024, 5353)
+
+	reply := inboundPacket(wirePacket(PacketSpec{
+		Protocol: header.UDPProtocolNumber,
+		SrcAddr:  otherServerAddr,
+		DstAddr:  clientAddr,
+		SrcPort:  5353,
+		DstPort:  1024,
+	}))
+	if !ipt.Check(Prerouting, &reply, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	checkPacket(t, reply, serverAddr, clientAddr, 53, 1024)
+}
+
+func TestDNATTargetKeepsZeroUDPChecksum(t *testing.T) {
+	ipt := natTables(DNATTarget{Port: 5353})
+	pkt := inboundPacket(wirePacket(udpPacketSpec()))
+	// A zero checksum means that none was computed.
+	header.UDP(pkt.Data.First()).SetChecksum(0)
+	if !ipt.Check(Prerouting, &pkt, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	udp := header.UDP(pkt.Data.ToView())
+	if got := udp.DestinationPort(); got != 5353 {
+		t.Errorf("got destination port %d, want 5353", got)
+	}
+	if got := udp.Checksum(); got != 0 {
+		t.Errorf("got checksum %#x, want 0", got)
+	}
+}
+
+func TestDNATTargetIgnoresTruncatedPackets(t *testing.T) {
+	ipt := natTables(DNATTarget{Addr: otherServerAddr, Port: 8080})
+	pkt := inboundPacket(wirePacket(PacketSpec{
+		Protocol: header.TCPProtocolNumber,
+		SrcAddr:  clientAddr,
+		DstAddr:  serverAddr,
+		SrcPort:  1234,
+		DstPort:  80,
+		TCPFlags: header.TCPFlagSyn,
+	}))
+	pkt.Data.CapLength(header.TCPMinimumSize - 1)
+	if !ipt.Check(Prerouting, &pkt, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	if got := header.IPv4(pkt.NetworkHeader).DestinationAddress(); got != serverAddr {
+		t.Errorf("got destination address %s, want %s", got, serverAddr)
+	}
+	if got := header.TCP(pkt.Data.ToView()[:4]).DestinationPort(); got != 80 {
+		t.Errorf("got destination port %d, want 80", got)
+	}
+}
+
+func TestDNATTargetUntracked(t *testing.T) {
+	ipt := natTables(DNATTarget{Addr: otherServerAddr})
+	ipt.ConnTrack = nil
+	pkt := inboundPacket(wirePacket(udpPacketSpec()))
+	if !ipt.Check(Prerouting, &pkt, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	checkPacket(t, pkt, clientAddr, serverAddr, 1024, 53)
+}
+
+func TestDNATTargetDryRun(t *testing.T) {
+	ipt := natTables(DNATTarget{Addr: otherServerAddr})
+	accepted, steps := ipt.CheckDryRun(Prerouting, udpPacketSpec())
+	if !accepted {
+		t.Errorf("CheckDryRun() = false, want true")
+	}
+	if len(steps) == 0 || steps[len(steps)-1].Verdict != RuleAccept {
+		t.Errorf("CheckDryRun() steps = %+v, want a last step accepting the packet", steps)
+	}
+	if got := ipt.ConnTrack.Count(); got != 0 {
+		t.Errorf("Count() = %d, want 0", got)
+	}
+}
+
+// TestDNATTargetDryRunTranslates checks that dry runs translate their packets
+// like Check, both when the nat table binds the destination of a new
+// connection and for the later packets of a translated one, so that the
+// filter table sees the translated destination.
+func TestDNATTargetDryRunTranslates(t *testing.T) {
+	ipt := natTables(DNATTarget{Addr: otherServerAddr})
+	// OUTPUT drops packets sent to otherServerAddr.
+	ipt.Tables[TablenameFilter] = Table{
+		Rules: []Rule{
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: AcceptTarget{}},
+			Rule{
+				Filter: IPHeaderFilter{Dst: otherServerAddr, DstMask: "\xff\xff\xff\xff"},
+				Target: DropTarget{},
+			},
+			Rule{Target: AcceptTarget{}},
+			Rule{Target: ErrorTarget{}},
+		},
+		BuiltinChains: map[Hook]int{
+			Input:   0,
+			Forward: 1,
+			Output:  2,
+		},
+		Underflows: map[Hook]int{
+			Input:   0,
+			Forward: 1,
+			Output:  3,
+		},
+		UserChains: map[string]int{},
+	}
+	ipt.InitCounters()
+	spec := udpPacketSpec()
+	wantDrop := TraceStep{Table: TablenameFilter, Chain: ChainNameOutput, RuleIdx: 2, Verdict: RuleDrop}
+
+	// The nat table translates the first packet of the connection.
+	ok, steps := ipt.CheckDryRun(Output, spec)
+	if ok || len(steps) == 0 || steps[len(steps)-1] != wantDrop {
+		t.Errorf("CheckDryRun(Output) = %t, %+v for a new connection, want false with a last step %+v", ok, steps, wantDrop)
+	}
+	if got := ipt.ConnTrack.Count(); got != 0 {
+		t.Fatalf("Count() = %d after a dry run, want 0", got)
+	}
+
+	// The packet is dropped, but its connection is tracked and translated.
+	pkt := outboundPacket(spec)
+	if ipt.Check(Output, &pkt, "") {
+		t.Fatalf("Check(Output) = true, but CheckDryRun returned false")
+	}
+	entries := ipt.ConnTrack.Entries()
+	if len(entries) != 1 || entries[0].Reply.SrcAddr != otherServerAddr {
+		t.Fatalf("got entries %+v, want one connection translated to %s", entries, otherServerAddr)
+	}
+
+	// Connection tracking translates its later packets, which skip the nat
+	// table.
+	ok, steps = ipt.CheckDryRun(Output, spec)
+	if ok || len(steps) == 0 || steps[len(steps)-1] != wantDrop {
+		t.Errorf("CheckDryRun(Output) = %t, %+v for a translated connection, want false with a last step %+v", ok, steps, wantDrop)
+	}
+	for _, step := range steps {
+		if step.Table == TablenameNat {
+			t.Errorf("CheckDryRun(Output) steps = %+v, want the nat table skipped", steps)
+		}
+	}
+	if got := ipt.ConnTrack.Entries(); !reflect.DeepEqual(got, entries) {
+		t.Errorf("got entries %+v after a dry run, want %+v", got, entries)
+	}
+}
+
+func TestDescribeNATTargets(t *testing.T) {
+	for _, tc := range []struct {
+		target   Target
+		wantName string
+		wantOpts string
+	}{
+		{DNATTarget{Addr: otherServerAddr, Port: 8080}, "DNAT", "--to-destination 10.0.0.3:8080"},
+		{DNATTarget{Addr: otherServerAddr}, "DNAT", "--to-destination 10.0.0.3"},
+		{DNATTarget{Port: 8080}, "DNAT", "--to-destination :8080"},
+		{RedirectTarget{Port: 8080}, "REDIRECT", "--to-ports 8080"},
+		{RedirectTarget{}, "REDIRECT", ""},
+	} {
+		name, opts := describeTarget(tc.target)
+		if name != tc.wantName || opts != tc.wantOpts {
+			t.Errorf("describeTarget(%+v) = %q, %q, want %q, %q", tc.target, name, opts, tc.wantName, tc.wantOpts)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+)
+
+// PeekTransportHeader returns the first n bytes following pkt's network
+// header, or all of them if there are fewer, without consuming them.
+//
+// If pkt.TransportHeader is set, a prefix of it is returned. Otherwise the
+// bytes are read from pkt.Data, whose payload may be split across several
+// views at any offset by link endpoints that don't linearize packets. If the
+// first n bytes are in a single view, they are returned without copying.
+// Otherwise they are copied to buf, which should be at least n bytes long to
+// avoid allocating, and a prefix of buf is returned. Callers typically pass
+// a buffer on their stack.
+//
+// Unless they are a prefix of pkt.TransportHeader, the returned bytes must not
+// be modified.
+func PeekTransportHeader(pkt tcpip.PacketBuffer, n int, buf []byte) buffer.View {
+	if pkt.TransportHeader != nil {
+		if len(pkt.TransportHeader) > n {
+			return pkt.TransportHeader[:n]
+		}
+		return pkt.TransportHeader
+	}
+
+	if first := pkt.Data.First(); len(first) >= n || len(first) == pkt.Data.Size() {
+		if len(first) > n {
+			return first[:n]
+		}
+		return first
+	}
+
+	if len(buf) < n {
+		buf = make([]byte, n)
+	}
+	copied := 0
+	for _, v := range pkt.Data.Views() {
+		copied += copy(buf[copied:n], v)
+		if copied == n {
+			break
+		}
+	}
+	return buffer.View(buf[:copied])
+}
+
+// writableTransportHeader returns the first n bytes following pkt's network
+// header, which may be modified in place, or nil if there are fewer.
+//
+// If pkt.TransportHeader is set, a prefix of it is returned. Otherwise the
+// bytes backing pkt.Data are immutable, so its first n bytes are replaced with
+// a copy, which gets a view of its own since they may be split across views.
+func writableTransportHeader(pkt *tcpip.PacketBuffer, n int) buffer.View {
+	if pkt.TransportHeader != nil {
+		if len(pkt.TransportHeader) < n {
+			return nil
+		}
+		return pkt.TransportHeader[:n]
+	}
+	if pkt.Data.Size() < n {
+		return nil
+	}
+	hdr := append(buffer.View(nil), PeekTransportHeader(*pkt, n, nil)...)
+	rest := pkt.Data.Clone(nil)
+	rest.TrimFront(n)
+	pkt.Data = buffer.NewVectorisedView(pkt.Data.Size(), append([]buffer.View{hdr}, rest.Views()...))
+	return hdr
+}
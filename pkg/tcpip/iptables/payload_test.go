@@ -0,0 +1,348 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// splitVV returns a VectorisedView of copies of the bytes of v, split at
+// offsets. Repeated offsets yield empty views.
+func splitVV(v buffer.View, offsets ...int) buffer.VectorisedView {
+	var views []buffer.View
+	prev := 0
+	for _, off := range append(offsets, len(v)) {
+		views = append(views, append(buffer.View{}, v[prev:off]...))
+		prev = off
+	}
+	return buffer.NewVectorisedView(len(v), views)
+}
+
+func TestPeekTransportHeader(t *testing.T) {
+	data := buffer.View("0123456789")
+	for _, tc := range []struct {
+		name string
+		pkt  tcpip.PacketBuffer
+		n    int
+		want string
+		// copied is true if the bytes are expected to be copied to the
+		// buffer.
+		copied bool
+	}{
+		{
+			name: "linear",
+			pkt:  tcpip.PacketBuffer{Data: data.ToVectorisedView()},
+			n:    4,
+			want: "0123",
+		},
+		{
+			name:   "split",
+			pkt:    tcpip.PacketBuffer{Data: splitVV(data, 3)},
+			n:      4,
+			want:   "0123",
+			copied: true,
+		},
+		{
+			name: "in first view",
+			pkt:  tcpip.PacketBuffer{Data: splitVV(data, 3)},
+			n:    3,
+			want: "012",
+		},
+		{
+			name:   "split in many views",
+			pkt:    tcpip.PacketBuffer{Data: splitVV(data, 1, 2, 3, 4, 5, 6, 7, 8, 9)},
+			n:      10,
+			want:   "0123456789",
+			copied: true,
+		},
+		{
+			name:   "empty views",
+			pkt:    tcpip.PacketBuffer{Data: splitVV(data, 0, 2, 2, 4)},
+			n:      4,
+			want:   "0123",
+			copied: true,
+		},
+		{
+			name:   "short",
+			pkt:    tcpip.PacketBuffer{Data: splitVV(data[:4], 2)},
+			n:      8,
+			want:   "0123",
+			copied: true,
+		},
+		{
+			name: "short linear",
+			pkt:  tcpip.PacketBuffer{Data: data[:4].ToVectorisedView()},
+			n:    8,
+			want: "0123",
+		},
+		{
+			name: "empty",
+			n:    4,
+			want: "",
+		},
+		{
+			name: "transport header",
+			pkt: tcpip.PacketBuffer{
+				TransportHeader: data[:6],
+				Data:            data[6:].ToVectorisedView(),
+			},
+			n:    4,
+			want: "0123",
+		},
+		{
+			// Data isn't read when the transport header has been parsed.
+			name: "short transport header",
+			pkt: tcpip.PacketBuffer{
+				TransportHeader: data[:2],
+				Data:            data[2:].ToVectorisedView(),
+			},
+			n:    4,
+			want: "01",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf [16]byte
+			got := PeekTransportHeader(tc.pkt, tc.n, buf[:])
+			if string(got) != tc.want {
+				t.Errorf("PeekTransportHeader(..., %d, ...) = %q, want %q", tc.n, got, tc.want)
+			}
+			if copied := len(got) > 0 && &got[0] == &buf[0]; copied != tc.copied {
+				t.Errorf("PeekTransportHeader(..., %d, ...) copied to the buffer: %t, want %t", tc.n, copied, tc.copied)
+			}
+		})
+	}
+}
+
+func TestPeekTransportHeaderSmallBuffer(t *testing.T) {
+	pkt := tcpip.PacketBuffer{Data: splitVV(buffer.View("0123456789"), 5)}
+	var buf [2]byte
+	if got, want := string(PeekTransportHeader(pkt, 8, buf[:])), "01234567"; got != want {
+		t.Errorf("PeekTransportHeader(..., 8, 2-byte buffer) = %q, want %q", got, want)
+	}
+}
+
+var peekSink byte
+
+func TestPeekTransportHeaderAllocs(t *testing.T) {
+	pkt := tcpip.PacketBuffer{Data: splitVV(make(buffer.View, 40), 7, 15)}
+	if allocs := testing.AllocsPerRun(100, func() {
+		var buf [header.TCPMinimumSize]byte
+		peekSink = PeekTransportHeader(pkt, len(buf), buf[:])[0]
+	}); allocs != 0 {
+		t.Errorf("PeekTransportHeader of a split header allocated %v times per run, want 0", allocs)
+	}
+}
+
+// splitTestPackets returns the wire bytes of inbound IPv4 packets with
+// options, so that splits can fall in the IP options, the TCP options or the
+// payload.
+func splitTestPackets() map[string]buffer.View {
+	const ipHdrLen = header.IPv4MinimumSize + 4
+	ip := func(proto tcpip.TransportProtocolNumber, transport []byte) buffer.View {
+		pkt := make(buffer.View, ipHdrLen+len(transport))
+		header.IPv4(pkt).Encode(&header.IPv4Fields{
+			IHL:         ipHdrLen,
+			TotalLength: uint16(len(pkt)),
+			TTL:         64,
+			Protocol:    uint8(proto),
+			SrcAddr:     clientAddr,
+			DstAddr:     serverAddr,
+		})
+		// Pad the IP options with NOPs.
+		copy(pkt[header.IPv4MinimumSize:], []byte{1, 1, 1, 1})
+		header.IPv4(pkt).SetChecksum(^header.IPv4(pkt).CalculateChecksum())
+		copy(pkt[ipHdrLen:], transport)
+		return pkt
+	}
+
+	// A SYN with ECN, an MSS option padded with NOPs, and a payload.
+	const tcpHdrLen = header.TCPMinimumSize + 12
+	payload := []byte("hello")
+	tcp := header.TCP(make([]byte, tcpHdrLen+len(payload)))
+	tcp.Encode(&header.TCPFields{
+		SrcPort:    1234,
+		DstPort:    80,
+		SeqNum:     1000,
+		DataOffset: tcpHdrLen,
+		Flags:      header.TCPFlagSyn | header.TCPFlagEce | header.TCPFlagCwr,
+		WindowSize: 1024,
+	})
+	copy(tcp[header.TCPMinimumSize:], []byte{2, 4, 0x05, 0xb4, 1, 1, 1, 1, 1, 1, 1, 1})
+	copy(tcp[tcpHdrLen:], payload)
+	xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, clientAddr, serverAddr, uint16(len(tcp)))
+	tcp.SetChecksum(^tcp.CalculateChecksum(header.Checksum(payload, xsum)))
+
+	udp := header.UDP(make([]byte, header.UDPMinimumSize+8))
+	udp.Encode(&header.UDPFields{
+		SrcPort: 1234,
+		DstPort: 53,
+		Length:  uint16(len(udp)),
+	})
+	copy(udp[header.UDPMinimumSize:], "payload!")
+
+	icmp := header.ICMPv4(make([]byte, header.ICMPv4MinimumSize+4))
+	icmp.SetType(header.ICMPv4Echo)
+	icmp.SetIdent(7)
+	copy(icmp[header.ICMPv4MinimumSize:], "ping")
+
+	return map[string]buffer.View{
+		"TCP":  ip(header.TCPProtocolNumber, tcp),
+		"UDP":  ip(header.UDPProtocolNumber, udp),
+		"ICMP": ip(header.ICMPv4ProtocolNumber, icmp),
+	}
+}
+
+// inboundPacket returns the packet wire as it reaches iptables after being
+// received in views split at offsets: the network layer moves the IP header,
+// which it requires to be contiguous, to NetworkHeader, and leaves the rest of
+// the packet in Data.
+func inboundPacket(wire buffer.View, offsets ...int) tcpip.PacketBuffer {
+	hdrLen := int(header.IPv4(wire).HeaderLength())
+	data := splitVV(wire, offsets...)
+	data.TrimFront(hdrLen)
+	return tcpip.PacketBuffer{
+		NetworkHeader: append(buffer.View{}, wire[:hdrLen]...),
+		Data:          data,
+	}
+}
+
+// splitResult holds what the matchers and targets of this package make of a
+// packet.
+type splitResult struct {
+	tuple     ConnTuple
+	tcpFlags  uint8
+	tupleOK   bool
+	tracked   bool
+	icmpError string
+	reset     string
+	// mangled holds the packet's Data after ECN --ecn-tcp-remove.
+	mangled string
+}
+
+// checkSplit runs pkt through the matchers and targets of this package, and
+// returns their results. It fails t if pkt's original data is modified.
+func checkSplit(t *testing.T, pkt tcpip.PacketBuffer) splitResult {
+	t.Helper()
+	var r splitResult
+	r.tuple, r.tcpFlags, r.tupleOK = packetTuple(pkt)
+	r.tracked = NewConnTrack(faketime.NewManualClock(time.Unix(0, 0)), 1).HandlePacket(pkt)
+	if msg, ok := ICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable); ok {
+		r.icmpError = string(msg)
+	}
+	if rst, ok := TCPReset(pkt); ok {
+		r.reset = string(rst)
+	}
+
+	var orig [][]byte
+	for _, v := range pkt.Data.Views() {
+		orig = append(orig, append([]byte{}, v...))
+	}
+	ipt := mangleTables(ECNTarget{RemoveTCP: true})
+	mangled := pkt.Clone()
+	if !ipt.Check(Prerouting, &mangled, "") {
+		t.Fatalf("Check(Prerouting) = false, want true")
+	}
+	r.mangled = string(mangled.Data.ToView())
+	for i, v := range pkt.Data.Views() {
+		if !bytes.Equal(v, orig[i]) {
+			t.Fatalf("ECN --ecn-tcp-remove modified view %d of the original packet from %v to %v", i, orig[i], v)
+		}
+	}
+	return r
+}
+
+// checkSplits checks that splitting the packets of splitTestPackets at the
+// offsets returned by splits doesn't change how they are handled.
+func checkSplits(t *testing.T, splits func(wire buffer.View, yield func(offsets ...int))) {
+	for name, wire := range splitTestPackets() {
+		t.Run(name, func(t *testing.T) {
+			want := checkSplit(t, inboundPacket(wire))
+			// Sanity check the linear packet's results.
+			if !want.tupleOK || !want.tracked {
+				t.Fatalf("linear packet: packetTuple ok = %t, tracked = %t, want both true", want.tupleOK, want.tracked)
+			}
+			if want.icmpError == "" {
+				t.Fatalf("linear packet: no ICMP error built")
+			}
+			if name == "TCP" {
+				if want.reset == "" {
+					t.Fatalf("linear packet: no reset built")
+				}
+				if want.mangled == string(wire[header.IPv4(wire).HeaderLength():]) {
+					t.Fatalf("linear packet: ECN flags weren't removed")
+				}
+			}
+
+			splits(wire, func(offsets ...int) {
+				if got := checkSplit(t, inboundPacket(wire, offsets...)); got != want {
+					t.Fatalf("packet split at %v:\ngot  %+v\nwant %+v", offsets, got, want)
+				}
+			})
+		})
+	}
+}
+
+// TestSplitPayload splits packets in three views at every pair of offsets.
+func TestSplitPayload(t *testing.T) {
+	checkSplits(t, func(wire buffer.View, yield func(offsets ...int)) {
+		for i := 0; i <= len(wire); i++ {
+			for j := i; j <= len(wire); j++ {
+				yield(i, j)
+			}
+		}
+	})
+}
+
+// TestSplitPayloadRandom splits packets in many views at random offsets.
+func TestSplitPayloadRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	checkSplits(t, func(wire buffer.View, yield func(offsets ...int)) {
+		for i := 0; i < 1000; i++ {
+			offsets := make([]int, 1+rng.Intn(len(wire)))
+			for j := range offsets {
+				offsets[j] = rng.Intn(len(wire) + 1)
+			}
+			sort.Ints(offsets)
+			yield(offsets...)
+		}
+	})
+}
+
+// TestChecksumFillSplitPayload checks that CHECKSUM --checksum-fill covers
+// payloads split across views.
+func TestChecksumFillSplitPayload(t *testing.T) {
+	const payloadLen = 13
+	for _, proto := range []tcpip.TransportProtocolNumber{header.TCPProtocolNumber, header.UDPProtocolNumber} {
+		for i := 0; i <= payloadLen; i++ {
+			for j := i; j <= payloadLen; j++ {
+				pkt := pendingPacket(proto, payloadLen)
+				pkt.Data = splitVV(pkt.Data.ToView(), i, j)
+				(ChecksumFillTarget{}).Mangle(&pkt)
+				if !transportChecksumValid(pkt) {
+					t.Errorf("protocol %d: checksum of payload split at %d and %d is invalid", proto, i, j)
+				}
+			}
+		}
+	}
+}
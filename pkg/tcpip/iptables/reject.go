@@ -0,0 +1,193 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// RejectWith specifies the response RejectTarget sends to rejected packets.
+// The values correspond to enum ipt_reject_with in
+// include/uapi/linux/netfilter_ipv4/ipt_REJECT.h.
+type RejectWith int
+
+// Responses to rejected packets.
+const (
+	RejectWithICMPNetUnreachable RejectWith = iota
+	RejectWithICMPHostUnreachable
+	RejectWithICMPProtUnreachable
+	RejectWithICMPPortUnreachable
+	_ // IPT_ICMP_ECHOREPLY is unused by Linux.
+	RejectWithICMPNetProhibited
+	RejectWithICMPHostProhibited
+	RejectWithTCPReset
+	RejectWithICMPAdminProhibited
+)
+
+// icmpCode returns the ICMP destination unreachable code sent for with.
+func (with RejectWith) icmpCode() byte {
+	switch with {
+	case RejectWithICMPNetUnreachable:
+		return header.ICMPv4NetUnreachable
+	case RejectWithICMPHostUnreachable:
+		return header.ICMPv4HostUnreachable
+	case RejectWithICMPProtUnreachable:
+		return header.ICMPv4ProtoUnreachable
+	case RejectWithICMPNetProhibited:
+		return header.ICMPv4NetProhibited
+	case RejectWithICMPHostProhibited:
+		return header.ICMPv4HostProhibited
+	case RejectWithICMPAdminProhibited:
+		return header.ICMPv4AdminProhibited
+	default:
+		return header.ICMPv4PortUnreachable
+	}
+}
+
+// String returns the name iptables uses for with, as in
+// "--reject-with tcp-reset".
+func (with RejectWith) String() string {
+	switch with {
+	case RejectWithICMPNetUnreachable:
+		return "icmp-net-unreachable"
+	case RejectWithICMPHostUnreachable:
+		return "icmp-host-unreachable"
+	case RejectWithICMPProtUnreachable:
+		return "icmp-proto-unreachable"
+	case RejectWithICMPPortUnreachable:
+		return "icmp-port-unreachable"
+	case RejectWithICMPNetProhibited:
+		return "icmp-net-prohibited"
+	case RejectWithICMPHostProhibited:
+		return "icmp-host-prohibited"
+	case RejectWithTCPReset:
+		return "tcp-reset"
+	case RejectWithICMPAdminProhibited:
+		return "icmp-admin-prohibited"
+	default:
+		return fmt.Sprintf("%d", int(with))
+	}
+}
+
+// A Responder sends responses to packets on behalf of targets. It is
+// implemented by the network stack.
+type Responder interface {
+	// SendICMPv4Error sends an ICMPv4 error message of type typ and code,
+	// built by ICMPv4Error, to the source of pkt. It returns true if the
+	// message was sent.
+	SendICMPv4Error(pkt tcpip.PacketBuffer, typ header.ICMPv4Type, code byte) bool
+
+	// SendTCPReset sends the reset built by TCPReset to the source of pkt.
+	// It returns true if the reset was sent.
+	SendTCPReset(pkt tcpip.PacketBuffer) bool
+}
+
+// RejectTarget drops packets and tells their source, either with an ICMP
+// destination unreachable error or, for TCP packets, with a reset.
+type RejectTarget struct {
+	// With is the response sent to rejected packets.
+	With RejectWith
+
+	// Responder sends the responses. If it is nil, packets are dropped
+	// silently.
+	Responder Responder
+}
+
+// Action implements Target.Action.
+func (RejectTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleDrop, ""
+}
+
+// Reply implements Replier.Reply.
+func (rt RejectTarget) Reply(pkt tcpip.PacketBuffer) {
+	if rt.Responder == nil {
+		return
+	}
+	if rt.With == RejectWithTCPReset {
+		// As in Linux, packets other than TCP are dropped without a
+		// response.
+		if header.IPv4(pkt.NetworkHeader).TransportProtocol() == header.TCPProtocolNumber {
+			rt.Responder.SendTCPReset(pkt)
+		}
+		return
+	}
+	rt.Responder.SendICMPv4Error(pkt, header.ICMPv4DstUnreachable, rt.With.icmpCode())
+}
+
+// TCPReset builds the TCP segment resetting the connection that the TCP
+// segment pkt belongs to, as described in RFC 793 "Reset Generation". The
+// reset is addressed from pkt's destination to its source and carries a valid
+// checksum.
+//
+// If pkt acknowledges data, the reset's sequence number is pkt's
+// acknowledgement number. Otherwise the reset has sequence number 0 and
+// acknowledges everything pkt occupies in the sequence space: its data and
+// its SYN and FIN flags.
+//
+// TCPReset returns false if pkt may not elicit a reset: it is itself a reset,
+// is truncated, isn't the first fragment of a datagram, or was sent from or to
+// a broadcast or multicast address.
+//
+// Precondition: pkt.NetworkHeader is set.
+func TCPReset(pkt tcpip.PacketBuffer) (buffer.View, bool) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	if ipHdr.TransportProtocol() != header.TCPProtocolNumber || !mayRespond(ipHdr) {
+		return nil, false
+	}
+
+	// Only the fixed part of the header is used, and options are ignored.
+	var buf [header.TCPMinimumSize]byte
+	tcpHdr := header.TCP(PeekTransportHeader(pkt, len(buf), buf[:]))
+	if len(tcpHdr) < header.TCPMinimumSize || int(tcpHdr.DataOffset()) < header.TCPMinimumSize {
+		return nil, false
+	}
+	flags := tcpHdr.Flags()
+	if flags&header.TCPFlagRst != 0 {
+		return nil, false
+	}
+
+	fields := header.TCPFields{
+		SrcPort:    tcpHdr.DestinationPort(),
+		DstPort:    tcpHdr.SourcePort(),
+		DataOffset: header.TCPMinimumSize,
+	}
+	if flags&header.TCPFlagAck != 0 {
+		fields.SeqNum = tcpHdr.AckNumber()
+		fields.Flags = header.TCPFlagRst
+	} else {
+		segLen := int(ipHdr.TotalLength()) - len(ipHdr) - int(tcpHdr.DataOffset())
+		if segLen < 0 {
+			return nil, false
+		}
+		if flags&header.TCPFlagSyn != 0 {
+			segLen++
+		}
+		if flags&header.TCPFlagFin != 0 {
+			segLen++
+		}
+		fields.AckNum = tcpHdr.SequenceNumber() + uint32(segLen)
+		fields.Flags = header.TCPFlagRst | header.TCPFlagAck
+	}
+
+	rst := header.TCP(buffer.NewView(header.TCPMinimumSize))
+	rst.Encode(&fields)
+	xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, ipHdr.DestinationAddress(), ipHdr.SourceAddress(), uint16(len(rst)))
+	rst.SetChecksum(^rst.CalculateChecksum(xsum))
+	return buffer.View(rst), true
+}
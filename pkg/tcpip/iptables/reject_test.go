@@ -0,0 +1,208 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// tcpSegment returns an inbound TCP segment from 10.0.0.1:1234 to
+// 10.0.0.2:80 with the given fields and payloadLen bytes of data.
+func tcpSegment(seq, ack uint32, flags uint8, payloadLen int) tcpip.PacketBuffer {
+	pkt := tcpDataPacket(payloadLen)
+	tcp := header.TCP(pkt.Data.First())
+	tcp.Encode(&header.TCPFields{
+		SrcPort:    1234,
+		DstPort:    80,
+		SeqNum:     seq,
+		AckNum:     ack,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      flags,
+		WindowSize: 1024,
+	})
+	ip := header.IPv4(pkt.NetworkHeader)
+	ip.SetTotalLength(uint16(header.IPv4MinimumSize + header.TCPMinimumSize + payloadLen))
+	return pkt
+}
+
+func TestTCPReset(t *testing.T) {
+	const (
+		seq = 1000
+		ack = 5000
+	)
+	for _, tc := range []struct {
+		name       string
+		flags      uint8
+		payloadLen int
+		wantSeq    uint32
+		wantAck    uint32
+		wantFlags  uint8
+	}{
+		{
+			name:       "data with ACK",
+			flags:      header.TCPFlagAck | header.TCPFlagPsh,
+			payloadLen: 100,
+			wantSeq:    ack,
+			wantFlags:  header.TCPFlagRst,
+		},
+		{
+			name:       "data without ACK",
+			flags:      header.TCPFlagPsh,
+			payloadLen: 100,
+			wantAck:    seq + 100,
+			wantFlags:  header.TCPFlagRst | header.TCPFlagAck,
+		},
+		{
+			name:      "SYN",
+			flags:     header.TCPFlagSyn,
+			wantAck:   seq + 1,
+			wantFlags: header.TCPFlagRst | header.TCPFlagAck,
+		},
+		{
+			name:       "SYN and FIN with data",
+			flags:      header.TCPFlagSyn | header.TCPFlagFin,
+			payloadLen: 10,
+			wantAck:    seq + 10 + 2,
+			wantFlags:  header.TCPFlagRst | header.TCPFlagAck,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkt := tcpSegment(seq, ack, tc.flags, tc.payloadLen)
+			v, ok := TCPReset(pkt)
+			if !ok {
+				t.Fatalf("TCPReset(...) = _, false, want true")
+			}
+			rst := header.TCP(v)
+			if got, want := rst.SourcePort(), uint16(80); got != want {
+				t.Errorf("got source port %d, want %d", got, want)
+			}
+			if got, want := rst.DestinationPort(), uint16(1234); got != want {
+				t.Errorf("got destination port %d, want %d", got, want)
+			}
+			if got := rst.SequenceNumber(); got != tc.wantSeq {
+				t.Errorf("got sequence number %d, want %d", got, tc.wantSeq)
+			}
+			if got := rst.AckNumber(); got != tc.wantAck {
+				t.Errorf("got acknowledgement number %d, want %d", got, tc.wantAck)
+			}
+			if got := rst.Flags(); got != tc.wantFlags {
+				t.Errorf("got flags %#x, want %#x", got, tc.wantFlags)
+			}
+			ip := header.IPv4(pkt.NetworkHeader)
+			xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, ip.DestinationAddress(), ip.SourceAddress(), uint16(len(rst)))
+			if got := rst.CalculateChecksum(xsum); got != 0xffff {
+				t.Errorf("got checksum over segment %#x, want 0xffff", got)
+			}
+		})
+	}
+}
+
+func TestTCPResetSuppressed(t *testing.T) {
+	fragment := tcpSegment(0, 0, header.TCPFlagAck, 0)
+	header.IPv4(fragment.NetworkHeader).SetFlagsFragmentOffset(0, 8)
+
+	for _, tc := range []struct {
+		name string
+		pkt  tcpip.PacketBuffer
+	}{
+		{"RST", tcpSegment(0, 0, header.TCPFlagRst, 0)},
+		{"RST with ACK", tcpSegment(0, 0, header.TCPFlagRst|header.TCPFlagAck, 0)},
+		{"UDP", ipv4Packet(header.UDPProtocolNumber)},
+		{"non-initial fragment", fragment},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := TCPReset(tc.pkt); ok {
+				t.Errorf("TCPReset(...) = _, true, want false")
+			}
+		})
+	}
+}
+
+// recordingResponder is a Responder that records what it is asked to send.
+type recordingResponder struct {
+	icmpCodes []byte
+	resets    int
+}
+
+// SendICMPv4Error implements Responder.SendICMPv4Error.
+func (r *recordingResponder) SendICMPv4Error(pkt tcpip.PacketBuffer, typ header.ICMPv4Type, code byte) bool {
+	r.icmpCodes = append(r.icmpCodes, code)
+	return true
+}
+
+// SendTCPReset implements Responder.SendTCPReset.
+func (r *recordingResponder) SendTCPReset(pkt tcpip.PacketBuffer) bool {
+	r.resets++
+	return true
+}
+
+// rejectTables returns the default tables with the filter table's INPUT chain
+// rejecting everything with target.
+func rejectTables(target RejectTarget) IPTables {
+	ipt := DefaultTables()
+	filter := EmptyFilterTable()
+	filter.Rules = []Rule{
+		Rule{Target: target},
+		Rule{Target: AcceptTarget{}},
+		Rule{Target: ErrorTarget{}},
+	}
+	filter.BuiltinChains[Input] = 0
+	filter.BuiltinChains[Forward] = 1
+	filter.BuiltinChains[Output] = 1
+	filter.Underflows[Input] = 1
+	filter.Underflows[Forward] = 1
+	filter.Underflows[Output] = 1
+	ipt.Tables[TablenameFilter] = filter
+	return ipt
+}
+
+func TestRejectTarget(t *testing.T) {
+	var responder recordingResponder
+	ipt := rejectTables(RejectTarget{With: RejectWithTCPReset, Responder: &responder})
+
+	segment := tcpSegment(0, 0, header.TCPFlagAck, 10)
+	if ipt.Check(Input, &segment, "") {
+		t.Errorf("Check(Input, TCP segment) = true, want false")
+	}
+	if responder.resets != 1 {
+		t.Errorf("got %d resets sent, want 1", responder.resets)
+	}
+
+	// Non-TCP packets are dropped without a response.
+	udp := ipv4Packet(header.UDPProtocolNumber)
+	if ipt.Check(Input, &udp, "") {
+		t.Errorf("Check(Input, UDP packet) = true, want false")
+	}
+	if responder.resets != 1 || len(responder.icmpCodes) != 0 {
+		t.Errorf("got %d resets and %d ICMP errors sent, want 1 and 0", responder.resets, len(responder.icmpCodes))
+	}
+
+	// Dry runs don't send anything.
+	if verdict, _ := ipt.CheckDryRun(Input, PacketSpec{Protocol: header.TCPProtocolNumber, TCPFlags: header.TCPFlagAck}); verdict {
+		t.Errorf("CheckDryRun(Input, TCP) = true, want false")
+	}
+	if responder.resets != 1 {
+		t.Errorf("got %d resets sent after dry run, want 1", responder.resets)
+	}
+
+	ipt = rejectTables(RejectTarget{With: RejectWithICMPHostProhibited, Responder: &responder})
+	ipt.Check(Input, &udp, "")
+	if want := []byte{header.ICMPv4HostProhibited}; len(responder.icmpCodes) != 1 || responder.icmpCodes[0] != want[0] {
+		t.Errorf("got ICMP codes %v sent, want %v", responder.icmpCodes, want)
+	}
+}
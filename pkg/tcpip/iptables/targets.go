@@ -47,14 +47,19 @@ func (ErrorTarget) Action(packet tcpip.PacketBuffer) (RuleVerdict, string) {
 	return RuleDrop, ""
 }
 
-// UserChainTarget marks a rule as the beginning of a user chain.
+// UserChainTarget marks a rule as the beginning of a user chain. Jumps go to
+// the rule after it.
 type UserChainTarget struct {
 	Name string
 }
 
-// Action implements Target.Action.
-func (UserChainTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
-	panic("UserChainTarget should never be called.")
+// Action implements Target.Action. Packets only reach a UserChainTarget if a
+// jump goes to it, or the chain before it has no final verdict, which Linux
+// rejects when the table is set. Like Linux, whose user chains begin with an
+// ERROR target, drop them.
+func (uc UserChainTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	log.Debugf("UserChainTarget %q triggered.", uc.Name)
+	return RuleDrop, ""
 }
 
 // ReturnTarget returns from the current chain. If the chain is a built-in, the
@@ -65,3 +70,34 @@ type ReturnTarget struct{}
 func (ReturnTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
 	return RuleReturn, ""
 }
+
+// JumpTarget jumps to another rule of the table, usually the first rule of a
+// user chain. Traversal returns to the rule after the JumpTarget when the
+// chain returns.
+type JumpTarget struct {
+	// Offset is the byte offset of the rule to jump to in the table, as
+	// set by iptables.
+	Offset uint32
+
+	// RuleNum is the index of the rule to jump to in the table's Rules.
+	RuleNum int
+}
+
+// Action implements Target.Action.
+func (JumpTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleJump, ""
+}
+
+// CTTarget sets how connection tracking treats the packets it acts on, then
+// lets them continue to the next rule. Like Linux's CT target, it is meant for
+// the raw table, whose chains are visited before connections are tracked.
+type CTTarget struct {
+	// NoTrack exempts packets from connection tracking. Such packets are
+	// untracked: they neither start nor update a tracked connection.
+	NoTrack bool
+}
+
+// Action implements Target.Action.
+func (CTTarget) Action(tcpip.PacketBuffer) (RuleVerdict, string) {
+	return RuleContinue, ""
+}
@@ -15,6 +15,8 @@
 package iptables
 
 import (
+	"sync/atomic"
+
 	"gvisor.dev/gvisor/pkg/tcpip"
 )
 
@@ -82,6 +84,10 @@ const (
 
 	// RuleReturn indicates the packet should return to the previous chain.
 	RuleReturn
+
+	// RuleJump indicates the packet should jump to another chain. The rule's
+	// target is a JumpTarget naming the rule to continue from.
+	RuleJump
 )
 
 // IPTables holds all the tables for a netstack.
@@ -91,8 +97,54 @@ type IPTables struct {
 
 	// Priorities maps each hook to a list of table names. The order of the
 	// list is the order in which each table should be visited for that
-	// hook.
+	// hook. It is computed from the tables' priorities by UpdatePriorities.
 	Priorities map[Hook][]string
+
+	// PriorityOverrides holds the priorities set by SetPriority, which
+	// replace the Linux priorities of tables at hooks. It is shared by
+	// copies of the IPTables.
+	PriorityOverrides map[TableHook]int
+
+	// DropCapture, if set, is passed the packets dropped by Check and
+	// CheckBatch. It is shared by copies of the IPTables.
+	DropCapture *DropCapture
+
+	// ConnTrack, if set, tracks the connections of the packets checked at
+	// the Prerouting and Output hooks, and classifies them by setting
+	// tcpip.PacketBuffer.ConnState. It is shared by copies of the IPTables.
+	// Only IPv4 connections are tracked.
+	ConnTrack *ConnTrack
+
+	// NetworkProtocol is the network protocol of the packets filtered by the
+	// tables: header.IPv4ProtocolNumber for iptables, the default if it is
+	// zero, or header.IPv6ProtocolNumber for ip6tables. Packets of other
+	// network protocols are accepted without being checked.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+
+	// MalformedPolicy maps hooks to the verdict of the packets checked there
+	// whose network header is missing or truncated, and can't be parsed
+	// from their payload. At hooks missing from it, such packets are
+	// accepted at the Output hook, which locally generated packets may reach
+	// before their headers are finalized, and dropped at the others.
+	MalformedPolicy map[Hook]TableVerdict
+
+	// MalformedPackets, if set, counts the packets given a verdict by
+	// MalformedPolicy. It is shared by copies of the IPTables.
+	MalformedPackets *tcpip.StatCounter
+
+	// LogCallback, if set, is passed the entries of the packets that reach
+	// LogTargets, instead of them being written to the sentry log. It is
+	// called synchronously by Check and CheckBatch, so it must not block.
+	LogCallback func(LogEntry)
+}
+
+// A TableHook identifies the built-in chain of a table for a hook.
+type TableHook struct {
+	// Table is the name of the table.
+	Table string
+
+	// Hook is the hook of the chain.
+	Hook Hook
 }
 
 // A Table defines a set of chains and hooks into the network stack. It is
@@ -115,6 +167,24 @@ type Table struct {
 	// Metadata holds information about the Table that is useful to users
 	// of IPTables, but not to the netstack IPTables code itself.
 	metadata interface{}
+
+	// counters holds the counters of each rule, indexed like Rules. It is
+	// allocated by IPTables.InitCounters and shared by copies of the Table.
+	// If it is nil, rules aren't counted.
+	counters []RuleCounters
+
+	// namedCounters holds the counters used by CountTargets, keyed by name.
+	// Like counters, it is allocated by IPTables.InitCounters and shared by
+	// copies of the Table.
+	namedCounters map[string]*RuleCounters
+
+	// policyCounters holds the counters of the policy of each built-in
+	// chain, indexed by Hook. They count the packets that reach the
+	// chain's underflow rule rather than a verdict of one of its rules, and
+	// are separate from the underflow rule's counters, which several chains
+	// may share. Like counters, it is allocated by IPTables.InitCounters and
+	// shared by copies of the Table.
+	policyCounters []RuleCounters
 }
 
 // ValidHooks returns a bitmap of the builtin hooks for the given table.
@@ -136,6 +206,108 @@ func (table *Table) SetMetadata(metadata interface{}) {
 	table.metadata = metadata
 }
 
+// RuleCounters holds the number of packets and bytes that matched a rule. The
+// counters of installed rules are accessed using atomic memory operations.
+type RuleCounters struct {
+	// Packets is the number of packets that matched the rule.
+	Packets uint64
+
+	// Bytes is the total IP length of the packets that matched the rule.
+	Bytes uint64
+}
+
+// count records that pkt matched the rule at ruleIdx.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (table *Table) count(ruleIdx int, pkt tcpip.PacketBuffer) {
+	if ruleIdx >= len(table.counters) {
+		return
+	}
+	c := &table.counters[ruleIdx]
+	atomic.AddUint64(&c.Packets, 1)
+	atomic.AddUint64(&c.Bytes, uint64(packetLength(pkt)))
+}
+
+// RuleCounter returns the counters of the rule at ruleIdx. Packets that reach
+// the rule as the policy of a built-in chain aren't included, see
+// PolicyCounter.
+func (table *Table) RuleCounter(ruleIdx int) RuleCounters {
+	if ruleIdx >= len(table.counters) {
+		return RuleCounters{}
+	}
+	return loadCounters(&table.counters[ruleIdx])
+}
+
+// Counters returns a snapshot of the counters of each of table's rules,
+// indexed like Rules. As with RuleCounter, packets that reach a rule as the
+// policy of a built-in chain aren't included. Tables without counters return
+// nil.
+func (table *Table) Counters() []RuleCounters {
+	if len(table.counters) == 0 {
+		return nil
+	}
+	counters := make([]RuleCounters, len(table.counters))
+	for i := range table.counters {
+		counters[i] = loadCounters(&table.counters[i])
+	}
+	return counters
+}
+
+// countPolicy records that pkt reached the policy of the built-in chain for
+// hook.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (table *Table) countPolicy(hook Hook, pkt tcpip.PacketBuffer) {
+	if int(hook) >= len(table.policyCounters) {
+		return
+	}
+	c := &table.policyCounters[hook]
+	atomic.AddUint64(&c.Packets, 1)
+	atomic.AddUint64(&c.Bytes, uint64(packetLength(pkt)))
+}
+
+// PolicyCounter returns the counters of the policy of the built-in chain for
+// hook.
+func (table *Table) PolicyCounter(hook Hook) RuleCounters {
+	if int(hook) >= len(table.policyCounters) {
+		return RuleCounters{}
+	}
+	return loadCounters(&table.policyCounters[hook])
+}
+
+// ZeroRuleCounters zeroes the counters of table's rules, including the named
+// counters used by CountTargets. Policy counters are left alone.
+func (table *Table) ZeroRuleCounters() {
+	for i := range table.counters {
+		zeroCounters(&table.counters[i])
+	}
+	for _, c := range table.namedCounters {
+		zeroCounters(c)
+	}
+}
+
+// ZeroPolicyCounters zeroes the policy counters of table's built-in chains.
+// Rule counters are left alone.
+func (table *Table) ZeroPolicyCounters() {
+	for i := range table.policyCounters {
+		zeroCounters(&table.policyCounters[i])
+	}
+}
+
+// loadCounters returns a snapshot of the live counters c.
+func loadCounters(c *RuleCounters) RuleCounters {
+	return RuleCounters{
+		Packets: atomic.LoadUint64(&c.Packets),
+		Bytes:   atomic.LoadUint64(&c.Bytes),
+	}
+}
+
+// zeroCounters zeroes the live counters c.
+func zeroCounters(c *RuleCounters) {
+	atomic.StoreUint64(&c.Packets, 0)
+	atomic.StoreUint64(&c.Bytes, 0)
+}
+
 // A Rule is a packet processing rule. It consists of two pieces. First it
 // contains zero or more matchers, each of which is a specification of which
 // packets this rule applies to. If there are no matchers in the rule, it
@@ -155,6 +327,64 @@ type Rule struct {
 type IPHeaderFilter struct {
 	// Protocol matches the transport protocol.
 	Protocol tcpip.TransportProtocolNumber
+
+	// Src matches the source IP address, after both are masked by SrcMask.
+	// If Src and SrcMask are empty, every source address matches.
+	Src tcpip.Address
+
+	// SrcMask masks bits of the source IP address when comparing with Src.
+	// It has the same length as Src.
+	SrcMask tcpip.Address
+
+	// SrcInvert inverts the meaning of the source IP check, i.e. when true
+	// the filter matches packets that fail the source comparison.
+	SrcInvert bool
+
+	// Dst matches the destination IP address, after both are masked by
+	// DstMask. If Dst and DstMask are empty, every destination address
+	// matches.
+	Dst tcpip.Address
+
+	// DstMask masks bits of the destination IP address when comparing with
+	// Dst. It has the same length as Dst.
+	DstMask tcpip.Address
+
+	// DstInvert inverts the meaning of the destination IP check, i.e. when
+	// true the filter matches packets that fail the destination comparison.
+	DstInvert bool
+
+	// InputInterface matches the name of the NIC a packet arrived on. A name
+	// ending in "+", e.g. "eth+", matches every NIC whose name starts with
+	// what precedes it. If InputInterface is empty, every NIC matches. It is
+	// only checked at the Prerouting and Input hooks.
+	InputInterface string
+
+	// InputInterfaceInvert inverts the meaning of the input interface check.
+	InputInterfaceInvert bool
+
+	// OutputInterface matches the name of the NIC a packet is leaving
+	// through, like InputInterface. It is only checked at the Output and
+	// Postrouting hooks.
+	OutputInterface string
+
+	// OutputInterfaceInvert inverts the meaning of the output interface
+	// check.
+	OutputInterfaceInvert bool
+}
+
+// ValidForHook returns whether fl can be used in a built-in chain for hook.
+// As in Linux, packets only have an input interface at the Prerouting, Input
+// and Forward hooks, and only have an output interface at the Forward, Output
+// and Postrouting hooks, so filters can't match the missing one.
+func (fl IPHeaderFilter) ValidForHook(hook Hook) bool {
+	switch hook {
+	case Prerouting, Input:
+		return fl.OutputInterface == "" && !fl.OutputInterfaceInvert
+	case Output, Postrouting:
+		return fl.InputInterface == "" && !fl.InputInterfaceInvert
+	default:
+		return true
+	}
 }
 
 // A Matcher is the interface for matching packets.
@@ -164,16 +394,53 @@ type Matcher interface {
 
 	// Match returns whether the packet matches and whether the packet
 	// should be "hotdropped", i.e. dropped immediately. This is usually
-	// used for suspicious packets.
+	// used for suspicious packets. interfaceName is the name of the NIC the
+	// packet goes through at hook, as passed to IPTables.Check.
 	//
 	// Precondition: packet.NetworkHeader is set.
 	Match(hook Hook, packet tcpip.PacketBuffer, interfaceName string) (matches bool, hotdrop bool)
 }
 
+// A NetworkMatcher is a Matcher that only applies to packets of one network
+// protocol, e.g. because it reads IPv4 header fields. A rule with a
+// NetworkMatcher never matches packets of other network protocols, and the
+// matcher isn't called for them.
+type NetworkMatcher interface {
+	Matcher
+
+	// NetworkProtocol returns the network protocol of the packets that the
+	// matcher applies to.
+	NetworkProtocol() tcpip.NetworkProtocolNumber
+}
+
 // A Target is the interface for taking an action for a packet.
 type Target interface {
 	// Action takes an action on the packet and returns a verdict on how
 	// traversal should (or should not) continue. If the return value is
-	// Jump, it also returns the name of the chain to jump to.
+	// RuleJump, the target is a JumpTarget and the string is unused.
 	Action(packet tcpip.PacketBuffer) (RuleVerdict, string)
 }
+
+// A Replier is a Target that replies to the source of the packets it acts
+// on, such as RejectTarget.
+type Replier interface {
+	Target
+
+	// Reply sends the reply to packet. It is called after Action, except
+	// when packet is evaluated by CheckDryRun.
+	//
+	// Precondition: packet.NetworkHeader is set.
+	Reply(packet tcpip.PacketBuffer)
+}
+
+// A Mangler is a Target that modifies the packets it acts on, such as
+// ChecksumFillTarget.
+type Mangler interface {
+	Target
+
+	// Mangle modifies packet. It is called after Action, except when packet
+	// is evaluated by CheckDryRun.
+	//
+	// Precondition: packet.NetworkHeader is set.
+	Mangle(packet *tcpip.PacketBuffer)
+}
@@ -245,18 +245,21 @@ func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, params stack.Netw
 	ip := e.addIPHeader(r, &pkt.Header, pkt.Data.Size(), params)
 	pkt.NetworkHeader = buffer.View(ip)
 
-	if r.Loop&stack.PacketLoop != 0 {
-		// The inbound path expects the network header to still be in
-		// the PacketBuffer's Data field.
-		views := make([]buffer.View, 1, 1+len(pkt.Data.Views()))
-		views[0] = pkt.Header.View()
-		views = append(views, pkt.Data.Views()...)
-		loopedR := r.MakeLoopedRoute()
+	// Looped back packets go through the Output hook too, so that its rules
+	// and connection tracking apply to local traffic.
+	if !e.handleOutbound(&pkt) {
+		// iptables dropped the packet, or the connection tracking table
+		// is full.
+		return nil
+	}
 
-		e.HandlePacket(&loopedR, tcpip.PacketBuffer{
-			Data: buffer.NewVectorisedView(len(views[0])+pkt.Data.Size(), views),
-		})
+	if e.deliverTranslated(r, pkt) {
+		return nil
+	}
 
+	if r.Loop&stack.PacketLoop != 0 {
+		loopedR := r.MakeLoopedRoute()
+		e.HandlePacket(&loopedR, loopedPacket(pkt))
 		loopedR.Release()
 	}
 	if r.Loop&stack.PacketOut == 0 {
@@ -285,9 +288,80 @@ func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts []tcpip.Pac
 		ip := e.addIPHeader(r, &pkts[i].Header, pkts[i].DataSize, params)
 		pkts[i].NetworkHeader = buffer.View(ip)
 	}
+
+	// Packets refused by iptables or connection tracking are dropped, and
+	// those translated to a local destination are delivered locally, but
+	// both are reported as written.
+	var kept []tcpip.PacketBuffer
+	for i := range pkts {
+		if !e.handleOutbound(&pkts[i]) || e.deliverTranslated(r, pkts[i]) {
+			if kept == nil {
+				kept = append(make([]tcpip.PacketBuffer, 0, len(pkts)), pkts[:i]...)
+			}
+			continue
+		}
+		if kept != nil {
+			kept = append(kept, pkts[i])
+		}
+	}
+	var dropped int
+	if kept != nil {
+		dropped = len(pkts) - len(kept)
+		pkts = kept
+		if len(pkts) == 0 {
+			return dropped, nil
+		}
+	}
 	n, err := e.linkEP.WritePackets(r, gso, pkts, ProtocolNumber)
 	r.Stats().IP.PacketsSent.IncrementBy(uint64(n))
-	return n, err
+	return n + dropped, err
+}
+
+// loopedPacket returns an inbound copy of pkt, an outbound packet that went
+// through the Output hook, to be handled locally.
+func loopedPacket(pkt tcpip.PacketBuffer) tcpip.PacketBuffer {
+	// The inbound path expects the network header to still be in the
+	// PacketBuffer's Data field.
+	views := make([]buffer.View, 1, 1+len(pkt.Data.Views()))
+	views[0] = pkt.Header.View()
+	views = append(views, pkt.Data.Views()...)
+	return tcpip.PacketBuffer{
+		Data:        buffer.NewVectorisedView(len(views[0])+pkt.Data.Size(), views),
+		NoTrack:     pkt.NoTrack,
+		ConnState:   pkt.ConnState,
+		ConnTracked: true,
+	}
+}
+
+// deliverTranslated delivers pkt, an outbound packet that went through the
+// Output hook, locally if the hook translated its addresses, so that r no
+// longer matches them, and its new destination is local. Like Linux, which
+// reroutes such packets, they are then handled as if they had been sent to
+// that destination in the first place. It returns false if pkt wasn't
+// delivered, in which case it still leaves through r.
+func (e *endpoint) deliverTranslated(r *stack.Route, pkt tcpip.PacketBuffer) bool {
+	ip := header.IPv4(pkt.NetworkHeader)
+	if ip.SourceAddress() == r.LocalAddress && ip.DestinationAddress() == r.RemoteAddress {
+		return false
+	}
+	if pkt.DataSize != 0 {
+		// pkt's payload is only part of its Data field, which it may
+		// share with other packets written by WritePackets.
+		pkt.Data = buffer.NewViewFromBytes(pkt.Data.ToView()[pkt.DataOffset:][:pkt.DataSize]).ToVectorisedView()
+	}
+	return e.stack.DeliverLocalPacket(ProtocolNumber, loopedPacket(pkt))
+}
+
+// handleOutbound runs pkt, an outbound packet whose network and transport
+// headers are in pkt.Header, through the iptables Output hook, which also
+// tracks its connection. It returns false if pkt should be dropped, either by
+// iptables or because the connection tracking table is full.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (e *endpoint) handleOutbound(pkt *tcpip.PacketBuffer) bool {
+	pkt.TransportHeader = pkt.Header.View()[len(pkt.NetworkHeader):]
+	ipt := e.stack.IPTables()
+	return ipt.Check(iptables.Output, pkt, e.stack.FindNICNameFromID(e.nicID))
 }
 
 // WriteHeaderIncludedPacket writes a packet already containing a network
@@ -358,10 +432,35 @@ func (e *endpoint) HandlePacket(r *stack.Route, pkt tcpip.PacketBuffer) {
 	pkt.Data.TrimFront(hlen)
 	pkt.Data.CapLength(tlen - hlen)
 
+	// Connections are tracked at the Prerouting hook, after the raw table,
+	// so that its rules can exempt packets from connection tracking.
+	ipt := e.stack.IPTables()
+	nicName := e.stack.FindNICNameFromID(e.nicID)
+	if ok := ipt.Check(iptables.Prerouting, &pkt, nicName); !ok {
+		// iptables is telling us to drop the packet, or the connection
+		// tracking table is full.
+		return
+	}
+
+	// Destination NAT may have rewritten the addresses of the packet, whose
+	// network header was then copied. It is delivered to its new
+	// destination, which must be local since packets aren't forwarded.
+	if nh := header.IPv4(pkt.NetworkHeader); nh.SourceAddress() != h.SourceAddress() || nh.DestinationAddress() != h.DestinationAddress() {
+		if e.stack.CheckLocalAddress(e.nicID, ProtocolNumber, nh.DestinationAddress()) == 0 {
+			r.Stats().IP.InvalidDestinationAddressesReceived.Increment()
+			return
+		}
+		natR := r.Clone()
+		defer natR.Release()
+		natR.LocalAddress = nh.DestinationAddress()
+		natR.RemoteAddress = nh.SourceAddress()
+		r = &natR
+	}
+	h = header.IPv4(pkt.NetworkHeader)
+
 	// iptables filtering. All packets that reach here are intended for
 	// this machine and will not be forwarded.
-	ipt := e.stack.IPTables()
-	if ok := ipt.Check(iptables.Input, pkt); !ok {
+	if ok := ipt.Check(iptables.Input, &pkt, nicName); !ok {
 		// iptables is telling us to drop the packet.
 		return
 	}
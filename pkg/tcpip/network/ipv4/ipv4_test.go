@@ -19,11 +19,16 @@ import (
 	"encoding/hex"
 	"math/rand"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -90,6 +95,531 @@ func TestExcludeBroadcast(t *testing.T) {
 	})
 }
 
+// TestRejectTCPReset checks that a TCP data segment rejected by an iptables
+// REJECT --reject-with tcp-reset rule is answered with a reset the peer will
+// accept.
+func TestRejectTCPReset(t *testing.T) {
+	const (
+		nicID      = 1
+		localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+		remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+		localPort  = 80
+		remotePort = 1234
+		seqNum     = 1000
+		ackNum     = 5000
+		payloadLen = 100
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol()},
+	})
+	e := channel.New(1, 1280, "")
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	ipt := iptables.DefaultTables()
+	filter := ipt.Tables[iptables.TablenameFilter]
+	filter.Rules = append([]iptables.Rule{{
+		Filter: iptables.IPHeaderFilter{Protocol: header.TCPProtocolNumber},
+		Target: iptables.RejectTarget{With: iptables.RejectWithTCPReset, Responder: s},
+	}}, filter.Rules...)
+	for hook, idx := range filter.BuiltinChains {
+		if hook != iptables.Input {
+			filter.BuiltinChains[hook] = idx + 1
+		}
+	}
+	for hook, idx := range filter.Underflows {
+		filter.Underflows[hook] = idx + 1
+	}
+	ipt.Tables[iptables.TablenameFilter] = filter
+	s.SetIPTables(ipt)
+
+	for _, tc := range []struct {
+		name      string
+		flags     uint8
+		wantSeq   uint32
+		wantAck   uint32
+		wantFlags uint8
+	}{
+		{
+			name:      "with ACK",
+			flags:     header.TCPFlagAck | header.TCPFlagPsh,
+			wantSeq:   ackNum,
+			wantFlags: header.TCPFlagRst,
+		},
+		{
+			name:      "without ACK",
+			flags:     header.TCPFlagPsh,
+			wantAck:   seqNum + payloadLen,
+			wantFlags: header.TCPFlagRst | header.TCPFlagAck,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			totalLen := header.IPv4MinimumSize + header.TCPMinimumSize + payloadLen
+			hdr := buffer.NewView(totalLen)
+			ip := header.IPv4(hdr)
+			ip.Encode(&header.IPv4Fields{
+				IHL:         header.IPv4MinimumSize,
+				TotalLength: uint16(totalLen),
+				TTL:         64,
+				Protocol:    uint8(header.TCPProtocolNumber),
+				SrcAddr:     remoteAddr,
+				DstAddr:     localAddr,
+			})
+			ip.SetChecksum(^ip.CalculateChecksum())
+			tcp := header.TCP(hdr[header.IPv4MinimumSize:])
+			tcp.Encode(&header.TCPFields{
+				SrcPort:    remotePort,
+				DstPort:    localPort,
+				SeqNum:     seqNum,
+				AckNum:     ackNum,
+				DataOffset: header.TCPMinimumSize,
+				Flags:      tc.flags,
+				WindowSize: 1024,
+			})
+			e.InjectInbound(ipv4.ProtocolNumber, tcpip.PacketBuffer{
+				Data: hdr.ToVectorisedView(),
+			})
+
+			p, ok := e.Read()
+			if !ok {
+				t.Fatalf("no reset was sent")
+			}
+			b := append(p.Pkt.Header.View(), p.Pkt.Data.ToView()...)
+			checker.IPv4(t, b,
+				checker.SrcAddr(localAddr),
+				checker.DstAddr(remoteAddr),
+				checker.TCP(
+					checker.SrcPort(localPort),
+					checker.DstPort(remotePort),
+					checker.SeqNum(tc.wantSeq),
+					checker.AckNum(tc.wantAck),
+					checker.TCPFlags(tc.wantFlags),
+				),
+			)
+		})
+	}
+}
+
+// TestConnTrackFull checks that new connections are dropped while the
+// stack's connection tracking table is full, and accepted again once tracked
+// connections expire.
+func TestConnTrackFull(t *testing.T) {
+	const (
+		nicID      = 1
+		localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+		remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+	)
+
+	clock := faketime.NewManualClock(time.Unix(0, 0))
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol()},
+		Clock:            clock,
+		ConnTrackMax:     1,
+	})
+	e := channel.New(1, 1280, "")
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	// ping injects an echo request with the given id and returns whether it
+	// was answered.
+	ping := func(id uint16) bool {
+		totalLen := header.IPv4MinimumSize + header.ICMPv4MinimumSize
+		hdr := buffer.NewView(totalLen)
+		ip := header.IPv4(hdr)
+		ip.Encode(&header.IPv4Fields{
+			IHL:         header.IPv4MinimumSize,
+			TotalLength: uint16(totalLen),
+			TTL:         64,
+			Protocol:    uint8(header.ICMPv4ProtocolNumber),
+			SrcAddr:     remoteAddr,
+			DstAddr:     localAddr,
+		})
+		ip.SetChecksum(^ip.CalculateChecksum())
+		icmp := header.ICMPv4(hdr[header.IPv4MinimumSize:])
+		icmp.SetType(header.ICMPv4Echo)
+		icmp.SetIdent(id)
+		icmp.SetChecksum(^header.Checksum(icmp, 0))
+		e.InjectInbound(ipv4.ProtocolNumber, tcpip.PacketBuffer{
+			Data: hdr.ToVectorisedView(),
+		})
+		_, ok := e.Read()
+		return ok
+	}
+
+	if !ping(1) {
+		t.Fatalf("first echo request wasn't answered")
+	}
+	if ping(2) {
+		t.Fatalf("echo request was answered with a full table")
+	}
+	if got := s.ConnTrack().Dropped(); got != 1 {
+		t.Errorf("got Dropped() = %d, want = 1", got)
+	}
+	// Requests of a tracked connection are still answered.
+	if !ping(1) {
+		t.Errorf("echo request of a tracked connection wasn't answered")
+	}
+
+	clock.Advance(s.ConnTrack().Timeouts().ICMP)
+	if !ping(2) {
+		t.Errorf("echo request wasn't answered after the tracked connection expired")
+	}
+}
+
+// TestConnTrackNoTrack checks that packets exempted from connection tracking
+// by a CT --notrack rule in the raw table aren't tracked, while other packets
+// still are.
+func TestConnTrackNoTrack(t *testing.T) {
+	const (
+		nicID      = 1
+		localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+		remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol()},
+		ConnTrackMax:     16,
+	})
+	e := channel.New(1, 1280, "")
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	// iptables -t raw -A PREROUTING -p udp -j CT --notrack
+	ipt := iptables.DefaultTables()
+	raw := ipt.Tables[iptables.TablenameRaw]
+	raw.Rules = append([]iptables.Rule{{
+		Filter: iptables.IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+		Target: iptables.CTTarget{NoTrack: true},
+	}}, raw.Rules...)
+	raw.BuiltinChains[iptables.Output]++
+	raw.Underflows[iptables.Prerouting]++
+	raw.Underflows[iptables.Output]++
+	ipt.Tables[iptables.TablenameRaw] = raw
+	s.SetIPTables(ipt)
+
+	// inject injects a packet of protocol proto with the given transport
+	// header.
+	inject := func(proto tcpip.TransportProtocolNumber, transport []byte) {
+		totalLen := header.IPv4MinimumSize + len(transport)
+		hdr := buffer.NewView(totalLen)
+		ip := header.IPv4(hdr)
+		ip.Encode(&header.IPv4Fields{
+			IHL:         header.IPv4MinimumSize,
+			TotalLength: uint16(totalLen),
+			TTL:         64,
+			Protocol:    uint8(proto),
+			SrcAddr:     remoteAddr,
+			DstAddr:     localAddr,
+		})
+		ip.SetChecksum(^ip.CalculateChecksum())
+		copy(hdr[header.IPv4MinimumSize:], transport)
+		e.InjectInbound(ipv4.ProtocolNumber, tcpip.PacketBuffer{
+			Data: hdr.ToVectorisedView(),
+		})
+		// Discard any reply.
+		e.Read()
+	}
+
+	for port := uint16(1000); port < 1010; port++ {
+		udp := make(header.UDP, header.UDPMinimumSize)
+		udp.Encode(&header.UDPFields{
+			SrcPort: port,
+			DstPort: 53,
+			Length:  header.UDPMinimumSize,
+		})
+		inject(header.UDPProtocolNumber, udp)
+	}
+	if got := s.ConnTrack().Count(); got != 0 {
+		t.Errorf("got Count() = %d after untracked UDP packets, want = 0", got)
+	}
+
+	icmp := make(header.ICMPv4, header.ICMPv4MinimumSize)
+	icmp.SetType(header.ICMPv4Echo)
+	icmp.SetIdent(1)
+	icmp.SetChecksum(^header.Checksum(icmp, 0))
+	inject(header.ICMPv4ProtocolNumber, icmp)
+	if got := s.ConnTrack().Count(); got != 1 {
+		t.Errorf("got Count() = %d after an echo request, want = 1", got)
+	}
+}
+
+// TestChecksumFill checks that UDP datagrams whose checksum is offloaded to
+// the link endpoint leave with a valid checksum once an iptables
+// CHECKSUM --checksum-fill rule is installed.
+func TestChecksumFill(t *testing.T) {
+	const (
+		nicID      = 1
+		localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+		remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+	)
+
+	for _, tc := range []struct {
+		name      string
+		fill      bool
+		wantValid bool
+	}{
+		{name: "offloaded", fill: false, wantValid: false},
+		{name: "filled", fill: true, wantValid: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols:   []stack.NetworkProtocol{ipv4.NewProtocol()},
+				TransportProtocols: []stack.TransportProtocol{udp.NewProtocol()},
+			})
+			e := channel.New(1, 1280, "")
+			e.LinkEPCapabilities |= stack.CapabilityTXChecksumOffload
+			if err := s.CreateNIC(nicID, e); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+			}
+			if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+				t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+			if tc.fill {
+				// iptables -t mangle -A OUTPUT -p udp -j CHECKSUM --checksum-fill
+				ipt := iptables.DefaultTables()
+				mangle := ipt.Tables[iptables.TablenameMangle]
+				output := mangle.BuiltinChains[iptables.Output]
+				rules := append([]iptables.Rule(nil), mangle.Rules[:output]...)
+				rules = append(rules, iptables.Rule{
+					Filter: iptables.IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+					Target: iptables.ChecksumFillTarget{},
+				})
+				mangle.Rules = append(rules, mangle.Rules[output:]...)
+				mangle.Underflows[iptables.Output]++
+				ipt.Tables[iptables.TablenameMangle] = mangle
+				s.SetIPTables(ipt)
+			}
+
+			var wq waiter.Queue
+			ep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+			if err != nil {
+				t.Fatalf("NewEndpoint: %s", err)
+			}
+			defer ep.Close()
+			if err := ep.Connect(tcpip.FullAddress{Addr: remoteAddr, Port: 53}); err != nil {
+				t.Fatalf("Connect: %s", err)
+			}
+			payload := []byte("checksum me")
+			if _, _, err := ep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{}); err != nil {
+				t.Fatalf("Write: %s", err)
+			}
+
+			p, ok := e.Read()
+			if !ok {
+				t.Fatalf("no datagram was sent")
+			}
+			b := append(p.Pkt.Header.View(), p.Pkt.Data.ToView()...)
+			checker.IPv4(t, b,
+				checker.SrcAddr(localAddr),
+				checker.DstAddr(remoteAddr),
+				checker.UDP(checker.DstPort(53)),
+			)
+			ip := header.IPv4(b)
+			udpHdr := header.UDP(ip.Payload())
+			xsum := header.PseudoHeaderChecksum(udp.ProtocolNumber, localAddr, remoteAddr, uint16(len(udpHdr)))
+			valid := udpHdr.Checksum() != 0 && header.Checksum(udpHdr, xsum) == 0xffff
+			if valid != tc.wantValid {
+				t.Errorf("got valid checksum = %t (checksum %#x), want %t", valid, udpHdr.Checksum(), tc.wantValid)
+			}
+		})
+	}
+}
+
+// TestOutputLoopback checks that locally delivered packets go through the
+// Output hook before they are looped back, so that they can be dropped there.
+func TestOutputLoopback(t *testing.T) {
+	const (
+		nicID     = 1
+		localAddr = tcpip.Address("\x0a\x00\x00\x02")
+		port      = 53
+	)
+
+	for _, tc := range []struct {
+		name       string
+		drop       bool
+		wantLooped bool
+	}{
+		{name: "accepted", drop: false, wantLooped: true},
+		{name: "dropped", drop: true, wantLooped: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols:   []stack.NetworkProtocol{ipv4.NewProtocol()},
+				TransportProtocols: []stack.TransportProtocol{udp.NewProtocol()},
+				HandleLocal:        true,
+			})
+			e := channel.New(1, 1280, "")
+			if err := s.CreateNIC(nicID, e); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+			}
+			if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+				t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+			if tc.drop {
+				// iptables -A OUTPUT -p udp -j DROP
+				ipt := iptables.DefaultTables()
+				filter := ipt.Tables[iptables.TablenameFilter]
+				output := filter.BuiltinChains[iptables.Output]
+				rules := append([]iptables.Rule(nil), filter.Rules[:output]...)
+				rules = append(rules, iptables.Rule{
+					Filter: iptables.IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+					Target: iptables.DropTarget{},
+				})
+				filter.Rules = append(rules, filter.Rules[output:]...)
+				filter.Underflows[iptables.Output]++
+				ipt.Tables[iptables.TablenameFilter] = filter
+				s.SetIPTables(ipt)
+			}
+
+			var rwq waiter.Queue
+			rep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &rwq)
+			if err != nil {
+				t.Fatalf("NewEndpoint: %s", err)
+			}
+			defer rep.Close()
+			if err := rep.Bind(tcpip.FullAddress{Addr: localAddr, Port: port}); err != nil {
+				t.Fatalf("Bind: %s", err)
+			}
+
+			var swq waiter.Queue
+			sep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &swq)
+			if err != nil {
+				t.Fatalf("NewEndpoint: %s", err)
+			}
+			defer sep.Close()
+			if err := sep.Connect(tcpip.FullAddress{Addr: localAddr, Port: port}); err != nil {
+				t.Fatalf("Connect: %s", err)
+			}
+			payload := []byte("loop me")
+			if _, _, err := sep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{}); err != nil {
+				t.Fatalf("Write: %s", err)
+			}
+
+			v, _, err := rep.Read(nil)
+			if tc.wantLooped {
+				if err != nil {
+					t.Fatalf("Read: %s", err)
+				}
+				if !bytes.Equal(v, payload) {
+					t.Errorf("got Read() = %q, want = %q", v, payload)
+				}
+			} else if err != tcpip.ErrWouldBlock {
+				t.Errorf("got Read() = (%q, %v), want = (_, %s)", v, err, tcpip.ErrWouldBlock)
+			}
+			if p, ok := e.Read(); ok {
+				t.Errorf("got an outbound packet %+v, want none", p)
+			}
+		})
+	}
+}
+
+// TestOutputRedirect checks that locally generated datagrams redirected to a
+// local port at the Output hook are delivered to the local listener on that
+// port, rather than sent to their original destination.
+func TestOutputRedirect(t *testing.T) {
+	const (
+		nicID        = 1
+		loopbackID   = 2
+		localAddr    = tcpip.Address("\x0a\x00\x00\x02")
+		remoteAddr   = tcpip.Address("\x0a\x00\x00\x01")
+		loopbackAddr = tcpip.Address("\x7f\x00\x00\x01")
+		redirectPort = 8080
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocol{ipv4.NewProtocol()},
+		TransportProtocols: []stack.TransportProtocol{udp.NewProtocol()},
+		ConnTrackMax:       16,
+	})
+	e := channel.New(1, 1280, "")
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+	}
+	if err := s.CreateNIC(loopbackID, loopback.New()); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", loopbackID, err)
+	}
+	if err := s.AddAddress(loopbackID, ipv4.ProtocolNumber, loopbackAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", loopbackID, ipv4.ProtocolNumber, loopbackAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	// iptables -t nat -A OUTPUT -p udp -j REDIRECT --to-ports 8080
+	ipt := iptables.DefaultTables()
+	nat := ipt.Tables[iptables.TablenameNat]
+	output := nat.BuiltinChains[iptables.Output]
+	rules := append([]iptables.Rule(nil), nat.Rules[:output]...)
+	rules = append(rules, iptables.Rule{
+		Filter: iptables.IPHeaderFilter{Protocol: header.UDPProtocolNumber},
+		Target: iptables.RedirectTarget{Port: redirectPort},
+	})
+	nat.Rules = append(rules, nat.Rules[output:]...)
+	nat.Underflows[iptables.Output]++
+	ipt.Tables[iptables.TablenameNat] = nat
+	s.SetIPTables(ipt)
+
+	var rwq waiter.Queue
+	rep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &rwq)
+	if err != nil {
+		t.Fatalf("NewEndpoint: %s", err)
+	}
+	defer rep.Close()
+	if err := rep.Bind(tcpip.FullAddress{Addr: loopbackAddr, Port: redirectPort}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+
+	var swq waiter.Queue
+	sep, err := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &swq)
+	if err != nil {
+		t.Fatalf("NewEndpoint: %s", err)
+	}
+	defer sep.Close()
+	if err := sep.Connect(tcpip.FullAddress{Addr: remoteAddr, Port: 53}); err != nil {
+		t.Fatalf("Connect: %s", err)
+	}
+	payload := []byte("redirect me")
+	if _, _, err := sep.Write(tcpip.SlicePayload(payload), tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	if p, ok := e.Read(); ok {
+		t.Errorf("got an outbound packet %+v, want none", p)
+	}
+	var from tcpip.FullAddress
+	v, _, err := rep.Read(&from)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+	if !bytes.Equal(v, payload) {
+		t.Errorf("got Read() = %q, want = %q", v, payload)
+	}
+	if from.Addr != localAddr {
+		t.Errorf("got sender address %s, want %s", from.Addr, localAddr)
+	}
+}
+
 // makeHdrAndPayload generates a randomize packet. hdrLength indicates how much
 // data should already be in the header before WritePacket. extraLength
 // indicates how much extra space should be in the header. The payload is made
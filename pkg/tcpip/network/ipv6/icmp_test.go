@@ -356,9 +356,10 @@ func routeICMPv6Packet(t *testing.T, args routeArgs, fn func(*testing.T, header.
 	}
 }
 
-func TestLinkResolution(t *testing.T) {
-	c := newTestContext(t)
-	defer c.cleanup()
+// exchangeEcho sends an echo request from c.s0 to c.s1 and routes the
+// resulting NDP and echo traffic between them.
+func exchangeEcho(t *testing.T, c *testContext) {
+	t.Helper()
 
 	r, err := c.s0.FindRoute(1, lladdr0, lladdr1, ProtocolNumber, false /* multicastLoop */)
 	if err != nil {
@@ -413,6 +414,113 @@ func TestLinkResolution(t *testing.T) {
 	}
 }
 
+func TestLinkResolution(t *testing.T) {
+	c := newTestContext(t)
+	defer c.cleanup()
+
+	exchangeEcho(t, c)
+}
+
+func TestEchoStats(t *testing.T) {
+	c := newTestContext(t)
+	defer c.cleanup()
+
+	exchangeEcho(t, c)
+
+	for _, tc := range []struct {
+		name string
+		s    *stack.Stack
+		// sent and received are the ICMPv6 types sent and received by s.
+		sent, received header.ICMPv6Type
+		// ndpSent and ndpReceived are the NDP types counted as sent and
+		// received by s.
+		ndpSent, ndpReceived header.ICMPv6Type
+		// packetsSent is the number of IPv6 packets counted as sent by s.
+		packetsSent uint64
+	}{
+		{
+			name:     "requester",
+			s:        c.s0,
+			sent:     header.ICMPv6EchoRequest,
+			received: header.ICMPv6EchoReply,
+			// Neighbor solicitations sent for link address resolution
+			// bypass the route, and aren't counted.
+			ndpReceived: header.ICMPv6NeighborAdvert,
+			packetsSent: 1,
+		},
+		{
+			name:        "responder",
+			s:           c.s1,
+			sent:        header.ICMPv6EchoReply,
+			received:    header.ICMPv6EchoRequest,
+			ndpSent:     header.ICMPv6NeighborAdvert,
+			ndpReceived: header.ICMPv6NeighborSolicit,
+			packetsSent: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := tc.s.Stats()
+			for _, stat := range []struct {
+				name    string
+				counter *tcpip.StatCounter
+				want    uint64
+			}{
+				{name: "IPv6.PacketsReceived", counter: stats.IPv6.PacketsReceived, want: 2},
+				{name: "IPv6.PacketsSent", counter: stats.IPv6.PacketsSent, want: tc.packetsSent},
+				{name: "IPv6.OutgoingPacketErrors", counter: stats.IPv6.OutgoingPacketErrors, want: 0},
+				{name: "IP.PacketsReceived", counter: stats.IP.PacketsReceived, want: 2},
+				{name: "IP.PacketsSent", counter: stats.IP.PacketsSent, want: tc.packetsSent},
+			} {
+				if got := stat.counter.Value(); got != stat.want {
+					t.Errorf("got %s = %d, want = %d", stat.name, got, stat.want)
+				}
+			}
+
+			want := map[string]map[header.ICMPv6Type]uint64{
+				"sent":     {tc.sent: 1},
+				"received": {tc.received: 1, tc.ndpReceived: 1},
+			}
+			if tc.ndpSent != 0 {
+				want["sent"][tc.ndpSent] = 1
+			}
+			for dir, s := range map[string]tcpip.ICMPv6PacketStats{
+				"sent":     stats.ICMP.V6PacketsSent.ICMPv6PacketStats,
+				"received": stats.ICMP.V6PacketsReceived.ICMPv6PacketStats,
+			} {
+				for typ, counter := range icmpv6TypeCounters(s) {
+					if got, want := counter.Value(), want[dir][typ]; got != want {
+						t.Errorf("got %d %s packets of type %d, want = %d", got, dir, typ, want)
+					}
+				}
+			}
+			if got := stats.ICMP.V6PacketsSent.Dropped.Value(); got != 0 {
+				t.Errorf("got V6PacketsSent.Dropped = %d, want = 0", got)
+			}
+			if got := stats.ICMP.V6PacketsReceived.Invalid.Value(); got != 0 {
+				t.Errorf("got V6PacketsReceived.Invalid = %d, want = 0", got)
+			}
+		})
+	}
+}
+
+// icmpv6TypeCounters returns the counters of s by the ICMPv6 message type they
+// count.
+func icmpv6TypeCounters(s tcpip.ICMPv6PacketStats) map[header.ICMPv6Type]*tcpip.StatCounter {
+	return map[header.ICMPv6Type]*tcpip.StatCounter{
+		header.ICMPv6DstUnreachable:  s.DstUnreachable,
+		header.ICMPv6PacketTooBig:    s.PacketTooBig,
+		header.ICMPv6TimeExceeded:    s.TimeExceeded,
+		header.ICMPv6ParamProblem:    s.ParamProblem,
+		header.ICMPv6EchoRequest:     s.EchoRequest,
+		header.ICMPv6EchoReply:       s.EchoReply,
+		header.ICMPv6RouterSolicit:   s.RouterSolicit,
+		header.ICMPv6RouterAdvert:    s.RouterAdvert,
+		header.ICMPv6NeighborSolicit: s.NeighborSolicit,
+		header.ICMPv6NeighborAdvert:  s.NeighborAdvert,
+		header.ICMPv6RedirectMsg:     s.RedirectMsg,
+	}
+}
+
 func TestICMPChecksumValidationSimple(t *testing.T) {
 	var tllData [header.NDPLinkLayerAddressSize]byte
 	header.NDPOptions(tllData[:]).Serialize(header.NDPOptionsSerializer{
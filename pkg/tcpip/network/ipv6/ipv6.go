@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
@@ -50,6 +51,7 @@ type endpoint struct {
 	linkAddrCache stack.LinkAddressCache
 	dispatcher    stack.TransportDispatcher
 	protocol      *protocol
+	stack         *stack.Stack
 }
 
 // DefaultTTL is the default hop limit for this endpoint.
@@ -133,8 +135,13 @@ func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, params stack.Netw
 	if r.Loop&stack.PacketOut == 0 {
 		return nil
 	}
+	if !e.handleOutbound(pkt) {
+		// ip6tables dropped the packet.
+		return nil
+	}
 
 	r.Stats().IP.PacketsSent.Increment()
+	r.Stats().IPv6.PacketsSent.Increment()
 	return e.linkEP.WritePacket(r, gso, ProtocolNumber, pkt)
 }
 
@@ -154,9 +161,42 @@ func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts []tcpip.Pac
 		pkts[i].NetworkHeader = buffer.View(ip)
 	}
 
+	// Packets refused by ip6tables are dropped, but reported as written.
+	var kept []tcpip.PacketBuffer
+	for i := range pkts {
+		if !e.handleOutbound(pkts[i]) {
+			if kept == nil {
+				kept = append(make([]tcpip.PacketBuffer, 0, len(pkts)), pkts[:i]...)
+			}
+			continue
+		}
+		if kept != nil {
+			kept = append(kept, pkts[i])
+		}
+	}
+	var dropped int
+	if kept != nil {
+		dropped = len(pkts) - len(kept)
+		pkts = kept
+		if len(pkts) == 0 {
+			return dropped, nil
+		}
+	}
 	n, err := e.linkEP.WritePackets(r, gso, pkts, ProtocolNumber)
 	r.Stats().IP.PacketsSent.IncrementBy(uint64(n))
-	return n, err
+	r.Stats().IPv6.PacketsSent.IncrementBy(uint64(n))
+	return n + dropped, err
+}
+
+// handleOutbound runs pkt, an outbound packet whose network and transport
+// headers are in pkt.Header, through the ip6tables Output hook. It returns
+// false if pkt should be dropped.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (e *endpoint) handleOutbound(pkt tcpip.PacketBuffer) bool {
+	pkt.TransportHeader = pkt.Header.View()[len(pkt.NetworkHeader):]
+	ipt := e.stack.IP6Tables()
+	return ipt.Check(iptables.Output, &pkt, e.stack.FindNICNameFromID(e.nicID))
 }
 
 // WriteHeaderIncludedPacker implements stack.NetworkEndpoint. It is not yet
@@ -179,6 +219,20 @@ func (e *endpoint) HandlePacket(r *stack.Route, pkt tcpip.PacketBuffer) {
 	pkt.Data.TrimFront(header.IPv6MinimumSize)
 	pkt.Data.CapLength(int(h.PayloadLength()))
 
+	ipt := e.stack.IP6Tables()
+	nicName := e.stack.FindNICNameFromID(e.nicID)
+	if ok := ipt.Check(iptables.Prerouting, &pkt, nicName); !ok {
+		// ip6tables is telling us to drop the packet.
+		return
+	}
+
+	// ip6tables filtering. All packets that reach here are intended for
+	// this machine and will not be forwarded.
+	if ok := ipt.Check(iptables.Input, &pkt, nicName); !ok {
+		// ip6tables is telling us to drop the packet.
+		return
+	}
+
 	p := h.TransportProtocol()
 	if p == header.ICMPv6ProtocolNumber {
 		e.handleICMP(r, headerView, pkt)
@@ -186,6 +240,7 @@ func (e *endpoint) HandlePacket(r *stack.Route, pkt tcpip.PacketBuffer) {
 	}
 
 	r.Stats().IP.PacketsDelivered.Increment()
+	r.Stats().IPv6.PacketsDelivered.Increment()
 	e.dispatcher.DeliverTransportPacket(r, p, pkt)
 }
 
@@ -230,6 +285,7 @@ func (p *protocol) NewEndpoint(nicID tcpip.NICID, addrWithPrefix tcpip.AddressWi
 		linkAddrCache: linkAddrCache,
 		dispatcher:    dispatcher,
 		protocol:      p,
+		stack:         st,
 	}, nil
 }
 
@@ -55,6 +55,27 @@ type PacketBuffer struct {
 	LinkHeader      buffer.View
 	NetworkHeader   buffer.View
 	TransportHeader buffer.View
+
+	// NoTrack is set by iptables rules that exempt the packet from
+	// connection tracking, e.g. "-t raw -j CT --notrack".
+	NoTrack bool
+
+	// ConnState is the state of the packet's connection, as classified by
+	// iptables connection tracking. It holds one of the iptables.ConnState*
+	// values, or 0 if the packet wasn't classified.
+	ConnState uint8
+
+	// ConnTracked is set for locally generated packets that are looped
+	// back to the stack, whose connection was already tracked, and whose
+	// addresses were already translated, at the Output hook. Like in Linux,
+	// where they keep their conntrack entry, they aren't tracked again and
+	// skip the nat table.
+	ConnTracked bool
+
+	// ChecksumPending is set for outbound packets whose transport checksum
+	// wasn't computed, because the link endpoint offloads it. Their
+	// checksum field holds zero.
+	ChecksumPending bool
 }
 
 // Clone makes a copy of pk. It clones the Data field, which creates a new
@@ -0,0 +1,64 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+)
+
+// SendICMPv4Error sends an ICMPv4 error message of type typ and code in
+// response to pkt, which was received over r. It is meant for errors generated
+// on behalf of the network layer, such as by iptables REJECT rules or on TTL
+// expiry.
+//
+// The message is built by iptables.ICMPv4Error, which limits how much of pkt
+// is quoted, and is subject to both the stack's global ICMP rate limit and its
+// per-destination limit (see SetICMPErrorInterval). SendICMPv4Error returns
+// true if the message was sent.
+//
+// Preconditions: r.RemoteAddress is the source of pkt. pkt.NetworkHeader is
+// set.
+func (r *Route) SendICMPv4Error(pkt tcpip.PacketBuffer, typ header.ICMPv4Type, code byte) bool {
+	msg, ok := iptables.ICMPv4Error(pkt, typ, code)
+	if !ok {
+		return false
+	}
+	s := r.Stack()
+	if !s.AllowICMPMessage() || !s.icmpErrorLimiter.Allow(r.RemoteAddress) {
+		s.Stats().ICMP.V4PacketsSent.RateLimited.Increment()
+		return false
+	}
+
+	sent := s.Stats().ICMP.V4PacketsSent
+	if err := r.WritePacket(nil /* gso */, NetworkHeaderParams{Protocol: header.ICMPv4ProtocolNumber, TTL: r.DefaultTTL(), TOS: DefaultTOS}, tcpip.PacketBuffer{
+		Header: buffer.NewPrependable(int(r.MaxHeaderLength())),
+		Data:   msg.ToVectorisedView(),
+	}); err != nil {
+		sent.Dropped.Increment()
+		return false
+	}
+	switch typ {
+	case header.ICMPv4DstUnreachable:
+		sent.DstUnreachable.Increment()
+	case header.ICMPv4TimeExceeded:
+		sent.TimeExceeded.Increment()
+	case header.ICMPv4ParamProblem:
+		sent.ParamProblem.Increment()
+	}
+	return true
+}
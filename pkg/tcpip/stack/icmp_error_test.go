@@ -0,0 +1,100 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// TestSendICMPv4ErrorFlood checks that a flood of packets eliciting ICMP
+// errors only produces a bounded number of them.
+func TestSendICMPv4ErrorFlood(t *testing.T) {
+	const (
+		nicID      = 1
+		localAddr  = tcpip.Address("\x0a\x00\x00\x01")
+		remoteAddr = tcpip.Address("\x0a\x00\x00\x02")
+		floodSize  = 100
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv4.NewProtocol()},
+	})
+	ep := channel.New(floodSize, defaultMTU, "")
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	if err := s.AddAddress(nicID, ipv4.ProtocolNumber, localAddr); err != nil {
+		t.Fatalf("AddAddress(%d, %d, %s): %s", nicID, ipv4.ProtocolNumber, localAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+	r, err := s.FindRoute(nicID, localAddr, remoteAddr, ipv4.ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		t.Fatalf("FindRoute(%d, %s, %s, %d, false): %s", nicID, localAddr, remoteAddr, ipv4.ProtocolNumber, err)
+	}
+	defer r.Release()
+	if got, want := s.ICMPErrorInterval(), iptables.DefaultICMPErrorInterval; got != want {
+		t.Errorf("ICMPErrorInterval() = %v, want %v", got, want)
+	}
+
+	hdr := buffer.NewView(header.IPv4MinimumSize + header.UDPMinimumSize)
+	header.IPv4(hdr).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(hdr)),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     remoteAddr,
+		DstAddr:     localAddr,
+	})
+	pkt := tcpip.PacketBuffer{
+		Data:          hdr[header.IPv4MinimumSize:].ToVectorisedView(),
+		NetworkHeader: hdr[:header.IPv4MinimumSize],
+	}
+
+	sent := 0
+	for i := 0; i < floodSize; i++ {
+		if r.SendICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable) {
+			sent++
+		}
+	}
+	if got := ep.Drain(); got != sent {
+		t.Errorf("SendICMPv4Error reported %d messages sent, but %d were written", sent, got)
+	}
+	if sent == 0 || sent >= floodSize {
+		t.Errorf("sent %d ICMP errors in response to %d packets, want a positive number bounded by the rate limit", sent, floodSize)
+	}
+	if got, want := s.Stats().ICMP.V4PacketsSent.RateLimited.Value(), uint64(floodSize-sent); got != want {
+		t.Errorf("got RateLimited = %d, want %d", got, want)
+	}
+
+	// Without per-destination limiting, only the global limit applies.
+	s.SetICMPErrorInterval(0)
+	if got := s.ICMPErrorInterval(); got != 0 {
+		t.Errorf("ICMPErrorInterval() = %v, want 0", got)
+	}
+	if !r.SendICMPv4Error(pkt, header.ICMPv4DstUnreachable, header.ICMPv4PortUnreachable) {
+		t.Errorf("SendICMPv4Error with rate limiting disabled = false, want true")
+	}
+	if got, want := ep.Drain(), 1; got != want {
+		t.Errorf("got %d packets written, want %d", got, want)
+	}
+}
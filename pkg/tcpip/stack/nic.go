@@ -1009,6 +1009,38 @@ func (n *NIC) leaveGroupLocked(addr tcpip.Address) *tcpip.Error {
 	return nil
 }
 
+// linkMulticastGroups returns the link-layer multicast addresses n receives
+// packets for because of the network-layer multicast groups it joined, sorted
+// by address. Only NICs with Ethernet addresses have link-layer multicast
+// addresses.
+func (n *NIC) linkMulticastGroups() []LinkMulticastGroup {
+	if len(n.linkEP.LinkAddress()) != header.EthernetAddressSize {
+		return nil
+	}
+
+	n.mu.RLock()
+	users := make(map[tcpip.LinkAddress]int)
+	for id, joins := range n.mu.mcastJoins {
+		if joins == 0 {
+			continue
+		}
+		switch len(id.LocalAddress) {
+		case header.IPv4AddressSize:
+			users[header.EthernetAddressFromMulticastIPv4Address(id.LocalAddress)]++
+		case header.IPv6AddressSize:
+			users[header.EthernetAddressFromMulticastIPv6Address(id.LocalAddress)]++
+		}
+	}
+	n.mu.RUnlock()
+
+	groups := make([]LinkMulticastGroup, 0, len(users))
+	for addr, u := range users {
+		groups = append(groups, LinkMulticastGroup{Address: addr, Users: u})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Address < groups[j].Address })
+	return groups
+}
+
 func handlePacket(protocol tcpip.NetworkProtocolNumber, dst, src tcpip.Address, localLinkAddr, remotelinkAddr tcpip.LinkAddress, ref *referencedNetworkEndpoint, pkt tcpip.PacketBuffer) {
 	r := makeRoute(protocol, dst, src, localLinkAddr, ref, false /* handleLocal */, false /* multicastLoop */)
 	r.RemoteLinkAddress = remotelinkAddr
@@ -1066,6 +1098,9 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, local tcpip.Link
 	if netProto.Number() == header.IPv4ProtocolNumber || netProto.Number() == header.IPv6ProtocolNumber {
 		n.stack.stats.IP.PacketsReceived.Increment()
 	}
+	if netProto.Number() == header.IPv6ProtocolNumber {
+		n.stack.stats.IPv6.PacketsReceived.Increment()
+	}
 
 	if len(pkt.Data.First()) < netProto.MinimumPacketSize() {
 		n.stack.stats.MalformedRcvdPackets.Increment()
@@ -1080,6 +1115,9 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, local tcpip.Link
 		// function even though the packets didn't come from the physical interface
 		// so don't drop those.
 		n.stack.stats.IP.InvalidSourceAddressesReceived.Increment()
+		if protocol == header.IPv6ProtocolNumber {
+			n.stack.stats.IPv6.InvalidSourceAddressesReceived.Increment()
+		}
 		return
 	}
 	if ref := n.getRef(protocol, dst); ref != nil {
@@ -1095,6 +1133,9 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, local tcpip.Link
 		r, err := n.stack.FindRoute(0, "", dst, protocol, false /* multicastLoop */)
 		if err != nil {
 			n.stack.stats.IP.InvalidDestinationAddressesReceived.Increment()
+			if protocol == header.IPv6ProtocolNumber {
+				n.stack.stats.IPv6.InvalidDestinationAddressesReceived.Increment()
+			}
 			return
 		}
 		defer r.Release()
@@ -1122,6 +1163,9 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, local tcpip.Link
 			// TODO(b/128629022): use route.WritePacket.
 			if err := n.linkEP.WritePacket(&r, nil /* gso */, protocol, pkt); err != nil {
 				r.Stats().IP.OutgoingPacketErrors.Increment()
+				if protocol == header.IPv6ProtocolNumber {
+					r.Stats().IPv6.OutgoingPacketErrors.Increment()
+				}
 			} else {
 				n.stats.Tx.Packets.Increment()
 				n.stats.Tx.Bytes.IncrementBy(uint64(pkt.Header.UsedLength() + pkt.Data.Size()))
@@ -1133,6 +1177,9 @@ func (n *NIC) DeliverNetworkPacket(linkEP LinkEndpoint, remote, local tcpip.Link
 	// If a packet socket handled the packet, don't treat it as invalid.
 	if len(packetEPs) == 0 {
 		n.stack.stats.IP.InvalidDestinationAddressesReceived.Increment()
+		if protocol == header.IPv6ProtocolNumber {
+			n.stack.stats.IPv6.InvalidDestinationAddressesReceived.Increment()
+		}
 	}
 }
 
@@ -0,0 +1,67 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
+)
+
+var _ iptables.Responder = (*Stack)(nil)
+
+// SendICMPv4Error implements iptables.Responder.SendICMPv4Error.
+func (s *Stack) SendICMPv4Error(pkt tcpip.PacketBuffer, typ header.ICMPv4Type, code byte) bool {
+	r, ok := s.responseRoute(pkt)
+	if !ok {
+		return false
+	}
+	defer r.Release()
+	return r.SendICMPv4Error(pkt, typ, code)
+}
+
+// SendTCPReset implements iptables.Responder.SendTCPReset.
+func (s *Stack) SendTCPReset(pkt tcpip.PacketBuffer) bool {
+	rst, ok := iptables.TCPReset(pkt)
+	if !ok {
+		return false
+	}
+	r, ok := s.responseRoute(pkt)
+	if !ok {
+		return false
+	}
+	defer r.Release()
+
+	hdr := buffer.NewPrependable(int(r.MaxHeaderLength()) + len(rst))
+	copy(hdr.Prepend(len(rst)), rst)
+	if err := r.WritePacket(nil /* gso */, NetworkHeaderParams{Protocol: header.TCPProtocolNumber, TTL: r.DefaultTTL(), TOS: DefaultTOS}, tcpip.PacketBuffer{
+		Header: hdr,
+	}); err != nil {
+		return false
+	}
+	s.Stats().TCP.ResetsSent.Increment()
+	return true
+}
+
+// responseRoute returns a route from the destination of the IPv4 packet pkt
+// back to its source.
+//
+// Precondition: pkt.NetworkHeader is set.
+func (s *Stack) responseRoute(pkt tcpip.PacketBuffer) (Route, bool) {
+	ipHdr := header.IPv4(pkt.NetworkHeader)
+	r, err := s.FindRoute(0, ipHdr.DestinationAddress(), ipHdr.SourceAddress(), header.IPv4ProtocolNumber, false /* multicastLoop */)
+	return r, err == nil
+}
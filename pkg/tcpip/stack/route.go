@@ -161,6 +161,9 @@ func (r *Route) WritePacket(gso *GSO, params NetworkHeaderParams, pkt tcpip.Pack
 	err := r.ref.ep.WritePacket(r, gso, params, pkt)
 	if err != nil {
 		r.Stats().IP.OutgoingPacketErrors.Increment()
+		if r.NetProto == header.IPv6ProtocolNumber {
+			r.Stats().IPv6.OutgoingPacketErrors.Increment()
+		}
 	} else {
 		r.ref.nic.stats.Tx.Packets.Increment()
 		r.ref.nic.stats.Tx.Bytes.IncrementBy(uint64(pkt.Header.UsedLength() + pkt.Data.Size()))
@@ -177,6 +180,9 @@ func (r *Route) WritePackets(gso *GSO, pkts []tcpip.PacketBuffer, params Network
 	n, err := r.ref.ep.WritePackets(r, gso, pkts, params)
 	if err != nil {
 		r.Stats().IP.OutgoingPacketErrors.IncrementBy(uint64(len(pkts) - n))
+		if r.NetProto == header.IPv6ProtocolNumber {
+			r.Stats().IPv6.OutgoingPacketErrors.IncrementBy(uint64(len(pkts) - n))
+		}
 	}
 	r.ref.nic.stats.Tx.Packets.IncrementBy(uint64(n))
 	payloadSize := 0
@@ -197,6 +203,9 @@ func (r *Route) WriteHeaderIncludedPacket(pkt tcpip.PacketBuffer) *tcpip.Error {
 
 	if err := r.ref.ep.WriteHeaderIncludedPacket(r, pkt); err != nil {
 		r.Stats().IP.OutgoingPacketErrors.Increment()
+		if r.NetProto == header.IPv6ProtocolNumber {
+			r.Stats().IPv6.OutgoingPacketErrors.Increment()
+		}
 		return err
 	}
 	r.ref.nic.stats.Tx.Packets.Increment()
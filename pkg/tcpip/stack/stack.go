@@ -430,6 +430,10 @@ type Stack struct {
 	// protected by tablesMu.`
 	tables iptables.IPTables
 
+	// ip6tables are the ip6tables packet filtering and manipulation rules,
+	// the IPv6 counterpart of tables. They are protected by tablesMu.
+	ip6tables iptables.IPTables
+
 	// resumableEndpoints is a list of endpoints that need to be resumed if the
 	// stack is being restored.
 	resumableEndpoints []ResumableEndpoint
@@ -438,6 +442,14 @@ type Stack struct {
 	// by the stack.
 	icmpRateLimiter *ICMPRateLimiter
 
+	// icmpErrorLimiter limits the rate of ICMP errors sent to each
+	// destination by SendICMPv4Error.
+	icmpErrorLimiter *iptables.ICMPErrorLimiter
+
+	// connTrack tracks the connections of the IPv4 packets sent and
+	// received by the stack. It is nil if connections aren't tracked.
+	connTrack *iptables.ConnTrack
+
 	// seed is a one-time random value initialized at stack startup
 	// and is used to seed the TCP port picking on active connections
 	//
@@ -525,6 +537,11 @@ type Options struct {
 	// OpaqueIIDOpts hold the options for generating opaque interface identifiers
 	// (IIDs) as outlined by RFC 7217.
 	OpaqueIIDOpts OpaqueInterfaceIdentifierOptions
+
+	// ConnTrackMax is the initial maximum number of connections tracked by
+	// the stack, see iptables.DefaultConnTrackMax. If it is zero,
+	// connections aren't tracked.
+	ConnTrackMax int
 }
 
 // TransportEndpointInfo holds useful information about a transport endpoint
@@ -633,6 +650,7 @@ func New(opts Options) *Stack {
 		stats:                opts.Stats.FillIn(),
 		handleLocal:          opts.HandleLocal,
 		icmpRateLimiter:      NewICMPRateLimiter(),
+		icmpErrorLimiter:     iptables.NewICMPErrorLimiter(clock),
 		seed:                 generateRandUint32(),
 		ndpConfigs:           opts.NDPConfigs,
 		autoGenIPv6LinkLocal: opts.AutoGenIPv6LinkLocal,
@@ -641,6 +659,14 @@ func New(opts Options) *Stack {
 		opaqueIIDOpts:        opts.OpaqueIIDOpts,
 	}
 
+	s.ip6tables.NetworkProtocol = header.IPv6ProtocolNumber
+	s.tables.MalformedPackets = s.stats.IP.IPTablesMalformedPackets
+	s.ip6tables.MalformedPackets = s.stats.IPv6.IPTablesMalformedPackets
+	if opts.ConnTrackMax != 0 {
+		s.connTrack = iptables.NewConnTrack(clock, opts.ConnTrackMax)
+		s.tables.ConnTrack = s.connTrack
+	}
+
 	// Add specified network protocols.
 	for _, netProto := range opts.NetworkProtocols {
 		s.networkProtocols[netProto.Number()] = netProto
@@ -970,6 +996,21 @@ type NICInfo struct {
 	// Context is user-supplied data optionally supplied in CreateNICWithOptions.
 	// See type NICOptions for more details.
 	Context NICContext
+
+	// LinkMulticastGroups are the link-layer multicast addresses the NIC
+	// receives packets for, sorted by address.
+	LinkMulticastGroups []LinkMulticastGroup
+}
+
+// LinkMulticastGroup is a link-layer multicast address that a NIC receives
+// packets for because it joined network-layer multicast groups.
+type LinkMulticastGroup struct {
+	// Address is the link-layer multicast address.
+	Address tcpip.LinkAddress
+
+	// Users is the number of network-layer multicast groups joined by the
+	// NIC that map to Address.
+	Users int
 }
 
 // HasNIC returns true if the NICID is defined in the stack.
@@ -980,6 +1021,19 @@ func (s *Stack) HasNIC(id tcpip.NICID) bool {
 	return ok
 }
 
+// FindNICNameFromID returns the name of the NIC with the given NICID, or ""
+// if there is no such NIC.
+func (s *Stack) FindNICNameFromID(id tcpip.NICID) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return ""
+	}
+	return nic.name
+}
+
 // NICInfo returns a map of NICIDs to their associated information.
 func (s *Stack) NICInfo() map[tcpip.NICID]NICInfo {
 	s.mu.RLock()
@@ -994,13 +1048,14 @@ func (s *Stack) NICInfo() map[tcpip.NICID]NICInfo {
 			Loopback:    nic.isLoopback(),
 		}
 		nics[id] = NICInfo{
-			Name:              nic.name,
-			LinkAddress:       nic.linkEP.LinkAddress(),
-			ProtocolAddresses: nic.PrimaryAddresses(),
-			Flags:             flags,
-			MTU:               nic.linkEP.MTU(),
-			Stats:             nic.stats,
-			Context:           nic.context,
+			Name:                nic.name,
+			LinkAddress:         nic.linkEP.LinkAddress(),
+			ProtocolAddresses:   nic.PrimaryAddresses(),
+			Flags:               flags,
+			MTU:                 nic.linkEP.MTU(),
+			Stats:               nic.stats,
+			Context:             nic.context,
+			LinkMulticastGroups: nic.linkMulticastGroups(),
 		}
 	}
 	return nics
@@ -1229,6 +1284,35 @@ func (s *Stack) CheckLocalAddress(nicID tcpip.NICID, protocol tcpip.NetworkProto
 	return 0
 }
 
+// DeliverLocalPacket delivers pkt, a locally generated packet of the given
+// network protocol whose network header is at the start of pkt.Data, to the
+// NIC that owns its destination address, as if it had arrived on that NIC. It
+// returns false if the destination address isn't local.
+func (s *Stack) DeliverLocalPacket(protocol tcpip.NetworkProtocolNumber, pkt tcpip.PacketBuffer) bool {
+	s.mu.RLock()
+	netProto, ok := s.networkProtocols[protocol]
+	if !ok || len(pkt.Data.First()) < netProto.MinimumPacketSize() {
+		s.mu.RUnlock()
+		return false
+	}
+	src, dst := netProto.ParseAddresses(pkt.Data.First())
+	var nic *NIC
+	var ref *referencedNetworkEndpoint
+	for _, n := range s.nics {
+		if ref = n.findEndpoint(protocol, dst, CanBePrimaryEndpoint); ref != nil {
+			nic = n
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if ref == nil {
+		return false
+	}
+	handlePacket(protocol, dst, src, nic.linkEP.LinkAddress(), "" /* remoteLinkAddr */, ref, pkt)
+	return true
+}
+
 // SetPromiscuousMode enables or disables promiscuous mode in the given NIC.
 func (s *Stack) SetPromiscuousMode(nicID tcpip.NICID, enable bool) *tcpip.Error {
 	s.mu.RLock()
@@ -1622,13 +1706,48 @@ func (s *Stack) IPTables() iptables.IPTables {
 	return t
 }
 
-// SetIPTables sets the stack's iptables.
+// SetIPTables sets the stack's iptables. Tables that don't have rule counters
+// are given zeroed ones. The tables filter IPv4 packets, track connections
+// with the stack's connection tracking table, and count malformed packets in
+// the stack's IP stats.
 func (s *Stack) SetIPTables(ipt iptables.IPTables) {
+	ipt.InitCounters()
+	ipt.NetworkProtocol = header.IPv4ProtocolNumber
+	ipt.ConnTrack = s.connTrack
+	ipt.MalformedPackets = s.stats.IP.IPTablesMalformedPackets
 	s.tablesMu.Lock()
 	s.tables = ipt
 	s.tablesMu.Unlock()
 }
 
+// IP6Tables returns the stack's ip6tables.
+func (s *Stack) IP6Tables() iptables.IPTables {
+	s.tablesMu.RLock()
+	t := s.ip6tables
+	s.tablesMu.RUnlock()
+	return t
+}
+
+// SetIP6Tables sets the stack's ip6tables. As with SetIPTables, tables that
+// don't have rule counters are given zeroed ones. The tables filter IPv6
+// packets, don't track connections, and count malformed packets in the stack's
+// IPv6 stats.
+func (s *Stack) SetIP6Tables(ipt iptables.IPTables) {
+	ipt.InitCounters()
+	ipt.NetworkProtocol = header.IPv6ProtocolNumber
+	ipt.ConnTrack = nil
+	ipt.MalformedPackets = s.stats.IPv6.IPTablesMalformedPackets
+	s.tablesMu.Lock()
+	s.ip6tables = ipt
+	s.tablesMu.Unlock()
+}
+
+// ConnTrack returns the stack's connection tracking table, or nil if
+// connections aren't tracked.
+func (s *Stack) ConnTrack() *iptables.ConnTrack {
+	return s.connTrack
+}
+
 // ICMPLimit returns the maximum number of ICMP messages that can be sent
 // in one second.
 func (s *Stack) ICMPLimit() rate.Limit {
@@ -1659,6 +1778,20 @@ func (s *Stack) AllowICMPMessage() bool {
 	return s.icmpRateLimiter.Allow()
 }
 
+// ICMPErrorInterval returns the time it takes a destination to be allowed
+// another ICMP error by SendICMPv4Error.
+func (s *Stack) ICMPErrorInterval() time.Duration {
+	return s.icmpErrorLimiter.Interval()
+}
+
+// SetICMPErrorInterval sets the time it takes a destination to be allowed
+// another ICMP error by SendICMPv4Error. It corresponds to Linux's
+// net.ipv4.icmp_ratelimit. An interval of 0 disables per-destination rate
+// limiting.
+func (s *Stack) SetICMPErrorInterval(interval time.Duration) {
+	s.icmpErrorLimiter.SetInterval(interval)
+}
+
 // IsAddrTentative returns true if addr is tentative on the NIC with ID id.
 //
 // Note that if addr is not associated with a NIC with id ID, then this
@@ -2019,6 +2019,63 @@ func TestNICContextPreservation(t *testing.T) {
 	}
 }
 
+// TestNICLinkMulticastGroups tests that NICInfo reports the link-layer
+// multicast addresses of the multicast groups joined by a NIC.
+func TestNICLinkMulticastGroups(t *testing.T) {
+	const nicID = 1
+	// All-nodes and the site-local all-nodes groups map to the same Ethernet
+	// address.
+	const (
+		allNodesLinkAddr   = tcpip.LinkAddress("\x33\x33\x00\x00\x00\x01")
+		siteAllNodesAddr   = tcpip.Address("\xff\x05\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+		otherGroupAddr     = tcpip.Address("\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05")
+		otherGroupLinkAddr = tcpip.LinkAddress("\x33\x33\x00\x00\x00\x05")
+	)
+
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocol{ipv6.NewProtocol()},
+	})
+	if err := s.CreateNIC(nicID, channel.New(0, 1280, linkAddr1)); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+
+	groups := func() []stack.LinkMulticastGroup {
+		t.Helper()
+		nicinfo, ok := s.NICInfo()[nicID]
+		if !ok {
+			t.Fatalf("NICInfo() has no NIC %d", nicID)
+		}
+		return nicinfo.LinkMulticastGroups
+	}
+
+	// Enabled IPv6 NICs join the all-nodes group.
+	want := []stack.LinkMulticastGroup{{Address: allNodesLinkAddr, Users: 1}}
+	if diff := cmp.Diff(want, groups()); diff != "" {
+		t.Fatalf("LinkMulticastGroups mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, addr := range []tcpip.Address{siteAllNodesAddr, otherGroupAddr} {
+		if err := s.JoinGroup(ipv6.ProtocolNumber, nicID, addr); err != nil {
+			t.Fatalf("JoinGroup(%d, %d, %s) = %s", ipv6.ProtocolNumber, nicID, addr, err)
+		}
+	}
+	want = []stack.LinkMulticastGroup{
+		{Address: allNodesLinkAddr, Users: 2},
+		{Address: otherGroupLinkAddr, Users: 1},
+	}
+	if diff := cmp.Diff(want, groups()); diff != "" {
+		t.Fatalf("LinkMulticastGroups mismatch after joins (-want +got):\n%s", diff)
+	}
+
+	if err := s.LeaveGroup(ipv6.ProtocolNumber, nicID, otherGroupAddr); err != nil {
+		t.Fatalf("LeaveGroup(%d, %d, %s) = %s", ipv6.ProtocolNumber, nicID, otherGroupAddr, err)
+	}
+	want = []stack.LinkMulticastGroup{{Address: allNodesLinkAddr, Users: 2}}
+	if diff := cmp.Diff(want, groups()); diff != "" {
+		t.Fatalf("LinkMulticastGroups mismatch after leave (-want +got):\n%s", diff)
+	}
+}
+
 // TestNICAutoGenLinkLocalAddr tests the auto-generation of IPv6 link-local
 // addresses.
 func TestNICAutoGenLinkLocalAddr(t *testing.T) {
@@ -956,6 +956,10 @@ type IPStats struct {
 	// MalformedFragmentsReceived is the total number of IP Fragments that were
 	// dropped due to the fragment failing validation checks.
 	MalformedFragmentsReceived *StatCounter
+
+	// IPTablesMalformedPackets is the total number of IP packets checked by
+	// iptables whose network header was missing or truncated.
+	IPTablesMalformedPackets *StatCounter
 }
 
 // TCPStats collects TCP-specific stats.
@@ -1104,6 +1108,10 @@ type Stats struct {
 	// IP breaks out IP-specific stats (both v4 and v6).
 	IP IPStats
 
+	// IPv6 breaks out IP-specific stats of IPv6 packets only. IPv6 packets
+	// are counted both here and in IP.
+	IPv6 IPStats
+
 	// TCP breaks out TCP-specific stats.
 	TCP TCPStats
 
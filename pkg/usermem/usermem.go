@@ -392,16 +392,54 @@ func isASCIIWhitespace(b byte) bool {
 //
 // Preconditions: As for CopyInVec.
 func CopyInt32StringsInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dsts []int32, opts IOOpts) (int64, error) {
-	if len(dsts) == 0 {
+	return copyIntStringsInVec(ctx, uio, ars, len(dsts), opts, func(j int, s string) error {
+		val, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		dsts[j] = int32(val)
+		return nil
+	})
+}
+
+// CopyInt32StringInVec is equivalent to CopyInt32StringsInVec, but copies at
+// most one int32.
+func CopyInt32StringInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dst *int32, opts IOOpts) (int64, error) {
+	dsts := [1]int32{*dst}
+	n, err := CopyInt32StringsInVec(ctx, uio, ars, dsts[:], opts)
+	*dst = dsts[0]
+	return n, err
+}
+
+// CopyUint64StringInVec is equivalent to CopyInt32StringInVec, but copies an
+// unsigned decimal string to a uint64, like Linux's
+// kernel/sysctl.c:proc_doulongvec_minmax(write=1) on 64-bit architectures.
+func CopyUint64StringInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dst *uint64, opts IOOpts) (int64, error) {
+	return copyIntStringsInVec(ctx, uio, ars, 1, opts, func(_ int, s string) error {
+		val, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*dst = val
+		return nil
+	})
+}
+
+// copyIntStringsInVec implements CopyInt32StringsInVec and
+// CopyUint64StringInVec. It copies up to n whitespace-separated strings from
+// the memory mapped at ars in uio and passes each of them to parse along with
+// its index.
+func copyIntStringsInVec(ctx context.Context, uio IO, ars AddrRangeSeq, n int, opts IOOpts, parse func(j int, s string) error) (int64, error) {
+	if n == 0 {
 		return 0, nil
 	}
 
 	buf := make([]byte, ars.NumBytes())
-	n, cperr := CopyInVec(ctx, uio, ars, buf, opts)
-	buf = buf[:n]
+	copied, cperr := CopyInVec(ctx, uio, ars, buf, opts)
+	buf = buf[:copied]
 
 	var i, j int
-	for ; j < len(dsts); j++ {
+	for ; j < n; j++ {
 		// Skip leading whitespace.
 		for i < len(buf) && isASCIIWhitespace(buf[i]) {
 			i++
@@ -417,11 +455,9 @@ func CopyInt32StringsInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dsts [
 		}
 
 		// Parse a single value.
-		val, err := strconv.ParseInt(string(buf[i:nextI]), 10, 32)
-		if err != nil {
+		if err := parse(j, string(buf[i:nextI])); err != nil {
 			return int64(i), syserror.EINVAL
 		}
-		dsts[j] = int32(val)
 
 		i = nextI
 	}
@@ -440,15 +476,6 @@ func CopyInt32StringsInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dsts [
 	return int64(i), nil
 }
 
-// CopyInt32StringInVec is equivalent to CopyInt32StringsInVec, but copies at
-// most one int32.
-func CopyInt32StringInVec(ctx context.Context, uio IO, ars AddrRangeSeq, dst *int32, opts IOOpts) (int64, error) {
-	dsts := [1]int32{*dst}
-	n, err := CopyInt32StringsInVec(ctx, uio, ars, dsts[:], opts)
-	*dst = dsts[0]
-	return n, err
-}
-
 // IOSequence holds arguments to IO methods.
 type IOSequence struct {
 	IO    IO
@@ -299,6 +299,33 @@ func TestCopyInt32StringsInVecRequiresOneValidValue(t *testing.T) {
 	}
 }
 
+func TestCopyUint64StringInVec(t *testing.T) {
+	for _, test := range []struct {
+		str     string
+		n       int
+		final   uint64
+		wantErr error
+	}{
+		{str: "65536\n", n: len("65536\n"), final: 65536},
+		{str: "18446744073709551615", n: len("18446744073709551615"), final: 18446744073709551615},
+		{str: " 4096 8192", n: len(" 4096 "), final: 4096},
+		{str: "18446744073709551616", final: 1, wantErr: syserror.EINVAL},
+		{str: "-1", final: 1, wantErr: syserror.EINVAL},
+		{str: "\n", n: len("\n"), final: 1, wantErr: syserror.EINVAL},
+	} {
+		t.Run(fmt.Sprintf("%q", test.str), func(t *testing.T) {
+			src := BytesIOSequence([]byte(test.str))
+			dst := uint64(1)
+			if n, err := CopyUint64StringInVec(newContext(), src.IO, src.Addrs, &dst, src.Opts); n != int64(test.n) || err != test.wantErr {
+				t.Errorf("CopyUint64StringInVec: got (%d, %v), wanted (%d, %v)", n, err, test.n, test.wantErr)
+			}
+			if dst != test.final {
+				t.Errorf("dst: got %d, wanted %d", dst, test.final)
+			}
+		})
+	}
+}
+
 func TestIOSequenceCopyOut(t *testing.T) {
 	buf := []byte("ABCD")
 	s := BytesIOSequence(buf)
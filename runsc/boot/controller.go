@@ -112,6 +112,12 @@ const (
 	ChangeLogging = "Logging.Change"
 )
 
+// Cache related commands (see cache.go for more details).
+const (
+	CacheStats = "Cache.Stats"
+	TrimCaches = "Cache.Trim"
+)
+
 // ControlSocketAddr generates an abstract unix socket name for the given ID.
 func ControlSocketAddr(id string) string {
 	return fmt.Sprintf("\x00runsc-sandbox.%s", id)
@@ -151,6 +157,7 @@ func newController(fd int, l *Loader) (*controller, error) {
 
 	srv.Register(&debug{})
 	srv.Register(&control.Logging{})
+	srv.Register(&control.Cache{Kernel: l.k})
 	if l.conf.ProfileEnable {
 		srv.Register(&control.Profile{
 			Kernel: l.k,
@@ -49,6 +49,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/iptables"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
@@ -230,6 +231,14 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("enabling strace: %v", err)
 	}
 
+	if args.TotalMem > 0 {
+		// Adjust the total memory returned by the Sentry so that applications that
+		// use /proc/meminfo can make allocations based on this limit. The
+		// network stack sizes its connection tracking table from it.
+		usage.MinimumTotalMemoryBytes = args.TotalMem
+		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
+	}
+
 	// Create an empty network stack because the network namespace may be empty at
 	// this point. Netns is configured before Run() is called. Netstack is
 	// configured using a control uRPC message. Host network is configured inside
@@ -264,13 +273,6 @@ func New(args Args) (*Loader, error) {
 	}
 	log.Infof("CPUs: %d", args.NumCPU)
 
-	if args.TotalMem > 0 {
-		// Adjust the total memory returned by the Sentry so that applications that
-		// use /proc/meminfo can make allocations based on this limit.
-		usage.MinimumTotalMemoryBytes = args.TotalMem
-		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
-	}
-
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
 	if err = k.Init(kernel.InitKernelArgs{
@@ -924,6 +926,9 @@ func newEmptyNetworkStack(conf *Config, clock tcpip.Clock, uniqueID stack.Unique
 			// privileges.
 			RawFactory: raw.EndpointFactory{},
 			UniqueID:   uniqueID,
+			// Size the connection tracking table like Linux does,
+			// from the memory reported to the application.
+			ConnTrackMax: iptables.DefaultConnTrackMax(usage.MinimumTotalMemoryBytes),
 		})}
 
 		// Enable SACK Recovery.
@@ -17,6 +17,7 @@ package cmd
 import (
 	"context"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -43,6 +44,8 @@ type Debug struct {
 	logPackets  string
 	duration    time.Duration
 	ps          bool
+	cacheStats  bool
+	trimCaches  bool
 }
 
 // Name implements subcommands.Command.
@@ -73,6 +76,8 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
+	f.BoolVar(&d.cacheStats, "cache-stats", false, "if true, dumps the stats of the sandbox's caches to the log")
+	f.BoolVar(&d.trimCaches, "trim-caches", false, "if true, releases unused entries from the sandbox's caches")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -135,6 +140,29 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		log.Infof("     *** Stack dump ***\n%s", stacks)
 	}
+	if d.trimCaches {
+		log.Infof("Trimming sandbox caches")
+		trimmed, err := c.Sandbox.TrimCaches()
+		if err != nil {
+			return Errorf("trimming caches: %v", err)
+		}
+		log.Infof("Released %d cache entries", trimmed)
+	}
+	if d.cacheStats {
+		log.Infof("Retrieving sandbox cache stats")
+		stats, err := c.Sandbox.CacheStats()
+		if err != nil {
+			return Errorf("retrieving cache stats: %v", err)
+		}
+		names := make([]string, 0, len(stats))
+		for name := range stats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			log.Infof("     *** Cache %q ***\n%s", name, stats[name])
+		}
+	}
 	if d.profileHeap != "" {
 		f, err := os.Create(d.profileHeap)
 		if err != nil {
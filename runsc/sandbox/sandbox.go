@@ -917,6 +917,40 @@ func (s *Sandbox) Stacks() (string, error) {
 	return stacks, nil
 }
 
+// CacheStats returns the stats of the sandbox's debuggable caches, keyed by
+// cache name.
+func (s *Sandbox) CacheStats() (map[string]string, error) {
+	log.Debugf("Cache stats sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var stats map[string]string
+	if err := conn.Call(boot.CacheStats, nil, &stats); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q cache stats: %v", s.ID, err)
+	}
+	return stats, nil
+}
+
+// TrimCaches trims the sandbox's debuggable caches and returns the number of
+// entries released.
+func (s *Sandbox) TrimCaches() (int, error) {
+	log.Debugf("Trim caches sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var trimmed int
+	if err := conn.Call(boot.TrimCaches, nil, &trimmed); err != nil {
+		return 0, fmt.Errorf("trimming sandbox %q caches: %v", s.ID, err)
+	}
+	return trimmed, nil
+}
+
 // HeapProfile writes a heap profile to the given file.
 func (s *Sandbox) HeapProfile(f *os.File) error {
 	log.Debugf("Heap profile %q", s.ID)
@@ -12,6 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
+#include <limits.h>
 #include <sys/prctl.h>
 #include <sys/ptrace.h>
 #include <sys/types.h>
@@ -26,6 +28,7 @@
 #include "test/util/cleanup.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
+#include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
@@ -181,6 +184,89 @@ TEST(PrctlTest, PDeathSig) {
       << "status = " << status;
 }
 
+// Argument vector installed by SetMMArgv, including the final NUL.
+constexpr char kNewCmdline[] = "foo\0bar";
+
+TEST(PrctlTest, SetMMArgv) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RESOURCE)));
+
+  // Change the argument vector of a child, so that the test process is
+  // unaffected.
+  pid_t child_pid = fork();
+  TEST_PCHECK(child_pid >= 0);
+  if (child_pid == 0) {
+    // kNewCmdline is below the current argument vector, so set the start
+    // first to keep the vector's bounds ordered.
+    const uintptr_t start = reinterpret_cast<uintptr_t>(kNewCmdline);
+    TEST_PCHECK(prctl(PR_SET_MM, PR_SET_MM_ARG_START, start, 0, 0) == 0);
+    TEST_PCHECK(prctl(PR_SET_MM, PR_SET_MM_ARG_END,
+                      start + sizeof(kNewCmdline), 0, 0) == 0);
+
+    char buf[sizeof(kNewCmdline) + 1] = {};
+    const int fd = open("/proc/self/cmdline", O_RDONLY);
+    TEST_PCHECK(fd >= 0);
+    TEST_PCHECK(read(fd, buf, sizeof(buf)) == sizeof(kNewCmdline));
+    TEST_CHECK(memcmp(buf, kNewCmdline, sizeof(kNewCmdline)) == 0);
+    _exit(0);
+  }
+
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
+}
+
+TEST(PrctlTest, SetMMArgvUnmapped) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RESOURCE)));
+
+  // Nothing is mapped at mmap_min_addr in the test process.
+  EXPECT_THAT(prctl(PR_SET_MM, PR_SET_MM_ARG_START, 0x10000, 0, 0),
+              SyscallFailsWithErrno(EFAULT));
+  EXPECT_THAT(prctl(PR_SET_MM, PR_SET_MM_ARG_START, 0, 0, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(PrctlTest, SetMMExeFile) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RESOURCE)));
+  // Linux only allows changing the executable once the original one is no
+  // longer mapped, which is never the case for the test process.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  const TempPath exe = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), "", 0755));
+  const std::string path = exe.path();
+
+  // The executable can only be changed once, so do it in a child.
+  pid_t child_pid = fork();
+  TEST_PCHECK(child_pid >= 0);
+  if (child_pid == 0) {
+    // The new executable must be a regular file.
+    const int dir_fd = open("/", O_RDONLY | O_DIRECTORY);
+    TEST_PCHECK(dir_fd >= 0);
+    TEST_CHECK(prctl(PR_SET_MM, PR_SET_MM_EXE_FILE, dir_fd, 0, 0) == -1 &&
+               errno == EACCES);
+
+    const int fd = open(path.c_str(), O_RDONLY);
+    TEST_PCHECK(fd >= 0);
+    TEST_PCHECK(prctl(PR_SET_MM, PR_SET_MM_EXE_FILE, fd, 0, 0) == 0);
+
+    char buf[PATH_MAX] = {};
+    TEST_PCHECK(readlink("/proc/self/exe", buf, sizeof(buf) - 1) > 0);
+    TEST_CHECK(strcmp(buf, path.c_str()) == 0);
+
+    TEST_CHECK(prctl(PR_SET_MM, PR_SET_MM_EXE_FILE, fd, 0, 0) == -1 &&
+               errno == EPERM);
+    _exit(0);
+  }
+
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
+}
+
 // This test is to validate that calling prctl with PR_SET_MM without the
 // CAP_SYS_RESOURCE returns EPERM.
 TEST(PrctlTest, InvalidPrSetMM) {
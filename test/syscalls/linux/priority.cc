@@ -15,14 +15,17 @@
 #include <sys/resource.h>
 #include <sys/time.h>
 #include <sys/types.h>
+#include <sys/wait.h>
 #include <unistd.h>
 
 #include <string>
 #include <vector>
 
 #include "gtest/gtest.h"
+#include "absl/strings/ascii.h"
 #include "absl/strings/numbers.h"
 #include "absl/strings/str_split.h"
+#include "absl/strings/string_view.h"
 #include "test/util/capability_util.h"
 #include "test/util/fs_util.h"
 #include "test/util/test_util.h"
@@ -130,9 +133,54 @@ TEST(SetpriorityTest, NicenessExposedViaProcfs) {
   std::vector<std::string> pieces = absl::StrSplit(proc_stat, ' ');
   ASSERT_GT(pieces.size(), 20);
 
+  int priority_procfs = 0;
+  ASSERT_TRUE(absl::SimpleAtoi(pieces[17], &priority_procfs));
+  EXPECT_EQ(priority_procfs, 20 + kNiceVal);
+
   int niceness_procfs = 0;
   ASSERT_TRUE(absl::SimpleAtoi(pieces[18], &niceness_procfs));
   EXPECT_EQ(niceness_procfs, kNiceVal);
+
+  // /proc/self/sched shows the kernel priority, 120 + nice.
+  std::string proc_sched;
+  ASSERT_NO_ERRNO(GetContents("/proc/self/sched", &proc_sched));
+  bool found = false;
+  for (absl::string_view line : absl::StrSplit(proc_sched, '\n')) {
+    std::vector<std::string> fields = absl::StrSplit(line, ':');
+    if (fields.size() != 2 ||
+        absl::StripAsciiWhitespace(fields[0]) != "prio") {
+      continue;
+    }
+    int prio = 0;
+    ASSERT_TRUE(
+        absl::SimpleAtoi(absl::StripAsciiWhitespace(fields[1]), &prio));
+    EXPECT_EQ(prio, 120 + kNiceVal);
+    found = true;
+  }
+  EXPECT_TRUE(found) << proc_sched;
+}
+
+// Child processes inherit their parent's nice value.
+TEST(SetpriorityTest, ForkInheritsNice) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_NICE)));
+
+  constexpr int kNiceVal = 7;
+  ASSERT_THAT(setpriority(PRIO_PROCESS, /*who=*/0, kNiceVal),
+              SyscallSucceeds());
+
+  pid_t child = fork();
+  if (child == 0) {
+    errno = 0;
+    TEST_CHECK(getpriority(PRIO_PROCESS, /*who=*/0) == kNiceVal);
+    _exit(0);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
 }
 
 // In the kernel's implementation, values outside the range of [-20, 19] are
@@ -27,6 +27,7 @@
 #include <sys/prctl.h>
 #include <sys/stat.h>
 #include <sys/utsname.h>
+#include <sys/wait.h>
 #include <syscall.h>
 #include <unistd.h>
 
@@ -944,6 +945,51 @@ TEST_P(ProcPidStatTest, HasBasicFields) {
 INSTANTIATE_TEST_SUITE_P(SelfAndNumericPid, ProcPidStatTest,
                          ::testing::Values("self", absl::StrCat(getpid())));
 
+// Returns the state field of /proc/[pid]/stat.
+PosixErrorOr<char> ProcPidStatState(int pid) {
+  ASSIGN_OR_RETURN_ERRNO(std::string stat,
+                         GetContents(absl::StrCat("/proc/", pid, "/stat")));
+  // The state follows the command name, which is in parentheses and may
+  // contain spaces and parentheses itself.
+  size_t pos = stat.rfind(") ");
+  if (pos == std::string::npos || pos + 2 >= stat.size()) {
+    return PosixError(EINVAL, absl::StrCat("malformed stat: ", stat));
+  }
+  return stat[pos + 2];
+}
+
+TEST(ProcPidStatTest, StateStopped) {
+  auto res = WithSubprocess(
+      [&](int pid) -> PosixError {
+        if (kill(pid, SIGSTOP) < 0) {
+          return PosixError(errno, "kill");
+        }
+        // Wait until the child is stopped.
+        int status;
+        if (waitpid(pid, &status, WUNTRACED) < 0) {
+          return PosixError(errno, "waitpid");
+        }
+        if (!WIFSTOPPED(status) || WSTOPSIG(status) != SIGSTOP) {
+          return PosixError(EINVAL, absl::StrCat("child status ", status));
+        }
+        EXPECT_THAT(ProcPidStatState(pid), IsPosixErrorOkAndHolds('T'));
+        return NoError();
+      },
+      nullptr, nullptr);
+  ASSERT_NO_ERRNO(res);
+}
+
+TEST(ProcPidStatTest, StateZombie) {
+  auto res = WithSubprocess(
+      nullptr,
+      [&](int pid) -> PosixError {
+        EXPECT_THAT(ProcPidStatState(pid), IsPosixErrorOkAndHolds('Z'));
+        return NoError();
+      },
+      nullptr);
+  ASSERT_NO_ERRNO(res);
+}
+
 using ProcPidStatmTest = ::testing::TestWithParam<std::string>;
 
 TEST_P(ProcPidStatmTest, HasBasicFields) {
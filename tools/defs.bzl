@@ -83,7 +83,7 @@ def go_imports(name, src, out):
         cmd = ("$(location @org_golang_x_tools//cmd/goimports:goimports) $(SRCS) > $@"),
     )
 
-def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = False, **kwargs):
+def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = False, marshal_layouts = [], marshal_budget = None, **kwargs):
     """Wraps the standard go_library and does stateification and marshalling.
 
     The recommended way is to use this rule with mostly identical configuration as the native
@@ -106,6 +106,11 @@ def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = F
       imports: imports required for stateify.
       stateify: whether statify is enabled (default: true).
       marshal: whether marshal is enabled (default: false).
+      marshal_layouts: build tags selecting the layouts of marshalled types
+        with conditional fields (default: none). Each layout, and the default
+        layout used when none of the tags is set, is generated in its own file.
+      marshal_budget: an optional JSON file of the expected layouts of
+        marshalled types (default: none). See tools/go_marshal/README.md.
       **kwargs: standard go_library arguments.
     """
     all_srcs = srcs
@@ -147,7 +152,20 @@ def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = F
                 debug = False,
                 imports = imports,
                 package = name,
+                layouts = marshal_layouts,
+                budget = marshal_budget,
             )
+            for layout in _marshal_layout_names(marshal_layouts):
+                go_marshal(
+                    name = name + suffix + "_" + layout + "_abi_autogen",
+                    srcs = srcs,
+                    debug = False,
+                    imports = imports,
+                    package = name,
+                    layouts = marshal_layouts,
+                    layout = layout,
+                    budget = marshal_budget,
+                )
         extra_deps = [
             dep
             for dep in marshal_deps
@@ -155,8 +173,9 @@ def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = F
         ]
         all_deps = all_deps + extra_deps
         all_srcs = all_srcs + [
-            name + suffix + "_abi_autogen_unsafe.go"
+            name + suffix + layout_suffix + "_abi_autogen_unsafe.go"
             for suffix in marshal_sets.keys()
+            for layout_suffix in _marshal_layout_suffixes(marshal_layouts)
         ]
 
     _go_library(
@@ -175,12 +194,25 @@ def go_library(name, srcs, deps = [], imports = [], stateify = True, marshal = F
         for (suffix, srcs) in marshal_sets.items():
             _go_test(
                 name = name + suffix + "_abi_autogen_test",
-                srcs = [name + suffix + "_abi_autogen_test.go"],
+                srcs = [
+                    name + suffix + layout_suffix + "_abi_autogen_test.go"
+                    for layout_suffix in _marshal_layout_suffixes(marshal_layouts)
+                ],
                 library = ":" + name + suffix,
                 deps = marshal_test_deps,
                 **kwargs
             )
 
+def _marshal_layout_names(layouts):
+    """Returns the layouts generated for marshal_layouts, including the default."""
+    if not layouts:
+        return []
+    return layouts + ["default"]
+
+def _marshal_layout_suffixes(layouts):
+    """Returns the suffixes of the files generated for marshal_layouts."""
+    return [""] + ["_" + layout for layout in _marshal_layout_names(layouts)]
+
 def proto_library(name, srcs, **kwargs):
     """Wraps the standard proto_library.
 
@@ -34,14 +34,16 @@ import (
 
 // RandomizeValue assigns random value(s) to an abitrary type. This is intended
 // for used with ABI structs from go_marshal, meaning the typical restrictions
-// apply (fixed-size types, no pointers, maps, channels, etc), and should only
-// be used on zeroed values to avoid overwriting pointers to active go objects.
+// apply (fixed-size types, no pointers, channels, etc), and should only be used
+// on zeroed values to avoid overwriting pointers to active go objects.
 //
 // Internally, we populate the type with random data by doing an unsafe cast to
 // access the underlying memory of the type and filling it as if it were a byte
 // slice. This almost gets us what we want, but padding fields named "_" are
 // normally not accessible, so we walk the type and recursively zero all "_"
-// fields.
+// fields. Map fields, which go_marshal marshals as sorted arrays, are skipped
+// when filling the memory, and then assigned maps with random entries. Arrays
+// are filled element by element if their elements hold maps.
 //
 // Precondition: x must be a pointer. x must not contain any valid
 // pointers to active go objects (pointer fields aren't allowed in ABI
@@ -63,13 +65,88 @@ func RandomizeValue(x interface{}) {
 
 	// Fill the byte slice with random data, which in effect fills the type with
 	// random values.
-	n, err := rand.Read(b)
-	if err != nil || n != len(b) {
-		panic("unreachable")
-	}
+	randomizeBytes(v.Type(), b)
 
 	// Normally, padding fields are not accessible, so zero them out.
 	reflectZeroPaddingFields(v.Type(), b, false)
+
+	randomizeMaps(v)
+}
+
+// randomizeBytes fills the memory in data of a value of type r with random
+// data, except for the memory of maps, which holds pointers. Maps may be held
+// by fields of structs and elements of arrays, at any depth.
+func randomizeBytes(r reflect.Type, data []byte) {
+	switch {
+	case !hasMaps(r):
+		n, err := rand.Read(data)
+		if err != nil || n != len(data) {
+			panic("unreachable")
+		}
+	case r.Kind() == reflect.Struct:
+		for i, numFields := 0, r.NumField(); i < numFields; i++ {
+			f := r.Field(i)
+			if f.Type.Kind() == reflect.Map {
+				continue
+			}
+			randomizeBytes(f.Type, data[f.Offset:f.Offset+f.Type.Size()])
+		}
+	case r.Kind() == reflect.Array:
+		eLen := int(r.Elem().Size())
+		for i, n := 0, r.Len(); i < n; i++ {
+			randomizeBytes(r.Elem(), data[i*eLen:(i+1)*eLen])
+		}
+	}
+}
+
+// hasMaps returns true if values of type r hold maps, directly or in the
+// fields of structs and elements of arrays they hold.
+func hasMaps(r reflect.Type) bool {
+	switch r.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Struct:
+		for i, numFields := 0, r.NumField(); i < numFields; i++ {
+			if hasMaps(r.Field(i).Type) {
+				return true
+			}
+		}
+	case reflect.Array:
+		return r.Len() > 0 && hasMaps(r.Elem())
+	}
+	return false
+}
+
+// randomizeMaps assigns a map with a few random entries to each map held by
+// the struct or array v, in its fields or elements.
+func randomizeMaps(v reflect.Value) {
+	if !hasMaps(v.Type()) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i, numFields := 0, v.NumField(); i < numFields; i++ {
+			f := v.Field(i)
+			if f.Kind() != reflect.Map {
+				randomizeMaps(f)
+				continue
+			}
+			m := reflect.MakeMap(f.Type())
+			for n := rand.Intn(8) + 1; n > 0; n-- {
+				key := reflect.New(f.Type().Key())
+				RandomizeValue(key.Interface())
+				val := reflect.New(f.Type().Elem())
+				RandomizeValue(val.Interface())
+				m.SetMapIndex(key.Elem(), val.Elem())
+			}
+			// Map fields are usually unexported, so they can't be set through f.
+			reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(m)
+		}
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			randomizeMaps(v.Index(i))
+		}
+	}
 }
 
 // reflectZeroPaddingFields assigns zero values to padding fields for the value
@@ -97,6 +174,8 @@ func reflectZeroPaddingFields(r reflect.Type, data []byte, zero bool) {
 			window := data[off : off+len]
 			reflectZeroPaddingFields(f.Type, window, f.Name == "_")
 		}
+	case reflect.Map:
+		// Maps are randomized by randomizeMaps.
 	case reflect.Array:
 		eLen := int(r.Elem().Size())
 		if int(r.Size()) != eLen*r.Len() {
@@ -4,21 +4,33 @@ def _go_marshal_impl(ctx):
     """Execute the go_marshal tool."""
     output = ctx.outputs.lib
     output_test = ctx.outputs.test
+    output_report = ctx.outputs.report
 
     # Run the marshal command.
     args = ["-output=%s" % output.path]
     args += ["-pkg=%s" % ctx.attr.package]
     args += ["-output_test=%s" % output_test.path]
+    args += ["-report=%s" % output_report.path]
 
     if ctx.attr.debug:
         args += ["-debug"]
 
+    if ctx.attr.layouts:
+        args += ["-layouts=%s" % ",".join(ctx.attr.layouts)]
+    if ctx.attr.layout:
+        args += ["-layout=%s" % ctx.attr.layout]
+
+    inputs = ctx.files.srcs
+    if ctx.file.budget:
+        args += ["-budget=%s" % ctx.file.budget.path]
+        inputs = inputs + [ctx.file.budget]
+
     args += ["--"]
     for src in ctx.attr.srcs:
         args += [f.path for f in src.files.to_list()]
     ctx.actions.run(
-        inputs = ctx.files.srcs,
-        outputs = [output, output_test],
+        inputs = inputs,
+        outputs = [output, output_test, output_report],
         mnemonic = "GoMarshal",
         progress_message = "go_marshal: %s" % ctx.label,
         arguments = args,
@@ -36,6 +48,14 @@ def _go_marshal_impl(ctx):
 #   out: the name of the generated file output. This must not conflict with any
 #        other files and must be added to the srcs of the relevant go_library.
 #   package: the package name for the input sources.
+#   layouts: build tags selecting the layouts of types with conditional fields,
+#            i.e. fields tagged `marshal:"build=<tag>"`.
+#   layout: the layout to generate, one of layouts or "default" for the
+#           layout used when none of them is set. If empty, only types
+#           without conditional fields are generated.
+#   budget: an optional JSON file of expected type layouts. Generation fails if
+#           the layouts of the generated types differ. The layouts are always
+#           reported in the %{name}_layout.json output, in the same format.
 go_marshal = rule(
     implementation = _go_marshal_impl,
     attrs = {
@@ -43,11 +63,15 @@ go_marshal = rule(
         "imports": attr.string_list(mandatory = False),
         "package": attr.string(mandatory = True),
         "debug": attr.bool(doc = "enable debugging output from the go_marshal tool"),
+        "layouts": attr.string_list(mandatory = False),
+        "layout": attr.string(mandatory = False),
+        "budget": attr.label(mandatory = False, allow_single_file = [".json"]),
         "_tool": attr.label(executable = True, cfg = "host", default = Label("//tools/go_marshal:go_marshal")),
     },
     outputs = {
         "lib": "%{name}_unsafe.go",
         "test": "%{name}_test.go",
+        "report": "%{name}_layout.json",
     },
 )
 
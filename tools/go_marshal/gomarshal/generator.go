@@ -77,10 +77,40 @@ type Generator struct {
 	pkg string
 	// Set of extra packages to import in the generated file.
 	imports *importTable
+	// Build tags selecting the layouts of types with conditional fields.
+	layouts []string
+	// Layout to generate, one of layouts or DefaultLayout. If empty, only
+	// types without conditional fields are generated.
+	layout string
+	// Path of the layout report to write, if any. See report.go.
+	report string
+	// Path of the budget file to check the generated layouts against, if
+	// any.
+	budget string
 }
 
 // NewGenerator creates a new code Generator.
-func NewGenerator(srcs []string, out, outTest, pkg string, imports []string) (*Generator, error) {
+//
+// Types with conditional fields are only generated if layout is set, in which
+// case the output is restricted to builds selecting it. See layout.go.
+//
+// If report is set, a report of the layouts of the generated types is written
+// to it. If budget is set, generation fails if these layouts don't match the
+// budget file. See report.go.
+func NewGenerator(srcs []string, out, outTest, pkg string, imports, layouts []string, layout, report, budget string) (*Generator, error) {
+	for _, l := range layouts {
+		if l == DefaultLayout || strings.HasPrefix(l, "!") {
+			return nil, fmt.Errorf("Invalid layout %q", l)
+		}
+	}
+	if layout != "" && layout != DefaultLayout && !containsString(layouts, layout) {
+		return nil, fmt.Errorf("Layout %q isn't one of the layouts %v", layout, layouts)
+	}
+	// The output must not depend on the order of the input files, which
+	// determines e.g. which import wins when two of them use the same local
+	// name for different packages.
+	srcs = append([]string(nil), srcs...)
+	sort.Strings(srcs)
 	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("Couldn't open output file %q: %v", out, err)
@@ -95,6 +125,10 @@ func NewGenerator(srcs []string, out, outTest, pkg string, imports []string) (*G
 		outputTest: fTest,
 		pkg:        pkg,
 		imports:    newImportTable(),
+		layouts:    layouts,
+		layout:     layout,
+		report:     report,
+		budget:     budget,
 	}
 	for _, i := range imports {
 		// All imports on the extra imports list are unconditionally marked as
@@ -108,6 +142,8 @@ func NewGenerator(srcs []string, out, outTest, pkg string, imports []string) (*G
 	g.imports.add("reflect")
 	g.imports.add("runtime")
 	g.imports.add(safecopyImport)
+	g.imports.add("sort")
+	g.imports.add("syscall")
 	g.imports.add("unsafe")
 	g.imports.add(usermemImport)
 
@@ -120,9 +156,13 @@ func (g *Generator) writeHeader() error {
 	var b sourceBuffer
 	b.emit("// Automatically generated marshal implementation. See tools/go_marshal.\n\n")
 
-	// Emit build tags.
-	if t := tags.Aggregate(g.inputs); len(t) > 0 {
+	// Emit build tags. They must be followed by a blank line.
+	if t := g.buildTags(); len(t) > 0 {
 		b.emit(strings.Join(t.Lines(), "\n"))
+		b.emit("\n\n")
+	}
+	if g.layout != "" {
+		b.emit(layoutComment(g.layout, g.layouts))
 		b.emit("\n")
 	}
 
@@ -135,6 +175,16 @@ func (g *Generator) writeHeader() error {
 	return g.imports.write(g.output)
 }
 
+// buildTags returns the build tags of the generated files: those of the
+// input files and, if a layout is generated, the constraint selecting it.
+func (g *Generator) buildTags() tags.AndSet {
+	t := tags.Aggregate(g.inputs)
+	if g.layout != "" {
+		t = t.Join(tags.AndSet{tags.OrSet{layoutConstraint(g.layout, g.layouts)}})
+	}
+	return t
+}
+
 // writeTypeChecks writes a statement to force the compiler to perform a type
 // check for all Marshallable types referenced by the generated code.
 func (g *Generator) writeTypeChecks(ms map[string]struct{}) error {
@@ -191,10 +241,54 @@ func (g *Generator) parse() ([]*ast.File, []*token.FileSet, error) {
 	return files, fsets, nil
 }
 
+// typeOptions are the options of a type marked for code generation, listed
+// after "+marshal" on its marker line, e.g. "// +marshal equals copy".
+type typeOptions struct {
+	// equals requests an Equals method comparing the marshalled fields of
+	// the type, ignoring padding.
+	equals bool
+	// copy requests a DeepCopy method.
+	copy bool
+	// copyOutN requests a CopyOutN method, which copies a prefix of the
+	// marshalled type.
+	copyOutN bool
+}
+
+// parseTypeOptions parses the marker line c of a type, and returns false if c
+// isn't a "+marshal" line.
+func parseTypeOptions(c *ast.Comment, f *token.FileSet) (typeOptions, bool) {
+	var opts typeOptions
+	fields := strings.Fields(strings.TrimPrefix(c.Text, "//"))
+	if !strings.HasPrefix(c.Text, "// ") || len(fields) == 0 || fields[0] != "+marshal" {
+		return opts, false
+	}
+	for _, o := range fields[1:] {
+		switch o {
+		case "equals":
+			opts.equals = true
+		case "copy":
+			opts.copy = true
+		case "copyoutn":
+			opts.copyOutN = true
+		default:
+			abortAt(f.Position(c.Pos()), fmt.Sprintf("Unknown +marshal option '%s'", o))
+		}
+	}
+	return opts, true
+}
+
+// marshallableType is a type declaration marked for code generation.
+type marshallableType struct {
+	t    *ast.TypeSpec
+	opts typeOptions
+	// fset is the file set of the input file declaring t.
+	fset *token.FileSet
+}
+
 // collectMarshallabeTypes walks the parsed AST and collects a list of type
 // declarations for which we need to generate the Marshallable interface.
-func (g *Generator) collectMarshallabeTypes(a *ast.File, f *token.FileSet) []*ast.TypeSpec {
-	var types []*ast.TypeSpec
+func (g *Generator) collectMarshallabeTypes(a *ast.File, f *token.FileSet) []marshallableType {
+	var types []marshallableType
 	for _, decl := range a.Decls {
 		gdecl, ok := decl.(*ast.GenDecl)
 		// Type declaration?
@@ -209,9 +303,9 @@ func (g *Generator) collectMarshallabeTypes(a *ast.File, f *token.FileSet) []*as
 		}
 		// Does the comment contain a "+marshal" line?
 		marked := false
+		var opts typeOptions
 		for _, c := range gdecl.Doc.List {
-			if c.Text == "// +marshal" {
-				marked = true
+			if opts, marked = parseTypeOptions(c, f); marked {
 				break
 			}
 		}
@@ -224,7 +318,7 @@ func (g *Generator) collectMarshallabeTypes(a *ast.File, f *token.FileSet) []*as
 			t := spec.(*ast.TypeSpec)
 			if _, ok := t.Type.(*ast.StructType); ok {
 				debugfAt(f.Position(t.Pos()), "Collected marshallable type %s.\n", t.Name.Name)
-				types = append(types, t)
+				types = append(types, marshallableType{t: t, opts: opts, fset: f})
 				continue
 			}
 			debugf("Skipping declaration %v since it's not a struct declaration.\n", gdecl)
@@ -266,19 +360,28 @@ func (g *Generator) collectImports(a *ast.File, f *token.FileSet) map[string]imp
 
 }
 
-func (g *Generator) generateOne(t *ast.TypeSpec, fset *token.FileSet) *interfaceGenerator {
+func (g *Generator) generateOne(m marshallableType) *interfaceGenerator {
 	// We're guaranteed to have only struct type specs by now. See
 	// Generator.collectMarshallabeTypes.
-	i := newInterfaceGenerator(t, fset)
+	i := newInterfaceGenerator(m.t, m.fset, g.layout)
 	i.validate()
 	i.emitMarshallable()
+	if m.opts.equals {
+		i.emitEquals()
+	}
+	if m.opts.copy {
+		i.emitDeepCopy()
+	}
+	if m.opts.copyOutN {
+		i.emitCopyOutN()
+	}
 	return i
 }
 
 // generateOneTestSuite generates a test suite for the automatically generated
-// implementations type t.
-func (g *Generator) generateOneTestSuite(t *ast.TypeSpec) *testGenerator {
-	i := newTestGenerator(t)
+// implementations type m.
+func (g *Generator) generateOneTestSuite(m marshallableType) *testGenerator {
+	i := newTestGenerator(m.t, m.opts, g.layout)
 	i.emitTests()
 	return i
 }
@@ -311,34 +414,56 @@ func (g *Generator) Run() error {
 		}
 	}
 
+	// Collect type declarations marked for code generation. They're generated
+	// in the order of their names, so that moving a type to another input
+	// file doesn't change the output.
+	var marked []marshallableType
+	for i, a := range asts {
+		marked = append(marked, g.collectMarshallabeTypes(a, fsets[i])...)
+	}
+	sort.SliceStable(marked, func(i, j int) bool {
+		return marked[i].t.Name.Name < marked[j].t.Name.Name
+	})
+
 	var impls []*interfaceGenerator
 	var ts []*testGenerator
+	var ls []typeLayout
+	resolver := newLayoutResolver(marked, g.layout)
 	// Set of Marshallable types referenced by generated code.
 	ms := make(map[string]struct{})
-	for i, a := range asts {
-		// Collect type declarations marked for code generation and generate
-		// Marshallable interfaces.
-		for _, t := range g.collectMarshallabeTypes(a, fsets[i]) {
-			impl := g.generateOne(t, fsets[i])
-			// Collect Marshallable types referenced by the generated code.
-			for ref, _ := range impl.ms {
-				ms[ref] = struct{}{}
-			}
-			impls = append(impls, impl)
-			// Collect imports referenced by the generated code and add them to
-			// the list of imports we need to copy to the generated code.
-			for name, _ := range impl.is {
-				if !g.imports.markUsed(name) {
-					panic(fmt.Sprintf("Generated code for '%s' referenced a non-existent import with local name '%s'", impl.typeName(), name))
-				}
+	for _, m := range marked {
+		// Generate Marshallable interfaces.
+		t := m.t
+		if hasConditionalFields(t) {
+			g.validateConditionalFields(t, m.fset)
+		}
+		// Types with conditional fields are only generated for a layout,
+		// and the others only outside of layouts.
+		if hasConditionalFields(t) != (g.layout != "") {
+			continue
+		}
+		impl := g.generateOne(m)
+		// Collect Marshallable types referenced by the generated code.
+		for ref, _ := range impl.ms {
+			ms[ref] = struct{}{}
+		}
+		impls = append(impls, impl)
+		// Collect imports referenced by the generated code and add them to
+		// the list of imports we need to copy to the generated code.
+		for name, _ := range impl.is {
+			if !g.imports.markUsed(name) {
+				panic(fmt.Sprintf("Generated code for '%s' referenced a non-existent import with local name '%s'", impl.typeName(), name))
 			}
-			ts = append(ts, g.generateOneTestSuite(t))
+		}
+		ts = append(ts, g.generateOneTestSuite(m))
+		if l, ok := resolver.typeLayout(t.Name.Name); ok {
+			ls = append(ls, *l)
 		}
 	}
 
 	// Tool was invoked with input files with no data structures marked for code
 	// generation. This is probably not what the user intended.
-	if len(impls) == 0 {
+	if len(impls) == 0 && len(g.layouts) == 0 {
 		var buf bytes.Buffer
 		fmt.Fprintf(&buf, "go_marshal invoked on these files, but they don't contain any types requiring code generation. Perhaps mark some with \"// +marshal\"?:\n")
 		for _, i := range g.inputs {
@@ -347,6 +472,16 @@ func (g *Generator) Run() error {
 		abort(buf.String())
 	}
 
+	if err := g.checkLayouts(marked, ls); err != nil {
+		return err
+	}
+
+	// Layouts may not hold any type, in which case only the package clause
+	// is written since imports would be unused.
+	if len(impls) == 0 {
+		g.imports.clear()
+	}
+
 	// Write output file header. These include things like package name and
 	// import statements.
 	if err := g.writeHeader(); err != nil {
@@ -369,14 +504,63 @@ func (g *Generator) Run() error {
 	return g.writeTests(ts)
 }
 
+// checkLayouts writes the layout report of the generated types ls, and checks
+// them against the budget file. Generation is aborted if they don't match.
+func (g *Generator) checkLayouts(marked []marshallableType, ls []typeLayout) error {
+	if g.report != "" {
+		if err := writeReport(g.report, g.pkg, ls); err != nil {
+			return err
+		}
+	}
+	if g.budget == "" {
+		return nil
+	}
+	budget, err := readBudget(g.budget)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]struct{})
+	for _, m := range marked {
+		names[m.t.Name.Name] = struct{}{}
+	}
+	if err := checkBudget(budget, ls, names, g.layout); err != nil {
+		abort(fmt.Sprintf("Generated layouts don't match the budget file %q:\n%v", g.budget, err))
+	}
+	return nil
+}
+
+// validateConditionalFields ensures the conditional fields of t depend on the
+// build tag of a layout.
+func (g *Generator) validateConditionalFields(t *ast.TypeSpec, fset *token.FileSet) {
+	for _, f := range t.Type.(*ast.StructType).Fields.List {
+		tag, _, ok := fieldCondition(f)
+		if !ok {
+			continue
+		}
+		if len(g.layouts) == 0 {
+			abortAt(fset.Position(f.Pos()), fmt.Sprintf("Type '%s' has conditional fields, but no layouts were given; list the build tags selecting layouts in the marshal_layouts of the library", t.Name.Name))
+		}
+		if !containsString(g.layouts, tag) {
+			abortAt(fset.Position(f.Pos()), fmt.Sprintf("Field depends on build tag '%s', which doesn't select any of the layouts %v", tag, g.layouts))
+		}
+	}
+}
+
 // writeTests outputs tests for the generated interface implementations to a go
 // source file.
 func (g *Generator) writeTests(ts []*testGenerator) error {
 	var b sourceBuffer
+	if t := g.buildTags(); len(t) > 0 {
+		b.emit(strings.Join(t.Lines(), "\n"))
+		b.emit("\n\n")
+	}
 	b.emit("package %s\n\n", g.pkg)
 	if err := b.write(g.outputTest); err != nil {
 		return err
 	}
+	if len(ts) == 0 {
+		return nil
+	}
 
 	// Collect and write test import statements.
 	imports := newImportTable()
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"sort"
 	"strings"
 )
 
@@ -46,6 +47,14 @@ type interfaceGenerator struct {
 	// as records embedded fields in t that are potentially not packed. The key
 	// is the accessor for the field.
 	as map[string]struct{}
+
+	// layout is the layout to generate if t has conditional fields. See
+	// layout.go.
+	layout string
+
+	// packed is true if t's memory matches its generated layout, ignoring
+	// the types of its fields. It is set by emitMarshallable.
+	packed bool
 }
 
 // typeName returns the name of the type this g represents.
@@ -54,7 +63,7 @@ func (g *interfaceGenerator) typeName() string {
 }
 
 // newinterfaceGenerator creates a new interface generator.
-func newInterfaceGenerator(t *ast.TypeSpec, fset *token.FileSet) *interfaceGenerator {
+func newInterfaceGenerator(t *ast.TypeSpec, fset *token.FileSet, layout string) *interfaceGenerator {
 	if _, ok := t.Type.(*ast.StructType); !ok {
 		panic(fmt.Sprintf("Attempting to generate code for a not struct type %v", t))
 	}
@@ -65,6 +74,8 @@ func newInterfaceGenerator(t *ast.TypeSpec, fset *token.FileSet) *interfaceGener
 		is: make(map[string]struct{}),
 		ms: make(map[string]struct{}),
 		as: make(map[string]struct{}),
+
+		layout: layout,
 	}
 	g.recordUsedMarshallable(g.typeName())
 	return g
@@ -84,11 +95,15 @@ func (g *interfaceGenerator) recordPotentiallyNonPackedField(fieldName string) {
 	g.as[fieldName] = struct{}{}
 }
 
+// forEachField calls fn for each field of g.t that is part of the generated
+// layout.
 func (g *interfaceGenerator) forEachField(fn func(f *ast.Field)) {
 	// This is guaranteed to succeed because g.t is always a struct.
 	st := g.t.Type.(*ast.StructType)
 	for _, field := range st.Fields.List {
-		fn(field)
+		if inLayout(field, g.layout) {
+			fn(field)
+		}
 	}
 }
 
@@ -115,25 +130,7 @@ func (g *interfaceGenerator) validate() {
 	g.forEachField(func(f *ast.Field) {
 		fieldDispatcher{
 			primitive: func(_, t *ast.Ident) {
-				switch t.Name {
-				case "int8", "uint8", "byte", "int16", "uint16", "int32", "uint32", "int64", "uint64":
-					// These are the only primitive types we're allow. Below, we
-					// provide suggestions for some disallowed types and reject
-					// them, then attempt to marshal any remaining types by
-					// invoking the marshal.Marshallable interface on them. If
-					// these types don't actually implement
-					// marshal.Marshallable, compilation of the generated code
-					// will fail with an appropriate error message.
-					return
-				case "int":
-					g.abortAt(f.Pos(), "Type 'int' has ambiguous width, use int32 or int64")
-				case "uint":
-					g.abortAt(f.Pos(), "Type 'uint' has ambiguous width, use uint32 or uint64")
-				case "string":
-					g.abortAt(f.Pos(), "Type 'string' is dynamically-sized and cannot be marshalled, use a fixed size byte array '[...]byte' instead")
-				default:
-					debugfAt(g.f.Position(f.Pos()), fmt.Sprintf("Found derived type '%s', will attempt dispatch via marshal.Marshallable.\n", t.Name))
-				}
+				g.validatePrimitive(f, t)
 			},
 			selector: func(_, _, _ *ast.Ident) {
 				// No validation to perform on selector fields. However this
@@ -149,14 +146,29 @@ func (g *interfaceGenerator) validate() {
 					g.abortAt(a.Len.Pos(), fmt.Sprintf("Array size must be a literal, don's use consts or expressions"))
 				}
 
-				if _, ok := a.Elt.(*ast.Ident); !ok {
-					g.abortAt(a.Elt.Pos(), fmt.Sprintf("Marshalling not supported for arrays with %s elements, array elements must be primitive types", kindString(a.Elt)))
+				switch e := a.Elt.(type) {
+				case *ast.Ident:
+					g.validatePrimitive(f, e)
+				case *ast.SelectorExpr:
+					g.abortAt(a.Elt.Pos(), "Marshalling not supported for arrays of types declared in other packages, array elements must be primitive types or Marshallable types of this package")
+				default:
+					g.abortAt(a.Elt.Pos(), fmt.Sprintf("Marshalling not supported for arrays with %s elements, array elements must be primitive types or Marshallable types", kindString(a.Elt)))
 				}
 
 				if len <= 0 {
 					g.abortAt(a.Len.Pos(), fmt.Sprintf("Marshalling not supported for zero length arrays, why does an ABI struct have one?"))
 				}
 			},
+			mapType: func(n *ast.Ident, m *ast.MapType) {
+				if n.Name == "_" {
+					g.abortAt(f.Pos(), "Map fields cannot be padding fields")
+				}
+				if !hasFieldOption(f, "sorted") {
+					g.abortAt(f.Pos(), fmt.Sprintf("Map '%s' has no defined order and cannot be marshalled as is, tag it as `marshal:\"sorted\"` to marshal it as an array sorted by key", n.Name))
+				}
+				g.validateMapElem(f, m.Key)
+				g.validateMapElem(f, m.Value)
+			},
 			unhandled: func(_ *ast.Ident) {
 				g.abortAt(f.Pos(), fmt.Sprintf("Marshalling not supported for %s fields", kindString(f.Type)))
 			},
@@ -164,22 +176,50 @@ func (g *interfaceGenerator) validate() {
 	})
 }
 
+// validatePrimitive ensures the type t of field f, or of its map keys or
+// values, can be marshalled.
+func (g *interfaceGenerator) validatePrimitive(f *ast.Field, t *ast.Ident) {
+	switch t.Name {
+	case "int8", "uint8", "byte", "int16", "uint16", "int32", "uint32", "int64", "uint64":
+		// These are the only primitive types we're allow. Below, we provide
+		// suggestions for some disallowed types and reject them, then attempt
+		// to marshal any remaining types by invoking the marshal.Marshallable
+		// interface on them. If these types don't actually implement
+		// marshal.Marshallable, compilation of the generated code will fail
+		// with an appropriate error message.
+		return
+	case "int":
+		g.abortAt(f.Pos(), "Type 'int' has ambiguous width, use int32 or int64")
+	case "uint":
+		g.abortAt(f.Pos(), "Type 'uint' has ambiguous width, use uint32 or uint64")
+	case "string":
+		g.abortAt(f.Pos(), "Type 'string' is dynamically-sized and cannot be marshalled, use a fixed size byte array '[...]byte' instead")
+	default:
+		debugfAt(g.f.Position(f.Pos()), fmt.Sprintf("Found derived type '%s', will attempt dispatch via marshal.Marshallable.\n", t.Name))
+	}
+}
+
+// validateMapElem ensures the key or value type e of the map field f can be
+// marshalled.
+func (g *interfaceGenerator) validateMapElem(f *ast.Field, e ast.Expr) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		g.validatePrimitive(f, t)
+	case *ast.SelectorExpr:
+		if _, ok := t.X.(*ast.Ident); !ok {
+			g.abortAt(e.Pos(), "Map key or value type must be a primitive type or a Marshallable type")
+		}
+	default:
+		g.abortAt(e.Pos(), fmt.Sprintf("Marshalling not supported for maps with %s keys or values, they must be primitive types or Marshallable types", kindString(e)))
+	}
+}
+
 // scalarSize returns the size of type identified by t. If t isn't a primitive
 // type, the size isn't known at code generation time, and must be resolved via
 // the marshal.Marshallable interface.
 func (g *interfaceGenerator) scalarSize(t *ast.Ident) (size int, unknownSize bool) {
-	switch t.Name {
-	case "int8", "uint8", "byte":
-		return 1, false
-	case "int16", "uint16":
-		return 2, false
-	case "int32", "uint32":
-		return 4, false
-	case "int64", "uint64":
-		return 8, false
-	default:
-		return 0, true
-	}
+	size, ok := primitiveSize(t.Name)
+	return size, !ok
 }
 
 func (g *interfaceGenerator) shift(bufVar string, n int) {
@@ -254,10 +294,124 @@ func (g *interfaceGenerator) unmarshalScalar(accessor, typ string, bufVar string
 	default:
 		g.emit("%s.UnmarshalBytes(%s[:%s.SizeBytes()])\n", accessor, bufVar, accessor)
 		g.shiftDynamic(bufVar, accessor)
-		g.recordPotentiallyNonPackedField(accessor)
 	}
 }
 
+// mapElemType returns the name of the key or value type e of a map field, and
+// whether it's a primitive type. Other types are marshalled via the
+// marshal.Marshallable interface.
+func (g *interfaceGenerator) mapElemType(e ast.Expr) (name string, primitive bool) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if _, dynamic := g.scalarSize(t); !dynamic {
+			return t.Name, true
+		}
+		g.recordUsedMarshallable(t.Name)
+		return t.Name, false
+	case *ast.SelectorExpr:
+		x := t.X.(*ast.Ident)
+		name := fmt.Sprintf("%s.%s", x.Name, t.Sel.Name)
+		g.recordUsedImport(x.Name)
+		g.recordUsedMarshallable(name)
+		return name, false
+	default:
+		// Should've been rejected by validate().
+		panic("unreachable")
+	}
+}
+
+// mapEntrySize returns a go expression for the size of a marshalled entry of
+// the map m.
+func (g *interfaceGenerator) mapEntrySize(m *ast.MapType) string {
+	size := 0
+	var terms []string
+	for _, e := range []ast.Expr{m.Key, m.Value} {
+		name, primitive := g.mapElemType(e)
+		if primitive {
+			s, _ := g.scalarSize(e.(*ast.Ident))
+			size += s
+		} else {
+			terms = append(terms, fmt.Sprintf("(*%s)(nil).SizeBytes()", name))
+		}
+	}
+	if len(terms) == 0 {
+		return fmt.Sprintf("%d", size)
+	}
+	if size != 0 {
+		terms = append([]string{fmt.Sprintf("%d", size)}, terms...)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(terms, "+"))
+}
+
+// marshalMap emits code marshalling the map accessor as its length, followed
+// by its entries sorted by key.
+func (g *interfaceGenerator) marshalMap(accessor string, m *ast.MapType, bufVar string) {
+	kName, kPrimitive := g.mapElemType(m.Key)
+	vName, _ := g.mapElemType(m.Value)
+	g.recordUsedImport("sort")
+	g.recordUsedImport("usermem")
+	g.emit("usermem.ByteOrder.PutUint32(%s[:4], uint32(len(%s)))\n", bufVar, accessor)
+	g.shift(bufVar, 4)
+	g.emit("{\n")
+	g.inIndent(func() {
+		g.emit("// Sort the keys, so that equal maps are marshalled identically.\n")
+		g.emit("keys := make([]%s, 0, len(%s))\n", kName, accessor)
+		g.emit("for key := range %s {\n", accessor)
+		g.inIndent(func() {
+			g.emit("keys = append(keys, key)\n")
+		})
+		g.emit("}\n")
+		if kPrimitive {
+			g.emit("sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })\n")
+		} else {
+			g.emit("sort.Slice(keys, func(i, j int) bool { return marshal.LessBytes(&keys[i], &keys[j]) })\n")
+		}
+		g.emit("for _, key := range keys {\n")
+		g.inIndent(func() {
+			g.emit("val := %s[key]\n", accessor)
+			g.marshalScalar("key", kName, bufVar)
+			g.marshalScalar("val", vName, bufVar)
+		})
+		g.emit("}\n")
+	})
+	g.emit("}\n")
+}
+
+// unmarshalMap emits code rebuilding the map accessor from the encoding
+// emitted by marshalMap.
+func (g *interfaceGenerator) unmarshalMap(accessor string, m *ast.MapType, bufVar string) {
+	kName, kPrimitive := g.mapElemType(m.Key)
+	vName, vPrimitive := g.mapElemType(m.Value)
+	g.recordUsedImport("usermem")
+	g.emit("{\n")
+	g.inIndent(func() {
+		g.emit("count := int(usermem.ByteOrder.Uint32(%s[:4]))\n", bufVar)
+		g.shift(bufVar, 4)
+		g.emit("%s = make(map[%s]%s, count)\n", accessor, kName, vName)
+		g.emit("for ; count > 0; count-- {\n")
+		g.inIndent(func() {
+			g.emit("var key %s\n", kName)
+			g.emit("var val %s\n", vName)
+			g.unmarshalMapElem("key", kName, kPrimitive, bufVar)
+			g.unmarshalMapElem("val", vName, vPrimitive, bufVar)
+			g.emit("%s[key] = val\n", accessor)
+		})
+		g.emit("}\n")
+	})
+	g.emit("}\n")
+}
+
+// unmarshalMapElem is like unmarshalScalar for a map key or value held in the
+// local variable accessor, which isn't a field of g.t.
+func (g *interfaceGenerator) unmarshalMapElem(accessor, typ string, primitive bool, bufVar string) {
+	if primitive {
+		g.unmarshalScalar(accessor, typ, bufVar)
+		return
+	}
+	g.emit("%s.UnmarshalBytes(%s[:%s.SizeBytes()])\n", accessor, bufVar, accessor)
+	g.shiftDynamic(bufVar, accessor)
+}
+
 // areFieldsPackedExpression returns a go expression checking whether g.t's fields are
 // packed. Returns "", false if g.t has no fields that may be potentially
 // packed, otherwise returns <clause>, true, where <clause> is an expression
@@ -271,23 +425,78 @@ func (g *interfaceGenerator) areFieldsPackedExpression() (string, bool) {
 	for accessor, _ := range g.as {
 		cs = append(cs, fmt.Sprintf("%s.Packed()", accessor))
 	}
+	// g.as is a map, so sort the clauses for the output to be reproducible.
+	sort.Strings(cs)
 	return strings.Join(cs, " && "), true
 }
 
+// sizeDispatcher returns a fieldDispatcher adding the size of each field to
+// primitiveSize if it's known at code generation time, and the expressions
+// computing the others to dynamicSizeTerms.
+func (g *interfaceGenerator) sizeDispatcher(primitiveSize *int, dynamicSizeTerms *[]string) fieldDispatcher {
+	return fieldDispatcher{
+		primitive: func(n, t *ast.Ident) {
+			if size, dynamic := g.scalarSize(t); !dynamic {
+				*primitiveSize += size
+			} else {
+				g.recordUsedMarshallable(t.Name)
+				*dynamicSizeTerms = append(*dynamicSizeTerms, fmt.Sprintf("%s.SizeBytes()", g.fieldAccessor(n)))
+			}
+		},
+		selector: func(n, tX, tSel *ast.Ident) {
+			tName := fmt.Sprintf("%s.%s", tX.Name, tSel.Name)
+			g.recordUsedImport(tX.Name)
+			g.recordUsedMarshallable(tName)
+			*dynamicSizeTerms = append(*dynamicSizeTerms, fmt.Sprintf("(*%s)(nil).SizeBytes()", tName))
+		},
+		array: func(n, t *ast.Ident, len int) {
+			if len < 1 {
+				// Zero-length arrays should've been rejected by validate().
+				panic("unreachable")
+			}
+			if size, dynamic := g.scalarSize(t); !dynamic {
+				*primitiveSize += size * len
+			} else {
+				g.recordUsedMarshallable(t.Name)
+				*dynamicSizeTerms = append(*dynamicSizeTerms, fmt.Sprintf("(*%s)(nil).SizeBytes()*%d", t.Name, len))
+			}
+		},
+		mapType: func(n *ast.Ident, m *ast.MapType) {
+			// Maps are preceded by their length.
+			*primitiveSize += 4
+			*dynamicSizeTerms = append(*dynamicSizeTerms, fmt.Sprintf("len(%s)*%s", g.fieldAccessor(n), g.mapEntrySize(m)))
+		},
+	}
+}
+
 func (g *interfaceGenerator) emitMarshallable() {
 	// Is g.t a packed struct without consideing field types?
 	thisPacked := true
 	g.forEachField(func(f *ast.Field) {
-		if f.Tag != nil {
-			if f.Tag.Value == "`marshal:\"unaligned\"`" {
-				if thisPacked {
-					debugfAt(g.f.Position(g.t.Pos()),
-						fmt.Sprintf("Marking type '%s' as not packed due to tag `marshal:\"unaligned\"`.\n", g.t.Name))
-					thisPacked = false
-				}
+		if hasFieldOption(f, "unaligned") {
+			if thisPacked {
+				debugfAt(g.f.Position(g.t.Pos()),
+					fmt.Sprintf("Marking type '%s' as not packed due to tag `marshal:\"unaligned\"`.\n", g.t.Name))
+				thisPacked = false
 			}
 		}
 	})
+	// The memory of a type with fields omitted from the generated layout
+	// doesn't match it.
+	for _, f := range g.t.Type.(*ast.StructType).Fields.List {
+		if !inLayout(f, g.layout) && thisPacked {
+			debugfAt(g.f.Position(g.t.Pos()),
+				fmt.Sprintf("Marking type '%s' as not packed since layout %q omits some of its fields.\n", g.t.Name, g.layout))
+			thisPacked = false
+		}
+	}
+	// Maps are marshalled as arrays sorted by key, unlike their memory.
+	if hasMapFields(g.t) && thisPacked {
+		debugfAt(g.f.Position(g.t.Pos()),
+			fmt.Sprintf("Marking type '%s' as not packed due to map fields.\n", g.t.Name))
+		thisPacked = false
+	}
+	g.packed = thisPacked
 
 	g.emit("// SizeBytes implements marshal.Marshallable.SizeBytes.\n")
 	g.emit("func (%s *%s) SizeBytes() int {\n", g.r, g.typeName())
@@ -295,34 +504,7 @@ func (g *interfaceGenerator) emitMarshallable() {
 		primitiveSize := 0
 		var dynamicSizeTerms []string
 
-		g.forEachField(fieldDispatcher{
-			primitive: func(n, t *ast.Ident) {
-				if size, dynamic := g.scalarSize(t); !dynamic {
-					primitiveSize += size
-				} else {
-					g.recordUsedMarshallable(t.Name)
-					dynamicSizeTerms = append(dynamicSizeTerms, fmt.Sprintf("%s.SizeBytes()", g.fieldAccessor(n)))
-				}
-			},
-			selector: func(n, tX, tSel *ast.Ident) {
-				tName := fmt.Sprintf("%s.%s", tX.Name, tSel.Name)
-				g.recordUsedImport(tX.Name)
-				g.recordUsedMarshallable(tName)
-				dynamicSizeTerms = append(dynamicSizeTerms, fmt.Sprintf("(*%s)(nil).SizeBytes()", tName))
-			},
-			array: func(n, t *ast.Ident, len int) {
-				if len < 1 {
-					// Zero-length arrays should've been rejected by validate().
-					panic("unreachable")
-				}
-				if size, dynamic := g.scalarSize(t); !dynamic {
-					primitiveSize += size * len
-				} else {
-					g.recordUsedMarshallable(t.Name)
-					dynamicSizeTerms = append(dynamicSizeTerms, fmt.Sprintf("(*%s)(nil).SizeBytes()*%d", t.Name, len))
-				}
-			},
-		}.dispatch)
+		g.forEachField(g.sizeDispatcher(&primitiveSize, &dynamicSizeTerms).dispatch)
 		g.emit("return %d", primitiveSize)
 		if len(dynamicSizeTerms) > 0 {
 			g.incIndent()
@@ -377,16 +559,32 @@ func (g *interfaceGenerator) emitMarshallable() {
 					return
 				}
 
+				if isByte(t) {
+					g.emit("copy(dst[:%d], %s[:])\n", size, g.fieldAccessor(n))
+					g.shift("dst", size)
+					return
+				}
 				g.emit("for i := 0; i < %d; i++ {\n", size)
 				g.inIndent(func() {
 					g.marshalScalar(fmt.Sprintf("%s[i]", g.fieldAccessor(n)), t.Name, "dst")
 				})
 				g.emit("}\n")
 			},
+			mapType: func(n *ast.Ident, m *ast.MapType) {
+				g.marshalMap(g.fieldAccessor(n), m, "dst")
+			},
 		}.dispatch)
 	})
 	g.emit("}\n\n")
 
+	g.emit("// MarshalBytesTo implements marshal.Marshallable.MarshalBytesTo.\n")
+	g.emit("func (%s *%s) MarshalBytesTo(dst []byte) []byte {\n", g.r, g.typeName())
+	g.inIndent(func() {
+		g.emit("%s.MarshalBytes(dst)\n", g.r)
+		g.emit("return dst[%s.SizeBytes():]\n", g.r)
+	})
+	g.emit("}\n\n")
+
 	g.emit("// UnmarshalBytes implements marshal.Marshallable.UnmarshalBytes.\n")
 	g.emit("func (%s *%s) UnmarshalBytes(src []byte) {\n", g.r, g.typeName())
 	g.inIndent(func() {
@@ -407,9 +605,13 @@ func (g *interfaceGenerator) emitMarshallable() {
 					return
 				}
 				g.unmarshalScalar(g.fieldAccessor(n), t.Name, "src")
+				if _, dynamic := g.scalarSize(t); dynamic {
+					g.recordPotentiallyNonPackedField(g.fieldAccessor(n))
+				}
 			},
 			selector: func(n, tX, tSel *ast.Ident) {
 				g.unmarshalScalar(g.fieldAccessor(n), fmt.Sprintf("%s.%s", tX.Name, tSel.Name), "src")
+				g.recordPotentiallyNonPackedField(g.fieldAccessor(n))
 			},
 			array: func(n, t *ast.Ident, size int) {
 				if n.Name == "_" {
@@ -426,11 +628,24 @@ func (g *interfaceGenerator) emitMarshallable() {
 					return
 				}
 
+				if isByte(t) {
+					g.emit("copy(%s[:], src[:%d])\n", g.fieldAccessor(n), size)
+					g.shift("src", size)
+					return
+				}
 				g.emit("for i := 0; i < %d; i++ {\n", size)
 				g.inIndent(func() {
 					g.unmarshalScalar(fmt.Sprintf("%s[i]", g.fieldAccessor(n)), t.Name, "src")
 				})
 				g.emit("}\n")
+				if _, dynamic := g.scalarSize(t); dynamic {
+					// The elements all have the same type, so the array is
+					// packed if its first element is.
+					g.recordPotentiallyNonPackedField(fmt.Sprintf("%s[0]", g.fieldAccessor(n)))
+				}
+			},
+			mapType: func(n *ast.Ident, m *ast.MapType) {
+				g.unmarshalMap(g.fieldAccessor(n), m, "src")
 			},
 		}.dispatch)
 	})
@@ -509,44 +724,7 @@ func (g *interfaceGenerator) emitMarshallable() {
 	g.recordUsedImport("usermem")
 	g.emit("func (%s *%s) CopyOut(task marshal.Task, addr usermem.Addr) (int, error) {\n", g.r, g.typeName())
 	g.inIndent(func() {
-		fallback := func() {
-			g.emit("// Type %s doesn't have a packed layout in memory, fall back to MarshalBytes.\n", g.typeName())
-			g.emit("buf := task.CopyScratchBuffer(%s.SizeBytes())\n", g.r)
-			g.emit("%s.MarshalBytes(buf)\n", g.r)
-			g.emit("return task.CopyOutBytes(addr, buf)\n")
-		}
-		if thisPacked {
-			g.recordUsedImport("reflect")
-			g.recordUsedImport("runtime")
-			g.recordUsedImport("unsafe")
-			if cond, ok := g.areFieldsPackedExpression(); ok {
-				g.emit("if !%s {\n", cond)
-				g.inIndent(fallback)
-				g.emit("}\n\n")
-			}
-			// Fast serialization.
-			g.emit("// Bypass escape analysis on %s. The no-op arithmetic operation on the\n", g.r)
-			g.emit("// pointer makes the compiler think val doesn't depend on %s.\n", g.r)
-			g.emit("// See src/runtime/stubs.go:noescape() in the golang toolchain.\n")
-			g.emit("ptr := unsafe.Pointer(%s)\n", g.r)
-			g.emit("val := uintptr(ptr)\n")
-			g.emit("val = val^0\n\n")
-
-			g.emit("// Construct a slice backed by %s's underlying memory.\n", g.r)
-			g.emit("var buf []byte\n")
-			g.emit("hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))\n")
-			g.emit("hdr.Data = val\n")
-			g.emit("hdr.Len = %s.SizeBytes()\n", g.r)
-			g.emit("hdr.Cap = %s.SizeBytes()\n\n", g.r)
-
-			g.emit("len, err := task.CopyOutBytes(addr, buf)\n")
-			g.emit("// Since we bypassed the compiler's escape analysis, indicate that %s\n", g.r)
-			g.emit("// must live until after the CopyOutBytes.\n")
-			g.emit("runtime.KeepAlive(%s)\n", g.r)
-			g.emit("return len, err\n")
-		} else {
-			fallback()
-		}
+		g.emitCopyOutBytes("")
 	})
 	g.emit("}\n\n")
 
@@ -573,7 +751,8 @@ func (g *interfaceGenerator) emitMarshallable() {
 			g.recordUsedImport("runtime")
 			g.recordUsedImport("unsafe")
 			if cond, ok := g.areFieldsPackedExpression(); ok {
-				g.emit("if !%s {\n", cond)
+				// cond is a conjunction, so it must be negated as a whole.
+				g.emit("if !(%s) {\n", cond)
 				g.inIndent(fallback)
 				g.emit("}\n\n")
 			}
@@ -597,9 +776,266 @@ func (g *interfaceGenerator) emitMarshallable() {
 			g.emit("// must live until after the CopyInBytes.\n")
 			g.emit("runtime.KeepAlive(%s)\n", g.r)
 			g.emit("return len, err\n")
+		} else if hasMapFields(g.t) {
+			g.emitCopyInMaps()
 		} else {
 			fallback()
 		}
 	})
 	g.emit("}\n\n")
 }
+
+// emitCopyOutBytes emits the body of a method copying the marshalled form of
+// g.t to a task's memory. If limit isn't empty, it is a variable no larger than
+// the size of g.t, and only that many bytes are copied.
+func (g *interfaceGenerator) emitCopyOutBytes(limit string) {
+	size := fmt.Sprintf("%s.SizeBytes()", g.r)
+	if limit != "" {
+		size = limit
+	}
+	fallback := func() {
+		g.emit("// Type %s doesn't have a packed layout in memory, fall back to MarshalBytes.\n", g.typeName())
+		g.emit("buf := task.CopyScratchBuffer(%s.SizeBytes())\n", g.r)
+		g.emit("%s.MarshalBytes(buf)\n", g.r)
+		if limit == "" {
+			g.emit("return task.CopyOutBytes(addr, buf)\n")
+		} else {
+			g.emit("return task.CopyOutBytes(addr, buf[:%s])\n", limit)
+		}
+	}
+	if g.packed {
+		g.recordUsedImport("reflect")
+		g.recordUsedImport("runtime")
+		g.recordUsedImport("unsafe")
+		if cond, ok := g.areFieldsPackedExpression(); ok {
+			// cond is a conjunction, so it must be negated as a whole.
+			g.emit("if !(%s) {\n", cond)
+			g.inIndent(fallback)
+			g.emit("}\n\n")
+		}
+		// Fast serialization.
+		g.emit("// Bypass escape analysis on %s. The no-op arithmetic operation on the\n", g.r)
+		g.emit("// pointer makes the compiler think val doesn't depend on %s.\n", g.r)
+		g.emit("// See src/runtime/stubs.go:noescape() in the golang toolchain.\n")
+		g.emit("ptr := unsafe.Pointer(%s)\n", g.r)
+		g.emit("val := uintptr(ptr)\n")
+		g.emit("val = val^0\n\n")
+
+		g.emit("// Construct a slice backed by %s's underlying memory.\n", g.r)
+		g.emit("var buf []byte\n")
+		g.emit("hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))\n")
+		g.emit("hdr.Data = val\n")
+		g.emit("hdr.Len = %s\n", size)
+		g.emit("hdr.Cap = %s\n\n", size)
+
+		g.emit("len, err := task.CopyOutBytes(addr, buf)\n")
+		g.emit("// Since we bypassed the compiler's escape analysis, indicate that %s\n", g.r)
+		g.emit("// must live until after the CopyOutBytes.\n")
+		g.emit("runtime.KeepAlive(%s)\n", g.r)
+		g.emit("return len, err\n")
+	} else {
+		fallback()
+	}
+}
+
+// emitCopyOutN emits a CopyOutN method, which copies at most limit bytes of
+// the marshalled form of g.t to a task's memory, as when a versioned struct is
+// copied to an older, smaller user buffer.
+//
+// Preconditions: emitMarshallable has been called.
+func (g *interfaceGenerator) emitCopyOutN() {
+	g.recordUsedImport("marshal")
+	g.recordUsedImport("usermem")
+	g.emit("// CopyOutN is like CopyOut, but copies at most limit bytes. It copies all\n")
+	g.emit("// of %s if limit is at least %s.SizeBytes().\n", g.r, g.r)
+	g.emit("//\n")
+	g.emit("// Preconditions: limit >= 0.\n")
+	g.emit("func (%s *%s) CopyOutN(task marshal.Task, addr usermem.Addr, limit int) (int, error) {\n", g.r, g.typeName())
+	g.inIndent(func() {
+		g.emit("if size := %s.SizeBytes(); limit > size {\n", g.r)
+		g.inIndent(func() {
+			g.emit("limit = size\n")
+		})
+		g.emit("}\n")
+		g.emitCopyOutBytes("limit")
+	})
+	g.emit("}\n\n")
+}
+
+// emitCopyInMaps emits the body of CopyIn for a type with map fields. The
+// size of such a type in memory depends on the lengths of its maps, which are
+// read from memory first.
+func (g *interfaceGenerator) emitCopyInMaps() {
+	g.emit("// Type %s holds maps, whose sizes depend on their lengths. Read the\n", g.typeName())
+	g.emit("// length of each map to find the size of %s, then fall back to\n", g.typeName())
+	g.emit("// UnmarshalBytes.\n")
+
+	primitiveSize := 0
+	var dynamicSizeTerms []string
+	declared := false
+	// flush emits the code adding the size of the fields dispatched since its
+	// last call to size.
+	flush := func() {
+		if declared && primitiveSize == 0 && len(dynamicSizeTerms) == 0 {
+			return
+		}
+		terms := append([]string{fmt.Sprintf("%d", primitiveSize)}, dynamicSizeTerms...)
+		if declared {
+			g.emit("size += %s\n", strings.Join(terms, " + "))
+		} else {
+			g.emit("size := %s\n", strings.Join(terms, " + "))
+			declared = true
+		}
+		primitiveSize = 0
+		dynamicSizeTerms = nil
+	}
+
+	fd := g.sizeDispatcher(&primitiveSize, &dynamicSizeTerms)
+	fd.mapType = func(n *ast.Ident, m *ast.MapType) {
+		flush()
+		g.recordUsedImport("syscall")
+		g.emit("{\n")
+		g.inIndent(func() {
+			g.emit("buf := task.CopyScratchBuffer(4)\n")
+			g.emit("if n, err := task.CopyInBytes(addr+usermem.Addr(size), buf); err != nil {\n")
+			g.inIndent(func() {
+				g.emit("return n, err\n")
+			})
+			g.emit("}\n")
+			g.emit("count := usermem.ByteOrder.Uint32(buf)\n")
+			g.emit("if count > marshal.MaxMapLen {\n")
+			g.inIndent(func() {
+				g.emit("return 0, syscall.EINVAL\n")
+			})
+			g.emit("}\n")
+			g.emit("size += 4 + int(count)*%s\n", g.mapEntrySize(m))
+		})
+		g.emit("}\n")
+	}
+	g.forEachField(fd.dispatch)
+	flush()
+
+	g.emit("buf := task.CopyScratchBuffer(size)\n")
+	g.emit("n, err := task.CopyInBytes(addr, buf)\n")
+	g.emit("if err != nil {\n")
+	g.inIndent(func() {
+		g.emit("return n, err\n")
+	})
+	g.emit("}\n")
+	g.emit("%s.UnmarshalBytes(buf)\n", g.r)
+	g.emit("return n, nil\n")
+}
+
+// emitEquals emits an Equals method comparing the fields of g.t that are part
+// of the generated layout, ignoring padding. Fields of other Marshallable types
+// are compared with their own Equals method, so these types must also be
+// marked with the equals option.
+func (g *interfaceGenerator) emitEquals() {
+	// differ emits code returning false if the values a and b differ. They're
+	// compared with == if primitive, and with Equals otherwise.
+	differ := func(a, b string, primitive bool) {
+		if primitive {
+			g.emit("if %s != %s {\n", a, b)
+		} else {
+			g.emit("if !%s.Equals(%s) {\n", a, b)
+		}
+		g.inIndent(func() {
+			g.emit("return false\n")
+		})
+		g.emit("}\n")
+	}
+	isPrimitive := func(t *ast.Ident) bool {
+		_, dynamic := g.scalarSize(t)
+		return !dynamic
+	}
+
+	g.emit("// Equals returns true if %s and other have the same marshalled fields,\n", g.r)
+	g.emit("// ignoring padding.\n")
+	g.emit("func (%s *%s) Equals(other %s) bool {\n", g.r, g.typeName(), g.typeName())
+	g.inIndent(func() {
+		g.forEachField(fieldDispatcher{
+			primitive: func(n, t *ast.Ident) {
+				if n.Name == "_" {
+					return
+				}
+				differ(g.fieldAccessor(n), "other."+n.Name, isPrimitive(t))
+			},
+			selector: func(n, _, _ *ast.Ident) {
+				differ(g.fieldAccessor(n), "other."+n.Name, false)
+			},
+			array: func(n, t *ast.Ident, size int) {
+				if n.Name == "_" {
+					return
+				}
+				if isPrimitive(t) {
+					differ(g.fieldAccessor(n), "other."+n.Name, true)
+					return
+				}
+				g.emit("for i := 0; i < %d; i++ {\n", size)
+				g.inIndent(func() {
+					differ(fmt.Sprintf("%s[i]", g.fieldAccessor(n)), fmt.Sprintf("other.%s[i]", n.Name), false)
+				})
+				g.emit("}\n")
+			},
+			mapType: func(n *ast.Ident, m *ast.MapType) {
+				_, vPrimitive := g.mapElemType(m.Value)
+				g.emit("if len(%s) != len(other.%s) {\n", g.fieldAccessor(n), n.Name)
+				g.inIndent(func() {
+					g.emit("return false\n")
+				})
+				g.emit("}\n")
+				// Keys are looked up with ==, which also ignores padding.
+				g.emit("for key, val := range %s {\n", g.fieldAccessor(n))
+				g.inIndent(func() {
+					g.emit("otherVal, ok := other.%s[key]\n", n.Name)
+					g.emit("if !ok {\n")
+					g.inIndent(func() {
+						g.emit("return false\n")
+					})
+					g.emit("}\n")
+					differ("val", "otherVal", vPrimitive)
+				})
+				g.emit("}\n")
+			},
+		}.dispatch)
+		g.emit("return true\n")
+	})
+	g.emit("}\n\n")
+}
+
+// emitDeepCopy emits a DeepCopy method returning a copy of g.t that shares no
+// maps with the original. Types with maps can't be fields of other types, so
+// the other fields are copied by value.
+func (g *interfaceGenerator) emitDeepCopy() {
+	g.emit("// DeepCopy returns a copy of %s.\n", g.r)
+	g.emit("func (%s *%s) DeepCopy() %s {\n", g.r, g.typeName(), g.typeName())
+	g.inIndent(func() {
+		if !hasMapFields(g.t) {
+			g.emit("return *%s\n", g.r)
+			return
+		}
+		g.emit("c := *%s\n", g.r)
+		for _, f := range g.t.Type.(*ast.StructType).Fields.List {
+			m, ok := f.Type.(*ast.MapType)
+			if !ok {
+				continue
+			}
+			kName, _ := g.mapElemType(m.Key)
+			vName, _ := g.mapElemType(m.Value)
+			for _, n := range f.Names {
+				g.emit("if %s != nil {\n", g.fieldAccessor(n))
+				g.inIndent(func() {
+					g.emit("c.%s = make(map[%s]%s, len(%s))\n", n.Name, kName, vName, g.fieldAccessor(n))
+					g.emit("for key, val := range %s {\n", g.fieldAccessor(n))
+					g.inIndent(func() {
+						g.emit("c.%s[key] = val\n", n.Name)
+					})
+					g.emit("}\n")
+				})
+				g.emit("}\n")
+			}
+		}
+		g.emit("return c\n")
+	})
+	g.emit("}\n\n")
+}
@@ -45,9 +45,16 @@ type testGenerator struct {
 	// for. We need this to construct test instances for the type, since the
 	// tests aren't written in the same package.
 	decl *importStmt
+
+	// layout is the layout generated if t has conditional fields. See
+	// layout.go.
+	layout string
+
+	// opts are the options t was marked with.
+	opts typeOptions
 }
 
-func newTestGenerator(t *ast.TypeSpec) *testGenerator {
+func newTestGenerator(t *ast.TypeSpec, opts typeOptions, layout string) *testGenerator {
 	if _, ok := t.Type.(*ast.StructType); !ok {
 		panic(fmt.Sprintf("Attempting to generate code for a not struct type %v", t))
 	}
@@ -55,6 +62,8 @@ func newTestGenerator(t *ast.TypeSpec) *testGenerator {
 		t:       t,
 		r:       receiverName(t),
 		imports: newImportTable(),
+		layout:  layout,
+		opts:    opts,
 	}
 
 	for _, i := range standardImports {
@@ -107,7 +116,21 @@ func (g *testGenerator) emitTestSuspectAlignment() {
 func (g *testGenerator) emitTestMarshalUnmarshalPreservesData() {
 	g.inTestFunction("TestSafeMarshalUnmarshalPreservesData", func() {
 		g.emit("var x, y, z, yUnsafe, zUnsafe %s\n", g.typeName())
-		g.emit("analysis.RandomizeValue(&x)\n\n")
+		g.emit("analysis.RandomizeValue(&x)\n")
+		// Fields omitted from the layout aren't preserved, so reset them to
+		// the zero values of y, which is still zero.
+		g.forEachField(func(f *ast.Field) {
+			if inLayout(f, g.layout) {
+				return
+			}
+			for _, n := range f.Names {
+				if n.Name == "_" {
+					continue
+				}
+				g.emit("x.%s = y.%s\n", n.Name, n.Name)
+			}
+		})
+		g.emitNoIndent("\n")
 
 		g.emit("buf := make([]byte, x.SizeBytes())\n")
 		g.emit("x.MarshalBytes(buf)\n")
@@ -142,10 +165,54 @@ func (g *testGenerator) emitTestMarshalUnmarshalPreservesData() {
 	})
 }
 
+func (g *testGenerator) emitTestEquals() {
+	g.inTestFunction("TestEquals", func() {
+		g.emit("var x, y %s\n", g.typeName())
+		g.emit("analysis.RandomizeValue(&x)\n")
+		g.emit("if !x.Equals(x) {\n")
+		g.inIndent(func() {
+			g.emit("t.Fatal(fmt.Sprintf(\"Value not equal to itself: %+v\\n\", x))\n")
+		})
+		g.emit("}\n\n")
+
+		g.emit("buf := make([]byte, x.SizeBytes())\n")
+		g.emit("x.MarshalBytes(buf)\n")
+		g.emit("y.UnmarshalBytes(buf)\n")
+		g.emit("if !x.Equals(y) {\n")
+		g.inIndent(func() {
+			g.emit("t.Fatal(fmt.Sprintf(\"Values not equal across Marshal/Unmarshal cycle:\\nBefore: %+v\\nAfter: %+v\\n\", x, y))\n")
+		})
+		g.emit("}\n")
+	})
+}
+
+func (g *testGenerator) emitTestDeepCopy() {
+	g.inTestFunction("TestDeepCopy", func() {
+		g.emit("var x %s\n", g.typeName())
+		g.emit("analysis.RandomizeValue(&x)\n")
+		g.emit("y := x.DeepCopy()\n")
+		g.emit("if !reflect.DeepEqual(x, y) {\n")
+		g.inIndent(func() {
+			g.emit("t.Fatal(fmt.Sprintf(\"Data corrupted by DeepCopy:\\nBefore: %+v\\nAfter: %+v\\n\", x, y))\n")
+		})
+		g.emit("}\n")
+	})
+}
+
 func (g *testGenerator) emitTests() {
 	g.emitTestNonZeroSize()
-	g.emitTestSuspectAlignment()
+	// Types with maps aren't packed, since maps are marshalled as arrays, so
+	// their memory layout doesn't matter.
+	if !hasMapFields(g.t) {
+		g.emitTestSuspectAlignment()
+	}
 	g.emitTestMarshalUnmarshalPreservesData()
+	if g.opts.equals {
+		g.emitTestEquals()
+	}
+	if g.opts.copy {
+		g.emitTestDeepCopy()
+	}
 }
 
 func (g *testGenerator) write(out io.Writer) error {
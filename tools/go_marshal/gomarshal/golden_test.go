@@ -0,0 +1,212 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomarshal
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files rather than checking them. Since Bazel runs
+// tests from a copy of the source tree, run it with:
+//
+//	go test ./tools/go_marshal/gomarshal -run TestGolden -update
+var update = flag.Bool("update", false, "update the golden files in testdata rather than checking them")
+
+// goldenCase is an invocation of go_marshal whose output is checked against
+// golden files.
+type goldenCase struct {
+	// name is the prefix of the golden files in testdata.
+	name string
+	// srcs are the input files, relative to this package.
+	srcs []string
+	// pkg, layouts and layout are the arguments to NewGenerator.
+	pkg     string
+	layouts []string
+	layout  string
+}
+
+// goldenCases run go_marshal over the input files of the test packages, with
+// the arguments used by the go_library macro.
+var goldenCases = []goldenCase{
+	{
+		name: "test",
+		srcs: []string{"../test/test.go"},
+		pkg:  "test",
+	},
+	{
+		name: "external",
+		srcs: []string{"../test/external/external.go"},
+		pkg:  "external",
+	},
+	{
+		name:    "layout",
+		srcs:    []string{"../test/layout/layout.go"},
+		pkg:     "layout",
+		layouts: []string{"marshal_wide"},
+	},
+	{
+		name:    "layout_default",
+		srcs:    []string{"../test/layout/layout.go"},
+		pkg:     "layout",
+		layouts: []string{"marshal_wide"},
+		layout:  DefaultLayout,
+	},
+	{
+		name:    "layout_marshal_wide",
+		srcs:    []string{"../test/layout/layout.go"},
+		pkg:     "layout",
+		layouts: []string{"marshal_wide"},
+		layout:  "marshal_wide",
+	},
+}
+
+// generate runs go_marshal over srcs, and returns the generated code and
+// tests.
+func generate(t *testing.T, c goldenCase, srcs []string) (string, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "go_marshal")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out.go")
+	outTest := filepath.Join(dir, "out_test.go")
+	g, err := NewGenerator(srcs, out, outTest, c.pkg, nil, c.layouts, c.layout, "", "")
+	if err != nil {
+		t.Fatalf("NewGenerator failed: %v", err)
+	}
+	err = g.Run()
+	// The generator doesn't close its output files.
+	g.output.Close()
+	g.outputTest.Close()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var outputs []string
+	for _, path := range []string{out, outTest} {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		outputs = append(outputs, string(buf))
+	}
+	return outputs[0], outputs[1]
+}
+
+// firstDiff describes the first line where got and want differ.
+func firstDiff(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, gotLines[i], wantLines[i])
+		}
+	}
+	return fmt.Sprintf("got %d lines, want %d", len(gotLines), len(wantLines))
+}
+
+// TestGolden checks the generated code against the golden files in testdata,
+// so that changes to the output of the generator are visible in reviews.
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases {
+		t.Run(c.name, func(t *testing.T) {
+			code, tests := generate(t, c, c.srcs)
+			for _, f := range []struct {
+				path string
+				got  string
+			}{
+				{filepath.Join("testdata", c.name+".go.golden"), code},
+				{filepath.Join("testdata", c.name+"_test.go.golden"), tests},
+			} {
+				if *update {
+					if err := ioutil.WriteFile(f.path, []byte(f.got), 0644); err != nil {
+						t.Fatalf("WriteFile failed: %v", err)
+					}
+					continue
+				}
+				want, err := ioutil.ReadFile(f.path)
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				if f.got != string(want) {
+					t.Errorf("generated code differs from %s, %s; rerun with -update if the change is expected", f.path, firstDiff(f.got, string(want)))
+				}
+			}
+		})
+	}
+}
+
+// TestDeterministic checks that the generated code doesn't change between
+// runs, nor with the order of the input files.
+func TestDeterministic(t *testing.T) {
+	for _, layout := range []string{"", "marshal_wide"} {
+		c := goldenCase{
+			srcs: []string{
+				"../test/external/external.go",
+				"../test/layout/layout.go",
+				"../test/test.go",
+			},
+			pkg:     "test",
+			layouts: []string{"marshal_wide"},
+			layout:  layout,
+		}
+		wantCode, wantTests := generate(t, c, c.srcs)
+		srcs := append([]string(nil), c.srcs...)
+		// Maps are iterated in a different order each time, so try several
+		// times.
+		for i := 0; i < 10; i++ {
+			rand.Shuffle(len(srcs), func(i, j int) {
+				srcs[i], srcs[j] = srcs[j], srcs[i]
+			})
+			code, tests := generate(t, c, srcs)
+			if code != wantCode {
+				t.Errorf("layout %q: generated code for inputs %v differs from the code for %v, %s", layout, srcs, c.srcs, firstDiff(code, wantCode))
+			}
+			if tests != wantTests {
+				t.Errorf("layout %q: generated tests for inputs %v differ from the tests for %v, %s", layout, srcs, c.srcs, firstDiff(tests, wantTests))
+			}
+		}
+	}
+}
+
+// TestImportOrder checks that imports are sorted by path, whether they're
+// aliased or not.
+func TestImportOrder(t *testing.T) {
+	is := newImportTable()
+	is.add("unsafe").markUsed()
+	is.add("reflect").markUsed()
+	is.add("sort")
+	is.is["aa"] = &importStmt{name: "aa", path: "z/external", aliased: true, used: true}
+	is.is["zz"] = &importStmt{name: "zz", path: "a/external", aliased: true, used: true}
+
+	var buf bytes.Buffer
+	if err := is.write(&buf); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want := "import (\n    zz \"a/external\"\n    \"reflect\"\n    \"unsafe\"\n    aa \"z/external\"\n)\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got imports:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomarshal
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+)
+
+// DefaultLayout names the layout used when none of the build tags selecting
+// layouts is set.
+const DefaultLayout = "default"
+
+// fieldOptions returns the comma-separated options in the marshal tag of f,
+// e.g. ["unaligned", "build=amd64"] for `marshal:"unaligned,build=amd64"`.
+func fieldOptions(f *ast.Field) []string {
+	if f.Tag == nil {
+		return nil
+	}
+	tag := reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("marshal")
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// hasFieldOption returns true if the marshal tag of f contains option.
+func hasFieldOption(f *ast.Field, option string) bool {
+	for _, o := range fieldOptions(f) {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldCondition returns the build tag a conditional field depends on, and
+// whether the field is omitted, rather than included, when the tag is set.
+// ok is false if f isn't conditional.
+//
+// A field tagged `marshal:"build=amd64"` is only part of the layout selected
+// by amd64, and a field tagged `marshal:"build=!amd64"` is part of every
+// layout except it.
+func fieldCondition(f *ast.Field) (tag string, negated bool, ok bool) {
+	for _, o := range fieldOptions(f) {
+		if !strings.HasPrefix(o, "build=") {
+			continue
+		}
+		tag = strings.TrimPrefix(o, "build=")
+		if strings.HasPrefix(tag, "!") {
+			return tag[1:], true, true
+		}
+		return tag, false, true
+	}
+	return "", false, false
+}
+
+// inLayout returns true if f is part of the layout selected by the build tag
+// layout, which may be DefaultLayout.
+func inLayout(f *ast.Field, layout string) bool {
+	tag, negated, ok := fieldCondition(f)
+	if !ok {
+		return true
+	}
+	return (tag == layout) != negated
+}
+
+// hasConditionalFields returns true if the struct type t has fields that are
+// only part of some layouts.
+func hasConditionalFields(t *ast.TypeSpec) bool {
+	for _, f := range t.Type.(*ast.StructType).Fields.List {
+		if _, _, ok := fieldCondition(f); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutConstraint returns the build constraint selecting layout among
+// layouts.
+func layoutConstraint(layout string, layouts []string) string {
+	if layout != DefaultLayout {
+		return layout
+	}
+	terms := make([]string, 0, len(layouts))
+	for _, l := range layouts {
+		terms = append(terms, "!"+l)
+	}
+	return strings.Join(terms, ",")
+}
+
+// layoutComment returns the comment documenting the layout of the types in a
+// file generated for layout.
+func layoutComment(layout string, layouts []string) string {
+	var b strings.Builder
+	if layout == DefaultLayout {
+		fmt.Fprintf(&b, "// This file holds the default layout of types with conditional fields, used\n")
+		fmt.Fprintf(&b, "// when none of the build tags %s is set. Fields tagged\n", strings.Join(layouts, ", "))
+		fmt.Fprintf(&b, "// `marshal:\"build=<tag>\"` aren't part of this layout, and fields tagged\n")
+		fmt.Fprintf(&b, "// `marshal:\"build=!<tag>\"` are.\n")
+	} else {
+		fmt.Fprintf(&b, "// This file holds the layout of types with conditional fields used when the\n")
+		fmt.Fprintf(&b, "// build tag %s is set. Fields tagged `marshal:\"build=%s\"` are part of\n", layout, layout)
+		fmt.Fprintf(&b, "// this layout, and fields tagged `marshal:\"build=!%s\"` aren't.\n", layout)
+	}
+	return b.String()
+}
+
+// containsString returns true if ss contains s.
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomarshal
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// unknownSize is the size, offset or alignment of a field or type that isn't
+// known at code generation time, e.g. because it depends on a type declared in
+// another package.
+const unknownSize = -1
+
+// fieldLayout is the layout of a field in the marshalled representation of a
+// type.
+type fieldLayout struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+}
+
+// typeLayout is the layout of a type, as written to the layout report and read
+// from budget files.
+//
+// Size and field offsets are those of the marshalled representation, which has
+// no implicit padding. Align is the alignment of the type in memory on 64-bit
+// platforms.
+type typeLayout struct {
+	Name string `json:"name"`
+	// Layout is the layout the type is generated for if it has conditional
+	// fields. See layout.go.
+	Layout string `json:"layout,omitempty"`
+	Size   int    `json:"size"`
+	Align  int    `json:"align"`
+	// Fields may be omitted from budgets, in which case only the size and
+	// alignment of the type are checked.
+	Fields []fieldLayout `json:"fields,omitempty"`
+}
+
+// layoutReport is the format of layout reports and budget files.
+type layoutReport struct {
+	Package string       `json:"package"`
+	Types   []typeLayout `json:"types"`
+}
+
+// layoutResolver computes the layouts of the types marked for code
+// generation, resolving the types of their fields among them.
+type layoutResolver struct {
+	// types maps the names of types marked for code generation to their
+	// declarations.
+	types map[string]*ast.TypeSpec
+
+	// layout is the layout to compute, as in Generator.layout.
+	layout string
+
+	// cache holds the layouts already computed. A nil entry marks a type
+	// being computed, and breaks cycles.
+	cache map[string]*typeLayout
+}
+
+func newLayoutResolver(ms []marshallableType, layout string) *layoutResolver {
+	r := &layoutResolver{
+		types:  make(map[string]*ast.TypeSpec),
+		layout: layout,
+		cache:  make(map[string]*typeLayout),
+	}
+	for _, m := range ms {
+		r.types[m.t.Name.Name] = m.t
+	}
+	return r
+}
+
+// typeLayout returns the layout of the type named name. ok is false if name
+// isn't marked for code generation, or its layout can't be computed.
+func (r *layoutResolver) typeLayout(name string) (l *typeLayout, ok bool) {
+	if l, ok := r.cache[name]; ok {
+		return l, l != nil
+	}
+	t, ok := r.types[name]
+	// Types with conditional fields only have a layout when one is selected.
+	if !ok || (r.layout == "" && hasConditionalFields(t)) {
+		return nil, false
+	}
+	r.cache[name] = nil
+	l = &typeLayout{
+		Name:  name,
+		Align: 1,
+	}
+	if hasConditionalFields(t) {
+		l.Layout = r.layout
+	}
+	offset := 0
+	for _, f := range t.Type.(*ast.StructType).Fields.List {
+		if !inLayout(f, r.layout) {
+			continue
+		}
+		size, align := r.exprLayout(f.Type)
+		if align == unknownSize || l.Align == unknownSize {
+			l.Align = unknownSize
+		} else if align > l.Align {
+			l.Align = align
+		}
+		for _, n := range f.Names {
+			l.Fields = append(l.Fields, fieldLayout{
+				Name:   n.Name,
+				Type:   types.ExprString(f.Type),
+				Offset: offset,
+				Size:   size,
+			})
+			if offset != unknownSize && size != unknownSize {
+				offset += size
+			} else {
+				offset = unknownSize
+			}
+		}
+	}
+	l.Size = offset
+	r.cache[name] = l
+	return l, true
+}
+
+// exprLayout returns the marshalled size and the alignment of the field type
+// e. Either may be unknownSize.
+func (r *layoutResolver) exprLayout(e ast.Expr) (size, align int) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if size, ok := primitiveSize(t.Name); ok {
+			return size, size
+		}
+		if l, ok := r.typeLayout(t.Name); ok {
+			return l.Size, l.Align
+		}
+	case *ast.ArrayType:
+		lit, ok := t.Len.(*ast.BasicLit)
+		if !ok {
+			break
+		}
+		n, err := strconv.Atoi(lit.Value)
+		if err != nil {
+			break
+		}
+		size, align := r.exprLayout(t.Elt)
+		if size == unknownSize {
+			return unknownSize, align
+		}
+		return size * n, align
+	case *ast.MapType:
+		// Maps are marshalled with their entries, and stored as a pointer.
+		return unknownSize, 8
+	}
+	// Types declared in other packages aren't known.
+	return unknownSize, unknownSize
+}
+
+// readBudget reads the budget file at path.
+func readBudget(path string) ([]typeLayout, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read budget file %q: %v", path, err)
+	}
+	var budget layoutReport
+	if err := json.Unmarshal(buf, &budget); err != nil {
+		return nil, fmt.Errorf("Budget file %q can't be parsed: %v", path, err)
+	}
+	return budget.Types, nil
+}
+
+// writeReport writes the layout report of the types in ls to path.
+func writeReport(path, pkg string, ls []typeLayout) error {
+	if ls == nil {
+		// Write an empty list rather than null.
+		ls = []typeLayout{}
+	}
+	buf, err := json.MarshalIndent(layoutReport{Package: pkg, Types: ls}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(buf, '\n'), 0644); err != nil {
+		return fmt.Errorf("Couldn't write layout report %q: %v", path, err)
+	}
+	return nil
+}
+
+// checkBudget compares the generated layouts ls to budget, and returns an
+// error describing every difference.
+//
+// marked is the set of types marked for code generation in the input files.
+// Budget entries are only checked against ls if they're for one of these types
+// and for layout; the others are checked by the go_marshal invocations
+// generating them, so that a package needs a single budget file.
+func checkBudget(budget, ls []typeLayout, marked map[string]struct{}, layout string) error {
+	generated := make(map[string]*typeLayout)
+	for i := range ls {
+		generated[ls[i].Name] = &ls[i]
+	}
+
+	var diffs []string
+	for _, want := range budget {
+		if _, ok := marked[want.Name]; !ok || want.Layout != layout {
+			continue
+		}
+		got, ok := generated[want.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is in the budget for layout %q, but isn't generated for it", want.Name, want.Layout))
+			continue
+		}
+		if d := diffLayout(got, &want); len(d) > 0 {
+			diffs = append(diffs, fmt.Sprintf("Layout of %s doesn't match the budget:\n    %s", want.Name, strings.Join(d, "\n    ")))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s", strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
+// diffLayout returns the differences between got and the budget want.
+func diffLayout(got, want *typeLayout) []string {
+	var d []string
+	if got.Size != want.Size {
+		d = append(d, fmt.Sprintf("size is %d, budget is %d", got.Size, want.Size))
+	}
+	if got.Align != want.Align {
+		d = append(d, fmt.Sprintf("alignment is %d, budget is %d", got.Align, want.Align))
+	}
+	if want.Fields == nil {
+		return d
+	}
+	for i := 0; i < len(got.Fields) || i < len(want.Fields); i++ {
+		switch {
+		case i >= len(want.Fields):
+			f := got.Fields[i]
+			d = append(d, fmt.Sprintf("field %d (%s %s) at offset %d isn't in the budget", i, f.Name, f.Type, f.Offset))
+		case i >= len(got.Fields):
+			f := want.Fields[i]
+			d = append(d, fmt.Sprintf("field %d (%s %s) at offset %d is missing", i, f.Name, f.Type, f.Offset))
+		default:
+			g, w := got.Fields[i], want.Fields[i]
+			if g.Name != w.Name {
+				d = append(d, fmt.Sprintf("field %d is %s, budget is %s", i, g.Name, w.Name))
+			}
+			if g.Type != w.Type {
+				d = append(d, fmt.Sprintf("field %d (%s) has type %s, budget is %s", i, g.Name, g.Type, w.Type))
+			}
+			if g.Offset != w.Offset {
+				d = append(d, fmt.Sprintf("field %d (%s) is at offset %d, budget is %d", i, g.Name, g.Offset, w.Offset))
+			}
+			if g.Size != w.Size {
+				d = append(d, fmt.Sprintf("field %d (%s) has size %d, budget is %d", i, g.Name, g.Size, w.Size))
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,305 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomarshal
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const reportSrc = `package test
+
+import "gvisor.dev/gvisor/tools/go_marshal/test/external"
+
+// +marshal
+type Timespec struct {
+	Sec  int64
+	Nsec int64
+}
+
+// +marshal
+type Stat struct {
+	Ino   uint64
+	Mode  uint32
+	_     [4]byte
+	ATime Timespec
+	Times [2]Timespec
+}
+
+// +marshal
+type Ext struct {
+	N int32
+	X external.External
+	M int32
+}
+
+// +marshal
+type Sigaction struct {
+	Flags    uint32
+	_        uint32 ` + "`marshal:\"build=wide\"`" + `
+	Restorer uint64 ` + "`marshal:\"build=wide\"`" + `
+}
+`
+
+// layouts returns the layouts of the types declared in reportSrc generated for
+// layout, and the set of types marked for code generation.
+func layouts(t *testing.T, layout string) ([]typeLayout, map[string]struct{}) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "test.go", reportSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+	var g Generator
+	marked := g.collectMarshallabeTypes(f, fset)
+	r := newLayoutResolver(marked, layout)
+	names := make(map[string]struct{})
+	var ls []typeLayout
+	for _, m := range marked {
+		names[m.t.Name.Name] = struct{}{}
+		if hasConditionalFields(m.t) != (layout != "") {
+			continue
+		}
+		if l, ok := r.typeLayout(m.t.Name.Name); ok {
+			ls = append(ls, *l)
+		}
+	}
+	return ls, names
+}
+
+func TestTypeLayout(t *testing.T) {
+	ls, _ := layouts(t, "")
+	want := []typeLayout{
+		{
+			Name:  "Timespec",
+			Size:  16,
+			Align: 8,
+			Fields: []fieldLayout{
+				{Name: "Sec", Type: "int64", Offset: 0, Size: 8},
+				{Name: "Nsec", Type: "int64", Offset: 8, Size: 8},
+			},
+		},
+		{
+			Name:  "Stat",
+			Size:  64,
+			Align: 8,
+			Fields: []fieldLayout{
+				{Name: "Ino", Type: "uint64", Offset: 0, Size: 8},
+				{Name: "Mode", Type: "uint32", Offset: 8, Size: 4},
+				{Name: "_", Type: "[4]byte", Offset: 12, Size: 4},
+				{Name: "ATime", Type: "Timespec", Offset: 16, Size: 16},
+				{Name: "Times", Type: "[2]Timespec", Offset: 32, Size: 32},
+			},
+		},
+		{
+			// The size of types declared in other packages isn't known.
+			Name:  "Ext",
+			Size:  unknownSize,
+			Align: unknownSize,
+			Fields: []fieldLayout{
+				{Name: "N", Type: "int32", Offset: 0, Size: 4},
+				{Name: "X", Type: "external.External", Offset: 4, Size: unknownSize},
+				{Name: "M", Type: "int32", Offset: unknownSize, Size: 4},
+			},
+		},
+	}
+	if !reflect.DeepEqual(ls, want) {
+		t.Errorf("got layouts %+v, want %+v", ls, want)
+	}
+}
+
+func TestTypeLayoutConditional(t *testing.T) {
+	for _, tc := range []struct {
+		layout string
+		want   typeLayout
+	}{
+		{
+			layout: "wide",
+			want: typeLayout{
+				Name:   "Sigaction",
+				Layout: "wide",
+				Size:   16,
+				Align:  8,
+				Fields: []fieldLayout{
+					{Name: "Flags", Type: "uint32", Offset: 0, Size: 4},
+					{Name: "_", Type: "uint32", Offset: 4, Size: 4},
+					{Name: "Restorer", Type: "uint64", Offset: 8, Size: 8},
+				},
+			},
+		},
+		{
+			layout: DefaultLayout,
+			want: typeLayout{
+				Name:   "Sigaction",
+				Layout: DefaultLayout,
+				Size:   4,
+				Align:  4,
+				Fields: []fieldLayout{
+					{Name: "Flags", Type: "uint32", Offset: 0, Size: 4},
+				},
+			},
+		},
+	} {
+		ls, _ := layouts(t, tc.layout)
+		if want := []typeLayout{tc.want}; !reflect.DeepEqual(ls, want) {
+			t.Errorf("got layouts %+v for layout %q, want %+v", ls, tc.layout, want)
+		}
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	timespec := func() typeLayout {
+		return typeLayout{
+			Name:  "Timespec",
+			Size:  16,
+			Align: 8,
+			Fields: []fieldLayout{
+				{Name: "Sec", Type: "int64", Offset: 0, Size: 8},
+				{Name: "Nsec", Type: "int64", Offset: 8, Size: 8},
+			},
+		}
+	}
+	stat := func() typeLayout {
+		return typeLayout{
+			Name:  "Stat",
+			Size:  64,
+			Align: 8,
+			Fields: []fieldLayout{
+				{Name: "Ino", Type: "uint64", Offset: 0, Size: 8},
+				{Name: "Mode", Type: "uint32", Offset: 8, Size: 4},
+				{Name: "_", Type: "[4]byte", Offset: 12, Size: 4},
+				{Name: "ATime", Type: "Timespec", Offset: 16, Size: 16},
+				{Name: "Times", Type: "[2]Timespec", Offset: 32, Size: 32},
+			},
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		layout string
+		budget func() []typeLayout
+		// want are the lines of the expected error, or nil if the budget
+		// matches.
+		want []string
+	}{
+		{
+			name:   "match",
+			budget: func() []typeLayout { return []typeLayout{timespec()} },
+		},
+		{
+			name: "sizes only",
+			budget: func() []typeLayout {
+				l := stat()
+				l.Fields = nil
+				return []typeLayout{l}
+			},
+		},
+		{
+			name: "other types and layouts are ignored",
+			budget: func() []typeLayout {
+				return []typeLayout{
+					{Name: "Unknown", Size: 1, Align: 1},
+					{Name: "Sigaction", Layout: "wide", Size: 1, Align: 1},
+				}
+			},
+		},
+		{
+			name: "wrong size",
+			budget: func() []typeLayout {
+				l := timespec()
+				l.Size = 12
+				l.Fields[1].Type = "int32"
+				l.Fields[1].Size = 4
+				return []typeLayout{l}
+			},
+			want: []string{
+				"Layout of Timespec doesn't match the budget:",
+				"    size is 16, budget is 12",
+				"    field 1 (Nsec) has type int64, budget is int32",
+				"    field 1 (Nsec) has size 8, budget is 4",
+			},
+		},
+		{
+			name: "reordered fields",
+			budget: func() []typeLayout {
+				// Ino is moved after Mode and its padding.
+				l := stat()
+				l.Fields[0], l.Fields[1], l.Fields[2] = l.Fields[1], l.Fields[2], l.Fields[0]
+				l.Fields[0].Offset, l.Fields[1].Offset, l.Fields[2].Offset = 0, 4, 8
+				return []typeLayout{l}
+			},
+			want: []string{
+				"Layout of Stat doesn't match the budget:",
+				"    field 0 is Ino, budget is Mode",
+				"    field 0 (Ino) has type uint64, budget is uint32",
+				"    field 0 (Ino) has size 8, budget is 4",
+				"    field 1 is Mode, budget is _",
+				"    field 1 (Mode) has type uint32, budget is [4]byte",
+				"    field 1 (Mode) is at offset 8, budget is 4",
+				"    field 2 is _, budget is Ino",
+				"    field 2 (_) has type [4]byte, budget is uint64",
+				"    field 2 (_) is at offset 12, budget is 8",
+				"    field 2 (_) has size 4, budget is 8",
+			},
+		},
+		{
+			name: "added and removed fields",
+			budget: func() []typeLayout {
+				l1 := timespec()
+				l1.Fields = l1.Fields[:1]
+				l2 := stat()
+				l2.Fields = append(l2.Fields, fieldLayout{Name: "Extra", Type: "uint64", Offset: 64, Size: 8})
+				return []typeLayout{l1, l2}
+			},
+			want: []string{
+				"Layout of Timespec doesn't match the budget:",
+				"    field 1 (Nsec int64) at offset 8 isn't in the budget",
+				"Layout of Stat doesn't match the budget:",
+				"    field 5 (Extra uint64) at offset 64 is missing",
+			},
+		},
+		{
+			name:   "not generated for layout",
+			layout: "wide",
+			budget: func() []typeLayout {
+				l := timespec()
+				l.Layout = "wide"
+				return []typeLayout{l}
+			},
+			want: []string{
+				`Timespec is in the budget for layout "wide", but isn't generated for it`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ls, marked := layouts(t, tc.layout)
+			err := checkBudget(tc.budget(), ls, marked, tc.layout)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("checkBudget failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("checkBudget succeeded, want error")
+			}
+			if got, want := err.Error(), strings.Join(tc.want, "\n"); got != want {
+				t.Errorf("got error:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -46,6 +46,9 @@ func kindString(e ast.Expr) string {
 	case *ast.Ident:
 		return "scalar"
 	case *ast.ArrayType:
+		if e.(*ast.ArrayType).Len == nil {
+			return "slice"
+		}
 		return "array"
 	case *ast.StructType:
 		return "struct"
@@ -70,6 +73,7 @@ type fieldDispatcher struct {
 	primitive func(n, t *ast.Ident)
 	selector  func(n, tX, tSel *ast.Ident)
 	array     func(n, t *ast.Ident, size int)
+	mapType   func(n *ast.Ident, m *ast.MapType)
 	unhandled func(n *ast.Ident)
 }
 
@@ -113,12 +117,48 @@ func (fd fieldDispatcher) dispatch(f *ast.Field) {
 			default:
 				fd.array(name, nil, len)
 			}
+		case *ast.MapType:
+			fd.mapType(name, v)
 		default:
 			fd.unhandled(name)
 		}
 	}
 }
 
+// primitiveSize returns the size of the primitive type named name. ok is false
+// if name isn't a primitive type.
+func primitiveSize(name string) (size int, ok bool) {
+	switch name {
+	case "int8", "uint8", "byte":
+		return 1, true
+	case "int16", "uint16":
+		return 2, true
+	case "int32", "uint32":
+		return 4, true
+	case "int64", "uint64":
+		return 8, true
+	default:
+		return 0, false
+	}
+}
+
+// isByte returns true if t is the byte type, so that arrays of t can be
+// copied to and from marshalled buffers directly.
+func isByte(t *ast.Ident) bool {
+	return t.Name == "byte" || t.Name == "uint8"
+}
+
+// hasMapFields returns true if the struct type t has map fields, which are
+// marshalled as arrays sorted by key.
+func hasMapFields(t *ast.TypeSpec) bool {
+	for _, f := range t.Type.(*ast.StructType).Fields.List {
+		if _, ok := f.Type.(*ast.MapType); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // debugEnabled indicates whether debugging is enabled for gomarshal.
 func debugEnabled() bool {
 	return *debug
@@ -371,13 +411,19 @@ func (i *importTable) write(out io.Writer) error {
 		return nil
 	}
 
-	imports := make([]string, 0, len(i.is))
+	imports := make([]*importStmt, 0, len(i.is))
 	for _, i := range i.is {
 		if i.used {
-			imports = append(imports, i.String())
+			imports = append(imports, i)
 		}
 	}
-	sort.Strings(imports)
+	// Like gofmt, sort imports by path, whether they're aliased or not.
+	sort.Slice(imports, func(a, b int) bool {
+		if imports[a].path != imports[b].path {
+			return imports[a].path < imports[b].path
+		}
+		return imports[a].name < imports[b].name
+	})
 
 	var b sourceBuffer
 	b.emit("import (\n")
@@ -35,6 +35,10 @@ var (
 	output     = flag.String("output", "", "output file")
 	outputTest = flag.String("output_test", "", "output file for tests")
 	imports    = flag.String("imports", "", "comma-separated list of extra packages to import in generated code")
+	layouts    = flag.String("layouts", "", "comma-separated list of build tags selecting the layouts of types with conditional fields")
+	layout     = flag.String("layout", "", "layout to generate: one of -layouts, or \""+gomarshal.DefaultLayout+"\" for the layout used when none of them is set; if empty, only types without conditional fields are generated")
+	report     = flag.String("report", "", "output file for a JSON report of the sizes, alignments and field offsets of the generated types")
+	budget     = flag.String("budget", "", "JSON file of expected type layouts, in the format of -report; generation fails if the generated layouts differ")
 )
 
 func main() {
@@ -61,7 +65,11 @@ func main() {
 		// as an import.
 		extraImports = strings.Split(*imports, ",")
 	}
-	g, err := gomarshal.NewGenerator(flag.Args(), *output, *outputTest, *pkg, extraImports)
+	var layoutTags []string
+	if len(*layouts) > 0 {
+		layoutTags = strings.Split(*layouts, ",")
+	}
+	g, err := gomarshal.NewGenerator(flag.Args(), *output, *outputTest, *pkg, extraImports, layoutTags, *layout, *report, *budget)
 	if err != nil {
 		panic(err)
 	}
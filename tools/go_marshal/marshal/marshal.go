@@ -21,6 +21,8 @@
 package marshal
 
 import (
+	"bytes"
+
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -50,6 +52,11 @@ type Marshallable interface {
 	// SizeBytes() long.
 	MarshalBytes(dst []byte)
 
+	// MarshalBytesTo serializes a copy of a type to dst like MarshalBytes,
+	// and returns the remainder of dst following the serialized bytes. This
+	// allows multiple types to be marshalled into a single buffer in sequence.
+	MarshalBytesTo(dst []byte) []byte
+
 	// UnmarshalBytes deserializes a type from src. src must be at least
 	// SizeBytes() long.
 	UnmarshalBytes(src []byte)
@@ -92,3 +99,18 @@ type Marshallable interface {
 	// memory by directly serializing from the object's underlying memory.
 	CopyOut(task Task, addr usermem.Addr) (int, error)
 }
+
+// MaxMapLen is the largest number of entries CopyIn accepts for a map field
+// tagged `marshal:"sorted"`, which bounds the memory allocated to read it.
+const MaxMapLen = 1 << 16
+
+// LessBytes returns true if the marshalled form of a sorts before the
+// marshalled form of b. It orders the keys of map fields tagged
+// `marshal:"sorted"` that aren't primitive types.
+func LessBytes(a, b Marshallable) bool {
+	aBuf := make([]byte, a.SizeBytes())
+	a.MarshalBytes(aBuf)
+	bBuf := make([]byte, b.SizeBytes())
+	b.MarshalBytes(bBuf)
+	return bytes.Compare(aBuf, bBuf) < 0
+}
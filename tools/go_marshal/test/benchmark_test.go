@@ -22,8 +22,10 @@ import (
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/binary"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/tools/go_marshal/analysis"
+	"gvisor.dev/gvisor/tools/go_marshal/marshal"
 	test "gvisor.dev/gvisor/tools/go_marshal/test"
 )
 
@@ -50,7 +52,7 @@ func BenchmarkEncodingBinary(b *testing.B) {
 	b.StopTimer()
 
 	// Sanity check, make sure the values were preserved.
-	if !reflect.DeepEqual(s1, s2) {
+	if !s1.Equals(s2) {
 		panic(fmt.Sprintf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2))
 	}
 }
@@ -73,7 +75,7 @@ func BenchmarkBinary(b *testing.B) {
 	b.StopTimer()
 
 	// Sanity check, make sure the values were preserved.
-	if !reflect.DeepEqual(s1, s2) {
+	if !s1.Equals(s2) {
 		panic(fmt.Sprintf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2))
 	}
 }
@@ -130,7 +132,7 @@ func BenchmarkMarshalManual(b *testing.B) {
 	b.StopTimer()
 
 	// Sanity check, make sure the values were preserved.
-	if !reflect.DeepEqual(s1, s2) {
+	if !s1.Equals(s2) {
 		panic(fmt.Sprintf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2))
 	}
 }
@@ -151,7 +153,7 @@ func BenchmarkGoMarshalSafe(b *testing.B) {
 	b.StopTimer()
 
 	// Sanity check, make sure the values were preserved.
-	if !reflect.DeepEqual(s1, s2) {
+	if !s1.Equals(s2) {
 		panic(fmt.Sprintf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2))
 	}
 }
@@ -172,7 +174,125 @@ func BenchmarkGoMarshalUnsafe(b *testing.B) {
 	b.StopTimer()
 
 	// Sanity check, make sure the values were preserved.
-	if !reflect.DeepEqual(s1, s2) {
+	if !s1.Equals(s2) {
 		panic(fmt.Sprintf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2))
 	}
 }
+
+// ioTask implements marshal.Task over an IOSequence, so that CopyIn and CopyOut
+// can be measured without a real task. The IOSequence is backed by a byte
+// slice to isolate the cost of marshalling from that of accessing memory.
+type ioTask struct {
+	ctx     context.Context
+	ios     usermem.IOSequence
+	scratch []byte
+}
+
+var _ marshal.Task = (*ioTask)(nil)
+
+func newIOTask(size int) *ioTask {
+	return &ioTask{
+		ctx: context.Background(),
+		ios: usermem.BytesIOSequence(make([]byte, size)),
+	}
+}
+
+// CopyScratchBuffer implements marshal.Task.CopyScratchBuffer.
+func (t *ioTask) CopyScratchBuffer(size int) []byte {
+	if len(t.scratch) < size {
+		t.scratch = make([]byte, size)
+	}
+	return t.scratch[:size]
+}
+
+// CopyOutBytes implements marshal.Task.CopyOutBytes.
+func (t *ioTask) CopyOutBytes(addr usermem.Addr, b []byte) (int, error) {
+	return t.ios.DropFirst(int(addr)).CopyOut(t.ctx, b)
+}
+
+// CopyInBytes implements marshal.Task.CopyInBytes.
+func (t *ioTask) CopyInBytes(addr usermem.Addr, b []byte) (int, error) {
+	return t.ios.DropFirst(int(addr)).CopyIn(t.ctx, b)
+}
+
+// Marshalling to an IOSequence with the go_marshal unsafe API, then copying
+// the marshalled bytes. This is what CopyIn and CopyOut replace.
+func BenchmarkGoMarshalUnsafeIOSequence(b *testing.B) {
+	var s1, s2 test.Stat
+	analysis.RandomizeValue(&s1)
+	task := newIOTask(s1.SizeBytes())
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		s1.Ino = uint64(n)
+		buf := make([]byte, s1.SizeBytes())
+		s1.MarshalUnsafe(buf)
+		if _, err := task.CopyOutBytes(0, buf); err != nil {
+			b.Fatalf("CopyOutBytes failed: %v", err)
+		}
+		if _, err := task.CopyInBytes(0, buf); err != nil {
+			b.Fatalf("CopyInBytes failed: %v", err)
+		}
+		s2.UnmarshalUnsafe(buf)
+		if !s1.Equals(s2) {
+			b.Fatalf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2)
+		}
+	}
+}
+
+// Marshalling directly to an IOSequence with go_marshal's CopyOut and CopyIn.
+// Stat is packed, so neither copies through an intermediate buffer.
+func BenchmarkGoMarshalCopyIOSequence(b *testing.B) {
+	var s1, s2 test.Stat
+	analysis.RandomizeValue(&s1)
+	if !s1.Packed() {
+		b.Fatalf("Stat isn't packed, CopyIn and CopyOut won't take the fast path")
+	}
+	task := newIOTask(s1.SizeBytes())
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		s1.Ino = uint64(n)
+		if _, err := s1.CopyOut(task, 0); err != nil {
+			b.Fatalf("CopyOut failed: %v", err)
+		}
+		if _, err := s2.CopyIn(task, 0); err != nil {
+			b.Fatalf("CopyIn failed: %v", err)
+		}
+		if !s1.Equals(s2) {
+			b.Fatalf("Data corruption across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v\n", s1, s2)
+		}
+	}
+}
+
+// Comparison with the generated Equals method.
+func BenchmarkEqualsGoMarshal(b *testing.B) {
+	var s1 test.Stat
+	analysis.RandomizeValue(&s1)
+	s2 := s1.DeepCopy()
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if !s1.Equals(s2) {
+			b.Fatalf("Copies not equal:\nOriginal: %+v\nCopy: %+v\n", s1, s2)
+		}
+	}
+}
+
+// Comparison with reflect.DeepEqual.
+func BenchmarkEqualsReflect(b *testing.B) {
+	var s1 test.Stat
+	analysis.RandomizeValue(&s1)
+	s2 := s1.DeepCopy()
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if !reflect.DeepEqual(s1, s2) {
+			b.Fatalf("Copies not equal:\nOriginal: %+v\nCopy: %+v\n", s1, s2)
+		}
+	}
+}
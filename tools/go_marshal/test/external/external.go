@@ -17,7 +17,7 @@ package external
 
 // External is a public Marshallable type for use in testing.
 //
-// +marshal
+// +marshal equals
 type External struct {
 	j int64
 }
@@ -0,0 +1,32 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layout contains data structures for testing the conditional fields
+// of the go_marshal tool.
+package layout
+
+// Sigaction is a test data type whose layout depends on the build tag
+// marshal_wide, like struct sigaction does on the architecture.
+//
+// +marshal
+type Sigaction struct {
+	Flags uint32
+	_     uint32 `marshal:"build=marshal_wide"` // Padding of 64-bit layouts.
+	// Handler is 64 bits in all layouts, which isn't the case in Linux, to
+	// keep this struct aligned in both.
+	Handler uint64
+
+	// Restorer is only part of the wide layout.
+	Restorer uint64 `marshal:"build=marshal_wide"`
+}
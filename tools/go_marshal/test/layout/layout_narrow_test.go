@@ -0,0 +1,30 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !marshal_wide
+// +build !marshal_wide
+
+package layout
+
+// The narrow layout of Sigaction packs Handler right after Flags and omits
+// Restorer.
+const (
+	wideSigaction     = false
+	wantSigactionSize = 12
+)
+
+var wantSigactionBytes = []byte{
+	0x04, 0x03, 0x02, 0x01,
+	0x18, 0x17, 0x16, 0x15, 0x14, 0x13, 0x12, 0x11,
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSigactionLayout(t *testing.T) {
+	s := Sigaction{
+		Flags:    0x01020304,
+		Handler:  0x1112131415161718,
+		Restorer: 0x2122232425262728,
+	}
+	if got := s.SizeBytes(); got != wantSigactionSize {
+		t.Fatalf("SizeBytes() = %d, want %d", got, wantSigactionSize)
+	}
+
+	buf := make([]byte, s.SizeBytes())
+	s.MarshalBytes(buf)
+	if !bytes.Equal(buf, wantSigactionBytes) {
+		t.Errorf("MarshalBytes() = %x, want %x", buf, wantSigactionBytes)
+	}
+	unsafeBuf := make([]byte, s.SizeBytes())
+	s.MarshalUnsafe(unsafeBuf)
+	if !bytes.Equal(unsafeBuf, wantSigactionBytes) {
+		t.Errorf("MarshalUnsafe() = %x, want %x", unsafeBuf, wantSigactionBytes)
+	}
+
+	var got Sigaction
+	got.UnmarshalBytes(buf)
+	if !wideSigaction {
+		// Restorer isn't part of the narrow layout.
+		s.Restorer = 0
+	}
+	if got != s {
+		t.Errorf("UnmarshalBytes(%x) = %+v, want %+v", buf, got, s)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package marshal_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/tools/go_marshal/analysis"
+	"gvisor.dev/gvisor/tools/go_marshal/marshal"
+	test "gvisor.dev/gvisor/tools/go_marshal/test"
+	ex "gvisor.dev/gvisor/tools/go_marshal/test/external"
+)
+
+// Test that MarshalBytesTo can chain multiple types into a single buffer.
+func TestMarshalBytesToChained(t *testing.T) {
+	var s1, s2 test.Stat
+	var ts1, ts2 test.Timespec
+	analysis.RandomizeValue(&s1)
+	analysis.RandomizeValue(&ts1)
+
+	buf := make([]byte, s1.SizeBytes()+ts1.SizeBytes())
+	rest := s1.MarshalBytesTo(buf)
+	if got, want := len(rest), ts1.SizeBytes(); got != want {
+		t.Fatalf("Stat.MarshalBytesTo returned %d bytes, want %d", got, want)
+	}
+	rest = ts1.MarshalBytesTo(rest)
+	if len(rest) != 0 {
+		t.Fatalf("Timespec.MarshalBytesTo returned %d bytes, want 0", len(rest))
+	}
+
+	s2.UnmarshalBytes(buf)
+	ts2.UnmarshalBytes(buf[s2.SizeBytes():])
+	if !reflect.DeepEqual(s1, s2) {
+		t.Errorf("Stat corrupted across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v", s1, s2)
+	}
+	if !reflect.DeepEqual(ts1, ts2) {
+		t.Errorf("Timespec corrupted across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v", ts1, ts2)
+	}
+}
+
+// Test that maps are marshalled identically regardless of their iteration
+// order, sorted by key, and rebuilt by UnmarshalBytes.
+func TestSortedMapsStable(t *testing.T) {
+	var x test.SortedMaps
+	analysis.RandomizeValue(&x)
+	// Enough entries that iterating over the map twice is unlikely to yield
+	// the same order.
+	x.Counts = make(map[uint32]int64)
+	for i := uint32(0); i < 64; i++ {
+		x.Counts[i*7919] = int64(i)
+	}
+
+	buf1 := make([]byte, x.SizeBytes())
+	x.MarshalBytes(buf1)
+	buf2 := make([]byte, x.SizeBytes())
+	x.MarshalBytes(buf2)
+	if !bytes.Equal(buf1, buf2) {
+		t.Fatalf("Marshalling the same maps twice isn't stable:\nFirst: %v\nSecond: %v", buf1, buf2)
+	}
+
+	// Counts follows Version and padding, and its entries are 12 bytes long.
+	counts := buf1[8:]
+	if got, want := usermem.ByteOrder.Uint32(counts), uint32(len(x.Counts)); got != want {
+		t.Fatalf("Marshalled length of Counts: got %d, want %d", got, want)
+	}
+	counts = counts[4:]
+	for i := uint32(0); i < 64; i++ {
+		if got, want := usermem.ByteOrder.Uint32(counts[i*12:]), i*7919; got != want {
+			t.Errorf("Marshalled key %d of Counts: got %d, want %d", i, got, want)
+		}
+	}
+
+	var y test.SortedMaps
+	y.UnmarshalBytes(buf1)
+	if !reflect.DeepEqual(x, y) {
+		t.Fatalf("SortedMaps corrupted across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v", x, y)
+	}
+	buf3 := make([]byte, y.SizeBytes())
+	y.MarshalBytes(buf3)
+	if !bytes.Equal(buf1, buf3) {
+		t.Errorf("Marshalling rebuilt maps isn't stable:\nBefore: %v\nAfter: %v", buf1, buf3)
+	}
+}
+
+// Test that Equals ignores padding, unlike reflect.DeepEqual, but not other
+// fields.
+func TestEqualsIgnoresPadding(t *testing.T) {
+	var s1, s2 test.Stat
+	analysis.RandomizeValue(&s1)
+
+	// UnmarshalUnsafe copies padding from the buffer, while UnmarshalBytes
+	// skips it.
+	buf := make([]byte, s1.SizeBytes())
+	s1.MarshalBytes(buf)
+	for _, pad := range [][]byte{buf[36:40], buf[120:]} {
+		for i := range pad {
+			pad[i] = 0xff
+		}
+	}
+	s2.UnmarshalUnsafe(buf)
+	if reflect.DeepEqual(s1, s2) {
+		t.Fatalf("Padding of Stat unchanged by UnmarshalUnsafe: %+v", s2)
+	}
+	if !s1.Equals(s2) {
+		t.Errorf("Stat with different padding not equal:\nBefore: %+v\nAfter: %+v", s1, s2)
+	}
+
+	s2.MTime.Nsec++
+	if s1.Equals(s2) {
+		t.Errorf("Stat with different MTime equal:\nBefore: %+v\nAfter: %+v", s1, s2)
+	}
+}
+
+// Test that DeepCopy copies maps, and that Equals compares their entries.
+func TestSortedMapsDeepCopy(t *testing.T) {
+	var x test.SortedMaps
+	analysis.RandomizeValue(&x)
+	y := x.DeepCopy()
+	if !x.Equals(y) {
+		t.Fatalf("SortedMaps not equal to its copy:\nOriginal: %+v\nCopy: %+v", x, y)
+	}
+
+	var key uint32
+	for key = range y.Counts {
+		break
+	}
+	y.Counts[key]++
+	if x.Counts[key] == y.Counts[key] {
+		t.Fatalf("SortedMaps copy shares Counts with the original: %+v", x)
+	}
+	if x.Equals(y) {
+		t.Errorf("SortedMaps with different Counts equal:\nOriginal: %+v\nCopy: %+v", x, y)
+	}
+
+	y = x.DeepCopy()
+	y.Times[test.Timespec{Sec: -1}] = ex.External{}
+	if x.Equals(y) {
+		t.Errorf("SortedMaps with different Times equal:\nOriginal: %+v\nCopy: %+v", x, y)
+	}
+}
+
+// Test that arrays are marshalled element by element, in order, and that
+// UnmarshalBytes restores them.
+func TestArrays(t *testing.T) {
+	var x test.Arrays
+	copy(x.Name[:], "gvisor")
+	for i := range x.Groups {
+		x.Groups[i] = uint32(1000 + i)
+	}
+	x.Times[1] = test.Timespec{Sec: 1, Nsec: 2}
+	x.Ports = [3]int16{-1, 80, 443}
+
+	buf := make([]byte, x.SizeBytes())
+	x.MarshalBytes(buf)
+	if got, want := string(buf[:6]), "gvisor"; got != want {
+		t.Errorf("Name marshalled as %q, want %q", got, want)
+	}
+	for i := range x.Groups {
+		if got, want := usermem.ByteOrder.Uint32(buf[32+4*i:]), x.Groups[i]; got != want {
+			t.Errorf("Groups[%d] marshalled as %d, want %d", i, got, want)
+		}
+	}
+	if got, want := usermem.ByteOrder.Uint64(buf[112:]), uint64(1); got != want {
+		t.Errorf("Times[1].Sec marshalled as %d, want %d", got, want)
+	}
+	if got, want := int16(usermem.ByteOrder.Uint16(buf[128:])), int16(-1); got != want {
+		t.Errorf("Ports[0] marshalled as %d, want %d", got, want)
+	}
+
+	var y test.Arrays
+	y.UnmarshalBytes(buf)
+	if !x.Equals(y) {
+		t.Errorf("Arrays corrupted across marshal/unmarshal cycle:\nBefore: %+v\nAfter: %+v", x, y)
+	}
+}
+
+// Test that RandomizeValue fills the maps held by array elements.
+func TestRandomizeArrayOfMaps(t *testing.T) {
+	var xs [4]test.SortedMaps
+	analysis.RandomizeValue(&xs)
+	for i, x := range xs {
+		if len(x.Counts) == 0 || len(x.Times) == 0 {
+			t.Errorf("RandomizeValue left the maps of element %d empty: %+v", i, x)
+		}
+	}
+}
+
+// mockTask implements marshal.Task over a byte slice standing in for user
+// memory, which is filled with 0xff so that untouched bytes can be detected.
+type mockTask struct {
+	mem     []byte
+	scratch []byte
+}
+
+func newMockTask(size int) *mockTask {
+	return &mockTask{mem: bytes.Repeat([]byte{0xff}, size)}
+}
+
+// CopyScratchBuffer implements marshal.Task.CopyScratchBuffer.
+func (m *mockTask) CopyScratchBuffer(size int) []byte {
+	if len(m.scratch) < size {
+		m.scratch = make([]byte, size)
+	}
+	return m.scratch[:size]
+}
+
+// CopyOutBytes implements marshal.Task.CopyOutBytes.
+func (m *mockTask) CopyOutBytes(addr usermem.Addr, b []byte) (int, error) {
+	return copy(m.mem[addr:], b), nil
+}
+
+// CopyInBytes implements marshal.Task.CopyInBytes.
+func (m *mockTask) CopyInBytes(addr usermem.Addr, b []byte) (int, error) {
+	return copy(b, m.mem[addr:]), nil
+}
+
+// copyRecorder wraps a mockTask and records the buffers passed to CopyOutBytes
+// and CopyInBytes.
+type copyRecorder struct {
+	*mockTask
+	out, in []byte
+}
+
+// CopyOutBytes implements marshal.Task.CopyOutBytes.
+func (r *copyRecorder) CopyOutBytes(addr usermem.Addr, b []byte) (int, error) {
+	r.out = b
+	return r.mockTask.CopyOutBytes(addr, b)
+}
+
+// CopyInBytes implements marshal.Task.CopyInBytes.
+func (r *copyRecorder) CopyInBytes(addr usermem.Addr, b []byte) (int, error) {
+	r.in = b
+	return r.mockTask.CopyInBytes(addr, b)
+}
+
+// Test that CopyOut and CopyIn copy directly from and to the memory of packed
+// types, and through the scratch buffer for other types.
+func TestCopyFastPath(t *testing.T) {
+	var s test.Stat
+	analysis.RandomizeValue(&s)
+	var a test.Arrays
+	analysis.RandomizeValue(&a)
+	var x test.Type1
+
+	for _, tc := range []struct {
+		name   string
+		val    marshal.Marshallable
+		ptr    unsafe.Pointer
+		direct bool
+	}{
+		{"packed", &s, unsafe.Pointer(&s), true},
+		{"packed arrays", &a, unsafe.Pointer(&a), true},
+		{"unaligned", &x, unsafe.Pointer(&x), false},
+	} {
+		if got := tc.val.Packed(); got != tc.direct {
+			t.Fatalf("%s: Packed() = %t, want %t", tc.name, got, tc.direct)
+		}
+		task := &copyRecorder{mockTask: newMockTask(tc.val.SizeBytes())}
+		if _, err := tc.val.CopyOut(task, 0); err != nil {
+			t.Fatalf("%s: CopyOut failed: %v", tc.name, err)
+		}
+		if _, err := tc.val.CopyIn(task, 0); err != nil {
+			t.Fatalf("%s: CopyIn failed: %v", tc.name, err)
+		}
+		for _, op := range []struct {
+			name string
+			buf  []byte
+		}{
+			{"CopyOut", task.out},
+			{"CopyIn", task.in},
+		} {
+			if len(op.buf) != tc.val.SizeBytes() {
+				t.Fatalf("%s: %s copied %d bytes, want %d", tc.name, op.name, len(op.buf), tc.val.SizeBytes())
+			}
+			start := unsafe.Pointer(&op.buf[0])
+			if direct := start == tc.ptr; direct != tc.direct {
+				t.Errorf("%s: %s copied from the value's memory: %t, want %t", tc.name, op.name, direct, tc.direct)
+			}
+			if scratch := len(task.scratch) > 0 && start == unsafe.Pointer(&task.scratch[0]); scratch == tc.direct {
+				t.Errorf("%s: %s copied through the scratch buffer: %t, want %t", tc.name, op.name, scratch, !tc.direct)
+			}
+		}
+	}
+}
+
+// Test that CopyOutN copies a prefix of the marshalled type, and all of it
+// when the limit exceeds its size.
+func TestCopyOutN(t *testing.T) {
+	var s test.Stat
+	analysis.RandomizeValue(&s)
+	var m test.SortedMaps
+	analysis.RandomizeValue(&m)
+
+	for _, tc := range []struct {
+		name string
+		val  interface {
+			SizeBytes() int
+			MarshalBytes(dst []byte)
+			CopyOutN(task marshal.Task, addr usermem.Addr, limit int) (int, error)
+		}
+	}{
+		{"packed", &s},
+		{"maps", &m},
+	} {
+		size := tc.val.SizeBytes()
+		want := make([]byte, size)
+		tc.val.MarshalBytes(want)
+		for _, limit := range []int{0, 10, size - 1, size, size + 10} {
+			task := newMockTask(size + 16)
+			n, err := tc.val.CopyOutN(task, 0, limit)
+			if err != nil {
+				t.Fatalf("%s: CopyOutN(limit=%d) failed: %v", tc.name, limit, err)
+			}
+			wantN := limit
+			if wantN > size {
+				wantN = size
+			}
+			if n != wantN {
+				t.Errorf("%s: CopyOutN(limit=%d) = %d, want %d", tc.name, limit, n, wantN)
+			}
+			if got := task.mem[:wantN]; !bytes.Equal(got, want[:wantN]) {
+				t.Errorf("%s: CopyOutN(limit=%d) wrote %v, want %v", tc.name, limit, got, want[:wantN])
+			}
+			for i, b := range task.mem[wantN:] {
+				if b != 0xff {
+					t.Errorf("%s: CopyOutN(limit=%d) wrote byte %d past the limit", tc.name, limit, wantN+i)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Test that CopyOutN of a packed type doesn't allocate.
+func TestCopyOutNAllocs(t *testing.T) {
+	var s test.Stat
+	analysis.RandomizeValue(&s)
+	task := newMockTask(s.SizeBytes())
+	if allocs := testing.AllocsPerRun(100, func() {
+		s.CopyOutN(task, 0, 16)
+	}); allocs != 0 {
+		t.Errorf("CopyOutN allocated %v times per run, want 0", allocs)
+	}
+}
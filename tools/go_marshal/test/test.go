@@ -23,7 +23,7 @@ import (
 
 // Type1 is a test data type.
 //
-// +marshal
+// +marshal equals
 type Type1 struct {
 	a    Type2
 	x, y int64 // Multiple field names.
@@ -39,7 +39,7 @@ type Type1 struct {
 
 // Type2 is a test data type.
 //
-// +marshal
+// +marshal equals
 type Type2 struct {
 	n int64
 	c byte
@@ -50,7 +50,7 @@ type Type2 struct {
 
 // Type3 is a test data type.
 //
-// +marshal
+// +marshal equals
 type Type3 struct {
 	s int64
 	x ex.External // Type defined in another package.
@@ -77,7 +77,7 @@ type Type5 struct {
 
 // Timespec represents struct timespec in <time.h>.
 //
-// +marshal
+// +marshal equals copy
 type Timespec struct {
 	Sec  int64
 	Nsec int64
@@ -85,7 +85,7 @@ type Timespec struct {
 
 // Stat represents struct stat.
 //
-// +marshal
+// +marshal equals copy copyoutn
 type Stat struct {
 	Dev     uint64
 	Ino     uint64
@@ -103,3 +103,26 @@ type Stat struct {
 	CTime   Timespec
 	_       [3]int64
 }
+
+// Arrays is a test data type with fixed-size arrays of primitive and
+// Marshallable types.
+//
+// +marshal equals copy
+type Arrays struct {
+	Name   [32]byte
+	Groups [16]uint32
+	Times  [2]Timespec
+	Ports  [3]int16
+	_      [2]byte
+}
+
+// SortedMaps is a test data type with maps, which are marshalled as arrays
+// sorted by key.
+//
+// +marshal equals copy copyoutn
+type SortedMaps struct {
+	Version uint32
+	_       uint32
+	Counts  map[uint32]int64         `marshal:"sorted"`
+	Times   map[Timespec]ex.External `marshal:"sorted"` // Marshallable keys and values.
+}